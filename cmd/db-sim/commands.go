@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+	"database-sync-unsynchronized/pkg/sim"
+)
+
+// Without a command the program makes the full run, as "all" does: every
+// command in turn, each with the flags of its runs. A command runs one
+// scenario with parameters from its own flags, which follow it:
+//
+//	go run ./cmd/db-sim counter -clients 10 -increments 100
+//	go run ./cmd/db-sim -budget 5s bank -engine 2pl -transfers 500
+//	go run ./cmd/db-sim writeskew -h
+//
+// The global flags (-budget, -manifest, -log, ...) go before the command.
+
+// printCommands lists the commands on w
+func printCommands(w io.Writer) {
+	fmt.Fprintln(w, "Commands (run with -h for their flags):")
+	fmt.Fprintf(w, "  %-18s %s\n", "all", "every scenario with its fixed parameters (the default)")
+	fmt.Fprintf(w, "  %-18s %s\n", "compare", "every engine on every scenario that takes one, as correctness and performance matrices")
+	fmt.Fprintf(w, "  %-18s %s\n", "bench", "a CSV matrix of each engine's throughput and latency over goroutines, keys and read ratios")
+	fmt.Fprintf(w, "  %-18s %s\n", "sweep", "throughput and p99 latency of each engine at increasing client counts")
+	for _, c := range sim.Commands() {
+		fmt.Fprintf(w, "  %-18s %s\n", c.Name, c.Summary)
+	}
+}
+
+// runCommand runs the command args names, with the rest of args as its
+// flags, through manifest. It returns flag.ErrHelp if they asked for help.
+func runCommand(manifest *sim.RunManifest, args []string) error {
+	switch args[0] {
+	case "compare":
+		return runCompare(manifest, args[1:])
+	case "sweep":
+		return runSweep(manifest, args[1:])
+	case "bench":
+		return runBench(args[1:])
+	}
+	c, exists := sim.FindCommand(args[0])
+	if !exists {
+		return fmt.Errorf("%w %q", sim.ErrUnknownCommand, args[0])
+	}
+	scenario, err := c.Parse(newFlagSet(c.Name, c.Summary), args[1:])
+	if err != nil {
+		return err
+	}
+	manifest.Run(scenario)
+	return nil
+}
+
+// newFlagSet returns the flag set of the command called name, whose usage
+// says what it does
+func newFlagSet(name, summary string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [global flags] %s [flags]\n\n%s: %s\n\nFlags:\n", os.Args[0], name, name, summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args with fs, as Command.Parse does, and rejects
+// stray arguments
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return sim.ErrBadFlags
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%s: unexpected argument %q", fs.Name(), fs.Arg(0))
+	}
+	return nil
+}
+
+// splitList splits a comma-separated flag value
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// runCompare runs the compare command with flags args through manifest
+func runCompare(manifest *sim.RunManifest, args []string) error {
+	var defaultScenarios []string
+	for _, c := range sim.Commands() {
+		if c.TakesEngine() {
+			defaultScenarios = append(defaultScenarios, c.Name)
+		}
+	}
+
+	fs := newFlagSet("compare", "every engine on every scenario that takes one, as correctness and performance matrices")
+	scenarioList := fs.String("scenarios", strings.Join(defaultScenarios, ","), "comma-separated scenarios to run")
+	engineList := fs.String("engines", strings.Join(db.EngineVariants(), ","), "comma-separated engines to run them on")
+	verbose := fs.Bool("v", false, "show each run's own output")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	return sim.Compare(manifest, splitList(*scenarioList), splitList(*engineList), *verbose)
+}
+
+// runSweep runs the sweep command with flags args through manifest
+func runSweep(manifest *sim.RunManifest, args []string) error {
+	fs := newFlagSet("sweep", "throughput and p99 latency of each engine at increasing client counts")
+	engineList := fs.String("engines", "unsynchronized,synchronized/fair,2pl,mvcc,tso", "comma-separated engines to sweep")
+	levels := sim.IntListFlag(sim.DefaultSweepLevels)
+	fs.Var(&levels, "levels", "comma-separated client counts")
+	keys := fs.Int("keys", 100, "keys the clients operate on")
+	duration := fs.Duration("duration", 200*time.Millisecond, "how long each level runs")
+	verbose := fs.Bool("v", false, "show each level's own output")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := sim.ValidateFlags(fs); err != nil {
+		return fmt.Errorf("sweep: %w", err)
+	}
+	return sim.Sweep(manifest, splitList(*engineList), levels, *keys, *duration, *verbose)
+}
+
+// percentListFlag is a comma-separated list of percentages, such as
+// "0,50,100"
+type percentListFlag []int
+
+func (l *percentListFlag) String() string { return (*sim.IntListFlag)(l).String() }
+
+func (l *percentListFlag) Set(value string) error {
+	var list percentListFlag
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 || n > 100 {
+			return fmt.Errorf("%q is not a percentage from 0 to 100", part)
+		}
+		list = append(list, n)
+	}
+	*l = list
+	return nil
+}
+
+// runBench runs the bench command with flags args
+func runBench(args []string) error {
+	fs := newFlagSet("bench", "a CSV matrix of each engine's throughput and latency over goroutines, keys and read ratios")
+	engineList := fs.String("engines", "synchronized/fair,2pl,mvcc,tso", "comma-separated engines to measure (not unsynchronized, which crashes when run in parallel)")
+	goroutines := sim.IntListFlag(sim.DefaultBenchGoroutines)
+	fs.Var(&goroutines, "goroutines", "comma-separated goroutine counts")
+	keys := sim.IntListFlag(sim.DefaultBenchKeys)
+	fs.Var(&keys, "keys", "comma-separated key cardinalities")
+	reads := percentListFlag(sim.DefaultBenchReads)
+	fs.Var(&reads, "reads", "comma-separated percentages of transactions that read; the rest update")
+	duration := fs.Duration("duration", 100*time.Millisecond, "how long each cell runs")
+	outPath := fs.String("o", "", "write the CSV matrix to this file instead of standard output")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	engines := splitList(*engineList)
+	cells := sim.BenchCells(goroutines, keys, reads)
+	out, progress := io.Writer(os.Stdout), io.Writer(io.Discard)
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			return fmt.Errorf("bench: %w", err)
+		}
+		defer f.Close()
+		out, progress = f, os.Stdout
+	}
+	fmt.Fprintf(progress, "Measuring %d engines on %d cells, %v each\n", len(engines), len(cells), *duration)
+	if err := sim.Bench(context.Background(), out, progress, engines, cells, *duration); err != nil {
+		return fmt.Errorf("bench: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/sim"
+)
+
+// TestRunCommand verifies a command runs its one scenario with the
+// parameters from its flags
+func TestRunCommand(t *testing.T) {
+	manifest := sim.NewRunManifest(nil)
+	if err := runCommand(manifest, []string{"counter", "-engine", "2pl", "-clients", "3", "-increments", "20"}); err != nil {
+		t.Fatalf("runCommand: %v", err)
+	}
+	if len(manifest.Scenarios) != 1 {
+		t.Fatalf("ran %d scenarios, expected 1", len(manifest.Scenarios))
+	}
+	result := manifest.Scenarios[0]
+	if !result.Passed || result.Engine != "two-phase-locking" || result.Parameters["clients"] != 3 {
+		t.Errorf("result = %+v, expected a passing two-phase locking run with 3 clients", result)
+	}
+}
+
+// TestRunCommandRejectsBadArguments verifies unknown commands, malformed
+// and invalid flags and stray arguments are errors and run nothing
+func TestRunCommandRejectsBadArguments(t *testing.T) {
+	cases := []struct {
+		args []string
+		want error
+	}{
+		{[]string{"nope"}, sim.ErrUnknownCommand},
+		{[]string{"counter", "-engine", "btree"}, sim.ErrBadFlags},
+		{[]string{"counter", "-clients", "many"}, sim.ErrBadFlags},
+		{[]string{"counter", "-h"}, flag.ErrHelp},
+		{[]string{"counter", "-clients", "0"}, nil},
+		{[]string{"writeskew", "-isolation", "Snapshot"}, nil},
+		{[]string{"counter", "extra"}, nil},
+		{[]string{"ratelimit", "-global-rate", "-1"}, nil},
+		{[]string{"compare", "-engines", "btree"}, nil},
+		{[]string{"compare", "-scenarios", "nope"}, sim.ErrUnknownCommand},
+		{[]string{"compare", "-scenarios", "raft"}, nil},
+		{[]string{"compare", "-engines", ""}, nil},
+		{[]string{"compare", "extra"}, nil},
+		{[]string{"sweep", "-engines", "btree"}, nil},
+		{[]string{"sweep", "-levels", "0"}, sim.ErrBadFlags},
+		{[]string{"sweep", "-duration", "0s"}, nil},
+		{[]string{"sweep", "-keys", "0"}, nil},
+		{[]string{"bench", "-reads", "0,101"}, sim.ErrBadFlags},
+		{[]string{"bench", "-engines", "unsynchronized"}, nil},
+	}
+	for _, c := range cases {
+		manifest := sim.NewRunManifest(nil)
+		err := runCommand(manifest, c.args)
+		if err == nil {
+			t.Errorf("%v: no error", c.args)
+		} else if c.want != nil && !errors.Is(err, c.want) {
+			t.Errorf("%v: error %v, expected %v", c.args, err, c.want)
+		}
+		if len(manifest.Scenarios) != 0 {
+			t.Errorf("%v: ran a scenario", c.args)
+		}
+	}
+}
+
+// TestSweepCommand verifies the sweep command passes its flags to the
+// sweep
+func TestSweepCommand(t *testing.T) {
+	manifest := sim.NewRunManifest(nil)
+	if err := runCommand(manifest, []string{"sweep", "-engines", "2pl,tso", "-levels", "1,3", "-duration", "20ms"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Scenarios) != 4 || manifest.Scenarios[3].Engine != "timestamp-ordering" || manifest.Scenarios[3].Parameters["clients"] != 3 {
+		t.Errorf("ran %+v, expected 2PL and TSO at 1 and 3 clients", manifest.Scenarios)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+
+	"database-sync-unsynchronized/pkg/sim"
+)
+
+// The -debug-addr flag serves the runtime's profiles while the scenarios
+// run, so goroutine dumps and mutex profiles can be captured while
+// contention is happening:
+//
+//	go tool pprof http://localhost:6060/debug/pprof/mutex
+//	curl http://localhost:6060/debug/pprof/goroutine?debug=2
+//	curl http://localhost:6060/debug/vars
+//
+// /debug/vars holds expvar's memory statistics and, under "database", the
+// live counters of the database the current scenario runs on.
+
+// mutexProfileFraction and blockProfileRate are the sampling rates set
+// while the debug endpoint is up: one in 5 mutex contention events, and
+// one blocking event per 10µs spent blocked
+const (
+	mutexProfileFraction = 5
+	blockProfileRate     = int(10 * time.Microsecond)
+)
+
+// publishOnce publishes the "database" variable; expvar allows it once
+var publishOnce sync.Once
+
+// startDebugServer serves net/http/pprof under /debug/pprof/ and expvar
+// under /debug/vars on addr, and turns on mutex and block profiling. It
+// returns the address it listens on, which tells the port when addr asked
+// for any, and a function that stops the server and the profiling.
+func startDebugServer(addr string) (string, func(), error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", nil, err
+	}
+	publishOnce.Do(func() { expvar.Publish("database", expvar.Func(sim.DatabaseVars)) })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	previousFraction := runtime.SetMutexProfileFraction(mutexProfileFraction)
+	runtime.SetBlockProfileRate(blockProfileRate)
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+
+	stop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+		runtime.SetMutexProfileFraction(previousFraction)
+		runtime.SetBlockProfileRate(0)
+	}
+	return listener.Addr().String(), stop, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+	"database-sync-unsynchronized/pkg/sim"
+)
+
+// TestDebugServerServesProfilesAndCounters verifies the debug endpoint
+// serves pprof and the watched database's counters as expvar
+func TestDebugServerServesProfilesAndCounters(t *testing.T) {
+	addr, stop, err := startDebugServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("startDebugServer: %v", err)
+	}
+	defer stop()
+
+	sim.RunCounterScenario(context.Background(), db.NewTwoPhaseLockingDatabase(), 1, 1)
+
+	resp, err := http.Get("http://" + addr + "/debug/vars")
+	if err != nil {
+		t.Fatalf("GET /debug/vars: %v", err)
+	}
+	var vars struct {
+		Database struct {
+			Scenario string
+			Engine   string
+			Stats    db.Stats
+		} `json:"database"`
+		Memstats json.RawMessage `json:"memstats"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&vars)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Decoding /debug/vars: %v", err)
+	}
+	if vars.Database.Scenario != "counter" || vars.Database.Stats.Commits == 0 || len(vars.Memstats) == 0 {
+		t.Errorf("Expected the counter scenario's database with its commits and memory stats, got %+v", vars.Database)
+	}
+
+	resp, err = http.Get("http://" + addr + "/debug/pprof/goroutine?debug=1")
+	if err != nil {
+		t.Fatalf("GET goroutine profile: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "goroutine profile") {
+		t.Errorf("Expected a goroutine dump, got %d: %.100s", resp.StatusCode, body)
+	}
+
+	resp, err = http.Get("http://" + addr + "/debug/pprof/mutex?debug=1")
+	if err != nil {
+		t.Fatalf("GET mutex profile: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a mutex profile, got %d", resp.StatusCode)
+	}
+}
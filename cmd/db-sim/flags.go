@@ -0,0 +1,36 @@
+package main
+
+import (
+	"database-sync-unsynchronized/pkg/db"
+	"database-sync-unsynchronized/pkg/lock"
+)
+
+// processingDelayFlag is the -delays flag, which sets
+// db.DefaultProcessingDelays
+type processingDelayFlag struct{}
+
+func (processingDelayFlag) String() string { return db.DefaultProcessingDelays.String() }
+
+func (processingDelayFlag) Set(s string) error {
+	d, err := db.ParseProcessingDelays(s)
+	if err != nil {
+		return err
+	}
+	db.DefaultProcessingDelays = d
+	return nil
+}
+
+// backoffStrategyFlag is the -backoff flag, which sets the strategy of
+// db.DefaultRetryPolicy
+type backoffStrategyFlag struct{}
+
+func (backoffStrategyFlag) String() string { return db.DefaultRetryPolicy.Strategy.String() }
+
+func (backoffStrategyFlag) Set(s string) error {
+	strategy, err := lock.ParseBackoffStrategy(s)
+	if err != nil {
+		return err
+	}
+	db.DefaultRetryPolicy.Strategy = strategy
+	return nil
+}
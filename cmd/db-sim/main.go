@@ -0,0 +1,200 @@
+// Command db-sim runs the database simulator: the built-in scenarios of
+// package sim, or the command, workload file or server its flags ask for.
+//
+//	go run ./cmd/db-sim
+//	go run ./cmd/db-sim -seed 42 counter -engine mvcc
+//	go run ./cmd/db-sim -config workload.yaml
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+	"database-sync-unsynchronized/pkg/sim"
+)
+
+func main() {
+	lockdep := flag.Bool("lockdep", false, "record key lock order and report inversions at exit")
+	leakcheck := flag.Bool("leakcheck", true, "fail scenarios that leave goroutines running or transactions unfinished, and report unfinished transactions at exit")
+	serializability := flag.Bool("serializability", false, "journal every database and report whether each scenario's committed transactions were conflict-serializable")
+	flag.DurationVar(&sim.ScenarioBudget, "budget", sim.DefaultScenarioBudget, "wall-clock budget per scenario; work left when it runs out is cancelled")
+	manifestPath := flag.String("manifest", "run-manifest.json", "write a JSON manifest of the run's configuration, environment and results (empty to disable)")
+	resultsPath := flag.String("results", "", "add each scenario's results to this .csv or .json file as it finishes, for spreadsheets and notebooks")
+	snapshotDir := flag.String("snapshots", "", "save each scenario's final database state as a JSON snapshot in this directory")
+	serveAddr := flag.String("serve", "", "serve a two-phase locking database's REST API on this address (e.g. :8080) instead of running the scenarios")
+	logSink := flag.String("log", "", "write structured traces to stderr or this file (empty to disable)")
+	logFormat := flag.String("log-format", "json", "structured trace format: text or json")
+	logLevel := flag.String("log-level", "debug", "lowest structured trace level: debug (every operation), info (commits, aborts and scenario results), warn or error")
+	debugAddr := flag.String("debug-addr", "", "serve net/http/pprof and expvar database counters on this address (e.g. localhost:6060) while the scenarios run")
+	flag.Var(processingDelayFlag{}, "delays", `simulated processing time of each operation, "none" or settings such as "update=0,jitter=0.5" (see db.ParseProcessingDelays)`)
+	flag.Var(backoffStrategyFlag{}, "backoff", "how RunTransaction waits before retrying a conflict: sleep (exponential backoff with jitter), yield or none")
+	flag.IntVar(&db.DefaultStripes, "stripes", 0, "lock stripes of every synchronized database; 1 guards all records with one lock (0 is four per GOMAXPROCS)")
+	flag.Int64Var(&db.RunSeed, "seed", 0, "seed every client and scenario RNG, to repeat a run's operations (0 picks one from the clock and prints it)")
+	configPath := flag.String("config", "", "run the workload this YAML or JSON file describes instead of the built-in scenarios (see workload.yaml)")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s [flags] [command [command flags]]\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(out)
+		printCommands(out)
+	}
+	flag.Parse()
+
+	if *logSink != "" {
+		logger, closer, err := db.OpenTraceLog(*logSink, *logFormat, *logLevel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "opening trace log: %v\n", err)
+			os.Exit(1)
+		}
+		defer closer.Close()
+		db.SetTraceLogger(logger)
+	}
+
+	if *debugAddr != "" {
+		addr, stop, err := startDebugServer(*debugAddr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "starting debug endpoint: %v\n", err)
+			os.Exit(1)
+		}
+		defer stop()
+		fmt.Printf("Debug endpoint: http://%s/debug/pprof/ and http://%s/debug/vars\n", addr, addr)
+	}
+
+	if *serveAddr != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		fmt.Printf("Serving the REST API of a two-phase locking database on %s (Ctrl-C to stop)\n", *serveAddr)
+		if err := db.Serve(ctx, db.NewTwoPhaseLockingDatabase(), *serveAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "serve: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if db.RunSeed == 0 {
+		db.RunSeed = time.Now().UnixNano()
+	}
+	fmt.Printf("Seed: %d (rerun with -seed %d to repeat the run's operations)\n", db.RunSeed, db.RunSeed)
+
+	manifest := sim.NewRunManifest(os.Args[1:])
+	flag.VisitAll(func(f *flag.Flag) {
+		manifest.Flags[f.Name] = f.Value.String()
+	})
+	if *snapshotDir != "" {
+		if err := os.MkdirAll(*snapshotDir, 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "creating snapshot directory: %v\n", err)
+			os.Exit(1)
+		}
+		manifest.SnapshotDir = *snapshotDir
+	}
+	if *resultsPath != "" {
+		results, err := sim.OpenResultsFile(*resultsPath, manifest.StartedAt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "creating results file: %v\n", err)
+			os.Exit(1)
+		}
+		manifest.Results = results
+	}
+
+	if *lockdep {
+		db.EnableLockOrderChecking()
+		defer db.ReportLockOrderViolations()
+	}
+	if *leakcheck {
+		db.EnableLeakDetection()
+		defer db.ReportLeakedTransactions()
+	}
+	if *serializability {
+		db.EnableSerializabilityChecking()
+	}
+
+	if *configPath != "" {
+		workload, err := sim.LoadWorkloadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "loading workload: %v\n", err)
+			os.Exit(1)
+		}
+		d, err := workload.NewDatabase()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "loading workload: %v\n", err)
+			os.Exit(1)
+		}
+		manifest.Run(func(ctx context.Context) sim.ScenarioResult { return sim.RunWorkloadScenario(ctx, d, workload) })
+		writeManifest(manifest, *manifestPath)
+		return
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) != "all" {
+		if err := runCommand(manifest, flag.Args()); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return
+			}
+			if !errors.Is(err, sim.ErrBadFlags) {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+			}
+			if errors.Is(err, sim.ErrUnknownCommand) {
+				printCommands(os.Stderr)
+			}
+			os.Exit(2)
+		}
+		writeManifest(manifest, *manifestPath)
+		return
+	}
+
+	fmt.Println("╔═══════════════════════════════════════════════════════════╗")
+	fmt.Println("║   Database Synchronization Mini-Project                  ║")
+	fmt.Println("║   UNSYNCHRONIZED VERSION - Demonstrates Race Conditions   ║")
+	fmt.Println("╚═══════════════════════════════════════════════════════════╝")
+
+	fmt.Println("\n⚠️  WARNING: This code has NO synchronization!")
+	fmt.Println("⚠️  Running with multiple goroutines WILL cause race conditions.")
+	fmt.Println("⚠️  Run with: go run -race ./cmd/db-sim to detect data races")
+
+	// Run every command the way the full run does, in order
+	commands := sim.Commands()
+	for _, c := range commands {
+		fmt.Println("\n" + strings.Repeat("=", 60))
+		for _, args := range c.FullRuns() {
+			scenario, err := c.Parse(flag.NewFlagSet(c.Name, flag.ContinueOnError), args)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s %s: %v\n", c.Name, strings.Join(args, " "), err)
+				continue
+			}
+			manifest.Run(scenario)
+		}
+	}
+
+	fmt.Println("\n" + strings.Repeat("=", 60))
+	fmt.Println("\n✓ All scenarios completed!")
+	fmt.Println("\nTo see the race conditions detected by Go's race detector:")
+	fmt.Println("  go run -race ./cmd/db-sim")
+	fmt.Println("\nExpected behavior:")
+	for _, c := range commands {
+		lines := strings.Split(c.Expect, "\n")
+		fmt.Println("  - " + lines[0])
+		for _, line := range lines[1:] {
+			fmt.Println("    " + line)
+		}
+	}
+
+	writeManifest(manifest, *manifestPath)
+}
+
+// writeManifest writes the run manifest to path, unless path is empty
+func writeManifest(manifest *sim.RunManifest, path string) {
+	if path == "" {
+		return
+	}
+	if err := manifest.WriteFile(path); err != nil {
+		fmt.Fprintf(os.Stderr, "writing run manifest: %v\n", err)
+	} else {
+		fmt.Printf("\nRun manifest written to %s\n", path)
+	}
+}
@@ -0,0 +1,307 @@
+// Package httpapi serves a transactional key-value store over HTTP:
+//
+//	POST /tx                  begin a transaction; 201 {"id": 7}
+//	GET  /keys/{k}?tx=7       read k in transaction 7; 200 {"key": "k", "value": 1}
+//	PUT  /keys/{k}?tx=7       write {"value": 1} to k in transaction 7; 204
+//	POST /tx/7/commit         commit transaction 7; 204
+//	POST /tx/7/abort          abort transaction 7; 204
+//
+// Without ?tx, a read or write runs in a transaction of its own. The store
+// is anything that implements Store; errors it returns that wrap
+// ErrNotFound or ErrConflict become 404 and 409 responses. Requests are
+// served concurrently, except that the requests of one transaction are
+// run one at a time, since a transaction is not safe for concurrent use.
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound marks a store error as a missing key (404)
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict marks a store error as a transaction that lost a
+	// conflict or was aborted (409)
+	ErrConflict = errors.New("conflict")
+)
+
+// DefaultTxTimeout is how long a transaction begun with POST /tx may stay
+// open before it is aborted
+const DefaultTxTimeout = 30 * time.Second
+
+// Store is a transactional key-value store; T is its transaction type
+type Store[T any] interface {
+	// Begin starts a transaction that the store aborts once ctx is done
+	Begin(ctx context.Context) T
+	Get(tx T, key string) (int, error)
+	Put(tx T, key string, value int) error
+	Commit(tx T) error
+	Abort(tx T)
+}
+
+// openTx is a transaction begun with POST /tx
+type openTx[T any] struct {
+	mu     sync.Mutex // Serializes the transaction's requests
+	tx     T
+	done   bool
+	cancel context.CancelFunc
+}
+
+// Handler serves a Store over HTTP
+type Handler[T any] struct {
+	store     Store[T]
+	txTimeout time.Duration
+
+	mu     sync.Mutex
+	nextID int
+	open   map[int]*openTx[T]
+}
+
+// NewHandler returns a handler serving store
+func NewHandler[T any](store Store[T]) *Handler[T] {
+	return &Handler[T]{
+		store:     store,
+		txTimeout: DefaultTxTimeout,
+		open:      make(map[int]*openTx[T]),
+	}
+}
+
+// SetTxTimeout sets how long a transaction may stay open before it is
+// aborted. Transactions already open keep their timeout.
+func (h *Handler[T]) SetTxTimeout(timeout time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.txTimeout = timeout
+}
+
+// OpenTransactions returns how many transactions are open
+func (h *Handler[T]) OpenTransactions() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.open)
+}
+
+// keyResponse is the body of a read
+type keyResponse struct {
+	Key   string `json:"key"`
+	Value int    `json:"value"`
+}
+
+// writeRequest is the body of a write
+type writeRequest struct {
+	Value *int `json:"value"`
+}
+
+// ServeHTTP routes a request to its endpoint
+func (h *Handler[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "tx":
+		allow(w, r, http.MethodPost, h.begin)
+	case len(parts) == 3 && parts[0] == "tx" && parts[2] == "commit":
+		allow(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) { h.finish(w, parts[1], true) })
+	case len(parts) == 3 && parts[0] == "tx" && parts[2] == "abort":
+		allow(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) { h.finish(w, parts[1], false) })
+	case len(parts) >= 2 && parts[0] == "keys":
+		key := strings.TrimPrefix(path, "keys/")
+		switch r.Method {
+		case http.MethodGet:
+			h.get(w, r, key)
+		case http.MethodPut:
+			h.put(w, r, key)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			httpError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		}
+	default:
+		httpError(w, http.StatusNotFound, "no endpoint %s", r.URL.Path)
+	}
+}
+
+// allow runs handle if the request uses method
+func allow(w http.ResponseWriter, r *http.Request, method string, handle http.HandlerFunc) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		httpError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		return
+	}
+	handle(w, r)
+}
+
+// begin serves POST /tx
+func (h *Handler[T]) begin(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.nextID++
+	id := h.nextID
+	ctx, cancel := context.WithTimeout(context.Background(), h.txTimeout)
+	h.mu.Unlock()
+
+	open := &openTx[T]{tx: h.store.Begin(ctx), cancel: cancel}
+	h.mu.Lock()
+	h.open[id] = open
+	h.mu.Unlock()
+
+	// Abort the transaction if the client never finishes it
+	context.AfterFunc(ctx, func() {
+		open.mu.Lock()
+		defer open.mu.Unlock()
+		if !open.done {
+			open.done = true
+			h.store.Abort(open.tx)
+			h.forget(id)
+		}
+	})
+
+	writeJSON(w, http.StatusCreated, map[string]int{"id": id})
+}
+
+// finish serves POST /tx/{id}/commit and /abort
+func (h *Handler[T]) finish(w http.ResponseWriter, idText string, commit bool) {
+	open, id, ok := h.lookup(w, idText)
+	if !ok {
+		return
+	}
+	open.mu.Lock()
+	defer open.mu.Unlock()
+	if open.done {
+		httpError(w, http.StatusNotFound, "transaction %d is finished", id)
+		return
+	}
+	open.done = true
+	h.forget(id)
+	defer open.cancel()
+
+	if !commit {
+		h.store.Abort(open.tx)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := h.store.Commit(open.tx); err != nil {
+		storeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// get serves GET /keys/{k}
+func (h *Handler[T]) get(w http.ResponseWriter, r *http.Request, key string) {
+	var value int
+	err := h.inTx(w, r, func(tx T) error {
+		var err error
+		value, err = h.store.Get(tx, key)
+		return err
+	})
+	if err == nil {
+		writeJSON(w, http.StatusOK, keyResponse{Key: key, Value: value})
+	}
+}
+
+// put serves PUT /keys/{k}
+func (h *Handler[T]) put(w http.ResponseWriter, r *http.Request, key string) {
+	var body writeRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Value == nil {
+		httpError(w, http.StatusBadRequest, `body must be {"value": <integer>}`)
+		return
+	}
+	err := h.inTx(w, r, func(tx T) error {
+		return h.store.Put(tx, key, *body.Value)
+	})
+	if err == nil {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// inTx runs op in the transaction named by the request's tx parameter, or
+// in a transaction of its own if it has none. On failure it writes the
+// error response and returns the error.
+func (h *Handler[T]) inTx(w http.ResponseWriter, r *http.Request, op func(tx T) error) error {
+	idText := r.URL.Query().Get("tx")
+	if idText == "" {
+		tx := h.store.Begin(r.Context())
+		err := op(tx)
+		if err == nil {
+			err = h.store.Commit(tx)
+		} else {
+			h.store.Abort(tx)
+		}
+		if err != nil {
+			storeError(w, err)
+		}
+		return err
+	}
+
+	open, id, ok := h.lookup(w, idText)
+	if !ok {
+		return ErrNotFound
+	}
+	open.mu.Lock()
+	defer open.mu.Unlock()
+	if open.done {
+		httpError(w, http.StatusNotFound, "transaction %d is finished", id)
+		return ErrNotFound
+	}
+	err := op(open.tx)
+	if err != nil {
+		storeError(w, err)
+	}
+	return err
+}
+
+// lookup finds the open transaction idText names, writing a 404 if there
+// is none
+func (h *Handler[T]) lookup(w http.ResponseWriter, idText string) (*openTx[T], int, bool) {
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, "bad transaction id %q", idText)
+		return nil, 0, false
+	}
+	h.mu.Lock()
+	open, ok := h.open[id]
+	h.mu.Unlock()
+	if !ok {
+		httpError(w, http.StatusNotFound, "no open transaction %d", id)
+		return nil, id, false
+	}
+	return open, id, true
+}
+
+// forget drops a finished transaction
+func (h *Handler[T]) forget(id int) {
+	h.mu.Lock()
+	delete(h.open, id)
+	h.mu.Unlock()
+}
+
+// storeError writes the response for an error from the store
+func storeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		httpError(w, http.StatusNotFound, "%v", err)
+	case errors.Is(err, ErrConflict):
+		httpError(w, http.StatusConflict, "%v", err)
+	default:
+		httpError(w, http.StatusInternalServerError, "%v", err)
+	}
+}
+
+// httpError writes a JSON error response
+func httpError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+// writeJSON writes v as a JSON response with status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,301 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memTx is a transaction of memStore: its writes, buffered until commit
+type memTx struct {
+	writes  map[string]int
+	aborted bool
+}
+
+// memStore is a map guarded by a mutex, with transactions that buffer
+// their writes. A write to "locked" conflicts and a write of -1 fails.
+type memStore struct {
+	mu     sync.Mutex
+	values map[string]int
+}
+
+func newMemStore() *memStore {
+	return &memStore{values: make(map[string]int)}
+}
+
+func (s *memStore) Begin(ctx context.Context) *memTx {
+	return &memTx{writes: make(map[string]int)}
+}
+
+func (s *memStore) Get(tx *memTx, key string) (int, error) {
+	if value, ok := tx.writes[key]; ok {
+		return value, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	if !ok {
+		return 0, fmt.Errorf("%w: key %s", ErrNotFound, key)
+	}
+	return value, nil
+}
+
+func (s *memStore) Put(tx *memTx, key string, value int) error {
+	if key == "locked" {
+		return fmt.Errorf("%w: key %s is locked", ErrConflict, key)
+	}
+	if value == -1 {
+		return fmt.Errorf("store failure")
+	}
+	tx.writes[key] = value
+	return nil
+}
+
+func (s *memStore) Commit(tx *memTx) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, value := range tx.writes {
+		s.values[key] = value
+	}
+	return nil
+}
+
+func (s *memStore) Abort(tx *memTx) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx.aborted = true
+}
+
+// request sends a request to server and decodes a JSON response into out,
+// if given, returning the response status
+func request(t *testing.T, server *httptest.Server, method, path, body string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("Decoding the response to %s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// TestTransactionLifecycle verifies a write in an open transaction is
+// visible to it, is not visible to others before commit, and is after
+func TestTransactionLifecycle(t *testing.T) {
+	handler := NewHandler[*memTx](newMemStore())
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	var begun struct{ ID int }
+	if status := request(t, server, http.MethodPost, "/tx", "", &begun); status != http.StatusCreated {
+		t.Fatalf("Expected 201 from POST /tx, got %d", status)
+	}
+	tx := fmt.Sprintf("?tx=%d", begun.ID)
+
+	if status := request(t, server, http.MethodPut, "/keys/a"+tx, `{"value": 7}`, nil); status != http.StatusNoContent {
+		t.Fatalf("Expected 204 from PUT, got %d", status)
+	}
+	var read keyResponse
+	if status := request(t, server, http.MethodGet, "/keys/a"+tx, "", &read); status != http.StatusOK || read.Value != 7 {
+		t.Errorf("Expected the transaction to read its write 7, got %d (status %d)", read.Value, status)
+	}
+	if status := request(t, server, http.MethodGet, "/keys/a", "", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for an uncommitted key outside the transaction, got %d", status)
+	}
+	if handler.OpenTransactions() != 1 {
+		t.Errorf("Expected 1 open transaction, got %d", handler.OpenTransactions())
+	}
+
+	if status := request(t, server, http.MethodPost, fmt.Sprintf("/tx/%d/commit", begun.ID), "", nil); status != http.StatusNoContent {
+		t.Fatalf("Expected 204 from commit, got %d", status)
+	}
+	read = keyResponse{}
+	if status := request(t, server, http.MethodGet, "/keys/a", "", &read); status != http.StatusOK || read.Key != "a" || read.Value != 7 {
+		t.Errorf("Expected a=7 after commit, got %+v (status %d)", read, status)
+	}
+	if handler.OpenTransactions() != 0 {
+		t.Errorf("Expected no open transactions after commit, got %d", handler.OpenTransactions())
+	}
+	if status := request(t, server, http.MethodPost, fmt.Sprintf("/tx/%d/commit", begun.ID), "", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 committing a finished transaction, got %d", status)
+	}
+}
+
+// TestAbortDiscardsWrites verifies an aborted transaction's writes are
+// never applied
+func TestAbortDiscardsWrites(t *testing.T) {
+	server := httptest.NewServer(NewHandler[*memTx](newMemStore()))
+	defer server.Close()
+
+	var begun struct{ ID int }
+	request(t, server, http.MethodPost, "/tx", "", &begun)
+	request(t, server, http.MethodPut, fmt.Sprintf("/keys/a?tx=%d", begun.ID), `{"value": 1}`, nil)
+	if status := request(t, server, http.MethodPost, fmt.Sprintf("/tx/%d/abort", begun.ID), "", nil); status != http.StatusNoContent {
+		t.Fatalf("Expected 204 from abort, got %d", status)
+	}
+	if status := request(t, server, http.MethodGet, "/keys/a", "", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for an aborted write, got %d", status)
+	}
+	if status := request(t, server, http.MethodGet, fmt.Sprintf("/keys/a?tx=%d", begun.ID), "", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 using an aborted transaction, got %d", status)
+	}
+}
+
+// TestErrorResponses verifies store errors and bad requests get the right
+// status and a JSON error body
+func TestErrorResponses(t *testing.T) {
+	server := httptest.NewServer(NewHandler[*memTx](newMemStore()))
+	defer server.Close()
+
+	cases := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodGet, "/keys/missing", "", http.StatusNotFound},
+		{http.MethodPut, "/keys/locked", `{"value": 1}`, http.StatusConflict},
+		{http.MethodPut, "/keys/a", `{"value": -1}`, http.StatusInternalServerError},
+		{http.MethodPut, "/keys/a", `{"value": "one"}`, http.StatusBadRequest},
+		{http.MethodPut, "/keys/a", `{}`, http.StatusBadRequest},
+		{http.MethodGet, "/keys/a?tx=99", "", http.StatusNotFound},
+		{http.MethodGet, "/keys/a?tx=x", "", http.StatusBadRequest},
+		{http.MethodDelete, "/keys/a", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/tx", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/tx/99/commit", "", http.StatusNotFound},
+		{http.MethodGet, "/nowhere", "", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		var body struct{ Error string }
+		status := request(t, server, c.method, c.path, c.body, &body)
+		if status != c.status {
+			t.Errorf("%s %s: expected %d, got %d", c.method, c.path, c.status, status)
+		}
+		if body.Error == "" {
+			t.Errorf("%s %s: expected an error message", c.method, c.path)
+		}
+	}
+}
+
+// TestAbandonedTransactionTimesOut verifies a transaction never finished
+// is aborted once its timeout passes
+func TestAbandonedTransactionTimesOut(t *testing.T) {
+	handler := NewHandler[*memTx](newMemStore())
+	handler.SetTxTimeout(20 * time.Millisecond)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	var begun struct{ ID int }
+	request(t, server, http.MethodPost, "/tx", "", &begun)
+	deadline := time.Now().Add(time.Second)
+	for handler.OpenTransactions() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if handler.OpenTransactions() != 0 {
+		t.Fatal("Expected the abandoned transaction to be aborted")
+	}
+	if status := request(t, server, http.MethodPost, fmt.Sprintf("/tx/%d/commit", begun.ID), "", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 committing a timed-out transaction, got %d", status)
+	}
+}
+
+// TestConcurrentTransactions verifies concurrent clients each running
+// their own transactions do not disturb each other
+func TestConcurrentTransactions(t *testing.T) {
+	handler := NewHandler[*memTx](newMemStore())
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(client int) {
+			defer wg.Done()
+			var begun struct{ ID int }
+			request(t, server, http.MethodPost, "/tx", "", &begun)
+			path := fmt.Sprintf("/keys/k%d?tx=%d", client, begun.ID)
+			request(t, server, http.MethodPut, path, fmt.Sprintf(`{"value": %d}`, client), nil)
+			request(t, server, http.MethodPost, fmt.Sprintf("/tx/%d/commit", begun.ID), "", nil)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 8; i++ {
+		var read keyResponse
+		if status := request(t, server, http.MethodGet, fmt.Sprintf("/keys/k%d", i), "", &read); status != http.StatusOK || read.Value != i {
+			t.Errorf("Expected k%d=%d, got %d (status %d)", i, i, read.Value, status)
+		}
+	}
+	if handler.OpenTransactions() != 0 {
+		t.Errorf("Expected no open transactions, got %d", handler.OpenTransactions())
+	}
+}
+
+// FuzzHandler runs scripts of requests, one per line as "METHOD PATH
+// BODY", against a handler and checks that no input crashes it, that every
+// response has a status the API documents and a JSON body, and that every
+// transaction the script leaves open can still be aborted. Run it with
+// go test -fuzz FuzzHandler ./httpapi.
+func FuzzHandler(f *testing.F) {
+	f.Add("POST /tx\nPUT /keys/a?tx=1 {\"value\": 7}\nGET /keys/a?tx=1\nPOST /tx/1/commit")
+	f.Add("POST /tx\nPUT /keys/locked?tx=1 {\"value\": 1}\nPOST /tx/1/abort\nPOST /tx/1/abort")
+	f.Add("PUT /keys/a {\"value\": -1}\nPUT /keys/a {\"value\": \"one\"}\nGET /keys/a?tx=x")
+	f.Add("GET /keys//?tx=-1\nDELETE /tx/1/commit\nPOST /tx/99999999999999999999/commit\nPUT /keys/%zz [")
+	documented := map[int]bool{
+		http.StatusOK: true, http.StatusCreated: true, http.StatusNoContent: true,
+		http.StatusBadRequest: true, http.StatusNotFound: true, http.StatusMethodNotAllowed: true,
+		http.StatusConflict: true, http.StatusInternalServerError: true,
+	}
+	f.Fuzz(func(t *testing.T, script string) {
+		handler := NewHandler[*memTx](newMemStore())
+		var begun []int
+		for _, line := range strings.Split(script, "\n") {
+			method, rest, _ := strings.Cut(line, " ")
+			path, body, _ := strings.Cut(rest, " ")
+			req, err := http.NewRequest(method, path, strings.NewReader(body))
+			if err != nil {
+				continue // net/http rejects it before any handler sees it
+			}
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+			if !documented[resp.Code] {
+				t.Fatalf("%q: undocumented status %d", line, resp.Code)
+			}
+			if resp.Code == http.StatusNoContent {
+				continue
+			}
+			var decoded struct {
+				ID    int
+				Error string
+			}
+			if err := json.Unmarshal(resp.Body.Bytes(), &decoded); err != nil {
+				t.Fatalf("%q: response %q is not JSON: %v", line, resp.Body, err)
+			}
+			if resp.Code >= 400 && decoded.Error == "" {
+				t.Fatalf("%q: status %d without an error message", line, resp.Code)
+			}
+			if resp.Code == http.StatusCreated {
+				begun = append(begun, decoded.ID)
+			}
+		}
+		for _, id := range begun {
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/tx/%d/abort", id), nil)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		if open := handler.OpenTransactions(); open != 0 {
+			t.Fatalf("%d transactions still open after aborting every one begun", open)
+		}
+	})
+}
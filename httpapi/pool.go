@@ -0,0 +1,320 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Pool is a client for the API that multiplexes any number of sessions
+// over at most MaxConns connections. Each connection pipelines up to
+// Pipeline requests: they are written one after another without waiting,
+// and the server answers them in order. Requests from different
+// transactions share connections freely, since every request names its
+// transaction. Pipelining has a cost: a request the server is slow to
+// answer, such as one waiting for a lock, holds up every request queued
+// behind it on its connection, possibly the commit that would release
+// that lock. Only the lock timeout breaks such a wait, so pipelining
+// suits engines whose requests do not block.
+
+// ErrPoolClosed means the pool was closed
+var ErrPoolClosed = errors.New("pool closed")
+
+// PoolConfig configures a Pool
+type PoolConfig struct {
+	MaxConns       int           // Connections the pool may open; at least 1
+	Pipeline       int           // Requests in flight on one connection; at least 1
+	RequestTimeout time.Duration // How long a request may take; 0 for no limit
+}
+
+// PoolStats describes a pool's traffic
+type PoolStats struct {
+	Dialed      int // Connections opened
+	Broken      int // Connections dropped after an error
+	Requests    int // Requests sent
+	TimedOut    int // Requests that outlived RequestTimeout or their context
+	MaxInFlight int // Most requests in flight at once
+}
+
+// Pool multiplexes API requests over a few pipelined connections
+type Pool struct {
+	addr  string
+	cfg   PoolConfig
+	slots chan struct{} // One per request in flight, MaxConns * Pipeline
+
+	mu     sync.Mutex
+	conns  []*poolConn
+	closed bool
+	stats  PoolStats
+}
+
+// poolConn is one pipelined connection
+type poolConn struct {
+	pool     *Pool
+	conn     net.Conn
+	reader   *bufio.Reader
+	inFlight int // Guarded by pool.mu
+
+	writeMu sync.Mutex // Orders writes with their place in pending
+	w       *bufio.Writer
+
+	mu      sync.Mutex
+	pending []*pendingResponse // Requests written, awaiting responses in order
+	broken  bool
+}
+
+// pendingResponse is a request awaiting its response
+type pendingResponse struct {
+	done      chan response
+	abandoned atomic.Bool // The caller gave up; discard the response
+}
+
+// response is a read response, or why there is none
+type response struct {
+	status int
+	body   []byte
+	err    error
+}
+
+// NewPool returns a pool of connections to the API served at addr
+// (host:port). Connections are opened as they are needed.
+func NewPool(addr string, cfg PoolConfig) *Pool {
+	cfg.MaxConns = max(cfg.MaxConns, 1)
+	cfg.Pipeline = max(cfg.Pipeline, 1)
+	return &Pool{
+		addr:  addr,
+		cfg:   cfg,
+		slots: make(chan struct{}, cfg.MaxConns*cfg.Pipeline),
+	}
+}
+
+// Stats returns the pool's traffic so far
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// Close closes every connection; requests in flight fail
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	conns := p.conns
+	p.conns = nil
+	p.mu.Unlock()
+	for _, c := range conns {
+		c.fail(ErrPoolClosed)
+	}
+}
+
+// Do sends a request with body, if not nil, encoded as JSON, and decodes a
+// successful response's JSON into out, if not nil. It returns the response
+// status. It waits for a free place in the pool, and fails once ctx is
+// done or RequestTimeout passes.
+func (p *Pool) Do(ctx context.Context, method, path string, body any, out any) (int, error) {
+	if p.cfg.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.cfg.RequestTimeout)
+		defer cancel()
+	}
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequest(method, "http://"+p.addr+path, &payload)
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		p.timedOut()
+		return 0, fmt.Errorf("%s %s: %w", method, path, ctx.Err())
+	}
+	c, err := p.pick()
+	if err != nil {
+		<-p.slots
+		return 0, err
+	}
+	pending, err := c.send(req)
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case resp := <-pending.done:
+		if resp.err != nil {
+			return 0, resp.err
+		}
+		if out != nil && resp.status < 300 {
+			if err := json.Unmarshal(resp.body, out); err != nil {
+				return resp.status, err
+			}
+		}
+		return resp.status, nil
+	case <-ctx.Done():
+		// The response still arrives in its turn and is discarded
+		pending.abandoned.Store(true)
+		p.timedOut()
+		return 0, fmt.Errorf("%s %s: %w", method, path, ctx.Err())
+	}
+}
+
+// timedOut counts a request that ran out of time
+func (p *Pool) timedOut() {
+	p.mu.Lock()
+	p.stats.TimedOut++
+	p.mu.Unlock()
+}
+
+// pick returns the connection with the fewest requests in flight, opening
+// a new one if every open connection is full. The caller holds a slot, so
+// once MaxConns are open one of them has room.
+func (p *Pool) pick() (*poolConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+
+	var best *poolConn
+	for _, c := range p.conns {
+		if c.inFlight < p.cfg.Pipeline && (best == nil || c.inFlight < best.inFlight) {
+			best = c
+		}
+	}
+	if best == nil || (best.inFlight > 0 && len(p.conns) < p.cfg.MaxConns) {
+		conn, err := net.Dial("tcp", p.addr)
+		if err != nil {
+			if best == nil {
+				return nil, err
+			}
+		} else {
+			best = &poolConn{
+				pool:   p,
+				conn:   conn,
+				reader: bufio.NewReader(conn),
+				w:      bufio.NewWriter(conn),
+			}
+			p.conns = append(p.conns, best)
+			p.stats.Dialed++
+			go best.readResponses()
+		}
+	}
+
+	best.inFlight++
+	p.stats.Requests++
+	inFlight := len(p.slots)
+	p.stats.MaxInFlight = max(p.stats.MaxInFlight, inFlight)
+	return best, nil
+}
+
+// send writes req to the connection and queues its response
+func (c *poolConn) send(req *http.Request) (*pendingResponse, error) {
+	pending := &pendingResponse{done: make(chan response, 1)}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.mu.Lock()
+	if c.broken {
+		c.mu.Unlock()
+		c.release()
+		return nil, fmt.Errorf("%s %s: connection broken", req.Method, req.URL.Path)
+	}
+	c.pending = append(c.pending, pending)
+	c.mu.Unlock()
+
+	err := req.Write(c.w)
+	if err == nil {
+		err = c.w.Flush()
+	}
+	if err != nil {
+		c.fail(err)
+	}
+	return pending, nil
+}
+
+// readResponses delivers the connection's responses, in order, to the
+// requests awaiting them
+func (c *poolConn) readResponses() {
+	for {
+		resp, err := http.ReadResponse(c.reader, nil)
+		var body []byte
+		if err == nil {
+			body, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		c.mu.Lock()
+		if len(c.pending) == 0 {
+			c.mu.Unlock()
+			c.fail(errors.New("response to no request"))
+			return
+		}
+		pending := c.pending[0]
+		c.pending = c.pending[1:]
+		c.mu.Unlock()
+
+		if !pending.abandoned.Load() {
+			pending.done <- response{status: resp.StatusCode, body: body}
+		}
+		c.release()
+	}
+}
+
+// release frees the place of one finished request
+func (c *poolConn) release() {
+	c.pool.mu.Lock()
+	c.inFlight--
+	c.pool.mu.Unlock()
+	<-c.pool.slots
+}
+
+// fail drops the connection, failing every request awaiting a response
+func (c *poolConn) fail(err error) {
+	c.mu.Lock()
+	if c.broken {
+		c.mu.Unlock()
+		return
+	}
+	c.broken = true
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+	c.conn.Close()
+
+	p := c.pool
+	p.mu.Lock()
+	for i, other := range p.conns {
+		if other == c {
+			p.conns = append(p.conns[:i:i], p.conns[i+1:]...)
+			if !errors.Is(err, ErrPoolClosed) {
+				p.stats.Broken++
+			}
+			break
+		}
+	}
+	p.mu.Unlock()
+
+	for _, r := range pending {
+		r.done <- response{err: fmt.Errorf("connection to %s: %w", p.addr, err)}
+		c.release()
+	}
+}
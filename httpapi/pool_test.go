@@ -0,0 +1,107 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestPoolPipelinesInOrder verifies concurrent requests pipelined over one
+// connection each get their own response
+func TestPoolPipelinesInOrder(t *testing.T) {
+	server := httptest.NewServer(NewHandler[*memTx](newMemStore()))
+	defer server.Close()
+	pool := NewPool(server.Listener.Addr().String(), PoolConfig{MaxConns: 1, Pipeline: 8})
+	defer pool.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("/keys/k%d", i)
+			if status, err := pool.Do(context.Background(), http.MethodPut, key, map[string]int{"value": i}, nil); err != nil || status != http.StatusNoContent {
+				t.Errorf("PUT %s: status %d, %v", key, status, err)
+				return
+			}
+			var read keyResponse
+			if status, err := pool.Do(context.Background(), http.MethodGet, key, nil, &read); err != nil || status != http.StatusOK || read.Value != i {
+				t.Errorf("GET %s: got %+v, status %d, %v", key, read, status, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := pool.Stats()
+	if stats.Dialed != 1 || stats.Requests != 100 {
+		t.Errorf("Expected 100 requests over 1 connection, got %+v", stats)
+	}
+	if stats.MaxInFlight > 8 {
+		t.Errorf("Expected at most 8 requests in flight, got %d", stats.MaxInFlight)
+	}
+}
+
+// TestPoolLimitsConnections verifies the pool never opens more than
+// MaxConns connections
+func TestPoolLimitsConnections(t *testing.T) {
+	server := httptest.NewServer(NewHandler[*memTx](newMemStore()))
+	defer server.Close()
+	pool := NewPool(server.Listener.Addr().String(), PoolConfig{MaxConns: 3, Pipeline: 2})
+	defer pool.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Do(context.Background(), http.MethodPost, "/tx", nil, nil)
+		}()
+	}
+	wg.Wait()
+	if stats := pool.Stats(); stats.Dialed > 3 || stats.MaxInFlight > 6 {
+		t.Errorf("Expected at most 3 connections and 6 requests in flight, got %+v", stats)
+	}
+}
+
+// TestPoolRequestTimeout verifies a slow response times out its request
+// without corrupting the responses pipelined behind it
+func TestPoolRequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"path": r.URL.Path})
+	}))
+	defer server.Close()
+	pool := NewPool(server.Listener.Addr().String(), PoolConfig{MaxConns: 1, Pipeline: 4, RequestTimeout: 20 * time.Millisecond})
+	defer pool.Close()
+
+	if _, err := pool.Do(context.Background(), http.MethodGet, "/slow", nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the slow request to time out, got %v", err)
+	}
+	// The next request waits behind the slow response it was pipelined after
+	time.Sleep(100 * time.Millisecond)
+	var body struct{ Path string }
+	if status, err := pool.Do(context.Background(), http.MethodGet, "/fast", nil, &body); err != nil || status != http.StatusOK || body.Path != "/fast" {
+		t.Errorf("Expected /fast's own response, got %+v, status %d, %v", body, status, err)
+	}
+	if stats := pool.Stats(); stats.TimedOut != 1 || stats.Dialed != 1 {
+		t.Errorf("Expected 1 timeout on 1 connection, got %+v", stats)
+	}
+}
+
+// TestPoolClosed verifies requests fail once the pool is closed
+func TestPoolClosed(t *testing.T) {
+	server := httptest.NewServer(NewHandler[*memTx](newMemStore()))
+	defer server.Close()
+	pool := NewPool(server.Listener.Addr().String(), PoolConfig{MaxConns: 1})
+	pool.Close()
+	if _, err := pool.Do(context.Background(), http.MethodPost, "/tx", nil, nil); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Expected ErrPoolClosed, got %v", err)
+	}
+}
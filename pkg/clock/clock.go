@@ -0,0 +1,208 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Time. A database reads the time and sleeps through its Clock: the real
+// one unless SetClock gave it a SimClock, whose time moves only when
+// something sleeps on it or calls Advance. Under a SimClock the simulated
+// processing time of every operation, client think times, retry backoffs
+// and injected delays cost no real time, so tests and the model checker
+// run without waiting, and TTLs, deadlines and latencies come out the same
+// on every run.
+//
+// Waits on other goroutines, such as key lock timeouts and WaitFor, are
+// timed by the clock's timers, which fire once the clock has passed their
+// deadline rather than moving it on themselves. On a SimClock that happens
+// when the other goroutines sleep. Nothing would move it on if every
+// goroutine were blocked, as in a deadlock between transactions, so a
+// simulated timer that has not fired after its duration in real time moves
+// the clock to its deadline itself. The background sweepers and
+// checkpointers still tick on real time.
+
+// A Clock tells the time, sleeps and times waits
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	// After is Sleep as a channel, for sleeps that can be cut short
+	After(d time.Duration) <-chan time.Time
+	// NewTimer returns a timer that fires once the clock has passed d
+	// from now, for a wait on other goroutines
+	NewTimer(d time.Duration) Timer
+	// AfterFunc is NewTimer calling f in its own goroutine when it fires
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// A Timer fires once, unless it is stopped first
+type Timer interface {
+	// C delivers the time the timer fired; nil for AfterFunc's timers
+	C() <-chan time.Time
+	// Stop keeps the timer from firing, and reports whether it had not yet
+	Stop() bool
+}
+
+// RealClock is the wall clock, every database's clock by default
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+func (t realTimer) Stop() bool          { return t.t.Stop() }
+
+// SimClock is a simulated clock. Sleeping on it returns at once, having
+// moved the clock on by the sleep. Sleeps do not overlap: each adds its
+// whole duration, as if the sleepers took turns, which is exact for one
+// goroutine at a time, as under a Scheduler, and an upper bound otherwise.
+type SimClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers map[*simTimer]bool // Pending timers
+}
+
+// Epoch is where a SimClock started at the zero time begins
+var Epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// NewSimClock returns a simulated clock reading start, or a fixed date if
+// start is zero
+func NewSimClock(start time.Time) *SimClock {
+	if start.IsZero() {
+		start = Epoch
+	}
+	return &SimClock{now: start}
+}
+
+// Now returns the simulated time
+func (c *SimClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock on by d, firing the timers it passes, and
+// returns the new time
+func (c *SimClock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d > 0 {
+		c.advanceTo(c.now.Add(d))
+	}
+	return c.now
+}
+
+// advanceTo moves the clock on to now, if it is later, and fires every
+// timer due by then. Must be called with c.mu held.
+func (c *SimClock) advanceTo(now time.Time) {
+	if now.After(c.now) {
+		c.now = now
+	}
+	for t := range c.timers {
+		if !t.deadline.After(c.now) {
+			t.fire(c.now)
+		}
+	}
+}
+
+// Sleep moves the clock on by d without waiting
+func (c *SimClock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+// After moves the clock on by d and returns a channel already holding the
+// new time
+func (c *SimClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.Advance(d)
+	return ch
+}
+
+// NewTimer returns a timer that fires once the clock has passed d from now
+func (c *SimClock) NewTimer(d time.Duration) Timer {
+	return c.startTimer(d, nil)
+}
+
+// AfterFunc returns a timer that calls f in its own goroutine once the
+// clock has passed d from now
+func (c *SimClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.startTimer(d, f)
+}
+
+// simTimer is a SimClock's timer
+type simTimer struct {
+	clock    *SimClock
+	deadline time.Time
+	c        chan time.Time
+	f        func()
+	backstop *time.Timer // Moves the clock on if nothing else has in real time
+}
+
+// startTimer starts a timer calling f, or sending on its channel if f is
+// nil, once the clock passes d from now
+func (c *SimClock) startTimer(d time.Duration, f func()) *simTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &simTimer{clock: c, deadline: c.now.Add(d), f: f}
+	if f == nil {
+		t.c = make(chan time.Time, 1)
+	}
+	if c.timers == nil {
+		c.timers = make(map[*simTimer]bool)
+	}
+	c.timers[t] = true
+	if d <= 0 {
+		t.fire(c.now)
+		return t
+	}
+	t.backstop = time.AfterFunc(d, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.timers[t] {
+			c.advanceTo(t.deadline)
+		}
+	})
+	return t
+}
+
+// fire delivers the timer at now and forgets it. Must be called with the
+// clock's mu held.
+func (t *simTimer) fire(now time.Time) {
+	delete(t.clock.timers, t)
+	if t.backstop != nil {
+		t.backstop.Stop()
+	}
+	if t.f != nil {
+		go t.f()
+	} else {
+		t.c <- now
+	}
+}
+
+func (t *simTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *simTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	if !t.clock.timers[t] {
+		return false
+	}
+	delete(t.clock.timers, t)
+	t.backstop.Stop()
+	return true
+}
@@ -0,0 +1,68 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimClockAdvancesOnlyWhenSlept(t *testing.T) {
+	clock := NewSimClock(time.Time{})
+	start := clock.Now()
+	if !start.Equal(Epoch) || !clock.Now().Equal(start) {
+		t.Fatalf("a fresh clock reads %v, then %v", start, clock.Now())
+	}
+
+	began := time.Now()
+	clock.Sleep(time.Hour)
+	at := <-clock.After(time.Minute)
+	if real := time.Since(began); real > 100*time.Millisecond {
+		t.Errorf("simulated sleeps took %v of real time", real)
+	}
+	if want := start.Add(time.Hour + time.Minute); !at.Equal(want) || !clock.Now().Equal(want) {
+		t.Errorf("After fired at %v, clock reads %v, want %v", at, clock.Now(), want)
+	}
+}
+
+func TestSimTimerFiresWhenPassed(t *testing.T) {
+	clock := NewSimClock(time.Time{})
+	timer := clock.NewTimer(time.Hour)
+	stopped := clock.NewTimer(time.Minute)
+	if !stopped.Stop() || stopped.Stop() {
+		t.Errorf("Stop reported the pending timer stopped, then stopped again")
+	}
+
+	clock.Sleep(59 * time.Minute)
+	select {
+	case at := <-timer.C():
+		t.Fatalf("the hour's timer fired at %v, a minute early", at)
+	default:
+	}
+	clock.Sleep(2 * time.Minute)
+	select {
+	case at := <-timer.C():
+		if want := Epoch.Add(time.Hour + time.Minute); !at.Equal(want) {
+			t.Errorf("the timer fired at %v, want %v", at, want)
+		}
+	default:
+		t.Fatal("the timer did not fire once the clock passed it")
+	}
+	select {
+	case <-stopped.C():
+		t.Error("a stopped timer fired")
+	default:
+	}
+}
+
+func TestSimTimerBackstop(t *testing.T) {
+	clock := NewSimClock(time.Time{})
+	fired := make(chan struct{})
+	clock.AfterFunc(time.Millisecond, func() { close(fired) })
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("a timer on an idle clock never fired")
+	}
+	if want := Epoch.Add(time.Millisecond); !clock.Now().Equal(want) {
+		t.Errorf("the clock reads %v after the backstop, want %v", clock.Now(), want)
+	}
+}
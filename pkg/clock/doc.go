@@ -0,0 +1,4 @@
+// Package clock holds the clocks the database tells the time and sleeps by.
+// It needs nothing of the database, so the locks and the simulator can use
+// it too; package db re-exports it under the names the database uses.
+package clock
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AdmissionPolicy decides which queued transaction gets the next free
+// admission slot
+type AdmissionPolicy int
+
+const (
+	// AdmitFIFO admits queued transactions in arrival order
+	AdmitFIFO AdmissionPolicy = iota
+	// AdmitEDF admits the queued transaction with the earliest deadline
+	// first; transactions without a deadline go last, in arrival order
+	AdmitEDF
+)
+
+func (p AdmissionPolicy) String() string {
+	switch p {
+	case AdmitFIFO:
+		return "FIFO"
+	case AdmitEDF:
+		return "EDF"
+	default:
+		return fmt.Sprintf("AdmissionPolicy(%d)", int(p))
+	}
+}
+
+// admissionWaiter is a transaction queued for an admission slot
+type admissionWaiter struct {
+	deadline time.Time // Zero when the transaction has none
+	seq      int64     // Arrival order
+	granted  chan struct{}
+}
+
+// admissionHeap orders waiters by policy; it implements heap.Interface
+type admissionHeap struct {
+	policy  AdmissionPolicy
+	waiters []*admissionWaiter
+}
+
+func (h *admissionHeap) Len() int { return len(h.waiters) }
+
+func (h *admissionHeap) Less(i, j int) bool {
+	a, b := h.waiters[i], h.waiters[j]
+	if h.policy == AdmitEDF && !a.deadline.Equal(b.deadline) {
+		switch {
+		case a.deadline.IsZero():
+			return false
+		case b.deadline.IsZero():
+			return true
+		default:
+			return a.deadline.Before(b.deadline)
+		}
+	}
+	return a.seq < b.seq
+}
+
+func (h *admissionHeap) Swap(i, j int) { h.waiters[i], h.waiters[j] = h.waiters[j], h.waiters[i] }
+
+func (h *admissionHeap) Push(x any) { h.waiters = append(h.waiters, x.(*admissionWaiter)) }
+
+func (h *admissionHeap) Pop() any {
+	last := h.waiters[len(h.waiters)-1]
+	h.waiters = h.waiters[:len(h.waiters)-1]
+	return last
+}
+
+// admissionQueue is a counting semaphore whose waiters are a priority
+// queue: a released slot is handed directly to the waiter the policy
+// picks, so nobody can barge in ahead of it
+type admissionQueue struct {
+	mu      sync.Mutex
+	slots   int
+	inUse   int
+	seq     int64
+	waiting admissionHeap
+}
+
+// newAdmissionQueue creates a queue with n slots
+func newAdmissionQueue(n int, policy AdmissionPolicy) *admissionQueue {
+	return &admissionQueue{slots: n, waiting: admissionHeap{policy: policy}}
+}
+
+// setPolicy changes the order in which the current waiters are admitted
+func (q *admissionQueue) setPolicy(policy AdmissionPolicy) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.waiting.policy = policy
+	heap.Init(&q.waiting)
+}
+
+// acquire takes a slot, blocking until one is handed over or ctx is done.
+// It reports whether the caller had to queue, and ctx's error if it gave up
+// without a slot.
+func (q *admissionQueue) acquire(ctx context.Context, deadline time.Time) (bool, error) {
+	q.mu.Lock()
+	if q.inUse < q.slots && q.waiting.Len() == 0 {
+		q.inUse++
+		q.mu.Unlock()
+		return false, nil
+	}
+	q.seq++
+	waiter := &admissionWaiter{deadline: deadline, seq: q.seq, granted: make(chan struct{})}
+	heap.Push(&q.waiting, waiter)
+	q.mu.Unlock()
+
+	select {
+	case <-waiter.granted:
+		return true, nil
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case <-waiter.granted:
+		// Handed over just as ctx was done: pass it on
+		q.releaseLocked()
+	default:
+		for i, queued := range q.waiting.waiters {
+			if queued == waiter {
+				heap.Remove(&q.waiting, i)
+				break
+			}
+		}
+	}
+	return true, ctx.Err()
+}
+
+// release gives a slot back, handing it to the next waiter if there is one
+func (q *admissionQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.releaseLocked()
+}
+
+// releaseLocked is release with q.mu already held
+func (q *admissionQueue) releaseLocked() {
+	if q.waiting.Len() > 0 {
+		// The slot stays in use; it just changes hands
+		next := heap.Pop(&q.waiting).(*admissionWaiter)
+		close(next.granted)
+		return
+	}
+	q.inUse--
+}
+
+// SetMaxConcurrentTx limits how many transactions may be active at once.
+// BeginTransaction blocks until one of the n slots is free; n <= 0 removes
+// the limit. Transactions already running keep the slot they were admitted
+// with, so the limit can be changed at any time.
+func (db *Database) SetMaxConcurrentTx(n int) {
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+
+	if n <= 0 {
+		db.admission = nil
+		return
+	}
+	db.admission = newAdmissionQueue(n, db.admissionPolicy)
+}
+
+// SetAdmissionPolicy chooses which queued transaction is admitted when a
+// slot frees up. It only matters while SetMaxConcurrentTx limits admission.
+func (db *Database) SetAdmissionPolicy(policy AdmissionPolicy) {
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+
+	db.admissionPolicy = policy
+	if db.admission != nil {
+		db.admission.setPolicy(policy)
+	}
+}
+
+// admit blocks until tx gets an admission slot, if admission control is
+// on. If tx's context is done first, tx is left without a slot.
+func (db *Database) admit(tx *Transaction) {
+	db.txMu.Lock()
+	queue := db.admission
+	db.txMu.Unlock()
+
+	if queue == nil {
+		return
+	}
+
+	start := db.clock.Now()
+	queued, err := queue.acquire(tx.Context(), tx.Deadline)
+	if queued {
+		// All slots were taken: account for the wait, on the clock lock
+		// waits are timed by
+		wait := db.since(start)
+
+		db.stats.record(func(s *statShard) {
+			s.add(statAdmissionQueued, 1)
+			s.add(statAdmissionWait, int64(wait))
+		})
+	}
+	if err == nil {
+		tx.admission = queue
+	}
+}
+
+// leave gives tx's admission slot back. It is safe to call more than once.
+func (db *Database) leave(tx *Transaction) {
+	if tx.admission != nil {
+		tx.admission.release()
+		tx.admission = nil
+	}
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+// merkleLeaves is how many key buckets a Merkle tree summarizes. Two
+// replicas compare root hashes first and only descend into subtrees that
+// differ, so in-sync replicas cost one comparison.
+const merkleLeaves = 64
+
+// merkleTree summarizes a replica's data. levels[0] holds the leaf hashes,
+// one per key bucket; each following level hashes pairs of the level
+// below, up to the single root hash.
+type merkleTree struct {
+	levels  [][]uint64
+	buckets [merkleLeaves][]string // Keys in each leaf, sorted
+}
+
+// merkleBucket returns the leaf a key belongs to
+func merkleBucket(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % merkleLeaves)
+}
+
+// buildMerkleTree hashes a snapshot of a replica's data
+func buildMerkleTree(data map[string]versionedValue) *merkleTree {
+	tree := &merkleTree{}
+	for key := range data {
+		bucket := merkleBucket(key)
+		tree.buckets[bucket] = append(tree.buckets[bucket], key)
+	}
+
+	leaves := make([]uint64, merkleLeaves)
+	for i := range tree.buckets {
+		sort.Strings(tree.buckets[i])
+		h := fnv.New64a()
+		for _, key := range tree.buckets[i] {
+			value := data[key]
+			fmt.Fprintf(h, "%s=%d@%d/%t;", key, value.Value, value.Version, value.Deleted)
+		}
+		leaves[i] = h.Sum64()
+	}
+
+	tree.levels = [][]uint64{leaves}
+	for level := leaves; len(level) > 1; {
+		parents := make([]uint64, len(level)/2)
+		for i := range parents {
+			h := fnv.New64a()
+			fmt.Fprintf(h, "%d,%d", level[2*i], level[2*i+1])
+			parents[i] = h.Sum64()
+		}
+		tree.levels = append(tree.levels, parents)
+		level = parents
+	}
+	return tree
+}
+
+// diff returns the leaf buckets whose hashes differ between two trees,
+// descending only into subtrees with differing hashes
+func (t *merkleTree) diff(other *merkleTree) []int {
+	var differing []int
+	var walk func(level, index int)
+	walk = func(level, index int) {
+		if t.levels[level][index] == other.levels[level][index] {
+			return
+		}
+		if level == 0 {
+			differing = append(differing, index)
+			return
+		}
+		walk(level-1, 2*index)
+		walk(level-1, 2*index+1)
+	}
+	walk(len(t.levels)-1, 0)
+	return differing
+}
+
+// snapshot copies the replica's data so a tree can be built without
+// holding its lock
+func (r *quorumReplica) snapshot() map[string]versionedValue {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := make(map[string]versionedValue, len(r.data))
+	for key, value := range r.data {
+		data[key] = value
+	}
+	return data
+}
+
+// AntiEntropy runs one anti-entropy round: every pair of reachable
+// replicas compares Merkle trees and exchanges the newer copy of every key
+// in the buckets that differ. It returns how many divergent keys it found.
+func (c *QuorumCluster) AntiEntropy() int {
+	up := c.reachable()
+	snapshots := make([]map[string]versionedValue, len(up))
+	trees := make([]*merkleTree, len(up))
+	for i, replica := range up {
+		snapshots[i] = replica.snapshot()
+		trees[i] = buildMerkleTree(snapshots[i])
+	}
+
+	divergent := make(map[string]bool)
+	repairs := 0
+	for i := 0; i < len(up); i++ {
+		for j := i + 1; j < len(up); j++ {
+			for _, bucket := range trees[i].diff(trees[j]) {
+				keys := make(map[string]bool)
+				for _, key := range trees[i].buckets[bucket] {
+					keys[key] = true
+				}
+				for _, key := range trees[j].buckets[bucket] {
+					keys[key] = true
+				}
+
+				for key := range keys {
+					a, b := snapshots[i][key], snapshots[j][key]
+					switch {
+					case a.newer(b):
+						divergent[key] = true
+						if up[j].apply(key, a) {
+							repairs++
+						}
+					case b.newer(a):
+						divergent[key] = true
+						if up[i].apply(key, b) {
+							repairs++
+						}
+					}
+				}
+			}
+		}
+	}
+
+	c.count(func(s *QuorumStats) {
+		s.AntiEntropyRounds++
+		s.AntiEntropyDivergences += len(divergent)
+		s.AntiEntropyRepairs += repairs
+	})
+	return len(divergent)
+}
+
+// StartAntiEntropy runs an anti-entropy round every interval until ctx is
+// done. The returned function stops it and waits for the current round.
+func (c *QuorumCluster) StartAntiEntropy(ctx context.Context, interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.AntiEntropy()
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// DivergentKeys counts keys on which the replicas do not all agree,
+// looking at every replica directly regardless of partitions
+func (c *QuorumCluster) DivergentKeys() int {
+	snapshots := make([]map[string]versionedValue, len(c.replicas))
+	keys := make(map[string]bool)
+	for i, replica := range c.replicas {
+		snapshots[i] = replica.snapshot()
+		for key := range snapshots[i] {
+			keys[key] = true
+		}
+	}
+
+	divergent := 0
+	for key := range keys {
+		for _, snapshot := range snapshots[1:] {
+			if snapshot[key] != snapshots[0][key] {
+				divergent++
+				break
+			}
+		}
+	}
+	return divergent
+}
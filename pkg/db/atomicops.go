@@ -0,0 +1,156 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// The atomic operations below each run as one transaction that
+// RunTransaction retries on conflicts, touching keys in sorted order so two
+// of them cannot deadlock under two-phase locking. Engines without
+// transaction isolation (the unsynchronized and plain synchronized ones)
+// would let such a transaction interleave with anything, so there they are
+// serialized with each other by a database-wide mutex instead. Plain
+// transactions running alongside them on those engines can still
+// interleave with them.
+
+// atomically runs fn as one transaction, retried on conflicts
+func (db *Database) atomically(fn func(tx *Transaction) error) error {
+	if db.DefaultIsolation() == ReadUncommitted {
+		db.atomicMu.Lock()
+		defer db.atomicMu.Unlock()
+	}
+	return db.RunTransaction(fn)
+}
+
+// Transfer moves amount from one existing key to another atomically:
+// either both change or neither does. Each side is a single Add, which
+// claims the key for writing as it reads it; under timestamp ordering a
+// separate read and write would keep losing to younger readers.
+func (db *Database) Transfer(from, to string, amount int) error {
+	if from == to {
+		return fmt.Errorf("transfer from %s to itself", from)
+	}
+	deltas := map[string]int{from: -amount, to: amount}
+	keys := []string{from, to}
+	sort.Strings(keys)
+
+	return db.atomically(func(tx *Transaction) error {
+		for _, key := range keys {
+			if err := db.Add(tx, key, deltas[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CompareAndSet sets an existing key to newValue if it currently holds
+// expected, atomically, and reports whether it did
+func (db *Database) CompareAndSet(key string, expected, newValue int) (bool, error) {
+	swapped := false
+	err := db.atomically(func(tx *Transaction) error {
+		swapped = false
+		current, err := db.Get(tx, key)
+		if err != nil {
+			return err
+		}
+		if current != expected {
+			return nil
+		}
+		if err := db.Put(tx, key, newValue); err != nil {
+			return err
+		}
+		swapped = true
+		return nil
+	})
+	return swapped && err == nil, err
+}
+
+// BatchWrite writes every key in writes atomically: if one write is
+// rejected, by a validator for instance, none of them is applied
+func (db *Database) BatchWrite(writes map[string]int) error {
+	keys := make([]string, 0, len(writes))
+	for key := range writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return db.atomically(func(tx *Transaction) error {
+		for _, key := range keys {
+			if err := db.Put(tx, key, writes[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Incr adds 1 to key and returns the new value. A missing key counts as 0,
+// as in Redis, so the first Incr creates it with the value 1.
+func (db *Database) Incr(key string) (int, error) {
+	return db.IncrBy(key, 1)
+}
+
+// Decr subtracts 1 from key and returns the new value; a missing key
+// counts as 0
+func (db *Database) Decr(key string) (int, error) {
+	return db.IncrBy(key, -1)
+}
+
+// IncrBy adds delta to key atomically and returns the new value; a missing
+// key counts as 0. The increment is a single Upsert, so like Transfer it
+// claims the key for writing as it reads it.
+func (db *Database) IncrBy(key string, delta int) (int, error) {
+	value := 0
+	err := db.atomically(func(tx *Transaction) error {
+		if err := db.Upsert(tx, key, delta, 0); err != nil {
+			return err
+		}
+		var err error
+		value, err = db.Get(tx, key)
+		return err
+	})
+	return value, err
+}
+
+// GetSet sets key to value atomically and returns the value it replaced,
+// and whether there was one
+func (db *Database) GetSet(key string, value int) (old int, existed bool, err error) {
+	err = db.atomically(func(tx *Transaction) error {
+		var getErr error
+		old, getErr = db.Get(tx, key)
+		existed = getErr == nil
+		if getErr != nil && !errors.Is(getErr, ErrKeyNotFound) {
+			return getErr
+		}
+		return db.Put(tx, key, value)
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return old, existed, nil
+}
+
+// SetNX sets key to value only if the key does not exist, atomically, and
+// reports whether it did
+func (db *Database) SetNX(key string, value int) (bool, error) {
+	set := false
+	err := db.atomically(func(tx *Transaction) error {
+		set = false
+		_, err := db.Get(tx, key)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrKeyNotFound) {
+			return err
+		}
+		if err := db.Put(tx, key, value); err != nil {
+			return err
+		}
+		set = true
+		return nil
+	})
+	return set && err == nil, err
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// atomicEngines are the engines the atomic operations must be atomic on
+var atomicEngines = map[string]func() *Database{
+	"unsynchronized":     NewUnsynchronizedDatabase,
+	"synchronized":       func() *Database { return NewSynchronizedDatabase(Fair) },
+	"two-phase-locking":  NewTwoPhaseLockingDatabase,
+	"mvcc":               NewMVCCDatabase,
+	"timestamp-ordering": NewTimestampOrderingDatabase,
+}
+
+// TestTransferPreservesTotal runs transfers in both directions at once and
+// checks no money is created or lost on any engine
+func TestTransferPreservesTotal(t *testing.T) {
+	for name, newDB := range atomicEngines {
+		t.Run(name, func(t *testing.T) {
+			db := newDB()
+			db.SetRetryPolicy(RetryPolicy{MaxAttempts: 1000, BaseBackoff: 10 * time.Microsecond, MaxBackoff: time.Millisecond})
+			if err := db.BatchWrite(map[string]int{"a": 1000, "b": 1000}); err != nil {
+				t.Fatalf("BatchWrite: %v", err)
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				from, to := "a", "b"
+				if i%2 == 1 {
+					from, to = to, from
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 20; j++ {
+						if err := db.Transfer(from, to, 7); err != nil {
+							t.Errorf("Transfer: %v", err)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			check := db.BeginTransaction()
+			a, _ := db.Read(check, "a")
+			b, _ := db.Read(check, "b")
+			db.Commit(check)
+			if a+b != 2000 || a != 1000 {
+				t.Errorf("a=%d b=%d, want 1000 each", a, b)
+			}
+		})
+	}
+}
+
+// TestTransferMissingKey verifies a transfer involving a missing key fails
+// with ErrKeyNotFound and changes nothing
+func TestTransferMissingKey(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.BatchWrite(map[string]int{"a": 100})
+
+	if err := db.Transfer("a", "missing", 10); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Transfer returned %v, want ErrKeyNotFound", err)
+	}
+	check := db.BeginTransaction()
+	if a, _ := db.Read(check, "a"); a != 100 {
+		t.Errorf("a = %d after failed transfer, want 100", a)
+	}
+	db.Commit(check)
+}
+
+// TestCompareAndSet verifies the swap only happens on a matching value
+func TestCompareAndSet(t *testing.T) {
+	db := NewMVCCDatabase()
+	db.BatchWrite(map[string]int{"x": 1})
+
+	if swapped, err := db.CompareAndSet("x", 2, 3); swapped || err != nil {
+		t.Errorf("CompareAndSet(x, 2, 3) = %v, %v; want false, nil", swapped, err)
+	}
+	if swapped, err := db.CompareAndSet("x", 1, 3); !swapped || err != nil {
+		t.Errorf("CompareAndSet(x, 1, 3) = %v, %v; want true, nil", swapped, err)
+	}
+	if _, err := db.CompareAndSet("missing", 0, 1); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("CompareAndSet on a missing key returned %v, want ErrKeyNotFound", err)
+	}
+
+	check := db.BeginTransaction()
+	if x, _ := db.Read(check, "x"); x != 3 {
+		t.Errorf("x = %d, want 3", x)
+	}
+	db.Commit(check)
+}
+
+// TestBatchWriteAllOrNothing verifies one rejected write keeps the whole
+// batch from being applied
+func TestBatchWriteAllOrNothing(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.AddValidator(NonNegative())
+
+	err := db.BatchWrite(map[string]int{"a": 1, "b": -1, "c": 1})
+	if !errors.Is(err, ErrTxAborted) {
+		t.Errorf("BatchWrite returned %v, want ErrTxAborted", err)
+	}
+	check := db.BeginTransaction()
+	for _, key := range []string{"a", "b", "c"} {
+		if _, exists := db.Read(check, key); exists {
+			t.Errorf("%s was written by a rejected batch", key)
+		}
+	}
+	db.Commit(check)
+}
+
+// TestIncrDecrAreAtomic runs concurrent Incr and Decr calls on a missing
+// key on every engine and checks none is lost
+func TestIncrDecrAreAtomic(t *testing.T) {
+	for name, newDB := range atomicEngines {
+		t.Run(name, func(t *testing.T) {
+			db := newDB()
+			db.SetRetryPolicy(RetryPolicy{MaxAttempts: 1000, BaseBackoff: 10 * time.Microsecond, MaxBackoff: time.Millisecond})
+
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func(id int) {
+					defer wg.Done()
+					for j := 0; j < 25; j++ {
+						op := db.Incr
+						if id == 0 {
+							op = db.Decr
+						}
+						if _, err := op("hits"); err != nil {
+							t.Errorf("Incr/Decr: %v", err)
+						}
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			if value, err := db.IncrBy("hits", 0); err != nil || value != 50 {
+				t.Errorf("hits = %d, %v; want 50", value, err)
+			}
+		})
+	}
+}
+
+// TestGetSetAndSetNX verifies GetSet returns the replaced value and SetNX
+// only writes missing keys
+func TestGetSetAndSetNX(t *testing.T) {
+	for name, newDB := range atomicEngines {
+		t.Run(name, func(t *testing.T) {
+			db := newDB()
+			if old, existed, err := db.GetSet("x", 1); existed || old != 0 || err != nil {
+				t.Errorf("GetSet on a missing key = %d, %v, %v; want 0, false, nil", old, existed, err)
+			}
+			if old, existed, _ := db.GetSet("x", 2); !existed || old != 1 {
+				t.Errorf("GetSet = %d, %v; want 1, true", old, existed)
+			}
+			if set, err := db.SetNX("x", 3); set || err != nil {
+				t.Errorf("SetNX on an existing key = %v, %v; want false, nil", set, err)
+			}
+			if set, _ := db.SetNX("y", 4); !set {
+				t.Error("SetNX on a missing key did not set it")
+			}
+			if value, _ := db.IncrBy("x", 0); value != 2 {
+				t.Errorf("x = %d, want 2", value)
+			}
+		})
+	}
+}
+
+// TestSetNXHasOneWinner races SetNX calls on one key and checks exactly
+// one of them set it
+func TestSetNXHasOneWinner(t *testing.T) {
+	for name, newDB := range atomicEngines {
+		t.Run(name, func(t *testing.T) {
+			db := newDB()
+			db.SetRetryPolicy(RetryPolicy{MaxAttempts: 1000, BaseBackoff: 10 * time.Microsecond, MaxBackoff: time.Millisecond})
+
+			var wins atomic.Int64
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(id int) {
+					defer wg.Done()
+					if set, _ := db.SetNX("leader", id); set {
+						wins.Add(1)
+					}
+				}(i)
+			}
+			wg.Wait()
+			if wins.Load() != 1 {
+				t.Errorf("%d SetNX calls won, want 1", wins.Load())
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestBulkLoad loads a thousand keys on every engine, and checks they were
+// committed by one transaction that took no simulated time
+func TestBulkLoad(t *testing.T) {
+	for _, engine := range EngineVariants() {
+		db, _ := OpenDatabase(engine)
+		clock := NewSimClock(time.Time{})
+		db.SetClock(clock)
+		start := clock.Now()
+		if err := db.BulkLoad(benchmarkKeys(1000)); err != nil {
+			t.Fatalf("%s: %v", engine, err)
+		}
+		if elapsed := clock.Now().Sub(start); elapsed != 0 {
+			t.Errorf("%s: loading took %v of processing time", engine, elapsed)
+		}
+		if stats := db.Stats(); stats.Commits != 1 || stats.TotalWrites != 1000 {
+			t.Errorf("%s: %d commits of %d writes, want 1 of 1000", engine, stats.Commits, stats.TotalWrites)
+		}
+		tx := db.BeginTransaction()
+		if value, ok := db.Read(tx, "key_999"); !ok || value != 999 {
+			t.Errorf("%s: key_999 = %d, %v", engine, value, ok)
+		}
+		db.Commit(tx)
+	}
+}
+
+// TestBulkLoadWritesOneWALRecord checks a durable bulk load is logged as a
+// single commit record
+func TestBulkLoadWritesOneWALRecord(t *testing.T) {
+	dir := t.TempDir()
+	db := NewTwoPhaseLockingDatabase()
+	if _, err := db.AttachStorage(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.BulkLoad(benchmarkKeys(200)); err != nil {
+		t.Fatal(err)
+	}
+	db.CloseStorage()
+	ends, _, err := WALRecordEnds(filepath.Join(dir, WALFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ends) != 1 {
+		t.Errorf("%d WAL records, want 1", len(ends))
+	}
+}
+
+// TestBulkLoadWaitsForLocks checks a bulk load that cannot lock a key
+// loads nothing and says why
+func TestBulkLoadWaitsForLocks(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetLockTimeout(0)
+	holder := db.BeginTransaction()
+	db.Put(holder, "key_5", -1)
+
+	err := db.BulkLoad(benchmarkKeys(10))
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("BulkLoad returned %v, want a lock timeout", err)
+	}
+	db.Abort(holder)
+	tx := db.BeginTransaction()
+	if _, exists := db.Read(tx, "key_0"); exists {
+		t.Error("a failed bulk load left key_0 behind")
+	}
+	db.Commit(tx)
+}
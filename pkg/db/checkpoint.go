@@ -0,0 +1,286 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// A database with storage attached logs every committed write set to a
+// WAL before Commit returns, and a checkpoint now and then writes the whole
+// record map to disk and empties the WAL. After a crash the latest
+// checkpoint plus the WAL records after it rebuild exactly the committed
+// state. Commits hold the storage lock shared while they install and log
+// their writes, and a checkpoint holds it exclusively, so it always sees a
+// state that is precisely the first Seq commits.
+
+// The files a durable database keeps in its directory
+const (
+	CheckpointFileName = "checkpoint.json"
+	WALFileName        = "wal.jsonl"
+)
+
+// storage is the on-disk side of a database: its directory and WAL
+type storage struct {
+	mu     sync.RWMutex
+	dir    string
+	wal    *WAL
+	closed bool
+}
+
+// checkpointFile is what a checkpoint writes: the committed records after
+// the first Seq commits
+type checkpointFile struct {
+	Seq      int64
+	Snapshot DBSnapshot
+}
+
+// RecoveryReport describes what AttachStorage found on disk
+type RecoveryReport struct {
+	CheckpointSeq  int64 // Commits the checkpoint held (0 without one)
+	CheckpointKeys int   // Live keys loaded from the checkpoint
+	Replayed       int   // WAL records replayed on top of the checkpoint
+	Skipped        int   // WAL records the checkpoint already held
+	TornTail       bool  // The WAL ended in a partly written record
+	LastSeq        int64 // Last commit recovered; new commits continue after it
+}
+
+// beginCommit holds off checkpoints while a commit installs and logs its
+// writes. It does nothing without storage.
+func (s *storage) beginCommit() {
+	if s != nil {
+		s.mu.RLock()
+	}
+}
+
+// endCommit lets checkpoints run again
+func (s *storage) endCommit() {
+	if s != nil {
+		s.mu.RUnlock()
+	}
+}
+
+// log appends a committed transaction to the WAL. Must be called between
+// beginCommit and endCommit.
+func (s *storage) log(record CommitRecord) {
+	if !s.closed {
+		// A failed append is kept by the WAL and reported by Checkpoint
+		// and CloseStorage
+		s.wal.Append(record)
+	}
+}
+
+// AttachStorage makes db durable in dir. It first recovers whatever the
+// latest checkpoint and the WAL in dir hold into db, which should be
+// empty, and from then on logs every commit. It must be called before the
+// database is shared.
+func (db *Database) AttachStorage(dir string) (RecoveryReport, error) {
+	if db.storage != nil {
+		return RecoveryReport{}, errors.New("storage already attached")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return RecoveryReport{}, err
+	}
+
+	report, err := db.recoverFrom(dir)
+	if err != nil {
+		return report, fmt.Errorf("recovering from %s: %w", dir, err)
+	}
+	wal, err := OpenWAL(filepath.Join(dir, WALFileName))
+	if err != nil {
+		return report, err
+	}
+	wal.SetSyncOnAppend(db.syncCommits)
+	db.commitSeq.Store(report.LastSeq)
+	db.storage = &storage{dir: dir, wal: wal}
+	return report, nil
+}
+
+// SetSyncCommits sets whether each commit fsyncs its WAL record before it
+// is acknowledged. Without it a commit survives the process dying once
+// Commit returns, but a power failure can still lose the last ones; with
+// it, nothing acknowledged is lost, at the cost of a disk flush per
+// commit. It should be called before AttachStorage.
+func (db *Database) SetSyncCommits(enabled bool) {
+	db.syncCommits = enabled
+}
+
+// recoverFrom loads the checkpoint in dir and replays the WAL tail after it
+func (db *Database) recoverFrom(dir string) (RecoveryReport, error) {
+	var report RecoveryReport
+	checkpoint, err := readCheckpoint(filepath.Join(dir, CheckpointFileName))
+	if err != nil {
+		return report, err
+	}
+	report.CheckpointSeq = checkpoint.Seq
+	report.LastSeq = checkpoint.Seq
+
+	if len(checkpoint.Snapshot.Entries) > 0 {
+		if err := db.Restore(checkpoint.Snapshot); err != nil {
+			return report, fmt.Errorf("loading checkpoint: %w", err)
+		}
+		for _, entry := range checkpoint.Snapshot.Entries {
+			if !entry.Deleted {
+				report.CheckpointKeys++
+			}
+		}
+	}
+
+	records, torn, err := ReadWAL(filepath.Join(dir, WALFileName))
+	if err != nil {
+		return report, err
+	}
+	report.TornTail = torn
+	for _, record := range records {
+		if record.Seq <= checkpoint.Seq {
+			// The crash came between the checkpoint and emptying the WAL
+			report.Skipped++
+			continue
+		}
+		if err := db.applyRecord(record); err != nil {
+			return report, fmt.Errorf("replaying commit %d: %w", record.Seq, err)
+		}
+		report.Replayed++
+		report.LastSeq = record.Seq
+	}
+	return report, nil
+}
+
+// Checkpoint writes every committed record to disk and empties the WAL.
+// Commits wait while it runs. A crashed database writes no checkpoints.
+func (db *Database) Checkpoint() error {
+	s := db.storage
+	if s == nil {
+		return errors.New("checkpoint: no storage attached")
+	}
+	if db.Crashed() {
+		return errors.New("checkpoint: database crashed")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("checkpoint: storage closed")
+	}
+
+	data, err := json.Marshal(checkpointFile{Seq: db.commitSeq.Load(), Snapshot: db.TakeSnapshot()})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(s.dir, CheckpointFileName), data); err != nil {
+		return err
+	}
+	// Everything in the WAL is now in the checkpoint, including records
+	// after an append error
+	if err := s.wal.Reset(); err != nil {
+		return err
+	}
+	db.countStat(statCheckpoints, 1)
+	return s.wal.Err()
+}
+
+// StartCheckpointing runs Checkpoint every interval until ctx is done or
+// the database crashes. The returned function stops it, waits for the
+// current checkpoint and returns the first error one ran into.
+func (db *Database) StartCheckpointing(ctx context.Context, interval time.Duration) (stop func() error) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	var firstErr error
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := db.Checkpoint()
+				if db.Crashed() {
+					return
+				}
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+	}()
+
+	return func() error {
+		cancel()
+		wg.Wait()
+		return firstErr
+	}
+}
+
+// CloseStorage stops logging commits and closes the WAL, without a final
+// checkpoint. It returns the first error an append ran into.
+func (db *Database) CloseStorage() error {
+	s := db.storage
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return errors.Join(s.wal.Err(), s.wal.Close())
+}
+
+// writeFileAtomic replaces the file at path with data. It writes a
+// temporary file, syncs it and renames it over the old one, so a crash
+// leaves either the old file or the new one, never half of one.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	// Make the rename itself durable
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// readCheckpoint loads the checkpoint at path; a missing one is empty
+func readCheckpoint(path string) (checkpointFile, error) {
+	var checkpoint checkpointFile
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return checkpoint, err
+	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("%s: %w", path, err)
+	}
+	return checkpoint, nil
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMaxConcurrentTx tests that admission control never lets more than
+// the configured number of transactions run at once
+func TestMaxConcurrentTx(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetMaxConcurrentTx(2)
+
+	var active, peak int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tx := db.BeginTransaction()
+
+			mu.Lock()
+			active++
+			if active > peak {
+				peak = active
+			}
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			active--
+			mu.Unlock()
+			db.Commit(tx)
+		}()
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("expected at most 2 concurrent transactions, saw %d", peak)
+	}
+	if queued := db.Stats().AdmissionQueued; queued == 0 {
+		t.Errorf("expected some transactions to queue for admission")
+	}
+}
+
+// TestEDFAdmitsEarliestDeadlineFirst tests that under AdmitEDF a freed
+// slot goes to the queued transaction with the earliest deadline, and
+// transactions without one go last
+func TestEDFAdmitsEarliestDeadlineFirst(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetMaxConcurrentTx(1)
+	db.SetAdmissionPolicy(AdmitEDF)
+	holder := db.BeginTransaction()
+
+	now := time.Now()
+	deadlines := map[string]time.Time{
+		"late":  now.Add(time.Hour),
+		"early": now.Add(time.Minute),
+		"none":  {},
+	}
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for _, name := range []string{"none", "late", "early"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			tx := db.BeginTransactionWithDeadline(deadlines[name])
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			db.Commit(tx)
+		}(name)
+	}
+
+	// Wait until all three are queued before freeing the slot
+	for {
+		db.admission.mu.Lock()
+		queued := db.admission.waiting.Len()
+		db.admission.mu.Unlock()
+		if queued == 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	db.Commit(holder)
+	wg.Wait()
+
+	if want := []string{"early", "late", "none"}; fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Errorf("Admission order = %v, want %v", order, want)
+	}
+}
+
+// TestWaitFor tests that WaitFor wakes up when a writer makes the predicate
+// true, and gives up after the timeout otherwise
+func TestWaitFor(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+
+	tx := db.BeginTransaction()
+	db.Write(tx, "balance", 0)
+	db.Commit(tx)
+
+	positive := func(value int, exists bool) bool { return exists && value > 0 }
+
+	if _, ok := db.WaitFor("balance", positive, 10*time.Millisecond); ok {
+		t.Fatalf("predicate should not hold before the deposit")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		tx := db.BeginTransaction()
+		db.Update(tx, "balance", 25)
+		db.Commit(tx)
+	}()
+
+	value, ok := db.WaitFor("balance", positive, time.Second)
+	if !ok || value != 25 {
+		t.Errorf("expected to wake up with balance=25, got %d (ok=%v)", value, ok)
+	}
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Aggregate statistics hide starvation: a run can commit plenty while one
+// client barely gets a transaction through. The database therefore also
+// keeps statistics per client, for every transaction tagged with one
+// (Transaction.ClientID, set from WithClient's context by
+// BeginTransactionCtx), and a scenario with more than one client ends with
+// a fairness report comparing them.
+
+// clientKey is the context key of WithClient
+type clientKey struct{}
+
+// WithClient returns a context whose transactions are attributed to client
+// (a positive ID) in traces and in per-client statistics
+func WithClient(ctx context.Context, client int) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// clientFrom returns the client ctx attributes its transactions to, 0 if none
+func clientFrom(ctx context.Context) int {
+	if ctx == nil {
+		return 0
+	}
+	client, _ := ctx.Value(clientKey{}).(int)
+	return client
+}
+
+// ClientStats describes one client's transactions
+type ClientStats struct {
+	Client   int
+	Commits  int
+	Aborts   int
+	LockWait time.Duration    // Total time its transactions waited for key locks
+	Latency  LatencyHistogram // Begin-to-finish time of its transactions, aborted ones included
+	Active   time.Duration    // From its first transaction's begin to its last one's end
+}
+
+// Throughput returns the client's commits per second while it was active
+func (c ClientStats) Throughput() float64 {
+	if c.Active <= 0 {
+		return 0
+	}
+	return float64(c.Commits) / c.Active.Seconds()
+}
+
+// AbortRate returns the fraction of the client's transactions that aborted
+func (c ClientStats) AbortRate() float64 {
+	if c.Commits+c.Aborts == 0 {
+		return 0
+	}
+	return float64(c.Aborts) / float64(c.Commits+c.Aborts)
+}
+
+// clientCounters is the live form of ClientStats
+type clientCounters struct {
+	commits, aborts int
+	lockWait        time.Duration
+	latency         LatencyCounters
+	first, last     time.Time
+}
+
+// clientRegistry holds the per-client statistics. It has its own mutex,
+// even when unsynchronized, since its map would otherwise crash the
+// program rather than merely miscount.
+type clientRegistry struct {
+	mu      sync.Mutex
+	clients map[int]*clientCounters
+}
+
+// countClient records a finished top-level transaction of a tagged client
+func (db *Database) countClient(tx *Transaction, status TxStatus) {
+	if tx.ClientID == 0 {
+		return
+	}
+	r := &db.clients
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.clients == nil {
+		r.clients = make(map[int]*clientCounters)
+	}
+	now := db.clock.Now()
+	c, exists := r.clients[tx.ClientID]
+	if !exists {
+		c = &clientCounters{first: tx.StartTime}
+		r.clients[tx.ClientID] = c
+	}
+	if tx.StartTime.Before(c.first) {
+		c.first = tx.StartTime
+	}
+	c.last = now
+	if status == TxCommitted {
+		c.commits++
+	} else {
+		c.aborts++
+	}
+	c.lockWait += tx.lockWait
+	c.latency.Observe(now.Sub(tx.StartTime))
+}
+
+// ClientStats returns the statistics of every client that ran a tagged
+// transaction, by client ID
+func (db *Database) ClientStats() []ClientStats {
+	r := &db.clients
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make([]ClientStats, 0, len(r.clients))
+	for client, c := range r.clients {
+		stats = append(stats, ClientStats{
+			Client:   client,
+			Commits:  c.commits,
+			Aborts:   c.aborts,
+			LockWait: c.lockWait,
+			Latency:  c.latency.Snapshot(),
+			Active:   c.last.Sub(c.first),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Client < stats[j].Client })
+	return stats
+}
+
+// JainIndex returns Jain's fairness index of xs, (Σx)² / (n·Σx²): 1 when
+// every x is equal, down to 1/n when one x has everything. It is 1 for no
+// values or all zeros.
+func JainIndex(xs []float64) float64 {
+	var sum, squares float64
+	for _, x := range xs {
+		sum += x
+		squares += x * x
+	}
+	if squares == 0 {
+		return 1
+	}
+	return sum * sum / (float64(len(xs)) * squares)
+}
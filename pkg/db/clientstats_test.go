@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+// TestJainIndex verifies the index is 1 for equal shares and 1/n when one
+// value has everything
+func TestJainIndex(t *testing.T) {
+	cases := []struct {
+		xs   []float64
+		want float64
+	}{
+		{[]float64{5, 5, 5, 5}, 1},
+		{[]float64{8, 0, 0, 0}, 0.25},
+		{[]float64{1, 3}, 0.8},
+		{nil, 1},
+	}
+	for _, c := range cases {
+		if got := JainIndex(c.xs); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("JainIndex(%v) = %v, expected %v", c.xs, got, c.want)
+		}
+	}
+}
+
+// TestClientStatsAttributeTransactions verifies transactions begun with a
+// client's context count towards that client, lock waits included, and
+// untagged ones towards none
+func TestClientStatsAttributeTransactions(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetLockTimeout(5 * time.Millisecond)
+
+	holder := db.BeginTransactionCtx(WithClient(context.Background(), 1))
+	db.Put(holder, "k", 1)
+
+	blocked := db.BeginTransactionCtx(WithClient(context.Background(), 2))
+	if err := db.Put(blocked, "k", 2); err == nil {
+		t.Fatal("Expected client 2 to time out on client 1's lock")
+	}
+	db.Abort(blocked)
+	db.Commit(holder)
+
+	untagged := db.BeginTransaction()
+	db.Commit(untagged)
+
+	clients := db.ClientStats()
+	if len(clients) != 2 {
+		t.Fatalf("Expected 2 clients, got %+v", clients)
+	}
+	if c := clients[0]; c.Client != 1 || c.Commits != 1 || c.Aborts != 0 || c.Latency.Count != 1 {
+		t.Errorf("Expected client 1 to have committed once, got %+v", c)
+	}
+	if c := clients[1]; c.Client != 2 || c.AbortRate() != 1 || c.LockWait < 5*time.Millisecond {
+		t.Errorf("Expected client 2 to have aborted after waiting 5ms or more, got %+v", c)
+	}
+}
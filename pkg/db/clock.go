@@ -0,0 +1,47 @@
+package db
+
+import (
+	"time"
+
+	"database-sync-unsynchronized/pkg/clock"
+)
+
+// The clocks live in pkg/clock; see clock.Clock for how the database uses
+// them.
+
+// Clock tells the time, sleeps and times waits
+type Clock = clock.Clock
+
+// SimClock is a simulated clock
+type SimClock = clock.SimClock
+
+// Timer is a Clock's timer, firing once the clock passes its deadline
+type Timer = clock.Timer
+
+// RealClock is the wall clock, every database's clock by default
+var RealClock = clock.RealClock
+
+// NewSimClock returns a simulated clock reading start, or a fixed date if
+// start is zero
+func NewSimClock(start time.Time) *SimClock {
+	return clock.NewSimClock(start)
+}
+
+// SetClock makes db tell the time, sleep and time its lock waits by clock.
+// It should be called before the database is shared.
+func (db *Database) SetClock(clock Clock) {
+	db.clock = clock
+	if db.locks != nil {
+		db.locks.SetClock(clock)
+	}
+}
+
+// Clock returns the clock db tells the time and sleeps by
+func (db *Database) Clock() Clock {
+	return db.clock
+}
+
+// since returns the time elapsed on db's clock since start
+func (db *Database) since(start time.Time) time.Duration {
+	return db.clock.Now().Sub(start)
+}
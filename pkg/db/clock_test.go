@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// simulated gives db a simulated clock, for tests whose operations should
+// not spend real time on their processing delays, and returns it
+func simulated(db *Database) *Database {
+	db.SetClock(NewSimClock(time.Time{}))
+	return db
+}
+
+// TestTTLExpiresOnSimClock checks that a key's TTL runs on the database's
+// clock, so advancing it expires the key without waiting
+func TestTTLExpiresOnSimClock(t *testing.T) {
+	for name, newDB := range map[string]func() *Database{"2PL": NewTwoPhaseLockingDatabase, "MVCC": NewMVCCDatabase} {
+		t.Run(name, func(t *testing.T) {
+			clock := NewSimClock(time.Time{})
+			db := newDB()
+			db.SetClock(clock)
+			tx := db.BeginTransaction()
+			db.PutWithTTL(tx, "session", 1, time.Minute)
+			db.Commit(tx)
+
+			clock.Advance(59 * time.Second)
+			if _, ok := db.Snapshot().Get("session"); !ok {
+				t.Fatal("key expired early")
+			}
+			clock.Advance(time.Second)
+			tx = db.BeginTransaction()
+			if _, err := db.Get(tx, "session"); err == nil {
+				t.Error("key still readable once its TTL ran out")
+			}
+			db.Commit(tx)
+			if expired := db.ExpireKeys(); expired != 1 {
+				t.Errorf("ExpireKeys found %d expired keys, want 1", expired)
+			}
+		})
+	}
+}
+
+// TestSimClockLatencies checks that under a simulated clock operations
+// take exactly their simulated processing time, and no real time
+func TestSimClockLatencies(t *testing.T) {
+	db := simulated(NewTwoPhaseLockingDatabase())
+	tx := db.BeginTransaction()
+	db.Put(tx, "x", 1)
+	db.Commit(tx)
+
+	began := time.Now()
+	for i := 0; i < 1000; i++ {
+		tx := db.BeginTransaction()
+		db.Get(tx, "x")
+		db.Commit(tx)
+	}
+	if real := time.Since(began); real > time.Second {
+		t.Errorf("1000 reads took %v of real time", real)
+	}
+	read := db.Stats().Latency[OpRead.String()]
+	if read.Count != 1000 || read.Max != 10*time.Microsecond || read.Mean() != 10*time.Microsecond {
+		t.Errorf("reads: %+v, want every one to take exactly 10µs", read)
+	}
+}
+
+// TestLockTimeoutOnSimClock checks that a key lock wait times out on the
+// database's clock: once the clock passes the timeout, however little
+// real time that took, and with the wait measured in simulated time
+func TestLockTimeoutOnSimClock(t *testing.T) {
+	clock := NewSimClock(time.Time{})
+	db := NewTwoPhaseLockingDatabase()
+	db.SetClock(clock)
+	db.SetLockTimeout(time.Hour)
+	holder := db.BeginTransaction()
+	db.Put(holder, "x", 1)
+	defer db.Abort(holder)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				clock.Advance(30 * time.Minute)
+			}
+		}
+	}()
+	began := time.Now()
+	waiter := db.BeginTransaction()
+	if _, err := db.Get(waiter, "x"); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Waiting behind the holder: %v, want ErrTimeout", err)
+	}
+	db.Abort(waiter)
+	if real := time.Since(began); real > time.Minute {
+		t.Errorf("The hour's timeout took %v of real time", real)
+	}
+	if waits := db.locks.LongestWaits(1); len(waits) != 1 || waits[0].Granted || waits[0].Wait < time.Hour {
+		t.Errorf("Lock waits %+v, want one of at least the simulated hour", waits)
+	}
+}
+
+// TestWaitsOnSimClock checks that lease expiry, token bucket waits and
+// admission waits run on a simulated clock: an hour of it passes in
+// moments, and the waits are measured in it
+func TestWaitsOnSimClock(t *testing.T) {
+	clock := NewSimClock(time.Time{})
+	done := make(chan struct{})
+	defer close(done)
+	advance := func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				clock.Advance(30 * time.Minute)
+			}
+		}
+	}
+	began := time.Now()
+
+	leases := NewLeaseManagerWithClock(clock)
+	first, _ := leases.TryAcquire("lock", "a", time.Hour)
+	if _, ok := leases.TryAcquire("lock", "b", time.Hour); ok {
+		t.Fatal("b acquired the lock a holds")
+	}
+	bucket := NewTokenBucketWithClock(1.0/3600, 1, clock) // A token an hour
+	bucket.Wait(context.Background())
+	waited := make(chan error)
+	go func() { waited <- bucket.Wait(context.Background()) }()
+	for reserved := false; !reserved; {
+		bucket.mu.Lock()
+		reserved = bucket.tokens < 0
+		bucket.mu.Unlock()
+	}
+
+	db := NewTwoPhaseLockingDatabase()
+	db.SetClock(clock)
+	db.SetMaxConcurrentTx(1)
+	holder := db.BeginTransaction()
+	admitted := make(chan *Transaction)
+	go func() { admitted <- db.BeginTransaction() }()
+	for queued := 0; queued == 0; {
+		db.admission.mu.Lock()
+		queued = db.admission.waiting.Len()
+		db.admission.mu.Unlock()
+	}
+	go advance()
+
+	second, err := leases.Acquire(context.Background(), "lock", "b", time.Hour)
+	if err != nil || second.Token <= first.Token {
+		t.Errorf("Acquiring after a's lease ran out: %+v, %v", second, err)
+	}
+	if err := <-waited; err != nil {
+		t.Errorf("Waiting for the next token: %v", err)
+	}
+	if throttled := bucket.Throttled(); throttled < 59*time.Minute {
+		t.Errorf("Throttled %v, want the hour to the next token", throttled)
+	}
+	for db.clock.Now().Sub(holder.StartTime) < time.Hour {
+		time.Sleep(time.Millisecond)
+	}
+	db.Commit(holder)
+	db.Commit(<-admitted)
+	if wait := db.Stats().AdmissionWait; wait < time.Hour {
+		t.Errorf("AdmissionWait = %v, want the simulated hour the holder held the slot", wait)
+	}
+	if real := time.Since(began); real > time.Minute {
+		t.Errorf("The simulated hours took %v of real time", real)
+	}
+}
@@ -0,0 +1,226 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Lists and sets. A key can hold a list of strings, pushed on the left and
+// popped from the right like a queue, or a set of distinct strings. The
+// elements are encoded into the key's payload (see payload.go), and its
+// integer value is the number of elements, so WaitFor can wait for a list
+// to fill up or drain. A list or set that loses its last element is
+// deleted, so an empty one and a missing key look the same. Like other
+// payloads, lists and sets are not carried by snapshot files, the WAL or
+// replication.
+//
+// The operations taking a transaction are a read of the key followed by a
+// write, as synchronized as the engine makes any read-modify-write: under
+// two-phase locking, MVCC and timestamp ordering two pushes never lose
+// each other's elements, while the plain synchronized engine can lose one
+// as it loses updates. LPush, RPop, SAdd, SRem and SMembers each run one
+// of them as an atomic operation of their own (see atomicops.go).
+
+// ErrWrongType means a list or set operation found a key holding some
+// other kind of value
+var ErrWrongType = errors.New("key holds the wrong kind of value")
+
+// The first byte of a list's or set's payload
+const (
+	listTag byte = 'l'
+	setTag  byte = 's'
+)
+
+// encodeItems encodes elements as a payload tagged tag: each element's
+// length as a uvarint followed by its bytes
+func encodeItems(tag byte, items []string) []byte {
+	size := 1
+	for _, item := range items {
+		size += binary.MaxVarintLen64 + len(item)
+	}
+	payload := append(make([]byte, 0, size), tag)
+	for _, item := range items {
+		payload = binary.AppendUvarint(payload, uint64(len(item)))
+		payload = append(payload, item...)
+	}
+	return payload
+}
+
+// decodeItems decodes a payload encodeItems encoded with tag
+func decodeItems(tag byte, payload []byte) ([]string, error) {
+	if len(payload) == 0 || payload[0] != tag {
+		return nil, ErrWrongType
+	}
+	var items []string
+	for rest := payload[1:]; len(rest) > 0; {
+		n, size := binary.Uvarint(rest)
+		if size <= 0 || n > uint64(len(rest)-size) {
+			return nil, ErrWrongType
+		}
+		items = append(items, string(rest[size:size+int(n)]))
+		rest = rest[size+int(n):]
+	}
+	return items, nil
+}
+
+// items returns the elements of the list or set, by tag, that key holds as
+// tx sees it; none if key does not exist
+func (db *Database) items(tx *Transaction, key string, tag byte) ([]string, error) {
+	payload, err := db.GetBytes(tx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeItems(tag, payload)
+}
+
+// putItems sets key to the list or set of items, by tag, when tx commits,
+// deleting it if there are none
+func (db *Database) putItems(tx *Transaction, key string, tag byte, items []string) error {
+	if len(items) == 0 {
+		return db.Remove(tx, key)
+	}
+	return db.putPayload(tx, key, len(items), encodeItems(tag, items))
+}
+
+// PushLeft adds values to the left of key's list, creating it if need be,
+// and returns the list's new length. Each value is pushed in turn, so the
+// last one ends up leftmost.
+func (db *Database) PushLeft(tx *Transaction, key string, values ...string) (int, error) {
+	list, err := db.items(tx, key, listTag)
+	if err != nil {
+		return 0, err
+	}
+	pushed := make([]string, 0, len(values)+len(list))
+	for i := len(values) - 1; i >= 0; i-- {
+		pushed = append(pushed, values[i])
+	}
+	pushed = append(pushed, list...)
+	return len(pushed), db.putItems(tx, key, listTag, pushed)
+}
+
+// PopRight removes and returns the rightmost element of key's list, the
+// oldest one pushed, failing with ErrKeyNotFound if the list is empty
+func (db *Database) PopRight(tx *Transaction, key string) (string, error) {
+	list, err := db.items(tx, key, listTag)
+	if err != nil {
+		return "", err
+	}
+	if len(list) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+	last := list[len(list)-1]
+	return last, db.putItems(tx, key, listTag, list[:len(list)-1])
+}
+
+// ListItems returns key's list, left to right; nil if it is empty
+func (db *Database) ListItems(tx *Transaction, key string) ([]string, error) {
+	return db.items(tx, key, listTag)
+}
+
+// AddMembers adds members to key's set, creating it if need be, and
+// returns how many were not in it already
+func (db *Database) AddMembers(tx *Transaction, key string, members ...string) (int, error) {
+	set, err := db.items(tx, key, setTag)
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for _, member := range members {
+		if i := sort.SearchStrings(set, member); i == len(set) || set[i] != member {
+			set = append(set[:i], append([]string{member}, set[i:]...)...)
+			added++
+		}
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	return added, db.putItems(tx, key, setTag, set)
+}
+
+// RemoveMembers removes members from key's set and returns how many were
+// in it
+func (db *Database) RemoveMembers(tx *Transaction, key string, members ...string) (int, error) {
+	set, err := db.items(tx, key, setTag)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, member := range members {
+		if i := sort.SearchStrings(set, member); i < len(set) && set[i] == member {
+			set = append(set[:i], set[i+1:]...)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, db.putItems(tx, key, setTag, set)
+}
+
+// Members returns key's set, sorted; nil if it is empty
+func (db *Database) Members(tx *Transaction, key string) ([]string, error) {
+	return db.items(tx, key, setTag)
+}
+
+// LPush pushes values onto the left of key's list atomically and returns
+// its new length
+func (db *Database) LPush(key string, values ...string) (int, error) {
+	length := 0
+	err := db.atomically(func(tx *Transaction) error {
+		var err error
+		length, err = db.PushLeft(tx, key, values...)
+		return err
+	})
+	return length, err
+}
+
+// RPop pops the rightmost element of key's list atomically, failing with
+// ErrKeyNotFound if the list is empty
+func (db *Database) RPop(key string) (string, error) {
+	var value string
+	err := db.atomically(func(tx *Transaction) error {
+		var err error
+		value, err = db.PopRight(tx, key)
+		return err
+	})
+	return value, err
+}
+
+// SAdd adds members to key's set atomically and returns how many were new
+func (db *Database) SAdd(key string, members ...string) (int, error) {
+	added := 0
+	err := db.atomically(func(tx *Transaction) error {
+		var err error
+		added, err = db.AddMembers(tx, key, members...)
+		return err
+	})
+	return added, err
+}
+
+// SRem removes members from key's set atomically and returns how many were
+// in it
+func (db *Database) SRem(key string, members ...string) (int, error) {
+	removed := 0
+	err := db.atomically(func(tx *Transaction) error {
+		var err error
+		removed, err = db.RemoveMembers(tx, key, members...)
+		return err
+	})
+	return removed, err
+}
+
+// SMembers returns key's set, sorted
+func (db *Database) SMembers(key string) ([]string, error) {
+	var members []string
+	err := db.atomically(func(tx *Transaction) error {
+		var err error
+		members, err = db.Members(tx, key)
+		return err
+	})
+	return members, err
+}
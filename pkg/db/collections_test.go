@@ -0,0 +1,116 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// TestListPushPop verifies a list pops its elements in the order they were
+// pushed, and is deleted when it empties
+func TestListPushPop(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	if length, err := db.LPush("queue", "a", "b"); err != nil || length != 2 {
+		t.Fatalf("LPush = %d, %v, want 2", length, err)
+	}
+	db.LPush("queue", "c")
+	tx := db.BeginTransaction()
+	if list, _ := db.ListItems(tx, "queue"); !reflect.DeepEqual(list, []string{"c", "b", "a"}) {
+		t.Errorf("List %v, want [c b a]", list)
+	}
+	if length, _ := db.Get(tx, "queue"); length != 3 {
+		t.Errorf("Value %d, want the length 3", length)
+	}
+	db.Commit(tx)
+
+	for _, want := range []string{"a", "b", "c"} {
+		if popped, err := db.RPop("queue"); err != nil || popped != want {
+			t.Errorf("RPop = %q, %v, want %q", popped, err, want)
+		}
+	}
+	if _, err := db.RPop("queue"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("RPop of an empty list: %v, want ErrKeyNotFound", err)
+	}
+	if count := db.GetRecordCount(); count != 0 {
+		t.Errorf("%d live keys once the list emptied, want 0", count)
+	}
+
+	db.BatchWrite(map[string]int{"counter": 1})
+	if _, err := db.LPush("counter", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("LPush onto an integer: %v, want ErrWrongType", err)
+	}
+	db.LPush("queue", "a")
+	if _, err := db.SAdd("queue", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("SAdd to a list: %v, want ErrWrongType", err)
+	}
+}
+
+// TestSetMembers verifies a set holds each member once, sorted
+func TestSetMembers(t *testing.T) {
+	db := NewMVCCDatabase()
+	if added, err := db.SAdd("tags", "red", "blue", "red"); err != nil || added != 2 {
+		t.Fatalf("SAdd = %d, %v, want 2", added, err)
+	}
+	if added, _ := db.SAdd("tags", "blue", "green"); added != 1 {
+		t.Errorf("SAdd added %d, want 1", added)
+	}
+	if members, _ := db.SMembers("tags"); !reflect.DeepEqual(members, []string{"blue", "green", "red"}) {
+		t.Errorf("SMembers = %v, want [blue green red]", members)
+	}
+	if removed, _ := db.SRem("tags", "green", "violet"); removed != 1 {
+		t.Errorf("SRem removed %d, want 1", removed)
+	}
+	db.SRem("tags", "blue", "red")
+	if members, err := db.SMembers("tags"); err != nil || members != nil {
+		t.Errorf("SMembers = %v, %v once emptied, want none", members, err)
+	}
+}
+
+// TestListConcurrentPushPop pushes from several goroutines in transactions
+// on each isolating engine, then pops, and checks every element comes out
+// exactly once
+func TestListConcurrentPushPop(t *testing.T) {
+	const goroutines, pushes = 4, 25
+	for _, engine := range []string{"2pl", "mvcc", "tso"} {
+		t.Run(engine, func(t *testing.T) {
+			db, _ := OpenDatabase(engine)
+			db.SetProcessingDelays(NoProcessingDelays)
+			var wg sync.WaitGroup
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < pushes; i++ {
+						err := db.RunTransaction(func(tx *Transaction) error {
+							_, err := db.PushLeft(tx, "queue", strconv.Itoa(g*pushes+i))
+							return err
+						})
+						if err != nil {
+							t.Error(err)
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+
+			seen := make(map[string]bool)
+			for {
+				popped, err := db.RPop("queue")
+				if errors.Is(err, ErrKeyNotFound) {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				if seen[popped] {
+					t.Errorf("Popped %s twice", popped)
+				}
+				seen[popped] = true
+			}
+			if len(seen) != goroutines*pushes {
+				t.Errorf("Popped %d elements, want %d", len(seen), goroutines*pushes)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package db
+
+import "time"
+
+// CommittedWrite is the final effect of a committed transaction on one key
+type CommittedWrite struct {
+	Key       string
+	Value     int
+	Deleted   bool
+	ExpiresAt time.Time `json:",omitempty"` // TTL deadline; zero for never
+	Payload   []byte    `json:",omitempty"` // Payload the key holds after the commit; nil for none
+}
+
+// CommitRecord describes one committed transaction in the commit stream
+type CommitRecord struct {
+	Seq    int64 // Position in the database's commit stream, starting at 1
+	TxID   int
+	Writes []CommittedWrite // In the order the transaction first wrote each key
+}
+
+// SetCommitHook registers a function that receives every committed
+// transaction that wrote something, e.g. to feed a standby. It runs inside
+// Commit before the transaction's key locks are released, so a slow hook
+// delays the commit (which is how synchronous replication behaves).
+// It should be set before the database is shared.
+func (db *Database) SetCommitHook(hook func(CommitRecord)) {
+	db.commitHook = hook
+}
+
+// publishCommit logs tx's write set to the WAL and hands it to the commit
+// hook, if there are any
+func (db *Database) publishCommit(tx *Transaction) {
+	if (db.commitHook == nil && db.storage == nil) || len(tx.writeOrder) == 0 {
+		return
+	}
+
+	record := CommitRecord{
+		Seq:    db.commitSeq.Add(1),
+		TxID:   tx.ID,
+		Writes: make([]CommittedWrite, 0, len(tx.writeOrder)),
+	}
+	for _, key := range tx.writeOrder {
+		write := tx.writes[key]
+		record.Writes = append(record.Writes, CommittedWrite{
+			Key:       key,
+			Value:     write.Value,
+			Deleted:   write.Deleted,
+			ExpiresAt: write.ExpiresAt,
+			Payload:   write.Payload,
+		})
+	}
+	if db.storage != nil {
+		if db.walFaults(tx) {
+			return // The process died before the commit was logged or shipped
+		}
+		db.storage.log(record)
+		db.crashAfterWAL()
+	}
+	if db.commitHook != nil {
+		db.commitHook(record)
+	}
+}
+
+// applyRecord replays a committed transaction as a new transaction of db
+func (db *Database) applyRecord(record CommitRecord) error {
+	tx := db.BeginTransaction()
+	for _, write := range record.Writes {
+		if write.Deleted {
+			db.remove(tx, write.Key)
+		} else {
+			db.putCommitted(tx, write.Key, write.Value, write.Payload, write.ExpiresAt)
+		}
+	}
+	return db.Commit(tx)
+}
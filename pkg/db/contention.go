@@ -0,0 +1,167 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The lock manager profiles its own contention: for every key, how often
+// it was locked, how long transactions waited for it and how long owners
+// held it; and overall, the longest waits together with the transaction
+// that waited and the one holding the lock when the wait began.
+// db.ContentionReport prints the hottest keys and the longest waits.
+
+// maxTrackedWaits is how many of the longest waits the profile keeps
+const maxTrackedWaits = 32
+
+// KeyContention profiles the lock on one key
+type KeyContention struct {
+	Key          string
+	Acquisitions int           // Times the lock was granted
+	Waits        int           // Acquisitions that had to wait, including those that gave up
+	Timeouts     int           // Waits that gave up
+	TotalWait    time.Duration // Time spent waiting for the lock
+	MaxWait      time.Duration
+	MaxWaiter    int           // Transaction that waited MaxWait
+	MaxBlocker   int           // Transaction holding the lock when that wait began
+	TotalHold    time.Duration // Time owners held the lock
+	MaxHold      time.Duration
+	MaxHolder    int // Transaction that held the lock for MaxHold
+}
+
+// LockWait is one transaction's wait for a key lock
+type LockWait struct {
+	Key     string
+	Waiter  int           // Transaction that waited
+	Holder  int           // Transaction holding the lock when the wait began
+	Wait    time.Duration // How long it waited
+	Granted bool          // Whether it got the lock or gave up
+}
+
+// keyContention returns key's profile, creating it if needed. Must be
+// called with lm.mu held.
+func (lm *LockManager) keyContention(key string) *KeyContention {
+	c, exists := lm.contention[key]
+	if !exists {
+		c = &KeyContention{Key: key}
+		lm.contention[key] = c
+	}
+	return c
+}
+
+// recordWait profiles a finished wait. Must be called with lm.mu held.
+func (lm *LockManager) recordWait(wait LockWait) {
+	c := lm.keyContention(wait.Key)
+	c.Waits++
+	if !wait.Granted {
+		c.Timeouts++
+	}
+	c.TotalWait += wait.Wait
+	if wait.Wait > c.MaxWait {
+		c.MaxWait, c.MaxWaiter, c.MaxBlocker = wait.Wait, wait.Waiter, wait.Holder
+	}
+
+	// Keep the longest waits, longest first
+	if len(lm.longest) == maxTrackedWaits && wait.Wait <= lm.longest[len(lm.longest)-1].Wait {
+		return
+	}
+	i := sort.Search(len(lm.longest), func(i int) bool { return lm.longest[i].Wait < wait.Wait })
+	lm.longest = append(lm.longest, LockWait{})
+	copy(lm.longest[i+1:], lm.longest[i:])
+	lm.longest[i] = wait
+	if len(lm.longest) > maxTrackedWaits {
+		lm.longest = lm.longest[:maxTrackedWaits]
+	}
+}
+
+// recordHold profiles txID's release of key after holding it for hold.
+// Must be called with lm.mu held.
+func (lm *LockManager) recordHold(key string, txID int, hold time.Duration) {
+	c := lm.keyContention(key)
+	c.TotalHold += hold
+	if hold > c.MaxHold {
+		c.MaxHold, c.MaxHolder = hold, txID
+	}
+}
+
+// Contention returns the profile of every key ever locked, the keys with
+// the most total wait first
+func (lm *LockManager) Contention() []KeyContention {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	profile := make([]KeyContention, 0, len(lm.contention))
+	for _, c := range lm.contention {
+		profile = append(profile, *c)
+	}
+	sort.Slice(profile, func(i, j int) bool {
+		if profile[i].TotalWait != profile[j].TotalWait {
+			return profile[i].TotalWait > profile[j].TotalWait
+		}
+		if profile[i].Acquisitions != profile[j].Acquisitions {
+			return profile[i].Acquisitions > profile[j].Acquisitions
+		}
+		return profile[i].Key < profile[j].Key
+	})
+	return profile
+}
+
+// LongestWaits returns up to n of the longest lock waits, longest first.
+// Only the longest 32 are kept.
+func (lm *LockManager) LongestWaits(n int) []LockWait {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return append([]LockWait(nil), lm.longest[:min(n, len(lm.longest))]...)
+}
+
+// LockContention returns up to n of the keys with the most time spent
+// waiting for their locks and up to n of the longest waits; none if the
+// engine takes no key locks
+func (db *Database) LockContention(n int) ([]KeyContention, []LockWait) {
+	if db.locks == nil {
+		return nil, nil
+	}
+	keys := db.locks.Contention()
+	return keys[:min(n, len(keys))], db.locks.LongestWaits(n)
+}
+
+// ContentionReport prints the topN keys with the most time spent waiting
+// for their locks, and the topN longest waits with the transactions
+// behind them. Only two-phase locking takes key locks; other engines have
+// nothing to report.
+func (db *Database) ContentionReport(topN int) {
+	fmt.Printf("\n=== Lock Contention (%s) ===\n", db.EngineName())
+	if db.locks == nil {
+		fmt.Println("No key locks: the engine does not use two-phase locking")
+		return
+	}
+
+	keys := db.locks.Contention()
+	if len(keys) == 0 {
+		fmt.Println("No key was locked")
+		return
+	}
+	fmt.Printf("Hottest keys (of %d locked):\n", len(keys))
+	for _, c := range keys[:min(topN, len(keys))] {
+		fmt.Printf("  %-12s %5d locks, %4d waits (%d gave up), waited %v total / %v max (tx %d behind tx %d), held %v max by tx %d\n",
+			c.Key, c.Acquisitions, c.Waits, c.Timeouts,
+			c.TotalWait.Round(time.Microsecond), c.MaxWait.Round(time.Microsecond), c.MaxWaiter, c.MaxBlocker,
+			c.MaxHold.Round(time.Microsecond), c.MaxHolder)
+	}
+
+	waits := db.locks.LongestWaits(topN)
+	if len(waits) == 0 {
+		fmt.Println("No transaction ever waited for a lock")
+		return
+	}
+	fmt.Println("Longest waits:")
+	for _, w := range waits {
+		outcome := "granted"
+		if !w.Granted {
+			outcome = "gave up"
+		}
+		fmt.Printf("  tx %d waited %v for %s held by tx %d (%s)\n",
+			w.Waiter, w.Wait.Round(time.Microsecond), w.Key, w.Holder, outcome)
+	}
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// TestContentionProfilesWaitsAndHolds verifies a contended key records the
+// wait, who waited behind whom, and how long the lock was held
+func TestContentionProfilesWaitsAndHolds(t *testing.T) {
+	lm := NewLockManager()
+	lm.SetTimeout(5 * time.Millisecond)
+
+	lm.Acquire(1, "hot")
+	lm.Acquire(1, "cold")
+	if lm.Acquire(2, "hot") {
+		t.Fatal("tx 2 should time out while tx 1 holds hot")
+	}
+
+	granted := make(chan bool)
+	lm.SetTimeout(time.Second)
+	go func() { granted <- lm.Acquire(3, "hot") }()
+	time.Sleep(10 * time.Millisecond)
+	lm.ReleaseAll(1)
+	if !<-granted {
+		t.Fatal("tx 3 should get hot once tx 1 released it")
+	}
+	lm.ReleaseAll(3)
+
+	profile := lm.Contention()
+	if len(profile) != 2 || profile[0].Key != "hot" {
+		t.Fatalf("Expected hot to be the most contended of 2 keys, got %+v", profile)
+	}
+	hot := profile[0]
+	if hot.Acquisitions != 2 || hot.Waits != 2 || hot.Timeouts != 1 {
+		t.Errorf("Expected 2 locks and 2 waits, 1 timed out, got %+v", hot)
+	}
+	if hot.MaxWaiter != 3 || hot.MaxBlocker != 1 || hot.MaxWait < 10*time.Millisecond {
+		t.Errorf("Expected the longest wait to be tx 3 behind tx 1 for 10ms or more, got %+v", hot)
+	}
+	if hot.MaxHolder != 1 || hot.MaxHold < 15*time.Millisecond {
+		t.Errorf("Expected tx 1 to have held hot longest, for 15ms or more, got %+v", hot)
+	}
+
+	waits := lm.LongestWaits(5)
+	if len(waits) != 2 || waits[0].Waiter != 3 || !waits[0].Granted || waits[1].Waiter != 2 || waits[1].Granted {
+		t.Errorf("Expected tx 3's granted wait then tx 2's timeout, got %+v", waits)
+	}
+}
+
+// TestLongestWaitsAreBounded verifies only the longest waits are kept
+func TestLongestWaitsAreBounded(t *testing.T) {
+	lm := NewLockManager()
+	for i := 1; i <= 2*maxTrackedWaits; i++ {
+		lm.recordWait(LockWait{Key: "k", Waiter: i, Wait: time.Duration(i)})
+	}
+	waits := lm.LongestWaits(100)
+	if len(waits) != maxTrackedWaits || waits[0].Waiter != 2*maxTrackedWaits || waits[len(waits)-1].Waiter != maxTrackedWaits+1 {
+		t.Errorf("Expected the %d longest waits, longest first, got %d from tx %d to tx %d",
+			maxTrackedWaits, len(waits), waits[0].Waiter, waits[len(waits)-1].Waiter)
+	}
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"fmt"
+)
+
+// LockGranularity is what a two-phase locking transaction's lock on a key
+// covers
+type LockGranularity int
+
+const (
+	// KeyLocks locks each key separately, so transactions on different
+	// keys run side by side
+	KeyLocks LockGranularity = iota
+	// DatabaseLock turns every key lock into one lock on the whole
+	// database, held until commit: coarse locking, under which one slow
+	// transaction holds up every other
+	DatabaseLock
+)
+
+func (g LockGranularity) String() string {
+	switch g {
+	case KeyLocks:
+		return "per-key locks"
+	case DatabaseLock:
+		return "database lock"
+	default:
+		return fmt.Sprintf("LockGranularity(%d)", int(g))
+	}
+}
+
+// databaseLockName is the lock every key maps to under DatabaseLock
+const databaseLockName = "*"
+
+// lockName returns the lock that covers key. Must be called with lm.mu
+// held.
+func (lm *LockManager) lockName(key string) string {
+	if lm.granularity == DatabaseLock {
+		return databaseLockName
+	}
+	return key
+}
+
+// SetGranularity chooses what a key lock covers. Change it only while no
+// transaction holds locks.
+func (lm *LockManager) SetGranularity(granularity LockGranularity) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.granularity = granularity
+}
+
+// Waiting returns how many transactions are waiting for a lock
+func (lm *LockManager) Waiting() int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return len(lm.waiting)
+}
+
+// LockManager returns the two-phase locking engine's lock manager; nil for
+// the other engines, which take no key locks
+func (db *Database) LockManager() *LockManager {
+	return db.locks
+}
+
+// SetLockGranularity chooses what a two-phase locking transaction's key
+// locks cover; the other engines take no key locks
+func (db *Database) SetLockGranularity(granularity LockGranularity) {
+	if db.locks != nil {
+		db.locks.SetGranularity(granularity)
+	}
+}
@@ -0,0 +1,25 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDatabaseLockCoversEveryKey verifies that under a database lock
+// transactions on different keys exclude each other
+func TestDatabaseLockCoversEveryKey(t *testing.T) {
+	lm := NewLockManager()
+	lm.SetTimeout(10 * time.Millisecond)
+	lm.SetGranularity(DatabaseLock)
+	lm.Acquire(1, "a")
+	if lm.Acquire(2, "b") {
+		t.Error("tx 2 locked b while tx 1 held the database lock")
+	}
+	if !lm.Holds(1, "b") {
+		t.Error("tx 1's database lock does not cover b")
+	}
+	lm.ReleaseAll(1)
+	if !lm.Acquire(2, "b") {
+		t.Error("tx 2 could not lock b once tx 1 released the database")
+	}
+}
@@ -0,0 +1,298 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A Coordinator runs two-phase commit over participants. In phase one it
+// asks each to prepare, which is its vote: a participant that prepares has
+// promised to commit if told to and can no longer abort on its own. If
+// every vote is yes the coordinator logs the decision to commit, the
+// commit point, then tells every participant to commit; otherwise it tells
+// them all to abort. The decision log survives a coordinator crash. A
+// coordinator that crashes after phase one leaves its participants in
+// doubt, prepared and holding their locks, until Recover reads the log:
+// transactions with a logged commit decision are committed, the rest are
+// aborted (presumed abort).
+
+var (
+	// ErrVotedNo means a participant could not prepare, so every
+	// participant was aborted. It wraps the participant's error.
+	ErrVotedNo = errors.New("participant voted no")
+
+	// ErrInDoubt means the coordinator failed after participants prepared:
+	// the transaction commits or aborts when the coordinator recovers, and
+	// the client does not know which
+	ErrInDoubt = errors.New("transaction in doubt")
+)
+
+// Participant is one party to a two-phase commit
+type Participant interface {
+	// Prepare votes: nil promises to commit when told to
+	Prepare() error
+	// Commit makes a prepared participant's changes durable
+	Commit() error
+	// Abort discards the participant's changes; it does nothing to a
+	// participant that already finished
+	Abort()
+}
+
+// Failpoint makes a coordinator fail at one point of the protocol
+type Failpoint int
+
+const (
+	// NoFailure runs the protocol to completion
+	NoFailure Failpoint = iota
+	// VoteNo has the last participant vote no after the others prepared
+	VoteNo
+	// CrashBeforeDecision crashes the coordinator once every participant
+	// has prepared, before it logs a decision
+	CrashBeforeDecision
+	// CrashAfterDecision crashes the coordinator right after it logs the
+	// decision to commit, before telling anyone
+	CrashAfterDecision
+	// CrashMidCommit crashes the coordinator after it told only the first
+	// participant to commit
+	CrashMidCommit
+)
+
+func (f Failpoint) String() string {
+	switch f {
+	case NoFailure:
+		return "none"
+	case VoteNo:
+		return "vote-no"
+	case CrashBeforeDecision:
+		return "crash-before-decision"
+	case CrashAfterDecision:
+		return "crash-after-decision"
+	case CrashMidCommit:
+		return "crash-mid-commit"
+	default:
+		return fmt.Sprintf("Failpoint(%d)", int(f))
+	}
+}
+
+// CoordinatorStats counts how a coordinator's transactions ended
+type CoordinatorStats struct {
+	Committed        int // Committed in the protocol's normal course
+	Aborted          int // Aborted because a participant voted no
+	InDoubt          int // Left in doubt by a coordinator crash
+	RecoveredCommits int // In-doubt transactions Recover committed
+	RecoveredAborts  int // In-doubt transactions Recover aborted
+}
+
+// inDoubtTx is a transaction whose participants await a decision
+type inDoubtTx struct {
+	participants []Participant
+	committed    []bool // Participants already told to commit
+}
+
+// Coordinator runs two-phase commits and remembers their decisions
+type Coordinator struct {
+	mu        sync.Mutex
+	decisions map[int]bool // The decision log: transaction -> commit
+	inDoubt   map[int]*inDoubtTx
+	failpoint Failpoint // Fires on the next two-phase commit, then resets
+	stats     CoordinatorStats
+}
+
+// NewCoordinator returns a coordinator with an empty decision log
+func NewCoordinator() *Coordinator {
+	return &Coordinator{
+		decisions: make(map[int]bool),
+		inDoubt:   make(map[int]*inDoubtTx),
+	}
+}
+
+// SetFailpoint makes the next two-phase commit fail at failpoint
+func (c *Coordinator) SetFailpoint(failpoint Failpoint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failpoint = failpoint
+}
+
+// takeFailpoint returns the armed failpoint and disarms it
+func (c *Coordinator) takeFailpoint() Failpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	failpoint := c.failpoint
+	c.failpoint = NoFailure
+	return failpoint
+}
+
+// Stats returns how the coordinator's transactions ended
+func (c *Coordinator) Stats() CoordinatorStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// InDoubt returns how many transactions await recovery
+func (c *Coordinator) InDoubt() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.inDoubt)
+}
+
+// Decision returns the logged decision for transaction id, if any
+func (c *Coordinator) Decision(id int) (commit bool, logged bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	commit, logged = c.decisions[id]
+	return commit, logged
+}
+
+// Run commits transaction id over participants with two-phase commit,
+// preparing them in the order given. If a participant votes no, all of
+// them are aborted and its error is returned wrapped in ErrVotedNo. If the
+// coordinator fails once they have prepared, Run returns ErrInDoubt and
+// Recover finishes them.
+func (c *Coordinator) Run(id int, participants []Participant) error {
+	failpoint := c.takeFailpoint()
+
+	// Phase one: collect the votes
+	for i, p := range participants {
+		err := p.Prepare()
+		if err == nil && failpoint == VoteNo && i == len(participants)-1 {
+			err = fmt.Errorf("participant %d refused", i)
+		}
+		if err != nil {
+			for _, other := range participants {
+				other.Abort()
+			}
+			// An abort needs no log entry: no decision means abort
+			c.mu.Lock()
+			c.stats.Aborted++
+			c.mu.Unlock()
+			return fmt.Errorf("%w: %w", ErrVotedNo, err)
+		}
+	}
+
+	doubt := &inDoubtTx{participants: participants, committed: make([]bool, len(participants))}
+	c.mu.Lock()
+	if failpoint == CrashBeforeDecision {
+		c.inDoubt[id] = doubt
+		c.stats.InDoubt++
+		c.mu.Unlock()
+		return fmt.Errorf("%w: coordinator crashed before deciding transaction %d", ErrInDoubt, id)
+	}
+	// The commit point
+	c.decisions[id] = true
+	if failpoint == CrashAfterDecision {
+		c.inDoubt[id] = doubt
+		c.stats.InDoubt++
+		c.mu.Unlock()
+		return fmt.Errorf("%w: coordinator crashed after deciding to commit transaction %d", ErrInDoubt, id)
+	}
+	c.mu.Unlock()
+
+	// Phase two: every participant has promised to commit
+	var errs []error
+	for i, p := range participants {
+		if failpoint == CrashMidCommit && i == 1 {
+			c.mu.Lock()
+			c.inDoubt[id] = doubt
+			c.stats.InDoubt++
+			c.mu.Unlock()
+			return fmt.Errorf("%w: coordinator crashed while committing transaction %d", ErrInDoubt, id)
+		}
+		if err := p.Commit(); err != nil {
+			errs = append(errs, err)
+		}
+		doubt.committed[i] = true
+	}
+	c.mu.Lock()
+	delete(c.decisions, id) // Every participant knows: the entry can go
+	c.stats.Committed++
+	c.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// Recover finishes every in-doubt transaction as the decision log says:
+// those with a commit decision are committed on the participants that
+// have not committed yet, the others are aborted. It returns how many
+// were committed and aborted.
+func (c *Coordinator) Recover() (committed, aborted int) {
+	c.mu.Lock()
+	pending := c.inDoubt
+	c.inDoubt = make(map[int]*inDoubtTx)
+	c.mu.Unlock()
+
+	for id, doubt := range pending {
+		commit, _ := c.Decision(id)
+		for i, p := range doubt.participants {
+			switch {
+			case !commit:
+				p.Abort()
+			case !doubt.committed[i]:
+				p.Commit()
+			}
+		}
+		c.mu.Lock()
+		delete(c.decisions, id)
+		if commit {
+			committed++
+			c.stats.RecoveredCommits++
+		} else {
+			aborted++
+			c.stats.RecoveredAborts++
+		}
+		c.mu.Unlock()
+	}
+	return committed, aborted
+}
+
+// StartRecovery runs Recover every interval until ctx is done or stop is
+// called, standing in for a coordinator that restarts after a crash
+func (c *Coordinator) StartRecovery(ctx context.Context, interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				c.Recover()
+				return
+			case <-ticker.C:
+				c.Recover()
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// shardParticipant is a shard's part of a sharded transaction
+type shardParticipant struct {
+	shard int
+	db    *Database
+	tx    *Transaction
+}
+
+func (p shardParticipant) Prepare() error {
+	if err := p.db.Prepare(p.tx); err != nil {
+		return fmt.Errorf("shard %d: %w", p.shard, err)
+	}
+	return nil
+}
+
+func (p shardParticipant) Commit() error {
+	if err := p.db.Commit(p.tx); err != nil {
+		return fmt.Errorf("shard %d: %w", p.shard, err)
+	}
+	return nil
+}
+
+func (p shardParticipant) Abort() {
+	p.db.Abort(p.tx)
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeParticipant records what the coordinator told it
+type fakeParticipant struct {
+	voteNo    bool
+	prepared  bool
+	committed int
+	aborted   bool
+}
+
+func (p *fakeParticipant) Prepare() error {
+	if p.voteNo {
+		p.aborted = true
+		return errors.New("cannot prepare")
+	}
+	p.prepared = true
+	return nil
+}
+
+func (p *fakeParticipant) Commit() error {
+	p.committed++
+	return nil
+}
+
+func (p *fakeParticipant) Abort() {
+	if p.committed == 0 {
+		p.aborted = true
+	}
+}
+
+// newFakeParticipants returns n participants, as fakes and as Participants
+func newFakeParticipants(n int) ([]*fakeParticipant, []Participant) {
+	fakes := make([]*fakeParticipant, n)
+	participants := make([]Participant, n)
+	for i := range fakes {
+		fakes[i] = &fakeParticipant{}
+		participants[i] = fakes[i]
+	}
+	return fakes, participants
+}
+
+// TestCoordinatorCommits verifies every participant commits exactly once
+// when all vote yes, and nothing is left in the decision log
+func TestCoordinatorCommits(t *testing.T) {
+	c := NewCoordinator()
+	fakes, participants := newFakeParticipants(3)
+	if err := c.Run(1, participants); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for i, p := range fakes {
+		if !p.prepared || p.committed != 1 || p.aborted {
+			t.Errorf("Participant %d: %+v, want prepared and committed once", i, *p)
+		}
+	}
+	if _, logged := c.Decision(1); logged {
+		t.Error("Expected the decision to be forgotten once every participant committed")
+	}
+}
+
+// TestCoordinatorAbortsOnNoVote verifies one no vote aborts every
+// participant, including those that already prepared
+func TestCoordinatorAbortsOnNoVote(t *testing.T) {
+	c := NewCoordinator()
+	fakes, participants := newFakeParticipants(3)
+	fakes[1].voteNo = true
+	if err := c.Run(1, participants); !errors.Is(err, ErrVotedNo) {
+		t.Fatalf("Expected ErrVotedNo, got %v", err)
+	}
+	for i, p := range fakes {
+		if p.committed != 0 || !p.aborted {
+			t.Errorf("Participant %d: %+v, want aborted", i, *p)
+		}
+	}
+
+	fakes, participants = newFakeParticipants(2)
+	c.SetFailpoint(VoteNo)
+	if err := c.Run(2, participants); !errors.Is(err, ErrVotedNo) {
+		t.Fatalf("Expected the VoteNo failpoint to abort, got %v", err)
+	}
+	if !fakes[1].aborted || !fakes[0].aborted {
+		t.Errorf("Expected both participants aborted, got %+v and %+v", *fakes[0], *fakes[1])
+	}
+}
+
+// TestCoordinatorRecovery verifies Recover commits in-doubt transactions
+// with a logged commit decision, completing only the participants that
+// had not committed, and aborts those without one
+func TestCoordinatorRecovery(t *testing.T) {
+	cases := []struct {
+		failpoint Failpoint
+		commit    bool
+	}{
+		{CrashBeforeDecision, false},
+		{CrashAfterDecision, true},
+		{CrashMidCommit, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.failpoint.String(), func(t *testing.T) {
+			c := NewCoordinator()
+			c.SetFailpoint(tc.failpoint)
+			fakes, participants := newFakeParticipants(3)
+			if err := c.Run(1, participants); !errors.Is(err, ErrInDoubt) {
+				t.Fatalf("Expected ErrInDoubt, got %v", err)
+			}
+			if c.InDoubt() != 1 {
+				t.Fatalf("Expected 1 transaction in doubt, got %d", c.InDoubt())
+			}
+
+			committed, aborted := c.Recover()
+			if tc.commit && committed != 1 || !tc.commit && aborted != 1 {
+				t.Errorf("Recover committed %d and aborted %d, want commit=%v", committed, aborted, tc.commit)
+			}
+			for i, p := range fakes {
+				if tc.commit && (p.committed != 1 || p.aborted) {
+					t.Errorf("Participant %d: %+v, want committed once", i, *p)
+				}
+				if !tc.commit && (p.committed != 0 || !p.aborted) {
+					t.Errorf("Participant %d: %+v, want aborted", i, *p)
+				}
+			}
+			if c.InDoubt() != 0 {
+				t.Errorf("Expected nothing in doubt after Recover, got %d", c.InDoubt())
+			}
+		})
+	}
+}
+
+// TestShardedInDoubtHoldsLocks verifies an in-doubt cross-shard
+// transaction keeps its shards' locks until recovery commits it
+func TestShardedInDoubtHoldsLocks(t *testing.T) {
+	sharded := NewShardedDatabase(2, NewTwoPhaseLockingDatabase)
+	a, b := "a", "b"
+	for i := 0; sharded.ShardFor(a) == sharded.ShardFor(b); i++ {
+		b = "b" + string(rune('0'+i))
+	}
+	setup := sharded.Begin()
+	sharded.Put(setup, a, 100)
+	sharded.Put(setup, b, 100)
+	if err := sharded.Commit(setup); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+
+	sharded.Coordinator().SetFailpoint(CrashMidCommit)
+	tx := sharded.Begin()
+	sharded.Add(tx, a, -10)
+	sharded.Add(tx, b, 10)
+	if err := sharded.Commit(tx); !errors.Is(err, ErrInDoubt) {
+		t.Fatalf("Expected ErrInDoubt, got %v", err)
+	}
+
+	later := sharded.Shard(sharded.ShardFor(b))
+	later.SetLockTimeout(0)
+	probe := later.BeginTransaction()
+	if _, err := later.Get(probe, b); err == nil {
+		t.Error("Expected the in-doubt shard to still hold its lock")
+	}
+	later.Abort(probe)
+
+	sharded.Coordinator().Recover()
+	check := sharded.Begin()
+	va, _ := sharded.Get(check, a)
+	vb, _ := sharded.Get(check, b)
+	sharded.Commit(check)
+	if va != 90 || vb != 110 {
+		t.Errorf("Expected the recovered transfer on both shards, got a=%d b=%d", va, vb)
+	}
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"hash/fnv"
+	"maps"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// db.Snapshot returns an immutable view of every committed record that
+// readers can walk for as long as they like without taking the database
+// lock or racing with commits. The view is copy-on-write: it is split into
+// viewShards maps, and each commit publishes a new view that shares every
+// shard it did not touch and copies the ones it did. Nothing is copied
+// until the first Snapshot call, so databases nobody snapshots pay nothing.
+
+// viewShards is how many maps a view is split into
+const viewShards = 64
+
+// ReadView is an immutable point-in-time view of a database's committed
+// records, tombstones included. It stays valid, and unchanged, however the
+// database moves on, except that keys whose TTL runs out disappear from it.
+type ReadView struct {
+	shards [viewShards]map[string]Record
+	clock  Clock // Expires TTLs by the database's clock
+}
+
+// cowViews holds the latest view of a database once snapshots are enabled.
+// It has its own mutex, even when unsynchronized, so that publishing views
+// cannot crash the program.
+type cowViews struct {
+	mu      sync.Mutex
+	enabled atomic.Bool
+	latest  atomic.Pointer[ReadView]
+}
+
+// viewShard returns the shard key belongs to
+func viewShard(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % viewShards)
+}
+
+// Snapshot returns the latest committed state as an immutable view. It
+// never blocks once snapshots are enabled; the first call builds the view
+// from the records under the write lock, so on the unsynchronized engine
+// make it before the database is shared.
+func (db *Database) Snapshot() *ReadView {
+	if view := db.views.latest.Load(); view != nil {
+		return view
+	}
+
+	// Same lock order as a commit publishing a view
+	db.wLock()
+	defer db.wUnlock()
+	db.views.mu.Lock()
+	defer db.views.mu.Unlock()
+	if view := db.views.latest.Load(); view != nil {
+		return view
+	}
+
+	view := &ReadView{clock: db.clock}
+	for i := range view.shards {
+		view.shards[i] = make(map[string]Record)
+	}
+	db.records.each(func(key string, record *Record) {
+		view.shards[viewShard(key)][key] = *record
+	})
+	db.views.latest.Store(view)
+	db.views.enabled.Store(true)
+	return view
+}
+
+// publishView publishes a new view with the current records of keys. Must
+// be called with the write lock held, after changing the records.
+func (db *Database) publishView(keys []string) {
+	if !db.views.enabled.Load() || len(keys) == 0 {
+		return
+	}
+	db.views.mu.Lock()
+	defer db.views.mu.Unlock()
+
+	old := db.views.latest.Load()
+	view := *old
+	copied := make(map[int]bool)
+	for _, key := range keys {
+		shard := viewShard(key)
+		if !copied[shard] {
+			view.shards[shard] = maps.Clone(old.shards[shard])
+			copied[shard] = true
+		}
+		if record, exists := db.records.get(key); exists {
+			view.shards[shard][key] = *record
+		} else {
+			delete(view.shards[shard], key)
+		}
+	}
+	db.views.latest.Store(&view)
+}
+
+// Get returns key's value in the view
+func (v *ReadView) Get(key string) (int, bool) {
+	record, ok := v.Record(key)
+	return record.Value, ok
+}
+
+// Record returns a copy of key's record if it is live in the view
+func (v *ReadView) Record(key string) (Record, bool) {
+	record, exists := v.shards[viewShard(key)][key]
+	if !exists || !record.live(v.clock.Now()) {
+		return Record{}, false
+	}
+	return record, true
+}
+
+// Len returns how many keys are live in the view
+func (v *ReadView) Len() int {
+	count := 0
+	now := v.clock.Now()
+	for _, shard := range v.shards {
+		for _, record := range shard {
+			if record.live(now) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Keys returns the live keys in the view, sorted
+func (v *ReadView) Keys() []string {
+	keys := make([]string, 0)
+	now := v.clock.Now()
+	for _, shard := range v.shards {
+		for key, record := range shard {
+			if record.live(now) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Range calls fn for every live record in the view, in no particular
+// order, until fn returns false
+func (v *ReadView) Range(fn func(record Record) bool) {
+	now := v.clock.Now()
+	for _, shard := range v.shards {
+		for _, record := range shard {
+			if record.live(now) && !fn(record) {
+				return
+			}
+		}
+	}
+}
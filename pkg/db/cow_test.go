@@ -0,0 +1,96 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestSnapshotViewIsImmutable verifies a view keeps showing the state it
+// was taken at while later commits change and delete keys
+func TestSnapshotViewIsImmutable(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetTombstoneGracePeriod(0)
+	tx := db.BeginTransaction()
+	db.Put(tx, "a", 1)
+	db.Put(tx, "b", 2)
+	db.Commit(tx)
+
+	before := db.Snapshot()
+	tx = db.BeginTransaction()
+	db.Put(tx, "a", 10)
+	db.Remove(tx, "b")
+	db.Put(tx, "c", 3)
+	db.Commit(tx)
+	db.CollectTombstones()
+	after := db.Snapshot()
+
+	if value, ok := before.Get("a"); !ok || value != 1 {
+		t.Errorf("Old view a = %d, %v; want 1", value, ok)
+	}
+	if value, ok := before.Get("b"); !ok || value != 2 {
+		t.Errorf("Old view b = %d, %v; want 2", value, ok)
+	}
+	if _, ok := before.Get("c"); ok || before.Len() != 2 {
+		t.Errorf("Old view has keys %v, want [a b]", before.Keys())
+	}
+
+	if value, _ := after.Get("a"); value != 10 {
+		t.Errorf("New view a = %d, want 10", value)
+	}
+	if _, ok := after.Get("b"); ok {
+		t.Error("New view still has the deleted key b")
+	}
+	if keys := after.Keys(); fmt.Sprint(keys) != "[a c]" {
+		t.Errorf("New view has keys %v, want [a c]", keys)
+	}
+}
+
+// TestSnapshotViewIsConsistent takes views while transfers run and
+// verifies every view shows the same total
+func TestSnapshotViewIsConsistent(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	const accounts = 8
+	setup := db.BeginTransaction()
+	for i := 0; i < accounts; i++ {
+		db.Put(setup, fmt.Sprintf("account_%d", i), 100)
+	}
+	db.Commit(setup)
+	db.Snapshot()
+
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; !stop.Load(); i++ {
+				from := fmt.Sprintf("account_%d", (w+i)%accounts)
+				to := fmt.Sprintf("account_%d", (w+i+1)%accounts)
+				db.Transfer(from, to, 1+i%5)
+			}
+		}(w)
+	}
+
+	views := 0
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		total := 0
+		db.Snapshot().Range(func(record Record) bool {
+			total += record.Value
+			return true
+		})
+		if total != accounts*100 {
+			t.Errorf("View total = %d, want %d", total, accounts*100)
+			break
+		}
+		views++
+	}
+	stop.Store(true)
+	wg.Wait()
+	if views == 0 {
+		t.Error("No views taken")
+	}
+}
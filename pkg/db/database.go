@@ -0,0 +1,1051 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Record represents a single database record
+type Record struct {
+	Key       string
+	Value     int
+	Version   int       // Used to detect lost updates
+	UpdatedAt time.Time
+	Deleted   bool // Tombstone: the key was deleted but the record is kept until GC
+	ExpiresAt time.Time // When the key expires; zero for never (see PutWithTTL)
+	DeletedBy int  // ID of the transaction that deleted the key
+	WrittenBy int  // ID of the transaction that last wrote or deleted the key
+	CreatedBy int  // ID of the transaction that created the key, or recreated it after a delete
+	Payload   []byte // String or binary payload alongside Value; nil for none (see PutBytes)
+
+	history []Modification // Audit trail, see History
+}
+
+// Transaction represents a database transaction
+type Transaction struct {
+	ID        int
+	StartTime time.Time
+	ops       opLog    // Latest operations, for debugging; see Operations and logOp
+	ClientID  int      // The client running the transaction, tagging its traces; 0 if unknown
+	Aborted     bool   // Set when the engine aborted the transaction
+	AbortReason string // Why the engine aborted it
+	conflict    bool   // Lost a conflict or a lock wait; running it again may succeed
+	failure     error  // Why the current operation's lock wait failed, if it did
+	readFrom    int    // Writer of the version the current operation read, for the journal; see readOwnWrite
+	lockWait    time.Duration // Time spent waiting for key locks
+	Isolation   IsolationLevel
+	Deadline    time.Time // When the transaction should be done by; zero for none
+	Priority    int       // Higher is more urgent; 0 unless its context set one with WithPriority
+
+	status    TxStatus        // Active until Commit or Abort
+	beginSite string          // Where it was begun, recorded for leak reports
+	ctx       context.Context // Aborts the transaction once done; nil for none
+	thread    *scheduleThread // Yields to a Scheduler before each operation; nil outside one
+	admission *admissionQueue // Admission slot held until Commit/Abort
+
+	// SnapshotTS is the snapshot an MVCC transaction reads. writes is the
+	// transaction's write set, buffered until Commit applies it and
+	// discarded by Abort.
+	SnapshotTS int64
+	writes     map[string]pendingWrite
+	writeOrder []string
+
+	parent *Transaction // Enclosing transaction of a nested one, see BeginNested
+
+	loading bool // A BulkLoad, whose writes take no processing time
+
+	journal []JournalEntry // Operations held until Commit adds them to the journal
+
+	// prepared is set by Prepare; an MVCC transaction then holds the
+	// commit locks until Commit or Abort
+	prepared         bool
+	holdsCommitLocks bool
+}
+
+// Database represents an in-memory key-value database
+// WARNING: A database created by NewDatabase or NewUnsynchronizedDatabase
+// has NO synchronization! Multiple goroutines accessing it will cause race
+// conditions. NewSynchronizedDatabase adds a reader-writer lock around
+// every operation, and NewTwoPhaseLockingDatabase additionally isolates
+// transactions with two-phase locking.
+type Database struct {
+	records recordMap // One map per stripe; see stripes.go
+	txCounter int
+	stats   statCounters // Atomic and sharded, so safe on every engine; see Stats
+	clients clientRegistry // Per-client statistics, see ClientStats
+
+	// lock guards records, stripe by stripe, when non-nil; txMu guards
+	// the transaction counter on a synchronized database
+	lock    *stripedLock
+	txMu    sync.Mutex
+
+	// locks holds per-key transaction locks under two-phase locking
+	locks *LockManager
+
+	// mvcc holds every committed version under multi-version concurrency
+	// control; records is then the latest-committed view
+	mvcc *mvccStore
+
+	// tso holds per-key read and write timestamps under timestamp ordering
+	tso *timestampOrdering
+
+	// tombstoneGrace is how long a deleted record is kept as a tombstone
+	// before CollectTombstones may remove it for good
+	tombstoneGrace time.Duration
+
+	upsertOnUpdate bool // Update inserts missing keys instead of failing
+	fieldLocking   bool // Field operations synchronize on the field, not the whole record; see fields.go
+
+	delays *processingDelays // Simulated processing time of each operation; see delays.go
+
+	opLogLimit int // Operation log lines each transaction keeps; see oplog.go
+
+	txPool *sync.Pool // Finished transactions to reuse; nil unless pooling is on, see pool.go
+
+	validators []Validator // Checked before every write is applied
+
+	escrow escrowLedger // Outstanding escrow reservations; see escrow.go
+
+	invariants invariantChecker // Checked after every commit; see invariant.go
+
+	// admission is a counting semaphore bounding active transactions,
+	// nil when unlimited, that admits waiters in admissionPolicy order.
+	// Guarded by txMu.
+	admission       *admissionQueue
+	admissionPolicy AdmissionPolicy
+
+	retryPolicy RetryPolicy // How RunTransaction retries conflicts; guarded by txMu
+	atomicMu    sync.Mutex  // Serializes the atomic operations on engines without isolation
+
+	// changed is broadcast after every exclusive operation for WaitFor
+	changeMu sync.Mutex
+	changed  *sync.Cond
+	waiters  atomic.Int32
+
+	// commitHook receives every committed transaction's writes
+	commitHook func(CommitRecord)
+	commitSeq  atomic.Int64
+
+	storage *storage // Checkpoints and WAL, nil unless AttachStorage was called
+	syncCommits bool // Fsync the WAL before acknowledging each commit; see SetSyncCommits
+	faults  *faultInjector // Injected faults, nil for none; see faults.go
+	clock   Clock          // Tells the time and sleeps; see clock.go
+	journal *Journal // Records committed operations, nil unless SetJournal was called
+	views   cowViews // Copy-on-write views for Snapshot
+	pins    pinTable // Keys held by Pin
+	lru     *lruList // Live keys by last use, nil unless SetCapacity set a limit
+	historyDepth int // Modifications each record keeps, see SetHistoryDepth
+	watches watchers // Subscriptions made with Watch
+	indexes map[string]*valueIndex // Secondary indexes by name, guarded by the database lock
+
+	// tables holds the named tables created by Table. It has its own
+	// mutex, even when unsynchronized, like live below.
+	tablesMu sync.Mutex
+	tables   map[string]*Database
+
+	crashed atomic.Bool // Set by Crash: every later operation fails
+
+	// live holds the top-level transactions not yet committed or aborted.
+	// It has its own mutex, even when unsynchronized, so that leak reports
+	// cannot crash the program.
+	liveMu sync.Mutex
+	live   map[int]*Transaction
+}
+
+// Stats is a snapshot of database statistics, used to detect corruption
+type Stats struct {
+	TotalReads    int
+	TotalWrites   int
+	TotalUpdates  int
+	LostUpdates   int // Detected when version doesn't increment properly
+	DataCorruption int // Detected when data is inconsistent
+	ResurrectionsBlocked int // Stale writes rejected because the key was deleted
+	TombstonesCollected  int // Tombstones removed by garbage collection
+	UpsertInserts        int // Updates that found no key and inserted it
+	LockTimeouts         int // Operations that gave up waiting for a key lock
+	Deadlocks            int // Lock timeouts whose wait was part of a wait-for cycle
+	ValidationFailures   int // Writes rejected by a validator
+	AdmissionQueued      int           // Transactions that had to wait for an admission slot
+	AdmissionWait        time.Duration // Total time spent waiting for admission
+	DeadlinesMissed      int           // Transactions that committed after their deadline
+	WriteConflicts       int           // Commits aborted because another transaction wrote the same key first
+	SerializationFailures int          // Transactions SSI aborted to prevent a non-serializable outcome
+	TimestampRestarts     int          // Transactions T/O aborted for operating out of timestamp order
+	VacuumRuns            int          // MVCC vacuum passes
+	VersionsReclaimed     int          // MVCC versions removed by vacuum
+	TransactionRetries    int          // Attempts RunTransaction repeated after a conflict
+	BackoffWait           time.Duration // Time RunTransaction spent backing off before retries
+	PayloadBytes          int          // Bytes of payload the committed records hold now, not a count since the start
+	KeysEvicted           int          // Least recently used keys deleted to keep within the capacity
+	Pins                  int          // References Pin holds now, not a count since the start
+	PinnedKeys            int          // Keys Pin holds now, not a count since the start
+	KeysExpired           int          // Keys the expiry sweeper deleted after their TTL ran out
+	Checkpoints           int          // Checkpoints written to disk
+	Commits               int          // Top-level transactions committed
+	Aborts                int          // Top-level transactions aborted, for any reason
+	Conflicts             int          // Aborts caused by a lost conflict or lock wait, which a retry may avoid
+
+	Latency map[string]LatencyHistogram // Per-operation latencies by OpKind name, for kinds that ran
+}
+
+// DefaultTombstoneGrace is the default time a tombstone survives before
+// it becomes eligible for garbage collection
+const DefaultTombstoneGrace = 100 * time.Millisecond
+
+// NewDatabase creates a new database instance
+// It has no synchronization, like NewUnsynchronizedDatabase; each engine
+// that has some is created by its own constructor.
+func NewDatabase() *Database {
+	return NewUnsynchronizedDatabase()
+}
+
+// NewTwoPhaseLockingDatabase creates a database instance that uses strict
+// two-phase locking: every key a transaction touches stays locked until it
+// commits or aborts, so transactions never see each other's partial work
+func NewTwoPhaseLockingDatabase() *Database {
+	db := NewSynchronizedDatabase(Fair)
+	db.locks = NewLockManager()
+	return db
+}
+
+// NewUnsynchronizedDatabase creates a database with no synchronization at
+// all. It exists to demonstrate race conditions.
+func NewUnsynchronizedDatabase() *Database {
+	db := &Database{
+		records: newRecordMap(1),
+		stats: newStatCounters(),
+		txCounter: 0,
+		tombstoneGrace: DefaultTombstoneGrace,
+		historyDepth: DefaultHistoryDepth,
+		retryPolicy: DefaultRetryPolicy,
+		live: make(map[int]*Transaction),
+		clock: RealClock,
+		opLogLimit: DefaultOpLogLimit,
+	}
+	db.changed = sync.NewCond(&db.changeMu)
+	db.SetProcessingDelays(DefaultProcessingDelays) // Validated when set
+	if leakDetector != nil {
+		leakDetector.register(db)
+	}
+	if serializabilityChecking {
+		db.journal = NewJournal()
+	}
+	return db
+}
+
+// NewSynchronizedDatabase creates a database whose operations are guarded by
+// reader-writer locks that admit readers and writers according to policy,
+// one per stripe of the records; DefaultStripes sets how many
+func NewSynchronizedDatabase(policy LockPolicy) *Database {
+	db := NewUnsynchronizedDatabase()
+	db.setLock(policy, defaultStripes())
+	return db
+}
+
+// IsSynchronized reports whether the database is protected by a lock
+func (db *Database) IsSynchronized() bool {
+	return db.lock != nil
+}
+
+// EngineName identifies the concurrency control the database uses
+func (db *Database) EngineName() string {
+	switch {
+	case db.mvcc != nil:
+		return "mvcc"
+	case db.tso != nil:
+		return "timestamp-ordering"
+	case db.locks != nil:
+		return "two-phase-locking"
+	case db.lock != nil:
+		return "synchronized/" + db.lock.Policy().String()
+	default:
+		return "unsynchronized"
+	}
+}
+
+// LockWaitStats returns how long readers and writers waited for the
+// database lock (all zero on an unsynchronized database)
+func (db *Database) LockWaitStats() LockWaitStats {
+	if db.lock == nil {
+		return LockWaitStats{}
+	}
+	return db.lock.WaitStats()
+}
+
+// SetLockTimeout sets how long a transaction waits for a key lock
+// under two-phase locking before the operation fails
+func (db *Database) SetLockTimeout(timeout time.Duration) {
+	if db.locks != nil {
+		db.locks.SetTimeout(timeout)
+	}
+}
+
+// lockKey acquires tx's lock on key under two-phase locking. It must be
+// called before taking the database lock, since it may block for a while.
+// It returns false if the lock wait timed out or tx's context was done.
+func (db *Database) lockKey(tx *Transaction, key string) bool {
+	if db.locks == nil {
+		return true
+	}
+	start := db.clock.Now()
+	err := db.locks.AcquireContext(tx.Context(), tx.ID, key)
+	tx.lockWait += db.since(start)
+	if err == nil {
+		return true
+	}
+	if db.cancelled(tx) {
+		return false
+	}
+	db.stats.record(func(s *statShard) {
+		s.add(statLockTimeouts, 1)
+		if err == ErrDeadlock {
+			s.add(statDeadlocks, 1)
+		}
+	})
+	tx.conflict = true
+	tx.failure = fmt.Errorf("%w: waiting for the lock on %s", err, key)
+	return false
+}
+
+// releaseKeys releases all of tx's key locks and escrow reservations
+func (db *Database) releaseKeys(tx *Transaction) {
+	if db.locks != nil {
+		db.locks.ReleaseAll(tx.ID)
+	}
+	db.escrow.release(tx.ID)
+}
+
+// checkActive rejects operations on a transaction that is finished or
+// that the engine has aborted
+func (db *Database) checkActive(tx *Transaction, op string, key string) bool {
+	if tx.status != TxActive && !tx.Aborted {
+		tx.logOp("%s %s: TX_FINISHED", op, key)
+		tx.failure = fmt.Errorf("%w: %s is %s", ErrTxDone, op, tx.status)
+		return false
+	}
+	if tx.prepared && !tx.Aborted {
+		tx.logOp("%s %s: TX_PREPARED", op, key)
+		tx.failure = fmt.Errorf("%w: %s after prepare", ErrTxDone, op)
+		return false
+	}
+	if db.crashed.Load() && !tx.Aborted {
+		db.abortWithReason(tx, "database crashed")
+	}
+	if tx.ancestorAborted() && !tx.Aborted {
+		db.abortWithReason(tx, "parent aborted")
+	}
+	db.cancelled(tx)
+	if tx.Aborted {
+		tx.logOp("%s %s: TX_ABORTED", op, key)
+		return false
+	}
+	return true
+}
+
+// abortWithReason aborts tx on behalf of the engine
+func (db *Database) abortWithReason(tx *Transaction, reason string) {
+	if tx.status != TxActive {
+		return
+	}
+	tx.Aborted = true
+	tx.AbortReason = reason
+	db.Abort(tx)
+}
+
+// rLock acquires the database lock in shared mode, if there is one
+func (db *Database) rLock() {
+	if db.lock != nil {
+		db.lock.RLock()
+	}
+}
+
+// rUnlock releases a shared hold on the database lock
+func (db *Database) rUnlock() {
+	if db.lock != nil {
+		db.lock.RUnlock()
+	}
+}
+
+// wLock acquires the database lock in exclusive mode, if there is one
+func (db *Database) wLock() {
+	if db.lock != nil {
+		db.lock.Lock()
+	}
+}
+
+// wUnlock releases an exclusive hold on the database lock and wakes
+// WaitFor callers, since the operation may have changed a value
+func (db *Database) wUnlock() {
+	if db.lock != nil {
+		db.lock.Unlock()
+	}
+	db.notifyChange()
+}
+
+// BeginTransaction starts a new transaction at the engine's default
+// isolation level
+func (db *Database) BeginTransaction() *Transaction {
+	return db.BeginTransactionWithIsolation(db.DefaultIsolation())
+}
+
+// BeginTransactionWithIsolation starts a new transaction at the given
+// isolation level
+func (db *Database) BeginTransactionWithIsolation(level IsolationLevel) *Transaction {
+	return db.beginTransaction(nil, level, time.Time{})
+}
+
+// BeginTransactionWithDeadline starts a new transaction at the default
+// isolation level that should commit by deadline, on db's clock. The
+// deadline is not enforced; it orders admission under AdmitEDF, and a
+// commit after it counts towards Stats.DeadlinesMissed.
+func (db *Database) BeginTransactionWithDeadline(deadline time.Time) *Transaction {
+	return db.beginTransaction(nil, db.DefaultIsolation(), deadline)
+}
+
+// beginTransaction starts a new transaction
+// RACE CONDITION: txCounter is not protected on an unsynchronized database!
+func (db *Database) beginTransaction(ctx context.Context, level IsolationLevel, deadline time.Time) *Transaction {
+	tx := db.newTransaction()
+	tx.ops.limit = db.opLogLimit
+	tx.Isolation = min(level, db.MaxIsolation())
+	tx.Deadline = deadline
+	tx.ClientID = clientFrom(ctx)
+	tx.Priority = priorityFrom(ctx)
+	tx.ctx = ctx
+	tx.thread = threadFrom(ctx)
+	db.admit(tx)
+	tx.StartTime = db.clock.Now()
+
+	if db.lock != nil {
+		db.txMu.Lock()
+		defer db.txMu.Unlock()
+	}
+	db.txCounter++ // UNSAFE: Multiple goroutines can increment simultaneously
+	tx.ID = db.txCounter
+	db.track(tx)
+	if db.locks != nil && tx.Priority != 0 {
+		db.locks.SetPriority(tx.ID, tx.Priority)
+	}
+	if db.tracked(tx) {
+		db.ssiBegin(tx)
+	} else if db.mvcc != nil {
+		tx.SnapshotTS = db.mvcc.begin(tx.ID)
+	}
+	return tx
+}
+
+// read retrieves a value from the database
+// RACE CONDITION: Reading while another goroutine is writing
+func (db *Database) read(tx *Transaction, key string) (int, bool) {
+	if !db.checkActive(tx, "READ", key) {
+		return 0, false
+	}
+	if db.mvcc != nil {
+		return db.mvccRead(tx, key)
+	}
+	if db.tso != nil {
+		return db.tsoRead(tx, key)
+	}
+	release, locked := db.lockForRead(tx, key)
+	if !locked {
+		tx.logOp("READ %s: LOCK_TIMEOUT", key)
+		return 0, false
+	}
+	defer release()
+	db.rLockKey(key)
+	defer db.rUnlockKey(key)
+
+	db.countStat(statTotalReads, 1)
+	
+	if _, exists := db.visibleValue(tx, key); !exists {
+		tx.logOp("READ %s: NOT_FOUND", key)
+		return 0, false
+	}
+	
+	// Simulate some processing time to increase likelihood of race conditions
+	db.process(tx, OpRead)
+	
+	value, exists := db.visibleValue(tx, key) // UNSAFE: Value might change between check and read
+	if !exists {
+		// A TTL can run out between the check and the read, even under a lock
+		tx.logOp("READ %s: NOT_FOUND (expired)", key)
+		return 0, false
+	}
+	tx.logOp("READ %s: %d", key, value)
+	return value, true
+}
+
+// write creates or updates a record in the database
+// The write is buffered in the transaction until Commit applies it.
+// Writing over a tombstone left by a transaction that started after this
+// one is rejected, so a stale write cannot silently resurrect a deleted key.
+// It returns false when the write was rejected.
+// RACE CONDITION: Multiple writes to the same key can cause lost updates
+func (db *Database) write(tx *Transaction, key string, value int) bool {
+	if !db.checkActive(tx, "WRITE", key) {
+		return false
+	}
+	if db.mvcc != nil {
+		db.countStat(statTotalWrites, 1)
+		return db.mvccWrite(tx, key, value)
+	}
+	if db.tso != nil {
+		db.countStat(statTotalWrites, 1)
+		return db.tsoWrite(tx, key, value)
+	}
+	if !db.lockKey(tx, key) {
+		tx.logOp("WRITE %s: LOCK_TIMEOUT", key)
+		return false
+	}
+	if !db.wLockForInsert(tx, key) {
+		tx.logOp("WRITE %s: RANGE_LOCK_TIMEOUT", key)
+		return false
+	}
+	defer db.wUnlockKey(key)
+
+	db.countStat(statTotalWrites, 1)
+	return db.applyWrite(tx, key, value)
+}
+
+// applyWrite does the work of Write: it checks the write against the
+// current record and buffers it. The caller must hold the database lock.
+func (db *Database) applyWrite(tx *Transaction, key string, value int) bool {
+	if !db.validateWrite(tx, "WRITE", key, value) {
+		return false
+	}
+
+	existingRecord, exists := db.records.get(key)
+	_, buffered := tx.pending(key)
+	
+	// Simulate some processing time
+	db.process(tx, OpWrite)
+	
+	if buffered {
+		tx.logOp("WRITE %s: %d (pending, overwrites own write)", key, value)
+	} else if exists && existingRecord.Deleted {
+		if tx.ID < existingRecord.DeletedBy {
+			// The delete happened after this transaction began: our write is
+			// based on a view of the database that no longer exists
+			db.countStat(statResurrectionsBlocked, 1)
+			tx.logOp("WRITE %s: REJECTED (deleted by tx %d)", key, existingRecord.DeletedBy)
+			return false
+		}
+		tx.logOp("WRITE %s: %d (pending, recreates deleted key)", key, value)
+	} else if exists {
+		tx.logOp("WRITE %s: %d (pending)", key, value)
+	} else {
+		tx.logOp("WRITE %s: %d (pending, new)", key, value)
+	}
+	tx.bufferWrite(key, pendingWrite{Value: value, SetsPayload: true})
+	return true
+}
+
+// visibleValue returns key's value as tx sees it: its own buffered write
+// if it has one, otherwise the current record. The caller must hold the
+// database lock.
+func (db *Database) visibleValue(tx *Transaction, key string) (int, bool) {
+	pending, buffered := tx.pending(key)
+	if buffered && !pending.Relative {
+		tx.readFrom = readOwnWrite
+		return pending.Value, !pending.Deleted
+	}
+	record, exists := db.records.get(key)
+	tx.readFrom = 0
+	if exists {
+		tx.readFrom = record.WrittenBy
+	}
+	if !exists || !record.live(db.clock.Now()) {
+		return pending.Value, buffered
+	}
+	return record.Value + pending.Value, true
+}
+
+// SetUpsertOnUpdate makes Add (and Update) insert missing keys instead of
+// failing
+func (db *Database) SetUpsertOnUpdate(enabled bool) {
+	db.upsertOnUpdate = enabled
+}
+
+// update performs a read-modify-write operation, the shared path of Add
+// and Upsert. A missing key makes it fail unless upsert is set, in which
+// case it counts as holding initial.
+// RACE CONDITION: Classic lost update problem!
+func (db *Database) update(tx *Transaction, key string, delta int, upsert bool, initial int) bool {
+	if !db.checkActive(tx, "UPDATE", key) {
+		return false
+	}
+	if db.mvcc != nil {
+		db.countStat(statTotalUpdates, 1)
+		return db.mvccUpdate(tx, key, delta, upsert, initial)
+	}
+	if db.tso != nil {
+		db.countStat(statTotalUpdates, 1)
+		return db.tsoUpdate(tx, key, delta, upsert, initial)
+	}
+	if !db.lockKey(tx, key) {
+		tx.logOp("UPDATE %s: LOCK_TIMEOUT", key)
+		return false
+	}
+	if !upsert {
+		db.rLockKey(key)
+		defer db.rUnlockKey(key)
+	} else if !db.wLockForInsert(tx, key) {
+		tx.logOp("UPDATE %s: RANGE_LOCK_TIMEOUT", key)
+		return false
+	} else {
+		defer db.wUnlockKey(key)
+	}
+
+	db.countStat(statTotalUpdates, 1)
+	
+	// Read current value
+	if _, exists := db.visibleValue(tx, key); !exists {
+		if upsert {
+			db.countStat(statUpsertInserts, 1)
+			tx.logOp("UPDATE %s: NOT_FOUND, inserting", key)
+			return db.applyWrite(tx, key, initial+delta)
+		}
+		tx.logOp("UPDATE %s: NOT_FOUND", key)
+		return false
+	}
+	
+	// Simulate some processing time (makes race condition more likely)
+	db.process(tx, OpUpdate)
+	
+	// UNSAFE: Another goroutine might have modified the value!
+	currentValue, _ := db.visibleValue(tx, key)
+	newValue := currentValue + delta
+	if !db.validateWrite(tx, "UPDATE", key, newValue) {
+		return false
+	}
+	
+	tx.logOp("UPDATE %s: +%d = %d (pending)", key, delta, newValue)
+
+	// Buffer the increment rather than the value it produced, so that a
+	// commit on an engine without key locks adds it to whatever the value
+	// is by then instead of overwriting a concurrent update
+	write := pendingWrite{Value: delta, Relative: true}
+	if pending, buffered := tx.pending(key); buffered {
+		write = pending
+		if pending.Relative {
+			write.Value += delta
+		} else {
+			write.Value = newValue
+		}
+	}
+	tx.bufferWrite(key, write)
+	return true
+}
+
+// validateWrite runs the validators against a pending write and aborts tx
+// if one of them rejects it
+func (db *Database) validateWrite(tx *Transaction, op string, key string, value int) bool {
+	err := db.validate(key, value)
+	if err == nil {
+		return true
+	}
+	db.countStat(statValidationFailures, 1)
+	tx.logOp("%s %s: INVALID (%v)", op, key, err)
+	db.abortWithReason(tx, err.Error())
+	return false
+}
+
+// deleteKey removes a record from the database
+// The delete is buffered until Commit, which replaces the record by a
+// tombstone instead of removing it from the map, so later writes can tell
+// a deleted key from one that never existed.
+// RACE CONDITION: Concurrent deletes or delete during read
+func (db *Database) deleteKey(tx *Transaction, key string) bool {
+	if !db.checkActive(tx, "DELETE", key) {
+		return false
+	}
+	if db.mvcc != nil {
+		return db.mvccDelete(tx, key)
+	}
+	if db.tso != nil {
+		return db.tsoDelete(tx, key)
+	}
+	if !db.lockKey(tx, key) {
+		tx.logOp("DELETE %s: LOCK_TIMEOUT", key)
+		return false
+	}
+	db.rLockKey(key)
+	defer db.rUnlockKey(key)
+
+	if _, exists := db.visibleValue(tx, key); !exists {
+		tx.logOp("DELETE %s: NOT_FOUND", key)
+		return false
+	}
+	
+	// Simulate some processing time
+	db.process(tx, OpDelete)
+	
+	// UNSAFE: Another goroutine might delete or modify this key before we commit
+	tx.logOp("DELETE %s: SUCCESS (pending)", key)
+	tx.bufferWrite(key, pendingWrite{Deleted: true})
+	return true
+}
+
+// Commit finalizes a transaction and releases its key locks
+// This is when the buffered writes become visible, all at once; an MVCC
+// transaction may be aborted instead if it lost a write-write conflict.
+// The committed writes are published to the commit hook while the key
+// locks (or the engine's commit mutex) are still held, so the stream
+// orders writes to the same key correctly. It returns nil if the
+// transaction committed, and why it was aborted otherwise.
+func (db *Database) Commit(tx *Transaction) error {
+	finished, topLevel := tx.status != TxActive, tx.parent == nil
+	err := db.commit(tx)
+	if !finished {
+		db.recycle(tx)
+	}
+	if topLevel && db.lru.over() {
+		db.evict()
+	}
+	return err
+}
+
+// commit is Commit, short of returning tx to the pool
+func (db *Database) commit(tx *Transaction) error {
+	db.yield(tx, "COMMIT", "")
+	defer db.observeLatency(OpCommit, db.clock.Now())
+	if tx.status != TxActive {
+		if tx.Aborted {
+			return txError(tx)
+		}
+		tx.logOp("COMMIT: TX_FINISHED")
+		return fmt.Errorf("%w: commit of a %s transaction", ErrTxDone, tx.status)
+	}
+	if tx.parent != nil {
+		db.commitNested(tx)
+		return txError(tx)
+	}
+	if db.crashed.Load() && !tx.Aborted {
+		db.abortWithReason(tx, "database crashed")
+	}
+	if !tx.prepared {
+		// A prepared transaction has promised to commit
+		db.cancelled(tx)
+	}
+	if tx.status != TxActive {
+		// Aborted just now, which finished it
+		return txError(tx)
+	}
+	if !tx.Aborted {
+		db.storage.beginCommit()
+		if db.mvcc != nil {
+			db.mvccCommit(tx)
+		} else if db.tso != nil {
+			db.tsoCommit(tx)
+		} else if db.installWrites(tx) {
+			db.publishCommit(tx)
+		}
+		db.storage.endCommit()
+	}
+	if db.mvcc != nil {
+		db.mvccReleasePrepared(tx)
+	}
+	if !tx.Aborted && len(tx.writeOrder) > 0 && db.crashed.Load() {
+		// The commit went out but the client never hears about it
+		tx.Aborted = true
+		tx.AbortReason = "database crashed before acknowledging commit (outcome unknown)"
+	}
+	duration := db.since(tx.StartTime)
+	if tx.Aborted {
+		tx.logOp("ABORT %s (duration: %v)", tx.AbortReason, duration)
+	} else {
+		tx.logOp("COMMIT (duration: %v)", duration)
+		if !tx.Deadline.IsZero() && db.clock.Now().After(tx.Deadline) {
+			db.countStat(statDeadlinesMissed, 1)
+		}
+	}
+	if db.tracked(tx) {
+		db.ssiFinish(tx)
+	}
+	if db.mvcc != nil {
+		db.mvcc.finish(tx.ID)
+	}
+	db.releaseKeys(tx)
+	db.leave(tx)
+	if tx.Aborted {
+		db.finish(tx, TxAborted)
+	} else {
+		db.finish(tx, TxCommitted)
+	}
+	return txError(tx)
+}
+
+// Prepare is the first phase of a two-phase commit. It checks that tx can
+// commit, as Commit would, and if so promises that Commit will succeed:
+// under MVCC it validates tx and holds the commit locks until Commit or
+// Abort, and every other engine already keeps conflicting transactions
+// out with key locks or pending marks. Only a crash can still abort it. If
+// the check fails, tx is aborted and the error returned as by Commit. A
+// prepared transaction must not run further operations.
+func (db *Database) Prepare(tx *Transaction) error {
+	if tx.status != TxActive || tx.Aborted {
+		return db.Commit(tx)
+	}
+	if tx.parent != nil {
+		return fmt.Errorf("prepare of nested transaction %d", tx.ID)
+	}
+	if tx.prepared {
+		return nil
+	}
+	if db.crashed.Load() {
+		db.abortWithReason(tx, "database crashed")
+	}
+	db.cancelled(tx)
+	if !tx.Aborted && db.mvcc != nil {
+		db.mvccPrepare(tx)
+	}
+	if tx.Aborted {
+		// Finishes the aborted transaction
+		return db.Commit(tx)
+	}
+	tx.prepared = true
+	tx.logOp("PREPARE")
+	return nil
+}
+
+// Abort cancels a transaction, discards its buffered writes and releases
+// its key locks. Nothing it wrote was ever applied, so it leaves no trace.
+// Aborting a finished transaction does nothing.
+func (db *Database) Abort(tx *Transaction) {
+	if tx.status != TxActive {
+		return
+	}
+	if tx.parent != nil {
+		db.abortNested(tx)
+		return
+	}
+	defer db.recycle(tx)
+	duration := db.since(tx.StartTime)
+	tx.logOp("ABORT (duration: %v)", duration)
+	if db.tso != nil {
+		db.tsoAbort(tx)
+	}
+	if db.mvcc != nil {
+		db.mvccReleasePrepared(tx)
+	}
+	tx.writes = nil
+	tx.writeOrder = nil
+	if db.tracked(tx) {
+		db.ssiFinish(tx)
+	}
+	if db.mvcc != nil {
+		db.mvcc.finish(tx.ID)
+	}
+	db.releaseKeys(tx)
+	db.leave(tx)
+	db.finish(tx, TxAborted)
+}
+
+// installWrites applies tx's buffered writes to the records. Under MVCC
+// the records are the latest-committed view used by whole-database
+// operations; everywhere else they are the data itself. It returns false,
+// having aborted tx and installed nothing, if a validator rejects the
+// value an increment would install.
+// RACE CONDITION: Without a lock, concurrent commits interleave
+func (db *Database) installWrites(tx *Transaction) bool {
+	unlock := db.wLockKeys(tx.writeOrder)
+	now := db.clock.Now()
+	if !db.validateIncrements(tx, now) {
+		unlock()
+		return false
+	}
+	for _, key := range tx.writeOrder {
+		pending := tx.writes[key]
+		record, exists := db.records.get(key)
+		install := JournalEntry{Op: JournalInstall, Key: key}
+		change := ChangeEvent{Key: key, TxID: tx.ID}
+		if exists && record.live(now) {
+			change.OldValue, change.Existed = record.Value, true
+		}
+		if pending.Relative {
+			install.Relative, install.Delta = true, pending.Value
+			if exists && record.live(now) {
+				pending.Value += record.Value
+			}
+			// The commit stream carries the value the increment produced
+			pending.Relative = false
+			tx.writes[key] = pending
+		}
+		if !exists {
+			record = &Record{Key: key}
+			db.records.set(key, record)
+		}
+		if !change.Existed && !pending.Deleted {
+			record.CreatedBy = tx.ID
+		}
+		record.Value = pending.Value
+		record.Version++
+		record.UpdatedAt = now
+		record.Deleted = pending.Deleted
+		record.ExpiresAt = pending.ExpiresAt
+		record.DeletedBy = 0
+		record.WrittenBy = tx.ID
+		if pending.Deleted {
+			record.DeletedBy = tx.ID
+			db.setPayload(record, nil)
+		} else if pending.SetsPayload {
+			// Copied under the stripe lock, so large values hold it longer
+			db.setPayload(record, bytes.Clone(pending.Payload))
+		} else if record.Payload != nil {
+			// The commit stream carries the payload the update kept
+			pending.SetsPayload, pending.Payload = true, record.Payload
+			tx.writes[key] = pending
+		}
+		if db.journal != nil {
+			install.Value, install.Deleted = pending.Value, pending.Deleted
+			db.journalOp(tx, install)
+		}
+		change.Deleted, change.Version = pending.Deleted, record.Version
+		if !pending.Deleted {
+			change.NewValue = pending.Value
+		}
+		db.lru.written(key, record)
+		db.notifyWatchers(change)
+		db.recordChange(record, Modification{TxID: tx.ID, Version: record.Version, OldValue: change.OldValue,
+			Value: change.NewValue, Deleted: change.Deleted, At: now})
+	}
+	db.updateIndexes(tx.writeOrder)
+	db.publishView(tx.writeOrder)
+	db.checkInvariants(tx)
+	unlock()
+	return true
+}
+
+// VerifyIntegrity checks for data corruption
+// This helps demonstrate that race conditions occurred
+// Every key is checked in the same snapshot view, without blocking commits
+func (db *Database) VerifyIntegrity(expectedValues map[string]int) (bool, []string) {
+	view := db.Snapshot()
+
+	errors := make([]string, 0)
+	
+	for key, expectedValue := range expectedValues {
+		record, exists := view.Record(key)
+		if !exists {
+			errors = append(errors, fmt.Sprintf("Key %s missing (expected %d)", key, expectedValue))
+			continue
+		}
+		
+		if record.Value != expectedValue {
+			errors = append(errors, fmt.Sprintf("Key %s has value %d (expected %d)", key, record.Value, expectedValue))
+			db.countStat(statDataCorruption, 1)
+		}
+	}
+	
+	return len(errors) == 0, errors
+}
+
+// PrintStats displays database statistics
+func (db *Database) PrintStats() {
+	stats := db.Stats()
+	fmt.Println("\n=== Database Statistics ===")
+	fmt.Printf("Total Reads:     %d\n", stats.TotalReads)
+	fmt.Printf("Total Writes:    %d\n", stats.TotalWrites)
+	fmt.Printf("Total Updates:   %d\n", stats.TotalUpdates)
+	fmt.Printf("Lost Updates:    %d\n", stats.LostUpdates)
+	fmt.Printf("Data Corruption: %d\n", stats.DataCorruption)
+	fmt.Printf("Blocked Resurrections: %d\n", stats.ResurrectionsBlocked)
+	fmt.Printf("Tombstones Collected:  %d\n", stats.TombstonesCollected)
+	fmt.Printf("Upsert Inserts:  %d\n", stats.UpsertInserts)
+	fmt.Printf("Lock Timeouts:   %d\n", stats.LockTimeouts)
+	if stats.Deadlocks > 0 {
+		fmt.Printf("Deadlocks:       %d\n", stats.Deadlocks)
+	}
+	fmt.Printf("Validation Failures: %d\n", stats.ValidationFailures)
+	fmt.Printf("Write Conflicts: %d\n", stats.WriteConflicts)
+	fmt.Printf("Serialization Failures: %d\n", stats.SerializationFailures)
+	fmt.Printf("Timestamp Restarts: %d\n", stats.TimestampRestarts)
+	if stats.TransactionRetries > 0 {
+		fmt.Printf("Transaction Retries: %d\n", stats.TransactionRetries)
+		fmt.Printf("Backoff Wait:    %v\n", stats.BackoffWait)
+	}
+	if stats.PayloadBytes > 0 {
+		fmt.Printf("Payload Bytes:   %d\n", stats.PayloadBytes)
+	}
+	if stats.KeysEvicted > 0 {
+		fmt.Printf("Keys Evicted:    %d\n", stats.KeysEvicted)
+	}
+	if stats.Pins > 0 {
+		fmt.Printf("Pins:            %d on %d keys\n", stats.Pins, stats.PinnedKeys)
+	}
+	if stats.KeysExpired > 0 {
+		fmt.Printf("Keys Expired:    %d\n", stats.KeysExpired)
+	}
+	if stats.Checkpoints > 0 {
+		fmt.Printf("Checkpoints:     %d\n", stats.Checkpoints)
+	}
+	if stats.VacuumRuns > 0 {
+		fmt.Printf("Versions Reclaimed: %d (%d vacuum runs)\n", stats.VersionsReclaimed, stats.VacuumRuns)
+	}
+	if stats.AdmissionQueued > 0 {
+		fmt.Printf("Admission Queued: %d (avg wait %v)\n", stats.AdmissionQueued, stats.AdmissionWait/time.Duration(stats.AdmissionQueued))
+	}
+	if stats.DeadlinesMissed > 0 {
+		fmt.Printf("Deadlines Missed: %d\n", stats.DeadlinesMissed)
+	}
+	fmt.Printf("Transactions:    %d committed, %d aborted (%d conflicts)\n", stats.Commits, stats.Aborts, stats.Conflicts)
+	for kind := OpKind(0); kind < NumOpKinds; kind++ {
+		if h, ok := stats.Latency[kind.String()]; ok {
+			fmt.Printf("Latency %-7s  n=%d mean=%v p50=%v p99=%v max=%v\n", kind.String()+":", h.Count, h.Mean(), h.P50, h.P99, h.Max)
+		}
+	}
+	fmt.Println("===========================")
+}
+
+// GetRecordCount returns the number of live records in the latest
+// snapshot view
+func (db *Database) GetRecordCount() int {
+	return db.Snapshot().Len()
+}
+
+// PrintRecords displays all live records in key order (for debugging).
+// It prints a snapshot view, so it neither blocks nor races with commits.
+func (db *Database) PrintRecords() {
+	view := db.Snapshot()
+
+	fmt.Println("\n=== Database Records ===")
+	for _, key := range view.Keys() {
+		record, _ := view.Record(key)
+		fmt.Printf("%s: value=%d, version=%d, updated=%v\n", 
+			key, record.Value, record.Version, record.UpdatedAt.Format("15:04:05.000"))
+	}
+	fmt.Println("========================")
+}
+
+// SetTombstoneGracePeriod sets how long tombstones are kept before
+// CollectTombstones is allowed to remove them
+func (db *Database) SetTombstoneGracePeriod(grace time.Duration) {
+	db.tombstoneGrace = grace
+}
+
+// CollectTombstones garbage-collects tombstones older than the grace period
+// and returns how many were removed, keeping those of pinned keys (see
+// Pin). A transaction that started before the
+// delete and writes after its tombstone was collected can still recreate
+// the key, so the grace period must outlive the longest transaction.
+// RACE CONDITION: Deleting from the map while other goroutines access it
+func (db *Database) CollectTombstones() int {
+	db.wLock()
+	defer db.wUnlock()
+
+	collected := make([]string, 0)
+	cutoff := db.clock.Now().Add(-db.tombstoneGrace)
+	db.records.each(func(key string, record *Record) { // UNSAFE: Concurrent map iteration
+		if record.Deleted && record.UpdatedAt.Before(cutoff) && db.Pins(key) == 0 {
+			db.records.remove(key)
+			collected = append(collected, key)
+		}
+	})
+	db.publishView(collected)
+	db.countStat(statTombstonesCollected, len(collected))
+	return len(collected)
+}
@@ -0,0 +1,784 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// CORRECTNESS TESTS
+// These tests verify that the database maintains data integrity under
+// concurrent access. With proper synchronization, all tests should pass.
+// They run on the two-phase locking engine; on the unsynchronized version
+// NewDatabase returns, they will likely fail or show race conditions when
+// run with: go test -race
+// ============================================================================
+
+// TestCounterIncrement tests the counter increment scenario
+// This is the classic "lost update" problem
+func TestCounterIncrement(t *testing.T) {
+	db := simulated(NewTwoPhaseLockingDatabase()) // Locks still contend; the sleeps just cost nothing
+
+	// Initialize counter
+	tx := db.BeginTransaction()
+	db.Write(tx, "counter", 0)
+	db.Commit(tx)
+
+	numClients := 10
+	incrementsPerClient := 100
+	expectedFinal := numClients * incrementsPerClient
+
+	var wg sync.WaitGroup
+
+	// Each client increments the counter
+	for i := 0; i < numClients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < incrementsPerClient; j++ {
+				tx := db.BeginTransaction()
+				db.Update(tx, "counter", 1)
+				db.Commit(tx)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// Verify final value
+	tx = db.BeginTransaction()
+	finalValue, exists := db.Read(tx, "counter")
+	db.Commit(tx)
+
+	if !exists {
+		t.Fatalf("counter key not found")
+	}
+
+	if finalValue != expectedFinal {
+		t.Errorf("expected counter=%d, got %d (lost %d updates)",
+			expectedFinal, finalValue, expectedFinal-finalValue)
+	}
+}
+
+// TestBankTransfer tests the bank transfer scenario
+// This verifies that the total balance is preserved across transfers
+func TestBankTransfer(t *testing.T) {
+	db := simulated(NewTwoPhaseLockingDatabase())
+
+	// Initialize accounts
+	tx := db.BeginTransaction()
+	db.Write(tx, "account_A", 1000)
+	db.Write(tx, "account_B", 1000)
+	db.Commit(tx)
+
+	initialTotal := 2000
+	numClients := 5
+	transfersPerClient := 50
+
+	var wg sync.WaitGroup
+
+	// Each client transfers money
+	for i := 0; i < numClients; i++ {
+		wg.Add(1)
+		go func(clientID int) {
+			defer wg.Done()
+
+			for j := 0; j < transfersPerClient; j++ {
+				amount := 10 // Fixed amount for deterministic testing
+
+				tx := db.BeginTransaction()
+
+				// Read both accounts
+				balanceA, _ := db.Read(tx, "account_A")
+				balanceB, _ := db.Read(tx, "account_B")
+
+				// Transfer from A to B
+				db.Write(tx, "account_A", balanceA-amount)
+				db.Write(tx, "account_B", balanceB+amount)
+
+				db.Commit(tx)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	// Verify total is preserved
+	tx = db.BeginTransaction()
+	finalA, _ := db.Read(tx, "account_A")
+	finalB, _ := db.Read(tx, "account_B")
+	db.Commit(tx)
+
+	finalTotal := finalA + finalB
+
+	if finalTotal != initialTotal {
+		t.Errorf("total not preserved! expected=%d, got=%d (lost %d)",
+			initialTotal, finalTotal, initialTotal-finalTotal)
+	}
+}
+
+// TestConcurrentReadWrite tests concurrent reads and writes
+// This verifies isolation - readers should not see partial updates
+func TestConcurrentReadWrite(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+
+	// Initialize data - both values should always be equal
+	tx := db.BeginTransaction()
+	db.Write(tx, "data_1", 100)
+	db.Write(tx, "data_2", 100)
+	db.Commit(tx)
+
+	stopChan := make(chan bool)
+	var wg sync.WaitGroup
+
+	inconsistentReads := 0
+	var inconsistentMutex sync.Mutex
+
+	numReaders := 5
+	numWriters := 3
+
+	// Start readers
+	for i := 0; i < numReaders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stopChan:
+					return
+				default:
+					tx := db.BeginTransaction()
+					val1, _ := db.Read(tx, "data_1")
+					val2, _ := db.Read(tx, "data_2")
+
+					if val1 != val2 {
+						inconsistentMutex.Lock()
+						inconsistentReads++
+						inconsistentMutex.Unlock()
+					}
+
+					db.Commit(tx)
+					time.Sleep(time.Microsecond * 100)
+				}
+			}
+		}()
+	}
+
+	// Start writers
+	for i := 0; i < numWriters; i++ {
+		wg.Add(1)
+		go func(writerID int) {
+			defer wg.Done()
+			value := 100
+
+			for {
+				select {
+				case <-stopChan:
+					return
+				default:
+					tx := db.BeginTransaction()
+					value++
+
+					// Write same value to both
+					db.Write(tx, "data_1", value)
+					db.Write(tx, "data_2", value)
+
+					db.Commit(tx)
+					time.Sleep(time.Microsecond * 100)
+				}
+			}
+		}(i)
+	}
+
+	// Run for a short duration
+	time.Sleep(100 * time.Millisecond)
+	close(stopChan)
+	wg.Wait()
+
+	// With proper synchronization, there should be no inconsistent reads
+	if inconsistentReads > 0 {
+		t.Errorf("detected %d inconsistent reads (synchronization may be insufficient)",
+			inconsistentReads)
+	}
+}
+
+// TestBasicOperations tests basic CRUD operations
+func TestBasicOperations(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+
+	// Test Write
+	tx := db.BeginTransaction()
+	db.Write(tx, "key1", 42)
+	db.Commit(tx)
+
+	// Test Read
+	tx = db.BeginTransaction()
+	value, exists := db.Read(tx, "key1")
+	db.Commit(tx)
+
+	if !exists {
+		t.Fatalf("key1 should exist")
+	}
+	if value != 42 {
+		t.Errorf("expected value=42, got %d", value)
+	}
+
+	// Test Update
+	tx = db.BeginTransaction()
+	success := db.Update(tx, "key1", 8)
+	db.Commit(tx)
+
+	if !success {
+		t.Fatalf("update should succeed")
+	}
+
+	tx = db.BeginTransaction()
+	value, _ = db.Read(tx, "key1")
+	db.Commit(tx)
+
+	if value != 50 {
+		t.Errorf("expected value=50 after update, got %d", value)
+	}
+
+	// Test Delete
+	tx = db.BeginTransaction()
+	success = db.Delete(tx, "key1")
+	db.Commit(tx)
+
+	if !success {
+		t.Fatalf("delete should succeed")
+	}
+
+	tx = db.BeginTransaction()
+	_, exists = db.Read(tx, "key1")
+	db.Commit(tx)
+
+	if exists {
+		t.Errorf("key1 should not exist after delete")
+	}
+}
+
+// TestDeleteBlocksStaleWrite tests the "deleted key silently resurrected by a
+// stale write" bug: a transaction that began before a delete must not be able
+// to bring the key back
+func TestDeleteBlocksStaleWrite(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+
+	tx := db.BeginTransaction()
+	db.Write(tx, "session", 1)
+	db.Commit(tx)
+
+	// stale starts first, then another transaction deletes the key
+	stale := db.BeginTransaction()
+	deleter := db.BeginTransaction()
+	if !db.Delete(deleter, "session") {
+		t.Fatalf("delete should succeed")
+	}
+	db.Commit(deleter)
+
+	if db.Write(stale, "session", 2) {
+		t.Errorf("stale write should be rejected")
+	}
+	db.Abort(stale)
+
+	tx = db.BeginTransaction()
+	_, exists := db.Read(tx, "session")
+	db.Commit(tx)
+
+	if exists {
+		t.Errorf("session was resurrected by a stale write")
+	}
+	if got := db.Stats().ResurrectionsBlocked; got != 1 {
+		t.Errorf("expected 1 blocked resurrection, got %d", got)
+	}
+}
+
+// TestWriteAfterDeleteRecreates tests that a transaction started after the
+// delete may legitimately recreate the key, continuing its version history
+func TestWriteAfterDeleteRecreates(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+
+	tx := db.BeginTransaction()
+	db.Write(tx, "key1", 1)
+	db.Commit(tx)
+
+	tx = db.BeginTransaction()
+	db.Delete(tx, "key1")
+	db.Commit(tx)
+
+	tx = db.BeginTransaction()
+	if !db.Write(tx, "key1", 7) {
+		t.Fatalf("write after delete should succeed")
+	}
+	value, exists := db.Read(tx, "key1")
+	db.Commit(tx)
+
+	if !exists || value != 7 {
+		t.Errorf("expected key1=7, got %d (exists=%v)", value, exists)
+	}
+	if record, _ := db.records.get("key1"); record.Version != 3 {
+		t.Errorf("expected version 3 after write/delete/write, got %d", record.Version)
+	}
+}
+
+// TestCollectTombstones tests that tombstones are only garbage-collected
+// after the grace period
+func TestCollectTombstones(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetTombstoneGracePeriod(20 * time.Millisecond)
+
+	tx := db.BeginTransaction()
+	db.Write(tx, "key1", 1)
+	db.Write(tx, "key2", 2)
+	db.Delete(tx, "key1")
+	db.Commit(tx)
+
+	if n := db.CollectTombstones(); n != 0 {
+		t.Errorf("tombstone collected before grace period expired (%d)", n)
+	}
+	if count := db.GetRecordCount(); count != 1 {
+		t.Errorf("expected 1 live record, got %d", count)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if n := db.CollectTombstones(); n != 1 {
+		t.Errorf("expected 1 tombstone collected, got %d", n)
+	}
+	if _, exists := db.records.get("key1"); exists {
+		t.Errorf("key1 tombstone should be gone after collection")
+	}
+}
+
+// TestUpdateOrInsert tests the upsert fallback of Update
+func TestUpdateOrInsert(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+
+	tx := db.BeginTransaction()
+	if db.Update(tx, "hits", 1) {
+		t.Errorf("update of a missing key should fail by default")
+	}
+	if !db.UpdateOrInsert(tx, "hits", 1, 10) {
+		t.Fatalf("upsert of a missing key should succeed")
+	}
+	if !db.UpdateOrInsert(tx, "hits", 1, 10) {
+		t.Fatalf("upsert of an existing key should succeed")
+	}
+	db.Delete(tx, "hits")
+	db.SetUpsertOnUpdate(true)
+	if !db.Update(tx, "hits", 5) {
+		t.Fatalf("update of a deleted key should insert with upsert-on-update")
+	}
+	value, _ := db.Read(tx, "hits")
+	db.Commit(tx)
+
+	if value != 5 {
+		t.Errorf("expected hits=5, got %d", value)
+	}
+	if got := db.Stats().UpsertInserts; got != 2 {
+		t.Errorf("expected 2 upsert inserts, got %d", got)
+	}
+}
+
+// TestValidatorAbortsTransaction tests that a write rejected by a validator
+// aborts the transaction and leaves the value untouched
+func TestValidatorAbortsTransaction(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.AddValidator(KeyPattern(`^[a-z_0-9]+$`))
+	db.AddValidator(ForKeys(`^stock_`, NonNegative()))
+
+	tx := db.BeginTransaction()
+	db.Write(tx, "stock_apples", 1)
+	db.Commit(tx)
+
+	tx = db.BeginTransaction()
+	if db.Update(tx, "stock_apples", -2) {
+		t.Errorf("update below zero should be rejected")
+	}
+	if !tx.Aborted {
+		t.Fatalf("violating transaction should be aborted")
+	}
+	if db.Write(tx, "stock_pears", 5) {
+		t.Errorf("operations on an aborted transaction should fail")
+	}
+
+	tx = db.BeginTransaction()
+	if db.Write(tx, "Bad Key", 1) {
+		t.Errorf("write to a malformed key should be rejected")
+	}
+
+	tx = db.BeginTransaction()
+	value, _ := db.Read(tx, "stock_apples")
+	db.Commit(tx)
+
+	if value != 1 {
+		t.Errorf("expected stock_apples=1, got %d", value)
+	}
+	if got := db.Stats().ValidationFailures; got != 2 {
+		t.Errorf("expected 2 validation failures, got %d", got)
+	}
+}
+
+// TestValidatorCheckedAtCommit tests that a commit on an engine without
+// key locks rejects an increment a concurrent commit has made invalid
+// since the validator saw it, rather than adding it to the new value
+func TestValidatorCheckedAtCommit(t *testing.T) {
+	for _, db := range []*Database{NewUnsynchronizedDatabase(), NewSynchronizedDatabase(Fair)} {
+		db.AddValidator(NonNegative())
+		tx := db.BeginTransaction()
+		db.Write(tx, "stock", 1)
+		db.Commit(tx)
+
+		first, second := db.BeginTransaction(), db.BeginTransaction()
+		okA := db.Update(first, "stock", -1)
+		okB := db.Update(second, "stock", -1)
+		if !okA || !okB {
+			t.Fatalf("%s: both updates should pass the validator against stock 1", db.EngineName())
+		}
+		db.Commit(first)
+		err := db.Commit(second)
+
+		tx = db.BeginTransaction()
+		stock, _ := db.Read(tx, "stock")
+		db.Commit(tx)
+		if !errors.Is(err, ErrTxAborted) || stock != 0 {
+			t.Errorf("%s: second commit %v, stock %d; want ErrTxAborted and 0", db.EngineName(), err, stock)
+		}
+	}
+}
+
+// TestKeyBoundsRejectWrites tests that writes outside the bounds
+// validators put on a key abort their transactions, and other keys are
+// not constrained
+func TestKeyBoundsRejectWrites(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.AddValidator(ForKey("seats", ValueRange(0, 10)))
+	db.AddValidator(ForKey("debt", AtMost(0)))
+	for _, write := range []struct {
+		key   string
+		value int
+		ok    bool
+	}{{"seats", 10, true}, {"seats", 11, false}, {"seats", -1, false}, {"debt", -5, true}, {"debt", 1, false}, {"other", -5, true}} {
+		tx := db.BeginTransaction()
+		db.Put(tx, write.key, write.value)
+		if err := db.Commit(tx); (err == nil) != write.ok {
+			t.Errorf("Writing %s = %d: %v, want success %v", write.key, write.value, err, write.ok)
+		}
+	}
+
+	tx := db.BeginTransaction()
+	if err := db.Add(tx, "seats", 1); !errors.Is(err, ErrTxAborted) {
+		t.Errorf("Adding a seat past the maximum: %v, want ErrTxAborted", err)
+	}
+	if failures := db.Stats().ValidationFailures; failures != 4 {
+		t.Errorf("ValidationFailures = %d, want 4", failures)
+	}
+}
+
+// TestValidatorConcurrentDecrements races more decrements than stock on
+// each engine, against a validator for every key and one for the stock
+// alone, and checks exactly the stock is taken
+func TestValidatorConcurrentDecrements(t *testing.T) {
+	validators := []struct {
+		name      string
+		validator Validator
+	}{
+		{"NonNegative", NonNegative()},
+		{"ForKey", ForKey("stock", AtLeast(0))},
+	}
+	for _, v := range validators {
+		for _, engine := range []string{"synchronized", "2pl", "mvcc", "tso"} {
+			t.Run(v.name+"/"+engine, func(t *testing.T) {
+				db, _ := OpenDatabase(engine)
+				db.SetProcessingDelays(NoProcessingDelays)
+				db.AddValidator(v.validator)
+				db.BatchWrite(map[string]int{"stock": 20})
+
+				var taken atomic.Int64
+				var wg sync.WaitGroup
+				for g := 0; g < 8; g++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for i := 0; i < 5; i++ {
+							err := db.RunTransaction(func(tx *Transaction) error {
+								return db.Add(tx, "stock", -1)
+							})
+							if err == nil {
+								taken.Add(1)
+							}
+						}
+					}()
+				}
+				wg.Wait()
+
+				tx := db.BeginTransaction()
+				stock, _ := db.Get(tx, "stock")
+				db.Commit(tx)
+				if stock != 0 || taken.Load() != 20 {
+					t.Errorf("%d taken, %d left, want the 20 taken and none left", taken.Load(), stock)
+				}
+			})
+		}
+	}
+}
+
+// TestAbortLeavesNoTrace tests that on every engine an aborted
+// transaction's writes, inserts and deletes are never applied or published
+func TestAbortLeavesNoTrace(t *testing.T) {
+	engines := map[string]func() *Database{
+		"synchronized":       func() *Database { return NewSynchronizedDatabase(Fair) },
+		"two-phase-locking":  NewTwoPhaseLockingDatabase,
+		"mvcc":               NewMVCCDatabase,
+		"timestamp-ordering": NewTimestampOrderingDatabase,
+	}
+	for name, newDB := range engines {
+		t.Run(name, func(t *testing.T) {
+			db := newDB()
+			setup := db.BeginTransaction()
+			db.Write(setup, "kept", 1)
+			db.Write(setup, "deleted", 1)
+			db.Commit(setup)
+			before := db.TakeSnapshot()
+
+			published := 0
+			db.SetCommitHook(func(CommitRecord) { published++ })
+
+			tx := db.BeginTransaction()
+			db.Write(tx, "kept", 2)
+			db.Update(tx, "kept", 10)
+			db.Write(tx, "inserted", 3)
+			db.Delete(tx, "deleted")
+			if value, _ := db.Read(tx, "kept"); value != 12 {
+				t.Errorf("Transaction does not see its own writes: kept=%d, want 12", value)
+			}
+			db.Abort(tx)
+
+			after := db.TakeSnapshot()
+			if diffs := DiffSnapshots(before, after); len(diffs) != 0 {
+				t.Errorf("Aborted transaction changed the data: %+v", diffs)
+			}
+			for key, entry := range before.Entries {
+				if after.Entries[key].Version != entry.Version {
+					t.Errorf("%s version changed from v%d to v%d", key, entry.Version, after.Entries[key].Version)
+				}
+			}
+			if _, exists := after.Entries["inserted"]; exists {
+				t.Error("Aborted insert left a record behind")
+			}
+			if published != 0 {
+				t.Errorf("Aborted transaction published %d commits", published)
+			}
+		})
+	}
+}
+
+// TestWritesInvisibleUntilCommit tests that a buffered write is not seen by
+// a reader that takes no locks until the writer commits
+func TestWritesInvisibleUntilCommit(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	setup := db.BeginTransaction()
+	db.Write(setup, "x", 1)
+	db.Commit(setup)
+
+	writer := db.BeginTransaction()
+	db.Write(writer, "x", 2)
+	db.Update(writer, "x", 3)
+
+	read := func() int {
+		reader := db.BeginTransactionWithIsolation(ReadUncommitted)
+		value, _ := db.Read(reader, "x")
+		db.Commit(reader)
+		return value
+	}
+	if value := read(); value != 1 {
+		t.Errorf("Uncommitted write visible: x=%d, want 1", value)
+	}
+	db.Commit(writer)
+	if value := read(); value != 5 {
+		t.Errorf("Committed write not visible: x=%d, want 5", value)
+	}
+}
+
+// TestStressTest runs a high-concurrency stress test
+func TestStressTest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping stress test in short mode")
+	}
+
+	db := NewTwoPhaseLockingDatabase()
+	db.AddValidator(ForKeys(`^counter_`, NonNegative()))
+
+	// Initialize multiple counters
+	for i := 0; i < 10; i++ {
+		tx := db.BeginTransaction()
+		db.Write(tx, fmt.Sprintf("counter_%d", i), 0)
+		db.Commit(tx)
+	}
+
+	numClients := 20
+	opsPerClient := 100
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < numClients; i++ {
+		wg.Add(1)
+		go func(clientID int) {
+			defer wg.Done()
+
+			for j := 0; j < opsPerClient; j++ {
+				key := fmt.Sprintf("counter_%d", j%10)
+
+				tx := db.BeginTransaction()
+				db.Update(tx, key, 1)
+				db.Commit(tx)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	// Verify all counters
+	expectedPerCounter := (numClients * opsPerClient) / 10
+
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("counter_%d", i)
+		tx := db.BeginTransaction()
+		value, exists := db.Read(tx, key)
+		db.Commit(tx)
+
+		if !exists {
+			t.Errorf("%s should exist", key)
+			continue
+		}
+
+		if value != expectedPerCounter {
+			t.Errorf("%s expected=%d, got=%d",
+				key, expectedPerCounter, value)
+		}
+	}
+
+	if failures := db.Stats().ValidationFailures; failures != 0 {
+		t.Errorf("counters went negative %d times", failures)
+	}
+}
+
+// ============================================================================
+// BENCHMARK TESTS
+// These benchmarks measure performance of the database operations.
+// Run with: go test -bench=. -benchmem
+// ============================================================================
+
+// numberedKeys returns n keys, key_0 onwards
+func numberedKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "key_" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+// benchmarkKeys maps n numbered keys to their numbers
+func benchmarkKeys(n int) map[string]int {
+	values := make(map[string]int, n)
+	for i, key := range numberedKeys(n) {
+		values[key] = i
+	}
+	return values
+}
+
+// benchmarkEngines runs benchmark on a new database of every registered
+// engine, as a sub-benchmark named after it. The databases have no
+// processing delays, keep no operation logs and reuse their transactions,
+// so what is measured is the engines' own overhead.
+// The unsynchronized engine is left out: its maps are not safe for
+// parallel use.
+func benchmarkEngines(b *testing.B, benchmark func(b *testing.B, db *Database)) {
+	for _, engine := range EngineVariants() {
+		if engine == "unsynchronized" {
+			continue
+		}
+		b.Run(engine, func(b *testing.B) {
+			db, err := OpenDatabase(engine)
+			if err != nil {
+				b.Fatal(err)
+			}
+			db.SetProcessingDelays(NoProcessingDelays)
+			db.SetOpLogLimit(0)
+			db.SetTransactionPooling(true)
+			b.ReportAllocs()
+			benchmark(b, db)
+		})
+	}
+}
+
+// BenchmarkTransactionPooling runs two-write transactions with and without
+// transaction pooling, to compare their allocations
+func BenchmarkTransactionPooling(b *testing.B) {
+	keys := numberedKeys(100)
+	benchmarkEngines(b, func(b *testing.B, db *Database) {
+		for _, pooled := range []bool{false, true} {
+			b.Run(map[bool]string{false: "unpooled", true: "pooled"}[pooled], func(b *testing.B) {
+				db.SetTransactionPooling(pooled)
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					tx := db.BeginTransaction()
+					db.Write(tx, keys[i%len(keys)], i)
+					db.Write(tx, keys[(i+1)%len(keys)], i)
+					db.Commit(tx)
+				}
+			})
+		}
+	})
+}
+
+// BenchmarkContentionHigh benchmarks performance under high contention:
+// 64 goroutines per processor updating one key, each finishing its
+// transaction before it begins the next
+func BenchmarkContentionHigh(b *testing.B) {
+	db := NewTwoPhaseLockingDatabase()
+
+	// Initialize a single key (high contention)
+	tx := db.BeginTransaction()
+	db.Write(tx, "hotkey", 0)
+	db.Commit(tx)
+
+	b.SetParallelism(64)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			tx := db.BeginTransaction()
+			db.Update(tx, "hotkey", 1)
+			db.Commit(tx)
+		}
+	})
+}
+
+// BenchmarkContentionHighAdmission is BenchmarkContentionHigh with admission
+// control: only GOMAXPROCS of its goroutines hold a transaction at once,
+// and the rest queue for an admission slot instead of for the key
+func BenchmarkContentionHighAdmission(b *testing.B) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetMaxConcurrentTx(runtime.GOMAXPROCS(0))
+
+	// Initialize a single key (high contention)
+	tx := db.BeginTransaction()
+	db.Write(tx, "hotkey", 0)
+	db.Commit(tx)
+
+	b.SetParallelism(64)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			tx := db.BeginTransaction() // blocks while all slots are taken
+			db.Update(tx, "hotkey", 1)
+			db.Commit(tx)
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Processing delays. Every read, write, update and delete sleeps on the
+// database's clock for a simulated processing time, in the middle of the
+// operation, with whatever the engine locked for it still held. The
+// delays widen the windows in which unsynchronized operations overlap, so
+// the races this project is about show up in short runs. They also
+// dominate what a benchmark measures, so SetProcessingDelays (or -delays,
+// or processing_delays in a workload file) can change them, randomize
+// them, or turn them off to measure the synchronization alone.
+
+// ProcessingDelays are the simulated processing times of the operations
+type ProcessingDelays struct {
+	Read   Duration `json:"read"`
+	Write  Duration `json:"write"`
+	Update Duration `json:"update"` // Between reading the value and writing it back
+	Delete Duration `json:"delete"`
+	// Jitter randomizes every delay d uniformly over [d*(1-Jitter),
+	// d*(1+Jitter)]; 0 keeps them fixed
+	Jitter float64 `json:"jitter"`
+	Seed   int64   `json:"seed"` // Seeds the jitter; 0 seeds from RunSeed or the clock
+}
+
+// DefaultProcessingDelays are the delays of every new database
+var DefaultProcessingDelays = ProcessingDelays{
+	Read:   Duration(10 * time.Microsecond),
+	Write:  Duration(10 * time.Microsecond),
+	Update: Duration(50 * time.Microsecond),
+	Delete: Duration(10 * time.Microsecond),
+}
+
+// NoProcessingDelays turns the simulated processing time off
+var NoProcessingDelays = ProcessingDelays{}
+
+// Validate rejects negative delays and jitter outside [0, 1]
+func (d ProcessingDelays) Validate() error {
+	if d.Read < 0 || d.Write < 0 || d.Update < 0 || d.Delete < 0 {
+		return fmt.Errorf("processing delays must not be negative")
+	}
+	if d.Jitter < 0 || d.Jitter > 1 {
+		return fmt.Errorf("processing delay jitter must be between 0 and 1, got %v", d.Jitter)
+	}
+	return nil
+}
+
+// of returns the delay of kind
+func (d ProcessingDelays) of(kind OpKind) time.Duration {
+	switch kind {
+	case OpRead:
+		return time.Duration(d.Read)
+	case OpWrite:
+		return time.Duration(d.Write)
+	case OpUpdate:
+		return time.Duration(d.Update)
+	case OpDelete:
+		return time.Duration(d.Delete)
+	default:
+		return 0
+	}
+}
+
+// String returns the delays as ParseProcessingDelays takes them
+func (d ProcessingDelays) String() string {
+	if d == NoProcessingDelays {
+		return "none"
+	}
+	parts := []string{
+		"read=" + time.Duration(d.Read).String(),
+		"write=" + time.Duration(d.Write).String(),
+		"update=" + time.Duration(d.Update).String(),
+		"delete=" + time.Duration(d.Delete).String(),
+	}
+	if d.Jitter > 0 {
+		parts = append(parts, "jitter="+strconv.FormatFloat(d.Jitter, 'g', -1, 64))
+	}
+	if d.Seed != 0 {
+		parts = append(parts, "seed="+strconv.FormatInt(d.Seed, 10))
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseProcessingDelays parses "none", or comma-separated settings that
+// change the default delays, such as "update=0,jitter=0.5":
+//
+//	read=D, write=D, update=D, delete=D  an operation's delay
+//	all=D                                every operation's delay
+//	jitter=F                             randomize each delay by up to F of it
+//	seed=N                               seed the jitter
+func ParseProcessingDelays(s string) (ProcessingDelays, error) {
+	if s == "none" || s == "0" {
+		return NoProcessingDelays, nil
+	}
+	d := DefaultProcessingDelays
+	for _, setting := range strings.Split(s, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(setting), "=")
+		if !found {
+			return d, fmt.Errorf("processing delay %q is not name=value", setting)
+		}
+		var err error
+		switch name {
+		case "read", "write", "update", "delete", "all":
+			var delay time.Duration
+			if delay, err = time.ParseDuration(value); err != nil {
+				break
+			}
+			for _, field := range map[string][]*Duration{
+				"read": {&d.Read}, "write": {&d.Write}, "update": {&d.Update}, "delete": {&d.Delete},
+				"all": {&d.Read, &d.Write, &d.Update, &d.Delete},
+			}[name] {
+				*field = Duration(delay)
+			}
+		case "jitter":
+			d.Jitter, err = strconv.ParseFloat(value, 64)
+		case "seed":
+			d.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return d, fmt.Errorf("unknown processing delay %q: want read, write, update, delete, all, jitter or seed", name)
+		}
+		if err != nil {
+			return d, fmt.Errorf("processing delay %s: %w", name, err)
+		}
+	}
+	return d, d.Validate()
+}
+
+// processingDelays are a database's delays, and the generator of their
+// jitter
+type processingDelays struct {
+	ProcessingDelays
+	mu  sync.Mutex
+	rng *rand.Rand // Nil without jitter
+}
+
+// SetProcessingDelays replaces db's simulated processing times. It should
+// be called before the database is shared.
+func (db *Database) SetProcessingDelays(delays ProcessingDelays) error {
+	if err := delays.Validate(); err != nil {
+		return err
+	}
+	db.delays = &processingDelays{ProcessingDelays: delays}
+	if delays.Jitter > 0 {
+		seed := delays.Seed
+		if seed == 0 {
+			seed = NewRunSeed()
+		}
+		db.delays.rng = rand.New(rand.NewSource(seed))
+	}
+	return nil
+}
+
+// ProcessingDelays returns db's simulated processing times
+func (db *Database) ProcessingDelays() ProcessingDelays {
+	return db.delays.ProcessingDelays
+}
+
+// process sleeps on db's clock for the processing time of an operation of
+// kind by tx. A bulk load's operations take none.
+func (db *Database) process(tx *Transaction, kind OpKind) {
+	delay := db.delays.of(kind)
+	if delay == 0 || tx.loading {
+		return
+	}
+	if d := db.delays; d.rng != nil {
+		d.mu.Lock()
+		delay = time.Duration(float64(delay) * (1 + d.Jitter*(2*d.rng.Float64()-1)))
+		d.mu.Unlock()
+	}
+	db.clock.Sleep(delay)
+}
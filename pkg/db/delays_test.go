@@ -0,0 +1,79 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseProcessingDelays(t *testing.T) {
+	cases := map[string]ProcessingDelays{
+		"none": NoProcessingDelays,
+		"0":    NoProcessingDelays,
+		"update=0,jitter=0.5": {
+			Read: Duration(10 * time.Microsecond), Write: Duration(10 * time.Microsecond),
+			Delete: Duration(10 * time.Microsecond), Jitter: 0.5,
+		},
+		"all=1ms, read=0, seed=7": {
+			Write: Duration(time.Millisecond), Update: Duration(time.Millisecond),
+			Delete: Duration(time.Millisecond), Seed: 7,
+		},
+	}
+	for s, want := range cases {
+		got, err := ParseProcessingDelays(s)
+		if err != nil || got != want {
+			t.Errorf("%q: got %+v (err %v), want %+v", s, got, err, want)
+			continue
+		}
+		if again, err := ParseProcessingDelays(got.String()); err != nil || again != got {
+			t.Errorf("%q: %q parses back to %+v (err %v)", s, got.String(), again, err)
+		}
+	}
+	for _, s := range []string{"read", "read=fast", "scan=1ms", "jitter=2", "write=-1us"} {
+		if _, err := ParseProcessingDelays(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
+
+// TestProcessingDelaysSetLatencies checks every engine's operations take
+// their configured processing time on a simulated clock, none without
+// delays, and within the jitter with it
+func TestProcessingDelaysSetLatencies(t *testing.T) {
+	delays := ProcessingDelays{
+		Read: Duration(time.Microsecond), Write: Duration(2 * time.Microsecond),
+		Update: Duration(3 * time.Microsecond), Delete: Duration(4 * time.Microsecond),
+	}
+	jittered := delays
+	jittered.Jitter, jittered.Seed = 0.5, 1
+
+	for _, engine := range EngineVariants() {
+		for name, d := range map[string]ProcessingDelays{"fixed": delays, "none": NoProcessingDelays, "jittered": jittered} {
+			db, _ := OpenDatabase(engine)
+			simulated(db)
+			if err := db.SetProcessingDelays(d); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 20; i++ {
+				tx := db.BeginTransaction()
+				db.Write(tx, "x", i)
+				db.Read(tx, "x")
+				db.Update(tx, "x", 1)
+				db.Delete(tx, "x")
+				db.Commit(tx)
+			}
+
+			latency := db.Stats().Latency
+			for _, kind := range []OpKind{OpRead, OpWrite, OpUpdate, OpDelete} {
+				h, want := latency[kind.String()], d.of(kind)
+				low, high := time.Duration(float64(want)*(1-d.Jitter)), time.Duration(float64(want)*(1+d.Jitter))
+				if h.Count != 20 || h.Mean() < low || h.Max > high || (d.Jitter == 0 && h.Max != want) {
+					t.Errorf("%s, %s delays: %s took %+v, want %d within [%v, %v]", engine, name, kind, h, 20, low, high)
+				}
+			}
+		}
+	}
+
+	if err := NewTwoPhaseLockingDatabase().SetProcessingDelays(ProcessingDelays{Jitter: 1.5}); err == nil {
+		t.Error("jitter above 1 accepted")
+	}
+}
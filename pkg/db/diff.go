@@ -0,0 +1,156 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// SnapshotEntry is one key's state in a DBSnapshot
+type SnapshotEntry struct {
+	Value     int
+	Version   int
+	Deleted   bool
+	WrittenBy int       // Transaction that last wrote or deleted the key
+	ExpiresAt time.Time `json:",omitempty"` // TTL deadline of a live key; zero for never
+	Payload   []byte    `json:",omitempty"` // Payload of a live key; nil for none
+}
+
+// DBSnapshot is a point-in-time copy of a database's latest-committed
+// records, tombstones included, for comparing two outcomes with DiffSnapshots
+type DBSnapshot struct {
+	Engine  string
+	TakenAt time.Time
+	Entries map[string]SnapshotEntry
+}
+
+// TakeSnapshot copies every record of the latest snapshot view, so it
+// never blocks commits. Writes are buffered until commit, so the copy only
+// holds committed data.
+func (db *Database) TakeSnapshot() DBSnapshot {
+	view := db.Snapshot()
+
+	snapshot := DBSnapshot{
+		Engine:  db.EngineName(),
+		TakenAt: db.clock.Now(),
+		Entries: make(map[string]SnapshotEntry),
+	}
+	for _, shard := range view.shards {
+		for key, record := range shard {
+			entry := SnapshotEntry{
+				Value:     record.Value,
+				Version:   record.Version,
+				Deleted:   !record.live(snapshot.TakenAt), // An expired key is as good as deleted
+				WrittenBy: record.WrittenBy,
+			}
+			if !entry.Deleted {
+				entry.ExpiresAt = record.ExpiresAt
+				entry.Payload = bytes.Clone(record.Payload)
+			}
+			snapshot.Entries[key] = entry
+		}
+	}
+	return snapshot
+}
+
+// DiffKind says how a key differs between two snapshots
+type DiffKind int
+
+const (
+	// KeyAdded is live only in the second snapshot
+	KeyAdded DiffKind = iota
+	// KeyRemoved is live only in the first snapshot
+	KeyRemoved
+	// KeyChanged is live in both with different values
+	KeyChanged
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case KeyAdded:
+		return "added"
+	case KeyRemoved:
+		return "removed"
+	case KeyChanged:
+		return "changed"
+	default:
+		return fmt.Sprintf("DiffKind(%d)", int(k))
+	}
+}
+
+// KeyDiff is one key whose value differs between two snapshots. A key
+// missing from a snapshot has a zero entry there.
+type KeyDiff struct {
+	Key    string
+	Kind   DiffKind
+	Before SnapshotEntry
+	After  SnapshotEntry
+}
+
+// DiffSnapshots returns every key whose value differs between before and
+// after, in key order. A tombstone counts as absent, and keys whose value
+// is the same but whose version or writer differ are not reported.
+func DiffSnapshots(before, after DBSnapshot) []KeyDiff {
+	keys := make(map[string]bool)
+	for key := range before.Entries {
+		keys[key] = true
+	}
+	for key := range after.Entries {
+		keys[key] = true
+	}
+
+	diffs := make([]KeyDiff, 0)
+	for key := range keys {
+		b, inBefore := before.Entries[key]
+		a, inAfter := after.Entries[key]
+		liveBefore := inBefore && !b.Deleted
+		liveAfter := inAfter && !a.Deleted
+
+		diff := KeyDiff{Key: key, Before: b, After: a}
+		switch {
+		case liveBefore && liveAfter && a.Value != b.Value:
+			diff.Kind = KeyChanged
+		case liveBefore && !liveAfter:
+			diff.Kind = KeyRemoved
+		case !liveBefore && liveAfter:
+			diff.Kind = KeyAdded
+		default:
+			continue
+		}
+		diffs = append(diffs, diff)
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Key < diffs[j].Key })
+	return diffs
+}
+
+// DiffLive compares a snapshot against the database's current state
+func (db *Database) DiffLive(before DBSnapshot) []KeyDiff {
+	return DiffSnapshots(before, db.TakeSnapshot())
+}
+
+// PrintDiff writes one line per differing key with both sides' value,
+// version and last writer
+func PrintDiff(w io.Writer, before, after DBSnapshot, diffs []KeyDiff) {
+	fmt.Fprintf(w, "--- %s (%s)\n", before.Engine, before.TakenAt.Format(time.StampMicro))
+	fmt.Fprintf(w, "+++ %s (%s)\n", after.Engine, after.TakenAt.Format(time.StampMicro))
+	if len(diffs) == 0 {
+		fmt.Fprintln(w, "No differences")
+		return
+	}
+
+	side := func(entry SnapshotEntry, live bool) string {
+		if !live {
+			return "-"
+		}
+		return fmt.Sprintf("%d (v%d, tx %d)", entry.Value, entry.Version, entry.WrittenBy)
+	}
+	fmt.Fprintf(w, "%-16s %-8s %-26s %-26s\n", "Key", "Diff", "Before", "After")
+	for _, diff := range diffs {
+		fmt.Fprintf(w, "%-16s %-8s %-26s %-26s\n", diff.Key, diff.Kind,
+			side(diff.Before, diff.Kind != KeyAdded),
+			side(diff.After, diff.Kind != KeyRemoved))
+	}
+	fmt.Fprintf(w, "%d keys differ (%d in before, %d in after)\n", len(diffs), len(before.Entries), len(after.Entries))
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"testing"
+)
+
+// TestDiffSnapshotsReportsChanges verifies added, removed and changed keys
+// are reported with their last writers, and unchanged values are not
+func TestDiffSnapshotsReportsChanges(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	setup := db.BeginTransaction()
+	db.Write(setup, "same", 1)
+	db.Write(setup, "changed", 1)
+	db.Write(setup, "removed", 1)
+	db.Commit(setup)
+	before := db.TakeSnapshot()
+
+	tx := db.BeginTransaction()
+	db.Write(tx, "same", 1) // New version, same value
+	db.Write(tx, "changed", 2)
+	db.Delete(tx, "removed")
+	db.Write(tx, "added", 3)
+	db.Commit(tx)
+
+	diffs := db.DiffLive(before)
+	want := []struct {
+		key  string
+		kind DiffKind
+	}{{"added", KeyAdded}, {"changed", KeyChanged}, {"removed", KeyRemoved}}
+	if len(diffs) != len(want) {
+		t.Fatalf("Got %d diffs, want %d: %+v", len(diffs), len(want), diffs)
+	}
+	for i, w := range want {
+		if diffs[i].Key != w.key || diffs[i].Kind != w.kind {
+			t.Errorf("Diff %d = %s %s, want %s %s", i, diffs[i].Key, diffs[i].Kind, w.key, w.kind)
+		}
+	}
+
+	changed := diffs[1]
+	if changed.Before.WrittenBy != setup.ID || changed.After.WrittenBy != tx.ID {
+		t.Errorf("Writers = tx %d -> tx %d, want tx %d -> tx %d",
+			changed.Before.WrittenBy, changed.After.WrittenBy, setup.ID, tx.ID)
+	}
+	if changed.Before.Version != 1 || changed.After.Version != 2 {
+		t.Errorf("Versions = v%d -> v%d, want v1 -> v2", changed.Before.Version, changed.After.Version)
+	}
+}
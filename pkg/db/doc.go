@@ -0,0 +1,7 @@
+// Package db is the transactional key-value database: the engines,
+// unsynchronized, synchronized by a lock policy, two-phase locking, MVCC
+// and timestamp ordering, behind the DB interface and the engine
+// registry, and the mechanisms they share. The clients, workloads and
+// scenarios that run on them are in package sim, and cmd/db-sim is the
+// command line.
+package db
@@ -0,0 +1,315 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Engines. Every built-in synchronization strategy is a *Database built by
+// its own constructor; an engine from outside only has to be a DB: begin,
+// read, write, update, delete, commit, abort and count. What else a
+// database offers is optional, each part an interface of its own:
+// Configurable for its settings, Reporter for its reports and
+// FaultInjector for the faults it injects. Clients, workloads and results
+// take a DB and use whichever of those it implements; scenarios that
+// exercise the built-in engines' other features take a *Database. Engines
+// are registered by name, which is what -engine, compare, sweep and
+// workload files accept.
+
+// DB is a transactional key-value store: the operations every engine
+// implements, whatever it synchronizes with
+type DB interface {
+	// Begin starts a transaction at level that lives no longer than ctx.
+	// An engine that cannot enforce level runs it at a weaker one.
+	Begin(ctx context.Context, level IsolationLevel) *Transaction
+	Read(tx *Transaction, key string) (int, bool)
+	Write(tx *Transaction, key string, value int) bool
+	Update(tx *Transaction, key string, delta int) bool
+	Delete(tx *Transaction, key string) bool
+	Commit(tx *Transaction) error
+	Abort(tx *Transaction)
+	Stats() Stats
+}
+
+// Configurable is a DB whose settings can be changed, as workload files
+// and the engine flags do. The settings should be made before the
+// database is shared.
+type Configurable interface {
+	Clock() Clock
+	SetClock(clock Clock)
+	SetLockTimeout(timeout time.Duration)
+	SetStripes(n int)
+	SetUpsertOnUpdate(enabled bool)
+	SetFieldLocking(enabled bool)
+	SetRetryPolicy(policy RetryPolicy)
+	SetJournal(j *Journal)
+	SetCapacity(capacity Capacity)
+	SetProcessingDelays(delays ProcessingDelays) error
+	SetOpLogLimit(limit int)
+	SetTransactionPooling(on bool)
+}
+
+// Reporter is a DB that reports on itself beyond its Stats, as scenario
+// results and the debug server show
+type Reporter interface {
+	EngineName() string
+	DefaultIsolation() IsolationLevel
+	MaxIsolation() IsolationLevel
+	CheckIsolation(level IsolationLevel) error
+	ClientStats() []ClientStats
+	LockWaitStats() LockWaitStats
+	LockContention(n int) ([]KeyContention, []LockWait)
+	Stripes() int
+	Journal() *Journal
+	LiveTransactions() []*Transaction
+	GetRecordCount() int
+	TakeSnapshot() DBSnapshot
+	InvariantCount() int
+	InvariantViolations() ([]InvariantViolation, int)
+	PrintStats()
+	PrintRecords()
+}
+
+// FaultInjector is a DB that injects faults into the transactions run on
+// it, including the crashes it plans for clients, and cleans up after the
+// transactions the crashed clients left behind
+type FaultInjector interface {
+	SetFaults(config FaultConfig) error
+	Faults() (FaultConfig, FaultCounts)
+	ClientCrash(client int, steps int) int
+	Abandon(tx *Transaction)
+	AwaitAbandoned()
+}
+
+// Scanner is a DB that reads every key with a prefix, as scan operations
+// do
+type Scanner interface {
+	Scan(tx *Transaction, prefix string) (map[string]int, bool)
+}
+
+// PayloadStore is a DB whose keys can hold payloads of bytes, as the
+// writes of workloads with a value size carry
+type PayloadStore interface {
+	GetBytes(tx *Transaction, key string) ([]byte, error)
+	PutBytes(tx *Transaction, key string, payload []byte) error
+}
+
+var (
+	_ DB            = (*Database)(nil)
+	_ Configurable  = (*Database)(nil)
+	_ Reporter      = (*Database)(nil)
+	_ FaultInjector = (*Database)(nil)
+	_ Scanner       = (*Database)(nil)
+	_ PayloadStore  = (*Database)(nil)
+)
+
+// EngineConstructor returns a new, empty database of an engine. policy is
+// the variant named after a slash, as in synchronized/fair, and empty if
+// none was.
+type EngineConstructor func(policy string) (DB, error)
+
+// registeredEngine is an engine RegisterEngine added
+type registeredEngine struct {
+	name     string
+	aliases  []string
+	policies []string // Its variants, the default first; none if it has none
+	open     EngineConstructor
+	// database opens a built-in engine as a *Database; nil for engines
+	// registered from outside
+	database func(policy string) (*Database, error)
+}
+
+// engines are the registered engines, in registration order
+var engines []registeredEngine
+
+// RegisterEngine makes an engine available under name and its aliases.
+// policies are the variants open accepts, the default first. It panics if
+// a name is taken.
+func RegisterEngine(name string, aliases []string, policies []string, open EngineConstructor) {
+	for _, n := range append([]string{name}, aliases...) {
+		if _, exists := findEngine(n); exists {
+			panic(fmt.Sprintf("engine %q registered twice", n))
+		}
+	}
+	engines = append(engines, registeredEngine{name: name, aliases: aliases, policies: policies, open: open})
+}
+
+// registerDatabase registers a built-in engine, one whose databases are
+// *Database
+func registerDatabase(name string, aliases []string, policies []string, open func(policy string) (*Database, error)) {
+	RegisterEngine(name, aliases, policies, func(policy string) (DB, error) {
+		db, err := open(policy)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	})
+	engines[len(engines)-1].database = open
+}
+
+// UnregisterEngine removes the engine registered as name, such as one a
+// test added
+func UnregisterEngine(name string) {
+	for i, e := range engines {
+		if e.name == name {
+			engines = append(engines[:i], engines[i+1:]...)
+			return
+		}
+	}
+}
+
+// findEngine returns the engine registered under name, which may be one
+// of its aliases
+func findEngine(name string) (registeredEngine, bool) {
+	name = strings.ToLower(name)
+	for _, e := range engines {
+		if e.name == name {
+			return e, true
+		}
+		for _, alias := range e.aliases {
+			if alias == name {
+				return e, true
+			}
+		}
+	}
+	return registeredEngine{}, false
+}
+
+// LookupEngine returns the name of the engine registered as name, which
+// may be one of its aliases
+func LookupEngine(name string) (string, bool) {
+	e, exists := findEngine(name)
+	return e.name, exists
+}
+
+// Engines returns the names of the registered engines, in the order they
+// were registered
+func Engines() []string {
+	names := make([]string, len(engines))
+	for i, e := range engines {
+		names[i] = e.name
+	}
+	return names
+}
+
+// EngineVariants returns every registered engine under each of its
+// policies, named as -engine takes them, such as synchronized/fair
+func EngineVariants() []string {
+	return variants(false)
+}
+
+// BuiltinEngineVariants is EngineVariants for the built-in engines
+func BuiltinEngineVariants() []string {
+	return variants(true)
+}
+
+// variants returns the registered engines under each of their policies,
+// only the built-in ones if builtin is set
+func variants(builtin bool) []string {
+	var variants []string
+	for _, e := range engines {
+		if builtin && e.database == nil {
+			continue
+		}
+		if len(e.policies) == 0 {
+			variants = append(variants, e.name)
+		}
+		for _, policy := range e.policies {
+			variants = append(variants, e.name+"/"+policy)
+		}
+	}
+	return variants
+}
+
+// findPolicy returns the engine registered as engine, or the first if it
+// is empty, checking that it takes policy
+func findPolicy(engine string, policy string) (registeredEngine, error) {
+	if engine == "" {
+		engine = engines[0].name
+	}
+	e, exists := findEngine(engine)
+	if !exists {
+		return registeredEngine{}, fmt.Errorf("unknown engine %q: want %s", engine, strings.Join(Engines(), ", "))
+	}
+	if policy != "" && len(e.policies) == 0 {
+		return registeredEngine{}, fmt.Errorf("engine %s has no policies", e.name)
+	}
+	return e, nil
+}
+
+// NewEngine returns a new, empty database of the engine registered as
+// engine, or of the first engine if it is empty, under policy
+func NewEngine(engine string, policy string) (DB, error) {
+	e, err := findPolicy(engine, policy)
+	if err != nil {
+		return nil, err
+	}
+	return e.open(strings.ToLower(policy))
+}
+
+// newDatabase is NewEngine for the built-in engines
+func newDatabase(engine string, policy string) (*Database, error) {
+	e, err := findPolicy(engine, policy)
+	if err != nil {
+		return nil, err
+	}
+	if e.database == nil {
+		return nil, fmt.Errorf("engine %s is not built in: this needs one of %s", e.name, strings.Join(builtinEngines(), ", "))
+	}
+	return e.database(strings.ToLower(policy))
+}
+
+// OpenEngine returns a new, empty database of engine, named as workload
+// files and -engine flags name it: a registered name or alias, with a
+// policy after a slash if it has policies, as in synchronized/fair
+func OpenEngine(engine string) (DB, error) {
+	name, policy, _ := strings.Cut(engine, "/")
+	return NewEngine(name, policy)
+}
+
+// OpenDatabase is OpenEngine for the built-in engines, which scenarios that
+// need more than a DB take
+func OpenDatabase(engine string) (*Database, error) {
+	name, policy, _ := strings.Cut(engine, "/")
+	return newDatabase(name, policy)
+}
+
+// builtinEngines returns the names of the built-in engines
+func builtinEngines() []string {
+	var names []string
+	for _, e := range engines {
+		if e.database != nil {
+			names = append(names, e.name)
+		}
+	}
+	return names
+}
+
+func init() {
+	registerDatabase("unsynchronized", nil, nil, func(string) (*Database, error) {
+		return NewUnsynchronizedDatabase(), nil
+	})
+	registerDatabase("synchronized", nil, []string{"prefer-readers", "prefer-writers", "fair"}, func(policy string) (*Database, error) {
+		switch policy {
+		case "prefer-readers", "":
+			return NewSynchronizedDatabase(PreferReaders), nil
+		case "prefer-writers":
+			return NewSynchronizedDatabase(PreferWriters), nil
+		case "fair":
+			return NewSynchronizedDatabase(Fair), nil
+		default:
+			return nil, fmt.Errorf("unknown lock policy %q: want prefer-readers, prefer-writers or fair", policy)
+		}
+	})
+	registerDatabase("2pl", []string{"two-phase-locking"}, nil, func(string) (*Database, error) {
+		return NewTwoPhaseLockingDatabase(), nil
+	})
+	registerDatabase("mvcc", nil, nil, func(string) (*Database, error) {
+		return NewMVCCDatabase(), nil
+	})
+	registerDatabase("tso", []string{"timestamp-ordering"}, nil, func(string) (*Database, error) {
+		return NewTimestampOrderingDatabase(), nil
+	})
+}
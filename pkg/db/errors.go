@@ -0,0 +1,216 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Operations report failures as errors wrapping one of the sentinels
+// below, so callers can tell a missing key from an aborted transaction with
+// errors.Is. Read, Write, Update, UpdateOrInsert, Delete and Scan are the
+// original boolean forms, kept as thin wrappers.
+
+var (
+	// ErrKeyNotFound means an operation needed a key that does not exist
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrTxAborted means the transaction was aborted, by the engine or
+	// because its context was done, for a reason a retry will not fix,
+	// such as a validator rejecting a write or a crash
+	ErrTxAborted = errors.New("transaction aborted")
+
+	// ErrConflict means the engine aborted the transaction because it lost
+	// a conflict: a write-write conflict or serialization failure under
+	// MVCC, or an out-of-order operation under timestamp ordering. Running
+	// the transaction again may succeed. A RunTransaction closure can also
+	// return it to ask for another attempt.
+	ErrConflict = errors.New("transaction conflict")
+
+	// ErrDeadlock means a key lock wait timed out while it was part of a
+	// wait-for cycle. The transaction is still active; abort and retry it.
+	ErrDeadlock = errors.New("deadlock")
+
+	// ErrTimeout means a key or range lock wait timed out without a
+	// wait-for cycle, behind a slow transaction. The transaction is still
+	// active.
+	ErrTimeout = errors.New("lock wait timed out")
+
+	// ErrEscrowExhausted means an escrow reservation was refused because,
+	// should every outstanding reservation commit, the key would fall
+	// below its floor. The transaction is still active.
+	ErrEscrowExhausted = errors.New("escrow exhausted")
+)
+
+// txError returns why tx was aborted, or nil if it was not
+func txError(tx *Transaction) error {
+	switch {
+	case !tx.Aborted:
+		return nil
+	case tx.conflict:
+		return fmt.Errorf("%w: %s", ErrConflict, tx.AbortReason)
+	case tx.ctx != nil && tx.ctx.Err() != nil && tx.AbortReason == tx.ctx.Err().Error():
+		return fmt.Errorf("%w: %w", ErrTxAborted, tx.ctx.Err())
+	default:
+		return fmt.Errorf("%w: %s", ErrTxAborted, tx.AbortReason)
+	}
+}
+
+// opError explains why the operation of tx on key that just returned
+// false failed
+func opError(tx *Transaction, key string) error {
+	switch {
+	case tx.failure != nil:
+		return tx.failure
+	case tx.Aborted:
+		return txError(tx)
+	default:
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+}
+
+// Get returns key's value as tx sees it
+func (db *Database) Get(tx *Transaction, key string) (int, error) {
+	db.yield(tx, "GET", key)
+	defer db.observeLatency(OpRead, db.clock.Now())
+	tx.failure = nil
+	if value, ok := db.read(tx, key); ok {
+		db.journalOp(tx, JournalEntry{Op: JournalRead, Key: key, Value: value, ReadFrom: tx.readFrom})
+		db.lru.used(key)
+		return value, nil
+	}
+	return 0, opError(tx, key)
+}
+
+// Put sets key to value when tx commits
+func (db *Database) Put(tx *Transaction, key string, value int) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return db.put(tx, key, value)
+}
+
+// put is Put for any key, including composite records' fields
+func (db *Database) put(tx *Transaction, key string, value int) error {
+	db.yield(tx, "PUT", key)
+	defer db.observeLatency(OpWrite, db.clock.Now())
+	tx.failure = nil
+	if db.write(tx, key, value) {
+		db.journalOp(tx, JournalEntry{Op: JournalWrite, Key: key, Value: value})
+		return nil
+	}
+	return opError(tx, key)
+}
+
+// Add adds delta to key's value. A missing key makes it fail, unless
+// upsert-on-update is enabled, in which case it behaves like Upsert with
+// an initial value of 0.
+func (db *Database) Add(tx *Transaction, key string, delta int) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return db.add(tx, key, delta)
+}
+
+// add is Add for any key, including composite records' fields
+func (db *Database) add(tx *Transaction, key string, delta int) error {
+	db.yield(tx, "ADD", key)
+	defer db.observeLatency(OpUpdate, db.clock.Now())
+	tx.failure = nil
+	if db.update(tx, key, delta, db.upsertOnUpdate, 0) {
+		db.journalOp(tx, JournalEntry{Op: JournalAdd, Key: key, Delta: delta, ReadFrom: tx.readFrom})
+		return nil
+	}
+	return opError(tx, key)
+}
+
+// Upsert adds delta to key, treating a missing (or deleted) key as holding
+// initial, so the key ends up as initial+delta. The fallback counts
+// towards Stats.UpsertInserts.
+func (db *Database) Upsert(tx *Transaction, key string, delta int, initial int) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	db.yield(tx, "ADD", key)
+	defer db.observeLatency(OpUpdate, db.clock.Now())
+	tx.failure = nil
+	if db.update(tx, key, delta, true, initial) {
+		db.journalOp(tx, JournalEntry{Op: JournalAdd, Key: key, Delta: delta, ReadFrom: tx.readFrom})
+		return nil
+	}
+	return opError(tx, key)
+}
+
+// Remove deletes key when tx commits
+func (db *Database) Remove(tx *Transaction, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return db.remove(tx, key)
+}
+
+// remove is Remove for any key, including composite records' fields
+func (db *Database) remove(tx *Transaction, key string) error {
+	db.yield(tx, "DELETE", key)
+	defer db.observeLatency(OpDelete, db.clock.Now())
+	tx.failure = nil
+	if db.deleteKey(tx, key) {
+		db.journalOp(tx, JournalEntry{Op: JournalDelete, Key: key})
+		return nil
+	}
+	return opError(tx, key)
+}
+
+// ScanPrefix returns every live key starting with prefix together with its
+// value, read at tx's isolation level, with tx's own pending writes applied
+func (db *Database) ScanPrefix(tx *Transaction, prefix string) (map[string]int, error) {
+	db.yield(tx, "SCAN", prefix)
+	defer db.observeLatency(OpScan, db.clock.Now())
+	tx.failure = nil
+	if rows, ok := db.scan(tx, prefix); ok {
+		if db.journal != nil {
+			keys := make([]string, 0, len(rows))
+			for key := range rows {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				db.journalOp(tx, JournalEntry{Op: JournalRead, Key: key, Value: rows[key], ReadFrom: readUntracked})
+			}
+		}
+		return rows, nil
+	}
+	return nil, opError(tx, prefix)
+}
+
+// Read is Get reporting only whether it succeeded
+func (db *Database) Read(tx *Transaction, key string) (int, bool) {
+	value, err := db.Get(tx, key)
+	return value, err == nil
+}
+
+// Write is Put reporting only whether it succeeded
+func (db *Database) Write(tx *Transaction, key string, value int) bool {
+	return db.Put(tx, key, value) == nil
+}
+
+// Update is Add reporting only whether it succeeded
+func (db *Database) Update(tx *Transaction, key string, delta int) bool {
+	return db.Add(tx, key, delta) == nil
+}
+
+// UpdateOrInsert is Upsert reporting only whether it succeeded
+func (db *Database) UpdateOrInsert(tx *Transaction, key string, delta int, initial int) bool {
+	return db.Upsert(tx, key, delta, initial) == nil
+}
+
+// Delete is Remove reporting only whether it succeeded
+func (db *Database) Delete(tx *Transaction, key string) bool {
+	return db.Remove(tx, key) == nil
+}
+
+// Scan is ScanPrefix reporting only whether it succeeded
+func (db *Database) Scan(tx *Transaction, prefix string) (map[string]int, bool) {
+	rows, err := db.ScanPrefix(tx, prefix)
+	return rows, err == nil
+}
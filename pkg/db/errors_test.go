@@ -0,0 +1,112 @@
+package db
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestOperationErrors verifies each kind of failure is reported with its
+// sentinel error
+func TestOperationErrors(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.AddValidator(NonNegative())
+
+	tx := db.BeginTransaction()
+	if _, err := db.Get(tx, "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Get of a missing key returned %v, want ErrKeyNotFound", err)
+	}
+	if err := db.Remove(tx, "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Remove of a missing key returned %v, want ErrKeyNotFound", err)
+	}
+	if err := db.Put(tx, "x", 1); err != nil {
+		t.Errorf("Put returned %v", err)
+	}
+	if err := db.Commit(tx); err != nil {
+		t.Errorf("Commit returned %v", err)
+	}
+
+	tx = db.BeginTransaction()
+	if err := db.Put(tx, "x", -1); !errors.Is(err, ErrTxAborted) {
+		t.Errorf("Rejected Put returned %v, want ErrTxAborted", err)
+	}
+	if _, err := db.Get(tx, "x"); !errors.Is(err, ErrTxAborted) {
+		t.Errorf("Get on an aborted transaction returned %v, want ErrTxAborted", err)
+	}
+	if err := db.Commit(tx); !errors.Is(err, ErrTxAborted) {
+		t.Errorf("Commit of an aborted transaction returned %v, want ErrTxAborted", err)
+	}
+}
+
+// TestCommitReportsConflict verifies an MVCC commit that loses a
+// write-write conflict returns ErrConflict
+func TestCommitReportsConflict(t *testing.T) {
+	db := NewMVCCDatabase()
+	first := db.BeginTransaction()
+	second := db.BeginTransaction()
+	db.Put(first, "x", 1)
+	db.Put(second, "x", 2)
+
+	if err := db.Commit(first); err != nil {
+		t.Fatalf("First commit returned %v", err)
+	}
+	if err := db.Commit(second); !errors.Is(err, ErrConflict) {
+		t.Errorf("Second commit returned %v, want ErrConflict", err)
+	}
+}
+
+// TestLockWaitErrors verifies a lock wait in a wait-for cycle times out
+// with ErrDeadlock, and one behind a transaction that is merely slow with
+// ErrTimeout
+func TestLockWaitErrors(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetLockTimeout(50 * time.Millisecond)
+	first := db.BeginTransaction()
+	second := db.BeginTransaction()
+	db.Put(first, "a", 1)
+	db.Put(second, "b", 1)
+
+	// first waits for b while second waits for a
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, step := range []struct {
+		tx  *Transaction
+		key string
+	}{{first, "b"}, {second, "a"}} {
+		i, step := i, step
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = db.Put(step.tx, step.key, 2)
+			if errs[i] != nil {
+				db.Abort(step.tx) // Lets the other one through
+			}
+		}()
+	}
+	wg.Wait()
+
+	deadlocks := 0
+	for _, err := range errs {
+		if errors.Is(err, ErrDeadlock) {
+			deadlocks++
+		} else if err != nil && !errors.Is(err, ErrTimeout) {
+			t.Errorf("Lock wait returned %v, want ErrDeadlock, ErrTimeout or nil", err)
+		}
+	}
+	if deadlocks != 1 {
+		t.Errorf("%d waits reported ErrDeadlock (%v), want 1", deadlocks, errs)
+	}
+	if stats := db.Stats(); stats.Deadlocks != 1 {
+		t.Errorf("Stats.Deadlocks = %d, want 1", stats.Deadlocks)
+	}
+
+	holder := db.BeginTransaction()
+	db.Put(holder, "c", 1)
+	waiter := db.BeginTransaction()
+	if err := db.Put(waiter, "c", 2); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Wait behind a slow transaction returned %v, want ErrTimeout", err)
+	}
+	db.Abort(waiter)
+	db.Commit(holder)
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Escrow. Increments commute: applied in any order they give the same
+// total, so transactions adding to a hot counter need not exclude each
+// other the way two-phase locking's exclusive lock makes them. Escrow
+// buffers a transaction's increment as a delta that commit adds to the
+// value committed by then, without a key lock. What increments alone
+// cannot guarantee is a bound, such as stock never falling below zero, so
+// each decrement first reserves its amount: it is refused if the value,
+// less every decrement reserved but not yet committed, would fall below
+// the floor. Whatever order the reservations then commit or abort in, the
+// value never falls below it.
+//
+// A key updated with Escrow should only be changed with Escrow: a plain
+// write replaces the value the reservations were checked against.
+
+// escrowLedger holds the outstanding escrow reservations. The zero value
+// holds none.
+type escrowLedger struct {
+	mu       sync.Mutex
+	reserved map[string]int         // Key -> decrements reserved against it, a negative sum
+	byTx     map[int]map[string]int // Transaction -> its reservations by key
+}
+
+// reserve records tx's decrement of key. Must be called with l.mu held.
+func (l *escrowLedger) reserve(txID int, key string, delta int) {
+	if l.reserved == nil {
+		l.reserved = make(map[string]int)
+		l.byTx = make(map[int]map[string]int)
+	}
+	if l.byTx[txID] == nil {
+		l.byTx[txID] = make(map[string]int)
+	}
+	l.reserved[key] += delta
+	l.byTx[txID][key] += delta
+}
+
+// release drops every reservation of the finished transaction txID
+func (l *escrowLedger) release(txID int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, delta := range l.byTx[txID] {
+		if l.reserved[key] -= delta; l.reserved[key] == 0 {
+			delete(l.reserved, key)
+		}
+	}
+	delete(l.byTx, txID)
+}
+
+// Escrow adds delta to key when tx commits, without locking the key. A
+// negative delta is refused, with an error wrapping ErrEscrowExhausted,
+// if key could then fall below floor; tx stays active either way. key
+// must exist. Escrow needs an engine with a database lock and without
+// multiple versions or timestamps: the synchronized engine or two-phase
+// locking.
+func (db *Database) Escrow(tx *Transaction, key string, delta int, floor int) error {
+	defer db.observeLatency(OpUpdate, db.clock.Now())
+	tx.failure = nil
+	if !db.checkActive(tx, "ESCROW", key) {
+		return opError(tx, key)
+	}
+	if db.lock == nil || db.mvcc != nil || db.tso != nil || tx.parent != nil {
+		return fmt.Errorf("escrow on %s in this transaction: %w", db.EngineName(), errors.ErrUnsupported)
+	}
+	earlier, buffered := tx.pending(key)
+	if buffered && !earlier.Relative {
+		return fmt.Errorf("escrow on %s after writing it in the same transaction: %w", key, errors.ErrUnsupported)
+	}
+
+	// Under the write lock no commit can change the value while we check it
+	db.wLockKey(key)
+	defer db.wUnlockKey(key)
+	record, exists := db.records.get(key)
+	if !exists || !record.live(db.clock.Now()) {
+		tx.logOp("ESCROW %s: NOT_FOUND", key)
+		return fmt.Errorf("escrow on %s: %w", key, ErrKeyNotFound)
+	}
+
+	db.escrow.mu.Lock()
+	defer db.escrow.mu.Unlock()
+	if delta < 0 {
+		// The worst case: every decrement reserved commits, and no increment
+		if lowest := record.Value + db.escrow.reserved[key] + delta; lowest < floor {
+			tx.logOp("ESCROW %s: %+d REFUSED (could fall to %d)", key, delta, lowest)
+			return fmt.Errorf("%w: %s could fall to %d, below %d", ErrEscrowExhausted, key, lowest, floor)
+		}
+		db.escrow.reserve(tx.ID, key, delta)
+	}
+	db.countStat(statTotalWrites, 1)
+	tx.bufferWrite(key, pendingWrite{Value: earlier.Value + delta, Relative: true})
+	tx.logOp("ESCROW %s: %+d (pending, floor %d)", key, delta, floor)
+	db.journalOp(tx, JournalEntry{Op: JournalAdd, Key: key, Delta: delta})
+	return nil
+}
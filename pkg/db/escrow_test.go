@@ -0,0 +1,79 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestEscrowReservesAgainstFloor verifies concurrent decrements are
+// refused once the outstanding reservations could take the key below its
+// floor, and that an abort gives its reservation back
+func TestEscrowReservesAgainstFloor(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	setup := db.BeginTransaction()
+	db.Write(setup, "stock", 2)
+	db.Commit(setup)
+
+	a, b, c := db.BeginTransaction(), db.BeginTransaction(), db.BeginTransaction()
+	if err := db.Escrow(a, "stock", -1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Escrow(b, "stock", -1, 0); err != nil {
+		t.Fatalf("second reservation refused: %v", err)
+	}
+	if err := db.Escrow(c, "stock", -1, 0); !errors.Is(err, ErrEscrowExhausted) {
+		t.Fatalf("third reservation of 2 items: %v, expected ErrEscrowExhausted", err)
+	}
+
+	db.Abort(b)
+	if err := db.Escrow(c, "stock", -1, 0); err != nil {
+		t.Fatalf("reservation refused after an abort freed one: %v", err)
+	}
+	db.Commit(c)
+	db.Commit(a)
+
+	check := db.BeginTransaction()
+	if stock, _ := db.Get(check, "stock"); stock != 0 {
+		t.Errorf("stock %d after two committed decrements of 2, expected 0", stock)
+	}
+	db.Commit(check)
+}
+
+// TestEscrowTakesNoLock verifies escrow increments of one key by open
+// transactions do not block each other
+func TestEscrowTakesNoLock(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	setup := db.BeginTransaction()
+	db.Write(setup, "counter", 0)
+	db.Commit(setup)
+
+	var txs []*Transaction
+	for i := 0; i < 3; i++ {
+		tx := db.BeginTransaction()
+		if err := db.Escrow(tx, "counter", 5, 0); err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+	for _, tx := range txs {
+		if err := db.Commit(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := db.BeginTransaction()
+	if value, _ := db.Get(check, "counter"); value != 15 {
+		t.Errorf("counter %d, expected 15", value)
+	}
+	db.Commit(check)
+}
+
+// TestEscrowUnsupported verifies escrow is refused where deltas cannot be
+// merged at commit
+func TestEscrowUnsupported(t *testing.T) {
+	db := NewMVCCDatabase()
+	tx := db.BeginTransaction()
+	if err := db.Escrow(tx, "stock", 1, 0); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("escrow under MVCC: %v, expected errors.ErrUnsupported", err)
+	}
+	db.Abort(tx)
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"container/list"
+	"sync"
+	"unsafe"
+)
+
+// Eviction. A database with a capacity behaves as a cache: once its live
+// keys outgrow the capacity, in number or in estimated bytes, the commit
+// that took them over it deletes the least recently used ones until they
+// fit again. Each eviction is an ordinary delete, in a transaction of its
+// own that runs after the committing one has finished, so every engine
+// orders it against concurrent transactions as it would a client's delete
+// and nothing ever reads a half-evicted key. Pinned keys are never
+// evicted (see Pin).
+//
+// A key is used when a Get (or GetBytes) reads it or a commit writes it.
+// Evicted keys leave tombstones, and MVCC versions, behind like any
+// delete, for CollectTombstones and Vacuum to reclaim.
+
+// Capacity limits how much a database holds before it evicts keys
+type Capacity struct {
+	Keys  int // Live keys; 0 for no limit
+	Bytes int // Estimated bytes of live records, their keys and payloads, as MemoryUsage counts them; 0 for no limit
+}
+
+// lruList orders a database's live keys by last use
+type lruList struct {
+	capacity Capacity
+
+	mu      sync.Mutex
+	order   *list.List // Of *lruEntry, most recently used first
+	entries map[string]*list.Element
+	bytes   int // Sum of the entries' sizes
+}
+
+// lruEntry is one live key and its estimated size
+type lruEntry struct {
+	key  string
+	size int
+}
+
+// SetCapacity makes db evict its least recently used keys beyond capacity,
+// tracking the live keys it already holds in no particular order. A zero
+// Capacity turns eviction off. It should be called before the database is
+// shared.
+func (db *Database) SetCapacity(capacity Capacity) {
+	if capacity == (Capacity{}) {
+		db.lru = nil
+		return
+	}
+	lru := &lruList{capacity: capacity, order: list.New(), entries: make(map[string]*list.Element)}
+	now := db.clock.Now()
+	db.rLock()
+	db.records.each(func(key string, record *Record) {
+		if record.live(now) {
+			lru.written(key, record)
+		}
+	})
+	db.rUnlock()
+	db.lru = lru
+}
+
+// recordBytes estimates the memory a record and its key take up
+func recordBytes(key string, record *Record) int {
+	return int(unsafe.Sizeof(*record)) + len(key) + len(record.Payload)
+}
+
+// written makes key the most recently used, at record's size, or forgets
+// it if record is a tombstone. The caller must hold key's stripe lock.
+func (l *lruList) written(key string, record *Record) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if record.Deleted {
+		l.remove(key)
+		return
+	}
+	size := recordBytes(key, record)
+	if element, exists := l.entries[key]; exists {
+		entry := element.Value.(*lruEntry)
+		l.bytes += size - entry.size
+		entry.size = size
+		l.order.MoveToFront(element)
+		return
+	}
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, size: size})
+	l.bytes += size
+}
+
+// used makes key the most recently used, if it is tracked
+func (l *lruList) used(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if element, exists := l.entries[key]; exists {
+		l.order.MoveToFront(element)
+	}
+}
+
+// remove forgets key. The caller must hold l.mu.
+func (l *lruList) remove(key string) {
+	if element, exists := l.entries[key]; exists {
+		l.bytes -= element.Value.(*lruEntry).size
+		l.order.Remove(element)
+		delete(l.entries, key)
+	}
+}
+
+// over reports whether the tracked keys exceed the capacity
+func (l *lruList) over() bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.overLocked()
+}
+
+func (l *lruList) overLocked() bool {
+	return (l.capacity.Keys > 0 && len(l.entries) > l.capacity.Keys) ||
+		(l.capacity.Bytes > 0 && l.bytes > l.capacity.Bytes)
+}
+
+// victims forgets, and returns, the least recently used keys that are not
+// pinned until the rest fit the capacity, or only pinned keys are left.
+// Forgetting them at once keeps concurrent evictions from picking the same
+// keys.
+func (l *lruList) victims(db *Database) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var keys []string
+	for element := l.order.Back(); element != nil && l.overLocked(); {
+		entry := element.Value.(*lruEntry)
+		element = element.Prev()
+		if db.Pins(entry.key) > 0 {
+			continue
+		}
+		l.remove(entry.key)
+		keys = append(keys, entry.key)
+	}
+	return keys
+}
+
+// evict deletes least recently used keys until the live keys fit db's
+// capacity, and returns how many it deleted. A key whose delete fails,
+// such as one a transaction under two-phase locking held until the lock
+// timed out, is tracked again if it is still live, to be tried next time.
+func (db *Database) evict() int {
+	evicted := 0
+	for _, key := range db.lru.victims(db) {
+		tx := db.BeginTransaction()
+		if !db.Delete(tx, key) {
+			db.Abort(tx)
+		} else if db.Commit(tx) == nil {
+			evicted++
+			continue
+		}
+		db.rLockKey(key)
+		if record, exists := db.records.get(key); exists && record.live(db.clock.Now()) {
+			db.lru.written(key, record)
+		}
+		db.rUnlockKey(key)
+	}
+	db.countStat(statKeysEvicted, evicted)
+	return evicted
+}
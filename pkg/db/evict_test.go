@@ -0,0 +1,113 @@
+package db
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestEvictionLeastRecentlyUsed verifies the commit that takes a database
+// over its capacity evicts the least recently used key that is not pinned
+func TestEvictionLeastRecentlyUsed(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetCapacity(Capacity{Keys: 3})
+	write := func(key string) {
+		tx := db.BeginTransaction()
+		db.Write(tx, key, 1)
+		if err := db.Commit(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(key string) bool {
+		tx := db.BeginTransaction()
+		defer db.Commit(tx)
+		_, ok := db.Read(tx, key)
+		return ok
+	}
+	write("a")
+	write("b")
+	write("c")
+	if !exists("a") {
+		t.Fatal("a missing before the capacity was reached")
+	}
+	write("d")
+	for _, key := range []string{"c", "b", "a", "d"} {
+		if got, want := exists(key), key != "b"; got != want {
+			t.Errorf("%s exists: %v, want %v after d took the database over", key, got, want)
+		}
+	}
+
+	// Read in that order, c is now the least recently used, then a
+	db.Pin("c")
+	write("e")
+	if exists("a") || !exists("c") {
+		t.Errorf("Evicted the pinned c instead of a")
+	}
+	if stats := db.Stats(); stats.KeysEvicted != 2 {
+		t.Errorf("KeysEvicted = %d, want 2", stats.KeysEvicted)
+	}
+	if count := db.GetRecordCount(); count != 3 {
+		t.Errorf("%d live keys, want the capacity's 3", count)
+	}
+}
+
+// TestEvictionBytes verifies a byte capacity counts payloads
+func TestEvictionBytes(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	payload := []byte(strings.Repeat("x", 1000))
+	size := recordBytes("key_0", &Record{Payload: payload})
+	db.SetCapacity(Capacity{Bytes: 2 * size})
+	for i := 0; i < 3; i++ {
+		tx := db.BeginTransaction()
+		db.PutBytes(tx, fmt.Sprintf("key_%d", i), payload)
+		db.Commit(tx)
+	}
+	if count := db.GetRecordCount(); count != 2 {
+		t.Errorf("%d live keys, want the 2 that fit", count)
+	}
+	if usage := db.MemoryUsage(); usage.PayloadBytes != 2*len(payload) {
+		t.Errorf("%d payload bytes held, want %d", usage.PayloadBytes, 2*len(payload))
+	}
+}
+
+// TestEvictionConcurrent writes more keys than fit from several goroutines
+// on each engine, for the race detector, and checks the keys fit once the
+// writers are done
+func TestEvictionConcurrent(t *testing.T) {
+	for _, engine := range []string{"synchronized", "2pl", "mvcc", "tso"} {
+		t.Run(engine, func(t *testing.T) {
+			db, err := OpenDatabase(engine)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db.SetProcessingDelays(NoProcessingDelays)
+			db.SetCapacity(Capacity{Keys: 8})
+			var wg sync.WaitGroup
+			for g := 0; g < 4; g++ {
+				wg.Add(1)
+				go func(rng *rand.Rand) {
+					defer wg.Done()
+					for i := 0; i < 200; i++ {
+						key := fmt.Sprintf("key_%d", rng.Intn(32))
+						tx := db.BeginTransaction()
+						if rng.Intn(2) == 0 {
+							db.Read(tx, key)
+						} else {
+							db.Write(tx, key, i)
+						}
+						db.Commit(tx)
+					}
+				}(rand.New(rand.NewSource(int64(g))))
+			}
+			wg.Wait()
+			if count := db.GetRecordCount(); count > 8 {
+				t.Errorf("%d live keys once the writers finished, want at most 8", count)
+			}
+			if stats := db.Stats(); stats.KeysEvicted == 0 {
+				t.Errorf("No keys evicted")
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ReplicationMode decides when a primary acknowledges a commit relative to
+// shipping it to its standby
+type ReplicationMode int
+
+const (
+	// AsyncReplication acknowledges at once and ships the commit in the
+	// background; commits still in flight are lost on failover
+	AsyncReplication ReplicationMode = iota
+	// SyncReplication acknowledges only after the standby applied the commit
+	SyncReplication
+)
+
+func (m ReplicationMode) String() string {
+	switch m {
+	case AsyncReplication:
+		return "async"
+	case SyncReplication:
+		return "sync"
+	default:
+		return fmt.Sprintf("ReplicationMode(%d)", int(m))
+	}
+}
+
+// Crash simulates the database process dying: every operation after it
+// fails and aborts its transaction, and a commit that was already under
+// way is reported as aborted even if it reached the commit stream
+func (db *Database) Crash() {
+	db.crashed.Store(true)
+}
+
+// Crashed reports whether Crash was called
+func (db *Database) Crashed() bool {
+	return db.crashed.Load()
+}
+
+// Standby is a warm standby: a separate database kept up to date by
+// replaying a primary's commit stream, which can take over when the
+// primary dies
+type Standby struct {
+	db    *Database
+	mode  ReplicationMode
+	delay time.Duration // Simulated network delay per shipped commit
+
+	stream chan CommitRecord // Async: commits shipped but not yet applied
+	stop   chan struct{}
+	done   chan struct{}
+
+	// mu serializes applying commits and guards the fields below
+	mu       sync.Mutex
+	promoted bool
+	applied  int   // Commits replayed on the standby
+	lastSeq  int64 // Seq of the last replayed commit
+	dropped  int   // Commits shipped but never applied because of failover
+}
+
+// NewStandby creates a standby for primary and subscribes it to primary's
+// commit stream. Each shipped commit takes delay to reach the standby.
+func NewStandby(primary *Database, mode ReplicationMode, delay time.Duration) *Standby {
+	s := &Standby{
+		db:    NewTwoPhaseLockingDatabase(),
+		mode:  mode,
+		delay: delay,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if mode == AsyncReplication {
+		s.stream = make(chan CommitRecord, 4096)
+		go s.replay()
+	} else {
+		close(s.done)
+	}
+	primary.SetCommitHook(s.ship)
+	return s
+}
+
+// DB returns the standby's database. Clients should only use it after
+// Promote; until then it is read-only by convention.
+func (s *Standby) DB() *Database {
+	return s.db
+}
+
+// ship is the primary's commit hook
+func (s *Standby) ship(record CommitRecord) {
+	if s.mode == SyncReplication {
+		time.Sleep(s.delay)
+		s.apply(record)
+		return
+	}
+
+	select {
+	case s.stream <- record:
+	case <-s.stop:
+		s.mu.Lock()
+		s.dropped++
+		s.mu.Unlock()
+	}
+}
+
+// replay applies asynchronously shipped commits in stream order until the
+// standby is promoted
+func (s *Standby) replay() {
+	defer close(s.done)
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case record := <-s.stream:
+			time.Sleep(s.delay)
+			s.apply(record)
+		}
+	}
+}
+
+// apply replays one committed transaction on the standby
+func (s *Standby) apply(record CommitRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.promoted {
+		// The link is gone: the commit never made it across
+		s.dropped++
+		return
+	}
+
+	s.db.applyRecord(record)
+
+	s.applied++
+	s.lastSeq = record.Seq
+}
+
+// Promote cuts the replication link and makes the standby the new
+// primary. Commits that were shipped but not yet applied are dropped.
+// It returns the standby's database for clients to reconnect to.
+func (s *Standby) Promote() *Database {
+	s.mu.Lock()
+	s.promoted = true
+	s.mu.Unlock()
+
+	close(s.stop)
+	<-s.done
+
+	// Whatever is still queued was acknowledged by the primary but is gone
+	s.mu.Lock()
+	for len(s.stream) > 0 {
+		<-s.stream
+		s.dropped++
+	}
+	s.mu.Unlock()
+	return s.db
+}
+
+// ReplicationStatus reports how much of the commit stream the standby
+// replayed and how much it lost at failover
+func (s *Standby) ReplicationStatus() (applied int, lastSeq int64, dropped int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.applied, s.lastSeq, s.dropped
+}
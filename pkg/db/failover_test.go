@@ -0,0 +1,56 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// TestStandbyReplaysCommitStream verifies a standby sees committed writes
+// and deletes, but nothing from aborted transactions
+func TestStandbyReplaysCommitStream(t *testing.T) {
+	primary := NewTwoPhaseLockingDatabase()
+	standby := NewStandby(primary, SyncReplication, 0)
+
+	tx := primary.BeginTransaction()
+	primary.Write(tx, "a", 1)
+	primary.Write(tx, "b", 2)
+	primary.Commit(tx)
+
+	tx = primary.BeginTransaction()
+	primary.Update(tx, "a", 10)
+	primary.Delete(tx, "b")
+	primary.Commit(tx)
+
+	tx = primary.BeginTransaction()
+	primary.Write(tx, "c", 3)
+	primary.Abort(tx)
+
+	db := standby.Promote()
+	if applied, lastSeq, _ := standby.ReplicationStatus(); applied != 2 || lastSeq != 2 {
+		t.Errorf("Standby applied %d commits up to seq %d, want 2 up to 2", applied, lastSeq)
+	}
+
+	ok, errs := db.VerifyIntegrity(map[string]int{"a": 11})
+	if !ok {
+		t.Errorf("Standby diverged from primary: %v", errs)
+	}
+	if db.GetRecordCount() != 1 {
+		t.Errorf("Standby has %d live records, want 1", db.GetRecordCount())
+	}
+}
+
+// TestCrashAbortsTransactions verifies a crashed database rejects work
+func TestCrashAbortsTransactions(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetLockTimeout(50 * time.Millisecond)
+	db.Crash()
+
+	tx := db.BeginTransaction()
+	if db.Write(tx, "a", 1) {
+		t.Error("Write on a crashed database succeeded")
+	}
+	db.Commit(tx)
+	if !tx.Aborted {
+		t.Error("Transaction on a crashed database committed")
+	}
+}
@@ -0,0 +1,313 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault injection. A database given a FaultConfig with SetFaults misbehaves
+// on purpose at labeled fault points: before each Get, Put, Add, Upsert,
+// Remove, ScanPrefix and Commit (the same points a Scheduler yields at),
+// and, with storage attached, at each commit's WAL append. At those points
+// it can sleep for a random extra delay and abort the transaction as if it
+// had lost a conflict, so a retry may succeed. Clients can be made to die
+// mid-transaction, leaving their transaction behind until the database
+// notices, and the whole database can be made to crash at a given commit,
+// just before or just after the commit reaches the WAL.
+//
+// Every client draws its faults from its own generator, seeded from the
+// configuration's seed and the client ID, so which of a client's
+// operations are hit follows from the seed rather than from how the
+// clients happen to interleave, and a chaos run can be repeated.
+
+// The fault point labels a FaultConfig's DelayPoints may name
+var faultPoints = []string{"get", "put", "add", "delete", "scan", "commit", "wal"}
+
+// The points of a commit, relative to its WAL append, at which
+// FaultConfig.CrashPoint can crash the database
+const (
+	CrashBeforeWAL = "before-wal" // The commit is installed but never logged
+	CrashAfterWAL  = "after-wal"  // The commit is logged but never acknowledged
+)
+
+// FaultConfig configures the faults SetFaults injects. Its zero value
+// injects none. It is the faults section of a workload file:
+//
+//	faults:
+//	  seed: 7
+//	  delay_probability: 0.1
+//	  max_delay: 2ms
+//	  delay_points: [commit, wal]
+//	  abort_probability: 0.02
+//	  client_crash_probability: 0.01
+//	  client_crash_timeout: 20ms
+//	  crash_at_commit: 500
+//	  crash_point: after-wal
+type FaultConfig struct {
+	Seed                   int64    `json:"seed"`                     // 0 for the workload's seed, or one from the clock
+	DelayProbability       float64  `json:"delay_probability"`        // Of sleeping at each fault point
+	MaxDelay               Duration `json:"max_delay"`                // Delays are uniform up to this
+	DelayPoints            []string `json:"delay_points"`             // get, put, add, delete, scan, commit or wal; empty for all
+	AbortProbability       float64  `json:"abort_probability"`        // Of aborting the transaction at each operation
+	ClientCrashProbability float64  `json:"client_crash_probability"` // Of a transaction's client dying partway through it
+	ClientCrashTimeout     Duration `json:"client_crash_timeout"`     // Until a dead client's transaction is aborted; 0 at once
+	CrashAtCommit          int64    `json:"crash_at_commit"`          // Crash at the nth commit logged after SetFaults; 0 never. Needs storage
+	CrashPoint             string   `json:"crash_point"`              // before-wal or after-wal (the default)
+}
+
+// Enabled reports whether the configuration injects any fault
+func (f FaultConfig) Enabled() bool {
+	return f.DelayProbability > 0 || f.AbortProbability > 0 || f.ClientCrashProbability > 0 || f.CrashAtCommit > 0
+}
+
+// Validate reports every problem with the configuration
+func (f FaultConfig) Validate() error {
+	var errs []error
+	for name, p := range map[string]float64{
+		"delay_probability":        f.DelayProbability,
+		"abort_probability":        f.AbortProbability,
+		"client_crash_probability": f.ClientCrashProbability,
+	} {
+		if p < 0 || p > 1 {
+			errs = append(errs, fmt.Errorf("faults: %s must be between 0 and 1, got %v", name, p))
+		}
+	}
+	if f.MaxDelay < 0 || f.ClientCrashTimeout < 0 || f.CrashAtCommit < 0 {
+		errs = append(errs, fmt.Errorf("faults: max_delay, client_crash_timeout and crash_at_commit must not be negative"))
+	}
+	if f.DelayProbability > 0 && f.MaxDelay == 0 {
+		errs = append(errs, fmt.Errorf("faults: delay_probability needs a max_delay"))
+	}
+	known := make(map[string]bool, len(faultPoints))
+	for _, point := range faultPoints {
+		known[point] = true
+	}
+	for _, point := range f.DelayPoints {
+		if !known[strings.ToLower(point)] {
+			errs = append(errs, fmt.Errorf("faults: unknown delay point %q: want %s", point, strings.Join(faultPoints, ", ")))
+		}
+	}
+	switch f.CrashPoint {
+	case "", CrashBeforeWAL, CrashAfterWAL:
+	default:
+		errs = append(errs, fmt.Errorf("faults: unknown crash_point %q: want %s or %s", f.CrashPoint, CrashBeforeWAL, CrashAfterWAL))
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+// FaultCounts counts the faults a database injected
+type FaultCounts struct {
+	Delays        int // Extra delays slept
+	Aborts        int // Transactions aborted
+	ClientCrashes int // Transactions abandoned by a dying client
+	Crashes       int // Database crashes, at most one
+}
+
+func (c FaultCounts) String() string {
+	return fmt.Sprintf("%d delays, %d aborts, %d client crashes, %d database crashes", c.Delays, c.Aborts, c.ClientCrashes, c.Crashes)
+}
+
+// faultInjector injects a database's faults. It has its own mutex, even
+// when unsynchronized, since every client draws from it.
+type faultInjector struct {
+	config FaultConfig
+	delays map[string]bool // The fault points delays apply at
+
+	mu     sync.Mutex
+	rngs   map[int]*rand.Rand // Client ID -> its generator; 0 for transactions of no client
+	counts FaultCounts
+	logged int64 // Commits that reached the WAL append point
+
+	abandoned sync.WaitGroup // Abandoned transactions not yet aborted
+}
+
+// SetFaults makes db inject the faults config describes, replacing any
+// set before. It should be called before the database is shared.
+func (db *Database) SetFaults(config FaultConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if !config.Enabled() {
+		db.faults = nil
+		return nil
+	}
+	if config.Seed == 0 {
+		config.Seed = NewRunSeed()
+	}
+	points := faultPoints
+	if len(config.DelayPoints) > 0 {
+		points = config.DelayPoints
+	}
+	f := &faultInjector{config: config, delays: make(map[string]bool), rngs: make(map[int]*rand.Rand)}
+	for _, point := range points {
+		f.delays[strings.ToLower(point)] = true
+	}
+	db.faults = f
+	return nil
+}
+
+// Faults returns the configuration db injects faults by, with its seed
+// filled in, and how many it has injected so far
+func (db *Database) Faults() (FaultConfig, FaultCounts) {
+	f := db.faults
+	if f == nil {
+		return FaultConfig{}, FaultCounts{}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.config, f.counts
+}
+
+// draw returns client's next random number in [0, 1). Must be called with
+// f.mu held.
+func (f *faultInjector) draw(client int) float64 {
+	rng, exists := f.rngs[client]
+	if !exists {
+		rng = rand.New(rand.NewSource(f.config.Seed + int64(client)))
+		f.rngs[client] = rng
+	}
+	return rng.Float64()
+}
+
+// delay returns how long client should sleep at point, 0 for not at all
+func (f *faultInjector) delay(client int, point string) time.Duration {
+	if f.config.DelayProbability == 0 || !f.delays[point] {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.draw(client) >= f.config.DelayProbability {
+		return 0
+	}
+	f.counts.Delays++
+	return time.Duration(f.draw(client) * float64(f.config.MaxDelay))
+}
+
+// abort decides whether client's transaction is aborted at this operation
+func (f *faultInjector) abort(client int) bool {
+	if f.config.AbortProbability == 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.draw(client) >= f.config.AbortProbability {
+		return false
+	}
+	f.counts.Aborts++
+	return true
+}
+
+// injectFaults is the fault point before op of tx: it sleeps for any
+// extra delay, then may abort tx as a lost conflict
+func (db *Database) injectFaults(tx *Transaction, op string) {
+	f := db.faults
+	if f == nil {
+		return
+	}
+	if delay := f.delay(tx.ClientID, strings.ToLower(op)); delay > 0 {
+		db.clock.Sleep(delay)
+	}
+	// A prepared transaction has promised to commit
+	if tx.status == TxActive && !tx.Aborted && !tx.prepared && f.abort(tx.ClientID) {
+		tx.conflict = true
+		db.abortWithReason(tx, "injected fault")
+	}
+}
+
+// walFaults is the fault point of tx's commit about to be logged: it
+// sleeps for any extra delay, and reports whether the database crashed
+// before the commit reached the WAL
+func (db *Database) walFaults(tx *Transaction) (crashed bool) {
+	f := db.faults
+	if f == nil {
+		return false
+	}
+	if delay := f.delay(tx.ClientID, "wal"); delay > 0 {
+		db.clock.Sleep(delay)
+	}
+	if f.crashesAt(CrashBeforeWAL) {
+		db.Crash()
+		return true
+	}
+	return false
+}
+
+// crashAfterWAL crashes the database if the commit just logged is the one
+// configured to crash after its WAL append
+func (db *Database) crashAfterWAL() {
+	if db.faults != nil && db.faults.crashesAt(CrashAfterWAL) {
+		db.Crash()
+	}
+}
+
+// crashesAt counts a commit reaching point, before-wal first, and reports
+// whether it is the one configured to crash there
+func (f *faultInjector) crashesAt(point string) bool {
+	if f.config.CrashAtCommit == 0 {
+		return false
+	}
+	configured := f.config.CrashPoint
+	if configured == "" {
+		configured = CrashAfterWAL
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if point == CrashBeforeWAL {
+		f.logged++
+	}
+	if point != configured || f.logged != f.config.CrashAtCommit {
+		return false
+	}
+	f.counts.Crashes++
+	return true
+}
+
+// ClientCrash decides whether client dies during its next transaction of
+// steps operations, and if so before which of them: steps means after
+// the last operation but before committing. It returns -1 if the client
+// survives the transaction.
+func (db *Database) ClientCrash(client int, steps int) int {
+	f := db.faults
+	if f == nil || f.config.ClientCrashProbability == 0 {
+		return -1
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.draw(client) >= f.config.ClientCrashProbability {
+		return -1
+	}
+	f.counts.ClientCrashes++
+	return int(f.draw(client) * float64(steps+1))
+}
+
+// Abandon leaves tx behind as its client dies: nothing runs it any more,
+// and the database aborts it once ClientCrashTimeout has passed, as a
+// server does when a dead connection's session times out. Until then it
+// holds whatever locks it took.
+func (db *Database) Abandon(tx *Transaction) {
+	tx.logOp("CLIENT CRASHED")
+	timeout := time.Duration(db.faults.config.ClientCrashTimeout)
+	if timeout == 0 {
+		db.abortWithReason(tx, "client crashed")
+		return
+	}
+	db.faults.abandoned.Add(1)
+	time.AfterFunc(timeout, func() {
+		defer db.faults.abandoned.Done()
+		db.abortWithReason(tx, "client crashed")
+	})
+}
+
+// AwaitAbandoned waits until every transaction abandoned by a crashed
+// client has been aborted
+func (db *Database) AwaitAbandoned() {
+	if db.faults != nil {
+		db.faults.abandoned.Wait()
+	}
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFaultConfigValidate(t *testing.T) {
+	cases := map[string]FaultConfig{
+		"probability above 1":  {AbortProbability: 1.5},
+		"negative probability": {ClientCrashProbability: -0.1},
+		"delay without max":    {DelayProbability: 0.5},
+		"unknown delay point":  {DelayProbability: 0.5, MaxDelay: Duration(time.Millisecond), DelayPoints: []string{"fsync"}},
+		"unknown crash point":  {CrashAtCommit: 3, CrashPoint: "mid-wal"},
+		"negative crash":       {CrashAtCommit: -1},
+	}
+	for name, config := range cases {
+		if err := NewTwoPhaseLockingDatabase().SetFaults(config); err == nil {
+			t.Errorf("%s: SetFaults accepted %+v", name, config)
+		}
+	}
+	if err := NewTwoPhaseLockingDatabase().SetFaults(FaultConfig{DelayProbability: 1, MaxDelay: Duration(time.Millisecond), DelayPoints: []string{"GET", "wal"}}); err != nil {
+		t.Errorf("valid configuration rejected: %v", err)
+	}
+}
+
+// TestInjectedAbortIsRetryable checks that an injected abort looks like a
+// lost conflict, so RunTransaction retries it
+func TestInjectedAbortIsRetryable(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	if err := db.SetFaults(FaultConfig{Seed: 1, AbortProbability: 1}); err != nil {
+		t.Fatal(err)
+	}
+	tx := db.BeginTransaction()
+	if err := db.Put(tx, "x", 1); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Put under an injected abort: got %v, want ErrConflict", err)
+	}
+	if tx.AbortReason != "injected fault" {
+		t.Errorf("abort reason %q", tx.AbortReason)
+	}
+
+	db.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Microsecond, MaxBackoff: time.Microsecond})
+	err := db.RunTransaction(func(tx *Transaction) error { return db.Put(tx, "x", 1) })
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("RunTransaction: got %v, want the last attempt's ErrConflict", err)
+	}
+	if _, counts := db.Faults(); counts.Aborts != 4 {
+		t.Errorf("injected %d aborts, want 4 (one, then three attempts)", counts.Aborts)
+	}
+}
+
+// TestFaultsRepeatForSeed checks that one client's operations meet the
+// same faults on every run with the same seed
+func TestFaultsRepeatForSeed(t *testing.T) {
+	run := func(seed int64) (FaultCounts, string) {
+		db := NewTwoPhaseLockingDatabase()
+		db.SetFaults(FaultConfig{Seed: seed, DelayProbability: 0.3, MaxDelay: Duration(time.Microsecond), AbortProbability: 0.2})
+		var outcomes strings.Builder
+		ctx := WithClient(context.Background(), 3)
+		for i := 0; i < 40; i++ {
+			tx := db.BeginTransactionCtx(ctx)
+			if db.Upsert(tx, "x", 1, 0) != nil || db.Commit(tx) != nil {
+				outcomes.WriteByte('A')
+			} else {
+				outcomes.WriteByte('C')
+			}
+		}
+		_, counts := db.Faults()
+		return counts, outcomes.String()
+	}
+	counts, outcomes := run(42)
+	if counts.Aborts == 0 || counts.Delays == 0 {
+		t.Fatalf("expected some faults, got %v", counts)
+	}
+	again, outcomesAgain := run(42)
+	if again != counts || outcomesAgain != outcomes {
+		t.Errorf("seed 42 gave %v %s, then %v %s", counts, outcomes, again, outcomesAgain)
+	}
+}
+
+// TestCrashAroundWALAppend crashes the database at its second commit, just
+// before and just after the commit is logged, and checks what recovery
+// finds: the commit is lost only if it never reached the WAL, and either
+// way its client never hears it committed
+func TestCrashAroundWALAppend(t *testing.T) {
+	for point, survives := range map[string]bool{CrashBeforeWAL: false, CrashAfterWAL: true} {
+		t.Run(point, func(t *testing.T) {
+			dir := t.TempDir()
+			db := NewTwoPhaseLockingDatabase()
+			if _, err := db.AttachStorage(dir); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.SetFaults(FaultConfig{CrashAtCommit: 2, CrashPoint: point}); err != nil {
+				t.Fatal(err)
+			}
+			for i, key := range []string{"first", "second"} {
+				tx := db.BeginTransaction()
+				db.Put(tx, key, 1)
+				err := db.Commit(tx)
+				if i == 0 && err != nil {
+					t.Fatalf("first commit: %v", err)
+				}
+				if i == 1 && (err == nil || !strings.Contains(err.Error(), "outcome unknown")) {
+					t.Fatalf("crashed commit: got %v, want an unknown outcome", err)
+				}
+			}
+			if !db.Crashed() {
+				t.Fatal("database did not crash")
+			}
+			db.CloseStorage()
+
+			recovered := NewTwoPhaseLockingDatabase()
+			if _, err := recovered.AttachStorage(dir); err != nil {
+				t.Fatal(err)
+			}
+			defer recovered.CloseStorage()
+			entries := recovered.TakeSnapshot().Entries
+			if _, ok := entries["first"]; !ok {
+				t.Error("acknowledged commit lost")
+			}
+			if _, ok := entries["second"]; ok != survives {
+				t.Errorf("crashed commit recovered: %v, want %v", ok, survives)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Composite records. A composite record is a key holding named integer
+// fields, such as an account's balance and its overdraft limit. Each field
+// is a record of its own, under the key, fieldSep and the field's name,
+// and the key's own record holds the number of fields PutFields wrote, so
+// every engine synchronizes fields as it does keys.
+//
+// How finely depends on the database's field locking. By default a field
+// operation also reads the key's record, or writes it to update a field,
+// so it takes the whole record: under two-phase locking, transactions
+// updating different fields of a record wait for each other, and under
+// MVCC or timestamp ordering one of them aborts. With SetFieldLocking on,
+// UpdateField and GetField touch the field alone, so transactions on
+// different fields of the same record go ahead side by side, and only
+// those on the same field contend. PutFields, GetFields and DeleteFields
+// always take the whole record.
+//
+// Field records are ordinary records to everything else: Scan, the record
+// count, eviction and snapshots see them under their field keys. Only the
+// field operations write them; Put, Add, Upsert and Remove reject a key
+// containing fieldSep with ErrBadKey.
+
+// fieldSep separates a composite record's key from a field's name, so
+// neither may contain it
+const fieldSep = "#"
+
+// ErrBadField means a field's name is empty or contains fieldSep
+var ErrBadField = errors.New("bad field name")
+
+// ErrBadKey means a key written on its own contains fieldSep, so it could
+// not be told apart from a composite record's field
+var ErrBadKey = errors.New("bad key")
+
+// ErrBadRecordKey means a composite record's key contains fieldSep, so its
+// fields could not be told apart from another record's
+var ErrBadRecordKey = errors.New("bad composite record key")
+
+// SetFieldLocking sets whether UpdateField and GetField synchronize on the
+// field alone rather than the whole record. It should be called before the
+// database is shared.
+func (db *Database) SetFieldLocking(enabled bool) {
+	db.fieldLocking = enabled
+}
+
+// fieldKey returns the key of key's field
+func fieldKey(key string, field string) string {
+	return key + fieldSep + field
+}
+
+// checkField rejects field names that could not be told apart from others
+func checkField(field string) error {
+	if field == "" || strings.Contains(field, fieldSep) {
+		return fmt.Errorf("%w: %q", ErrBadField, field)
+	}
+	return nil
+}
+
+// checkKey rejects keys that name a composite record's field, which only
+// the field operations may write, so that a plain write cannot change a
+// field behind its record's back
+func checkKey(key string) error {
+	if strings.Contains(key, fieldSep) {
+		return fmt.Errorf("%w: %q is a field key", ErrBadKey, key)
+	}
+	return nil
+}
+
+// checkRecordKey rejects composite record keys whose fields would share a
+// prefix with another record's: those of a#b start with a's prefix a#
+func checkRecordKey(key string) error {
+	if strings.Contains(key, fieldSep) {
+		return fmt.Errorf("%w: %q", ErrBadRecordKey, key)
+	}
+	return nil
+}
+
+// PutFields sets key to a composite record of fields when tx commits,
+// replacing any fields it had. Fields are written in name order after the
+// key's own record, the order every field operation locks them in.
+func (db *Database) PutFields(tx *Transaction, key string, fields map[string]int) error {
+	if err := checkRecordKey(key); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		if err := checkField(field); err != nil {
+			return err
+		}
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	if err := db.Put(tx, key, len(fields)); err != nil {
+		return err
+	}
+	old, err := db.ScanPrefix(tx, key+fieldSep)
+	if err != nil {
+		return err
+	}
+	for _, stale := range sortedKeys(old) {
+		if _, kept := fields[strings.TrimPrefix(stale, key+fieldSep)]; !kept {
+			if err := db.remove(tx, stale); err != nil {
+				return err
+			}
+		}
+	}
+	for _, field := range names {
+		if err := db.put(tx, fieldKey(key, field), fields[field]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetFields returns key's fields as tx sees them
+func (db *Database) GetFields(tx *Transaction, key string) (map[string]int, error) {
+	if err := checkRecordKey(key); err != nil {
+		return nil, err
+	}
+	if _, err := db.Get(tx, key); err != nil {
+		return nil, err
+	}
+	rows, err := db.ScanPrefix(tx, key+fieldSep)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]int, len(rows))
+	for k, value := range rows {
+		fields[strings.TrimPrefix(k, key+fieldSep)] = value
+	}
+	return fields, nil
+}
+
+// GetField returns one of key's fields as tx sees it, failing with
+// ErrKeyNotFound if the record or the field does not exist
+func (db *Database) GetField(tx *Transaction, key string, field string) (int, error) {
+	if err := checkRecordKey(key); err != nil {
+		return 0, err
+	}
+	if err := checkField(field); err != nil {
+		return 0, err
+	}
+	if !db.fieldLocking {
+		if _, err := db.Get(tx, key); err != nil {
+			return 0, err
+		}
+	}
+	return db.Get(tx, fieldKey(key, field))
+}
+
+// UpdateField adds delta to one of key's fields when tx commits, failing
+// with ErrKeyNotFound if the record or the field does not exist. Without
+// field locking, it writes the key's own record too, unchanged, to take the
+// whole record.
+func (db *Database) UpdateField(tx *Transaction, key string, field string, delta int) error {
+	if err := checkRecordKey(key); err != nil {
+		return err
+	}
+	if err := checkField(field); err != nil {
+		return err
+	}
+	// Each key is read before it is added to, so a database that upserts on
+	// update adds neither a record nor a field
+	if !db.fieldLocking {
+		if _, err := db.Get(tx, key); err != nil {
+			return err
+		}
+		if err := db.Add(tx, key, 0); err != nil {
+			return err
+		}
+	}
+	if _, err := db.Get(tx, fieldKey(key, field)); err != nil {
+		return err
+	}
+	return db.add(tx, fieldKey(key, field), delta)
+}
+
+// DeleteFields deletes key's composite record and all its fields when tx
+// commits
+func (db *Database) DeleteFields(tx *Transaction, key string) error {
+	if err := checkRecordKey(key); err != nil {
+		return err
+	}
+	if err := db.Remove(tx, key); err != nil {
+		return err
+	}
+	rows, err := db.ScanPrefix(tx, key+fieldSep)
+	if err != nil {
+		return err
+	}
+	for _, k := range sortedKeys(rows) {
+		if err := db.remove(tx, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of rows, in order
+func sortedKeys(rows map[string]int) []string {
+	keys := make([]string, 0, len(rows))
+	for key := range rows {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
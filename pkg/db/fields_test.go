@@ -0,0 +1,171 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestCompositeRecordFields puts, reads, updates, replaces and deletes a
+// composite record
+func TestCompositeRecordFields(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	tx := db.BeginTransaction()
+	if err := db.PutFields(tx, "acct", map[string]int{"balance": 100, "limit": 50}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutFields(tx, "acct", map[string]int{"a#b": 1}); !errors.Is(err, ErrBadField) {
+		t.Errorf("PutFields with a separator in a field name: %v, want ErrBadField", err)
+	}
+	if err := db.PutFields(tx, "acct#b", map[string]int{"balance": 1}); !errors.Is(err, ErrBadRecordKey) {
+		t.Errorf("PutFields with a separator in the key: %v, want ErrBadRecordKey", err)
+	}
+	db.Commit(tx)
+
+	tx = db.BeginTransaction()
+	if err := db.UpdateField(tx, "acct", "balance", -30); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateField(tx, "acct", "missing", 1); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("UpdateField of a missing field: %v, want ErrKeyNotFound", err)
+	}
+	if value, _ := db.GetField(tx, "acct", "balance"); value != 70 {
+		t.Errorf("balance = %d in the updating transaction, want 70", value)
+	}
+	db.Commit(tx)
+
+	tx = db.BeginTransaction()
+	fields, err := db.GetFields(tx, "acct")
+	if want := map[string]int{"balance": 70, "limit": 50}; err != nil || !reflect.DeepEqual(fields, want) {
+		t.Errorf("GetFields = %v, %v, want %v", fields, err, want)
+	}
+	db.PutFields(tx, "acct", map[string]int{"balance": 1})
+	db.Commit(tx)
+
+	tx = db.BeginTransaction()
+	if fields, _ := db.GetFields(tx, "acct"); !reflect.DeepEqual(fields, map[string]int{"balance": 1}) {
+		t.Errorf("GetFields = %v after a replacing PutFields, want balance alone", fields)
+	}
+	if err := db.DeleteFields(tx, "acct"); err != nil {
+		t.Fatal(err)
+	}
+	db.Commit(tx)
+
+	tx = db.BeginTransaction()
+	defer db.Commit(tx)
+	if _, err := db.GetFields(tx, "acct"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("GetFields after DeleteFields: %v, want ErrKeyNotFound", err)
+	}
+	if count := db.GetRecordCount(); count != 0 {
+		t.Errorf("%d live keys after DeleteFields, want 0", count)
+	}
+}
+
+// TestPlainWritesRejectFieldKeys verifies a field can't be written, added
+// to or deleted as a plain key, behind its record's back
+func TestPlainWritesRejectFieldKeys(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	tx := db.BeginTransaction()
+	db.PutFields(tx, "acct", map[string]int{"balance": 100})
+	db.Commit(tx)
+
+	tx = db.BeginTransaction()
+	for name, err := range map[string]error{
+		"Put":        db.Put(tx, "acct#balance", -1),
+		"Add":        db.Add(tx, "acct#balance", -1),
+		"Upsert":     db.Upsert(tx, "acct#balance", -1, 0),
+		"Remove":     db.Remove(tx, "acct#balance"),
+		"PutWithTTL": db.PutWithTTL(tx, "acct#balance", -1, time.Minute),
+	} {
+		if !errors.Is(err, ErrBadKey) {
+			t.Errorf("%s of a field key: %v, want ErrBadKey", name, err)
+		}
+	}
+	if tx.Aborted {
+		t.Errorf("A rejected field key aborted the transaction")
+	}
+	if balance, _ := db.GetField(tx, "acct", "balance"); balance != 100 {
+		t.Errorf("balance = %d, want the 100 the field operations wrote", balance)
+	}
+	db.Commit(tx)
+}
+
+// TestFieldLockingGranularity verifies transactions updating different
+// fields of one record contend without field locking, waiting under
+// two-phase locking and aborting under MVCC, and go ahead side by side
+// with it
+func TestFieldLockingGranularity(t *testing.T) {
+	for _, engine := range []string{"2pl", "mvcc"} {
+		for _, fieldLocking := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/field-locking=%v", engine, fieldLocking), func(t *testing.T) {
+				db, _ := OpenDatabase(engine)
+				db.SetProcessingDelays(NoProcessingDelays)
+				db.SetLockTimeout(10 * time.Millisecond)
+				db.SetFieldLocking(fieldLocking)
+				setup := db.BeginTransaction()
+				db.PutFields(setup, "acct", map[string]int{"balance": 100, "limit": 50})
+				db.Commit(setup)
+
+				first, second := db.BeginTransaction(), db.BeginTransaction()
+				if err := db.UpdateField(first, "acct", "balance", 1); err != nil {
+					t.Fatal(err)
+				}
+				err := db.UpdateField(second, "acct", "limit", 1)
+				if err := db.Commit(first); err != nil {
+					t.Fatal(err)
+				}
+				if err == nil {
+					err = db.Commit(second)
+				} else {
+					db.Abort(second)
+				}
+				if fieldLocking && err != nil {
+					t.Errorf("Updating another field failed: %v", err)
+				}
+				if !fieldLocking && err == nil {
+					t.Errorf("Updating another field of the record went ahead without field locking")
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkFieldUpdates has every goroutine update its own field of one
+// record, with and without field locking
+func BenchmarkFieldUpdates(b *testing.B) {
+	const numFields = 8
+	fields := make(map[string]int, numFields)
+	for i := 0; i < numFields; i++ {
+		fields[fmt.Sprintf("f%d", i)] = 0
+	}
+	for _, engine := range []string{"2pl", "mvcc"} {
+		for _, fieldLocking := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/field-locking=%v", engine, fieldLocking), func(b *testing.B) {
+				db, _ := OpenDatabase(engine)
+				db.SetProcessingDelays(NoProcessingDelays)
+				db.SetOpLogLimit(0)
+				db.SetFieldLocking(fieldLocking)
+				setup := db.BeginTransaction()
+				db.PutFields(setup, "record", fields)
+				db.Commit(setup)
+				var next atomic.Int32
+
+				b.SetParallelism(numFields / 2)
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					field := fmt.Sprintf("f%d", int(next.Add(1)-1)%numFields)
+					for pb.Next() {
+						db.RunTransaction(func(tx *Transaction) error {
+							return db.UpdateField(tx, "record", field, 1)
+						})
+					}
+				})
+				b.StopTimer()
+				b.ReportMetric(float64(db.Stats().TransactionRetries)/float64(b.N), "retries/op")
+			})
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Goroutine leaks. Everything a scenario or a test starts should have
+// returned by the time it ends; the scenario runner in pkg/sim and the
+// tests take the running goroutines before and compare them afterwards.
+
+// ignoredGoroutines are functions whose goroutines the runtime starts on
+// first use and keeps, which are not anyone's leak
+var ignoredGoroutines = []string{
+	"os/signal.signal_recv",
+	"os/signal.loop",
+	"runtime.ensureSigM",
+	"runtime/trace.",
+	"testing.(*F).Fuzz",
+}
+
+// RunningGoroutines returns the stack of every goroutine, by ID
+func RunningGoroutines() map[int]string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	stacks := make(map[int]string)
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		// Each starts "goroutine 12 [chan receive]:"
+		header, _, _ := strings.Cut(string(stack), "\n")
+		fields := strings.Fields(header)
+		if len(fields) < 2 || fields[0] != "goroutine" {
+			continue
+		}
+		if id, err := strconv.Atoi(fields[1]); err == nil {
+			stacks[id] = string(stack)
+		}
+	}
+	return stacks
+}
+
+// LeakedGoroutines waits up to grace for the goroutines started since
+// before was taken to exit, and returns the stacks of those that did not,
+// oldest first
+func LeakedGoroutines(before map[int]string, grace time.Duration) []string {
+	deadline := time.Now().Add(grace)
+	for {
+		var ids []int
+		stacks := RunningGoroutines()
+		for id, stack := range stacks {
+			if _, existed := before[id]; !existed && !ignoredGoroutine(stack) {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 || time.Now().After(deadline) {
+			sort.Ints(ids)
+			leaked := make([]string, len(ids))
+			for i, id := range ids {
+				leaked[i] = stacks[id]
+			}
+			return leaked
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// ignoredGoroutine reports whether stack is of a goroutine that is not a
+// leak, the goroutine taking the stacks among them
+func ignoredGoroutine(stack string) bool {
+	if strings.Contains(stack, "db.RunningGoroutines(") {
+		return true
+	}
+	for _, function := range ignoredGoroutines {
+		if strings.Contains(stack, function) {
+			return true
+		}
+	}
+	return false
+}
+
+// GoroutineSummary is a leaked goroutine in one line: its state and the
+// function it is blocked in
+func GoroutineSummary(stack string) string {
+	lines := strings.Split(stack, "\n")
+	header := strings.TrimSuffix(lines[0], ":")
+	if len(lines) < 2 {
+		return header
+	}
+	// Skip the runtime frames the goroutine is parked in
+	for i := 1; i < len(lines); i += 2 {
+		function := lines[i]
+		if !strings.HasPrefix(function, "runtime.") && !strings.HasPrefix(function, "sync.") &&
+			!strings.HasPrefix(function, "internal/") {
+			if i+1 < len(lines) {
+				function += " at " + strings.TrimSpace(lines[i+1])
+			}
+			return fmt.Sprintf("%s in %s", header, function)
+		}
+	}
+	return header + " in " + lines[1]
+}
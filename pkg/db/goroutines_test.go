@@ -0,0 +1,25 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// leakGrace is how long goroutines the tests started get to exit
+const leakGrace = 2 * time.Second
+
+// TestMain fails the run if any test left a goroutine running
+func TestMain(m *testing.M) {
+	before := RunningGoroutines()
+	code := m.Run()
+	if code == 0 {
+		if leaked := LeakedGoroutines(before, leakGrace); len(leaked) > 0 {
+			fmt.Fprintf(os.Stderr, "%d goroutines outlived the tests:\n\n%s\n", len(leaked), strings.Join(leaked, "\n\n"))
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"time"
+)
+
+// Every record keeps an audit trail: the transaction that created it and
+// its last few modifications, each with the transaction that made it, the
+// value it replaced and when. db.History returns it for post-mortems: when
+// a value is wrong, the trail shows which transaction wrote it and from
+// what. The trail is kept for the last DefaultHistoryDepth modifications
+// unless SetHistoryDepth changes it.
+
+// DefaultHistoryDepth is how many modifications each record remembers
+const DefaultHistoryDepth = 16
+
+// Modification is one committed change to a key
+type Modification struct {
+	TxID     int // Committing transaction; 0 when the key expired
+	Version  int // Record version the change produced
+	OldValue int // Value before the change; 0 when the key did not exist
+	Value    int // Value after the change; 0 when Deleted
+	Deleted  bool
+	At       time.Time
+}
+
+// KeyHistory is a key's audit trail
+type KeyHistory struct {
+	Key       string
+	CreatedBy int            // Transaction that created the key, or recreated it after a delete
+	Dropped   int            // Earlier modifications no longer kept
+	Changes   []Modification // Oldest first
+}
+
+// SetHistoryDepth sets how many modifications each record keeps; 0 stops
+// keeping any. Records with longer trails are cut down at their next
+// change.
+func (db *Database) SetHistoryDepth(depth int) {
+	db.wLock()
+	defer db.wUnlock()
+	db.historyDepth = max(depth, 0)
+}
+
+// History returns key's audit trail, if the key has a record (a tombstone
+// counts until it is collected)
+func (db *Database) History(key string) (KeyHistory, bool) {
+	db.rLockKey(key)
+	defer db.rUnlockKey(key)
+
+	record, exists := db.records.get(key)
+	if !exists {
+		return KeyHistory{Key: key}, false
+	}
+	return KeyHistory{
+		Key:       key,
+		CreatedBy: record.CreatedBy,
+		Dropped:   record.Version - len(record.history),
+		Changes:   append([]Modification(nil), record.history...),
+	}, true
+}
+
+// recordChange appends change to record's trail. The trail is replaced,
+// never changed in place, because snapshot views share it. Must be called
+// with the write lock held.
+func (db *Database) recordChange(record *Record, change Modification) {
+	if db.historyDepth == 0 {
+		record.history = nil
+		return
+	}
+	keep := min(len(record.history), db.historyDepth-1)
+	trail := make([]Modification, 0, keep+1)
+	trail = append(trail, record.history[len(record.history)-keep:]...)
+	record.history = append(trail, change)
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// TestHistoryRecordsChanges verifies the trail names the creating and
+// modifying transactions with the values they replaced, and skips aborts
+func TestHistoryRecordsChanges(t *testing.T) {
+	for name, newDB := range atomicEngines {
+		t.Run(name, func(t *testing.T) {
+			db := newDB()
+			create := db.BeginTransaction()
+			db.Put(create, "key", 1)
+			db.Commit(create)
+
+			aborted := db.BeginTransaction()
+			db.Put(aborted, "key", 100)
+			db.Abort(aborted)
+
+			update := db.BeginTransaction()
+			db.Add(update, "key", 4)
+			db.Commit(update)
+			remove := db.BeginTransaction()
+			db.Remove(remove, "key")
+			db.Commit(remove)
+
+			history, ok := db.History("key")
+			if !ok {
+				t.Fatal("History found no record")
+			}
+			if history.CreatedBy != create.ID {
+				t.Errorf("CreatedBy = %d, want %d", history.CreatedBy, create.ID)
+			}
+			want := []Modification{
+				{TxID: create.ID, Version: 1, Value: 1},
+				{TxID: update.ID, Version: 2, OldValue: 1, Value: 5},
+				{TxID: remove.ID, Version: 3, OldValue: 5, Deleted: true},
+			}
+			if len(history.Changes) != len(want) {
+				t.Fatalf("History has %d changes, want %d: %+v", len(history.Changes), len(want), history.Changes)
+			}
+			for i, change := range history.Changes {
+				change.At = time.Time{}
+				if change != want[i] {
+					t.Errorf("Change %d = %+v, want %+v", i, change, want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestHistoryDepth verifies the trail keeps only the last changes and
+// counts the ones it dropped
+func TestHistoryDepth(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetHistoryDepth(3)
+	for i := 1; i <= 10; i++ {
+		tx := db.BeginTransaction()
+		db.Put(tx, "key", i)
+		db.Commit(tx)
+	}
+
+	history, _ := db.History("key")
+	if len(history.Changes) != 3 || history.Dropped != 7 {
+		t.Fatalf("History kept %d and dropped %d, want 3 and 7", len(history.Changes), history.Dropped)
+	}
+	if first := history.Changes[0]; first.OldValue != 7 || first.Value != 8 {
+		t.Errorf("Oldest kept change = %+v, want 7 -> 8", first)
+	}
+
+	db.SetHistoryDepth(0)
+	tx := db.BeginTransaction()
+	db.Put(tx, "key", 11)
+	db.Commit(tx)
+	if history, _ := db.History("key"); len(history.Changes) != 0 {
+		t.Errorf("History with depth 0 kept %d changes", len(history.Changes))
+	}
+}
+
+// TestHistoryInViewIsStable verifies a snapshot view's record is not
+// changed by later history
+func TestHistoryInViewIsStable(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetHistoryDepth(2)
+	tx := db.BeginTransaction()
+	db.Put(tx, "key", 1)
+	db.Commit(tx)
+	view := db.Snapshot()
+	before, _ := view.Record("key")
+
+	for i := 2; i <= 5; i++ {
+		tx := db.BeginTransaction()
+		db.Put(tx, "key", i)
+		db.Commit(tx)
+	}
+	after, _ := view.Record("key")
+	if len(after.history) != 1 || after.history[0] != before.history[0] {
+		t.Errorf("View history changed from %+v to %+v", before.history, after.history)
+	}
+}
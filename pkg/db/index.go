@@ -0,0 +1,189 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// A secondary index maps values back to the keys that hold them, so keys
+// can be found by value range without scanning every record. Indexes are
+// updated while a commit installs its writes, under the same exclusive
+// database lock, so a query never sees a write in the records but not in
+// the index or the other way round. Deleted keys leave the index when they
+// are deleted; expired keys stay in it until the expiry sweeper tombstones
+// them, but queries skip them.
+
+var (
+	// ErrIndexNotFound means no index has the given name
+	ErrIndexNotFound = errors.New("index not found")
+
+	// ErrIndexExists means CreateIndex was given a name already in use
+	ErrIndexExists = errors.New("index already exists")
+)
+
+// valueIndex maps every live key to its value and back. Guarded by the
+// database lock.
+type valueIndex struct {
+	values map[string]int              // Indexed value of each key
+	keys   map[int]map[string]struct{} // Keys holding each value
+	sorted []int                       // Distinct indexed values, ascending
+}
+
+// IndexEntry is a key found by an index query, with its value
+type IndexEntry struct {
+	Key   string
+	Value int
+}
+
+func newValueIndex() *valueIndex {
+	return &valueIndex{
+		values: make(map[string]int),
+		keys:   make(map[int]map[string]struct{}),
+	}
+}
+
+// set indexes key under value, moving it from its old value if it had one
+func (ix *valueIndex) set(key string, value int) {
+	if old, ok := ix.values[key]; ok {
+		if old == value {
+			return
+		}
+		ix.remove(key)
+	}
+	ix.values[key] = value
+	keys, ok := ix.keys[value]
+	if !ok {
+		keys = make(map[string]struct{})
+		ix.keys[value] = keys
+		i := sort.SearchInts(ix.sorted, value)
+		ix.sorted = append(ix.sorted, 0)
+		copy(ix.sorted[i+1:], ix.sorted[i:])
+		ix.sorted[i] = value
+	}
+	keys[key] = struct{}{}
+}
+
+// remove drops key from the index
+func (ix *valueIndex) remove(key string) {
+	value, ok := ix.values[key]
+	if !ok {
+		return
+	}
+	delete(ix.values, key)
+	keys := ix.keys[value]
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(ix.keys, value)
+		i := sort.SearchInts(ix.sorted, value)
+		ix.sorted = append(ix.sorted[:i], ix.sorted[i+1:]...)
+	}
+}
+
+// CreateIndex creates an index of every key by value, called name, and
+// fills it from the current records
+func (db *Database) CreateIndex(name string) error {
+	db.wLock()
+	defer db.wUnlock()
+
+	if _, exists := db.indexes[name]; exists {
+		return fmt.Errorf("%w: %s", ErrIndexExists, name)
+	}
+	if db.indexes == nil {
+		db.indexes = make(map[string]*valueIndex)
+	}
+	ix := newValueIndex()
+	db.records.each(func(key string, record *Record) {
+		if !record.Deleted {
+			ix.set(key, record.Value)
+		}
+	})
+	db.indexes[name] = ix
+	return nil
+}
+
+// DropIndex removes the index called name
+func (db *Database) DropIndex(name string) error {
+	db.wLock()
+	defer db.wUnlock()
+
+	if _, exists := db.indexes[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrIndexNotFound, name)
+	}
+	delete(db.indexes, name)
+	return nil
+}
+
+// updateIndexes brings every index up to date with the records of keys.
+// Must be called with the write lock held, after changing the records.
+func (db *Database) updateIndexes(keys []string) {
+	for _, ix := range db.indexes {
+		for _, key := range keys {
+			if record, exists := db.records.get(key); exists && !record.Deleted {
+				ix.set(key, record.Value)
+			} else {
+				ix.remove(key)
+			}
+		}
+	}
+}
+
+// QueryIndex returns the live keys whose committed value is between lo and
+// hi inclusive, ordered by value and then key. It reads the latest
+// committed state, not a transaction's snapshot, and takes no key locks.
+func (db *Database) QueryIndex(name string, lo, hi int) ([]IndexEntry, error) {
+	db.rLock()
+	defer db.rUnlock()
+
+	ix, exists := db.indexes[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrIndexNotFound, name)
+	}
+	entries := make([]IndexEntry, 0)
+	now := db.clock.Now()
+	for i := sort.SearchInts(ix.sorted, lo); i < len(ix.sorted) && ix.sorted[i] <= hi; i++ {
+		value := ix.sorted[i]
+		start := len(entries)
+		for key := range ix.keys[value] {
+			if record, _ := db.records.get(key); record.live(now) {
+				entries = append(entries, IndexEntry{Key: key, Value: value})
+			}
+		}
+		sort.Slice(entries[start:], func(a, b int) bool { return entries[start+a].Key < entries[start+b].Key })
+	}
+	return entries, nil
+}
+
+// VerifyIndex checks the index called name against the records and
+// returns a description of every difference
+func (db *Database) VerifyIndex(name string) ([]string, error) {
+	db.rLock()
+	defer db.rUnlock()
+
+	ix, exists := db.indexes[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrIndexNotFound, name)
+	}
+	problems := make([]string, 0)
+	db.records.each(func(key string, record *Record) {
+		value, indexed := ix.values[key]
+		switch {
+		case record.Deleted && indexed:
+			problems = append(problems, fmt.Sprintf("%s is deleted but indexed under %d", key, value))
+		case !record.Deleted && !indexed:
+			problems = append(problems, fmt.Sprintf("%s = %d is not indexed", key, record.Value))
+		case !record.Deleted && value != record.Value:
+			problems = append(problems, fmt.Sprintf("%s = %d is indexed under %d", key, record.Value, value))
+		}
+	})
+	for key, value := range ix.values {
+		if _, exists := db.records.get(key); !exists {
+			problems = append(problems, fmt.Sprintf("%s is indexed under %d but does not exist", key, value))
+		}
+		if _, ok := ix.keys[value][key]; !ok {
+			problems = append(problems, fmt.Sprintf("%s is missing from the keys of %d", key, value))
+		}
+	}
+	sort.Strings(problems)
+	return problems, nil
+}
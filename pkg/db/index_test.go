@@ -0,0 +1,86 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestIndexQueryRange verifies a query returns the keys in the value range
+// in value order, and follows later updates and deletes
+func TestIndexQueryRange(t *testing.T) {
+	for name, newDB := range atomicEngines {
+		t.Run(name, func(t *testing.T) {
+			db := newDB()
+			tx := db.BeginTransaction()
+			db.Put(tx, "a", 5)
+			db.Put(tx, "b", 1)
+			db.Put(tx, "c", 5)
+			db.Put(tx, "d", 9)
+			db.Commit(tx)
+			if err := db.CreateIndex("by_value"); err != nil {
+				t.Fatalf("CreateIndex: %v", err)
+			}
+
+			entries, _ := db.QueryIndex("by_value", 1, 5)
+			if got := fmt.Sprint(entries); got != "[{b 1} {a 5} {c 5}]" {
+				t.Errorf("Query [1,5] = %s, want [{b 1} {a 5} {c 5}]", got)
+			}
+
+			tx = db.BeginTransaction()
+			db.Put(tx, "a", 7)
+			db.Remove(tx, "b")
+			db.Add(tx, "d", -6)
+			db.Commit(tx)
+			entries, _ = db.QueryIndex("by_value", 0, 10)
+			if got := fmt.Sprint(entries); got != "[{d 3} {c 5} {a 7}]" {
+				t.Errorf("Query after updates = %s, want [{d 3} {c 5} {a 7}]", got)
+			}
+			if problems, _ := db.VerifyIndex("by_value"); len(problems) > 0 {
+				t.Errorf("Index out of step: %v", problems)
+			}
+		})
+	}
+}
+
+// TestIndexIgnoresAbortedAndExpired verifies aborted writes never reach
+// the index and expired keys are skipped by queries
+func TestIndexIgnoresAbortedAndExpired(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.CreateIndex("by_value")
+
+	tx := db.BeginTransaction()
+	db.Put(tx, "aborted", 1)
+	db.Abort(tx)
+	tx = db.BeginTransaction()
+	db.PutWithTTL(tx, "session", 1, time.Millisecond)
+	db.Put(tx, "kept", 1)
+	db.Commit(tx)
+
+	time.Sleep(5 * time.Millisecond)
+	entries, _ := db.QueryIndex("by_value", 1, 1)
+	if got := fmt.Sprint(entries); got != "[{kept 1}]" {
+		t.Errorf("Query = %s, want [{kept 1}]", got)
+	}
+	db.ExpireKeys()
+	if problems, _ := db.VerifyIndex("by_value"); len(problems) > 0 {
+		t.Errorf("Index out of step after expiry: %v", problems)
+	}
+}
+
+// TestIndexErrors verifies duplicate and unknown index names are reported
+func TestIndexErrors(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.CreateIndex("by_value")
+	if err := db.CreateIndex("by_value"); !errors.Is(err, ErrIndexExists) {
+		t.Errorf("Duplicate CreateIndex = %v, want ErrIndexExists", err)
+	}
+	if _, err := db.QueryIndex("missing", 0, 1); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Query of a missing index = %v, want ErrIndexNotFound", err)
+	}
+	db.DropIndex("by_value")
+	if err := db.DropIndex("by_value"); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Second DropIndex = %v, want ErrIndexNotFound", err)
+	}
+}
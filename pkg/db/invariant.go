@@ -0,0 +1,175 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Invariants. A scenario's final check only sees the state the run ended
+// in; an invariant registered with AddInvariant is checked after every
+// commit, under the lock the commit installs its writes with, so it sees
+// each state the committed transactions leave in turn, never one halfway
+// through a commit. Every commit leaving an invariant broken is recorded
+// with its transaction and the transactions that last wrote the
+// invariant's keys, which between them made the values that do not add
+// up. Only invariants on a key the commit wrote are checked.
+//
+// Validators, by contrast, check single writes before they are applied,
+// and reject them.
+
+// An Invariant is a condition on committed values that must hold after
+// every commit, such as account_A + account_B == 2000
+type Invariant struct {
+	Name string   // The condition, as it is reported
+	Keys []string // The keys it reads
+	// Check returns an error describing how values, those of the live
+	// keys among Keys, break the invariant, or nil if they do not
+	Check func(values map[string]int) error
+}
+
+// SumInvariant requires the values of keys to add up to total, as the
+// balances of accounts transferring money between them do
+func SumInvariant(total int, keys ...string) Invariant {
+	return Invariant{
+		Name: fmt.Sprintf("%s == %d", strings.Join(keys, " + "), total),
+		Keys: keys,
+		Check: func(values map[string]int) error {
+			sum := 0
+			for _, key := range keys {
+				sum += values[key]
+			}
+			if sum != total {
+				return fmt.Errorf("sum is %d", sum)
+			}
+			return nil
+		},
+	}
+}
+
+// EqualInvariant requires keys to hold the same value, as keys always
+// written together do
+func EqualInvariant(keys ...string) Invariant {
+	return Invariant{
+		Name: strings.Join(keys, " == "),
+		Keys: keys,
+		Check: func(values map[string]int) error {
+			for _, key := range keys[1:] {
+				if values[key] != values[keys[0]] {
+					return fmt.Errorf("%s = %d but %s = %d", keys[0], values[keys[0]], key, values[key])
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// Violation is a broken invariant a scenario found
+type Violation struct {
+	Invariant string // What should have held, such as "x == y"
+	Detail    string // How it did not
+}
+
+func (v Violation) String() string {
+	return v.Invariant + ": " + v.Detail
+}
+
+// InvariantViolation is a commit that left an invariant broken
+type InvariantViolation struct {
+	Violation
+	TxID    int   // The transaction whose commit left it broken
+	Writers []int // The transactions that last wrote each of the invariant's keys, 0 if none
+	At      time.Time
+}
+
+func (v InvariantViolation) String() string {
+	return fmt.Sprintf("%v (after tx %d; last writers %v)", v.Violation, v.TxID, v.Writers)
+}
+
+// maxInvariantViolations is how many violations a database keeps; later
+// ones are only counted
+const maxInvariantViolations = 1000
+
+// invariantChecker holds a database's invariants and the violations found.
+// It has its own mutex, even when unsynchronized, so that recording
+// violations cannot crash the program.
+type invariantChecker struct {
+	invariants []Invariant
+	byKey      map[string][]int // Key -> indexes of the invariants reading it
+
+	mu         sync.Mutex
+	violations []InvariantViolation
+	count      int
+}
+
+// AddInvariant registers an invariant to check after every commit that
+// writes one of its keys. Invariants should be registered before the
+// database is shared.
+func (db *Database) AddInvariant(inv Invariant) {
+	c := &db.invariants
+	if c.byKey == nil {
+		c.byKey = make(map[string][]int)
+	}
+	for _, key := range inv.Keys {
+		c.byKey[key] = append(c.byKey[key], len(c.invariants))
+	}
+	c.invariants = append(c.invariants, inv)
+}
+
+// InvariantCount returns how many invariants are registered
+func (db *Database) InvariantCount() int {
+	return len(db.invariants.invariants)
+}
+
+// InvariantViolations returns the violations found so far, oldest first,
+// and how many there were in all, including those no longer kept
+func (db *Database) InvariantViolations() ([]InvariantViolation, int) {
+	c := &db.invariants
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]InvariantViolation(nil), c.violations...), c.count
+}
+
+// checkInvariants checks every invariant on a key tx wrote against the
+// records tx's commit left. Must be called with the write lock held.
+func (db *Database) checkInvariants(tx *Transaction) {
+	c := &db.invariants
+	if len(c.invariants) == 0 {
+		return
+	}
+	checked := make(map[int]bool)
+	now := db.clock.Now()
+	for _, key := range tx.writeOrder {
+		for _, i := range c.byKey[key] {
+			if checked[i] {
+				continue
+			}
+			checked[i] = true
+			inv := c.invariants[i]
+			values := make(map[string]int, len(inv.Keys))
+			writers := make([]int, len(inv.Keys))
+			for j, k := range inv.Keys {
+				if record, exists := db.records.get(k); exists {
+					writers[j] = record.WrittenBy
+					if record.live(now) {
+						values[k] = record.Value
+					}
+				}
+			}
+			if err := inv.Check(values); err != nil {
+				c.record(InvariantViolation{Violation: Violation{inv.Name, err.Error()}, TxID: tx.ID, Writers: writers, At: now})
+			}
+		}
+	}
+}
+
+// record keeps v, unless maxInvariantViolations are kept already
+func (c *invariantChecker) record(v InvariantViolation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count++
+	if len(c.violations) < maxInvariantViolations {
+		c.violations = append(c.violations, v)
+	}
+}
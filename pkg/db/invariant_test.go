@@ -0,0 +1,35 @@
+package db
+
+import (
+	"testing"
+)
+
+// TestInvariantCheckedAfterCommit verifies a commit leaving an invariant
+// broken is recorded with its transaction, and one restoring it is not
+func TestInvariantCheckedAfterCommit(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	setup := db.BeginTransaction()
+	db.Write(setup, "a", 1000)
+	db.Write(setup, "b", 1000)
+	db.Commit(setup)
+	db.AddInvariant(SumInvariant(2000, "a", "b"))
+
+	broken := db.BeginTransaction()
+	db.Write(broken, "a", 900)
+	db.Commit(broken)
+	restored := db.BeginTransaction()
+	db.Write(restored, "b", 1100)
+	db.Commit(restored)
+	other := db.BeginTransaction()
+	db.Write(other, "c", -1) // No invariant reads c
+	db.Commit(other)
+
+	violations, count := db.InvariantViolations()
+	if count != 1 || len(violations) != 1 {
+		t.Fatalf("%d violations %v, expected the one commit taking 100 from a", count, violations)
+	}
+	v := violations[0]
+	if v.TxID != broken.ID || v.Writers[0] != broken.ID || v.Writers[1] != setup.ID || v.Invariant != "a + b == 2000" {
+		t.Errorf("violation %v, expected tx %d with writers [%d %d]", v, broken.ID, broken.ID, setup.ID)
+	}
+}
@@ -0,0 +1,238 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// IsolationLevel is how much of other transactions' work a transaction
+// may observe, from weakest to strongest
+type IsolationLevel int
+
+const (
+	// ReadUncommitted reads without locks. It would see uncommitted writes,
+	// but every engine here buffers writes until commit.
+	ReadUncommitted IsolationLevel = iota
+	// ReadCommitted only sees committed data, but a key read twice may
+	// have changed in between
+	ReadCommitted
+	// RepeatableRead keeps every key it read unchanged until it finishes,
+	// but a scan repeated later may find newly inserted keys (phantoms)
+	RepeatableRead
+	// Serializable also locks the ranges it scans, so no phantoms appear
+	Serializable
+)
+
+func (l IsolationLevel) String() string {
+	switch l {
+	case ReadUncommitted:
+		return "ReadUncommitted"
+	case ReadCommitted:
+		return "ReadCommitted"
+	case RepeatableRead:
+		return "RepeatableRead"
+	case Serializable:
+		return "Serializable"
+	default:
+		return fmt.Sprintf("IsolationLevel(%d)", int(l))
+	}
+}
+
+// ParseIsolationLevel returns the level named name, as String spells it,
+// in any case
+func ParseIsolationLevel(name string) (IsolationLevel, error) {
+	for level := ReadUncommitted; level <= Serializable; level++ {
+		if strings.EqualFold(name, level.String()) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown isolation level %q", name)
+}
+
+// ErrIsolationUnsupported means an engine was asked for an isolation
+// level stronger than it can enforce
+var ErrIsolationUnsupported = errors.New("isolation level not supported by the engine")
+
+// DefaultIsolation is the level BeginTransaction uses: Serializable under
+// two-phase locking, RepeatableRead under timestamp ordering and under
+// MVCC (snapshot isolation), and ReadUncommitted on engines without
+// transaction isolation
+func (db *Database) DefaultIsolation() IsolationLevel {
+	if db.mvcc != nil {
+		return RepeatableRead
+	}
+	return db.MaxIsolation()
+}
+
+// MaxIsolation is the strongest level the engine enforces: Serializable
+// under two-phase locking and MVCC (with SSI), RepeatableRead under
+// timestamp ordering, whose scans do not prevent phantoms, and
+// ReadUncommitted on engines without transaction isolation. A transaction
+// begun at a stronger level runs at this one, and its Isolation says so.
+func (db *Database) MaxIsolation() IsolationLevel {
+	switch {
+	case db.locks != nil, db.mvcc != nil:
+		return Serializable
+	case db.tso != nil:
+		return RepeatableRead
+	default:
+		return ReadUncommitted
+	}
+}
+
+// CheckIsolation returns ErrIsolationUnsupported if the engine cannot
+// enforce level, for callers that would rather refuse to run than run at
+// a weaker level
+func (db *Database) CheckIsolation(level IsolationLevel) error {
+	if max := db.MaxIsolation(); level > max {
+		return fmt.Errorf("%w: %s offers at most %s, not %s", ErrIsolationUnsupported, db.EngineName(), max, level)
+	}
+	return nil
+}
+
+// Under two-phase locking the levels differ in how reads are locked:
+// ReadUncommitted takes no read locks, ReadCommitted holds a read lock only
+// for the duration of the read, RepeatableRead holds it until the
+// transaction ends and Serializable adds range locks for scans. Writes
+// always hold their key lock until the end, so no level sees dirty writes.
+// Since writes are buffered until commit, ReadUncommitted cannot read
+// uncommitted data either; it only skips waiting for writers to finish.
+//
+// Under MVCC, ReadUncommitted and ReadCommitted read the latest committed
+// data at every operation (buffered writes are never visible to others, so
+// there is nothing dirty to read), while RepeatableRead and Serializable
+// read the snapshot taken at begin, and Serializable additionally runs
+// serializable snapshot isolation (see ssi.go) to rule out write skew.
+//
+// Timestamp ordering ignores the level: every transaction is ordered by its
+// timestamp (see timestamp.go), which makes its reads repeatable but lets
+// phantoms through, so it reports RepeatableRead. Other engines without a
+// lock manager cannot isolate transactions at all, and run every
+// transaction at ReadUncommitted.
+
+// lockForRead takes the key lock a read at tx's isolation level needs. The
+// returned function releases it again when the level only locks for the
+// duration of the read.
+func (db *Database) lockForRead(tx *Transaction, key string) (release func(), ok bool) {
+	release = func() {}
+	if db.locks == nil || tx.Isolation == ReadUncommitted {
+		return release, true
+	}
+	if tx.Isolation == ReadCommitted && !db.locks.Holds(tx.ID, key) {
+		if !db.lockKey(tx, key) {
+			return release, false
+		}
+		return func() { db.locks.Release(tx.ID, key) }, true
+	}
+	return release, db.lockKey(tx, key)
+}
+
+// wLockForInsert takes the write lock of key's stripe for a write that may
+// insert key, waiting while another transaction's range lock covers a key that
+// does not exist yet. It returns false, without the lock, if the wait
+// timed out or tx's context was done.
+func (db *Database) wLockForInsert(tx *Transaction, key string) bool {
+	if db.locks == nil {
+		db.wLockKey(key)
+		return true
+	}
+
+	deadline := db.clock.NewTimer(db.locks.Timeout())
+	defer deadline.Stop()
+
+	for {
+		// Checking under the write lock keeps a scan from slipping in
+		// between the check and the insert
+		db.wLockKey(key)
+		if record, exists := db.records.get(key); exists && record.live(db.clock.Now()) {
+			return true
+		}
+		released, blocked := db.locks.RangeConflict(tx.ID, key)
+		if !blocked {
+			return true
+		}
+		db.wUnlockKey(key)
+
+		select {
+		case <-released:
+		case <-deadline.C():
+			db.countStat(statLockTimeouts, 1)
+			tx.conflict = true
+			tx.failure = fmt.Errorf("%w: waiting for a range lock covering %s", ErrTimeout, key)
+			return false
+		case <-tx.Context().Done():
+			db.cancelled(tx)
+			return false
+		}
+	}
+}
+
+// scan returns every live key starting with prefix together with its
+// value, read at tx's isolation level, with tx's own pending writes
+// applied. It returns false if the transaction was aborted or a key lock
+// timed out.
+func (db *Database) scan(tx *Transaction, prefix string) (map[string]int, bool) {
+	if !db.checkActive(tx, "SCAN", prefix) {
+		return nil, false
+	}
+	if db.mvcc != nil {
+		return db.mvccScan(tx, prefix)
+	}
+	if db.tso != nil {
+		return db.tsoScan(tx, prefix)
+	}
+
+	db.rLock()
+	if db.locks != nil && tx.Isolation == Serializable {
+		// Registered under the database lock so that no insert into the
+		// range can happen between locking it and listing its keys
+		db.locks.LockRange(tx.ID, prefix)
+	}
+	found := make(map[string]bool)
+	now := db.clock.Now()
+	db.records.each(func(key string, record *Record) {
+		if strings.HasPrefix(key, prefix) && record.live(now) {
+			found[key] = true
+		}
+	})
+	if db.locks != nil {
+		// Keys other transactions are about to insert are not records yet;
+		// locking them waits for the inserts to commit or abort
+		for _, key := range db.locks.LockedKeys(prefix) {
+			found[key] = true
+		}
+	}
+	for _, key := range tx.pendingKeys() {
+		if strings.HasPrefix(key, prefix) {
+			found[key] = true
+		}
+	}
+	db.rUnlock()
+	keys := make([]string, 0, len(found))
+	for key := range found {
+		keys = append(keys, key)
+	}
+
+	// Lock in key order, like a range scan over an ordered index would
+	sort.Strings(keys)
+	rows := make(map[string]int, len(keys))
+	for _, key := range keys {
+		release, ok := db.lockForRead(tx, key)
+		if !ok {
+			tx.logOp("SCAN %s: LOCK_TIMEOUT on %s", prefix, key)
+			return nil, false
+		}
+		db.rLockKey(key)
+		db.countStat(statTotalReads, 1)
+		if value, exists := db.visibleValue(tx, key); exists {
+			rows[key] = value
+		}
+		db.rUnlockKey(key)
+		release()
+	}
+
+	tx.logOp("SCAN %s: %d rows", prefix, len(rows))
+	return rows, true
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var isolationLevels = []IsolationLevel{ReadUncommitted, ReadCommitted, RepeatableRead, Serializable}
+
+// newIsolationTestDB creates a database with a short lock timeout, so a
+// transaction that the level forbids from proceeding gives up quickly
+func newIsolationTestDB(newDB func() *Database) *Database {
+	db := newDB()
+	db.SetLockTimeout(20 * time.Millisecond)
+	return db
+}
+
+// provokeDirtyRead reports whether a transaction at level sees a value
+// another transaction wrote but has not committed
+func provokeDirtyRead(newDB func() *Database, level IsolationLevel) bool {
+	db := newIsolationTestDB(newDB)
+	setup := db.BeginTransaction()
+	db.Write(setup, "x", 1)
+	db.Commit(setup)
+
+	writer := db.BeginTransaction()
+	db.Write(writer, "x", 100)
+
+	reader := db.BeginTransactionWithIsolation(level)
+	value, ok := db.Read(reader, "x")
+	db.Commit(reader)
+	db.Commit(writer)
+
+	return ok && value == 100
+}
+
+// provokeNonRepeatableRead reports whether a transaction at level reading
+// a key twice sees a change committed in between
+func provokeNonRepeatableRead(newDB func() *Database, level IsolationLevel) bool {
+	db := newIsolationTestDB(newDB)
+	setup := db.BeginTransaction()
+	db.Write(setup, "x", 1)
+	db.Commit(setup)
+
+	reader := db.BeginTransactionWithIsolation(level)
+	first, _ := db.Read(reader, "x")
+
+	writer := db.BeginTransaction()
+	db.Update(writer, "x", 1)
+	db.Commit(writer)
+
+	second, _ := db.Read(reader, "x")
+	db.Commit(reader)
+
+	return first != second
+}
+
+// provokePhantom reports whether a transaction at level repeating a scan
+// finds a key inserted and committed in between
+func provokePhantom(newDB func() *Database, level IsolationLevel) bool {
+	db := newIsolationTestDB(newDB)
+	setup := db.BeginTransaction()
+	db.Write(setup, "acct_1", 100)
+	db.Write(setup, "acct_2", 100)
+	db.Commit(setup)
+
+	reader := db.BeginTransactionWithIsolation(level)
+	first, _ := db.Scan(reader, "acct_")
+
+	writer := db.BeginTransaction()
+	db.Write(writer, "acct_3", 100)
+	db.Commit(writer)
+
+	second, _ := db.Scan(reader, "acct_")
+	db.Commit(reader)
+
+	return len(first) != len(second)
+}
+
+// TestIsolationLevelsTwoPhaseLocking checks which anomalies each level
+// allows under two-phase locking. Writes are buffered until commit, so even
+// ReadUncommitted never sees a dirty write.
+func TestIsolationLevelsTwoPhaseLocking(t *testing.T) {
+	expected := map[IsolationLevel][3]bool{
+		// dirty read, non-repeatable read, phantom
+		ReadUncommitted: {false, true, true},
+		ReadCommitted:   {false, true, true},
+		RepeatableRead:  {false, false, true},
+		Serializable:    {false, false, false},
+	}
+
+	for _, level := range isolationLevels {
+		t.Run(level.String(), func(t *testing.T) {
+			want := expected[level]
+			if got := provokeDirtyRead(NewTwoPhaseLockingDatabase, level); got != want[0] {
+				t.Errorf("Dirty read allowed = %v, want %v", got, want[0])
+			}
+			if got := provokeNonRepeatableRead(NewTwoPhaseLockingDatabase, level); got != want[1] {
+				t.Errorf("Non-repeatable read allowed = %v, want %v", got, want[1])
+			}
+			if got := provokePhantom(NewTwoPhaseLockingDatabase, level); got != want[2] {
+				t.Errorf("Phantom allowed = %v, want %v", got, want[2])
+			}
+		})
+	}
+}
+
+// TestIsolationLevelsMVCC checks which anomalies each level allows under
+// MVCC, where writes are never visible before commit
+func TestIsolationLevelsMVCC(t *testing.T) {
+	expected := map[IsolationLevel][3]bool{
+		ReadUncommitted: {false, true, true},
+		ReadCommitted:   {false, true, true},
+		RepeatableRead:  {false, false, false},
+		Serializable:    {false, false, false},
+	}
+
+	for _, level := range isolationLevels {
+		t.Run(level.String(), func(t *testing.T) {
+			want := expected[level]
+			if got := provokeDirtyRead(NewMVCCDatabase, level); got != want[0] {
+				t.Errorf("Dirty read allowed = %v, want %v", got, want[0])
+			}
+			if got := provokeNonRepeatableRead(NewMVCCDatabase, level); got != want[1] {
+				t.Errorf("Non-repeatable read allowed = %v, want %v", got, want[1])
+			}
+			if got := provokePhantom(NewMVCCDatabase, level); got != want[2] {
+				t.Errorf("Phantom allowed = %v, want %v", got, want[2])
+			}
+		})
+	}
+}
+
+// TestIsolationCappedByEngine verifies a transaction begun at a level its
+// engine cannot enforce runs, and reports itself, at the strongest level
+// the engine has
+func TestIsolationCappedByEngine(t *testing.T) {
+	for engine, want := range map[string]IsolationLevel{
+		"unsynchronized": ReadUncommitted,
+		"synchronized":   ReadUncommitted,
+		"2pl":            Serializable,
+		"mvcc":           Serializable,
+		"tso":            RepeatableRead,
+	} {
+		db, _ := OpenDatabase(engine)
+		tx := db.BeginTransactionWithIsolation(Serializable)
+		if tx.Isolation != want {
+			t.Errorf("%s: Serializable transaction runs at %v, want %v", engine, tx.Isolation, want)
+		}
+		db.Abort(tx)
+		if err := db.CheckIsolation(Serializable); (err == nil) != (want == Serializable) || err != nil && !errors.Is(err, ErrIsolationUnsupported) {
+			t.Errorf("%s: CheckIsolation(Serializable) = %v", engine, err)
+		}
+	}
+}
+
+// TestSerializableScanBlocksInsertUntilCommit verifies an insert into a
+// scanned range waits for the scanning transaction instead of failing
+func TestSerializableScanBlocksInsertUntilCommit(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+
+	reader := db.BeginTransactionWithIsolation(Serializable)
+	db.Scan(reader, "acct_")
+
+	inserted := make(chan bool)
+	go func() {
+		writer := db.BeginTransaction()
+		ok := db.Write(writer, "acct_1", 100)
+		db.Commit(writer)
+		inserted <- ok
+	}()
+
+	select {
+	case <-inserted:
+		t.Fatal("Insert went through while the range was locked")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	db.Commit(reader)
+	if !<-inserted {
+		t.Error("Insert failed after the range lock was released")
+	}
+}
@@ -0,0 +1,314 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// The journal records every operation of every committed transaction,
+// numbered in the order the operations happened across all clients, plus
+// the value each commit installed for each key. Replaying it on a fresh
+// database single-threaded rebuilds exactly the state the run ended in,
+// even one the unsynchronized engine corrupted, and points at the
+// interleavings that did it: reads that saw a value no commit had left
+// there, and commits that overwrote an update their transaction never saw.
+
+// JournalOp is the kind of a journal entry
+type JournalOp string
+
+const (
+	JournalRead    JournalOp = "read"    // Value is the value read
+	JournalWrite   JournalOp = "write"   // Value is the value written
+	JournalAdd     JournalOp = "add"     // Delta is the increment
+	JournalDelete  JournalOp = "delete"  // The key was deleted
+	JournalInstall JournalOp = "install" // A commit set the key to Value
+)
+
+// JournalEntry is one operation in a journal
+type JournalEntry struct {
+	Seq      int64 // Order of the operation across all transactions
+	TxID     int   // Top-level transaction; nested transactions log under it
+	Op       JournalOp
+	Key      string
+	Value    int  `json:",omitempty"`
+	Delta    int  `json:",omitempty"`
+	Deleted  bool `json:",omitempty"` // Install of a delete
+	Relative bool `json:",omitempty"` // Install of an increment: Value is the base it found plus Delta
+	ReadFrom int  `json:",omitempty"` // Read or add: the transaction whose install it saw, 0 for none; see readOwnWrite
+}
+
+// Journal collects the entries of committed transactions, in memory or
+// appended to a file as JSON lines
+type Journal struct {
+	seq     atomic.Int64
+	mu      sync.Mutex
+	entries []JournalEntry
+	file    *bufio.Writer
+	closer  *os.File
+	err     error
+}
+
+// NewJournal returns an in-memory journal
+func NewJournal() *Journal {
+	return &Journal{}
+}
+
+// CreateJournal returns a journal that writes to the file at path,
+// replacing it. Read it back with ReadJournal after Close.
+func CreateJournal(path string) (*Journal, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{file: bufio.NewWriter(file), closer: file}, nil
+}
+
+// SetJournal records every committed transaction of db in j. It must be
+// called before the database is shared.
+func (db *Database) SetJournal(j *Journal) {
+	db.journal = j
+}
+
+// Journal returns the journal SetJournal gave db; nil if it has none
+func (db *Database) Journal() *Journal {
+	return db.journal
+}
+
+// InMemory reports whether j keeps its entries in memory rather than in a
+// file
+func (j *Journal) InMemory() bool {
+	return j.file == nil
+}
+
+// Entries returns the in-memory journal's entries in Seq order
+func (j *Journal) Entries() []JournalEntry {
+	j.mu.Lock()
+	entries := append([]JournalEntry(nil), j.entries...)
+	j.mu.Unlock()
+
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Seq < entries[b].Seq })
+	return entries
+}
+
+// Close flushes a file journal and closes its file
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closer == nil {
+		return nil
+	}
+	err := errors.Join(j.err, j.file.Flush(), j.closer.Close())
+	j.closer = nil
+	return err
+}
+
+// ReadJournal loads the entries of a journal file in Seq order
+func ReadJournal(path string) ([]JournalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []JournalEntry
+	decoder := json.NewDecoder(file)
+	for decoder.More() {
+		var entry JournalEntry
+		if err := decoder.Decode(&entry); err != nil {
+			return entries, fmt.Errorf("%s: %w", path, err)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Seq < entries[b].Seq })
+	return entries, nil
+}
+
+// journalOp numbers an operation of tx and holds it until tx finishes
+func (db *Database) journalOp(tx *Transaction, entry JournalEntry) {
+	if db.journal == nil {
+		return
+	}
+	root := tx
+	for root.parent != nil {
+		root = root.parent
+	}
+	entry.Seq = db.journal.seq.Add(1)
+	entry.TxID = root.ID
+	root.journal = append(root.journal, entry)
+}
+
+// journalFinish adds the held entries of a top-level transaction to the
+// journal if it committed, or if it installed writes before a crash
+// swallowed its acknowledgement, and drops them otherwise
+func (db *Database) journalFinish(tx *Transaction, status TxStatus) {
+	entries := tx.journal
+	tx.journal = nil
+	if db.journal == nil || len(entries) == 0 {
+		return
+	}
+	if status != TxCommitted {
+		installed := false
+		for _, entry := range entries {
+			installed = installed || entry.Op == JournalInstall
+		}
+		if !installed {
+			return
+		}
+	}
+
+	j := db.journal
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		j.entries = append(j.entries, entries...)
+		return
+	}
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err == nil {
+			_, err = j.file.Write(append(line, '\n'))
+		}
+		if err != nil && j.err == nil {
+			j.err = err
+		}
+	}
+}
+
+// StaleRead is a journaled read whose value differs from what the commits
+// before it had left, e.g. a dirty or torn read. On MVCC, reads of an older
+// snapshot show up here too.
+type StaleRead struct {
+	Seq       int64
+	TxID      int
+	Key       string
+	Saw       int
+	Committed int  // Value the replay had at that point
+	Missing   bool // The key did not exist at that point
+}
+
+// LostUpdate is a commit that overwrote another transaction's update
+// without having seen it
+type LostUpdate struct {
+	Seq       int64 // The overwriting install
+	TxID      int
+	Key       string
+	Overwrote int // Transaction whose install was lost
+	Installed int // Value the overwriting commit installed
+	Found     int // Value the overwritten install had left
+}
+
+// ReplayReport describes a replayed journal
+type ReplayReport struct {
+	Entries      int
+	Transactions int
+	Installs     int
+	StaleReads   []StaleRead
+	LostUpdates  []LostUpdate
+}
+
+// Replay rebuilds the state a journal recorded by applying its installs to
+// db one at a time, in Seq order, and checks every read and install
+// against the state so far. entries must be in Seq order, as Entries and
+// ReadJournal return them.
+func (db *Database) Replay(entries []JournalEntry) (ReplayReport, error) {
+	type keyState struct {
+		value     int
+		exists    bool
+		writer    int   // Transaction of the last install
+		installed int64 // Seq of the last install
+	}
+	type txKey struct {
+		tx  int
+		key string
+	}
+	state := make(map[string]keyState)
+	type read struct {
+		seq   int64
+		value int
+	}
+	lastRead := make(map[txKey]read) // Latest read of the key before the transaction wrote it
+	wrote := make(map[txKey]JournalOp)
+	transactions := make(map[int]bool)
+
+	report := ReplayReport{Entries: len(entries)}
+	for _, entry := range entries {
+		transactions[entry.TxID] = true
+		k := txKey{entry.TxID, entry.Key}
+		current := state[entry.Key]
+
+		switch entry.Op {
+		case JournalRead:
+			if _, own := wrote[k]; own {
+				// The transaction reads its own pending write
+				continue
+			}
+			lastRead[k] = read{entry.Seq, entry.Value}
+			if !current.exists || current.value != entry.Value {
+				report.StaleReads = append(report.StaleReads, StaleRead{
+					Seq: entry.Seq, TxID: entry.TxID, Key: entry.Key,
+					Saw: entry.Value, Committed: current.value, Missing: !current.exists,
+				})
+			}
+
+		case JournalWrite, JournalAdd, JournalDelete:
+			if _, seen := wrote[k]; !seen || entry.Op == JournalWrite {
+				wrote[k] = entry.Op
+			}
+
+		case JournalInstall:
+			report.Installs++
+			lost := false
+			if entry.Relative {
+				// An increment must land on what the last commit left
+				base := 0
+				if current.exists {
+					base = current.value
+				}
+				lost = current.installed > 0 && entry.Value != base+entry.Delta
+			} else if r, ok := lastRead[k]; ok && wrote[k] == JournalWrite {
+				// A value computed from a read must not skip an install
+				// that changed what the read saw
+				lost = current.installed > r.seq && current.writer != entry.TxID && current.value != r.value
+			}
+			if lost {
+				report.LostUpdates = append(report.LostUpdates, LostUpdate{
+					Seq: entry.Seq, TxID: entry.TxID, Key: entry.Key,
+					Overwrote: current.writer, Installed: entry.Value, Found: current.value,
+				})
+			}
+
+			if err := db.replayInstall(entry); err != nil {
+				return report, fmt.Errorf("replaying entry %d: %w", entry.Seq, err)
+			}
+			state[entry.Key] = keyState{
+				value:     entry.Value,
+				exists:    !entry.Deleted,
+				writer:    entry.TxID,
+				installed: entry.Seq,
+			}
+		}
+	}
+	report.Transactions = len(transactions)
+	return report, nil
+}
+
+// replayInstall applies one journaled install to db as its own transaction
+func (db *Database) replayInstall(entry JournalEntry) error {
+	tx := db.BeginTransaction()
+	if entry.Deleted {
+		if err := db.remove(tx, entry.Key); err != nil && !errors.Is(err, ErrKeyNotFound) {
+			db.Abort(tx)
+			return err
+		}
+	} else if err := db.put(tx, entry.Key, entry.Value); err != nil {
+		db.Abort(tx)
+		return err
+	}
+	return db.Commit(tx)
+}
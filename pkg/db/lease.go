@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A LeaseManager is a lock service for nodes that may stall: a lock is
+// granted as a lease that expires unless renewed, so a node that crashes
+// or pauses cannot hold it forever. Expiry makes the lock unsafe on its
+// own, though: a node paused past its lease still believes it holds the
+// lock when it wakes up. Every grant therefore carries a fencing token,
+// larger than any granted before, and the resource the lock protects must
+// reject requests carrying a token smaller than one it has already seen.
+// db.RunFenced does that for keys of a Database.
+
+var (
+	// ErrLeaseExpired means a lease was renewed or released after it
+	// expired, possibly after someone else acquired the lock
+	ErrLeaseExpired = errors.New("lease expired")
+
+	// ErrStaleToken means a fenced request carried a fencing token older
+	// than one the resource has already accepted
+	ErrStaleToken = errors.New("stale fencing token")
+)
+
+// Lease is a granted lock
+type Lease struct {
+	Name    string
+	Holder  string
+	Token   int // Fencing token: larger for every grant of the manager
+	Expires time.Time
+}
+
+// LeaseManager grants leases on named locks
+type LeaseManager struct {
+	mu        sync.Mutex
+	leases    map[string]Lease
+	nextToken int
+	released  chan struct{} // Closed and replaced whenever a lock is released
+	grants    int
+	expired   int   // Leases that ran out while their holder still had them
+	clock     Clock // Leases expire by it
+}
+
+// NewLeaseManager returns a lease manager with every lock free, whose
+// leases expire on the wall clock
+func NewLeaseManager() *LeaseManager {
+	return NewLeaseManagerWithClock(RealClock)
+}
+
+// NewLeaseManagerWithClock is NewLeaseManager with leases expiring by
+// clock, e.g. a database's, so a simulated clock can run them out
+func NewLeaseManagerWithClock(clock Clock) *LeaseManager {
+	return &LeaseManager{
+		leases:   make(map[string]Lease),
+		released: make(chan struct{}),
+		clock:    clock,
+	}
+}
+
+// TryAcquire grants holder the lock name for ttl if it is free or its
+// lease has expired
+func (m *LeaseManager) TryAcquire(name, holder string, ttl time.Duration) (Lease, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lease, _, ok := m.tryAcquire(name, holder, ttl)
+	return lease, ok
+}
+
+// tryAcquire is TryAcquire with m.mu held. When the lock is taken it
+// returns when the current lease expires.
+func (m *LeaseManager) tryAcquire(name, holder string, ttl time.Duration) (Lease, time.Time, bool) {
+	now := m.clock.Now()
+	if current, held := m.leases[name]; held {
+		if now.Before(current.Expires) {
+			return Lease{}, current.Expires, false
+		}
+		m.expired++
+	}
+	m.nextToken++
+	m.grants++
+	lease := Lease{Name: name, Holder: holder, Token: m.nextToken, Expires: now.Add(ttl)}
+	m.leases[name] = lease
+	return lease, time.Time{}, true
+}
+
+// Acquire waits until holder is granted the lock name for ttl, or until
+// ctx is done
+func (m *LeaseManager) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (Lease, error) {
+	for {
+		m.mu.Lock()
+		lease, expires, ok := m.tryAcquire(name, holder, ttl)
+		released := m.released
+		m.mu.Unlock()
+		if ok {
+			return lease, nil
+		}
+
+		timer := m.clock.NewTimer(expires.Sub(m.clock.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return Lease{}, fmt.Errorf("acquiring lease %s: %w", name, ctx.Err())
+		case <-released:
+		case <-timer.C():
+		}
+		timer.Stop()
+	}
+}
+
+// Renew extends a lease that has not expired to ttl from now
+func (m *LeaseManager) Renew(lease Lease, ttl time.Duration) (Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, held := m.leases[lease.Name]
+	now := m.clock.Now()
+	if !held || current.Token != lease.Token || !now.Before(current.Expires) {
+		return Lease{}, fmt.Errorf("%w: %s token %d", ErrLeaseExpired, lease.Name, lease.Token)
+	}
+	current.Expires = now.Add(ttl)
+	m.leases[lease.Name] = current
+	return current, nil
+}
+
+// Release frees the lock of a lease that has not expired
+func (m *LeaseManager) Release(lease Lease) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, held := m.leases[lease.Name]
+	if !held || current.Token != lease.Token {
+		return fmt.Errorf("%w: %s token %d", ErrLeaseExpired, lease.Name, lease.Token)
+	}
+	delete(m.leases, lease.Name)
+	close(m.released)
+	m.released = make(chan struct{})
+	if !m.clock.Now().Before(current.Expires) {
+		m.expired++
+		return fmt.Errorf("%w: %s token %d", ErrLeaseExpired, lease.Name, lease.Token)
+	}
+	return nil
+}
+
+// LeaseStats returns how many leases were granted and how many expired
+// before their holder released them
+func (m *LeaseManager) LeaseStats() (grants, expired int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.grants, m.expired
+}
+
+// fenceKey is the key holding the highest fencing token resource accepted
+func fenceKey(resource string) string {
+	return "fence:" + resource
+}
+
+// RunFenced runs fn in a transaction on behalf of the holder of token,
+// failing with ErrStaleToken if resource has seen a larger token. The
+// largest token seen is kept in the database, in the same transaction as
+// fn's reads and writes, so once a newer holder's request has run, no
+// request from an older holder can, whether it reads or writes.
+func (db *Database) RunFenced(resource string, token int, fn func(tx *Transaction) error) error {
+	return db.atomically(func(tx *Transaction) error {
+		seen, err := db.Get(tx, fenceKey(resource))
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return err
+		}
+		if token < seen {
+			return fmt.Errorf("%w: %s token %d, already saw %d", ErrStaleToken, resource, token, seen)
+		}
+		if token > seen {
+			if err := db.Put(tx, fenceKey(resource), token); err != nil {
+				return err
+			}
+		}
+		return fn(tx)
+	})
+}
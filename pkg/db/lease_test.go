@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestLeaseExclusiveUntilExpiry verifies a lease keeps others out until it
+// expires, and that each grant's fencing token is larger than the last
+func TestLeaseExclusiveUntilExpiry(t *testing.T) {
+	m := NewLeaseManager()
+	first, ok := m.TryAcquire("lock", "a", 20*time.Millisecond)
+	if !ok {
+		t.Fatal("Expected a free lock to be granted")
+	}
+	if _, ok := m.TryAcquire("lock", "b", time.Second); ok {
+		t.Fatal("Expected the held lock to be refused")
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	second, ok := m.TryAcquire("lock", "b", time.Second)
+	if !ok {
+		t.Fatal("Expected the expired lease to be taken over")
+	}
+	if second.Token <= first.Token {
+		t.Errorf("Expected a larger fencing token, got %d after %d", second.Token, first.Token)
+	}
+	if _, err := m.Renew(first, time.Second); !errors.Is(err, ErrLeaseExpired) {
+		t.Errorf("Expected renewing the expired lease to fail, got %v", err)
+	}
+	if err := m.Release(first); !errors.Is(err, ErrLeaseExpired) {
+		t.Errorf("Expected releasing the expired lease to fail, got %v", err)
+	}
+	if err := m.Release(second); err != nil {
+		t.Errorf("Release: %v", err)
+	}
+}
+
+// TestLeaseAcquireWaits verifies Acquire waits for a release, and gives up
+// when its context is done
+func TestLeaseAcquireWaits(t *testing.T) {
+	m := NewLeaseManager()
+	held, _ := m.TryAcquire("lock", "a", time.Minute)
+
+	short, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := m.Acquire(short, "lock", "b", time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Acquire to time out, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		m.Release(held)
+	}()
+	lease, err := m.Acquire(context.Background(), "lock", "b", time.Second)
+	if err != nil || lease.Holder != "b" {
+		t.Errorf("Expected b to get the lock once released, got %+v (%v)", lease, err)
+	}
+}
+
+// TestLeaseRenew verifies a renewed lease outlives its original expiry
+func TestLeaseRenew(t *testing.T) {
+	m := NewLeaseManager()
+	lease, _ := m.TryAcquire("lock", "a", 10*time.Millisecond)
+	renewed, err := m.Renew(lease, time.Minute)
+	if err != nil {
+		t.Fatalf("Renew: %v", err)
+	}
+	time.Sleep(15 * time.Millisecond)
+	if _, ok := m.TryAcquire("lock", "b", time.Second); ok {
+		t.Error("Expected the renewed lease to still hold the lock")
+	}
+	if renewed.Token != lease.Token {
+		t.Errorf("Expected renewal to keep token %d, got %d", lease.Token, renewed.Token)
+	}
+}
+
+// TestRunFencedRejectsStaleTokens verifies a request with an older token
+// is rejected once a newer one ran, and leaves the data alone
+func TestRunFencedRejectsStaleTokens(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	put := func(value int) func(tx *Transaction) error {
+		return func(tx *Transaction) error { return db.Put(tx, "key", value) }
+	}
+
+	if err := db.RunFenced("res", 1, put(1)); err != nil {
+		t.Fatalf("RunFenced with token 1: %v", err)
+	}
+	if err := db.RunFenced("res", 2, put(2)); err != nil {
+		t.Fatalf("RunFenced with token 2: %v", err)
+	}
+	if err := db.RunFenced("res", 1, put(100)); !errors.Is(err, ErrStaleToken) {
+		t.Fatalf("Expected ErrStaleToken, got %v", err)
+	}
+	if err := db.RunFenced("res", 2, put(3)); err != nil {
+		t.Errorf("Expected the current token to be accepted again, got %v", err)
+	}
+	if err := db.RunFenced("other", 1, put(4)); err != nil {
+		t.Errorf("Expected another resource's fence to be separate, got %v", err)
+	}
+
+	tx := db.BeginTransaction()
+	value, _ := db.Get(tx, "key")
+	db.Commit(tx)
+	if value != 4 {
+		t.Errorf("Expected 4, got %d", value)
+	}
+}
@@ -0,0 +1,341 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLockTimeout is how long a transaction waits for a key lock before
+// giving up. Exclusive per-key locks can deadlock when transactions take
+// keys in different orders; the timeout is what breaks the deadlock.
+const DefaultLockTimeout = 500 * time.Millisecond
+
+// lockWaiter is a transaction queued for a key lock
+type lockWaiter struct {
+	txID    int
+	granted chan struct{} // Closed when the lock is handed to this waiter
+}
+
+// keyLock is an exclusive lock on a single key, owned by one transaction.
+// Waiters are granted the lock in FIFO order so none of them starves,
+// unless transactions have priorities: then the most urgent goes first.
+type keyLock struct {
+	owner int       // ID of the owning transaction
+	since time.Time // When the owner was granted the lock
+	queue []*lockWaiter
+}
+
+// LockManager hands out exclusive per-key locks to transactions and keeps
+// them until the transaction finishes (strict two-phase locking)
+type LockManager struct {
+	mu      sync.Mutex
+	locks   map[string]*keyLock
+	held    map[int][]string // Keys held by each transaction, in acquisition order
+	waiting map[int]string   // Key each blocked transaction waits for
+	timeout time.Duration
+	clock   Clock // Times lock waits and holds
+
+	// Range locks taken by serializable scans: prefix -> holding transactions.
+	// They are shared between scanners and only keep other transactions from
+	// inserting keys with the prefix; rangeReleased is closed and replaced
+	// whenever one is released.
+	ranges        map[string]map[int]bool
+	heldRanges    map[int][]string
+	rangeReleased chan struct{}
+
+	order *LockOrderChecker // Lock-order debugging, nil when disabled
+
+	// Transaction priorities, for those that have one, and whether lock
+	// holders inherit the priority of the transactions waiting for them.
+	// See priority.go.
+	priorities  map[int]int
+	inheritance bool
+
+	granularity LockGranularity // What a key lock covers; see convoy.go
+
+	// Contention profile: per-key waits and holds, and the longest waits
+	// with the transactions behind them. See ContentionReport.
+	contention map[string]*KeyContention
+	longest    []LockWait
+}
+
+// NewLockManager creates a lock manager. If lock-order checking has been
+// enabled with EnableLockOrderChecking, acquisitions are reported to it.
+func NewLockManager() *LockManager {
+	return &LockManager{
+		locks:   make(map[string]*keyLock),
+		held:    make(map[int][]string),
+		waiting: make(map[int]string),
+		timeout: DefaultLockTimeout,
+		clock:   RealClock,
+		order:   lockOrderChecker,
+
+		priorities: make(map[int]int),
+		contention: make(map[string]*KeyContention),
+
+		ranges:        make(map[string]map[int]bool),
+		heldRanges:    make(map[int][]string),
+		rangeReleased: make(chan struct{}),
+	}
+}
+
+// SetTimeout sets how long Acquire waits before giving up
+func (lm *LockManager) SetTimeout(timeout time.Duration) {
+	lm.mu.Lock()
+	lm.timeout = timeout
+	lm.mu.Unlock()
+}
+
+// SetClock makes lm time lock waits, their timeouts and lock holds by
+// clock. It should be called before lm is shared.
+func (lm *LockManager) SetClock(clock Clock) {
+	lm.mu.Lock()
+	lm.clock = clock
+	lm.mu.Unlock()
+}
+
+// Timeout returns how long Acquire waits before giving up
+func (lm *LockManager) Timeout() time.Duration {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.timeout
+}
+
+// Acquire blocks until txID owns the lock on key. Locks are re-entrant for
+// the owning transaction. It returns false if the wait timed out.
+func (lm *LockManager) Acquire(txID int, key string) bool {
+	return lm.AcquireContext(context.Background(), txID, key) == nil
+}
+
+// AcquireContext is Acquire that also gives up as soon as ctx is done. It
+// returns nil once txID owns the lock, ctx's error if ctx ended the wait,
+// and ErrTimeout or, if the wait was part of a wait-for cycle, ErrDeadlock
+// when it timed out.
+func (lm *LockManager) AcquireContext(ctx context.Context, txID int, key string) error {
+	lm.mu.Lock()
+	key = lm.lockName(key)
+
+	lock, locked := lm.locks[key]
+	if !locked {
+		lm.locks[key] = &keyLock{owner: txID, since: lm.clock.Now()}
+		lm.grant(txID, key)
+		lm.mu.Unlock()
+		return nil
+	}
+	if lock.owner == txID {
+		lm.mu.Unlock()
+		return nil
+	}
+
+	waiter := &lockWaiter{txID: txID, granted: make(chan struct{})}
+	lock.queue = append(lock.queue, waiter)
+	lm.waiting[txID] = key
+	holder, start := lock.owner, lm.clock.Now()
+	timer := lm.clock.NewTimer(lm.timeout)
+	lm.mu.Unlock()
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-waiter.granted:
+	case <-timer.C():
+		err = ErrTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	delete(lm.waiting, txID)
+	if err == nil {
+		lm.recordWait(LockWait{Key: key, Waiter: txID, Holder: holder, Wait: lm.clock.Now().Sub(start), Granted: true})
+		return nil
+	}
+
+	select {
+	case <-waiter.granted:
+		// Handed over just as the wait ended
+		lm.recordWait(LockWait{Key: key, Waiter: txID, Holder: holder, Wait: lm.clock.Now().Sub(start), Granted: true})
+		return nil
+	default:
+	}
+	lm.recordWait(LockWait{Key: key, Waiter: txID, Holder: holder, Wait: lm.clock.Now().Sub(start)})
+	if err == ErrTimeout && lm.inCycle(txID, key) {
+		err = ErrDeadlock
+	}
+	for i, queued := range lock.queue {
+		if queued == waiter {
+			lock.queue = append(lock.queue[:i], lock.queue[i+1:]...)
+			break
+		}
+	}
+	return err
+}
+
+// inCycle reports whether txID, waiting for key, is part of a wait-for
+// cycle: key's owner waits, directly or through other transactions, for a
+// lock txID holds. Must be called with lm.mu held.
+func (lm *LockManager) inCycle(txID int, key string) bool {
+	seen := make(map[int]bool)
+	for {
+		lock, locked := lm.locks[key]
+		if !locked {
+			return false
+		}
+		owner := lock.owner
+		if owner == txID {
+			return true
+		}
+		if seen[owner] {
+			return false
+		}
+		seen[owner] = true
+		if key, locked = lm.waiting[owner]; !locked {
+			return false
+		}
+	}
+}
+
+// grant records that txID now owns key. Must be called with lm.mu held.
+func (lm *LockManager) grant(txID int, key string) {
+	if lm.order != nil {
+		lm.order.Acquired(txID, lm.held[txID], key)
+	}
+	lm.held[txID] = append(lm.held[txID], key)
+	lm.keyContention(key).Acquisitions++
+}
+
+// ReleaseAll releases every lock held by txID, handing each one to the
+// longest waiting transaction
+func (lm *LockManager) ReleaseAll(txID int) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for _, key := range lm.held[txID] {
+		lm.handOff(txID, key)
+	}
+	delete(lm.held, txID)
+	delete(lm.priorities, txID)
+
+	if prefixes := lm.heldRanges[txID]; len(prefixes) > 0 {
+		for _, prefix := range prefixes {
+			delete(lm.ranges[prefix], txID)
+			if len(lm.ranges[prefix]) == 0 {
+				delete(lm.ranges, prefix)
+			}
+		}
+		delete(lm.heldRanges, txID)
+		close(lm.rangeReleased)
+		lm.rangeReleased = make(chan struct{})
+	}
+}
+
+// Release releases txID's lock on a single key before the transaction
+// ends, for short read locks below RepeatableRead
+func (lm *LockManager) Release(txID int, key string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	key = lm.lockName(key)
+
+	held := lm.held[txID]
+	for i, k := range held {
+		if k == key {
+			lm.held[txID] = append(held[:i], held[i+1:]...)
+			lm.handOff(txID, key)
+			return
+		}
+	}
+}
+
+// handOff passes txID's lock on key to the longest waiting transaction, or
+// the most urgent one if transactions have priorities, or drops it if
+// nobody is waiting. Must be called with lm.mu held.
+func (lm *LockManager) handOff(txID int, key string) {
+	lock, locked := lm.locks[key]
+	if !locked || lock.owner != txID {
+		return
+	}
+	now := lm.clock.Now()
+	lm.recordHold(key, txID, now.Sub(lock.since))
+	if len(lock.queue) == 0 {
+		delete(lm.locks, key)
+		return
+	}
+	i := lm.nextWaiter(lock.queue)
+	next := lock.queue[i]
+	lock.queue = append(lock.queue[:i], lock.queue[i+1:]...)
+	lock.owner = next.txID
+	lock.since = now
+	lm.grant(next.txID, key)
+	close(next.granted)
+}
+
+// Holds reports whether txID owns the lock on key
+func (lm *LockManager) Holds(txID int, key string) bool {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	key = lm.lockName(key)
+	lock, locked := lm.locks[key]
+	return locked && lock.owner == txID
+}
+
+// LockRange gives txID a range lock on every key starting with prefix,
+// held until ReleaseAll. It never blocks: range locks only conflict with
+// inserts, which check for them with RangeConflict.
+func (lm *LockManager) LockRange(txID int, prefix string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	holders, exists := lm.ranges[prefix]
+	if !exists {
+		holders = make(map[int]bool)
+		lm.ranges[prefix] = holders
+	}
+	if !holders[txID] {
+		holders[txID] = true
+		lm.heldRanges[txID] = append(lm.heldRanges[txID], prefix)
+	}
+}
+
+// RangeConflict reports whether a transaction other than txID holds a
+// range lock covering key. If so it also returns a channel that is closed
+// the next time any range lock is released.
+func (lm *LockManager) RangeConflict(txID int, key string) (<-chan struct{}, bool) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for prefix, holders := range lm.ranges {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		for holder := range holders {
+			if holder != txID {
+				return lm.rangeReleased, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// LockedKeys returns every locked key starting with prefix
+func (lm *LockManager) LockedKeys(prefix string) []string {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	keys := make([]string, 0)
+	for key := range lm.locks {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// HeldBy returns the keys held by txID in acquisition order
+func (lm *LockManager) HeldBy(txID int) []string {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return append([]string(nil), lm.held[txID]...)
+}
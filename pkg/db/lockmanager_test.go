@@ -0,0 +1,61 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLockManagerTimeout tests that a blocked acquisition gives up after
+// the timeout and succeeds once the holder releases
+func TestLockManagerTimeout(t *testing.T) {
+	lm := NewLockManager()
+	lm.SetTimeout(10 * time.Millisecond)
+
+	if !lm.Acquire(1, "key1") {
+		t.Fatalf("first acquisition should succeed")
+	}
+	if !lm.Acquire(1, "key1") {
+		t.Fatalf("locks should be re-entrant for the owner")
+	}
+	if lm.Acquire(2, "key1") {
+		t.Fatalf("tx 2 should time out while tx 1 holds key1")
+	}
+
+	lm.ReleaseAll(1)
+
+	if !lm.Acquire(2, "key1") {
+		t.Errorf("tx 2 should get key1 after tx 1 released it")
+	}
+}
+
+// TestLockOrderCheckerFlagsInversion tests that locking two keys in both
+// orders is reported, even when the transactions never overlapped
+func TestLockOrderCheckerFlagsInversion(t *testing.T) {
+	lm := NewLockManager()
+	lm.order = NewLockOrderChecker()
+
+	lm.Acquire(1, "account_A")
+	lm.Acquire(1, "account_B")
+	lm.ReleaseAll(1)
+
+	lm.Acquire(2, "account_A")
+	lm.Acquire(2, "account_B")
+	lm.ReleaseAll(2)
+
+	if n := len(lm.order.Violations()); n != 0 {
+		t.Fatalf("consistent order should not be flagged, got %d violations", n)
+	}
+
+	lm.Acquire(3, "account_B")
+	lm.Acquire(3, "account_A")
+	lm.ReleaseAll(3)
+
+	violations := lm.order.Violations()
+	if len(violations) != 1 {
+		t.Fatalf("expected 1 violation, got %d", len(violations))
+	}
+	v := violations[0]
+	if v.TxID != 3 || v.Held != "account_B" || v.Acquired != "account_A" || v.EstablishedBy != 1 {
+		t.Errorf("unexpected violation: %v", v)
+	}
+}
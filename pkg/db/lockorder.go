@@ -0,0 +1,148 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+)
+
+// LockOrderViolation describes a pair of keys that have been locked in both
+// orders. Two transactions doing this concurrently can deadlock.
+type LockOrderViolation struct {
+	TxID          int    // Transaction that acquired the keys in the new order
+	Held          string // Key the transaction already held
+	Acquired      string // Key the transaction was acquiring
+	EstablishedBy int    // Transaction that first locked them the other way round
+}
+
+// String describes the violation in lockdep style
+func (v LockOrderViolation) String() string {
+	return fmt.Sprintf("tx %d locked %s -> %s, but tx %d established %s -> %s",
+		v.TxID, v.Held, v.Acquired, v.EstablishedBy, v.Acquired, v.Held)
+}
+
+// LockOrderChecker is a miniature lockdep: it records the order in which
+// transactions acquire keys as a graph (edge A -> B means "B was locked
+// while holding A") and flags any acquisition that closes a cycle
+type LockOrderChecker struct {
+	mu         sync.Mutex
+	edges      map[string]map[string]int // before -> after -> establishing tx
+	violations []LockOrderViolation
+	reported   map[[2]string]bool // Key pairs already reported
+}
+
+// lockOrderChecker is the process-wide checker, like lockdep's lock class
+// graph it is shared by every lock manager. nil means checking is disabled.
+var lockOrderChecker *LockOrderChecker
+
+// EnableLockOrderChecking turns on lock-order checking for every lock
+// manager created afterwards
+func EnableLockOrderChecking() {
+	if lockOrderChecker == nil {
+		lockOrderChecker = NewLockOrderChecker()
+	}
+}
+
+// ReportLockOrderViolations prints every violation found by the process-wide
+// checker. Call it at program exit.
+func ReportLockOrderViolations() {
+	if lockOrderChecker != nil {
+		lockOrderChecker.Report()
+	}
+}
+
+// NewLockOrderChecker creates an empty lock-order checker
+func NewLockOrderChecker() *LockOrderChecker {
+	return &LockOrderChecker{
+		edges:    make(map[string]map[string]int),
+		reported: make(map[[2]string]bool),
+	}
+}
+
+// Acquired records that txID locked key while holding the keys in held
+func (c *LockOrderChecker) Acquired(txID int, held []string, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, before := range held {
+		if before == key {
+			continue
+		}
+
+		// A path key -> ... -> before means someone locked them the other way
+		if establishedBy, found := c.pathFrom(key, before); found {
+			pair := [2]string{before, key}
+			if before > key {
+				pair = [2]string{key, before}
+			}
+			if !c.reported[pair] {
+				c.reported[pair] = true
+				c.violations = append(c.violations, LockOrderViolation{
+					TxID:          txID,
+					Held:          before,
+					Acquired:      key,
+					EstablishedBy: establishedBy,
+				})
+			}
+			continue
+		}
+
+		if c.edges[before] == nil {
+			c.edges[before] = make(map[string]int)
+		}
+		if _, exists := c.edges[before][key]; !exists {
+			c.edges[before][key] = txID
+		}
+	}
+}
+
+// pathFrom searches the order graph for a path from -> to and returns the
+// transaction that established its first edge. Must be called with c.mu held.
+func (c *LockOrderChecker) pathFrom(from, to string) (int, bool) {
+	visited := map[string]bool{from: true}
+	type step struct {
+		key  string
+		txID int
+	}
+	stack := make([]step, 0)
+	for next, txID := range c.edges[from] {
+		stack = append(stack, step{next, txID})
+	}
+
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if current.key == to {
+			return current.txID, true
+		}
+		if visited[current.key] {
+			continue
+		}
+		visited[current.key] = true
+		for next := range c.edges[current.key] {
+			stack = append(stack, step{next, current.txID})
+		}
+	}
+	return 0, false
+}
+
+// Violations returns the lock-order inversions found so far
+func (c *LockOrderChecker) Violations() []LockOrderViolation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]LockOrderViolation(nil), c.violations...)
+}
+
+// Report prints all lock-order inversions found so far
+func (c *LockOrderChecker) Report() {
+	violations := c.Violations()
+	fmt.Println("\n=== Lock Order Report ===")
+	if len(violations) == 0 {
+		fmt.Println("✓ No lock-order inversions detected")
+	} else {
+		fmt.Printf("❌ %d lock-order inversion(s) that could deadlock:\n", len(violations))
+		for _, v := range violations {
+			fmt.Printf("  %v\n", v)
+		}
+	}
+	fmt.Println("=========================")
+}
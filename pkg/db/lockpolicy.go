@@ -0,0 +1,40 @@
+package db
+
+import (
+	"database-sync-unsynchronized/pkg/lock"
+)
+
+// The database lock of the synchronized engine lives in pkg/lock; these
+// are its names here.
+
+// LockPolicy decides who goes first when readers and writers compete
+// for the database lock
+type LockPolicy = lock.LockPolicy
+
+// The lock policies; see lock.LockPolicy
+const (
+	PreferReaders = lock.PreferReaders
+	PreferWriters = lock.PreferWriters
+	Fair          = lock.Fair
+)
+
+// LockWaitStats reports how long each role waited to acquire the lock
+type LockWaitStats = lock.LockWaitStats
+
+// PolicyRWLock is a reader-writer lock admitting by a LockPolicy
+type PolicyRWLock = lock.PolicyRWLock
+
+// NewPolicyRWLock creates a reader-writer lock with the given policy
+func NewPolicyRWLock(policy LockPolicy) *PolicyRWLock {
+	return lock.NewPolicyRWLock(policy)
+}
+
+// BackoffStrategy is how a retry loop waits before trying again
+type BackoffStrategy = lock.BackoffStrategy
+
+// The backoff strategies; see lock.BackoffStrategy
+const (
+	BackoffSleep = lock.BackoffSleep
+	BackoffYield = lock.BackoffYield
+	BackoffNone  = lock.BackoffNone
+)
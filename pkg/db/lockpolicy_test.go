@@ -0,0 +1,45 @@
+package db
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestSynchronizedCounterIncrement tests that the synchronized database
+// makes single-operation updates atomic under every lock policy
+func TestSynchronizedCounterIncrement(t *testing.T) {
+	for _, policy := range []LockPolicy{PreferReaders, PreferWriters, Fair} {
+		db := simulated(NewSynchronizedDatabase(policy))
+
+		tx := db.BeginTransaction()
+		db.Write(tx, "counter", 0)
+		db.Commit(tx)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					tx := db.BeginTransaction()
+					db.Update(tx, "counter", 1)
+					db.Read(tx, "counter")
+					db.Commit(tx)
+				}
+			}()
+		}
+		wg.Wait()
+
+		tx = db.BeginTransaction()
+		value, _ := db.Read(tx, "counter")
+		db.Commit(tx)
+
+		if value != 500 {
+			t.Errorf("%v: expected counter=500, got %d", policy, value)
+		}
+		waits := db.LockWaitStats()
+		if waits.ReaderAcquisitions == 0 || waits.WriterAcquisitions == 0 {
+			t.Errorf("%v: wait stats not recorded: %+v", policy, waits)
+		}
+	}
+}
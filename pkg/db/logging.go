@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Scenario output on stdout stays human-readable. Detailed traces go to a
+// structured log instead, when one is configured with SetTraceLogger (the
+// -log flags): every operation a transaction makes, tagged with the
+// transaction, the client running it and the operation, at debug level;
+// every commit and abort at info level; and every scenario's result, also
+// at info level. Each transaction keeps the same lines in Operations.
+
+// traceLogger receives the structured traces; nil when tracing is off
+var traceLogger *slog.Logger
+
+// SetTraceLogger sends the structured traces to logger, or turns them off
+// when it is nil. It must be called before any transaction starts.
+func SetTraceLogger(logger *slog.Logger) {
+	traceLogger = logger
+}
+
+// TraceLogger returns the logger the traces go to, nil when tracing is off
+func TraceLogger() *slog.Logger {
+	return traceLogger
+}
+
+// OpenTraceLog returns a logger writing to sink, "stderr" or a file path
+// (appended to), in format "text" or "json", and dropping lines below
+// level ("debug", "info", "warn" or "error"). The returned closer closes
+// the file, if any.
+func OpenTraceLog(sink, format, level string) (*slog.Logger, io.Closer, error) {
+	var threshold slog.Level
+	if err := threshold.UnmarshalText([]byte(level)); err != nil {
+		return nil, nil, fmt.Errorf("log level %q: %w", level, err)
+	}
+
+	var w io.Writer = os.Stderr
+	var closer io.Closer = io.NopCloser(nil)
+	if sink != "stderr" {
+		f, err := os.OpenFile(sink, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, closer = f, f
+	}
+
+	options := &slog.HandlerOptions{Level: threshold}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, options)), closer, nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), closer, nil
+	default:
+		closer.Close()
+		return nil, nil, fmt.Errorf("log format %q: want text or json", format)
+	}
+}
+
+// logOp records a line of tx's operation log, such as "READ key: 5", and
+// traces it. The operation is the line's first word.
+func (tx *Transaction) logOp(format string, args ...any) {
+	if !tx.ops.enabled() && traceLogger == nil {
+		return
+	}
+	line := fmt.Sprintf(format, args...)
+	tx.ops.add(line)
+	if traceLogger == nil {
+		return
+	}
+
+	op, _, _ := strings.Cut(line, " ")
+	op = strings.TrimSuffix(op, ":")
+	level := slog.LevelDebug
+	if op == "COMMIT" || op == "ABORT" {
+		level = slog.LevelInfo
+	}
+	if !traceLogger.Enabled(context.Background(), level) {
+		return
+	}
+	traceLogger.LogAttrs(context.Background(), level, line,
+		slog.Int("tx", tx.ID),
+		slog.Int("client", tx.ClientID),
+		slog.String("op", op),
+	)
+}
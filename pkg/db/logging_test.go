@@ -0,0 +1,87 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTraceTagsOperations verifies each traced line carries the
+// transaction, its client and the operation
+func TestTraceTagsOperations(t *testing.T) {
+	var buf bytes.Buffer
+	SetTraceLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer SetTraceLogger(nil)
+
+	db := NewTwoPhaseLockingDatabase()
+	tx := db.BeginTransaction()
+	tx.ClientID = 7
+	db.Put(tx, "a", 1)
+	db.Get(tx, "a")
+	db.Commit(tx)
+
+	var ops []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry struct {
+			Level  string
+			Msg    string
+			Tx     int
+			Client int
+			Op     string
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", line, err)
+		}
+		if entry.Tx != tx.ID || entry.Client != 7 {
+			t.Errorf("Expected tx %d of client 7, got %+v", tx.ID, entry)
+		}
+		ops = append(ops, entry.Level+" "+entry.Op)
+	}
+	expected := []string{"DEBUG WRITE", "DEBUG READ", "INFO COMMIT"}
+	if strings.Join(ops, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, ops)
+	}
+	if len(tx.Operations()) != 3 {
+		t.Errorf("Expected the operation log to keep 3 lines, got %v", tx.Operations())
+	}
+}
+
+// TestTraceLevelFiltersOperations verifies info level keeps only the
+// transaction outcomes
+func TestTraceLevelFiltersOperations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.log")
+	logger, closer, err := OpenTraceLog(path, "text", "info")
+	if err != nil {
+		t.Fatalf("OpenTraceLog: %v", err)
+	}
+	SetTraceLogger(logger)
+	defer SetTraceLogger(nil)
+
+	db := NewTwoPhaseLockingDatabase()
+	tx := db.BeginTransaction()
+	db.Put(tx, "a", 1)
+	db.Abort(tx)
+	closer.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Reading trace: %v", err)
+	}
+	if trace := string(data); strings.Contains(trace, "op=WRITE") || !strings.Contains(trace, "op=ABORT") {
+		t.Errorf("Expected only the abort at info level, got %q", trace)
+	}
+}
+
+// TestOpenTraceLogRejectsBadOptions verifies unknown formats and levels fail
+func TestOpenTraceLogRejectsBadOptions(t *testing.T) {
+	if _, _, err := OpenTraceLog("stderr", "xml", "info"); err == nil {
+		t.Error("Expected format xml to be rejected")
+	}
+	if _, _, err := OpenTraceLog("stderr", "json", "loud"); err == nil {
+		t.Error("Expected level loud to be rejected")
+	}
+}
@@ -0,0 +1,458 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recordVersion is one committed version of a key under MVCC
+type recordVersion struct {
+	Value     int
+	Deleted   bool  // The version is a delete tombstone
+	CommitTS  int64 // Commit timestamp of the writing transaction
+	TxID      int
+	ExpiresAt time.Time // Zero for never
+	Payload   []byte    // Shared with the versions before it that it kept it from
+}
+
+// pendingWrite is a write buffered in a transaction until it commits
+type pendingWrite struct {
+	Value     int
+	Deleted   bool
+	BaseTS    int64     // Snapshot the write was based on, validated at commit
+	ExpiresAt time.Time // TTL deadline of the written value; zero for never
+
+	// Relative means Value is an increment that commit adds to the value
+	// committed by then (Update on engines without MVCC or timestamps)
+	Relative bool
+
+	// SetsPayload means commit replaces the key's payload with Payload,
+	// nil for none, as Write and PutBytes do; updates keep the payload
+	SetsPayload bool
+	Payload     []byte
+}
+
+// mvccStore keeps every committed version of every key. Transactions read
+// the newest version committed before their snapshot was taken, and writes
+// stay invisible in the transaction until commit installs them as new
+// versions. Readers only hold mu for the lookup, so they never wait for a
+// writer's transaction and writers never wait for readers.
+type mvccStore struct {
+	mu     sync.RWMutex
+	chains map[string][]recordVersion // Versions of each key, oldest first
+	clock  int64                      // Timestamp of the latest commit
+	active map[int]int64              // Snapshot of each active transaction, for Vacuum
+
+	// commitMu serializes commit validation and installation
+	commitMu sync.Mutex
+
+	ssi *ssiTracker // Read tracking for Serializable transactions
+}
+
+// newMVCCStore creates an empty version store
+func newMVCCStore() *mvccStore {
+	return &mvccStore{
+		chains: make(map[string][]recordVersion),
+		active: make(map[int]int64),
+		ssi:    newSSITracker(),
+	}
+}
+
+// NewMVCCDatabase creates a database using multi-version concurrency
+// control with snapshot isolation: each transaction reads a consistent
+// snapshot as of its start, and concurrent writers of the same key are
+// resolved first-committer-wins at commit time
+func NewMVCCDatabase() *Database {
+	db := NewSynchronizedDatabase(Fair)
+	db.mvcc = newMVCCStore()
+	return db
+}
+
+// snapshot returns the timestamp a new transaction reads as of
+func (s *mvccStore) snapshot() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clock
+}
+
+// visible returns the newest version of key committed at or before ts
+func (s *mvccStore) visible(key string, ts int64) (recordVersion, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	chain := s.chains[key]
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i].CommitTS <= ts {
+			return chain[i], true
+		}
+	}
+	return recordVersion{}, false
+}
+
+// latestCommitTS returns when key was last written. Must be called with
+// s.mu held.
+func (s *mvccStore) latestCommitTS(key string) (recordVersion, bool) {
+	chain := s.chains[key]
+	if len(chain) == 0 {
+		return recordVersion{}, false
+	}
+	return chain[len(chain)-1], true
+}
+
+// readTS returns the snapshot tx's next operation reads: the one taken at
+// begin, or the latest committed state below RepeatableRead
+func (db *Database) readTS(tx *Transaction) int64 {
+	if tx.Isolation < RepeatableRead {
+		return db.mvcc.snapshot()
+	}
+	return tx.SnapshotTS
+}
+
+// mvccGet returns key's value as seen by tx at snapshot ts: its own
+// pending write if it has one, otherwise the snapshot version
+func (db *Database) mvccGet(tx *Transaction, key string, ts int64) (int, bool) {
+	if pending, buffered := tx.pending(key); buffered {
+		tx.readFrom = readOwnWrite
+		return pending.Value, !pending.Deleted
+	}
+	version, found := db.mvcc.visible(key, ts)
+	tx.readFrom = version.TxID
+	if !found || version.Deleted || expired(version.ExpiresAt, db.clock.Now()) {
+		return 0, false
+	}
+	return version.Value, true
+}
+
+// bufferWrite records a pending write in tx's write set
+func (tx *Transaction) bufferWrite(key string, write pendingWrite) {
+	if tx.writes == nil {
+		tx.writes = make(map[string]pendingWrite)
+	}
+	if earlier, buffered := tx.pending(key); buffered {
+		// The new value builds on the earlier write, so it keeps its base,
+		// and its payload unless it replaces or deletes it
+		write.BaseTS = earlier.BaseTS
+		if !write.SetsPayload && !write.Deleted {
+			write.SetsPayload, write.Payload = earlier.SetsPayload, earlier.Payload
+		}
+	}
+	if _, own := tx.writes[key]; !own {
+		tx.writeOrder = append(tx.writeOrder, key)
+	}
+	tx.writes[key] = write
+}
+
+// ssiCheckRead records a Serializable transaction's read of key with SSI
+// and aborts the transaction if the read makes the history unserializable
+func (db *Database) ssiCheckRead(tx *Transaction, op string, key string) bool {
+	if !db.tracked(tx) {
+		return true
+	}
+	reason, ok := db.ssiRead(tx, key)
+	if !ok {
+		db.countStat(statSerializationFailures, 1)
+		tx.conflict = true
+		tx.logOp("%s %s: SERIALIZATION_FAILURE", op, key)
+		db.abortWithReason(tx, reason)
+	}
+	return ok
+}
+
+// mvccRead reads key from tx's snapshot
+func (db *Database) mvccRead(tx *Transaction, key string) (int, bool) {
+	db.countStat(statTotalReads, 1)
+
+	if !db.ssiCheckRead(tx, "READ", key) {
+		return 0, false
+	}
+	ts := db.readTS(tx)
+	value, exists := db.mvccGet(tx, key, ts)
+
+	// Simulate some processing time
+	db.process(tx, OpRead)
+
+	if !exists {
+		tx.logOp("READ %s: NOT_FOUND", key)
+		return 0, false
+	}
+	tx.logOp("READ %s: %d (snapshot %d)", key, value, ts)
+	return value, true
+}
+
+// mvccWrite buffers a write until commit
+func (db *Database) mvccWrite(tx *Transaction, key string, value int) bool {
+	if !db.validateWrite(tx, "WRITE", key, value) {
+		return false
+	}
+
+	// Simulate some processing time
+	db.process(tx, OpWrite)
+
+	tx.bufferWrite(key, pendingWrite{Value: value, BaseTS: db.readTS(tx), SetsPayload: true})
+	tx.logOp("WRITE %s: %d (pending)", key, value)
+	return true
+}
+
+// mvccUpdate reads key from the snapshot and buffers the modified value
+func (db *Database) mvccUpdate(tx *Transaction, key string, delta int, upsert bool, initial int) bool {
+	if !db.ssiCheckRead(tx, "UPDATE", key) {
+		return false
+	}
+	ts := db.readTS(tx)
+	current, exists := db.mvccGet(tx, key, ts)
+	if !exists {
+		if !upsert {
+			tx.logOp("UPDATE %s: NOT_FOUND", key)
+			return false
+		}
+		db.countStat(statUpsertInserts, 1)
+		current = initial
+	}
+
+	// Simulate some processing time
+	db.process(tx, OpUpdate)
+
+	newValue := current + delta
+	if !db.validateWrite(tx, "UPDATE", key, newValue) {
+		return false
+	}
+	tx.bufferWrite(key, pendingWrite{Value: newValue, BaseTS: ts})
+	tx.logOp("UPDATE %s: +%d = %d (pending)", key, delta, newValue)
+	return true
+}
+
+// mvccDelete buffers a delete tombstone until commit
+func (db *Database) mvccDelete(tx *Transaction, key string) bool {
+	if !db.ssiCheckRead(tx, "DELETE", key) {
+		return false
+	}
+	ts := db.readTS(tx)
+	if _, exists := db.mvccGet(tx, key, ts); !exists {
+		tx.logOp("DELETE %s: NOT_FOUND", key)
+		return false
+	}
+
+	// Simulate some processing time
+	db.process(tx, OpDelete)
+
+	tx.bufferWrite(key, pendingWrite{Deleted: true, BaseTS: ts})
+	tx.logOp("DELETE %s: SUCCESS (pending)", key)
+	return true
+}
+
+// mvccCommit validates tx against transactions that committed after the
+// snapshot each of its writes was based on and, if none of them wrote the
+// same keys, installs its writes
+// as new versions under a fresh commit timestamp. On a conflict tx is
+// aborted instead (first committer wins). Serializable transactions are
+// also checked by SSI. A transaction that Prepare already validated is
+// installed straight away.
+func (db *Database) mvccCommit(tx *Transaction) {
+	if tx.prepared {
+		db.mvccInstall(tx)
+		return
+	}
+	if len(tx.writes) == 0 {
+		db.mvccValidate(tx)
+		return
+	}
+
+	s := db.mvcc
+	s.commitMu.Lock()
+	defer s.commitMu.Unlock()
+
+	// Held until the new versions are installed; see ssiValidateCommit
+	s.ssi.mu.Lock()
+	if !db.mvccValidate(tx) {
+		s.ssi.mu.Unlock()
+		return
+	}
+	db.mvccInstall(tx)
+}
+
+// mvccPrepare validates tx as mvccCommit would and, if it passes, keeps
+// the commit locks until Commit or Abort, so no other transaction can
+// commit a conflicting write in between. Returns false if tx was aborted.
+func (db *Database) mvccPrepare(tx *Transaction) bool {
+	if len(tx.writes) == 0 {
+		return db.mvccValidate(tx)
+	}
+	s := db.mvcc
+	s.commitMu.Lock()
+	s.ssi.mu.Lock()
+	if !db.mvccValidate(tx) {
+		s.ssi.mu.Unlock()
+		s.commitMu.Unlock()
+		return false
+	}
+	tx.holdsCommitLocks = true
+	return true
+}
+
+// mvccReleasePrepared releases the commit locks of a prepared transaction
+// that is being aborted
+func (db *Database) mvccReleasePrepared(tx *Transaction) {
+	if tx.holdsCommitLocks {
+		tx.holdsCommitLocks = false
+		db.mvcc.ssi.mu.Unlock()
+		db.mvcc.commitMu.Unlock()
+	}
+}
+
+// mvccValidate checks tx for write-write conflicts and, if it is
+// serializable, SSI, and aborts it if it fails. A transaction with writes
+// must be validated with commitMu and ssi.mu held.
+func (db *Database) mvccValidate(tx *Transaction) bool {
+	if len(tx.writes) == 0 {
+		if db.tracked(tx) {
+			if reason, ok := db.ssiCommitReadOnly(tx); !ok {
+				db.countStat(statSerializationFailures, 1)
+				tx.Aborted = true
+				tx.conflict = true
+				tx.AbortReason = reason
+				return false
+			}
+		}
+		return true
+	}
+
+	s := db.mvcc
+	s.mu.RLock()
+	for _, key := range tx.writeOrder {
+		latest, found := s.latestCommitTS(key)
+		if found && latest.CommitTS > tx.writes[key].BaseTS {
+			s.mu.RUnlock()
+			db.countStat(statWriteConflicts, 1)
+			if latest.Deleted {
+				// Our write would resurrect a key deleted after our snapshot
+				db.countStat(statResurrectionsBlocked, 1)
+			}
+			tx.Aborted = true
+			tx.conflict = true
+			tx.AbortReason = fmt.Sprintf("write-write conflict on %s with tx %d", key, latest.TxID)
+			tx.writes = nil
+			tx.writeOrder = nil
+			return false
+		}
+	}
+	s.mu.RUnlock()
+
+	if db.tracked(tx) {
+		if reason, ok := db.ssiValidateCommit(tx); !ok {
+			db.countStat(statSerializationFailures, 1)
+			tx.Aborted = true
+			tx.conflict = true
+			tx.AbortReason = reason
+			tx.writes = nil
+			tx.writeOrder = nil
+			return false
+		}
+	}
+	return true
+}
+
+// mvccInstall installs tx's validated writes as new versions under a
+// fresh commit timestamp, then releases ssi.mu, and commitMu too if
+// Prepare took it
+func (db *Database) mvccInstall(tx *Transaction) {
+	if len(tx.writes) == 0 {
+		return
+	}
+	s := db.mvcc
+	s.mu.Lock()
+	s.clock++
+	commitTS := s.clock
+	for _, key := range tx.writeOrder {
+		pending := tx.writes[key]
+		version := recordVersion{
+			Value:     pending.Value,
+			Deleted:   pending.Deleted,
+			CommitTS:  commitTS,
+			TxID:      tx.ID,
+			ExpiresAt: pending.ExpiresAt,
+			Payload:   pending.Payload,
+		}
+		if chain := s.chains[key]; !pending.SetsPayload && !pending.Deleted && len(chain) > 0 {
+			version.Payload = chain[len(chain)-1].Payload
+		}
+		s.chains[key] = append(s.chains[key], version)
+	}
+	s.mu.Unlock()
+
+	if state, ok := s.ssi.txs[tx.ID]; ok && db.tracked(tx) {
+		state.committed = true
+		state.commitTS = commitTS
+	}
+	s.ssi.mu.Unlock()
+
+	db.installWrites(tx)
+	db.publishCommit(tx)
+	if tx.holdsCommitLocks {
+		tx.holdsCommitLocks = false
+		s.commitMu.Unlock()
+	}
+}
+
+// mvccScan returns every key starting with prefix that is live in tx's
+// snapshot, with tx's own pending writes applied. It returns false if SSI
+// aborted the transaction.
+func (db *Database) mvccScan(tx *Transaction, prefix string) (map[string]int, bool) {
+	if db.tracked(tx) {
+		if reason, ok := db.ssiScan(tx, prefix); !ok {
+			db.countStat(statSerializationFailures, 1)
+			tx.conflict = true
+			tx.logOp("SCAN %s: SERIALIZATION_FAILURE", prefix)
+			db.abortWithReason(tx, reason)
+			return nil, false
+		}
+	}
+	ts := db.readTS(tx)
+	rows := make(map[string]int)
+	now := db.clock.Now()
+
+	s := db.mvcc
+	s.mu.RLock()
+	for key, chain := range s.chains {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		for i := len(chain) - 1; i >= 0; i-- {
+			if chain[i].CommitTS <= ts {
+				if !chain[i].Deleted && !expired(chain[i].ExpiresAt, now) {
+					rows[key] = chain[i].Value
+				}
+				break
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, key := range tx.pendingKeys() {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		pending, _ := tx.pending(key)
+		if pending.Deleted {
+			delete(rows, key)
+		} else {
+			rows[key] = pending.Value
+		}
+	}
+
+	db.countStat(statTotalReads, len(rows))
+	tx.logOp("SCAN %s: %d rows (snapshot %d)", prefix, len(rows), ts)
+	return rows, true
+}
+
+// VersionCount returns how many committed versions of key are retained
+// (0 for engines other than MVCC)
+func (db *Database) VersionCount(key string) int {
+	if db.mvcc == nil {
+		return 0
+	}
+	db.mvcc.mu.RLock()
+	defer db.mvcc.mu.RUnlock()
+	return len(db.mvcc.chains[key])
+}
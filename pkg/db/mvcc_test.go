@@ -0,0 +1,148 @@
+package db
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMVCCSnapshotRead tests that a transaction keeps reading the snapshot
+// it started with while later commits stay invisible to it
+func TestMVCCSnapshotRead(t *testing.T) {
+	db := NewMVCCDatabase()
+
+	tx := db.BeginTransaction()
+	db.Write(tx, "key1", 1)
+	db.Commit(tx)
+
+	reader := db.BeginTransaction()
+
+	writer := db.BeginTransaction()
+	db.Write(writer, "key1", 2)
+	db.Write(writer, "key2", 2)
+	if value, _ := db.Read(reader, "key1"); value != 1 {
+		t.Errorf("uncommitted write visible to another transaction: key1=%d", value)
+	}
+	db.Commit(writer)
+
+	if value, _ := db.Read(reader, "key1"); value != 1 {
+		t.Errorf("snapshot changed under the reader: key1=%d", value)
+	}
+	if _, exists := db.Read(reader, "key2"); exists {
+		t.Errorf("key2 was created after the reader's snapshot")
+	}
+	db.Commit(reader)
+
+	tx = db.BeginTransaction()
+	value, _ := db.Read(tx, "key1")
+	db.Commit(tx)
+	if value != 2 {
+		t.Errorf("expected key1=2 for a new transaction, got %d", value)
+	}
+	if versions := db.VersionCount("key1"); versions != 2 {
+		t.Errorf("expected 2 versions of key1, got %d", versions)
+	}
+}
+
+// TestMVCCFirstCommitterWins tests that of two concurrent writers of the
+// same key only the first to commit succeeds
+func TestMVCCFirstCommitterWins(t *testing.T) {
+	db := NewMVCCDatabase()
+
+	tx := db.BeginTransaction()
+	db.Write(tx, "counter", 0)
+	db.Commit(tx)
+
+	first := db.BeginTransaction()
+	second := db.BeginTransaction()
+	db.Update(first, "counter", 1)
+	db.Update(second, "counter", 1)
+	db.Commit(first)
+	db.Commit(second)
+
+	if first.Aborted {
+		t.Errorf("first committer should succeed")
+	}
+	if !second.Aborted {
+		t.Errorf("second committer should be aborted")
+	}
+
+	tx = db.BeginTransaction()
+	value, _ := db.Read(tx, "counter")
+	db.Commit(tx)
+	if value != 1 {
+		t.Errorf("expected counter=1, got %d (lost or doubled update)", value)
+	}
+	if conflicts := db.Stats().WriteConflicts; conflicts != 1 {
+		t.Errorf("expected 1 write conflict, got %d", conflicts)
+	}
+}
+
+// TestMVCCConsistentSnapshots runs the read-write workload and checks that
+// readers never see data_1 and data_2 out of step
+func TestMVCCConsistentSnapshots(t *testing.T) {
+	db := NewMVCCDatabase()
+
+	tx := db.BeginTransaction()
+	db.Write(tx, "data_1", 100)
+	db.Write(tx, "data_2", 100)
+	db.Commit(tx)
+
+	stopChan := make(chan bool)
+	var wg sync.WaitGroup
+	var inconsistent, committedWrites int
+	var mu sync.Mutex
+
+	for i := 0; i < 3; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stopChan:
+					return
+				default:
+					tx := db.BeginTransaction()
+					val1, _ := db.Read(tx, "data_1")
+					val2, _ := db.Read(tx, "data_2")
+					db.Commit(tx)
+					if val1 != val2 {
+						mu.Lock()
+						inconsistent++
+						mu.Unlock()
+					}
+				}
+			}
+		}()
+		go func(writerID int) {
+			defer wg.Done()
+			for value := writerID * 1000; ; value++ {
+				select {
+				case <-stopChan:
+					return
+				default:
+					tx := db.BeginTransaction()
+					db.Write(tx, "data_1", value)
+					db.Write(tx, "data_2", value)
+					db.Commit(tx)
+					if !tx.Aborted {
+						mu.Lock()
+						committedWrites++
+						mu.Unlock()
+					}
+				}
+			}
+		}(i)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(stopChan)
+	wg.Wait()
+
+	if inconsistent > 0 {
+		t.Errorf("detected %d inconsistent snapshot reads", inconsistent)
+	}
+	if committedWrites == 0 {
+		t.Errorf("no writer ever committed")
+	}
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"fmt"
+)
+
+// Nested transactions. A child transaction runs inside its parent and
+// buffers its own writes on top of the parent's: it sees everything the
+// parent wrote, the parent sees nothing of the child's work until the child
+// commits, and then the child's writes merge into the parent's write set.
+// They become visible to others, and durable, only when the top-level
+// transaction commits. Aborting a child throws away just its own writes and
+// leaves the parent running.
+//
+// A child acts as its parent towards the engine: it shares the parent's ID,
+// so key locks it takes are held by the top-level transaction until that
+// ends, it reads the parent's snapshot or uses the parent's timestamp, and
+// it is cancelled along with the parent's context.
+
+// BeginNested starts a child transaction of parent. It returns an aborted
+// transaction if parent has already been aborted.
+func (db *Database) BeginNested(parent *Transaction) *Transaction {
+	tx := &Transaction{
+		ID:         parent.ID,
+		StartTime:  db.clock.Now(),
+		ops:        opLog{limit: parent.ops.limit},
+		Isolation:  parent.Isolation,
+		Deadline:   parent.Deadline,
+		ctx:        parent.ctx,
+		SnapshotTS: parent.SnapshotTS,
+		parent:     parent,
+	}
+	parent.ops.add("BEGIN NESTED")
+	if parent.Aborted {
+		tx.Aborted = true
+		tx.AbortReason = "parent aborted"
+	}
+	return tx
+}
+
+// pending returns the buffered write for key visible to tx: its own, or
+// the nearest ancestor's. It is safe to call on a nil transaction.
+func (tx *Transaction) pending(key string) (pendingWrite, bool) {
+	for t := tx; t != nil; t = t.parent {
+		if write, buffered := t.writes[key]; buffered {
+			return write, true
+		}
+	}
+	return pendingWrite{}, false
+}
+
+// pendingKeys returns every key tx or one of its ancestors has a buffered
+// write for
+func (tx *Transaction) pendingKeys() []string {
+	seen := make(map[string]bool)
+	keys := make([]string, 0)
+	for t := tx; t != nil; t = t.parent {
+		for _, key := range t.writeOrder {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// ancestorAborted reports whether a transaction tx is nested in was
+// aborted, so tx cannot go on either
+func (tx *Transaction) ancestorAborted() bool {
+	for t := tx.parent; t != nil; t = t.parent {
+		if t.Aborted {
+			return true
+		}
+	}
+	return false
+}
+
+// commitNested merges a child's writes into its parent's write set
+func (db *Database) commitNested(tx *Transaction) {
+	if tx.ancestorAborted() && !tx.Aborted {
+		db.abortWithReason(tx, "parent aborted")
+	}
+	duration := db.since(tx.StartTime)
+	if tx.Aborted {
+		tx.logOp("ABORT %s (duration: %v)", tx.AbortReason, duration)
+		db.finish(tx, TxAborted)
+		return
+	}
+
+	for _, key := range tx.writeOrder {
+		tx.parent.bufferWrite(key, tx.writes[key])
+	}
+	tx.logOp("COMMIT INTO PARENT (%d writes, duration: %v)", len(tx.writeOrder), duration)
+	if tx.parent.ops.enabled() {
+		tx.parent.ops.add(fmt.Sprintf("NESTED COMMIT (%d writes)", len(tx.writeOrder)))
+	}
+	tx.writes = nil
+	tx.writeOrder = nil
+	db.finish(tx, TxCommitted)
+}
+
+// abortNested discards a child's writes. Locks it took stay with the
+// top-level transaction, like everything else under strict two-phase
+// locking.
+func (db *Database) abortNested(tx *Transaction) {
+	duration := db.since(tx.StartTime)
+	tx.logOp("ABORT (duration: %v)", duration)
+	tx.parent.ops.add("NESTED ABORT")
+	if db.tso != nil {
+		db.tsoAbort(tx)
+	}
+	tx.writes = nil
+	tx.writeOrder = nil
+	db.finish(tx, TxAborted)
+}
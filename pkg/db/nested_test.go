@@ -0,0 +1,103 @@
+package db
+
+import (
+	"testing"
+)
+
+var nestedEngines = map[string]func() *Database{
+	"synchronized":       func() *Database { return NewSynchronizedDatabase(Fair) },
+	"two-phase-locking":  NewTwoPhaseLockingDatabase,
+	"mvcc":               NewMVCCDatabase,
+	"timestamp-ordering": NewTimestampOrderingDatabase,
+}
+
+// TestNestedCommitMergesIntoParent tests that a child sees its parent's
+// writes, its own writes reach the parent only when it commits, and
+// nothing is visible outside until the top-level transaction commits
+func TestNestedCommitMergesIntoParent(t *testing.T) {
+	for name, newDB := range nestedEngines {
+		t.Run(name, func(t *testing.T) {
+			db := newDB()
+			parent := db.BeginTransaction()
+			db.Write(parent, "a", 1)
+
+			child := db.BeginNested(parent)
+			if value, _ := db.Read(child, "a"); value != 1 {
+				t.Errorf("Child sees a=%d, want the parent's 1", value)
+			}
+			db.Write(child, "b", 2)
+			db.Update(child, "a", 10)
+			if _, exists := db.Read(parent, "b"); exists {
+				t.Error("Parent sees the child's write before it committed")
+			}
+			db.Commit(child)
+
+			a, _ := db.Read(parent, "a")
+			b, _ := db.Read(parent, "b")
+			if a != 11 || b != 2 {
+				t.Errorf("Parent sees a=%d b=%d after the child committed, want 11 and 2", a, b)
+			}
+			if len(db.TakeSnapshot().Entries) != 0 {
+				t.Error("Writes became visible before the top-level commit")
+			}
+
+			db.Commit(parent)
+			if parent.Aborted {
+				t.Fatalf("Parent aborted: %s", parent.AbortReason)
+			}
+			ok, errs := db.VerifyIntegrity(map[string]int{"a": 11, "b": 2})
+			if !ok {
+				t.Errorf("Unexpected state after the top-level commit: %v", errs)
+			}
+		})
+	}
+}
+
+// TestNestedAbortKeepsParent tests that aborting a child discards only the
+// child's writes and the parent can still commit
+func TestNestedAbortKeepsParent(t *testing.T) {
+	for name, newDB := range nestedEngines {
+		t.Run(name, func(t *testing.T) {
+			db := newDB()
+			parent := db.BeginTransaction()
+			db.Write(parent, "a", 1)
+
+			child := db.BeginNested(parent)
+			db.Write(child, "a", 5)
+			db.Write(child, "c", 3)
+			db.Abort(child)
+
+			if parent.Aborted {
+				t.Fatal("Aborting the child aborted the parent")
+			}
+			if value, _ := db.Read(parent, "a"); value != 1 {
+				t.Errorf("Parent sees a=%d after the child aborted, want 1", value)
+			}
+			db.Commit(parent)
+
+			ok, errs := db.VerifyIntegrity(map[string]int{"a": 1})
+			if !ok {
+				t.Errorf("Unexpected state: %v", errs)
+			}
+			if _, exists := db.TakeSnapshot().Entries["c"]; exists {
+				t.Error("Aborted child's insert was applied")
+			}
+		})
+	}
+}
+
+// TestAbortedParentStopsChild tests that a child of an aborted parent
+// cannot do any more work
+func TestAbortedParentStopsChild(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	parent := db.BeginTransaction()
+	child := db.BeginNested(parent)
+	db.abortWithReason(parent, "engine gave up")
+
+	if db.Write(child, "a", 1) {
+		t.Error("Child of an aborted parent could still write")
+	}
+	if child.AbortReason != "parent aborted" {
+		t.Errorf("Abort reason = %q, want \"parent aborted\"", child.AbortReason)
+	}
+}
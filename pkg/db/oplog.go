@@ -0,0 +1,71 @@
+package db
+
+import (
+	"sync"
+)
+
+// Operation logs. Every transaction keeps the lines it traces, such as
+// "READ x: 5", for debugging. Several goroutines can log to one
+// transaction, a nested transaction's parent or a transaction shared by
+// mistake, so the log has its own mutex. It keeps only a transaction's
+// latest lines, up to the database's op log limit, so a long transaction
+// takes bounded memory; a limit of 0 turns logging off, as benchmarks
+// want, and then lines are not even formatted unless traced.
+
+// DefaultOpLogLimit is how many lines a new database's transactions keep
+const DefaultOpLogLimit = 256
+
+// opLog is a transaction's operation log: a ring of its latest lines
+type opLog struct {
+	limit int // Fixed when the transaction begins
+
+	mu    sync.Mutex
+	lines []string // At most limit lines; once full, next is the oldest
+	next  int
+	total int // Lines logged, including those dropped
+}
+
+// enabled reports whether the log keeps lines
+func (l *opLog) enabled() bool {
+	return l.limit > 0
+}
+
+// add logs line, dropping the oldest line if the log is full
+func (l *opLog) add(line string) {
+	if !l.enabled() {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total++
+	if len(l.lines) < l.limit {
+		l.lines = append(l.lines, line)
+		return
+	}
+	l.lines[l.next] = line
+	l.next = (l.next + 1) % l.limit
+}
+
+// Operations returns the latest lines of tx's operation log, oldest first.
+// Without an op log limit it is empty.
+func (tx *Transaction) Operations() []string {
+	l := &tx.ops
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append(append([]string(nil), l.lines[l.next:]...), l.lines[:l.next]...)
+}
+
+// OperationCount returns how many lines tx logged, including any the log
+// no longer holds
+func (tx *Transaction) OperationCount() int {
+	tx.ops.mu.Lock()
+	defer tx.ops.mu.Unlock()
+	return tx.ops.total
+}
+
+// SetOpLogLimit sets how many operation log lines each transaction begun
+// afterwards keeps; 0 keeps none. It should be called before the database
+// is shared.
+func (db *Database) SetOpLogLimit(limit int) {
+	db.opLogLimit = max(limit, 0)
+}
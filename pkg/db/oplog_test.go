@@ -0,0 +1,71 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestOpLogKeepsLatestLines checks a long transaction's log holds only its
+// latest lines, oldest first, and still counts every line
+func TestOpLogKeepsLatestLines(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetOpLogLimit(4)
+	tx := db.BeginTransaction()
+	for i := 0; i < 10; i++ {
+		tx.logOp("NOTE %d", i)
+	}
+	db.Abort(tx)
+
+	got := tx.Operations()
+	if len(got) != 4 || fmt.Sprint(got[:3]) != "[NOTE 7 NOTE 8 NOTE 9]" || !strings.HasPrefix(got[3], "ABORT") {
+		t.Errorf("log %q, want NOTE 7 to 9 and the abort", got)
+	}
+	if tx.OperationCount() != 11 {
+		t.Errorf("%d lines counted, want 11", tx.OperationCount())
+	}
+}
+
+// TestOpLogDisabled checks a limit of 0 keeps no lines, in nested
+// transactions too
+func TestOpLogDisabled(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetOpLogLimit(0)
+	tx := db.BeginTransaction()
+	db.Write(tx, "x", 1)
+	nested := db.BeginNested(tx)
+	db.Write(nested, "y", 2)
+	db.Commit(nested)
+	db.Commit(tx)
+
+	if len(tx.Operations()) != 0 || tx.OperationCount() != 0 || len(nested.Operations()) != 0 {
+		t.Errorf("disabled logs kept %q and %q", tx.Operations(), nested.Operations())
+	}
+}
+
+// TestOpLogSharedTransaction logs to one transaction from several
+// goroutines, for the race detector
+func TestOpLogSharedTransaction(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetOpLogLimit(8)
+	tx := db.BeginTransaction()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				tx.logOp("NOTE %d.%d", g, i)
+				tx.Operations()
+			}
+		}(g)
+	}
+	wg.Wait()
+	db.Abort(tx)
+
+	if len(tx.Operations()) != 8 || tx.OperationCount() != 201 {
+		t.Errorf("%d lines kept and %d counted, want 8 and 201", len(tx.Operations()), tx.OperationCount())
+	}
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"bytes"
+	"unsafe"
+)
+
+// Payloads. Besides its integer Value, a record can hold a string or
+// binary payload of any size, so contention experiments can include the
+// cost of copying large values. PutBytes buffers a copy of the payload
+// with the write, and the commit copies it into the record under the
+// record's stripe lock, as GetBytes copies it out under the same lock, so
+// the bigger the values, the longer each holds it. MVCC versions keep the
+// payload they were committed with, for snapshot reads.
+//
+// A payload write sets the integer value to the payload's length. Write
+// replaces the payload with none, and Delete drops it; Update and the
+// other increments keep it. The WAL, checkpoints, snapshot files and the
+// commit stream replicas apply carry each key's payload with its value,
+// so lists and sets survive recovery and failover.
+
+// PutBytes sets key to payload, and its value to the payload's length,
+// when tx commits. The payload is copied, so the caller may reuse it.
+func (db *Database) PutBytes(tx *Transaction, key string, payload []byte) error {
+	return db.putPayload(tx, key, len(payload), bytes.Clone(payload))
+}
+
+// putPayload sets key to value and payload, which it keeps, when tx
+// commits
+func (db *Database) putPayload(tx *Transaction, key string, value int, payload []byte) error {
+	if err := db.Put(tx, key, value); err != nil {
+		return err
+	}
+	write := tx.writes[key]
+	write.Payload = payload
+	tx.writes[key] = write
+	return nil
+}
+
+// GetBytes returns a copy of key's payload as tx sees it; nil if the key
+// holds none. The value is read as Get reads it, with the same locking
+// and conflict detection, and the payload of the same version: the
+// snapshot's under MVCC, and otherwise the record's, read under its
+// stripe lock just after.
+func (db *Database) GetBytes(tx *Transaction, key string) ([]byte, error) {
+	if _, err := db.Get(tx, key); err != nil {
+		return nil, err
+	}
+	if pending, buffered := tx.pending(key); buffered && pending.SetsPayload {
+		return bytes.Clone(pending.Payload), nil
+	}
+	if db.mvcc != nil {
+		version, _ := db.mvcc.visible(key, db.readTS(tx))
+		return bytes.Clone(version.Payload), nil
+	}
+	db.rLockKey(key)
+	defer db.rUnlockKey(key)
+	if record, exists := db.records.get(key); exists {
+		return bytes.Clone(record.Payload), nil
+	}
+	return nil, nil
+}
+
+// PutString is PutBytes for a string payload
+func (db *Database) PutString(tx *Transaction, key string, s string) error {
+	return db.PutBytes(tx, key, []byte(s))
+}
+
+// GetString is GetBytes for a string payload
+func (db *Database) GetString(tx *Transaction, key string) (string, error) {
+	payload, err := db.GetBytes(tx, key)
+	return string(payload), err
+}
+
+// setPayload replaces record's payload, keeping Stats.PayloadBytes up to
+// date. The caller must hold the record's stripe lock.
+func (db *Database) setPayload(record *Record, payload []byte) {
+	if delta := len(payload) - len(record.Payload); delta != 0 {
+		db.countStat(statPayloadBytes, delta)
+	}
+	record.Payload = payload
+}
+
+// MemoryUsage estimates the memory a database's data takes up
+type MemoryUsage struct {
+	Records      int // Records, tombstones included
+	Versions     int // MVCC versions; 0 on other engines
+	PayloadBytes int // Bytes of payload, in records and versions, counting a payload shared by versions once
+	Bytes        int // All of it: records, keys, versions and payloads, leaving out the maps' own overhead
+}
+
+// MemoryUsage walks db's records, and its MVCC versions, to estimate the
+// memory they take up
+func (db *Database) MemoryUsage() MemoryUsage {
+	var usage MemoryUsage
+	db.rLock()
+	db.records.each(func(key string, record *Record) {
+		usage.Records++
+		usage.PayloadBytes += len(record.Payload)
+		usage.Bytes += recordBytes(key, record)
+	})
+	db.rUnlock()
+
+	if db.mvcc != nil {
+		s := db.mvcc
+		s.mu.RLock()
+		counted := make(map[*byte]bool)
+		for key, chain := range s.chains {
+			usage.Versions += len(chain)
+			usage.Bytes += len(key) + len(chain)*int(unsafe.Sizeof(recordVersion{}))
+			for _, version := range chain {
+				if len(version.Payload) > 0 && !counted[&version.Payload[0]] {
+					counted[&version.Payload[0]] = true
+					usage.PayloadBytes += len(version.Payload)
+					usage.Bytes += len(version.Payload)
+				}
+			}
+		}
+		s.mu.RUnlock()
+	}
+	return usage
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestPayloadLifecycle writes, updates, overwrites and deletes a payload on
+// every engine, checking what reads see and what Stats.PayloadBytes counts
+func TestPayloadLifecycle(t *testing.T) {
+	for _, engine := range EngineVariants() {
+		db, _ := OpenDatabase(engine)
+		simulated(db)
+
+		tx := db.BeginTransaction()
+		db.PutString(tx, "doc", "hello, world")
+		if s, err := db.GetString(tx, "doc"); err != nil || s != "hello, world" {
+			t.Fatalf("%s: own payload write read as %q, %v", engine, s, err)
+		}
+		if err := db.Commit(tx); err != nil {
+			t.Fatalf("%s: %v", engine, err)
+		}
+		if n := db.Stats().PayloadBytes; n != 12 {
+			t.Errorf("%s: %d payload bytes after the write, want 12", engine, n)
+		}
+
+		tx = db.BeginTransaction()
+		db.Update(tx, "doc", 1)
+		db.Commit(tx)
+		tx = db.BeginTransaction()
+		value, _ := db.Get(tx, "doc")
+		s, _ := db.GetString(tx, "doc")
+		db.Commit(tx)
+		if value != 13 || s != "hello, world" {
+			t.Errorf("%s: after an update, value %d and payload %q, want 13 and the payload kept", engine, value, s)
+		}
+
+		tx = db.BeginTransaction()
+		db.Write(tx, "doc", 5)
+		db.Commit(tx)
+		tx = db.BeginTransaction()
+		payload, err := db.GetBytes(tx, "doc")
+		db.Commit(tx)
+		if err != nil || payload != nil || db.Stats().PayloadBytes != 0 {
+			t.Errorf("%s: after an integer write, payload %q, %v and %d bytes, want none", engine, payload, err, db.Stats().PayloadBytes)
+		}
+
+		tx = db.BeginTransaction()
+		db.PutBytes(tx, "doc", make([]byte, 100))
+		db.Commit(tx)
+		tx = db.BeginTransaction()
+		db.Delete(tx, "doc")
+		db.Commit(tx)
+		if n := db.Stats().PayloadBytes; n != 0 {
+			t.Errorf("%s: %d payload bytes after the delete, want 0", engine, n)
+		}
+	}
+}
+
+// TestPayloadSnapshotRead checks an MVCC snapshot keeps seeing the payload
+// it started with, and that versions sharing a payload count it once
+func TestPayloadSnapshotRead(t *testing.T) {
+	db := NewMVCCDatabase()
+	simulated(db)
+	setup := db.BeginTransaction()
+	db.PutString(setup, "doc", "first")
+	db.Commit(setup)
+
+	reader := db.BeginTransaction()
+	writer := db.BeginTransaction()
+	db.PutString(writer, "doc", "second")
+	db.Commit(writer)
+	if s, _ := db.GetString(reader, "doc"); s != "first" {
+		t.Errorf("snapshot read %q, want first", s)
+	}
+	db.Commit(reader)
+
+	bump := db.BeginTransaction()
+	db.Update(bump, "doc", 1)
+	db.Commit(bump)
+	if usage := db.MemoryUsage(); usage.Versions != 3 || usage.PayloadBytes != len("first")+2*len("second") {
+		t.Errorf("usage %+v, want 3 versions and the payloads of both writes and the record", usage)
+	}
+}
+
+// TestPayloadsSurviveRecoveryAndFailover verifies lists and sets come back
+// whole from a checkpoint and the WAL tail after it, from snapshot files
+// and on a promoted standby, including a payload an increment kept
+func TestPayloadsSurviveRecoveryAndFailover(t *testing.T) {
+	dir := t.TempDir()
+	primary := NewTwoPhaseLockingDatabase()
+	if _, err := primary.AttachStorage(dir); err != nil {
+		t.Fatal(err)
+	}
+	standby := NewStandby(primary, SyncReplication, 0)
+	primary.SAdd("set", "a", "b")
+	primary.LPush("list", "x")
+	if err := primary.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	primary.SAdd("set", "c")
+	primary.LPush("list", "y")
+	tx := primary.BeginTransaction()
+	primary.Add(tx, "list", 0)
+	primary.Commit(tx)
+	snapshots := t.TempDir()
+	for _, name := range []string{"state.json", "state.gob"} {
+		if err := primary.SaveSnapshot(filepath.Join(snapshots, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	primary.CloseStorage()
+
+	copies := map[string]*Database{"promoted standby": standby.Promote()}
+	recovered := NewTwoPhaseLockingDatabase()
+	if _, err := recovered.AttachStorage(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer recovered.CloseStorage()
+	copies["recovered"] = recovered
+	for _, name := range []string{"state.json", "state.gob"} {
+		snapshot, err := LoadSnapshot(filepath.Join(snapshots, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored := NewTwoPhaseLockingDatabase()
+		if err := restored.Restore(snapshot); err != nil {
+			t.Fatal(err)
+		}
+		copies[name] = restored
+	}
+
+	for name, db := range copies {
+		members, err := db.SMembers("set")
+		if want := []string{"a", "b", "c"}; err != nil || !reflect.DeepEqual(members, want) {
+			t.Errorf("%s: set = %v, %v, want %v", name, members, err, want)
+		}
+		tx := db.BeginTransaction()
+		items, err := db.ListItems(tx, "list")
+		db.Commit(tx)
+		if want := []string{"y", "x"}; err != nil || !reflect.DeepEqual(items, want) {
+			t.Errorf("%s: list = %v, %v, want %v", name, items, err, want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// Pins. A long-running reader outside any transaction, such as a report
+// or a replica catching up, can Pin a key to hold its record against
+// garbage collection and eviction until it calls Unpin. Pins are counted
+// per key: the key stays pinned until every Pin is matched by an Unpin.
+// Under MVCC, Vacuum keeps every version of a pinned key from the one
+// that was current when its first outstanding pin was taken, so versions
+// a later pin took are kept too. On every engine, CollectTombstones keeps
+// the record of a pinned key that was deleted.
+
+// keyPin is the pins held on one key
+type keyPin struct {
+	count int
+	since int64 // MVCC commit timestamp of the version the first pin took
+}
+
+// pinTable is a database's pinned keys. It has its own mutex, taken after
+// the MVCC store's and the stripe locks, so pinning works on every engine.
+type pinTable struct {
+	mu   sync.Mutex
+	keys map[string]*keyPin
+}
+
+// Pin takes a reference on key and returns a copy of its latest committed
+// record. It fails with ErrKeyNotFound if key does not exist or is
+// deleted.
+func (db *Database) Pin(key string) (Record, error) {
+	if s := db.mvcc; s != nil {
+		// Vacuum holds s.mu while it reads the pins, so it sees this one or
+		// runs before the version is found
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	db.rLockKey(key)
+	defer db.rUnlockKey(key)
+	record, exists := db.records.get(key)
+	if !exists || !record.live(db.clock.Now()) {
+		return Record{}, fmt.Errorf("pin %s: %w", key, ErrKeyNotFound)
+	}
+	pinned := *record
+	pinned.Payload = bytes.Clone(record.Payload)
+	pinned.history = nil
+
+	db.pins.mu.Lock()
+	defer db.pins.mu.Unlock()
+	if db.pins.keys == nil {
+		db.pins.keys = make(map[string]*keyPin)
+	}
+	pin, exists := db.pins.keys[key]
+	if !exists {
+		pin = &keyPin{}
+		if db.mvcc != nil {
+			pin.since = db.mvcc.writtenAt(key, record.WrittenBy)
+		}
+		db.pins.keys[key] = pin
+		db.countStat(statPinnedKeys, 1)
+	}
+	pin.count++
+	db.countStat(statPins, 1)
+	return pinned, nil
+}
+
+// Unpin releases a reference Pin took on key. It does nothing if key is
+// not pinned.
+func (db *Database) Unpin(key string) {
+	db.pins.mu.Lock()
+	defer db.pins.mu.Unlock()
+	pin, exists := db.pins.keys[key]
+	if !exists {
+		return
+	}
+	db.countStat(statPins, -1)
+	if pin.count--; pin.count == 0 {
+		delete(db.pins.keys, key)
+		db.countStat(statPinnedKeys, -1)
+	}
+}
+
+// Pins returns how many references are held on key
+func (db *Database) Pins(key string) int {
+	db.pins.mu.Lock()
+	defer db.pins.mu.Unlock()
+	if pin, exists := db.pins.keys[key]; exists {
+		return pin.count
+	}
+	return 0
+}
+
+// writtenAt returns the commit timestamp of the version of key that
+// transaction txID wrote, or of the latest version if txID's is gone. The
+// caller must hold s.mu.
+func (s *mvccStore) writtenAt(key string, txID int) int64 {
+	chain := s.chains[key]
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i].TxID == txID {
+			return chain[i].CommitTS
+		}
+	}
+	if len(chain) == 0 {
+		return 0
+	}
+	return chain[len(chain)-1].CommitTS
+}
+
+// pinnedSince reports whether key is pinned, and under MVCC the commit
+// timestamp of the oldest version its pins hold
+func (db *Database) pinnedSince(key string) (int64, bool) {
+	db.pins.mu.Lock()
+	defer db.pins.mu.Unlock()
+	pin, exists := db.pins.keys[key]
+	if !exists {
+		return 0, false
+	}
+	return pin.since, true
+}
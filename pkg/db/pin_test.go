@@ -0,0 +1,122 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestPinCountsReferences verifies a key stays pinned, and its tombstone
+// uncollected, until every pin is released
+func TestPinCountsReferences(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetTombstoneGracePeriod(0)
+	if _, err := db.Pin("x"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Pin of a missing key: %v, want ErrKeyNotFound", err)
+	}
+
+	tx := db.BeginTransaction()
+	db.PutString(tx, "x", "hello")
+	db.Commit(tx)
+	record, err := db.Pin("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(record.Payload) != "hello" || record.Value != 5 {
+		t.Errorf("Pinned %+v, want x = 5 holding hello", record)
+	}
+	db.Pin("x")
+	if stats := db.Stats(); stats.Pins != 2 || stats.PinnedKeys != 1 {
+		t.Errorf("Pins = %d on %d keys, want 2 on 1", stats.Pins, stats.PinnedKeys)
+	}
+
+	tx = db.BeginTransaction()
+	db.Delete(tx, "x")
+	db.Commit(tx)
+	db.Unpin("x")
+	if n := db.CollectTombstones(); n != 0 {
+		t.Errorf("Collected %d tombstones of a key still pinned, want 0", n)
+	}
+	db.Unpin("x")
+	db.Unpin("x") // Not pinned any more: does nothing
+	if pins := db.Pins("x"); pins != 0 {
+		t.Errorf("x has %d pins, want 0", pins)
+	}
+	if stats := db.Stats(); stats.Pins != 0 || stats.PinnedKeys != 0 {
+		t.Errorf("Pins = %d on %d keys once released, want none", stats.Pins, stats.PinnedKeys)
+	}
+	if n := db.CollectTombstones(); n != 1 {
+		t.Errorf("Collected %d tombstones once unpinned, want 1", n)
+	}
+}
+
+// TestPinKeepsMVCCVersions verifies vacuum keeps every version of a pinned
+// key from the one its first pin took, even once the key is deleted
+func TestPinKeepsMVCCVersions(t *testing.T) {
+	db := NewMVCCDatabase()
+	write := func(value int) {
+		tx := db.BeginTransaction()
+		db.Write(tx, "x", value)
+		db.Commit(tx)
+	}
+	write(1)
+	write(2)
+	if record, _ := db.Pin("x"); record.Value != 2 {
+		t.Errorf("Pinned x = %d, want 2", record.Value)
+	}
+	write(3)
+	db.Pin("x")
+	tx := db.BeginTransaction()
+	db.Delete(tx, "x")
+	db.Commit(tx)
+
+	db.Vacuum()
+	if versions := db.VersionCount("x"); versions != 3 {
+		t.Errorf("x has %d versions while pinned, want 3: from 2 on", versions)
+	}
+	db.Unpin("x")
+	db.Vacuum()
+	if versions := db.VersionCount("x"); versions != 3 {
+		t.Errorf("x has %d versions while pinned once, want 3", versions)
+	}
+	db.Unpin("x")
+	db.Vacuum()
+	if versions := db.VersionCount("x"); versions != 0 {
+		t.Errorf("x has %d versions once unpinned, want 0", versions)
+	}
+}
+
+// TestPinConcurrent pins and unpins keys while they are written and
+// vacuumed, for the race detector
+func TestPinConcurrent(t *testing.T) {
+	for _, engine := range []string{"synchronized", "mvcc"} {
+		t.Run(engine, func(t *testing.T) {
+			db, _ := OpenDatabase(engine)
+			db.BulkLoad(benchmarkKeys(4))
+			var wg sync.WaitGroup
+			for g := 0; g < 4; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					key := fmt.Sprintf("key_%d", g)
+					for i := 0; i < 100; i++ {
+						if _, err := db.Pin(key); err != nil {
+							t.Error(err)
+							return
+						}
+						tx := db.BeginTransaction()
+						db.Update(tx, key, 1)
+						db.Commit(tx)
+						db.Vacuum()
+						db.Unpin(key)
+					}
+				}(g)
+			}
+			wg.Wait()
+			if stats := db.Stats(); stats.Pins != 0 || stats.PinnedKeys != 0 {
+				t.Errorf("Pins = %d on %d keys after every unpin, want none", stats.Pins, stats.PinnedKeys)
+			}
+		})
+	}
+}
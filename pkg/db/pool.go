@@ -0,0 +1,56 @@
+package db
+
+import (
+	"sync"
+)
+
+// Transaction pooling. Every transaction allocates a Transaction, a write
+// set, and the slices of its write order, journal and operation log, which
+// a write-heavy workload begins millions of times. With pooling on, Commit
+// and Abort hand a finished top-level transaction back to its database,
+// and the next Begin reuses it along with its map and slices. The caller
+// must not touch a transaction once it committed or aborted it, not even
+// to read its outcome or operation log, so pooling is off unless
+// SetTransactionPooling turns it on; the benchmarks do.
+
+// SetTransactionPooling turns reuse of finished transactions on or off. It
+// should be called before the database is shared.
+func (db *Database) SetTransactionPooling(on bool) {
+	if !on {
+		db.txPool = nil
+	} else if db.txPool == nil {
+		db.txPool = &sync.Pool{New: func() any { return new(Transaction) }}
+	}
+}
+
+// newTransaction returns a zero transaction, reused from the pool if
+// pooling is on
+func (db *Database) newTransaction() *Transaction {
+	if db.txPool == nil {
+		return new(Transaction)
+	}
+	return db.txPool.Get().(*Transaction)
+}
+
+// recycle returns a finished top-level transaction to the pool, if pooling
+// is on. A nested transaction is left alone: its parent may still be
+// logging to it.
+func (db *Database) recycle(tx *Transaction) {
+	if db.txPool == nil || tx.parent != nil || tx.status == TxActive {
+		return
+	}
+	tx.reset()
+	db.txPool.Put(tx)
+}
+
+// reset zeroes tx but keeps its write set's map and its slices, emptied,
+// for the next transaction to fill
+func (tx *Transaction) reset() {
+	clear(tx.writes)
+	clear(tx.writeOrder)
+	clear(tx.journal)
+	clear(tx.ops.lines)
+	writes, order, journal, lines := tx.writes, tx.writeOrder[:0], tx.journal[:0], tx.ops.lines[:0]
+	*tx = Transaction{writes: writes, writeOrder: order, journal: journal}
+	tx.ops.lines = lines
+}
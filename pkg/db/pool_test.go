@@ -0,0 +1,95 @@
+package db
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// TestPooledTransactionsStartClean commits and aborts transactions with
+// pooling on, and checks the ones begun after them are reused but keep
+// nothing of them
+func TestPooledTransactionsStartClean(t *testing.T) {
+	for _, engine := range EngineVariants() {
+		db, _ := OpenDatabase(engine)
+		simulated(db)
+		db.SetTransactionPooling(true)
+		seen := make(map[*Transaction]bool)
+		reused := 0
+
+		for i := 0; i < 50; i++ {
+			tx := db.BeginTransaction()
+			if seen[tx] {
+				reused++
+			}
+			seen[tx] = true
+			if tx.Aborted || tx.AbortReason != "" || len(tx.writes) != 0 || len(tx.writeOrder) != 0 ||
+				len(tx.journal) != 0 || tx.OperationCount() != 0 || tx.status != TxActive {
+				t.Fatalf("%s: transaction %d begun with %+v", engine, tx.ID, tx)
+			}
+			db.Write(tx, "x", i)
+			db.UpdateOrInsert(tx, "y", 1, 0)
+			if i%3 == 0 {
+				db.Abort(tx)
+			} else if err := db.Commit(tx); err != nil {
+				t.Fatalf("%s: %v", engine, err)
+			}
+		}
+		if reused == 0 {
+			t.Errorf("%s: no transaction reused", engine)
+		}
+
+		check := db.BeginTransaction()
+		x, _ := db.Read(check, "x")
+		y, _ := db.Read(check, "y")
+		db.Commit(check)
+		if x != 49 || y != 33 {
+			t.Errorf("%s: x=%d y=%d, want 49 and 33", engine, x, y)
+		}
+	}
+}
+
+// TestPooledCommitReportsAbort checks Commit still returns why a pooled
+// transaction aborted
+func TestPooledCommitReportsAbort(t *testing.T) {
+	db := NewMVCCDatabase()
+	db.SetTransactionPooling(true)
+	a, b := db.BeginTransaction(), db.BeginTransaction()
+	db.Write(a, "x", 1)
+	db.Write(b, "x", 2)
+	db.Commit(a)
+	if err := db.Commit(b); !errors.Is(err, ErrConflict) {
+		t.Errorf("losing commit returned %v, want a conflict", err)
+	}
+}
+
+// TestPooledTransactionsConcurrent runs pooled transactions from several
+// goroutines, for the race detector
+func TestPooledTransactionsConcurrent(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetProcessingDelays(NoProcessingDelays)
+	db.SetTransactionPooling(true)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				tx := db.BeginTransaction()
+				db.UpdateOrInsert(tx, "counter", 1, 0)
+				if db.Commit(tx) != nil {
+					i--
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	tx := db.BeginTransaction()
+	counter, _ := db.Read(tx, "counter")
+	db.Commit(tx)
+	if counter != 400 {
+		t.Errorf("counter %d, want 400", counter)
+	}
+}
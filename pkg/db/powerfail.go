@@ -0,0 +1,50 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Power failures. With SetSyncCommits, a commit is acknowledged once its
+// record has been written to the WAL and fsynced, so it is on disk when
+// the power fails; without it, records the operating system has not
+// flushed yet are lost with the power, and only a process crash leaves
+// every acknowledged commit behind. A syncing database that dies when its
+// WAL is n bytes long has acknowledged at most the commits whose records
+// lie wholly within those n bytes, and the record being written at the
+// time, if any, is torn at byte n. Cutting a finished run's WAL short at n
+// therefore leaves the disk exactly as that failure would, and recovering
+// from the cut copy must bring back every commit acknowledged by then and
+// nothing of the torn one.
+
+// WALRecordEnd is where a WAL record ends in the log
+type WALRecordEnd struct {
+	TxID int
+	End  int64 // Offset just past the record's newline
+}
+
+// WALRecordEnds returns where each record of the WAL at path ends
+func WALRecordEnds(path string) ([]WALRecordEnd, int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	var ends []WALRecordEnd
+	offset := int64(0)
+	for len(data) > 0 {
+		n := bytes.IndexByte(data, '\n') + 1
+		if n == 0 {
+			break // Torn already; recovery skips it
+		}
+		var record CommitRecord
+		if err := json.Unmarshal(data[:n], &record); err != nil {
+			return nil, 0, fmt.Errorf("%s at offset %d: %w", path, offset, err)
+		}
+		offset += int64(n)
+		ends = append(ends, WALRecordEnd{TxID: record.TxID, End: offset})
+		data = data[n:]
+	}
+	return ends, offset, nil
+}
@@ -0,0 +1,190 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Priorities. A transaction begun with a context from WithPriority has a
+// priority, higher being more urgent. The lock manager hands a released
+// lock to the most urgent waiter, and a Processor runs the most urgent
+// ready work first.
+//
+// Priorities alone invite priority inversion: a low-priority transaction
+// holding a lock that a high-priority one waits for gets no processor time
+// while medium-priority work is ready, so the high-priority transaction
+// waits for the medium-priority work too, for as long as there is any.
+// With priority inheritance a lock holder runs at the priority of the most
+// urgent transaction waiting for it, directly or through a chain of locks,
+// so it finishes and hands over the lock before medium-priority work runs.
+
+// priorityKey is the context key of WithPriority
+type priorityKey struct{}
+
+// WithPriority returns a context whose transactions run at priority;
+// higher is more urgent, and transactions without one run at 0
+func WithPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// priorityFrom returns the priority ctx gives its transactions, 0 if none
+func priorityFrom(ctx context.Context) int {
+	if ctx == nil {
+		return 0
+	}
+	priority, _ := ctx.Value(priorityKey{}).(int)
+	return priority
+}
+
+// SetPriority records txID's priority until ReleaseAll
+func (lm *LockManager) SetPriority(txID int, priority int) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.priorities[txID] = priority
+}
+
+// SetPriorityInheritance turns priority inheritance on or off
+func (lm *LockManager) SetPriorityInheritance(enabled bool) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.inheritance = enabled
+}
+
+// EffectivePriority returns the priority txID runs at: its own, or with
+// priority inheritance that of the most urgent transaction waiting for a
+// lock it holds, if higher
+func (lm *LockManager) EffectivePriority(txID int) int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.effectivePriority(txID, make(map[int]bool))
+}
+
+// effectivePriority is EffectivePriority with lm.mu held, skipping the
+// transactions in seen, which wait-for cycles would otherwise revisit
+func (lm *LockManager) effectivePriority(txID int, seen map[int]bool) int {
+	seen[txID] = true
+	priority := lm.priorities[txID]
+	if !lm.inheritance {
+		return priority
+	}
+	for _, key := range lm.held[txID] {
+		lock := lm.locks[key]
+		if lock == nil || lock.owner != txID {
+			continue
+		}
+		for _, waiter := range lock.queue {
+			if !seen[waiter.txID] {
+				priority = max(priority, lm.effectivePriority(waiter.txID, seen))
+			}
+		}
+	}
+	return priority
+}
+
+// nextWaiter returns the index in queue of the waiter to hand a lock to:
+// the first of the most urgent. Must be called with lm.mu held.
+func (lm *LockManager) nextWaiter(queue []*lockWaiter) int {
+	if len(lm.priorities) == 0 {
+		return 0
+	}
+	next, urgency := 0, lm.effectivePriority(queue[0].txID, make(map[int]bool))
+	for i := 1; i < len(queue); i++ {
+		if p := lm.effectivePriority(queue[i].txID, make(map[int]bool)); p > urgency {
+			next, urgency = i, p
+		}
+	}
+	return next
+}
+
+// SetPriorityInheritance turns priority inheritance on or off under
+// two-phase locking; the other engines take no locks to inherit through
+func (db *Database) SetPriorityInheritance(enabled bool) {
+	if db.locks != nil {
+		db.locks.SetPriorityInheritance(enabled)
+	}
+}
+
+// EffectivePriority returns the priority tx runs at, raised by priority
+// inheritance while it holds a lock a more urgent transaction waits for
+func (db *Database) EffectivePriority(tx *Transaction) int {
+	if db.locks == nil {
+		return tx.Priority
+	}
+	return max(tx.Priority, db.locks.EffectivePriority(tx.ID))
+}
+
+// A Processor simulates a single processor shared by transactions'
+// computation. It runs work a quantum at a time, and at the end of each
+// quantum hands the processor to the ready transaction with the highest
+// effective priority, so urgent work preempts less urgent work within a
+// quantum.
+type Processor struct {
+	db      *Database
+	quantum time.Duration
+
+	mu      sync.Mutex
+	busy    bool
+	seq     int64
+	waiting []*processorWaiter
+}
+
+// processorWaiter is a transaction ready to run on the processor
+type processorWaiter struct {
+	tx      *Transaction
+	seq     int64 // Arrival order, breaking ties between equal priorities
+	granted chan struct{}
+}
+
+// NewProcessor returns an idle processor that schedules db's transactions
+// by their effective priority, switching every quantum
+func NewProcessor(db *Database, quantum time.Duration) *Processor {
+	return &Processor{db: db, quantum: quantum}
+}
+
+// Run performs work of computation for tx, waiting for the processor
+// before each quantum
+func (p *Processor) Run(tx *Transaction, work time.Duration) {
+	for work > 0 {
+		p.acquire(tx)
+		slice := min(p.quantum, work)
+		time.Sleep(slice)
+		work -= slice
+		p.release()
+	}
+}
+
+// acquire blocks until tx is given the processor
+func (p *Processor) acquire(tx *Transaction) {
+	p.mu.Lock()
+	if !p.busy {
+		p.busy = true
+		p.mu.Unlock()
+		return
+	}
+	p.seq++
+	waiter := &processorWaiter{tx: tx, seq: p.seq, granted: make(chan struct{})}
+	p.waiting = append(p.waiting, waiter)
+	p.mu.Unlock()
+	<-waiter.granted
+}
+
+// release gives the processor to the most urgent waiter, by effective
+// priority at this moment, or leaves it idle
+func (p *Processor) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.waiting) == 0 {
+		p.busy = false
+		return
+	}
+	next, urgency := 0, p.db.EffectivePriority(p.waiting[0].tx)
+	for i := 1; i < len(p.waiting); i++ {
+		if priority := p.db.EffectivePriority(p.waiting[i].tx); priority > urgency {
+			next, urgency = i, priority
+		}
+	}
+	waiter := p.waiting[next]
+	p.waiting = append(p.waiting[:next], p.waiting[next+1:]...)
+	close(waiter.granted)
+}
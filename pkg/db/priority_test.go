@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestLockHandOffByPriority verifies a released lock goes to the most
+// urgent waiter rather than the first
+func TestLockHandOffByPriority(t *testing.T) {
+	lm := NewLockManager()
+	lm.SetPriority(3, 10)
+	lm.Acquire(1, "k")
+
+	granted := make(chan int, 2)
+	for _, id := range []int{2, 3} {
+		go func(id int) {
+			lm.Acquire(id, "k")
+			granted <- id
+			lm.ReleaseAll(id)
+		}(id)
+		time.Sleep(5 * time.Millisecond) // Tx 2 queues first
+	}
+	lm.ReleaseAll(1)
+	if first := <-granted; first != 3 {
+		t.Errorf("tx %d got the lock first, expected the urgent tx 3", first)
+	}
+	<-granted
+}
+
+// TestPriorityInheritanceChain verifies a lock holder inherits the
+// priority of a transaction waiting for it through another waiter, and
+// only while inheritance is on
+func TestPriorityInheritanceChain(t *testing.T) {
+	lm := NewLockManager()
+	lm.SetPriority(3, 10)
+	lm.Acquire(1, "a")
+	lm.Acquire(2, "b")
+	go lm.Acquire(2, "a") // 2 waits for 1
+	go lm.Acquire(3, "b") // 3 waits for 2
+	time.Sleep(10 * time.Millisecond)
+
+	if p := lm.EffectivePriority(1); p != 0 {
+		t.Errorf("priority %d without inheritance, expected 0", p)
+	}
+	lm.SetPriorityInheritance(true)
+	if p := lm.EffectivePriority(1); p != 10 {
+		t.Errorf("priority %d inherited through the chain, expected 10", p)
+	}
+	lm.ReleaseAll(1)
+	lm.ReleaseAll(2)
+	lm.ReleaseAll(3)
+}
+
+// TestTransactionPriorityFromContext verifies transactions take their
+// priority from their context
+func TestTransactionPriorityFromContext(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	tx := db.BeginTransactionCtx(WithPriority(context.Background(), 7))
+	if tx.Priority != 7 || db.EffectivePriority(tx) != 7 {
+		t.Errorf("priority %d, effective %d, expected 7", tx.Priority, db.EffectivePriority(tx))
+	}
+	db.Commit(tx)
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProbeTarget is a replicated system as consistency probes see it: writes
+// go to one place, reads may be served by any replica
+type ProbeTarget struct {
+	Name       string
+	NeverStale bool // The mode promises reads never miss an acknowledged write
+	Write      func(value int) bool
+	Read       func() (int, bool)
+	Close      func()
+}
+
+// StalenessReport summarizes what reader probes observed for one
+// consistency mode. A read is stale when a newer write had already been
+// acknowledged; its staleness is how long ago that newer write was
+// acknowledged.
+type StalenessReport struct {
+	Mode       string
+	Reads      int
+	StaleReads int
+	P50        time.Duration // Percentiles over stale reads only
+	P90        time.Duration
+	P99        time.Duration
+	Max        time.Duration
+	MaxBehind  int // Most versions a read was behind the latest acknowledged write
+}
+
+// StaleFraction is the share of reads that returned stale data
+func (r StalenessReport) StaleFraction() float64 {
+	if r.Reads == 0 {
+		return 0
+	}
+	return float64(r.StaleReads) / float64(r.Reads)
+}
+
+// stalenessProbe tracks when each probe write was acknowledged
+type stalenessProbe struct {
+	mu       sync.Mutex
+	ackedAt  []time.Time // ackedAt[i] is when value i+1 was acknowledged
+	observed []time.Duration
+	reads    int
+	behind   int
+}
+
+// acked records that value was acknowledged at t. Values are written in
+// order, starting at 1.
+func (p *stalenessProbe) acked(value int, t time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.ackedAt) < value {
+		p.ackedAt = append(p.ackedAt, t)
+	}
+}
+
+// latest returns the newest acknowledged value and the current time. A
+// read that starts now must return at least that value to be fresh.
+func (p *stalenessProbe) latest() (int, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.ackedAt), time.Now()
+}
+
+// observe records a read that started at start, when latest was the
+// newest acknowledged value, and returned value
+func (p *stalenessProbe) observe(value int, latest int, start time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.reads++
+	if value >= latest {
+		return
+	}
+	// Stale since the first write newer than the value read was acknowledged
+	p.observed = append(p.observed, start.Sub(p.ackedAt[value]))
+	if latest-value > p.behind {
+		p.behind = latest - value
+	}
+}
+
+// report computes the staleness distribution
+func (p *stalenessProbe) report(mode string) StalenessReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	report := StalenessReport{
+		Mode:       mode,
+		Reads:      p.reads,
+		StaleReads: len(p.observed),
+		MaxBehind:  p.behind,
+	}
+	if len(p.observed) == 0 {
+		return report
+	}
+
+	sorted := append([]time.Duration(nil), p.observed...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(q float64) time.Duration {
+		return sorted[int(q*float64(len(sorted)-1))]
+	}
+	report.P50 = percentile(0.50)
+	report.P90 = percentile(0.90)
+	report.P99 = percentile(0.99)
+	report.Max = sorted[len(sorted)-1]
+	return report
+}
+
+// ProbeConsistency runs one writer probe that writes increasing values
+// and numReaders reader probes that read them back continuously, for the
+// given duration, and reports the staleness the readers observed
+func ProbeConsistency(ctx context.Context, target ProbeTarget, numReaders int, duration time.Duration) StalenessReport {
+	probe := &stalenessProbe{}
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for value := 1; ctx.Err() == nil; value++ {
+			if target.Write(value) {
+				probe.acked(value, time.Now())
+			}
+			time.Sleep(200 * time.Microsecond)
+		}
+	}()
+
+	for i := 0; i < numReaders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				latest, start := probe.latest()
+				value, _ := target.Read()
+				probe.observe(value, latest, start)
+				time.Sleep(50 * time.Microsecond)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if target.Close != nil {
+		target.Close()
+	}
+	return probe.report(target.Name)
+}
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// TestStalenessProbeMeasuresFromNewerAck verifies staleness is counted
+// from when the first newer write was acknowledged
+func TestStalenessProbeMeasuresFromNewerAck(t *testing.T) {
+	probe := &stalenessProbe{}
+	start := time.Now()
+	probe.acked(1, start)
+	probe.acked(2, start.Add(10*time.Millisecond))
+	probe.acked(3, start.Add(20*time.Millisecond))
+
+	probe.observe(3, 3, start.Add(30*time.Millisecond)) // fresh
+	probe.observe(1, 3, start.Add(30*time.Millisecond)) // stale since value 2
+
+	report := probe.report("test")
+	if report.Reads != 2 || report.StaleReads != 1 {
+		t.Fatalf("Reads/stale = %d/%d, want 2/1", report.Reads, report.StaleReads)
+	}
+	if report.Max != 20*time.Millisecond || report.MaxBehind != 2 {
+		t.Errorf("Staleness = %v, %d behind; want 20ms, 2 behind", report.Max, report.MaxBehind)
+	}
+}
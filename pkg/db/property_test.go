@@ -0,0 +1,265 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// Property-based tests. testing/quick generates random programs, a few
+// small transactions over a handful of keys, and each is run twice: one
+// transaction at a time on a fresh database, which gives the states the
+// program may end in, and with every transaction on its own goroutine on
+// each isolating engine, which must end in one of them. A failing program
+// is printed with the seed that generated it.
+
+// propertyKeys are the keys generated programs use, each starting at 0
+var propertyKeys = []string{"k0", "k1", "k2"}
+
+// propertyEngines are the engines whose transactions must be serializable
+// at Serializable; under MVCC that is serializable snapshot isolation
+var propertyEngines = map[string]func() *Database{
+	"two-phase-locking":  func() *Database { return NewTwoPhaseLockingDatabase() },
+	"mvcc":               func() *Database { return NewMVCCDatabase() },
+	"timestamp-ordering": func() *Database { return NewTimestampOrderingDatabase() },
+}
+
+// propertyOp is one operation of a generated transaction
+type propertyOp struct {
+	Kind  OpKind // OpRead, OpWrite or OpUpdate
+	Key   string
+	Value int // The delta of an update; added to the sum read so far by a write
+}
+
+func (op propertyOp) String() string {
+	switch op.Kind {
+	case OpRead:
+		return "read " + op.Key
+	case OpWrite:
+		return fmt.Sprintf("%s = reads+%d", op.Key, op.Value)
+	default:
+		return fmt.Sprintf("%s += %d", op.Key, op.Value)
+	}
+}
+
+// propertyProgram is a generated set of transactions
+type propertyProgram [][]propertyOp
+
+func (p propertyProgram) String() string {
+	var b strings.Builder
+	for i, tx := range p {
+		ops := make([]string, len(tx))
+		for j, op := range tx {
+			ops[j] = op.String()
+		}
+		fmt.Fprintf(&b, "\n  T%d: %s", i+1, strings.Join(ops, "; "))
+	}
+	return b.String()
+}
+
+// generateProgram returns two to five transactions of one to four
+// operations each, only updates if commutative
+func generateProgram(rng *rand.Rand, commutative bool) propertyProgram {
+	program := make(propertyProgram, 2+rng.Intn(4))
+	for i := range program {
+		tx := make([]propertyOp, 1+rng.Intn(4))
+		for j := range tx {
+			op := propertyOp{Kind: OpUpdate, Key: propertyKeys[rng.Intn(len(propertyKeys))], Value: rng.Intn(21) - 10}
+			if !commutative {
+				op.Kind = []OpKind{OpRead, OpWrite, OpUpdate}[rng.Intn(3)]
+			}
+			tx[j] = op
+		}
+		program[i] = tx
+	}
+	return program
+}
+
+// commutativeProgram is a program of updates only, which end in the same
+// state in every order
+type commutativeProgram struct{ propertyProgram }
+
+func (commutativeProgram) Generate(rng *rand.Rand, _ int) reflect.Value {
+	return reflect.ValueOf(commutativeProgram{generateProgram(rng, true)})
+}
+
+// mixedProgram is a program of reads, writes of what was read, and updates
+type mixedProgram struct{ propertyProgram }
+
+func (mixedProgram) Generate(rng *rand.Rand, _ int) reflect.Value {
+	return reflect.ValueOf(mixedProgram{generateProgram(rng, false)})
+}
+
+// runPropertyTx runs ops as one Serializable transaction of db, starting
+// over after a backoff until it commits. Without the backoff timestamp
+// ordering can starve a transaction that keeps restarting behind younger
+// ones.
+func runPropertyTx(ctx context.Context, db *Database, ops []propertyOp) error {
+	for attempt := 1; ; attempt++ {
+		if attempt > 200 {
+			return fmt.Errorf("no commit after %d attempts", attempt-1)
+		}
+		if attempt > 1 {
+			db.Clock().Sleep(DefaultRetryPolicy.backoff(attempt))
+		}
+		tx := db.Begin(ctx, Serializable)
+		var err error
+		read := 0
+		for _, op := range ops {
+			switch op.Kind {
+			case OpRead:
+				var value int
+				value, err = db.Get(tx, op.Key)
+				read += value
+			case OpWrite:
+				err = db.Put(tx, op.Key, read+op.Value)
+			default:
+				err = db.Add(tx, op.Key, op.Value)
+			}
+			if err != nil {
+				break
+			}
+		}
+		if err != nil {
+			db.Abort(tx)
+			continue
+		}
+		if db.Commit(tx) == nil {
+			return nil
+		}
+	}
+}
+
+// newPropertyDB returns a database from open holding propertyKeys
+func newPropertyDB(open func() *Database) *Database {
+	db := open()
+	db.SetLockTimeout(5 * time.Millisecond)
+	tx := db.BeginTransaction()
+	for _, key := range propertyKeys {
+		db.Put(tx, key, 0)
+	}
+	db.Commit(tx)
+	return db
+}
+
+// propertyState returns the values of propertyKeys in db
+func propertyState(db *Database) string {
+	entries := db.TakeSnapshot().Entries
+	values := make([]string, len(propertyKeys))
+	for i, key := range propertyKeys {
+		values[i] = fmt.Sprintf("%s=%d", key, entries[key].Value)
+	}
+	return strings.Join(values, " ")
+}
+
+// serialStates returns the state program ends in for every order of its
+// transactions, run one at a time
+func serialStates(program propertyProgram) map[string][]int {
+	states := make(map[string][]int)
+	var permute func(order []int, rest []int)
+	permute = func(order []int, rest []int) {
+		if len(rest) == 0 {
+			// Nothing runs concurrently, so the processing time need not
+			// pass
+			db := newPropertyDB(func() *Database { return simulated(NewUnsynchronizedDatabase()) })
+			for _, i := range order {
+				runPropertyTx(context.Background(), db, program[i])
+			}
+			state := propertyState(db)
+			if _, seen := states[state]; !seen {
+				states[state] = append([]int(nil), order...)
+			}
+			return
+		}
+		for i := range rest {
+			next := append(append([]int(nil), rest[:i]...), rest[i+1:]...)
+			permute(append(order, rest[i]), next)
+		}
+	}
+	all := make([]int, len(program))
+	for i := range all {
+		all[i] = i
+	}
+	permute(nil, all)
+	return states
+}
+
+// runConcurrently runs every transaction of program on its own goroutine
+// on a fresh database from open and returns the state it ends in. The
+// database keeps the real clock, whose processing delays let the
+// transactions interleave.
+func runConcurrently(t *testing.T, open func() *Database, program propertyProgram) string {
+	db := newPropertyDB(open)
+	var wg sync.WaitGroup
+	for i, ops := range program {
+		wg.Add(1)
+		go func(client int, ops []propertyOp) {
+			defer wg.Done()
+			if err := runPropertyTx(WithClient(context.Background(), client), db, ops); err != nil {
+				t.Errorf("T%d: %v", client, err)
+			}
+		}(i+1, ops)
+	}
+	wg.Wait()
+	return propertyState(db)
+}
+
+// propertyConfig returns a quick configuration running count programs,
+// seeded with a seed it logs for reproducing a failure
+func propertyConfig(t *testing.T, count int) *quick.Config {
+	seed := NewRunSeed()
+	t.Logf("programs generated with seed %d", seed)
+	return &quick.Config{MaxCount: count, Rand: rand.New(rand.NewSource(seed))}
+}
+
+// TestPropertyCommutativeUpdates checks that concurrent programs of
+// updates end in the state they end in when run sequentially
+func TestPropertyCommutativeUpdates(t *testing.T) {
+	for name, open := range propertyEngines {
+		t.Run(name, func(t *testing.T) {
+			err := quick.Check(func(p commutativeProgram) bool {
+				var want string
+				for state := range serialStates(p.propertyProgram) {
+					want = state // Every order gives the same state
+				}
+				if got := runConcurrently(t, open, p.propertyProgram); got != want {
+					t.Logf("program:%v\nran concurrently to %s, sequentially to %s", p, got, want)
+					return false
+				}
+				return true
+			}, propertyConfig(t, 30))
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestPropertySerializable checks that concurrent programs of reads,
+// writes and updates end in a state some serial order of their
+// transactions also ends in
+func TestPropertySerializable(t *testing.T) {
+	for name, open := range propertyEngines {
+		t.Run(name, func(t *testing.T) {
+			err := quick.Check(func(p mixedProgram) bool {
+				states := serialStates(p.propertyProgram)
+				got := runConcurrently(t, open, p.propertyProgram)
+				if _, serial := states[got]; !serial {
+					t.Logf("program:%v\nran concurrently to %s, which no serial order gives (%d orders give %d states)",
+						p, got, len(p.propertyProgram), len(states))
+					return false
+				}
+				return true
+			}, propertyConfig(t, 30))
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
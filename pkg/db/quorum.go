@@ -0,0 +1,363 @@
+package db
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// versionedValue is a replica's copy of a key. Versions come from the
+// coordinator's clock, and replicas keep the highest one they have seen
+// (last writer wins).
+type versionedValue struct {
+	Value   int
+	Version int64
+	Deleted bool
+}
+
+// newer reports whether v should replace other
+func (v versionedValue) newer(other versionedValue) bool {
+	return v.Version > other.Version
+}
+
+// hintedWrite is a write meant for a replica that was down, kept by
+// another replica until the intended one comes back
+type hintedWrite struct {
+	Target int
+	Key    string
+	Value  versionedValue
+}
+
+// quorumReplica is one copy of the data in a quorum cluster
+type quorumReplica struct {
+	id    int
+	mu    sync.Mutex
+	data  map[string]versionedValue
+	hints []hintedWrite // Writes this replica holds for unreachable ones
+	down  atomic.Bool   // Partitioned away from the coordinator
+}
+
+// apply stores value if it is newer than the replica's copy and reports
+// whether it did
+func (r *quorumReplica) apply(key string, value versionedValue) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if current, exists := r.data[key]; exists && !value.newer(current) {
+		return false
+	}
+	r.data[key] = value
+	return true
+}
+
+// get returns the replica's copy of key
+func (r *quorumReplica) get(key string) (versionedValue, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value, exists := r.data[key]
+	return value, exists
+}
+
+// QuorumStats counts what a quorum cluster did, including how often its
+// replicas were found to disagree and got repaired
+type QuorumStats struct {
+	Writes       int
+	Reads        int
+	FailedWrites int // Fewer than W replicas reachable
+	FailedReads  int // Fewer than R replicas reachable
+
+	DroppedReplications int // Background replica writes lost to a partition
+
+	StaleReads  int // Replica copies a read found older than the newest
+	ReadRepairs int // Stale replica copies fixed by read repair
+
+	AntiEntropyRounds      int
+	AntiEntropyDivergences int // Keys found differing between two replicas
+	AntiEntropyRepairs     int // Replica copies fixed by anti-entropy
+
+	HintsStored    int // Writes parked on another replica for a down one
+	HintsDelivered int // Hints handed to their replica after it recovered
+}
+
+// QuorumCluster keeps N copies of every key. A write is acknowledged once
+// W replicas have it and reaches the others in the background; a read asks
+// R replicas and returns the newest version among them. With R + W > N
+// every read quorum overlaps the last write quorum.
+type QuorumCluster struct {
+	replicas []*quorumReplica
+	r, w     int
+	clock    atomic.Int64 // Version source for writes
+
+	lag time.Duration // Delay before background replica writes land
+
+	hintedHandoff bool // Park writes for down replicas on reachable ones
+
+	rngMu sync.Mutex
+	rng   *rand.Rand
+
+	statsMu sync.Mutex
+	stats   QuorumStats
+	pending sync.WaitGroup // Background replica writes in flight
+}
+
+// NewQuorumCluster creates a cluster of n replicas with read quorum r and
+// write quorum w
+func NewQuorumCluster(n, r, w int) *QuorumCluster {
+	if r < 1 || w < 1 || r > n || w > n {
+		panic(fmt.Sprintf("invalid quorum N=%d R=%d W=%d", n, r, w))
+	}
+	c := &QuorumCluster{
+		r:   r,
+		w:   w,
+		rng: rand.New(rand.NewSource(NewRunSeed())),
+	}
+	for i := 0; i < n; i++ {
+		c.replicas = append(c.replicas, &quorumReplica{
+			id:   i,
+			data: make(map[string]versionedValue),
+		})
+	}
+	return c
+}
+
+// String describes the quorum configuration, e.g. "quorum(N=3,R=2,W=2)"
+func (c *QuorumCluster) String() string {
+	return fmt.Sprintf("quorum(N=%d,R=%d,W=%d)", len(c.replicas), c.r, c.w)
+}
+
+// SetReplicationLag sets how long writes take to reach the replicas
+// outside the write quorum
+func (c *QuorumCluster) SetReplicationLag(lag time.Duration) {
+	c.lag = lag
+}
+
+// SetHintedHandoff makes writes that cannot reach a replica leave a hint
+// on a reachable one, to be delivered when the replica comes back
+func (c *QuorumCluster) SetHintedHandoff(enabled bool) {
+	c.hintedHandoff = enabled
+}
+
+// Partition cuts the given replicas off from the coordinator
+func (c *QuorumCluster) Partition(ids ...int) {
+	for _, id := range ids {
+		c.replicas[id].down.Store(true)
+	}
+}
+
+// Reconnect brings the given replicas back and delivers the hints other
+// replicas kept for them
+func (c *QuorumCluster) Reconnect(ids ...int) {
+	for _, id := range ids {
+		c.replicas[id].down.Store(false)
+	}
+	c.DeliverHints()
+}
+
+// Heal reconnects every replica
+func (c *QuorumCluster) Heal() {
+	for _, replica := range c.replicas {
+		replica.down.Store(false)
+	}
+	c.DeliverHints()
+}
+
+// Quiesce waits for background replica writes to land
+func (c *QuorumCluster) Quiesce() {
+	c.pending.Wait()
+}
+
+// reachable returns the replicas the coordinator can talk to, starting at
+// a random one so load spreads over the cluster
+func (c *QuorumCluster) reachable() []*quorumReplica {
+	c.rngMu.Lock()
+	start := c.rng.Intn(len(c.replicas))
+	c.rngMu.Unlock()
+
+	up := make([]*quorumReplica, 0, len(c.replicas))
+	for i := range c.replicas {
+		replica := c.replicas[(start+i)%len(c.replicas)]
+		if !replica.down.Load() {
+			up = append(up, replica)
+		}
+	}
+	return up
+}
+
+// count updates the cluster statistics
+func (c *QuorumCluster) count(update func(*QuorumStats)) {
+	c.statsMu.Lock()
+	update(&c.stats)
+	c.statsMu.Unlock()
+}
+
+// Put writes key on a write quorum and reports whether W replicas
+// acknowledged it
+func (c *QuorumCluster) Put(key string, value int) bool {
+	return c.write(key, versionedValue{Value: value})
+}
+
+// Delete writes a tombstone for key on a write quorum
+func (c *QuorumCluster) Delete(key string) bool {
+	return c.write(key, versionedValue{Deleted: true})
+}
+
+// write versions value and sends it to W replicas synchronously and to the
+// remaining reachable replicas in the background
+func (c *QuorumCluster) write(key string, value versionedValue) bool {
+	up := c.reachable()
+	if len(up) < c.w {
+		c.count(func(s *QuorumStats) { s.FailedWrites++ })
+		return false
+	}
+	value.Version = c.clock.Add(1)
+
+	for _, replica := range up[:c.w] {
+		replica.apply(key, value)
+	}
+	for _, replica := range up[c.w:] {
+		c.pending.Add(1)
+		go func(replica *quorumReplica) {
+			defer c.pending.Done()
+			time.Sleep(c.lag)
+			if replica.down.Load() {
+				// Went down while the write was on its way
+				if !c.storeHint(replica.id, key, value) {
+					c.count(func(s *QuorumStats) { s.DroppedReplications++ })
+				}
+				return
+			}
+			replica.apply(key, value)
+		}(replica)
+	}
+	if c.hintedHandoff && len(up) < len(c.replicas) {
+		reached := make(map[int]bool, len(up))
+		for _, replica := range up {
+			reached[replica.id] = true
+		}
+		for _, replica := range c.replicas {
+			if !reached[replica.id] {
+				c.storeHint(replica.id, key, value)
+			}
+		}
+	}
+
+	c.count(func(s *QuorumStats) { s.Writes++ })
+	return true
+}
+
+// storeHint parks a write for an unreachable replica on a reachable one.
+// It returns false if hinted handoff is off or no replica is reachable.
+func (c *QuorumCluster) storeHint(target int, key string, value versionedValue) bool {
+	if !c.hintedHandoff {
+		return false
+	}
+	if replica := c.replicas[target]; !replica.down.Load() {
+		// Back already: no need to park the write
+		replica.apply(key, value)
+		return true
+	}
+	up := c.reachable()
+	if len(up) == 0 {
+		return false
+	}
+
+	holder := up[0]
+	holder.mu.Lock()
+	holder.hints = append(holder.hints, hintedWrite{Target: target, Key: key, Value: value})
+	holder.mu.Unlock()
+
+	c.count(func(s *QuorumStats) { s.HintsStored++ })
+	return true
+}
+
+// DeliverHints hands every hint held by a reachable replica to its target
+// if the target is reachable again, and returns how many were delivered.
+// Hints for replicas that are still down stay where they are.
+func (c *QuorumCluster) DeliverHints() int {
+	delivered := 0
+	for _, holder := range c.replicas {
+		if holder.down.Load() {
+			continue
+		}
+
+		holder.mu.Lock()
+		var ready, waiting []hintedWrite
+		for _, hint := range holder.hints {
+			if c.replicas[hint.Target].down.Load() {
+				waiting = append(waiting, hint)
+			} else {
+				ready = append(ready, hint)
+			}
+		}
+		holder.hints = waiting
+		holder.mu.Unlock()
+
+		for _, hint := range ready {
+			c.replicas[hint.Target].apply(hint.Key, hint.Value)
+		}
+		delivered += len(ready)
+	}
+
+	c.count(func(s *QuorumStats) { s.HintsDelivered += delivered })
+	return delivered
+}
+
+// Get reads key from R replicas and returns the newest value among them.
+// Replicas in the read quorum that returned an older copy are repaired
+// with the newest one before Get returns (read repair).
+// ok is false if fewer than R replicas were reachable.
+func (c *QuorumCluster) Get(key string) (value int, exists bool, ok bool) {
+	up := c.reachable()
+	if len(up) < c.r {
+		c.count(func(s *QuorumStats) { s.FailedReads++ })
+		return 0, false, false
+	}
+
+	quorum := up[:c.r]
+	copies := make([]versionedValue, len(quorum))
+	var newest versionedValue
+	for i, replica := range quorum {
+		copies[i], _ = replica.get(key)
+		if copies[i].newer(newest) {
+			newest = copies[i]
+		}
+	}
+
+	stale, repaired := 0, 0
+	for i, replica := range quorum {
+		if newest.newer(copies[i]) {
+			stale++
+			if replica.apply(key, newest) {
+				repaired++
+			}
+		}
+	}
+
+	c.count(func(s *QuorumStats) {
+		s.Reads++
+		s.StaleReads += stale
+		s.ReadRepairs += repaired
+	})
+	if newest.Version == 0 || newest.Deleted {
+		return 0, false, true
+	}
+	return newest.Value, true, true
+}
+
+// Stats returns the cluster's statistics
+func (c *QuorumCluster) Stats() QuorumStats {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	return c.stats
+}
+
+// ReplicaValue returns replica id's copy of key, bypassing the quorum
+func (c *QuorumCluster) ReplicaValue(id int, key string) (int, bool) {
+	stored, found := c.replicas[id].get(key)
+	if !found || stored.Deleted {
+		return 0, false
+	}
+	return stored.Value, true
+}
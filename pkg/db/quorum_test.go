@@ -0,0 +1,112 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestReadRepairFixesStaleReplica verifies a read quorum that includes a
+// replica which missed a write brings it up to date
+func TestReadRepairFixesStaleReplica(t *testing.T) {
+	cluster := NewQuorumCluster(3, 3, 2)
+	cluster.Put("x", 1)
+	cluster.Quiesce()
+
+	cluster.Partition(2)
+	cluster.Put("x", 2)
+	cluster.Quiesce()
+	cluster.Heal()
+
+	if value, _ := cluster.ReplicaValue(2, "x"); value != 1 {
+		t.Fatalf("Partitioned replica has x=%d, want the stale 1", value)
+	}
+	if value, _, _ := cluster.Get("x"); value != 2 {
+		t.Errorf("Quorum read returned x=%d, want 2", value)
+	}
+	if value, _ := cluster.ReplicaValue(2, "x"); value != 2 {
+		t.Errorf("Read repair left replica 2 with x=%d, want 2", value)
+	}
+	if stats := cluster.Stats(); stats.ReadRepairs != 1 {
+		t.Errorf("Read repairs = %d, want 1", stats.ReadRepairs)
+	}
+}
+
+// TestAntiEntropyConverges verifies one anti-entropy round after a
+// partition makes every replica identical, deletes included
+func TestAntiEntropyConverges(t *testing.T) {
+	cluster := NewQuorumCluster(3, 2, 2)
+	for i := 0; i < 20; i++ {
+		cluster.Put(fmt.Sprintf("key_%d", i), i)
+	}
+	cluster.Quiesce()
+
+	cluster.Partition(0)
+	for i := 0; i < 20; i += 2 {
+		cluster.Put(fmt.Sprintf("key_%d", i), i*100)
+	}
+	cluster.Delete("key_1")
+	cluster.Quiesce()
+	cluster.Heal()
+
+	if cluster.DivergentKeys() != 11 {
+		t.Fatalf("Divergent keys after partition = %d, want 11", cluster.DivergentKeys())
+	}
+	if found := cluster.AntiEntropy(); found != 11 {
+		t.Errorf("Anti-entropy found %d divergences, want 11", found)
+	}
+	if remaining := cluster.DivergentKeys(); remaining != 0 {
+		t.Errorf("%d keys still differ after anti-entropy", remaining)
+	}
+	if _, exists := cluster.ReplicaValue(0, "key_1"); exists {
+		t.Error("Delete was not propagated to replica 0")
+	}
+	if found := cluster.AntiEntropy(); found != 0 {
+		t.Errorf("Second round found %d divergences in converged replicas", found)
+	}
+}
+
+// TestMerkleDiffFindsChangedBucket verifies the tree comparison narrows a
+// difference down to the bucket holding the changed key
+func TestMerkleDiffFindsChangedBucket(t *testing.T) {
+	data := make(map[string]versionedValue)
+	for i := 0; i < 100; i++ {
+		data[fmt.Sprintf("key_%d", i)] = versionedValue{Value: i, Version: int64(i + 1)}
+	}
+	a := buildMerkleTree(data)
+
+	if diff := a.diff(buildMerkleTree(data)); len(diff) != 0 {
+		t.Errorf("Identical data differs in buckets %v", diff)
+	}
+
+	data["key_42"] = versionedValue{Value: -1, Version: 1000}
+	diff := a.diff(buildMerkleTree(data))
+	if len(diff) != 1 || diff[0] != merkleBucket("key_42") {
+		t.Errorf("Diff = %v, want only bucket %d", diff, merkleBucket("key_42"))
+	}
+}
+
+// TestHintedHandoffDeliversOnRecovery verifies writes a replica missed
+// while down are handed to it when it comes back
+func TestHintedHandoffDeliversOnRecovery(t *testing.T) {
+	cluster := NewQuorumCluster(3, 2, 2)
+	cluster.SetHintedHandoff(true)
+
+	cluster.Partition(1)
+	for i := 0; i < 5; i++ {
+		cluster.Put(fmt.Sprintf("key_%d", i), i)
+	}
+	cluster.Delete("key_0")
+	cluster.Quiesce()
+
+	if _, exists := cluster.ReplicaValue(1, "key_3"); exists {
+		t.Fatal("Partitioned replica received a write")
+	}
+
+	cluster.Reconnect(1)
+	if stats := cluster.Stats(); stats.HintsStored != 6 || stats.HintsDelivered != 6 {
+		t.Errorf("Hints stored/delivered = %d/%d, want 6/6", stats.HintsStored, stats.HintsDelivered)
+	}
+	if cluster.DivergentKeys() != 0 {
+		t.Errorf("%d keys differ after hints were delivered", cluster.DivergentKeys())
+	}
+}
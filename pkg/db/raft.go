@@ -0,0 +1,794 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A RaftCluster replicates a log of write sets over a few nodes with the
+// Raft consensus algorithm: the nodes elect a leader, the leader appends
+// each proposed write set to its log and copies it to the others, and an
+// entry is committed once a majority holds it. Every node applies
+// committed entries in log order to its own Database, so all of them go
+// through the same states, and a write acknowledged to a client survives
+// any minority of crashed nodes. Messages are function calls through the
+// cluster, which drops those to or from a crashed node. A node's term,
+// vote and log are its persistent state and survive a crash; its commit
+// index and database are rebuilt from the log when it restarts.
+
+var (
+	// errNotLeader means a proposal reached a node that is not, or stopped
+	// being, the leader; the entry may still commit under a new leader
+	errNotLeader = errors.New("not the raft leader")
+
+	// errNodeDown means the node a proposal reached crashed before the
+	// entry was applied
+	errNodeDown = errors.New("raft node is down")
+)
+
+// RaftRole is the part a node plays in its current term
+type RaftRole int
+
+const (
+	// RaftFollower replicates the leader's log and votes in elections
+	RaftFollower RaftRole = iota
+	// RaftCandidate is asking for votes to become leader
+	RaftCandidate
+	// RaftLeader accepts proposals and replicates its log
+	RaftLeader
+)
+
+func (r RaftRole) String() string {
+	switch r {
+	case RaftFollower:
+		return "follower"
+	case RaftCandidate:
+		return "candidate"
+	case RaftLeader:
+		return "leader"
+	default:
+		return fmt.Sprintf("RaftRole(%d)", int(r))
+	}
+}
+
+// RaftStatus describes one node
+type RaftStatus struct {
+	ID          int
+	Role        RaftRole
+	Term        int
+	LastIndex   int // Index of the last log entry
+	CommitIndex int // Highest entry known to be committed
+	Applied     int // Highest entry applied to the node's database
+	Crashed     bool
+}
+
+// raftEntry is one log entry: a write set proposed in Term, by a client
+// as its Seq'th proposal
+type raftEntry struct {
+	Term   int
+	Client int64            // 0 for a new leader's no-op or a read barrier
+	Seq    int64            // Numbered from 1 within the client
+	Writes []CommittedWrite // Empty for a new leader's no-op or a read barrier
+}
+
+// raftWaiter is a proposal waiting to be applied
+type raftWaiter struct {
+	term int
+	done chan error
+}
+
+// voteRequest and voteReply are the RequestVote RPC
+type voteRequest struct {
+	Term         int
+	Candidate    int
+	LastLogIndex int
+	LastLogTerm  int
+}
+
+type voteReply struct {
+	Term    int
+	Granted bool
+}
+
+// appendRequest and appendReply are the AppendEntries RPC, which also
+// serves as the leader's heartbeat
+type appendRequest struct {
+	Term         int
+	Leader       int
+	PrevIndex    int
+	PrevTerm     int
+	Entries      []raftEntry
+	LeaderCommit int
+}
+
+type appendReply struct {
+	Term      int
+	Success   bool
+	LastIndex int // Follower's last log index, to skip back over a mismatch
+}
+
+// RaftNode is one member of a RaftCluster
+type RaftNode struct {
+	id      int
+	cluster *RaftCluster
+
+	mu       sync.Mutex
+	crashed  bool
+	role     RaftRole
+	term     int
+	votedFor int         // Candidate voted for this term; -1 for none
+	log      []raftEntry // log[0] is a sentinel, so entries are numbered from 1
+	leaderID int         // -1 when unknown
+
+	commitIndex      int
+	lastApplied      int
+	db               *Database
+	sessions         map[int64]int64 // Highest Seq applied per client; rebuilt with db
+	electionDeadline time.Time
+	rng              *rand.Rand // Draws the election timeouts, from the cluster's seed
+
+	// Leader state, reset on election
+	nextIndex  []int
+	matchIndex []int
+	inflight   []bool // An AppendEntries to the peer is awaiting its reply
+	waiters    map[int]raftWaiter
+}
+
+// RaftCluster is a group of nodes replicating one log
+type RaftCluster struct {
+	nodes           []*RaftNode
+	heartbeat       time.Duration
+	electionTimeout time.Duration // Each wait is randomized between this and twice this
+	clock           Clock         // Times heartbeats and elections, and the nodes' databases
+	seed            int64         // Seeds the nodes' election timeouts
+
+	elections atomic.Int64
+	clients   atomic.Int64 // Last client ID handed out
+	stop      chan struct{}
+	stopOnce  sync.Once
+	wg        sync.WaitGroup
+}
+
+// raftMaxBatch is the most entries one AppendEntries carries
+const raftMaxBatch = 64
+
+// NewRaftCluster starts a cluster of size nodes, which elect a leader
+// among themselves within a few election timeouts. Their timeouts are
+// drawn from the run's seed (see RunSeed).
+func NewRaftCluster(size int) *RaftCluster {
+	return NewRaftClusterWithClock(size, RealClock)
+}
+
+// NewRaftClusterWithClock is NewRaftCluster with heartbeats, election
+// timeouts and the nodes' databases on clock
+func NewRaftClusterWithClock(size int, clock Clock) *RaftCluster {
+	c := &RaftCluster{
+		heartbeat:       2 * time.Millisecond,
+		electionTimeout: 15 * time.Millisecond,
+		clock:           clock,
+		seed:            NewRunSeed(),
+		stop:            make(chan struct{}),
+	}
+	for i := 0; i < size; i++ {
+		n := &RaftNode{
+			id:       i,
+			cluster:  c,
+			votedFor: -1,
+			log:      []raftEntry{{}},
+			leaderID: -1,
+			db:       c.newNodeDB(),
+			sessions: make(map[int64]int64),
+			rng:      rand.New(rand.NewSource(c.seed + int64(i))),
+		}
+		n.resetElectionDeadline()
+		c.nodes = append(c.nodes, n)
+	}
+	for _, n := range c.nodes {
+		c.wg.Add(1)
+		go n.run()
+	}
+	return c
+}
+
+// newNodeDB returns an empty database for a node
+func (c *RaftCluster) newNodeDB() *Database {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetClock(c.clock)
+	return db
+}
+
+// Close stops every node
+func (c *RaftCluster) Close() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+		c.wg.Wait()
+	})
+}
+
+// Seed returns the seed the nodes' election timeouts were drawn from
+func (c *RaftCluster) Seed() int64 {
+	return c.seed
+}
+
+// Size returns how many nodes the cluster has
+func (c *RaftCluster) Size() int {
+	return len(c.nodes)
+}
+
+// Elections returns how many elections nodes have started
+func (c *RaftCluster) Elections() int {
+	return int(c.elections.Load())
+}
+
+// Leader returns the live leader of the latest term, if there is one
+func (c *RaftCluster) Leader() (id int, ok bool) {
+	if n := c.leader(); n != nil {
+		return n.id, true
+	}
+	return -1, false
+}
+
+// Status returns the state of every node
+func (c *RaftCluster) Status() []RaftStatus {
+	statuses := make([]RaftStatus, len(c.nodes))
+	for i, n := range c.nodes {
+		statuses[i] = n.Status()
+	}
+	return statuses
+}
+
+// Node returns node id
+func (c *RaftCluster) Node(id int) *RaftNode {
+	return c.nodes[id]
+}
+
+// Crash stops node id: it answers no messages until Restart, and a
+// proposal waiting on it fails
+func (c *RaftCluster) Crash(id int) {
+	n := c.nodes[id]
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.crashed = true
+	n.role = RaftFollower
+	n.leaderID = -1
+	n.failWaiters(errNodeDown)
+}
+
+// Restart brings node id back as a follower with its persistent state.
+// Its database starts empty and is rebuilt as it learns which entries are
+// committed.
+func (c *RaftCluster) Restart(id int) {
+	n := c.nodes[id]
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.crashed = false
+	n.role = RaftFollower
+	n.commitIndex = 0
+	n.lastApplied = 0
+	n.db = c.newNodeDB()
+	n.sessions = make(map[int64]int64)
+	n.resetElectionDeadline()
+}
+
+// A RaftClient is a session through which writes are proposed. A proposal
+// whose leader fails before it is applied is proposed again, but the first
+// attempt may still commit, leaving the write in the log twice. Each entry
+// therefore carries its client's ID and a sequence number, and a node
+// skips an entry whose client already had that number applied, so a write
+// takes effect once however often it commits, and another client's write
+// committed in between is not overwritten by the repeat.
+type RaftClient struct {
+	cluster *RaftCluster
+	id      int64
+
+	mu  sync.Mutex // Proposals go one at a time, in sequence order
+	seq int64
+}
+
+// NewClient opens a session on the cluster
+func (c *RaftCluster) NewClient() *RaftClient {
+	return &RaftClient{cluster: c, id: c.clients.Add(1)}
+}
+
+// Put sets key to value once a majority has committed the write
+func (rc *RaftClient) Put(ctx context.Context, key string, value int) error {
+	return rc.Apply(ctx, []CommittedWrite{{Key: key, Value: value}})
+}
+
+// Apply commits writes as one log entry, applied atomically and at most
+// once on every node. It is proposed to the leader and proposed again if
+// the leader fails first, until ctx is done.
+func (rc *RaftClient) Apply(ctx context.Context, writes []CommittedWrite) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.seq++
+	_, _, err := rc.cluster.commit(ctx, raftEntry{Client: rc.id, Seq: rc.seq, Writes: writes})
+	return err
+}
+
+// Put sets key to value once a majority has committed the write
+func (c *RaftCluster) Put(ctx context.Context, key string, value int) error {
+	return c.Apply(ctx, []CommittedWrite{{Key: key, Value: value}})
+}
+
+// Remove deletes key once a majority has committed the delete
+func (c *RaftCluster) Remove(ctx context.Context, key string) error {
+	return c.Apply(ctx, []CommittedWrite{{Key: key, Deleted: true}})
+}
+
+// Apply commits writes as one log entry, applied atomically and at most
+// once on every node, through a session of its own (see RaftClient)
+func (c *RaftCluster) Apply(ctx context.Context, writes []CommittedWrite) error {
+	return c.NewClient().Apply(ctx, writes)
+}
+
+// Get reads key linearizably: it commits an empty entry through the
+// leader and reads the leader's database once that entry is applied, so
+// the read sees every write acknowledged before it started.
+func (c *RaftCluster) Get(ctx context.Context, key string) (int, error) {
+	for {
+		n, index, err := c.commit(ctx, raftEntry{})
+		if err != nil {
+			return 0, err
+		}
+		n.mu.Lock()
+		if !n.crashed && n.lastApplied >= index {
+			value, err := ReadKey(n.db, key)
+			n.mu.Unlock()
+			return value, err
+		}
+		// The node restarted and has not reapplied the barrier yet
+		n.mu.Unlock()
+	}
+}
+
+// commit proposes entry to the leader until an attempt is applied,
+// returning the node and the index it was applied at
+func (c *RaftCluster) commit(ctx context.Context, entry raftEntry) (*RaftNode, int, error) {
+	for {
+		if n := c.leader(); n != nil {
+			index, done, err := n.propose(entry)
+			if err == nil {
+				select {
+				case err = <-done:
+					if err == nil {
+						return n, index, nil
+					}
+				case <-ctx.Done():
+					return nil, 0, fmt.Errorf("raft entry not committed: %w", ctx.Err())
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, 0, fmt.Errorf("raft entry not committed: %w", ctx.Err())
+		case <-time.After(c.heartbeat):
+		}
+	}
+}
+
+// leader returns the live leader with the highest term
+func (c *RaftCluster) leader() *RaftNode {
+	var leader *RaftNode
+	leaderTerm := -1
+	for _, n := range c.nodes {
+		n.mu.Lock()
+		if !n.crashed && n.role == RaftLeader && n.term > leaderTerm {
+			leader, leaderTerm = n, n.term
+		}
+		n.mu.Unlock()
+	}
+	return leader
+}
+
+// requestVote delivers a RequestVote, reporting false if either end is down
+func (c *RaftCluster) requestVote(from, to int, req voteRequest) (voteReply, bool) {
+	if c.nodes[from].down() {
+		return voteReply{}, false
+	}
+	return c.nodes[to].handleRequestVote(req)
+}
+
+// appendEntries delivers an AppendEntries, reporting false if either end
+// is down
+func (c *RaftCluster) appendEntries(from, to int, req appendRequest) (appendReply, bool) {
+	if c.nodes[from].down() {
+		return appendReply{}, false
+	}
+	return c.nodes[to].handleAppendEntries(req)
+}
+
+// DB returns the node's database, which holds every entry it has applied.
+// It is read-only by convention, and replaced when the node restarts.
+func (n *RaftNode) DB() *Database {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.db
+}
+
+// Status returns the node's state
+func (n *RaftNode) Status() RaftStatus {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return RaftStatus{
+		ID:          n.id,
+		Role:        n.role,
+		Term:        n.term,
+		LastIndex:   len(n.log) - 1,
+		CommitIndex: n.commitIndex,
+		Applied:     n.lastApplied,
+		Crashed:     n.crashed,
+	}
+}
+
+// down reports whether the node is crashed
+func (n *RaftNode) down() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.crashed
+}
+
+// run ticks the node every heartbeat until the cluster closes
+func (n *RaftNode) run() {
+	defer n.cluster.wg.Done()
+
+	for {
+		tick := n.cluster.clock.NewTimer(n.cluster.heartbeat)
+		select {
+		case <-n.cluster.stop:
+			tick.Stop()
+			return
+		case <-tick.C():
+		}
+
+		n.mu.Lock()
+		switch {
+		case n.crashed:
+			n.mu.Unlock()
+		case n.role == RaftLeader:
+			n.mu.Unlock()
+			n.broadcast()
+		case n.cluster.clock.Now().After(n.electionDeadline):
+			n.startElection()
+		default:
+			n.mu.Unlock()
+		}
+	}
+}
+
+// resetElectionDeadline picks when the node next stands for election if
+// it hears from no leader. Must be called with n.mu held.
+func (n *RaftNode) resetElectionDeadline() {
+	timeout := n.cluster.electionTimeout
+	n.electionDeadline = n.cluster.clock.Now().Add(timeout + time.Duration(n.rng.Int63n(int64(timeout))))
+}
+
+// startElection makes the node a candidate for the next term and asks the
+// others for their votes. Must be called with n.mu held; it unlocks it.
+func (n *RaftNode) startElection() {
+	n.role = RaftCandidate
+	n.term++
+	n.votedFor = n.id
+	n.leaderID = -1
+	n.resetElectionDeadline()
+	req := voteRequest{
+		Term:         n.term,
+		Candidate:    n.id,
+		LastLogIndex: len(n.log) - 1,
+		LastLogTerm:  n.log[len(n.log)-1].Term,
+	}
+	votes := 1
+	if votes > len(n.cluster.nodes)/2 {
+		n.becomeLeader()
+	}
+	n.mu.Unlock()
+	n.cluster.elections.Add(1)
+
+	for _, peer := range n.cluster.nodes {
+		if peer.id == n.id {
+			continue
+		}
+		go func(peer int) {
+			reply, ok := n.cluster.requestVote(n.id, peer, req)
+			if !ok {
+				return
+			}
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if reply.Term > n.term {
+				n.becomeFollower(reply.Term)
+				return
+			}
+			if n.role != RaftCandidate || n.term != req.Term || !reply.Granted {
+				return
+			}
+			votes++
+			if votes > len(n.cluster.nodes)/2 {
+				n.becomeLeader()
+			}
+		}(peer.id)
+	}
+}
+
+// becomeLeader takes over the log. It appends a no-op so that entries of
+// earlier terms get committed along with it. Must be called with n.mu held.
+func (n *RaftNode) becomeLeader() {
+	n.role = RaftLeader
+	n.leaderID = n.id
+	n.log = append(n.log, raftEntry{Term: n.term})
+
+	size := len(n.cluster.nodes)
+	n.nextIndex = make([]int, size)
+	n.matchIndex = make([]int, size)
+	n.inflight = make([]bool, size)
+	n.waiters = make(map[int]raftWaiter)
+	for i := range n.nextIndex {
+		n.nextIndex[i] = len(n.log) - 1
+	}
+	n.matchIndex[n.id] = len(n.log) - 1
+	n.advanceCommit()
+	go n.broadcast()
+}
+
+// becomeFollower steps down, adopting term if it is newer. Must be called
+// with n.mu held.
+func (n *RaftNode) becomeFollower(term int) {
+	if term > n.term {
+		n.term = term
+		n.votedFor = -1
+	}
+	if n.role != RaftFollower {
+		n.failWaiters(errNotLeader)
+		n.role = RaftFollower
+		n.resetElectionDeadline()
+	}
+}
+
+// failWaiters fails every proposal waiting on the node. Must be called
+// with n.mu held.
+func (n *RaftNode) failWaiters(err error) {
+	for index, w := range n.waiters {
+		w.done <- err
+		delete(n.waiters, index)
+	}
+}
+
+// propose appends entry to the leader's log in its current term, returning
+// the entry's index and a channel that reports whether it was applied
+func (n *RaftNode) propose(entry raftEntry) (int, <-chan error, error) {
+	n.mu.Lock()
+	if n.crashed || n.role != RaftLeader {
+		n.mu.Unlock()
+		return 0, nil, errNotLeader
+	}
+	entry.Term = n.term
+	n.log = append(n.log, entry)
+	index := len(n.log) - 1
+	n.matchIndex[n.id] = index
+	done := make(chan error, 1)
+	n.waiters[index] = raftWaiter{term: n.term, done: done}
+	n.advanceCommit()
+	n.mu.Unlock()
+
+	n.broadcast()
+	return index, done, nil
+}
+
+// broadcast sends each follower the entries it is missing, or a heartbeat
+// if it has them all, unless the last message to it is still unanswered
+func (n *RaftNode) broadcast() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.crashed || n.role != RaftLeader {
+		return
+	}
+	for peer := range n.cluster.nodes {
+		if peer == n.id || n.inflight[peer] {
+			continue
+		}
+		prev := n.nextIndex[peer] - 1
+		last := min(len(n.log)-1, prev+raftMaxBatch)
+		req := appendRequest{
+			Term:         n.term,
+			Leader:       n.id,
+			PrevIndex:    prev,
+			PrevTerm:     n.log[prev].Term,
+			Entries:      append([]raftEntry(nil), n.log[prev+1:last+1]...),
+			LeaderCommit: n.commitIndex,
+		}
+		n.inflight[peer] = true
+		go n.replicate(peer, req)
+	}
+}
+
+// replicate sends req to peer and processes the reply
+func (n *RaftNode) replicate(peer int, req appendRequest) {
+	reply, ok := n.cluster.appendEntries(n.id, peer, req)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.role != RaftLeader || n.term != req.Term {
+		if reply.Term > n.term {
+			n.becomeFollower(reply.Term)
+		}
+		return
+	}
+	n.inflight[peer] = false
+	if !ok {
+		return
+	}
+	if reply.Term > n.term {
+		n.becomeFollower(reply.Term)
+		return
+	}
+	if reply.Success {
+		n.matchIndex[peer] = max(n.matchIndex[peer], req.PrevIndex+len(req.Entries))
+		n.nextIndex[peer] = n.matchIndex[peer] + 1
+		n.advanceCommit()
+	} else {
+		// Back up to the follower's log, or past the mismatched entry
+		n.nextIndex[peer] = max(1, min(req.PrevIndex, reply.LastIndex+1))
+	}
+}
+
+// advanceCommit commits the newest entry of the current term that a
+// majority holds, and everything before it. Must be called with n.mu held.
+func (n *RaftNode) advanceCommit() {
+	for index := len(n.log) - 1; index > n.commitIndex && n.log[index].Term == n.term; index-- {
+		count := 0
+		for _, match := range n.matchIndex {
+			if match >= index {
+				count++
+			}
+		}
+		if count > len(n.cluster.nodes)/2 {
+			n.commitIndex = index
+			n.applyCommitted()
+			return
+		}
+	}
+}
+
+// applyCommitted applies committed entries to the database in log order,
+// skipping repeats of a client's proposals, and reports each to its
+// waiting proposal. Must be called with n.mu held.
+func (n *RaftNode) applyCommitted() {
+	for n.lastApplied < n.commitIndex {
+		n.lastApplied++
+		entry := n.log[n.lastApplied]
+		if len(entry.Writes) > 0 && !n.duplicate(entry) {
+			n.db.applyRecord(CommitRecord{Seq: int64(n.lastApplied), Writes: entry.Writes})
+		}
+		if w, ok := n.waiters[n.lastApplied]; ok {
+			delete(n.waiters, n.lastApplied)
+			if w.term == entry.Term {
+				w.done <- nil
+			} else {
+				// Another leader's entry replaced the proposal
+				w.done <- errNotLeader
+			}
+		}
+	}
+}
+
+// duplicate reports whether entry repeats a proposal its client already
+// had applied, and records it as applied otherwise. Must be called with
+// n.mu held.
+func (n *RaftNode) duplicate(entry raftEntry) bool {
+	if entry.Client == 0 {
+		return false
+	}
+	if entry.Seq <= n.sessions[entry.Client] {
+		return true
+	}
+	n.sessions[entry.Client] = entry.Seq
+	return false
+}
+
+// handleRequestVote grants a vote to a candidate whose log is at least as
+// up to date as the node's, once per term
+func (n *RaftNode) handleRequestVote(req voteRequest) (voteReply, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.crashed {
+		return voteReply{}, false
+	}
+	if req.Term > n.term {
+		n.becomeFollower(req.Term)
+	}
+
+	reply := voteReply{Term: n.term}
+	lastIndex := len(n.log) - 1
+	lastTerm := n.log[lastIndex].Term
+	upToDate := req.LastLogTerm > lastTerm || (req.LastLogTerm == lastTerm && req.LastLogIndex >= lastIndex)
+	if req.Term == n.term && (n.votedFor == -1 || n.votedFor == req.Candidate) && upToDate {
+		n.votedFor = req.Candidate
+		n.resetElectionDeadline()
+		reply.Granted = true
+	}
+	return reply, true
+}
+
+// handleAppendEntries appends the leader's entries after checking the log
+// matches up to them, replacing any conflicting entries
+func (n *RaftNode) handleAppendEntries(req appendRequest) (appendReply, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.crashed {
+		return appendReply{}, false
+	}
+	if req.Term > n.term || (req.Term == n.term && n.role == RaftCandidate) {
+		n.becomeFollower(req.Term)
+	}
+
+	reply := appendReply{Term: n.term, LastIndex: len(n.log) - 1}
+	if req.Term < n.term {
+		return reply, true
+	}
+	n.leaderID = req.Leader
+	n.resetElectionDeadline()
+	if req.PrevIndex >= len(n.log) || n.log[req.PrevIndex].Term != req.PrevTerm {
+		return reply, true
+	}
+
+	for i, entry := range req.Entries {
+		index := req.PrevIndex + 1 + i
+		if index < len(n.log) {
+			if n.log[index].Term == entry.Term {
+				continue
+			}
+			n.log = n.log[:index:index]
+		}
+		n.log = append(n.log, entry)
+	}
+	if req.LeaderCommit > n.commitIndex {
+		n.commitIndex = max(n.commitIndex, min(req.LeaderCommit, req.PrevIndex+len(req.Entries)))
+		n.applyCommitted()
+	}
+	reply.Success = true
+	reply.LastIndex = len(n.log) - 1
+	return reply, true
+}
+
+// WaitForLeader waits until the cluster has a leader, or ctx is done
+func (c *RaftCluster) WaitForLeader(ctx context.Context) (int, error) {
+	for {
+		if id, ok := c.Leader(); ok {
+			return id, nil
+		}
+		select {
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		case <-time.After(c.heartbeat):
+		}
+	}
+}
+
+// Settle waits until every live node has applied everything the leader
+// has committed, or until ctx is done
+func (c *RaftCluster) Settle(ctx context.Context) error {
+	for {
+		if id, ok := c.Leader(); ok {
+			target := c.nodes[id].Status().CommitIndex
+			settled := true
+			for _, status := range c.Status() {
+				if !status.Crashed && status.Applied < target {
+					settled = false
+				}
+			}
+			if settled {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.heartbeat):
+		}
+	}
+}
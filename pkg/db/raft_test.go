@@ -0,0 +1,187 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestRaftElectsOneLeader verifies a new cluster elects a single leader
+// that the others follow
+func TestRaftElectsOneLeader(t *testing.T) {
+	cluster := NewRaftCluster(3)
+	defer cluster.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	leader, err := cluster.WaitForLeader(ctx)
+	if err != nil {
+		t.Fatalf("No leader elected: %v", err)
+	}
+	if err := cluster.Put(ctx, "key", 1); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	leaders := 0
+	for _, status := range cluster.Status() {
+		if status.Role == RaftLeader {
+			leaders++
+			if status.ID != leader {
+				t.Errorf("Node %d leads, expected node %d", status.ID, leader)
+			}
+		}
+	}
+	if leaders != 1 {
+		t.Errorf("Expected one leader, got %d", leaders)
+	}
+}
+
+// TestRaftReplicatesWrites verifies committed writes and deletes reach
+// every node and linearizable reads see them
+func TestRaftReplicatesWrites(t *testing.T) {
+	cluster := NewRaftCluster(3)
+	defer cluster.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 1; i <= 10; i++ {
+		if err := cluster.Put(ctx, "counter", i); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	cluster.Put(ctx, "doomed", 1)
+	if err := cluster.Remove(ctx, "doomed"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if value, err := cluster.Get(ctx, "counter"); err != nil || value != 10 {
+		t.Errorf("Expected counter 10, got %d (%v)", value, err)
+	}
+
+	if err := cluster.Settle(ctx); err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	for id := 0; id < cluster.Size(); id++ {
+		db := cluster.Node(id).DB()
+		if value, err := ReadKey(db, "counter"); err != nil || value != 10 {
+			t.Errorf("Node %d: expected counter 10, got %d (%v)", id, value, err)
+		}
+		if _, err := ReadKey(db, "doomed"); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("Node %d: expected the deleted key to be gone, got %v", id, err)
+		}
+	}
+}
+
+// TestRaftSurvivesLeaderCrash verifies the remaining majority elects a new
+// leader that keeps every acknowledged write, and that the crashed node
+// catches up when it restarts
+func TestRaftSurvivesLeaderCrash(t *testing.T) {
+	cluster := NewRaftCluster(3)
+	defer cluster.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := cluster.Put(ctx, "before", 1); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	old, _ := cluster.Leader()
+	cluster.Crash(old)
+
+	if err := cluster.Put(ctx, "after", 2); err != nil {
+		t.Fatalf("Put after the crash: %v", err)
+	}
+	leader, _ := cluster.Leader()
+	if leader == old {
+		t.Fatalf("Crashed node %d is still the leader", old)
+	}
+	if value, err := cluster.Get(ctx, "before"); err != nil || value != 1 {
+		t.Errorf("Expected the write before the crash to survive, got %d (%v)", value, err)
+	}
+
+	cluster.Restart(old)
+	if err := cluster.Settle(ctx); err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	db := cluster.Node(old).DB()
+	if value, err := ReadKey(db, "after"); err != nil || value != 2 {
+		t.Errorf("Expected the restarted node to catch up, got %d (%v)", value, err)
+	}
+}
+
+// TestRaftSkipsRepeatedProposal verifies a client's write that commits a
+// second time, as a retry after a leader failure can, is applied once and
+// does not overwrite another client's write committed in between, on a
+// restarted node replaying the log too
+func TestRaftSkipsRepeatedProposal(t *testing.T) {
+	cluster := NewRaftCluster(3)
+	defer cluster.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first, second := cluster.NewClient(), cluster.NewClient()
+	if err := first.Put(ctx, "key", 1); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := second.Put(ctx, "key", 2); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	// The first client's write again, as its retry would commit it
+	repeat := raftEntry{Client: first.id, Seq: first.seq, Writes: []CommittedWrite{{Key: "key", Value: 1}}}
+	if _, _, err := cluster.commit(ctx, repeat); err != nil {
+		t.Fatalf("Committing the repeat: %v", err)
+	}
+
+	cluster.Crash(0)
+	cluster.Restart(0)
+	if err := cluster.Settle(ctx); err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	for _, status := range cluster.Status() {
+		if value, err := ReadKey(cluster.Node(status.ID).DB(), "key"); err != nil || value != 2 {
+			t.Errorf("Node %d holds %d (%v), expected the second client's 2", status.ID, value, err)
+		}
+	}
+}
+
+// TestRaftOnSimulatedClock verifies a cluster whose heartbeats and
+// elections run on a simulated clock still elects a leader and commits
+func TestRaftOnSimulatedClock(t *testing.T) {
+	clock := NewSimClock(time.Time{})
+	start := clock.Now()
+	cluster := NewRaftClusterWithClock(3, clock)
+	defer cluster.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := cluster.Put(ctx, "key", 1); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if value, err := cluster.Get(ctx, "key"); err != nil || value != 1 {
+		t.Errorf("Get = %d (%v), expected 1", value, err)
+	}
+	if !clock.Now().After(start.Add(cluster.electionTimeout)) {
+		t.Errorf("The simulated clock reads %v, expected it past the first election timeout", clock.Now())
+	}
+}
+
+// TestRaftNeedsMajority verifies nothing commits while a majority is down
+func TestRaftNeedsMajority(t *testing.T) {
+	cluster := NewRaftCluster(3)
+	defer cluster.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	leader, err := cluster.WaitForLeader(ctx)
+	if err != nil {
+		t.Fatalf("No leader elected: %v", err)
+	}
+	for id := 0; id < cluster.Size(); id++ {
+		if id != leader {
+			cluster.Crash(id)
+		}
+	}
+	short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	if err := cluster.Put(short, "key", 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the write to wait for a majority, got %v", err)
+	}
+}
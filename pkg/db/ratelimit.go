@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A TokenBucket caps the rate transactions start at. It holds up to burst
+// tokens, refilled at rate per second; each transaction takes one, and
+// waits for it when the bucket is empty. Waiters take tokens in the order
+// they arrived, reserving ones not yet refilled, so a cap holds over time
+// even when timers fire late.
+//
+// Capping every engine at the same rate holds the offered load constant,
+// so differences in latency and aborts come from contention alone rather
+// than from faster engines also being driven harder.
+type TokenBucket struct {
+	rate  float64 // Tokens per second
+	burst float64 // Most tokens the bucket holds
+
+	clock Clock // Refills the bucket and times the waits
+
+	mu        sync.Mutex
+	tokens    float64 // Negative when waiters have reserved tokens still to come
+	last      time.Time
+	throttled time.Duration // Total time waited for tokens
+}
+
+// NewTokenBucket returns a full bucket refilled at rate tokens per second
+// of the wall clock and holding up to burst of them; a burst below 1 holds
+// one
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return NewTokenBucketWithClock(rate, burst, RealClock)
+}
+
+// NewTokenBucketWithClock is NewTokenBucket refilled by clock, e.g. the
+// database's the transactions it caps run on
+func NewTokenBucketWithClock(rate float64, burst int, clock Clock) *TokenBucket {
+	b := &TokenBucket{rate: rate, burst: float64(max(burst, 1)), clock: clock, last: clock.Now()}
+	b.tokens = b.burst
+	return b
+}
+
+// Rate returns the bucket's rate in tokens per second
+func (b *TokenBucket) Rate() float64 {
+	return b.rate
+}
+
+// Wait takes a token, waiting until one is due. It returns ctx's error,
+// without a token, if ctx is done first.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := b.clock.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	wait := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	if wait > 0 {
+		b.throttled += wait
+	}
+	b.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := b.clock.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++ // Give back the reservation
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Throttled returns the total time waiters have been held back for
+func (b *TokenBucket) Throttled() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.throttled
+}
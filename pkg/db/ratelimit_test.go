@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestTokenBucketPacesWaiters verifies waiters past the burst are spaced
+// out at the bucket's rate
+func TestTokenBucketPacesWaiters(t *testing.T) {
+	b := NewTokenBucket(1000, 5)
+	start := time.Now()
+	for i := 0; i < 55; i++ {
+		if err := b.Wait(context.Background()); err != nil {
+			t.Fatalf("wait %d: %v", i, err)
+		}
+	}
+	// The first 5 come from the burst, the other 50 at 1ms each
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+		t.Errorf("55 tokens in %v at 1000/s with a burst of 5, expected at least 50ms", elapsed)
+	}
+	if b.Throttled() == 0 {
+		t.Error("no throttled time recorded")
+	}
+}
+
+// TestTokenBucketWaitCancelled verifies a waiter gives up when its context
+// is done, and gives its reserved token back
+func TestTokenBucketWaitCancelled(t *testing.T) {
+	b := NewTokenBucket(10, 1)
+	b.Wait(context.Background()) // Empties the bucket; the next token is 100ms away
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait returned %v, expected the context's deadline", err)
+	}
+	b.mu.Lock()
+	tokens := b.tokens
+	b.mu.Unlock()
+	if tokens < -0.5 {
+		t.Errorf("%.2f tokens after a cancelled wait; the reservation was not returned", tokens)
+	}
+}
@@ -0,0 +1,355 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A primary can stream its commit records to any number of read replicas,
+// each a separate database replaying them asynchronously. Shipping a
+// commit only appends it to every replica's unbounded queue, so the
+// primary never waits for a replica; each replica applies its queue in
+// order, a commit becoming visible there a simulated network delay after
+// the primary shipped it. Replicas serve reads from whatever they have
+// applied so far: cheap, never ahead of the primary, but possibly behind
+// it. Lag reports how far behind.
+//
+// SetQuorum turns the set into a quorum system of N nodes, the primary and
+// its replicas: a commit is acknowledged only once W nodes, the primary
+// included, have applied it, and Get asks R nodes chosen at random and
+// returns the answer of the one furthest along the commit stream. When
+// R + W > N every read quorum overlaps every write quorum, so a read sees
+// every write acknowledged before it; otherwise it can miss one, even the
+// reader's own.
+
+// ReplicaLag describes how far a replica trails its primary
+type ReplicaLag struct {
+	Commits    int64         // Commits shipped to the replica but not yet applied
+	Behind     time.Duration // Age of the oldest commit not yet applied; 0 when caught up
+	Applied    int64         // Commits applied so far
+	MaxCommits int64         // Most commits ever waiting at once
+	MaxBehind  time.Duration // Longest any commit took to be applied after shipping
+}
+
+// shippedCommit is a commit record queued at a replica
+type shippedCommit struct {
+	record CommitRecord
+	at     time.Time // When the primary shipped it
+}
+
+// Replica is an asynchronously replicated read replica of a primary
+type Replica struct {
+	set   *ReplicaSet
+	db    *Database
+	delay time.Duration // Simulated network delay per shipped commit
+
+	mu         sync.Mutex
+	queue      []shippedCommit
+	shipped    int64
+	applied    int64
+	maxCommits int64
+	maxBehind  time.Duration
+
+	wake chan struct{} // Signalled when the queue becomes non-empty
+	stop chan struct{}
+	done chan struct{}
+}
+
+// ReplicaSet is a primary and the read replicas its commits stream to
+type ReplicaSet struct {
+	primary  *Database
+	replicas []*Replica
+	closed   atomic.Bool
+	stopOnce sync.Once
+
+	readQuorum, writeQuorum int
+	shipped                 atomic.Int64 // Commits shipped: the primary's position in the stream
+	rngMu                   sync.Mutex
+	rng                     *rand.Rand // Picks the nodes a read asks
+
+	progressMu sync.Mutex
+	progress   chan struct{} // Closed and replaced whenever a replica applies a commit
+}
+
+// NewReplicaSet subscribes one replica per delay to primary's commit
+// stream, each receiving commits delay after they are shipped. It replaces
+// any commit hook primary had and should be called before primary is
+// shared: replicas start empty and only see commits made after it.
+func NewReplicaSet(primary *Database, delays ...time.Duration) *ReplicaSet {
+	rs := &ReplicaSet{
+		primary:     primary,
+		readQuorum:  1,
+		writeQuorum: 1,
+		rng:         rand.New(rand.NewSource(NewRunSeed())),
+		progress:    make(chan struct{}),
+	}
+	for _, delay := range delays {
+		r := &Replica{
+			set:   rs,
+			db:    NewTwoPhaseLockingDatabase(),
+			delay: delay,
+			wake:  make(chan struct{}, 1),
+			stop:  make(chan struct{}),
+			done:  make(chan struct{}),
+		}
+		rs.replicas = append(rs.replicas, r)
+		go r.replay()
+	}
+	primary.SetCommitHook(rs.ship)
+	return rs
+}
+
+// Primary returns the database the replicas copy
+func (rs *ReplicaSet) Primary() *Database {
+	return rs.primary
+}
+
+// Replicas returns the replicas, in the order of their delays
+func (rs *ReplicaSet) Replicas() []*Replica {
+	return rs.replicas
+}
+
+// SetQuorum sets the read and write quorums R and W, each between 1 and
+// N, the number of replicas plus the primary. The default, R = W = 1, is
+// plain asynchronous replication with reads from any one node. It should
+// be called before the primary is shared.
+func (rs *ReplicaSet) SetQuorum(r, w int) error {
+	n := len(rs.replicas) + 1
+	if r < 1 || r > n || w < 1 || w > n {
+		return fmt.Errorf("quorum R=%d W=%d outside 1..%d", r, w, n)
+	}
+	rs.readQuorum, rs.writeQuorum = r, w
+	return nil
+}
+
+// Quorum returns the number of nodes N and the quorums R and W
+func (rs *ReplicaSet) Quorum() (n, r, w int) {
+	return len(rs.replicas) + 1, rs.readQuorum, rs.writeQuorum
+}
+
+// ship is the primary's commit hook: it queues record at every replica
+// and, with a write quorum above 1, holds the commit until enough of them
+// have applied it
+func (rs *ReplicaSet) ship(record CommitRecord) {
+	if rs.closed.Load() {
+		return
+	}
+	now := time.Now()
+	positions := make([]int64, len(rs.replicas))
+	for i, r := range rs.replicas {
+		r.mu.Lock()
+		r.queue = append(r.queue, shippedCommit{record: record, at: now})
+		r.shipped++
+		positions[i] = r.shipped
+		r.maxCommits = max(r.maxCommits, r.shipped-r.applied)
+		r.mu.Unlock()
+
+		select {
+		case r.wake <- struct{}{}:
+		default:
+		}
+	}
+	rs.shipped.Add(1)
+	if rs.writeQuorum > 1 {
+		rs.awaitWriteQuorum(positions)
+	}
+}
+
+// awaitWriteQuorum waits until the primary and W - 1 replicas have applied
+// the commit each replica has queued at positions, or replication stops
+func (rs *ReplicaSet) awaitWriteQuorum(positions []int64) {
+	for {
+		rs.progressMu.Lock()
+		progress := rs.progress
+		rs.progressMu.Unlock()
+
+		acks := 1 // The primary
+		for i, r := range rs.replicas {
+			r.mu.Lock()
+			if r.applied >= positions[i] {
+				acks++
+			}
+			r.mu.Unlock()
+		}
+		if acks >= rs.writeQuorum || rs.closed.Load() {
+			return
+		}
+		<-progress
+	}
+}
+
+// notifyProgress wakes commits waiting for their write quorum
+func (rs *ReplicaSet) notifyProgress() {
+	rs.progressMu.Lock()
+	close(rs.progress)
+	rs.progress = make(chan struct{})
+	rs.progressMu.Unlock()
+}
+
+// Get reads key from R nodes chosen at random among the primary and the
+// replicas, and returns the answer of the one that has applied the most
+// commits
+func (rs *ReplicaSet) Get(key string) (int, error) {
+	rs.rngMu.Lock()
+	chosen := rs.rng.Perm(len(rs.replicas) + 1)[:rs.readQuorum]
+	rs.rngMu.Unlock()
+
+	freshest := int64(-1)
+	var value int
+	var err error
+	for _, node := range chosen {
+		// Each node's position is taken before reading it, so its answer
+		// is at least that fresh
+		var position int64
+		var v int
+		var e error
+		if node == 0 {
+			position = rs.shipped.Load()
+			v, e = ReadKey(rs.primary, key)
+		} else {
+			r := rs.replicas[node-1]
+			r.mu.Lock()
+			position = r.applied
+			r.mu.Unlock()
+			v, e = r.Get(key)
+		}
+		if position > freshest {
+			freshest, value, err = position, v, e
+		}
+	}
+	return value, err
+}
+
+// CatchUp waits until every replica has applied every commit shipped
+// before the call, or until ctx is done
+func (rs *ReplicaSet) CatchUp(ctx context.Context) error {
+	for _, r := range rs.replicas {
+		if err := r.CatchUp(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops replication; commits still queued, and later ones, are never
+// applied
+func (rs *ReplicaSet) Close() {
+	rs.stopOnce.Do(func() {
+		rs.closed.Store(true)
+		rs.notifyProgress()
+		for _, r := range rs.replicas {
+			close(r.stop)
+			<-r.done
+		}
+	})
+}
+
+// DB returns the replica's database. It is read-only by convention: a
+// write there would be overwritten by, or diverge from, the primary's.
+func (r *Replica) DB() *Database {
+	return r.db
+}
+
+// Get reads key from the replica, in a transaction of its own. The value
+// is the primary's as of the last commit the replica applied.
+func (r *Replica) Get(key string) (int, error) {
+	return ReadKey(r.db, key)
+}
+
+// ReadKey reads key from db in a transaction of its own
+func ReadKey(db *Database, key string) (int, error) {
+	tx := db.BeginTransaction()
+	value, err := db.Get(tx, key)
+	if err != nil {
+		db.Abort(tx)
+		return 0, err
+	}
+	return value, db.Commit(tx)
+}
+
+// Lag reports how far the replica trails its primary
+func (r *Replica) Lag() ReplicaLag {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lag := ReplicaLag{
+		Commits:    r.shipped - r.applied,
+		Applied:    r.applied,
+		MaxCommits: r.maxCommits,
+		MaxBehind:  r.maxBehind,
+	}
+	if len(r.queue) > 0 {
+		lag.Behind = time.Since(r.queue[0].at)
+	}
+	return lag
+}
+
+// CatchUp waits until the replica has applied every commit shipped to it
+// before the call, or until ctx is done
+func (r *Replica) CatchUp(ctx context.Context) error {
+	r.mu.Lock()
+	target := r.shipped
+	r.mu.Unlock()
+
+	for {
+		r.mu.Lock()
+		applied := r.applied
+		r.mu.Unlock()
+		if applied >= target {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.done:
+			return fmt.Errorf("replication stopped with %d commits unapplied", target-applied)
+		case <-time.After(100 * time.Microsecond):
+		}
+	}
+}
+
+// replay applies queued commits in stream order until replication stops
+func (r *Replica) replay() {
+	defer close(r.done)
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-r.wake:
+		}
+
+		for {
+			r.mu.Lock()
+			if len(r.queue) == 0 {
+				r.mu.Unlock()
+				break
+			}
+			next := r.queue[0]
+			r.mu.Unlock()
+
+			// The commit arrives delay after it was shipped; commits shipped
+			// back to back are in flight together
+			if wait := time.Until(next.at.Add(r.delay)); wait > 0 {
+				select {
+				case <-r.stop:
+					return
+				case <-time.After(wait):
+				}
+			}
+			r.db.applyRecord(next.record)
+
+			r.mu.Lock()
+			r.queue[0] = shippedCommit{}
+			r.queue = r.queue[1:]
+			r.applied++
+			r.maxBehind = max(r.maxBehind, time.Since(next.at))
+			r.mu.Unlock()
+			r.set.notifyProgress()
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestReplicasConverge verifies every replica ends up with the primary's
+// state, deletes included, once it has caught up
+func TestReplicasConverge(t *testing.T) {
+	primary := NewTwoPhaseLockingDatabase()
+	rs := NewReplicaSet(primary, 0, time.Millisecond)
+	defer rs.Close()
+
+	for i := 0; i < 20; i++ {
+		if _, err := primary.Incr("counter"); err != nil {
+			t.Fatalf("Incr: %v", err)
+		}
+	}
+	primary.Incr("doomed")
+	tx := primary.BeginTransaction()
+	primary.Remove(tx, "doomed")
+	primary.Commit(tx)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rs.CatchUp(ctx); err != nil {
+		t.Fatalf("CatchUp: %v", err)
+	}
+	for i, r := range rs.Replicas() {
+		if value, err := r.Get("counter"); err != nil || value != 20 {
+			t.Errorf("Replica %d: expected counter 20, got %d (%v)", i, value, err)
+		}
+		if _, err := r.Get("doomed"); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("Replica %d: expected the deleted key to be gone, got %v", i, err)
+		}
+		if lag := r.Lag(); lag.Commits != 0 || lag.Behind != 0 || lag.Applied != 22 {
+			t.Errorf("Replica %d: expected no lag after 22 applied commits, got %+v", i, lag)
+		}
+	}
+}
+
+// TestReplicaServesStaleReads verifies a lagging replica serves the value
+// from before a commit and reports the commit as lag until it arrives
+func TestReplicaServesStaleReads(t *testing.T) {
+	primary := NewTwoPhaseLockingDatabase()
+	rs := NewReplicaSet(primary, 100*time.Millisecond)
+	defer rs.Close()
+	replica := rs.Replicas()[0]
+
+	primary.Incr("counter")
+	if _, err := replica.Get("counter"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected the replica not to have the key yet, got %v", err)
+	}
+	lag := replica.Lag()
+	if lag.Commits != 1 || lag.Behind <= 0 {
+		t.Errorf("Expected 1 commit of lag, got %+v", lag)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := replica.CatchUp(ctx); err != nil {
+		t.Fatalf("CatchUp: %v", err)
+	}
+	if value, err := replica.Get("counter"); err != nil || value != 1 {
+		t.Errorf("Expected counter 1 after catching up, got %d (%v)", value, err)
+	}
+	if lag := replica.Lag(); lag.MaxBehind < 100*time.Millisecond || lag.MaxCommits != 1 {
+		t.Errorf("Expected the worst lag to be the 100ms delay and 1 commit, got %+v", lag)
+	}
+}
+
+// TestReplicaSetClose verifies commits after Close are not replicated and
+// CatchUp reports the replication stopped
+func TestReplicaSetClose(t *testing.T) {
+	primary := NewTwoPhaseLockingDatabase()
+	rs := NewReplicaSet(primary, time.Hour)
+	primary.Incr("counter")
+	rs.Close()
+	primary.Incr("counter")
+
+	replica := rs.Replicas()[0]
+	if lag := replica.Lag(); lag.Commits != 1 || lag.Applied != 0 {
+		t.Errorf("Expected only the commit before Close to be shipped, got %+v", lag)
+	}
+	if err := replica.CatchUp(context.Background()); err == nil {
+		t.Error("Expected CatchUp to fail once replication stopped")
+	}
+}
+
+// TestSetQuorumRejectsOutOfRange verifies R and W must lie within 1..N
+func TestSetQuorumRejectsOutOfRange(t *testing.T) {
+	rs := NewReplicaSet(NewTwoPhaseLockingDatabase(), 0, 0)
+	defer rs.Close()
+
+	for _, q := range [][2]int{{0, 1}, {1, 0}, {4, 1}, {1, 4}} {
+		if err := rs.SetQuorum(q[0], q[1]); err == nil {
+			t.Errorf("Expected R=%d W=%d to be rejected with N=3", q[0], q[1])
+		}
+	}
+	if err := rs.SetQuorum(3, 3); err != nil {
+		t.Fatalf("SetQuorum(3, 3): %v", err)
+	}
+	if n, r, w := rs.Quorum(); n != 3 || r != 3 || w != 3 {
+		t.Errorf("Expected N=3 R=3 W=3, got N=%d R=%d W=%d", n, r, w)
+	}
+}
+
+// TestWriteQuorumWaitsForReplicas verifies a commit with W = N returns
+// only once every replica has applied it
+func TestWriteQuorumWaitsForReplicas(t *testing.T) {
+	primary := NewTwoPhaseLockingDatabase()
+	rs := NewReplicaSet(primary, time.Millisecond, 2*time.Millisecond)
+	defer rs.Close()
+	if err := rs.SetQuorum(1, 3); err != nil {
+		t.Fatalf("SetQuorum: %v", err)
+	}
+
+	for i := 1; i <= 5; i++ {
+		primary.Incr("counter")
+		for _, replica := range rs.Replicas() {
+			if value, err := replica.Get("counter"); err != nil || value != i {
+				t.Fatalf("Expected every replica to hold %d on commit, got %d (%v)", i, value, err)
+			}
+		}
+	}
+}
+
+// TestOverlappingQuorumsReadYourWrites verifies that with R + W > N a
+// quorum read never misses a write acknowledged before it
+func TestOverlappingQuorumsReadYourWrites(t *testing.T) {
+	for _, q := range [][2]int{{1, 3}, {2, 2}, {3, 1}} {
+		primary := NewTwoPhaseLockingDatabase()
+		rs := NewReplicaSet(primary, time.Millisecond, 2*time.Millisecond)
+		if err := rs.SetQuorum(q[0], q[1]); err != nil {
+			t.Fatalf("SetQuorum: %v", err)
+		}
+		for i := 1; i <= 20; i++ {
+			primary.Incr("counter")
+			if value, err := rs.Get("counter"); err != nil || value != i {
+				t.Errorf("R=%d W=%d: expected to read %d, got %d (%v)", q[0], q[1], i, value, err)
+			}
+		}
+		rs.Close()
+	}
+}
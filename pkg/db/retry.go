@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	"database-sync-unsynchronized/pkg/lock"
+)
+
+// RetryPolicy controls how RunTransaction retries conflicting transactions.
+// Under BackoffSleep, the default, attempt n waits a random time up to
+// BaseBackoff<<(n-2), capped at MaxBackoff, so transactions that keep
+// colliding spread out. BackoffYield only gives up the processor before
+// each retry, and BackoffNone retries at once.
+type RetryPolicy struct {
+	MaxAttempts int // Attempts before giving up, the first one included
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	Strategy    BackoffStrategy
+}
+
+// DefaultRetryPolicy is the policy a new database retries with
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 20,
+	BaseBackoff: 100 * time.Microsecond,
+	MaxBackoff:  20 * time.Millisecond,
+}
+
+// backoff returns how long to sleep before attempt number attempt (2 or
+// more); 0 unless the strategy sleeps
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	return lock.Backoff{Strategy: p.Strategy, Base: p.BaseBackoff, Max: p.MaxBackoff}.Delay(attempt - 1)
+}
+
+// wait waits on clock before attempt number attempt as the strategy says,
+// and returns how long it waited. It returns early, with ctx's error, once
+// ctx is done.
+func (p RetryPolicy) wait(ctx context.Context, clock Clock, attempt int) (time.Duration, error) {
+	start := clock.Now()
+	switch p.Strategy {
+	case BackoffSleep:
+		select {
+		case <-clock.After(p.backoff(attempt)):
+		case <-ctx.Done():
+		}
+	case BackoffYield:
+		runtime.Gosched()
+	}
+	return clock.Now().Sub(start), ctx.Err()
+}
+
+// SetRetryPolicy changes how RunTransaction retries. MaxAttempts below 1
+// is treated as 1.
+func (db *Database) SetRetryPolicy(policy RetryPolicy) {
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+	db.retryPolicy = policy
+}
+
+// RunTransaction begins a transaction, runs fn in it and commits it. If fn
+// returns an error the transaction is aborted and the error returned. If
+// the transaction loses a conflict or a lock wait (ErrConflict, ErrDeadlock
+// or ErrTimeout), whether during fn or at commit, it is aborted and run
+// again in a new transaction after a random exponential backoff, up to the
+// retry policy's limit; fn must therefore be safe to run more than once.
+// When every attempt conflicts the error wraps ErrConflict; when the
+// engine aborts it for another reason it wraps ErrTxAborted.
+func (db *Database) RunTransaction(fn func(tx *Transaction) error) error {
+	return db.RunTransactionCtx(context.Background(), fn)
+}
+
+// RunTransactionCtx is RunTransaction with every attempt begun with
+// BeginTransactionCtx(ctx). It stops retrying and returns ctx's error once
+// ctx is done.
+func (db *Database) RunTransactionCtx(ctx context.Context, fn func(tx *Transaction) error) error {
+	db.txMu.Lock()
+	policy := db.retryPolicy
+	db.txMu.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			waited, err := policy.wait(ctx, db.clock, attempt)
+			db.stats.record(func(s *statShard) {
+				s.add(statTransactionRetries, 1)
+				s.add(statBackoffWait, int64(waited))
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		tx, err := db.runAttempt(ctx, fn)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !tx.conflict && !errors.Is(err, ErrConflict) {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			return fmt.Errorf("%w after %d attempts: %w", ErrConflict, attempt, err)
+		}
+	}
+}
+
+// runAttempt runs fn in a new transaction and commits it, or aborts it if
+// fn failed or panicked
+func (db *Database) runAttempt(ctx context.Context, fn func(tx *Transaction) error) (tx *Transaction, err error) {
+	tx = db.BeginTransactionCtx(ctx)
+	defer func() {
+		if r := recover(); r != nil {
+			if !tx.Aborted {
+				db.Abort(tx)
+			}
+			panic(r)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		if !tx.Aborted {
+			db.Abort(tx)
+		}
+		return tx, err
+	}
+	if tx.Aborted {
+		return tx, txError(tx)
+	}
+	return tx, db.Commit(tx)
+}
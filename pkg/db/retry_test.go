@@ -0,0 +1,194 @@
+package db
+
+import (
+	"errors"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRunTransactionRetriesConflicts verifies concurrent read-modify-write
+// increments under MVCC all land once RunTransaction retries the losers
+func TestRunTransactionRetriesConflicts(t *testing.T) {
+	db := NewMVCCDatabase()
+	db.SetRetryPolicy(RetryPolicy{MaxAttempts: 1000, BaseBackoff: 10 * time.Microsecond, MaxBackoff: time.Millisecond})
+	setup := db.BeginTransaction()
+	db.Write(setup, "counter", 0)
+	db.Commit(setup)
+
+	const clients, increments = 4, 25
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				err := db.RunTransaction(func(tx *Transaction) error {
+					value, _ := db.Read(tx, "counter")
+					time.Sleep(50 * time.Microsecond)
+					db.Write(tx, "counter", value+1)
+					return nil
+				})
+				if err != nil {
+					t.Errorf("RunTransaction: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	check := db.BeginTransaction()
+	if value, _ := db.Read(check, "counter"); value != clients*increments {
+		t.Errorf("counter = %d, want %d", value, clients*increments)
+	}
+	db.Commit(check)
+	if db.Stats().TransactionRetries == 0 {
+		t.Error("No transaction was retried; the workload should conflict")
+	}
+}
+
+// TestRunTransactionReturnsClosureError verifies an error from the closure
+// aborts the transaction without a retry
+func TestRunTransactionReturnsClosureError(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	failure := errors.New("insufficient funds")
+	calls := 0
+	err := db.RunTransaction(func(tx *Transaction) error {
+		calls++
+		db.Write(tx, "x", 1)
+		return failure
+	})
+
+	if !errors.Is(err, failure) {
+		t.Errorf("RunTransaction returned %v, want %v", err, failure)
+	}
+	if calls != 1 {
+		t.Errorf("Closure ran %d times, want 1", calls)
+	}
+	check := db.BeginTransaction()
+	if _, exists := db.Read(check, "x"); exists {
+		t.Error("Write of the failed transaction is visible")
+	}
+	db.Commit(check)
+}
+
+// TestRunTransactionGivesUp verifies RunTransaction stops after
+// MaxAttempts conflicting attempts and reports the conflict
+func TestRunTransactionGivesUp(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Microsecond, MaxBackoff: time.Microsecond})
+	calls := 0
+	err := db.RunTransaction(func(tx *Transaction) error {
+		calls++
+		return ErrConflict
+	})
+
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("RunTransaction returned %v, want ErrConflict", err)
+	}
+	if calls != 3 {
+		t.Errorf("Closure ran %d times, want 3", calls)
+	}
+	if retries := db.Stats().TransactionRetries; retries != 2 {
+		t.Errorf("TransactionRetries = %d, want 2", retries)
+	}
+}
+
+// TestRunTransactionDoesNotRetryValidation verifies an abort a retry cannot
+// fix is reported as ErrTxAborted after one attempt
+func TestRunTransactionDoesNotRetryValidation(t *testing.T) {
+	db := NewMVCCDatabase()
+	db.AddValidator(NonNegative())
+	err := db.RunTransaction(func(tx *Transaction) error {
+		db.Write(tx, "balance", -1)
+		return nil
+	})
+
+	if !errors.Is(err, ErrTxAborted) {
+		t.Errorf("RunTransaction returned %v, want ErrTxAborted", err)
+	}
+	if retries := db.Stats().TransactionRetries; retries != 0 {
+		t.Errorf("TransactionRetries = %d, want 0", retries)
+	}
+}
+
+// TestRunTransactionBackoffStrategies verifies only the sleep strategy
+// spends time backing off, and every strategy still retries
+func TestRunTransactionBackoffStrategies(t *testing.T) {
+	for _, strategy := range []BackoffStrategy{BackoffSleep, BackoffYield, BackoffNone} {
+		db := NewMVCCDatabase()
+		db.SetClock(NewSimClock(time.Time{}))
+		db.SetRetryPolicy(RetryPolicy{MaxAttempts: 4, BaseBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond, Strategy: strategy})
+		calls := 0
+		err := db.RunTransaction(func(tx *Transaction) error {
+			if calls++; calls < 4 {
+				return ErrConflict
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: RunTransaction: %v", strategy, err)
+		}
+
+		stats := db.Stats()
+		if stats.TransactionRetries != 3 {
+			t.Errorf("%s: TransactionRetries = %d, want 3", strategy, stats.TransactionRetries)
+		}
+		if sleeps := strategy == BackoffSleep; sleeps != (stats.BackoffWait > 0) || stats.BackoffWait > 30*time.Millisecond {
+			t.Errorf("%s: BackoffWait = %v", strategy, stats.BackoffWait)
+		}
+	}
+}
+
+// BenchmarkHotKeyBackoff increments one key from parallel RunTransaction
+// callers under MVCC, whose losers retry, with each backoff strategy, and
+// reports the median and tail latency of a whole increment, retries
+// included
+func BenchmarkHotKeyBackoff(b *testing.B) {
+	for _, strategy := range []BackoffStrategy{BackoffSleep, BackoffYield, BackoffNone} {
+		b.Run(strategy.String(), func(b *testing.B) {
+			db := NewMVCCDatabase()
+			db.SetProcessingDelays(NoProcessingDelays)
+			db.SetOpLogLimit(0)
+			db.SetRetryPolicy(RetryPolicy{MaxAttempts: 1 << 20, BaseBackoff: time.Microsecond, MaxBackoff: time.Millisecond, Strategy: strategy})
+			db.BulkLoad(map[string]int{"hot": 0})
+
+			var mu sync.Mutex
+			var latencies []time.Duration
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var mine []time.Duration
+				for pb.Next() {
+					start := time.Now()
+					err := db.RunTransaction(func(tx *Transaction) error {
+						value, _ := db.Read(tx, "hot")
+						runtime.Gosched() // Let the other callers collide with this one
+						db.Write(tx, "hot", value+1)
+						return nil
+					})
+					if err != nil {
+						b.Error(err)
+					}
+					mine = append(mine, time.Since(start))
+				}
+				mu.Lock()
+				latencies = append(latencies, mine...)
+				mu.Unlock()
+			})
+			b.StopTimer()
+
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			quantile := func(q float64) float64 {
+				return float64(latencies[int(q*float64(len(latencies)-1))].Nanoseconds())
+			}
+			b.ReportMetric(quantile(0.5), "p50-ns")
+			b.ReportMetric(quantile(0.99), "p99-ns")
+			stats := db.Stats()
+			b.ReportMetric(float64(stats.TransactionRetries)/float64(b.N), "retries/op")
+			b.ReportMetric(float64(stats.BackoffWait.Nanoseconds())/float64(b.N), "backoff-ns/op")
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Deterministic scheduling. The race demos show anomalies when the Go
+// scheduler happens to interleave the clients badly, which it may not do
+// on a given run. A Scheduler takes the choice away from it: it runs a
+// few threads one at a time and switches between them only at yield
+// points, which transactions begun with a thread's context pass before
+// each Get, Put, Add, Upsert, Remove, ScanPrefix and Commit. A Strategy
+// picks which waiting thread goes next, so the same choices always give
+// the same interleaving, and ExploreAll and ExploreRandom run a small
+// scenario under every interleaving, or under many random ones.
+//
+// A thread that blocks inside an operation, such as one waiting for a
+// two-phase lock, cannot reach its next yield point. After scheduleStall
+// without one the scheduler counts it as blocked and runs another thread,
+// which may release the lock; the blocked thread rejoins the choice once
+// it yields again. Interleavings are exactly repeatable only on engines
+// that never block inside an operation.
+
+// scheduleStall is how long a running thread may take to reach its next
+// yield point before the scheduler takes it to be blocked
+const scheduleStall = 50 * time.Millisecond
+
+// A Strategy picks the thread to run next from runnable, the threads
+// waiting at a yield point in increasing order, returning an index into
+// it. step counts the choices made so far in the run.
+type Strategy func(step int, runnable []int) int
+
+// RandomStrategy picks uniformly at random, repeatably for a seed
+func RandomStrategy(seed int64) Strategy {
+	rng := rand.New(rand.NewSource(seed))
+	return func(_ int, runnable []int) int {
+		return rng.Intn(len(runnable))
+	}
+}
+
+// ScheduleStep is one step of an interleaving: a thread resumed to run
+// an operation
+type ScheduleStep struct {
+	Thread int
+	Op     string // GET, PUT, ADD, DELETE, SCAN or COMMIT; START before its first
+	Key    string
+}
+
+func (s ScheduleStep) String() string {
+	if s.Key == "" {
+		return fmt.Sprintf("thread %d: %s", s.Thread, s.Op)
+	}
+	return fmt.Sprintf("thread %d: %s %s", s.Thread, s.Op, s.Key)
+}
+
+// A Scheduler runs threads one at a time, switching only at yield points.
+// Use a Scheduler for one Run.
+type Scheduler struct {
+	strategy Strategy
+	events   chan scheduleEvent
+
+	mu    sync.Mutex
+	steps []ScheduleStep
+	sets  [][]int // The runnable threads at each step
+}
+
+// scheduleThread is a thread of a Scheduler, carried by its context
+type scheduleThread struct {
+	id     int
+	s      *Scheduler
+	resume chan struct{}
+}
+
+// scheduleEvent is a thread reaching a yield point, or finishing
+type scheduleEvent struct {
+	thread *scheduleThread
+	step   ScheduleStep
+	done   bool
+}
+
+// scheduleKey is the context key of a scheduler thread
+type scheduleKey struct{}
+
+// NewScheduler returns a scheduler that picks threads with strategy
+func NewScheduler(strategy Strategy) *Scheduler {
+	return &Scheduler{strategy: strategy, events: make(chan scheduleEvent)}
+}
+
+// threadFrom returns the scheduler thread ctx belongs to, nil if none
+func threadFrom(ctx context.Context) *scheduleThread {
+	if ctx == nil {
+		return nil
+	}
+	thread, _ := ctx.Value(scheduleKey{}).(*scheduleThread)
+	return thread
+}
+
+// yield waits at a yield point before op on key until the scheduler
+// resumes the thread
+func (t *scheduleThread) yield(op string, key string) {
+	t.s.events <- scheduleEvent{thread: t, step: ScheduleStep{Thread: t.id, Op: op, Key: key}}
+	<-t.resume
+}
+
+// yield is a yield point before op on key, if tx runs on a scheduler
+// thread. It is also the fault point before op; see faults.go.
+func (db *Database) yield(tx *Transaction, op string, key string) {
+	if tx.thread != nil {
+		tx.thread.yield(op, key)
+	}
+	db.injectFaults(tx, op)
+}
+
+// Run runs each of threads, numbered from 1, on its own goroutine under
+// the scheduler, and returns once all have returned. Transactions a
+// thread begins with the context it is given, or one derived from it,
+// yield to the scheduler; it is already tagged with WithClient.
+func (s *Scheduler) Run(ctx context.Context, threads ...func(ctx context.Context)) {
+	for i, fn := range threads {
+		t := &scheduleThread{id: i + 1, s: s, resume: make(chan struct{})}
+		go func(fn func(context.Context)) {
+			defer func() { s.events <- scheduleEvent{thread: t, done: true} }()
+			t.yield("START", "")
+			fn(context.WithValue(WithClient(ctx, t.id), scheduleKey{}, t))
+		}(fn)
+	}
+
+	// Every thread waits at START before the first choice
+	waiting := make(map[int]scheduleEvent) // Threads at a yield point
+	for len(waiting) < len(threads) {
+		event := <-s.events
+		waiting[event.thread.id] = event
+	}
+	var running *scheduleThread
+	for live := len(threads); live > 0; {
+		if running == nil && len(waiting) > 0 {
+			runnable := make([]int, 0, len(waiting))
+			for id := range waiting {
+				runnable = append(runnable, id)
+			}
+			sort.Ints(runnable)
+			s.mu.Lock()
+			choice := s.strategy(len(s.steps), runnable)
+			next := waiting[runnable[choice]]
+			s.steps = append(s.steps, next.step)
+			s.sets = append(s.sets, runnable)
+			s.mu.Unlock()
+			delete(waiting, next.step.Thread)
+			running = next.thread
+			running.resume <- struct{}{}
+		}
+
+		var event scheduleEvent
+		if running != nil {
+			select {
+			case event = <-s.events:
+			case <-time.After(scheduleStall):
+				running = nil // Blocked in the engine; let another thread run
+				continue
+			}
+		} else {
+			event = <-s.events // Every live thread is blocked
+		}
+		if event.thread == running {
+			running = nil
+		}
+		if event.done {
+			live--
+		} else {
+			waiting[event.thread.id] = event
+		}
+	}
+}
+
+// Steps returns the interleaving the scheduler ran, step by step
+func (s *Scheduler) Steps() []ScheduleStep {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ScheduleStep(nil), s.steps...)
+}
+
+// A Trial runs one interleaving of a small scenario: it sets up a fresh
+// database, runs its threads with s.Run and returns an error if the
+// outcome is wrong
+type Trial func(s *Scheduler) error
+
+// ScheduleFailure is an interleaving under which a trial failed
+type ScheduleFailure struct {
+	Steps []ScheduleStep
+	Err   error
+}
+
+// Exploration is what running a trial under many interleavings found
+type Exploration struct {
+	Schedules int               // Interleavings run
+	Complete  bool              // Every interleaving was run
+	Failures  []ScheduleFailure // The interleavings the trial failed under
+}
+
+// ExploreAll runs trial under every interleaving, up to limit of them,
+// depth first: each run follows the choices of the last up to its final
+// choice with an untried alternative, takes that, and then the first
+// runnable thread from there on
+func ExploreAll(trial Trial, limit int) Exploration {
+	var result Exploration
+	var prefix []int
+	for result.Schedules < limit {
+		s := NewScheduler(func(step int, runnable []int) int {
+			if step < len(prefix) {
+				return min(prefix[step], len(runnable)-1)
+			}
+			return 0
+		})
+		result.record(s, trial(s))
+
+		// Backtrack to the last choice with an untried alternative
+		s.mu.Lock()
+		choices := make([]int, len(s.steps))
+		for i, step := range s.steps {
+			choices[i] = sort.SearchInts(s.sets[i], step.Thread)
+		}
+		sets := s.sets
+		s.mu.Unlock()
+		i := len(choices) - 1
+		for i >= 0 && choices[i] == len(sets[i])-1 {
+			i--
+		}
+		if i < 0 {
+			result.Complete = true
+			break
+		}
+		prefix = append(choices[:i:i], choices[i]+1)
+	}
+	return result
+}
+
+// ExploreRandom runs trial under runs random interleavings, the first
+// seeded with seed and each following with the next seed
+func ExploreRandom(trial Trial, runs int, seed int64) Exploration {
+	var result Exploration
+	for i := 0; i < runs; i++ {
+		s := NewScheduler(RandomStrategy(seed + int64(i)))
+		result.record(s, trial(s))
+	}
+	return result
+}
+
+// record counts the interleaving s ran, and keeps it if err is not nil
+func (e *Exploration) record(s *Scheduler, err error) {
+	e.Schedules++
+	if err != nil {
+		e.Failures = append(e.Failures, ScheduleFailure{Steps: s.Steps(), Err: err})
+	}
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+// incrementTrial returns a trial in which two threads each increment x
+// by reading it and writing back one more, on a database from open with a
+// simulated clock. It fails if x does not count the committed increments.
+func incrementTrial(open func() *Database) Trial {
+	return func(s *Scheduler) error {
+		db := simulated(open())
+		setup := db.BeginTransaction()
+		db.Write(setup, "x", 0)
+		db.Commit(setup)
+
+		var committed atomic.Int64
+		increment := func(ctx context.Context) {
+			tx := db.BeginTransactionCtx(ctx)
+			value, _ := db.Read(tx, "x")
+			db.Write(tx, "x", value+1)
+			if db.Commit(tx) == nil {
+				committed.Add(1)
+			}
+		}
+		s.Run(context.Background(), increment, increment)
+
+		check := db.BeginTransaction()
+		x, _ := db.Read(check, "x")
+		db.Commit(check)
+		if x != int(committed.Load()) {
+			return fmt.Errorf("x = %d after %d committed increments", x, committed.Load())
+		}
+		return nil
+	}
+}
+
+// TestExploreAllFindsLostUpdate verifies every interleaving of two
+// increments is run, and exactly those where both read before either
+// commits lose one on the unsynchronized engine
+func TestExploreAllFindsLostUpdate(t *testing.T) {
+	result := ExploreAll(incrementTrial(NewUnsynchronizedDatabase), 1000)
+	// START, GET, PUT and COMMIT of two threads: 8 choose 4 interleavings
+	if !result.Complete || result.Schedules != 70 {
+		t.Fatalf("ran %d interleavings (complete %v), expected all 70", result.Schedules, result.Complete)
+	}
+	if len(result.Failures) == 0 {
+		t.Fatal("no interleaving lost an update")
+	}
+	for _, failure := range result.Failures {
+		firstCommit := 0
+		for i, step := range failure.Steps {
+			if step.Op == "COMMIT" {
+				firstCommit = i
+				break
+			}
+		}
+		reads := 0
+		for _, step := range failure.Steps[:firstCommit] {
+			if step.Op == "GET" {
+				reads++
+			}
+		}
+		if reads != 2 {
+			t.Errorf("lost an update with one read before the first commit: %v", failure.Steps)
+		}
+	}
+}
+
+// TestExploreAllIsolated verifies no interleaving loses an update under
+// MVCC, which aborts the second writer instead
+func TestExploreAllIsolated(t *testing.T) {
+	result := ExploreAll(incrementTrial(NewMVCCDatabase), 1000)
+	if !result.Complete || len(result.Failures) != 0 {
+		t.Errorf("%d of %d interleavings failed: %v", len(result.Failures), result.Schedules, result.Failures)
+	}
+}
+
+// TestRandomStrategyRepeats verifies a seed picks the same interleaving
+// every time
+func TestRandomStrategyRepeats(t *testing.T) {
+	var runs [][]ScheduleStep
+	for i := 0; i < 2; i++ {
+		s := NewScheduler(RandomStrategy(42))
+		incrementTrial(NewUnsynchronizedDatabase)(s)
+		runs = append(runs, s.Steps())
+	}
+	if !reflect.DeepEqual(runs[0], runs[1]) || len(runs[0]) != 8 {
+		t.Errorf("seed 42 ran %v, then %v", runs[0], runs[1])
+	}
+}
+
+// TestSchedulerRunsPastBlockedThread verifies a thread blocked on a
+// two-phase lock does not stall the run
+func TestSchedulerRunsPastBlockedThread(t *testing.T) {
+	result := ExploreRandom(incrementTrial(NewTwoPhaseLockingDatabase), 3, 1)
+	if result.Schedules != 3 || len(result.Failures) != 0 {
+		t.Errorf("%+v", result)
+	}
+}
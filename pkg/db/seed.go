@@ -0,0 +1,18 @@
+package db
+
+import "time"
+
+// RunSeed, when not 0, seeds every random choice the database and its
+// scenarios make: the operations each client picks, the failures injected,
+// the processing jitter, replica and election timings and the keys and
+// amounts used. A run with the same RunSeed and parameters repeats them,
+// though the Go scheduler may still interleave the clients differently.
+var RunSeed int64
+
+// NewRunSeed returns RunSeed, or a seed from the clock if it is 0
+func NewRunSeed() int64 {
+	if RunSeed != 0 {
+		return RunSeed
+	}
+	return time.Now().UnixNano()
+}
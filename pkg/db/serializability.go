@@ -0,0 +1,195 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Conflict serializability. A journal (SetJournal, or one on every
+// database once EnableSerializabilityChecking is on) holds the history of
+// a run: every committed transaction's reads, each with the transaction
+// whose write it saw, and every install, in commit order. CheckSerializable
+// builds the precedence graph of the committed transactions from it, with
+// an edge for each pair of conflicting operations:
+//
+//	ww  T1 installed a key, T2 installed the key's next version
+//	wr  T2 read the version T1 installed
+//	rw  T1 read a version, T2 installed the version after it
+//
+// The run was conflict-serializable, equivalent to running its committed
+// transactions one at a time in some order, exactly when the graph has no
+// cycle. Scans do not record what they read, so they leave no edges.
+
+// The ReadFrom of reads that saw no committed version of their own
+const (
+	readOwnWrite  = -1 // The transaction's own pending write
+	readUntracked = -2 // A row of a scan
+)
+
+// Dependency is an edge of the precedence graph: From has to come before
+// To in any equivalent serial order
+type Dependency struct {
+	From int
+	To   int
+	Kind string // ww, wr or rw
+	Key  string
+}
+
+func (d Dependency) String() string {
+	return fmt.Sprintf("T%d -%s(%s)-> T%d", d.From, d.Kind, d.Key, d.To)
+}
+
+// SerializabilityReport is the outcome of CheckSerializable
+type SerializabilityReport struct {
+	Transactions int          // Committed transactions in the history
+	Dependencies int          // Edges between them
+	Serializable bool         // The precedence graph has no cycle
+	Cycle        []Dependency // A cycle, if there is one
+}
+
+func (r SerializabilityReport) String() string {
+	if r.Serializable {
+		return fmt.Sprintf("yes (%d committed transactions, %d dependencies)", r.Transactions, r.Dependencies)
+	}
+	steps := make([]string, len(r.Cycle))
+	for i, d := range r.Cycle {
+		steps[i] = d.String()
+	}
+	return "no, cycle " + strings.Join(steps, ", ")
+}
+
+// serializabilityChecking journals every new database; see
+// EnableSerializabilityChecking
+var serializabilityChecking bool
+
+// EnableSerializabilityChecking gives every database created afterwards an
+// in-memory journal, so each scenario reports whether its committed
+// transactions were conflict-serializable. The journals keep every
+// operation until the process exits.
+func EnableSerializabilityChecking() {
+	serializabilityChecking = true
+}
+
+// CheckSerializable builds the precedence graph of the committed
+// transactions in entries, in Seq order as Journal.Entries returns them,
+// and looks for a cycle. Transactions the journal does not hold, such as
+// ones that committed before it was attached, count as the initial state.
+func CheckSerializable(entries []JournalEntry) SerializabilityReport {
+	committed := make(map[int]bool)
+	versions := make(map[string][]int) // Key -> its installers in commit order
+	var reads []JournalEntry
+	for _, entry := range entries {
+		committed[entry.TxID] = true
+		switch entry.Op {
+		case JournalInstall:
+			versions[entry.Key] = append(versions[entry.Key], entry.TxID)
+		case JournalRead, JournalAdd:
+			if entry.ReadFrom >= 0 {
+				reads = append(reads, entry)
+			}
+		}
+	}
+
+	graph := make(map[int]map[int]Dependency)
+	report := SerializabilityReport{Transactions: len(committed)}
+	addEdge := func(d Dependency) {
+		if d.From == d.To {
+			return
+		}
+		if graph[d.From] == nil {
+			graph[d.From] = make(map[int]Dependency)
+		}
+		if _, exists := graph[d.From][d.To]; !exists {
+			graph[d.From][d.To] = d
+			report.Dependencies++
+		}
+	}
+
+	keys := make([]string, 0, len(versions))
+	for key := range versions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	position := make(map[string]map[int]int) // Key -> installer -> its version's index
+	for _, key := range keys {
+		writers := versions[key]
+		position[key] = make(map[int]int, len(writers))
+		for i, writer := range writers {
+			position[key][writer] = i
+			if i > 0 {
+				addEdge(Dependency{From: writers[i-1], To: writer, Kind: "ww", Key: key})
+			}
+		}
+	}
+	for _, read := range reads {
+		next := 0 // Index of the version after the one read
+		if i, journaled := position[read.Key][read.ReadFrom]; journaled {
+			addEdge(Dependency{From: read.ReadFrom, To: read.TxID, Kind: "wr", Key: read.Key})
+			next = i + 1
+		}
+		if writers := versions[read.Key]; next < len(writers) {
+			addEdge(Dependency{From: read.TxID, To: writers[next], Kind: "rw", Key: read.Key})
+		}
+	}
+
+	report.Cycle = findCycle(graph)
+	report.Serializable = report.Cycle == nil
+	return report
+}
+
+// findCycle returns the edges of a cycle in graph, or nil if it has none.
+// It visits transactions in ID order, so the same graph gives the same
+// cycle.
+func findCycle(graph map[int]map[int]Dependency) []Dependency {
+	const (
+		unvisited = iota
+		onPath
+		finished
+	)
+	state := make(map[int]int)
+	var path []Dependency // Edges from the search's root to the current node
+	var visit func(node int) []Dependency
+	visit = func(node int) []Dependency {
+		state[node] = onPath
+		for _, to := range sortedIDs(graph[node]) {
+			edge := graph[node][to]
+			switch state[to] {
+			case onPath:
+				// The cycle is the path on from to, closed by edge
+				start := len(path) - 1
+				for path[start].From != to {
+					start--
+				}
+				return append(append([]Dependency(nil), path[start:]...), edge)
+			case unvisited:
+				path = append(path, edge)
+				if cycle := visit(to); cycle != nil {
+					return cycle
+				}
+				path = path[:len(path)-1]
+			}
+		}
+		state[node] = finished
+		return nil
+	}
+
+	for _, from := range sortedIDs(graph) {
+		if state[from] == unvisited {
+			if cycle := visit(from); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// sortedIDs returns the transaction IDs m is keyed by, in order
+func sortedIDs[V any](m map[int]V) []int {
+	ids := make([]int, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
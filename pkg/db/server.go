@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"database-sync-unsynchronized/httpapi"
+)
+
+// The database can be served over HTTP with the httpapi package; apiStore
+// adapts it to httpapi.Store. Every request runs through the same Get, Put
+// and Commit as any other client, so concurrent requests exercise the
+// engine's synchronization exactly as goroutines calling it directly do.
+
+// apiStore serves a DB through httpapi
+type apiStore struct {
+	db *Database
+}
+
+// NewHTTPHandler returns an HTTP handler serving db's REST API
+func NewHTTPHandler(db *Database) *httpapi.Handler[*Transaction] {
+	return httpapi.NewHandler[*Transaction](apiStore{db: db})
+}
+
+// Serve serves db's REST API on addr until ctx is done
+func Serve(ctx context.Context, db *Database, addr string) error {
+	server := &http.Server{Addr: addr, Handler: NewHTTPHandler(db)}
+	stop := context.AfterFunc(ctx, func() {
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	})
+	defer stop()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s apiStore) Begin(ctx context.Context) *Transaction {
+	return s.db.BeginTransactionCtx(ctx)
+}
+
+func (s apiStore) Get(tx *Transaction, key string) (int, error) {
+	value, err := s.db.Get(tx, key)
+	return value, apiError(err)
+}
+
+func (s apiStore) Put(tx *Transaction, key string, value int) error {
+	return apiError(s.db.Put(tx, key, value))
+}
+
+func (s apiStore) Commit(tx *Transaction) error {
+	return apiError(s.db.Commit(tx))
+}
+
+func (s apiStore) Abort(tx *Transaction) {
+	s.db.Abort(tx)
+}
+
+// apiError marks err with the httpapi error its response should use
+func apiError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrKeyNotFound):
+		return fmt.Errorf("%w: %w", httpapi.ErrNotFound, err)
+	case errors.Is(err, ErrConflict), errors.Is(err, ErrDeadlock), errors.Is(err, ErrTimeout),
+		errors.Is(err, ErrTxAborted), errors.Is(err, ErrTxDone):
+		return fmt.Errorf("%w: %w", httpapi.ErrConflict, err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,294 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync/atomic"
+)
+
+// A ShardedDatabase splits the keyspace across several databases, its
+// shards, each with its own records and locks, so transactions on keys in
+// different shards never contend. Keys are placed by consistent hashing:
+// each shard owns many points on a hash ring and a key belongs to the
+// shard owning the first point at or after the key's hash, so adding a
+// shard moves only the keys the new shard takes over.
+//
+// A sharded transaction begins a transaction on each shard it touches. If
+// it touched only one, committing it is that shard's Commit; otherwise the
+// database's Coordinator commits it with two-phase commit: every shard is
+// prepared, in shard order, and only if all of them can commit are they
+// all committed. Otherwise they are all aborted.
+
+// ringPointsPerShard is how many points each shard owns on the hash ring
+const ringPointsPerShard = 64
+
+// ringPoint is one point on the hash ring
+type ringPoint struct {
+	hash  uint64
+	shard int
+}
+
+// ShardedDatabase partitions keys across shards by consistent hashing
+type ShardedDatabase struct {
+	shards      []*Database
+	ring        []ringPoint // Sorted by hash
+	coordinator *Coordinator
+
+	nextID                         atomic.Int64
+	singleShardCommits, crossShard atomic.Int64
+	prepareFailures, retries       atomic.Int64
+	retryPolicy                    RetryPolicy
+}
+
+// ShardedTransaction is a transaction across the shards of a
+// ShardedDatabase
+type ShardedTransaction struct {
+	ID    int
+	db    *ShardedDatabase
+	parts map[int]*Transaction // Shard -> its transaction, begun on first use
+	ctx   context.Context
+	done  bool
+}
+
+// ShardStats counts how a sharded database's transactions committed
+type ShardStats struct {
+	SingleShardCommits int // Committed by one shard alone
+	CrossShardCommits  int // Committed by two-phase commit
+	PrepareFailures    int // Two-phase commits aborted because a shard could not prepare
+	Retries            int // RunTransaction attempts after the first
+}
+
+// hashKey places s on the hash ring
+func hashKey(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	// fnv spreads short, similar strings poorly over the high bits
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	return x
+}
+
+// NewShardedDatabase creates a database of n shards, each made by
+// newShard, which decides their engine
+func NewShardedDatabase(n int, newShard func() *Database) *ShardedDatabase {
+	n = max(n, 1)
+	s := &ShardedDatabase{
+		shards:      make([]*Database, n),
+		ring:        make([]ringPoint, 0, n*ringPointsPerShard),
+		coordinator: NewCoordinator(),
+		retryPolicy: DefaultRetryPolicy,
+	}
+	for i := range s.shards {
+		s.shards[i] = newShard()
+		for p := 0; p < ringPointsPerShard; p++ {
+			s.ring = append(s.ring, ringPoint{hash: hashKey(fmt.Sprintf("shard-%d-%d", i, p)), shard: i})
+		}
+	}
+	sort.Slice(s.ring, func(a, b int) bool { return s.ring[a].hash < s.ring[b].hash })
+	return s
+}
+
+// NumShards returns how many shards the database has
+func (s *ShardedDatabase) NumShards() int {
+	return len(s.shards)
+}
+
+// Shard returns shard i
+func (s *ShardedDatabase) Shard(i int) *Database {
+	return s.shards[i]
+}
+
+// ShardFor returns the shard key belongs to
+func (s *ShardedDatabase) ShardFor(key string) int {
+	h := hashKey(key)
+	i := sort.Search(len(s.ring), func(i int) bool { return s.ring[i].hash >= h })
+	if i == len(s.ring) {
+		i = 0 // Wrap around the ring
+	}
+	return s.ring[i].shard
+}
+
+// SetRetryPolicy changes how RunTransaction retries
+func (s *ShardedDatabase) SetRetryPolicy(policy RetryPolicy) {
+	policy.MaxAttempts = max(policy.MaxAttempts, 1)
+	s.retryPolicy = policy
+}
+
+// Coordinator returns the coordinator of the database's two-phase commits
+func (s *ShardedDatabase) Coordinator() *Coordinator {
+	return s.coordinator
+}
+
+// Stats returns how the database's transactions committed
+func (s *ShardedDatabase) Stats() ShardStats {
+	return ShardStats{
+		SingleShardCommits: int(s.singleShardCommits.Load()),
+		CrossShardCommits:  int(s.crossShard.Load()),
+		PrepareFailures:    int(s.prepareFailures.Load()),
+		Retries:            int(s.retries.Load()),
+	}
+}
+
+// Begin starts a sharded transaction
+func (s *ShardedDatabase) Begin() *ShardedTransaction {
+	return s.BeginCtx(context.Background())
+}
+
+// BeginCtx starts a sharded transaction whose shard transactions are
+// begun with ctx
+func (s *ShardedDatabase) BeginCtx(ctx context.Context) *ShardedTransaction {
+	return &ShardedTransaction{
+		ID:    int(s.nextID.Add(1)),
+		db:    s,
+		parts: make(map[int]*Transaction),
+		ctx:   ctx,
+	}
+}
+
+// part returns tx's transaction on the shard key belongs to, beginning it
+// if needed
+func (tx *ShardedTransaction) part(key string) (*Database, *Transaction) {
+	shard := tx.db.ShardFor(key)
+	part, ok := tx.parts[shard]
+	if !ok {
+		part = tx.db.shards[shard].BeginTransactionCtx(tx.ctx)
+		tx.parts[shard] = part
+	}
+	return tx.db.shards[shard], part
+}
+
+// Shards returns the shards tx has touched, in order
+func (tx *ShardedTransaction) Shards() []int {
+	shards := make([]int, 0, len(tx.parts))
+	for shard := range tx.parts {
+		shards = append(shards, shard)
+	}
+	sort.Ints(shards)
+	return shards
+}
+
+// Get returns key's value as tx sees it
+func (s *ShardedDatabase) Get(tx *ShardedTransaction, key string) (int, error) {
+	db, part := tx.part(key)
+	return db.Get(part, key)
+}
+
+// Put sets key to value when tx commits
+func (s *ShardedDatabase) Put(tx *ShardedTransaction, key string, value int) error {
+	db, part := tx.part(key)
+	return db.Put(part, key, value)
+}
+
+// Add adds delta to an existing key's value
+func (s *ShardedDatabase) Add(tx *ShardedTransaction, key string, delta int) error {
+	db, part := tx.part(key)
+	return db.Add(part, key, delta)
+}
+
+// Remove deletes key when tx commits
+func (s *ShardedDatabase) Remove(tx *ShardedTransaction, key string) error {
+	db, part := tx.part(key)
+	return db.Remove(part, key)
+}
+
+// Commit commits tx on every shard it touched, with two-phase commit if
+// there is more than one. If any shard cannot commit, none does, and the
+// first shard's error is returned wrapped in ErrVotedNo. ErrInDoubt means
+// the coordinator failed and will finish the transaction when it recovers.
+func (s *ShardedDatabase) Commit(tx *ShardedTransaction) error {
+	if tx.done {
+		return fmt.Errorf("%w: commit of sharded transaction %d", ErrTxDone, tx.ID)
+	}
+	tx.done = true
+	shards := tx.Shards()
+	if len(shards) == 0 {
+		return nil
+	}
+	if len(shards) == 1 {
+		err := s.shards[shards[0]].Commit(tx.parts[shards[0]])
+		if err == nil {
+			s.singleShardCommits.Add(1)
+		}
+		return err
+	}
+
+	// Prepared in shard order so that two coordinators preparing MVCC
+	// shards take their commit locks in the same order
+	participants := make([]Participant, len(shards))
+	for i, shard := range shards {
+		participants[i] = shardParticipant{shard: shard, db: s.shards[shard], tx: tx.parts[shard]}
+	}
+	err := s.coordinator.Run(tx.ID, participants)
+	switch {
+	case err == nil:
+		s.crossShard.Add(1)
+	case errors.Is(err, ErrVotedNo):
+		s.prepareFailures.Add(1)
+	}
+	return err
+}
+
+// Abort aborts tx on every shard it touched
+func (s *ShardedDatabase) Abort(tx *ShardedTransaction) {
+	if tx.done {
+		return
+	}
+	tx.done = true
+	for shard, part := range tx.parts {
+		s.shards[shard].Abort(part)
+	}
+}
+
+// conflicted reports whether running tx again might succeed
+func (tx *ShardedTransaction) conflicted(err error) bool {
+	for _, part := range tx.parts {
+		if part.conflict {
+			return true
+		}
+	}
+	return errors.Is(err, ErrConflict)
+}
+
+// RunTransaction runs fn in a sharded transaction and commits it, retrying
+// conflicts like Database.RunTransaction
+func (s *ShardedDatabase) RunTransaction(fn func(tx *ShardedTransaction) error) error {
+	return s.RunTransactionCtx(context.Background(), fn)
+}
+
+// RunTransactionCtx is RunTransaction with every attempt begun with
+// BeginCtx(ctx)
+func (s *ShardedDatabase) RunTransactionCtx(ctx context.Context, fn func(tx *ShardedTransaction) error) error {
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			s.retries.Add(1)
+			if _, err := s.retryPolicy.wait(ctx, RealClock, attempt); err != nil {
+				return err
+			}
+		}
+
+		tx := s.BeginCtx(ctx)
+		err := fn(tx)
+		if err != nil {
+			s.Abort(tx)
+		} else {
+			err = s.Commit(tx)
+		}
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !tx.conflicted(err) {
+			return err
+		}
+		if attempt >= s.retryPolicy.MaxAttempts {
+			return fmt.Errorf("%w after %d attempts: %w", ErrConflict, attempt, err)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestConsistentHashingMovesFewKeys verifies adding a shard only moves
+// keys to the new shard, and only about its share of them
+func TestConsistentHashingMovesFewKeys(t *testing.T) {
+	four := NewShardedDatabase(4, NewTwoPhaseLockingDatabase)
+	five := NewShardedDatabase(5, NewTwoPhaseLockingDatabase)
+
+	const keys = 10000
+	moved := 0
+	counts := make([]int, 5)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key_%d", i)
+		before, after := four.ShardFor(key), five.ShardFor(key)
+		counts[after]++
+		if before == after {
+			continue
+		}
+		moved++
+		if after != 4 {
+			t.Fatalf("%s moved from shard %d to old shard %d", key, before, after)
+		}
+	}
+	if moved < keys/10 || moved > keys*3/10 {
+		t.Errorf("%d of %d keys moved, want about a fifth", moved, keys)
+	}
+	for shard, count := range counts {
+		if count < keys/10 || count > keys*3/10 {
+			t.Errorf("Shard %d holds %d of %d keys, want about a fifth", shard, count, keys)
+		}
+	}
+}
+
+// keysOnShards returns two keys that live on different shards of s
+func keysOnShards(t *testing.T, s *ShardedDatabase) (string, string) {
+	t.Helper()
+	first := "key_0"
+	for i := 1; i < 1000; i++ {
+		if key := fmt.Sprintf("key_%d", i); s.ShardFor(key) != s.ShardFor(first) {
+			return first, key
+		}
+	}
+	t.Fatal("No two keys on different shards")
+	return "", ""
+}
+
+// TestCrossShardCommitIsAtomic verifies a cross-shard transaction that
+// loses a conflict on one shard commits on none
+func TestCrossShardCommitIsAtomic(t *testing.T) {
+	s := NewShardedDatabase(4, NewMVCCDatabase)
+	a, b := keysOnShards(t, s)
+	s.RunTransaction(func(tx *ShardedTransaction) error {
+		s.Put(tx, a, 1)
+		return s.Put(tx, b, 1)
+	})
+
+	tx := s.Begin()
+	s.Put(tx, a, 100)
+	s.Put(tx, b, 100)
+	if err := s.RunTransaction(func(other *ShardedTransaction) error { return s.Put(other, b, 2) }); err != nil {
+		t.Fatalf("Conflicting commit: %v", err)
+	}
+	if err := s.Commit(tx); !errors.Is(err, ErrConflict) {
+		t.Errorf("Commit = %v, want ErrConflict", err)
+	}
+
+	check := s.Begin()
+	valueA, _ := s.Get(check, a)
+	valueB, _ := s.Get(check, b)
+	s.Commit(check)
+	if valueA != 1 || valueB != 2 {
+		t.Errorf("%s=%d %s=%d, want 1 and 2", a, valueA, b, valueB)
+	}
+	if stats := s.Stats(); stats.PrepareFailures != 1 {
+		t.Errorf("PrepareFailures = %d, want 1", stats.PrepareFailures)
+	}
+}
+
+// TestPrepareHoldsOffConflicts verifies a prepared MVCC transaction keeps
+// a conflicting commit waiting until it commits, which then makes that
+// commit fail, and that a prepared transaction runs no more operations
+func TestPrepareHoldsOffConflicts(t *testing.T) {
+	db := NewMVCCDatabase()
+	prepared := db.BeginTransaction()
+	db.Put(prepared, "x", 1)
+	other := db.BeginTransaction()
+	db.Put(other, "x", 2)
+
+	if err := db.Prepare(prepared); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if err := db.Put(prepared, "y", 1); !errors.Is(err, ErrTxDone) {
+		t.Errorf("Put after Prepare = %v, want ErrTxDone", err)
+	}
+
+	var committed atomic.Bool
+	result := make(chan error)
+	go func() {
+		err := db.Commit(other)
+		committed.Store(true)
+		result <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if committed.Load() {
+		t.Error("A conflicting commit finished while the transaction was prepared")
+	}
+	if err := db.Commit(prepared); err != nil {
+		t.Errorf("Commit after Prepare: %v", err)
+	}
+	if err := <-result; !errors.Is(err, ErrConflict) {
+		t.Errorf("Conflicting commit = %v, want ErrConflict", err)
+	}
+}
+
+// TestAbortPreparedReleasesCommit verifies aborting a prepared MVCC
+// transaction lets other commits through
+func TestAbortPreparedReleasesCommit(t *testing.T) {
+	db := NewMVCCDatabase()
+	tx := db.BeginTransaction()
+	db.Put(tx, "x", 1)
+	db.Prepare(tx)
+	db.Abort(tx)
+
+	other := db.BeginTransaction()
+	db.Put(other, "x", 2)
+	if err := db.Commit(other); err != nil {
+		t.Errorf("Commit after an aborted prepare: %v", err)
+	}
+}
+
+// TestShardedTransfersPreserveTotal runs cross-shard transfers on every
+// isolating engine and checks the total
+func TestShardedTransfersPreserveTotal(t *testing.T) {
+	engines := map[string]func() *Database{
+		"two-phase-locking": func() *Database {
+			db := NewTwoPhaseLockingDatabase()
+			db.SetLockTimeout(10 * time.Millisecond)
+			return db
+		},
+		"mvcc":               NewMVCCDatabase,
+		"timestamp-ordering": NewTimestampOrderingDatabase,
+	}
+	for name, newShard := range engines {
+		t.Run(name, func(t *testing.T) {
+			s := NewShardedDatabase(4, newShard)
+			s.SetRetryPolicy(RetryPolicy{MaxAttempts: 1000, BaseBackoff: 10 * time.Microsecond, MaxBackoff: time.Millisecond})
+			const accounts = 8
+			s.RunTransaction(func(tx *ShardedTransaction) error {
+				for i := 0; i < accounts; i++ {
+					s.Put(tx, fmt.Sprintf("account_%d", i), 100)
+				}
+				return nil
+			})
+
+			var wg sync.WaitGroup
+			for c := 0; c < 4; c++ {
+				wg.Add(1)
+				go func(c int) {
+					defer wg.Done()
+					for j := 0; j < 25; j++ {
+						from, to := fmt.Sprintf("account_%d", (c+j)%accounts), fmt.Sprintf("account_%d", (c+j+3)%accounts)
+						err := s.RunTransaction(func(tx *ShardedTransaction) error {
+							if err := s.Add(tx, from, -5); err != nil {
+								return err
+							}
+							return s.Add(tx, to, 5)
+						})
+						if err != nil {
+							t.Errorf("Transfer: %v", err)
+						}
+					}
+				}(c)
+			}
+			wg.Wait()
+
+			total := 0
+			s.RunTransaction(func(tx *ShardedTransaction) error {
+				total = 0
+				for i := 0; i < accounts; i++ {
+					balance, err := s.Get(tx, fmt.Sprintf("account_%d", i))
+					if err != nil {
+						return err
+					}
+					total += balance
+				}
+				return nil
+			})
+			if total != accounts*100 {
+				t.Errorf("Total = %d, want %d", total, accounts*100)
+			}
+			if s.Stats().CrossShardCommits == 0 {
+				t.Error("No transfer crossed shards")
+			}
+		})
+	}
+}
+
+// BenchmarkShardedStress runs the stress test's workload, with each
+// operation incrementing two neighbouring counters in one transaction, on
+// 1 to 16 two-phase locking shards
+func BenchmarkShardedStress(b *testing.B) {
+	for _, shards := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			s := NewShardedDatabase(shards, func() *Database {
+				db := NewTwoPhaseLockingDatabase()
+				db.SetLockTimeout(10 * time.Millisecond)
+				return db
+			})
+			const counters = 10
+			s.RunTransaction(func(tx *ShardedTransaction) error {
+				for i := 0; i < counters; i++ {
+					s.Put(tx, fmt.Sprintf("counter_%d", i), 0)
+				}
+				return nil
+			})
+
+			var next atomic.Int64
+			b.SetParallelism(20)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := int(next.Add(1))
+					first, second := fmt.Sprintf("counter_%d", i%counters), fmt.Sprintf("counter_%d", (i+1)%counters)
+					s.RunTransaction(func(tx *ShardedTransaction) error {
+						if err := s.Add(tx, first, 1); err != nil {
+							return err
+						}
+						return s.Add(tx, second, 1)
+					})
+				}
+			})
+			b.StopTimer()
+			stats := s.Stats()
+			b.ReportMetric(float64(stats.CrossShardCommits)/float64(b.N), "cross-shard/op")
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Snapshots can be written to disk and read back, so that a scenario's end
+// state can be kept, diffed against another run's with DiffSnapshots, or
+// restored into a fresh database as a test fixture. A path ending in .gob
+// is gob-encoded; anything else is indented JSON, which is easy to read and
+// to check in.
+
+// SaveSnapshot writes a snapshot of db's committed records to path
+func (db *Database) SaveSnapshot(path string) error {
+	return WriteSnapshot(path, db.TakeSnapshot())
+}
+
+// WriteSnapshot writes snapshot to path, replacing any file there
+func WriteSnapshot(path string, snapshot DBSnapshot) error {
+	var data []byte
+	if isGobPath(path) {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(snapshot); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	} else {
+		var err error
+		if data, err = json.MarshalIndent(snapshot, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	}
+	return writeFileAtomic(path, data)
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot
+func LoadSnapshot(path string) (DBSnapshot, error) {
+	var snapshot DBSnapshot
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snapshot, err
+	}
+	if isGobPath(path) {
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(&snapshot)
+	} else {
+		err = json.Unmarshal(data, &snapshot)
+	}
+	if err != nil {
+		return snapshot, fmt.Errorf("%s: %w", path, err)
+	}
+	if snapshot.Entries == nil {
+		snapshot.Entries = make(map[string]SnapshotEntry)
+	}
+	return snapshot, nil
+}
+
+// Restore writes every live key of snapshot into db in one transaction,
+// loaded as by BulkLoad. Versions and writers are not restored: each key
+// starts over as written by that transaction.
+func (db *Database) Restore(snapshot DBSnapshot) error {
+	tx := db.beginLoad()
+	for key, entry := range snapshot.Entries {
+		if entry.Deleted {
+			continue
+		}
+		if err := db.putCommitted(tx, key, entry.Value, entry.Payload, entry.ExpiresAt); err != nil {
+			db.Abort(tx)
+			return fmt.Errorf("restoring %s: %w", key, err)
+		}
+	}
+	return db.Commit(tx)
+}
+
+// isGobPath reports whether a snapshot file at path is gob-encoded
+func isGobPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".gob")
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestSnapshotFileRoundTrip verifies a snapshot saved as JSON or gob loads
+// back unchanged
+func TestSnapshotFileRoundTrip(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	tx := db.BeginTransaction()
+	db.Put(tx, "a", 1)
+	db.Put(tx, "b", 2)
+	db.Put(tx, "c", 3)
+	db.Commit(tx)
+	tx = db.BeginTransaction()
+	db.Remove(tx, "c")
+	db.Commit(tx)
+	want := db.TakeSnapshot()
+
+	for _, name := range []string{"state.json", "state.gob"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := db.SaveSnapshot(path); err != nil {
+			t.Fatalf("SaveSnapshot(%s): %v", name, err)
+		}
+		got, err := LoadSnapshot(path)
+		if err != nil {
+			t.Fatalf("LoadSnapshot(%s): %v", name, err)
+		}
+		if got.Engine != want.Engine || !reflect.DeepEqual(got.Entries, want.Entries) {
+			t.Errorf("%s loaded %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+// TestSnapshotFixture restores a checked-in snapshot as the starting state
+// of a test
+func TestSnapshotFixture(t *testing.T) {
+	fixture, err := LoadSnapshot(filepath.Join("testdata", "bank_fixture.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewTwoPhaseLockingDatabase()
+	if err := db.Restore(fixture); err != nil {
+		t.Fatal(err)
+	}
+	if db.GetRecordCount() != 2 {
+		t.Errorf("Restored %d records, want the 2 live ones", db.GetRecordCount())
+	}
+
+	if err := db.Transfer("account_B", "account_A", 300); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"account_A": 1000, "account_B": 1000}
+	if ok, errs := db.VerifyIntegrity(want); !ok {
+		t.Errorf("After the transfer: %v", errs)
+	}
+	if diffs := db.DiffLive(fixture); len(diffs) != 2 {
+		t.Errorf("%d keys differ from the fixture, want 2: %v", len(diffs), diffs)
+	}
+}
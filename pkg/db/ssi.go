@@ -0,0 +1,247 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Serializable snapshot isolation (SSI). Snapshot isolation alone lets two
+// concurrent transactions each read what the other is about to overwrite
+// and both commit (write skew). SSI watches for rw-antidependencies: T1
+// read a version that a concurrent T2 overwrote, written T1 -rw-> T2. Every
+// non-serializable history contains a "pivot" transaction with both an
+// incoming and an outgoing rw-antidependency, so aborting a transaction as
+// soon as it becomes a pivot keeps every history serializable. Like most
+// implementations this is conservative and sometimes aborts a transaction
+// that would have been harmless.
+//
+// Only MVCC transactions at the Serializable level are tracked.
+
+// ssiTx is SSI's bookkeeping for one serializable transaction
+type ssiTx struct {
+	snapshotTS  int64
+	committed   bool
+	commitTS    int64 // Clock value at commit
+	inConflict  bool  // A concurrent transaction read what this one overwrote
+	outConflict bool  // This one read what a concurrent transaction overwrote
+	keys        []string
+	prefixes    []string
+}
+
+// concurrentWith reports whether the two transactions overlapped, i.e.
+// neither committed before the other took its snapshot
+func (t *ssiTx) concurrentWith(other *ssiTx) bool {
+	return (!t.committed || t.commitTS > other.snapshotTS) &&
+		(!other.committed || other.commitTS > t.snapshotTS)
+}
+
+// ssiTracker records what serializable transactions read (SIREAD locks,
+// which never block anybody) until no concurrent transaction is left that
+// could overwrite it
+type ssiTracker struct {
+	mu           sync.Mutex
+	txs          map[int]*ssiTx
+	readers      map[string]map[int]bool // Key -> transactions that read it
+	rangeReaders map[string]map[int]bool // Scanned prefix -> transactions
+}
+
+// newSSITracker creates an empty tracker
+func newSSITracker() *ssiTracker {
+	return &ssiTracker{
+		txs:          make(map[int]*ssiTx),
+		readers:      make(map[string]map[int]bool),
+		rangeReaders: make(map[string]map[int]bool),
+	}
+}
+
+// tracked reports whether SSI watches tx
+func (db *Database) tracked(tx *Transaction) bool {
+	return db.mvcc != nil && tx.Isolation == Serializable
+}
+
+// ssiBegin takes tx's snapshot and starts tracking it. Commits install
+// their versions under the tracker's mutex, so the snapshot and the
+// registration happen at the same point in the commit order.
+func (db *Database) ssiBegin(tx *Transaction) {
+	t := db.mvcc.ssi
+	t.mu.Lock()
+	tx.SnapshotTS = db.mvcc.begin(tx.ID)
+	t.txs[tx.ID] = &ssiTx{snapshotTS: tx.SnapshotTS}
+	t.mu.Unlock()
+}
+
+// ssiRead records that tx read key from its snapshot and adds an edge to
+// every concurrent serializable transaction that already committed a newer
+// version. It returns false, and why, if tx has to abort because an edge
+// made an already committed transaction a pivot.
+func (db *Database) ssiRead(tx *Transaction, key string) (string, bool) {
+	t := db.mvcc.ssi
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.txs[tx.ID]
+	state.keys = append(state.keys, key)
+	if t.readers[key] == nil {
+		t.readers[key] = make(map[int]bool)
+	}
+	t.readers[key][tx.ID] = true
+
+	s := db.mvcc
+	s.mu.RLock()
+	chain := s.chains[key]
+	var writers []int
+	for i := len(chain) - 1; i >= 0 && chain[i].CommitTS > tx.SnapshotTS; i-- {
+		writers = append(writers, chain[i].TxID)
+	}
+	s.mu.RUnlock()
+
+	return db.ssiReadEdges(tx, state, writers, "read of "+key)
+}
+
+// ssiScan records that tx scanned prefix, like ssiRead does for one key
+func (db *Database) ssiScan(tx *Transaction, prefix string) (string, bool) {
+	t := db.mvcc.ssi
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.txs[tx.ID]
+	state.prefixes = append(state.prefixes, prefix)
+	if t.rangeReaders[prefix] == nil {
+		t.rangeReaders[prefix] = make(map[int]bool)
+	}
+	t.rangeReaders[prefix][tx.ID] = true
+
+	s := db.mvcc
+	s.mu.RLock()
+	var writers []int
+	for key, chain := range s.chains {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		for i := len(chain) - 1; i >= 0 && chain[i].CommitTS > tx.SnapshotTS; i-- {
+			writers = append(writers, chain[i].TxID)
+		}
+	}
+	s.mu.RUnlock()
+
+	return db.ssiReadEdges(tx, state, writers, "scan of "+prefix)
+}
+
+// ssiReadEdges adds tx -rw-> writer for every tracked writer. Must be
+// called with the tracker's mutex held.
+func (db *Database) ssiReadEdges(tx *Transaction, state *ssiTx, writers []int, what string) (string, bool) {
+	for _, id := range writers {
+		writer, ok := db.mvcc.ssi.txs[id]
+		if !ok || id == tx.ID {
+			continue
+		}
+		state.outConflict = true
+		writer.inConflict = true
+		if writer.outConflict {
+			// The writer committed as a pivot; the only way out is us
+			return fmt.Sprintf("serialization failure: %s overwritten by pivot tx %d", what, id), false
+		}
+	}
+	return "", true
+}
+
+// ssiValidateCommit adds reader -rw-> tx for every concurrent serializable
+// transaction that read something tx is about to overwrite, and reports
+// whether tx may commit. It must be called with the tracker's mutex held,
+// and the mutex must stay held until tx's versions are installed, so a
+// reader cannot slip in between the check and the install unnoticed.
+func (db *Database) ssiValidateCommit(tx *Transaction) (reason string, ok bool) {
+	t := db.mvcc.ssi
+	state := t.txs[tx.ID]
+
+	readers := make(map[int]bool)
+	for _, key := range tx.writeOrder {
+		for id := range t.readers[key] {
+			readers[id] = true
+		}
+		for prefix, ids := range t.rangeReaders {
+			if strings.HasPrefix(key, prefix) {
+				for id := range ids {
+					readers[id] = true
+				}
+			}
+		}
+	}
+
+	for id := range readers {
+		reader := t.txs[id]
+		if id == tx.ID || !reader.concurrentWith(state) {
+			continue
+		}
+		reader.outConflict = true
+		state.inConflict = true
+		if reader.committed && reader.inConflict {
+			return fmt.Sprintf("serialization failure: tx %d committed as a pivot", id), false
+		}
+	}
+	if state.inConflict && state.outConflict {
+		return "serialization failure: transaction is a pivot (rw-conflicts in and out)", false
+	}
+	return "", true
+}
+
+// ssiCommitReadOnly commits a serializable transaction that wrote
+// nothing, unless it became a pivot. It returns false, and why, if it
+// has to abort instead.
+func (db *Database) ssiCommitReadOnly(tx *Transaction) (string, bool) {
+	t := db.mvcc.ssi
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.txs[tx.ID]
+	if state.inConflict && state.outConflict {
+		return "serialization failure: read-only transaction is a pivot", false
+	}
+	state.committed = true
+	state.commitTS = db.mvcc.snapshot()
+	return "", true
+}
+
+// ssiFinish stops tracking tx if it aborted, and forgets committed
+// transactions that no active transaction overlaps any more: a
+// transaction that starts later can never be concurrent with them
+func (db *Database) ssiFinish(tx *Transaction) {
+	t := db.mvcc.ssi
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if state, ok := t.txs[tx.ID]; ok && !state.committed {
+		t.forget(tx.ID, state)
+	}
+
+	oldest := int64(-1)
+	for _, state := range t.txs {
+		if !state.committed && (oldest < 0 || state.snapshotTS < oldest) {
+			oldest = state.snapshotTS
+		}
+	}
+	for id, state := range t.txs {
+		if state.committed && (oldest < 0 || state.commitTS <= oldest) {
+			t.forget(id, state)
+		}
+	}
+}
+
+// forget drops a transaction and its SIREAD locks. Must be called with
+// the tracker's mutex held.
+func (t *ssiTracker) forget(id int, state *ssiTx) {
+	for _, key := range state.keys {
+		delete(t.readers[key], id)
+		if len(t.readers[key]) == 0 {
+			delete(t.readers, key)
+		}
+	}
+	for _, prefix := range state.prefixes {
+		delete(t.rangeReaders[prefix], id)
+		if len(t.rangeReaders[prefix]) == 0 {
+			delete(t.rangeReaders, prefix)
+		}
+	}
+	delete(t.txs, id)
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"testing"
+)
+
+// goOffCall runs one doctor's half of the on-call check: read both
+// doctors, then take me off call if both were on
+func goOffCall(db *Database, tx *Transaction, me string) {
+	onCall := 0
+	for _, doctor := range []string{"oncall_alice", "oncall_bob"} {
+		value, _ := db.Read(tx, doctor)
+		onCall += value
+	}
+	if onCall >= 2 {
+		db.Write(tx, me, 0)
+	}
+}
+
+// interleaveWriteSkew runs the two doctors' transactions so that both
+// read before either commits, and returns them
+func interleaveWriteSkew(db *Database, level IsolationLevel) (*Transaction, *Transaction) {
+	setup := db.BeginTransaction()
+	db.Write(setup, "oncall_alice", 1)
+	db.Write(setup, "oncall_bob", 1)
+	db.Commit(setup)
+
+	alice := db.BeginTransactionWithIsolation(level)
+	bob := db.BeginTransactionWithIsolation(level)
+	goOffCall(db, alice, "oncall_alice")
+	goOffCall(db, bob, "oncall_bob")
+	db.Commit(alice)
+	db.Commit(bob)
+	return alice, bob
+}
+
+// TestSnapshotIsolationAllowsWriteSkew verifies plain snapshot isolation
+// lets both doctors go off call
+func TestSnapshotIsolationAllowsWriteSkew(t *testing.T) {
+	db := NewMVCCDatabase()
+	alice, bob := interleaveWriteSkew(db, RepeatableRead)
+
+	if alice.Aborted || bob.Aborted {
+		t.Fatalf("Snapshot isolation aborted a transaction: %q / %q", alice.AbortReason, bob.AbortReason)
+	}
+	ok, _ := db.VerifyIntegrity(map[string]int{"oncall_alice": 0, "oncall_bob": 0})
+	if !ok {
+		t.Error("Expected write skew to leave nobody on call")
+	}
+}
+
+// TestSSIPreventsWriteSkew verifies SSI aborts the second doctor
+func TestSSIPreventsWriteSkew(t *testing.T) {
+	db := NewMVCCDatabase()
+	alice, bob := interleaveWriteSkew(db, Serializable)
+
+	if alice.Aborted {
+		t.Errorf("First committer was aborted: %s", alice.AbortReason)
+	}
+	if !bob.Aborted {
+		t.Fatal("SSI let both doctors go off call")
+	}
+	if db.Stats().SerializationFailures != 1 {
+		t.Errorf("Serialization failures = %d, want 1", db.Stats().SerializationFailures)
+	}
+	ok, errs := db.VerifyIntegrity(map[string]int{"oncall_alice": 0, "oncall_bob": 1})
+	if !ok {
+		t.Errorf("Unexpected final state: %v", errs)
+	}
+}
+
+// TestSSIAllowsIndependentTransactions verifies concurrent serializable
+// transactions on unrelated keys are not aborted
+func TestSSIAllowsIndependentTransactions(t *testing.T) {
+	db := NewMVCCDatabase()
+
+	t1 := db.BeginTransactionWithIsolation(Serializable)
+	t2 := db.BeginTransactionWithIsolation(Serializable)
+	db.Read(t1, "a")
+	db.Write(t1, "a", 1)
+	db.Read(t2, "b")
+	db.Write(t2, "b", 1)
+	db.Commit(t1)
+	db.Commit(t2)
+
+	if t1.Aborted || t2.Aborted {
+		t.Errorf("Independent transactions aborted: %q / %q", t1.AbortReason, t2.AbortReason)
+	}
+	if n := len(db.mvcc.ssi.txs); n != 0 {
+		t.Errorf("SSI still tracks %d transactions after all finished", n)
+	}
+}
@@ -0,0 +1,454 @@
+package db
+
+import (
+	"math/bits"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The statistics are atomic counters, so counting is race-free on every
+// engine, the unsynchronized one included, and never waits on the
+// database lock. Counting alone would not make Stats consistent, since
+// it could load one counter before an operation and the next after it, and
+// report a deadlock without its lock timeout. Every update therefore holds
+// the cut lock of its shard of the statistics shared while it adds, and
+// Stats holds every shard's exclusively while it loads: a snapshot sees
+// each update whole or not at all.
+
+// OpKind is a kind of database operation whose latency is recorded
+type OpKind int
+
+const (
+	OpRead OpKind = iota
+	OpWrite
+	OpUpdate
+	OpDelete
+	OpScan
+	OpCommit
+	NumOpKinds // How many kinds there are
+)
+
+func (k OpKind) String() string {
+	switch k {
+	case OpRead:
+		return "read"
+	case OpWrite:
+		return "write"
+	case OpUpdate:
+		return "update"
+	case OpDelete:
+		return "delete"
+	case OpScan:
+		return "scan"
+	case OpCommit:
+		return "commit"
+	default:
+		return "unknown"
+	}
+}
+
+// Latencies are recorded in an HDR-style histogram: nanosecond values
+// below 64 each get a bucket of their own, and every power of two above is
+// split into 32 equal sub-buckets, so a bucket is never wider than 1/32 of
+// the values it holds and a percentile read from the histogram is within
+// about 3% of the true one, whatever its magnitude, at a fixed cost per
+// recording.
+const (
+	subBucketBits  = 5
+	subBuckets     = 1 << subBucketBits
+	maxLatencyBits = 36 // Latencies from 2^36ns (about 69s) up share the last bucket
+	latencyBuckets = (maxLatencyBits-subBucketBits)*subBuckets + subBuckets
+)
+
+// latencyBucket returns the bucket counting latency d
+func latencyBucket(d time.Duration) int {
+	v := uint64(max(d, 0))
+	if v < 2*subBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(v) - subBucketBits - 1
+	if shift > maxLatencyBits-subBucketBits-1 {
+		return latencyBuckets - 1
+	}
+	return shift<<subBucketBits + int(v>>shift)
+}
+
+// latencyBucketBounds returns the range [lower, upper) of latencies bucket
+// i counts
+func latencyBucketBounds(i int) (lower, upper time.Duration) {
+	if i < 2*subBuckets {
+		return time.Duration(i), time.Duration(i + 1)
+	}
+	shift := i>>subBucketBits - 1
+	m := i&(subBuckets-1) + subBuckets
+	return time.Duration(m) << shift, time.Duration(m+1) << shift
+}
+
+// bucketCount is a non-empty histogram bucket
+type bucketCount struct {
+	bucket int
+	count  int
+}
+
+// LatencyHistogram is a snapshot of an operation's latencies, with the
+// usual percentiles already read off
+type LatencyHistogram struct {
+	Count int
+	Total time.Duration
+	Max   time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	P999  time.Duration
+
+	counts []bucketCount // Non-empty buckets, in order
+}
+
+// Mean returns the average latency, 0 if none was recorded
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Total / time.Duration(h.Count)
+}
+
+// Quantile returns the q-th quantile (0 to 1) of the latencies: the
+// highest latency the bucket holding it counts, or Max if that is lower
+func (h LatencyHistogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := int(q * float64(h.Count))
+	seen := 0
+	for _, b := range h.counts {
+		seen += b.count
+		if seen > rank {
+			_, upper := latencyBucketBounds(b.bucket)
+			return min(upper-1, h.Max)
+		}
+	}
+	return h.Max
+}
+
+// LatencyCounters is the live form of a LatencyHistogram
+type LatencyCounters struct {
+	count   atomic.Int64
+	total   atomic.Int64
+	max     atomic.Int64
+	buckets [latencyBuckets]atomic.Int64
+}
+
+// Observe records one latency
+func (c *LatencyCounters) Observe(d time.Duration) {
+	c.count.Add(1)
+	c.total.Add(int64(d))
+	c.buckets[latencyBucket(d)].Add(1)
+	for {
+		longest := c.max.Load()
+		if int64(d) <= longest || c.max.CompareAndSwap(longest, int64(d)) {
+			return
+		}
+	}
+}
+
+// Snapshot loads the histogram
+func (c *LatencyCounters) Snapshot() LatencyHistogram {
+	h := LatencyHistogram{
+		Count: int(c.count.Load()),
+		Total: time.Duration(c.total.Load()),
+		Max:   time.Duration(c.max.Load()),
+	}
+	if h.Count == 0 {
+		return h
+	}
+	for i := range c.buckets {
+		if n := c.buckets[i].Load(); n > 0 {
+			h.counts = append(h.counts, bucketCount{bucket: i, count: int(n)})
+		}
+	}
+	return h.withPercentiles()
+}
+
+// withPercentiles returns h with its percentiles read off its buckets
+func (h LatencyHistogram) withPercentiles() LatencyHistogram {
+	h.P50, h.P90, h.P99, h.P999 = h.Quantile(0.5), h.Quantile(0.9), h.Quantile(0.99), h.Quantile(0.999)
+	return h
+}
+
+// Since returns the histogram of the latencies recorded after before, an
+// earlier snapshot of the same operation's latencies. Its Max is the
+// highest latency the buckets tell apart, since the highest since before
+// is not recorded.
+func (h LatencyHistogram) Since(before LatencyHistogram) LatencyHistogram {
+	d := LatencyHistogram{Count: h.Count - before.Count, Total: h.Total - before.Total}
+	if d.Count <= 0 {
+		return LatencyHistogram{}
+	}
+	j := 0
+	for _, b := range h.counts {
+		for j < len(before.counts) && before.counts[j].bucket < b.bucket {
+			j++
+		}
+		if j < len(before.counts) && before.counts[j].bucket == b.bucket {
+			b.count -= before.counts[j].count
+		}
+		if b.count > 0 {
+			d.counts = append(d.counts, b)
+		}
+	}
+	_, upper := latencyBucketBounds(d.counts[len(d.counts)-1].bucket)
+	d.Max = min(upper-1, h.Max)
+	return d.withPercentiles()
+}
+
+// Merge returns the histogram of the latencies of h and other together,
+// such as two clients' transactions
+func (h LatencyHistogram) Merge(other LatencyHistogram) LatencyHistogram {
+	m := LatencyHistogram{Count: h.Count + other.Count, Total: h.Total + other.Total, Max: max(h.Max, other.Max)}
+	i, j := 0, 0
+	for i < len(h.counts) || j < len(other.counts) {
+		switch {
+		case j == len(other.counts) || (i < len(h.counts) && h.counts[i].bucket < other.counts[j].bucket):
+			m.counts = append(m.counts, h.counts[i])
+			i++
+		case i == len(h.counts) || other.counts[j].bucket < h.counts[i].bucket:
+			m.counts = append(m.counts, other.counts[j])
+			j++
+		default:
+			m.counts = append(m.counts, bucketCount{bucket: h.counts[i].bucket, count: h.counts[i].count + other.counts[j].count})
+			i++
+			j++
+		}
+	}
+	return m.withPercentiles()
+}
+
+// statField is one of the counters of Stats
+type statField int
+
+const (
+	statTotalReads statField = iota
+	statTotalWrites
+	statTotalUpdates
+	statLostUpdates
+	statDataCorruption
+	statResurrectionsBlocked
+	statTombstonesCollected
+	statUpsertInserts
+	statLockTimeouts
+	statDeadlocks
+	statValidationFailures
+	statAdmissionQueued
+	statAdmissionWait
+	statDeadlinesMissed
+	statWriteConflicts
+	statSerializationFailures
+	statTimestampRestarts
+	statVacuumRuns
+	statVersionsReclaimed
+	statTransactionRetries
+	statBackoffWait
+	statPayloadBytes
+	statKeysEvicted
+	statPins
+	statPinnedKeys
+	statKeysExpired
+	statCheckpoints
+	statCommits
+	statAborts
+	statConflicts
+	numStatFields
+)
+
+// cacheLineSize is how far apart memory written by different cores must be
+// to not share a cache line
+const cacheLineSize = 64
+
+// statShard is one shard of the statistics, with counters of its own and
+// the cut lock its updates hold. The padding keeps the next shard's lock
+// and counters off its cache lines.
+type statShard struct {
+	cut     sync.RWMutex // Shared by updates, exclusive for snapshots
+	counts  [numStatFields]atomic.Int64
+	latency [NumOpKinds]LatencyCounters
+	_       [cacheLineSize]byte
+}
+
+// add adds delta to a counter. Must be called with the cut lock held
+// shared.
+func (s *statShard) add(field statField, delta int64) {
+	s.counts[field].Add(delta)
+}
+
+// statCounters is the live form of Stats, split into a shard per
+// GOMAXPROCS. One set of counters written by every core would bounce its
+// cache lines between them on every operation, which would show up in the
+// contention benchmarks as contention of the engines' own. Each update
+// goes to a random shard instead, and Stats adds the shards up.
+type statCounters struct {
+	shards []statShard
+}
+
+// newStatCounters returns zeroed statistics sharded for GOMAXPROCS
+func newStatCounters() statCounters {
+	return statCounters{shards: make([]statShard, runtime.GOMAXPROCS(0))}
+}
+
+// shard returns the shard an update goes to
+func (s *statCounters) shard() *statShard {
+	if len(s.shards) == 1 {
+		return &s.shards[0]
+	}
+	return &s.shards[rand.Intn(len(s.shards))]
+}
+
+// record runs update, which adds to one or more counters of the shard it
+// is given, as a single step of the statistics
+func (s *statCounters) record(update func(shard *statShard)) {
+	shard := s.shard()
+	shard.cut.RLock()
+	defer shard.cut.RUnlock()
+	update(shard)
+}
+
+// countStat adds delta to a statistics counter
+func (db *Database) countStat(field statField, delta int) {
+	shard := db.stats.shard()
+	shard.cut.RLock()
+	shard.add(field, int64(delta))
+	shard.cut.RUnlock()
+}
+
+// observeLatency records that an operation of kind began at start and has
+// just finished. Use it as defer db.observeLatency(kind, db.clock.Now()).
+func (db *Database) observeLatency(kind OpKind, start time.Time) {
+	elapsed := db.since(start)
+	shard := db.stats.shard()
+	shard.cut.RLock()
+	shard.latency[kind].Observe(elapsed)
+	shard.cut.RUnlock()
+}
+
+// countOutcome counts a finished top-level transaction
+func (db *Database) countOutcome(tx *Transaction, status TxStatus) {
+	db.stats.record(func(s *statShard) {
+		if status == TxCommitted {
+			s.add(statCommits, 1)
+			return
+		}
+		s.add(statAborts, 1)
+		if tx.conflict {
+			s.add(statConflicts, 1)
+		}
+	})
+}
+
+// Stats returns a consistent snapshot of the database statistics: every
+// update is either wholly in it or wholly absent, even mid-workload
+func (db *Database) Stats() Stats {
+	shards := db.stats.shards
+	for i := range shards {
+		shards[i].cut.Lock()
+		defer shards[i].cut.Unlock()
+	}
+
+	var c [numStatFields]int64
+	var latency [NumOpKinds]LatencyHistogram
+	for i := range shards {
+		for field := range c {
+			c[field] += shards[i].counts[field].Load()
+		}
+		for kind := range latency {
+			if h := shards[i].latency[kind].Snapshot(); h.Count > 0 {
+				latency[kind] = latency[kind].Merge(h)
+			}
+		}
+	}
+
+	stats := Stats{
+		TotalReads:            int(c[statTotalReads]),
+		TotalWrites:           int(c[statTotalWrites]),
+		TotalUpdates:          int(c[statTotalUpdates]),
+		LostUpdates:           int(c[statLostUpdates]),
+		DataCorruption:        int(c[statDataCorruption]),
+		ResurrectionsBlocked:  int(c[statResurrectionsBlocked]),
+		TombstonesCollected:   int(c[statTombstonesCollected]),
+		UpsertInserts:         int(c[statUpsertInserts]),
+		LockTimeouts:          int(c[statLockTimeouts]),
+		Deadlocks:             int(c[statDeadlocks]),
+		ValidationFailures:    int(c[statValidationFailures]),
+		AdmissionQueued:       int(c[statAdmissionQueued]),
+		AdmissionWait:         time.Duration(c[statAdmissionWait]),
+		DeadlinesMissed:       int(c[statDeadlinesMissed]),
+		WriteConflicts:        int(c[statWriteConflicts]),
+		SerializationFailures: int(c[statSerializationFailures]),
+		TimestampRestarts:     int(c[statTimestampRestarts]),
+		VacuumRuns:            int(c[statVacuumRuns]),
+		VersionsReclaimed:     int(c[statVersionsReclaimed]),
+		TransactionRetries:    int(c[statTransactionRetries]),
+		BackoffWait:           time.Duration(c[statBackoffWait]),
+		PayloadBytes:          int(c[statPayloadBytes]),
+		KeysEvicted:           int(c[statKeysEvicted]),
+		Pins:                  int(c[statPins]),
+		PinnedKeys:            int(c[statPinnedKeys]),
+		KeysExpired:           int(c[statKeysExpired]),
+		Checkpoints:           int(c[statCheckpoints]),
+		Commits:               int(c[statCommits]),
+		Aborts:                int(c[statAborts]),
+		Conflicts:             int(c[statConflicts]),
+		Latency:               make(map[string]LatencyHistogram),
+	}
+	for kind := OpKind(0); kind < NumOpKinds; kind++ {
+		if h := latency[kind]; h.Count > 0 {
+			stats.Latency[kind.String()] = h
+		}
+	}
+	return stats
+}
+
+// Since returns the statistics of what happened after before, an earlier
+// snapshot of the same database
+func (s Stats) Since(before Stats) Stats {
+	d := Stats{
+		TotalReads:            s.TotalReads - before.TotalReads,
+		TotalWrites:           s.TotalWrites - before.TotalWrites,
+		TotalUpdates:          s.TotalUpdates - before.TotalUpdates,
+		LostUpdates:           s.LostUpdates - before.LostUpdates,
+		DataCorruption:        s.DataCorruption - before.DataCorruption,
+		ResurrectionsBlocked:  s.ResurrectionsBlocked - before.ResurrectionsBlocked,
+		TombstonesCollected:   s.TombstonesCollected - before.TombstonesCollected,
+		UpsertInserts:         s.UpsertInserts - before.UpsertInserts,
+		LockTimeouts:          s.LockTimeouts - before.LockTimeouts,
+		Deadlocks:             s.Deadlocks - before.Deadlocks,
+		ValidationFailures:    s.ValidationFailures - before.ValidationFailures,
+		AdmissionQueued:       s.AdmissionQueued - before.AdmissionQueued,
+		AdmissionWait:         s.AdmissionWait - before.AdmissionWait,
+		DeadlinesMissed:       s.DeadlinesMissed - before.DeadlinesMissed,
+		WriteConflicts:        s.WriteConflicts - before.WriteConflicts,
+		SerializationFailures: s.SerializationFailures - before.SerializationFailures,
+		TimestampRestarts:     s.TimestampRestarts - before.TimestampRestarts,
+		VacuumRuns:            s.VacuumRuns - before.VacuumRuns,
+		VersionsReclaimed:     s.VersionsReclaimed - before.VersionsReclaimed,
+		TransactionRetries:    s.TransactionRetries - before.TransactionRetries,
+		BackoffWait:           s.BackoffWait - before.BackoffWait,
+		PayloadBytes:          s.PayloadBytes, // A level, not a count
+		KeysEvicted:           s.KeysEvicted - before.KeysEvicted,
+		Pins:                  s.Pins,
+		PinnedKeys:            s.PinnedKeys,
+		KeysExpired:           s.KeysExpired - before.KeysExpired,
+		Checkpoints:           s.Checkpoints - before.Checkpoints,
+		Commits:               s.Commits - before.Commits,
+		Aborts:                s.Aborts - before.Aborts,
+		Conflicts:             s.Conflicts - before.Conflicts,
+		Latency:               make(map[string]LatencyHistogram),
+	}
+	for kind, h := range s.Latency {
+		if since := h.Since(before.Latency[kind]); since.Count > 0 {
+			d.Latency[kind] = since
+		}
+	}
+	return d
+}
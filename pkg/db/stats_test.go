@@ -0,0 +1,240 @@
+package db
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestLatencyBuckets verifies every latency lands in a bucket whose range
+// holds it, and that a bucket is never wider than 1/32 of its values
+func TestLatencyBuckets(t *testing.T) {
+	latencies := []time.Duration{0, 1, 63, 64, 65, 127, 128, 999, time.Microsecond,
+		12345 * time.Nanosecond, time.Millisecond, 3 * time.Second, 60 * time.Second}
+	last := -1
+	for _, d := range latencies {
+		bucket := latencyBucket(d)
+		lower, upper := latencyBucketBounds(bucket)
+		if d < lower || d >= upper {
+			t.Errorf("%v landed in bucket %d, which holds [%v, %v)", d, bucket, lower, upper)
+		}
+		if width := upper - lower; width > 1 && width*subBuckets > lower {
+			t.Errorf("Bucket %d [%v, %v) is wider than 1/%d of its values", bucket, lower, upper, subBuckets)
+		}
+		if bucket < last {
+			t.Errorf("Bucket %d of %v comes before the previous latency's bucket %d", bucket, d, last)
+		}
+		last = bucket
+	}
+	if got := latencyBucket(time.Hour); got != latencyBuckets-1 {
+		t.Errorf("Expected an hour in the last bucket, got %d", got)
+	}
+}
+
+// TestLatencyPercentiles verifies percentiles are read to within 1/32 of
+// the true value and never above the longest latency
+func TestLatencyPercentiles(t *testing.T) {
+	var c LatencyCounters
+	for i := 1; i <= 1000; i++ {
+		c.Observe(time.Duration(i) * time.Microsecond)
+	}
+	h := c.Snapshot()
+
+	if h.Count != 1000 || h.Max != time.Millisecond {
+		t.Fatalf("Expected 1000 latencies up to 1ms, got %d up to %v", h.Count, h.Max)
+	}
+	for _, p := range []struct {
+		got, want time.Duration
+	}{
+		{h.P50, 501 * time.Microsecond},
+		{h.P90, 901 * time.Microsecond},
+		{h.P99, 991 * time.Microsecond},
+		{h.P999, 1000 * time.Microsecond},
+	} {
+		if p.got < p.want-p.want/subBuckets || p.got > p.want+p.want/subBuckets {
+			t.Errorf("Expected a percentile within 1/%d of %v, got %v", subBuckets, p.want, p.got)
+		}
+	}
+	if h.P999 > h.Max {
+		t.Errorf("p99.9 %v exceeds the maximum %v", h.P999, h.Max)
+	}
+	if mean := h.Mean(); mean != 500500*time.Nanosecond {
+		t.Errorf("Unexpected mean %v", mean)
+	}
+}
+
+// TestLatencySince verifies the histogram since an earlier snapshot holds
+// only the later latencies
+func TestLatencySince(t *testing.T) {
+	var c LatencyCounters
+	for i := 0; i < 100; i++ {
+		c.Observe(time.Second)
+	}
+	before := c.Snapshot()
+	for i := 1; i <= 100; i++ {
+		c.Observe(time.Duration(i) * time.Microsecond)
+	}
+	since := c.Snapshot().Since(before)
+
+	if since.Count != 100 || since.Total != 5050*time.Microsecond {
+		t.Fatalf("Expected 100 latencies totalling 5.05ms, got %d totalling %v", since.Count, since.Total)
+	}
+	if since.Max < 100*time.Microsecond || since.Max > 100*time.Microsecond+100*time.Microsecond/subBuckets {
+		t.Errorf("Expected a maximum of about 100µs, got %v", since.Max)
+	}
+	if since.P50 < 48*time.Microsecond || since.P50 > 53*time.Microsecond {
+		t.Errorf("Expected a median of about 50µs, got %v", since.P50)
+	}
+	if empty := before.Since(before); empty.Count != 0 || empty.P99 != 0 {
+		t.Errorf("Expected nothing since itself, got %+v", empty)
+	}
+}
+
+// TestLatencyMerge verifies merged histograms hold both sets of latencies
+func TestLatencyMerge(t *testing.T) {
+	var fast, slow LatencyCounters
+	for i := 1; i <= 90; i++ {
+		fast.Observe(time.Duration(i) * time.Microsecond)
+	}
+	for i := 0; i < 10; i++ {
+		slow.Observe(time.Second)
+	}
+	merged := fast.Snapshot().Merge(slow.Snapshot())
+
+	if merged.Count != 100 || merged.Max != time.Second {
+		t.Fatalf("Expected 100 latencies up to 1s, got %d up to %v", merged.Count, merged.Max)
+	}
+	if merged.P50 < 49*time.Microsecond || merged.P50 > 53*time.Microsecond {
+		t.Errorf("Expected a median of about 51µs, got %v", merged.P50)
+	}
+	if merged.P99 < 990*time.Millisecond {
+		t.Errorf("Expected a p99 of about 1s, got %v", merged.P99)
+	}
+	if same := merged.Merge(LatencyHistogram{}); same.Count != merged.Count || same.P50 != merged.P50 {
+		t.Errorf("Merging nothing changed %+v into %+v", merged, same)
+	}
+}
+
+// TestStatsCountOutcomes verifies commits, aborts, conflicts and operation
+// latencies are counted
+func TestStatsCountOutcomes(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetLockTimeout(0)
+
+	tx := db.BeginTransaction()
+	db.Put(tx, "a", 1)
+	db.Commit(tx)
+
+	holder := db.BeginTransaction()
+	db.Put(holder, "a", 2)
+	loser := db.BeginTransaction()
+	if err := db.Put(loser, "a", 3); err == nil {
+		t.Fatal("Expected the lock wait to time out")
+	}
+	db.Abort(loser)
+	db.Abort(holder)
+
+	stats := db.Stats()
+	if stats.Commits != 1 || stats.Aborts != 2 || stats.Conflicts != 1 {
+		t.Errorf("Expected 1 commit and 2 aborts, 1 a conflict, got %d, %d and %d",
+			stats.Commits, stats.Aborts, stats.Conflicts)
+	}
+	if stats.Latency["write"].Count != 3 || stats.Latency["commit"].Count != 1 {
+		t.Errorf("Expected 3 writes and 1 commit timed, got %+v", stats.Latency)
+	}
+}
+
+// TestStatsSnapshotsAreConsistent takes snapshots while transactions time
+// out on each other's locks, and checks every snapshot is a consistent
+// cut: no counter runs ahead of the counter it is part of, whichever
+// shards the two went to
+func TestStatsSnapshotsAreConsistent(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetLockTimeout(0)
+	db.stats = statCounters{shards: make([]statShard, 4)}
+
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				db.RunTransaction(func(tx *Transaction) error {
+					return db.Put(tx, "hot", 1)
+				})
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		stats := db.Stats()
+		if stats.Deadlocks > stats.LockTimeouts || stats.Conflicts > stats.Aborts {
+			t.Errorf("Inconsistent snapshot: %+v", stats)
+			break
+		}
+	}
+	stop.Store(true)
+	wg.Wait()
+}
+
+// TestStatsShardsAddUp counts from several goroutines into four shards,
+// and checks Stats adds every count and latency up
+func TestStatsShardsAddUp(t *testing.T) {
+	db := NewSynchronizedDatabase(Fair)
+	db.SetProcessingDelays(NoProcessingDelays)
+	db.stats = statCounters{shards: make([]statShard, 4)}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				tx := db.BeginTransaction()
+				db.Write(tx, "x", i)
+				db.Read(tx, "x")
+				db.Commit(tx)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := db.Stats()
+	if stats.TotalWrites != 400 || stats.TotalReads != 400 || stats.Commits != 400 {
+		t.Errorf("%d writes, %d reads and %d commits, want 400 each", stats.TotalWrites, stats.TotalReads, stats.Commits)
+	}
+	for _, kind := range []string{"write", "read", "commit"} {
+		if h := stats.Latency[kind]; h.Count != 400 || len(h.counts) == 0 {
+			t.Errorf("%s latency %+v, want 400 timed", kind, h)
+		}
+	}
+	used := 0
+	for i := range db.stats.shards {
+		if db.stats.shards[i].counts[statCommits].Load() > 0 {
+			used++
+		}
+	}
+	if used < 2 {
+		t.Errorf("commits counted in %d of 4 shards", used)
+	}
+}
+
+// BenchmarkCountStat counts from every core into one shard, as the
+// statistics did before they were sharded, and into a shard per core
+func BenchmarkCountStat(b *testing.B) {
+	for name, shards := range map[string]int{"one-shard": 1, "sharded": max(runtime.GOMAXPROCS(0), 2)} {
+		b.Run(name, func(b *testing.B) {
+			db := NewUnsynchronizedDatabase()
+			db.stats = statCounters{shards: make([]statShard, shards)}
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					db.countStat(statTotalReads, 1)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package db
+
+import (
+	"runtime"
+	"sort"
+)
+
+// Striped locks. A synchronized database splits its records into stripes
+// by a hash of the key, each a map guarded by its own reader-writer lock
+// under the database's lock policy. An operation on one key locks only
+// its stripe, and a commit only the stripes of the keys it writes, so
+// operations on keys in different stripes run in parallel instead of
+// queueing for one lock. Whole-database operations, such as scans, index
+// maintenance and tombstone collection, lock every stripe in order, which
+// is also what a single stripe degenerates to: the one lock the engine
+// started with.
+
+// DefaultStripes is how many stripes a new synchronized database has; 0
+// sizes it to four per GOMAXPROCS
+var DefaultStripes = 0
+
+// defaultStripes returns the stripe count DefaultStripes asks for
+func defaultStripes() int {
+	if DefaultStripes > 0 {
+		return DefaultStripes
+	}
+	return 4 * runtime.GOMAXPROCS(0)
+}
+
+// stripeOf returns the stripe of n that key belongs to: its FNV-1a hash,
+// computed inline since every operation needs it, modulo n
+func stripeOf(key string, n int) int {
+	if n == 1 {
+		return 0
+	}
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % uint32(n))
+}
+
+// recordMap is the records of a database, split into one map per stripe.
+// An unsynchronized database has a single map.
+type recordMap []map[string]*Record
+
+// newRecordMap returns an empty record map of n stripes
+func newRecordMap(n int) recordMap {
+	m := make(recordMap, n)
+	for i := range m {
+		m[i] = make(map[string]*Record)
+	}
+	return m
+}
+
+// get returns key's record, if it has one
+func (m recordMap) get(key string) (*Record, bool) {
+	record, exists := m[stripeOf(key, len(m))][key]
+	return record, exists
+}
+
+// set makes record key's record
+func (m recordMap) set(key string, record *Record) {
+	m[stripeOf(key, len(m))][key] = record
+}
+
+// remove deletes key's record
+func (m recordMap) remove(key string) {
+	delete(m[stripeOf(key, len(m))], key)
+}
+
+// each calls fn with every key and its record, in no particular order. fn
+// may remove the key it was called with.
+func (m recordMap) each(fn func(key string, record *Record)) {
+	for _, stripe := range m {
+		for key, record := range stripe {
+			fn(key, record)
+		}
+	}
+}
+
+// stripedLock is the locks of a database's stripes, all under one policy
+type stripedLock struct {
+	policy  LockPolicy
+	stripes []*PolicyRWLock
+}
+
+// newStripedLock returns n unlocked stripes under policy
+func newStripedLock(policy LockPolicy, n int) *stripedLock {
+	l := &stripedLock{policy: policy, stripes: make([]*PolicyRWLock, n)}
+	for i := range l.stripes {
+		l.stripes[i] = NewPolicyRWLock(policy)
+	}
+	return l
+}
+
+// Policy returns the policy every stripe's lock follows
+func (l *stripedLock) Policy() LockPolicy {
+	return l.policy
+}
+
+// WaitStats adds up the waits of every stripe. Locking the whole database
+// counts one acquisition per stripe.
+func (l *stripedLock) WaitStats() LockWaitStats {
+	var total LockWaitStats
+	for _, stripe := range l.stripes {
+		s := stripe.WaitStats()
+		total.ReaderAcquisitions += s.ReaderAcquisitions
+		total.WriterAcquisitions += s.WriterAcquisitions
+		total.ReaderWait += s.ReaderWait
+		total.WriterWait += s.WriterWait
+	}
+	return total
+}
+
+// RLock locks every stripe in shared mode, in order
+func (l *stripedLock) RLock() {
+	for _, stripe := range l.stripes {
+		stripe.RLock()
+	}
+}
+
+// RUnlock releases RLock
+func (l *stripedLock) RUnlock() {
+	for i := len(l.stripes) - 1; i >= 0; i-- {
+		l.stripes[i].RUnlock()
+	}
+}
+
+// Lock locks every stripe in exclusive mode, in order
+func (l *stripedLock) Lock() {
+	for _, stripe := range l.stripes {
+		stripe.Lock()
+	}
+}
+
+// Unlock releases Lock
+func (l *stripedLock) Unlock() {
+	for i := len(l.stripes) - 1; i >= 0; i-- {
+		l.stripes[i].Unlock()
+	}
+}
+
+// stripesOf returns the distinct stripes of keys, in ascending order, the
+// order they must be locked in
+func (l *stripedLock) stripesOf(keys []string) []int {
+	seen := make(map[int]bool, len(keys))
+	stripes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		if i := stripeOf(key, len(l.stripes)); !seen[i] {
+			seen[i] = true
+			stripes = append(stripes, i)
+		}
+	}
+	sort.Ints(stripes)
+	return stripes
+}
+
+// Stripes returns how many stripes db's records are split into; 1 on the
+// unsynchronized engine
+func (db *Database) Stripes() int {
+	return len(db.records)
+}
+
+// SetStripes splits db's records into n stripes, each with its own lock,
+// or puts them back under a single lock if n is 1. It does nothing on the
+// unsynchronized engine and should be called before the database is
+// shared.
+func (db *Database) SetStripes(n int) {
+	if db.lock == nil || n < 1 {
+		return
+	}
+	db.setLock(db.lock.Policy(), n)
+}
+
+// setLock guards db's records with n stripes under policy
+func (db *Database) setLock(policy LockPolicy, n int) {
+	db.lock = newStripedLock(policy, n)
+	records := newRecordMap(n)
+	db.records.each(records.set)
+	db.records = records
+}
+
+// rLockKey locks the stripe of key in shared mode, if there are stripes
+func (db *Database) rLockKey(key string) {
+	if db.lock != nil {
+		db.lock.stripes[stripeOf(key, len(db.lock.stripes))].RLock()
+	}
+}
+
+// rUnlockKey releases rLockKey
+func (db *Database) rUnlockKey(key string) {
+	if db.lock != nil {
+		db.lock.stripes[stripeOf(key, len(db.lock.stripes))].RUnlock()
+	}
+}
+
+// wLockKey locks the stripe of key in exclusive mode, if there are
+// stripes
+func (db *Database) wLockKey(key string) {
+	if db.lock != nil {
+		db.lock.stripes[stripeOf(key, len(db.lock.stripes))].Lock()
+	}
+}
+
+// wUnlockKey releases wLockKey and wakes WaitFor callers, like wUnlock
+func (db *Database) wUnlockKey(key string) {
+	if db.lock != nil {
+		db.lock.stripes[stripeOf(key, len(db.lock.stripes))].Unlock()
+	}
+	db.notifyChange()
+}
+
+// wLockKeys locks the stripes of keys in exclusive mode for a commit, and
+// returns the function that unlocks them. With indexes or invariants the
+// commit reads and changes more than its own keys, so it locks the whole
+// database instead.
+func (db *Database) wLockKeys(keys []string) (unlock func()) {
+	if db.lock == nil || len(db.invariants.invariants) > 0 {
+		db.wLock()
+		return db.wUnlock
+	}
+	stripes := db.lock.stripesOf(keys)
+	if len(stripes) == 0 {
+		stripes = []int{0} // Enough to keep indexes from changing
+	}
+	for _, i := range stripes {
+		db.lock.stripes[i].Lock()
+	}
+	unlock = func() {
+		for j := len(stripes) - 1; j >= 0; j-- {
+			db.lock.stripes[stripes[j]].Unlock()
+		}
+		db.notifyChange()
+	}
+	// Indexes are created and dropped under every stripe, so holding any
+	// one of them is enough to check for them
+	if len(db.indexes) > 0 {
+		unlock()
+		db.wLock()
+		return db.wUnlock
+	}
+	return unlock
+}
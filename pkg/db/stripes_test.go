@@ -0,0 +1,126 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestStripesSplitRecords checks keys spread over the stripes, survive
+// restriping, and that a single stripe is the old single lock
+func TestStripesSplitRecords(t *testing.T) {
+	db := NewSynchronizedDatabase(Fair)
+	if db.Stripes() != defaultStripes() {
+		t.Errorf("%d stripes, want %d", db.Stripes(), defaultStripes())
+	}
+	db.SetStripes(8)
+	tx := db.BeginTransaction()
+	for i := 0; i < 100; i++ {
+		db.Write(tx, fmt.Sprintf("key_%d", i), i)
+	}
+	db.Commit(tx)
+	for i, stripe := range db.records {
+		if len(stripe) == 0 || len(stripe) == 100 {
+			t.Errorf("stripe %d holds %d of 100 keys", i, len(stripe))
+		}
+	}
+
+	for _, n := range []int{1, 3} {
+		db.SetStripes(n)
+		tx := db.BeginTransaction()
+		for i := 0; i < 100; i++ {
+			if value, ok := db.Read(tx, fmt.Sprintf("key_%d", i)); !ok || value != i {
+				t.Fatalf("%d stripes: key_%d = %d, %v", n, i, value, ok)
+			}
+		}
+		db.Commit(tx)
+	}
+	if NewUnsynchronizedDatabase().Stripes() != 1 {
+		t.Error("unsynchronized database striped")
+	}
+}
+
+// TestStripesRunInParallel holds the lock of one key's stripe and checks
+// a key in another stripe can still be read and committed, while one in
+// the same stripe waits
+func TestStripesRunInParallel(t *testing.T) {
+	db := NewSynchronizedDatabase(Fair)
+	db.SetStripes(4)
+	db.SetProcessingDelays(NoProcessingDelays)
+	keys := make(map[int]string)
+	for i := 0; len(keys) < 2; i++ {
+		key := fmt.Sprintf("key_%d", i)
+		if stripe := stripeOf(key, 4); stripe < 2 && keys[stripe] == "" {
+			keys[stripe] = key
+		}
+	}
+	held, other := keys[0], keys[1]
+
+	db.wLockKey(held)
+	var wg sync.WaitGroup
+	done := make(chan string, 2)
+	for _, key := range []string{other, held} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			tx := db.BeginTransaction()
+			db.Write(tx, key, 1)
+			db.Commit(tx)
+			done <- key
+		}(key)
+	}
+
+	select {
+	case key := <-done:
+		if key != other {
+			t.Errorf("%s committed while its stripe was locked", key)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s waited for the lock of another stripe", other)
+	}
+	db.wUnlockKey(held)
+	wg.Wait()
+	if key := <-done; key != held {
+		t.Errorf("%s committed twice", key)
+	}
+}
+
+// TestStripedCounter increments counters in every stripe from many
+// goroutines, for the race detector, and checks no update was lost
+func TestStripedCounter(t *testing.T) {
+	db := NewSynchronizedDatabase(PreferWriters)
+	db.SetStripes(4)
+	db.SetProcessingDelays(NoProcessingDelays)
+	setup := db.BeginTransaction()
+	for k := 0; k < 8; k++ {
+		db.Write(setup, fmt.Sprintf("counter_%d", k), 0)
+	}
+	db.Commit(setup)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				tx := db.BeginTransaction()
+				db.Update(tx, fmt.Sprintf("counter_%d", (g+i)%8), 1)
+				db.Scan(tx, "counter_")
+				db.Commit(tx)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	tx := db.BeginTransaction()
+	rows, _ := db.Scan(tx, "counter_")
+	db.Commit(tx)
+	total := 0
+	for _, value := range rows {
+		total += value
+	}
+	if total != 400 {
+		t.Errorf("counters add up to %d, want 400", total)
+	}
+}
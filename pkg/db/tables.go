@@ -0,0 +1,88 @@
+package db
+
+import (
+	"sort"
+)
+
+// A database can hold named tables, each a database of its own: it has its
+// own records, its own database lock and, depending on the engine, its own
+// key locks, version store or timestamps. Two tables can use the same keys
+// without seeing each other, and transactions on one never wait for, or
+// conflict with, transactions on another. A transaction belongs to the
+// table it was begun on:
+//
+//	accounts := db.Table("accounts")
+//	tx := accounts.BeginTransaction()
+//	accounts.Write(tx, "alice", 100)
+//	accounts.Commit(tx)
+//
+// db itself acts as the default table; its records are not in any named one.
+
+// Table returns the table called name, creating it on first use with db's
+// engine and its lock policy, lock timeout, tombstone grace period,
+// history depth, upsert-on-update, field locking and retry settings as
+// they are at that moment. Hooks,
+// storage, journals, validators and admission limits are not inherited:
+// set them on the table itself.
+func (db *Database) Table(name string) *Database {
+	db.tablesMu.Lock()
+	defer db.tablesMu.Unlock()
+
+	if table, ok := db.tables[name]; ok {
+		return table
+	}
+	if db.tables == nil {
+		db.tables = make(map[string]*Database)
+	}
+	table := db.newTable()
+	db.tables[name] = table
+	return table
+}
+
+// Tables returns the names of db's tables, sorted
+func (db *Database) Tables() []string {
+	db.tablesMu.Lock()
+	defer db.tablesMu.Unlock()
+
+	names := make([]string, 0, len(db.tables))
+	for name := range db.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newTable creates an empty database with db's engine and settings
+func (db *Database) newTable() *Database {
+	var table *Database
+	switch {
+	case db.mvcc != nil:
+		table = NewMVCCDatabase()
+	case db.tso != nil:
+		table = NewTimestampOrderingDatabase()
+	case db.locks != nil:
+		table = NewTwoPhaseLockingDatabase()
+	case db.lock != nil:
+		table = NewSynchronizedDatabase(db.lock.Policy())
+	default:
+		table = NewUnsynchronizedDatabase()
+	}
+	if db.lock != nil && (table.lock.Policy() != db.lock.Policy() || table.Stripes() != db.Stripes()) {
+		table.setLock(db.lock.Policy(), db.Stripes())
+	}
+	if db.locks != nil {
+		db.locks.mu.Lock()
+		table.SetLockTimeout(db.locks.timeout)
+		db.locks.mu.Unlock()
+	}
+
+	table.tombstoneGrace = db.tombstoneGrace
+	table.historyDepth = db.historyDepth
+	table.upsertOnUpdate = db.upsertOnUpdate
+	table.fieldLocking = db.fieldLocking
+	table.clock = db.clock
+	db.txMu.Lock()
+	table.retryPolicy = db.retryPolicy
+	db.txMu.Unlock()
+	return table
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestTablesAreSeparate verifies tables with the same keys keep their own
+// values and that Table returns the same table for the same name
+func TestTablesAreSeparate(t *testing.T) {
+	for name, newDB := range atomicEngines {
+		t.Run(name, func(t *testing.T) {
+			db := newDB()
+			accounts, counters := db.Table("accounts"), db.Table("counters")
+			if db.Table("accounts") != accounts {
+				t.Fatal("Table returned a new table for an existing name")
+			}
+			if accounts.EngineName() != db.EngineName() {
+				t.Errorf("Table engine = %s, want %s", accounts.EngineName(), db.EngineName())
+			}
+
+			tx := accounts.BeginTransaction()
+			accounts.Put(tx, "alice", 100)
+			accounts.Commit(tx)
+			tx = counters.BeginTransaction()
+			counters.Put(tx, "alice", 1)
+			counters.Commit(tx)
+
+			tx = accounts.BeginTransaction()
+			if value, err := accounts.Get(tx, "alice"); err != nil || value != 100 {
+				t.Errorf("accounts alice = %d, %v; want 100", value, err)
+			}
+			accounts.Commit(tx)
+			tx = db.BeginTransaction()
+			if _, err := db.Get(tx, "alice"); err == nil {
+				t.Error("A table's key is visible in the default table")
+			}
+			db.Commit(tx)
+			if tables := fmt.Sprint(db.Tables()); tables != "[accounts counters]" {
+				t.Errorf("Tables = %s, want [accounts counters]", tables)
+			}
+		})
+	}
+}
+
+// TestTablesHaveSeparateLocks verifies a transaction holding a key lock in
+// one table does not block the same key in another
+func TestTablesHaveSeparateLocks(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetLockTimeout(20 * time.Millisecond)
+	accounts, counters := db.Table("accounts"), db.Table("counters")
+
+	holder := accounts.BeginTransaction()
+	accounts.Put(holder, "alice", 100)
+
+	tx := counters.BeginTransaction()
+	if err := counters.Put(tx, "alice", 1); err != nil {
+		t.Errorf("Write to the other table waited for the lock: %v", err)
+	}
+	counters.Commit(tx)
+
+	blocked := accounts.BeginTransaction()
+	if err := accounts.Put(blocked, "alice", 1); err == nil {
+		t.Error("Write to the same table did not wait for the lock")
+	}
+	accounts.Abort(blocked)
+	accounts.Commit(holder)
+}
@@ -0,0 +1,334 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Timestamp ordering (T/O) serializes transactions in the order they began
+// instead of the order they lock things. Every transaction gets a timestamp
+// at begin (its ID, since IDs are handed out in begin order), and every key
+// remembers the youngest timestamp that read it and the timestamp of its
+// last committed write. An operation that arrives too late to fit the
+// timestamp order, such as writing a key a younger transaction already read,
+// aborts the transaction; the client restarts it with a new timestamp.
+//
+// Writes are buffered until commit (strict T/O), so nobody reads
+// uncommitted data. A transaction that touches a key an older transaction
+// has a pending write on waits for that write's outcome. Only younger
+// transactions ever wait for older ones, so waits cannot deadlock. A wait
+// ends early if the waiting transaction's context is done.
+//
+// Scans check the keys they find but do not protect the range, so T/O here
+// does not prevent phantoms.
+
+// tsoKey is the timestamp bookkeeping for one key
+type tsoKey struct {
+	readTS    int // Youngest transaction that read the key
+	writeTS   int // Transaction whose write to the key committed last
+	pendingTS int // Transaction with an uncommitted write to the key, 0 if none
+}
+
+// timestampOrdering holds the per-key timestamps of a T/O database
+type timestampOrdering struct {
+	mu      sync.Mutex
+	keys    map[string]*tsoKey
+	owned   map[int][]string // Keys each transaction made pending, nested ones included
+	settled *sync.Cond       // Broadcast when a pending write commits or aborts
+}
+
+// newTimestampOrdering creates empty timestamp bookkeeping
+func newTimestampOrdering() *timestampOrdering {
+	t := &timestampOrdering{
+		keys:  make(map[string]*tsoKey),
+		owned: make(map[int][]string),
+	}
+	t.settled = sync.NewCond(&t.mu)
+	return t
+}
+
+// NewTimestampOrderingDatabase creates a database that uses basic timestamp
+// ordering: conflicting operations must happen in the order their
+// transactions began, and a transaction that is too late is aborted and
+// counted in Stats.TimestampRestarts rather than made to wait
+func NewTimestampOrderingDatabase() *Database {
+	db := NewSynchronizedDatabase(Fair)
+	db.tso = newTimestampOrdering()
+	return db
+}
+
+// key returns key's bookkeeping, creating it if needed. Must be called with
+// t.mu held.
+func (t *timestampOrdering) key(key string) *tsoKey {
+	k, ok := t.keys[key]
+	if !ok {
+		k = &tsoKey{}
+		t.keys[key] = k
+	}
+	return k
+}
+
+// tsoAccess checks tx's read and/or write of key against timestamp order.
+// If the access is in order it is recorded and the value tx sees is
+// returned; otherwise reason says why tx has to restart.
+func (db *Database) tsoAccess(tx *Transaction, key string, read, write bool) (value int, exists bool, reason string) {
+	t := db.tso
+	ts := tx.ID
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if tx.ctx != nil && tx.ctx.Done() != nil {
+		// sync.Cond has no cancellable wait, so wake the waiters when
+		// tx's context is done
+		stop := context.AfterFunc(tx.ctx, func() {
+			t.mu.Lock()
+			t.settled.Broadcast()
+			t.mu.Unlock()
+		})
+		defer stop()
+	}
+
+	k := t.key(key)
+	for k.pendingTS != 0 && k.pendingTS < ts {
+		if err := tx.Context().Err(); err != nil {
+			return 0, false, err.Error()
+		}
+		// An older transaction's write has to commit or abort before we
+		// know which value fits our place in the order
+		t.settled.Wait()
+	}
+
+	if pending, mine := tx.pending(key); mine && k.pendingTS == ts {
+		// Our own pending write: nothing can come between
+		if read && ts > k.readTS {
+			k.readTS = ts
+		}
+		tx.readFrom = readOwnWrite
+		return pending.Value, !pending.Deleted, ""
+	}
+	if read && ts < k.writeTS {
+		return 0, false, fmt.Sprintf("timestamp order: read of %s after younger tx %d wrote it", key, k.writeTS)
+	}
+	if write {
+		if ts < k.readTS {
+			return 0, false, fmt.Sprintf("timestamp order: write of %s after younger tx %d read it", key, k.readTS)
+		}
+		if younger := max(k.writeTS, k.pendingTS); ts < younger {
+			return 0, false, fmt.Sprintf("timestamp order: write of %s after younger tx %d wrote it", key, younger)
+		}
+		k.pendingTS = ts
+		t.owned[ts] = append(t.owned[ts], key)
+	}
+	if read && ts > k.readTS {
+		k.readTS = ts
+	}
+
+	// Read under t.mu so no younger write can be installed in between
+	db.rLockKey(key)
+	record, found := db.records.get(key)
+	tx.readFrom = 0
+	if found {
+		tx.readFrom = record.WrittenBy
+	}
+	if found && record.live(db.clock.Now()) {
+		value, exists = record.Value, true
+	}
+	db.rUnlockKey(key)
+	return value, exists, ""
+}
+
+// tsoCheck runs tsoAccess and aborts tx if it arrived too late or its
+// context was done while it waited
+func (db *Database) tsoCheck(tx *Transaction, op string, key string, read, write bool) (int, bool, bool) {
+	value, exists, reason := db.tsoAccess(tx, key, read, write)
+	if reason != "" && db.cancelled(tx) {
+		tx.logOp("%s %s: CANCELLED", op, key)
+		return 0, false, false
+	}
+	if reason != "" {
+		db.countStat(statTimestampRestarts, 1)
+		tx.conflict = true
+		tx.logOp("%s %s: TIMESTAMP_ORDER_VIOLATION", op, key)
+		db.abortWithReason(tx, reason)
+		return 0, false, false
+	}
+	return value, exists, true
+}
+
+// tsoRead reads key if tx's timestamp allows it
+func (db *Database) tsoRead(tx *Transaction, key string) (int, bool) {
+	db.countStat(statTotalReads, 1)
+	value, exists, ok := db.tsoCheck(tx, "READ", key, true, false)
+	if !ok {
+		return 0, false
+	}
+
+	// Simulate some processing time
+	db.process(tx, OpRead)
+
+	if !exists {
+		tx.logOp("READ %s: NOT_FOUND", key)
+		return 0, false
+	}
+	tx.logOp("READ %s: %d (ts %d)", key, value, tx.ID)
+	return value, true
+}
+
+// tsoWrite buffers a blind write if tx's timestamp allows it
+func (db *Database) tsoWrite(tx *Transaction, key string, value int) bool {
+	if !db.validateWrite(tx, "WRITE", key, value) {
+		return false
+	}
+	if _, _, ok := db.tsoCheck(tx, "WRITE", key, false, true); !ok {
+		return false
+	}
+
+	// Simulate some processing time
+	db.process(tx, OpWrite)
+
+	tx.bufferWrite(key, pendingWrite{Value: value, SetsPayload: true})
+	tx.logOp("WRITE %s: %d (pending, ts %d)", key, value, tx.ID)
+	return true
+}
+
+// tsoUpdate reads and writes key in one step if tx's timestamp allows both
+func (db *Database) tsoUpdate(tx *Transaction, key string, delta int, upsert bool, initial int) bool {
+	current, exists, ok := db.tsoCheck(tx, "UPDATE", key, true, true)
+	if !ok {
+		return false
+	}
+	if !exists {
+		if !upsert {
+			tx.logOp("UPDATE %s: NOT_FOUND", key)
+			return false
+		}
+		db.countStat(statUpsertInserts, 1)
+		current = initial
+	}
+
+	// Simulate some processing time
+	db.process(tx, OpUpdate)
+
+	newValue := current + delta
+	if !db.validateWrite(tx, "UPDATE", key, newValue) {
+		return false
+	}
+	tx.bufferWrite(key, pendingWrite{Value: newValue})
+	tx.logOp("UPDATE %s: +%d = %d (pending, ts %d)", key, delta, newValue, tx.ID)
+	return true
+}
+
+// tsoDelete buffers a delete tombstone if tx's timestamp allows it
+func (db *Database) tsoDelete(tx *Transaction, key string) bool {
+	_, exists, ok := db.tsoCheck(tx, "DELETE", key, true, true)
+	if !ok {
+		return false
+	}
+	if !exists {
+		tx.logOp("DELETE %s: NOT_FOUND", key)
+		return false
+	}
+
+	// Simulate some processing time
+	db.process(tx, OpDelete)
+
+	tx.bufferWrite(key, pendingWrite{Deleted: true})
+	tx.logOp("DELETE %s: SUCCESS (pending)", key)
+	return true
+}
+
+// tsoScan reads every live key starting with prefix, checking each against
+// timestamp order. It returns false if tx had to restart.
+func (db *Database) tsoScan(tx *Transaction, prefix string) (map[string]int, bool) {
+	found := make(map[string]bool)
+	now := db.clock.Now()
+	db.rLock()
+	db.records.each(func(key string, record *Record) {
+		if strings.HasPrefix(key, prefix) && record.live(now) {
+			found[key] = true
+		}
+	})
+	db.rUnlock()
+	for _, key := range tx.pendingKeys() {
+		if strings.HasPrefix(key, prefix) {
+			found[key] = true // Our own pending inserts
+		}
+	}
+	keys := make([]string, 0, len(found))
+	for key := range found {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rows := make(map[string]int, len(keys))
+	for _, key := range keys {
+		value, exists, ok := db.tsoCheck(tx, "SCAN", key, true, false)
+		if !ok {
+			return nil, false
+		}
+		db.countStat(statTotalReads, 1)
+		if exists {
+			rows[key] = value
+		}
+	}
+
+	tx.logOp("SCAN %s: %d rows (ts %d)", prefix, len(rows), tx.ID)
+	return rows, true
+}
+
+// tsoCommit installs tx's buffered writes and publishes them, then wakes
+// transactions that were waiting for the outcome
+func (db *Database) tsoCommit(tx *Transaction) {
+	t := db.tso
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(tx.writeOrder) > 0 {
+		db.installWrites(tx)
+		db.publishCommit(tx)
+	}
+	for _, key := range tx.writeOrder {
+		t.key(key).writeTS = tx.ID
+	}
+	// Also releases keys written by nested transactions that never
+	// committed into this one
+	t.release(tx.ID)
+	t.settled.Broadcast()
+}
+
+// tsoAbort drops tx's pending writes so waiting transactions can go on.
+// Keys a nested transaction's parent also wrote stay pending.
+func (db *Database) tsoAbort(tx *Transaction) {
+	t := db.tso
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if tx.parent == nil {
+		t.release(tx.ID)
+		t.settled.Broadcast()
+		return
+	}
+	for _, key := range tx.writeOrder {
+		if _, kept := tx.parent.pending(key); kept {
+			continue
+		}
+		if k := t.key(key); k.pendingTS == tx.ID {
+			k.pendingTS = 0
+		}
+	}
+	t.settled.Broadcast()
+}
+
+// release clears every pending write of transaction id. Must be called
+// with t.mu held.
+func (t *timestampOrdering) release(id int) {
+	for _, key := range t.owned[id] {
+		if k := t.key(key); k.pendingTS == id {
+			k.pendingTS = 0
+		}
+	}
+	delete(t.owned, id)
+}
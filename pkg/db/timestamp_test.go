@@ -0,0 +1,69 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTimestampOrderingRejectsLateWrite verifies an older transaction
+// cannot write a key a younger one has already read
+func TestTimestampOrderingRejectsLateWrite(t *testing.T) {
+	db := NewTimestampOrderingDatabase()
+	older := db.BeginTransaction()
+	younger := db.BeginTransaction()
+
+	db.Read(younger, "x")
+	if db.Write(older, "x", 1) {
+		t.Fatal("Older transaction wrote a key a younger one had read")
+	}
+	if !older.Aborted {
+		t.Error("Late writer was not aborted")
+	}
+	db.Commit(younger)
+	if younger.Aborted {
+		t.Errorf("Younger transaction aborted: %s", younger.AbortReason)
+	}
+	if restarts := db.Stats().TimestampRestarts; restarts != 1 {
+		t.Errorf("Timestamp restarts = %d, want 1", restarts)
+	}
+}
+
+// TestTimestampOrderingRejectsLateRead verifies an older transaction
+// cannot read a value a younger one wrote
+func TestTimestampOrderingRejectsLateRead(t *testing.T) {
+	db := NewTimestampOrderingDatabase()
+	older := db.BeginTransaction()
+	younger := db.BeginTransaction()
+
+	db.Write(younger, "x", 1)
+	db.Commit(younger)
+	if _, ok := db.Read(older, "x"); ok || !older.Aborted {
+		t.Error("Older transaction read a younger transaction's write")
+	}
+}
+
+// TestTimestampOrderingWaitsForOlderWrite verifies a younger reader waits
+// for an older transaction's pending write instead of reading around it
+func TestTimestampOrderingWaitsForOlderWrite(t *testing.T) {
+	db := NewTimestampOrderingDatabase()
+	older := db.BeginTransaction()
+	younger := db.BeginTransaction()
+	db.Write(older, "x", 42)
+
+	read := make(chan int)
+	go func() {
+		value, _ := db.Read(younger, "x")
+		db.Commit(younger)
+		read <- value
+	}()
+
+	select {
+	case value := <-read:
+		t.Fatalf("Reader did not wait for the pending write, read %d", value)
+	case <-time.After(20 * time.Millisecond):
+	}
+	db.Commit(older)
+	if value := <-read; value != 42 {
+		t.Errorf("Reader saw x=%d, want 42", value)
+	}
+}
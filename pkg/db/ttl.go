@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A key written with a TTL expires once its deadline passes: from then on
+// every read, scan and snapshot treats it as missing, on every engine, even
+// before anything removes it. The expiry sweeper then turns expired records
+// into tombstones, which CollectTombstones removes after the grace period
+// (and Vacuum, under MVCC, drops expired version chains). Expiry is checked
+// against the database's clock at read time, so a long-running snapshot
+// stops seeing a key once it expires.
+
+// expired reports whether a TTL deadline has passed by now; zero never
+// expires
+func expired(deadline time.Time, now time.Time) bool {
+	return !deadline.IsZero() && !now.Before(deadline)
+}
+
+// live reports whether the record holds a value at now: it is neither
+// deleted nor expired
+func (r Record) live(now time.Time) bool {
+	return !r.Deleted && !expired(r.ExpiresAt, now)
+}
+
+// PutWithTTL sets key to value when tx commits, expiring ttl from now. A
+// later write to the key without a TTL makes it permanent again.
+func (db *Database) PutWithTTL(tx *Transaction, key string, value int, ttl time.Duration) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return db.PutExpiring(tx, key, value, db.clock.Now().Add(ttl))
+}
+
+// WriteWithTTL is PutWithTTL reporting only whether it succeeded
+func (db *Database) WriteWithTTL(tx *Transaction, key string, value int, ttl time.Duration) bool {
+	return db.PutWithTTL(tx, key, value, ttl) == nil
+}
+
+// PutExpiring is Put with an absolute TTL deadline; a zero deadline is a
+// plain Put
+func (db *Database) PutExpiring(tx *Transaction, key string, value int, deadline time.Time) error {
+	if err := db.put(tx, key, value); err != nil || deadline.IsZero() {
+		return err
+	}
+	// Put buffered the write in the transaction that issued it
+	pending := tx.writes[key]
+	pending.ExpiresAt = deadline
+	tx.writes[key] = pending
+	return nil
+}
+
+// putCommitted is PutExpiring keeping a payload too, to write back a value
+// as it was committed elsewhere: replayed from the WAL, shipped to a
+// replica or restored from a snapshot
+func (db *Database) putCommitted(tx *Transaction, key string, value int, payload []byte, deadline time.Time) error {
+	if err := db.PutExpiring(tx, key, value, deadline); err != nil || payload == nil {
+		return err
+	}
+	pending := tx.writes[key]
+	pending.Payload = payload
+	tx.writes[key] = pending
+	return nil
+}
+
+// ExpireKeys turns every expired record into a tombstone and returns how
+// many it found. Readers stop seeing expired keys on their own; this only
+// frees the space.
+func (db *Database) ExpireKeys() int {
+	db.wLock()
+	now := db.clock.Now()
+	keys := make([]string, 0)
+	db.records.each(func(key string, record *Record) {
+		if !record.Deleted && expired(record.ExpiresAt, now) {
+			record.Deleted = true
+			record.DeletedBy = 0 // Not a transaction: never blocks a rewrite
+			db.setPayload(record, nil)
+			record.Version++
+			record.UpdatedAt = now
+			keys = append(keys, key)
+			db.notifyWatchers(ChangeEvent{Key: key, OldValue: record.Value, Existed: true, Deleted: true, Version: record.Version})
+			db.recordChange(record, Modification{Version: record.Version, OldValue: record.Value, Deleted: true, At: now})
+		}
+	})
+	db.updateIndexes(keys)
+	db.publishView(keys)
+	db.wUnlock()
+
+	db.countStat(statKeysExpired, len(keys))
+	return len(keys)
+}
+
+// StartExpirySweeper runs ExpireKeys and CollectTombstones every interval
+// of db's clock until ctx is done. The returned function stops it and
+// waits for the current sweep.
+func (db *Database) StartExpirySweeper(ctx context.Context, interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		for {
+			tick := db.clock.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				tick.Stop()
+				return
+			case <-tick.C():
+				db.ExpireKeys()
+				db.CollectTombstones()
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestTTLKeyExpires verifies a key written with a TTL is readable until it
+// expires and missing afterwards, on every engine, before any sweep
+func TestTTLKeyExpires(t *testing.T) {
+	for name, newDB := range atomicEngines {
+		t.Run(name, func(t *testing.T) {
+			db := newDB()
+			tx := db.BeginTransaction()
+			if err := db.PutWithTTL(tx, "session", 1, 20*time.Millisecond); err != nil {
+				t.Fatalf("PutWithTTL: %v", err)
+			}
+			db.Put(tx, "permanent", 2)
+			db.Commit(tx)
+
+			tx = db.BeginTransaction()
+			if value, err := db.Get(tx, "session"); err != nil || value != 1 {
+				t.Errorf("Before expiry: %d, %v; want 1", value, err)
+			}
+			db.Commit(tx)
+
+			time.Sleep(30 * time.Millisecond)
+			tx = db.BeginTransaction()
+			if _, err := db.Get(tx, "session"); err == nil {
+				t.Error("Expired key is still readable")
+			}
+			if keys, _ := db.ScanPrefix(tx, ""); len(keys) != 1 {
+				t.Errorf("Scan after expiry = %v, want only permanent", keys)
+			}
+			db.Commit(tx)
+			if _, ok := db.TakeSnapshot().Entries["session"]; !ok {
+				t.Error("Expired key was removed without a sweep")
+			}
+		})
+	}
+}
+
+// TestPutClearsTTL verifies a write without a TTL makes a key permanent
+func TestPutClearsTTL(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	tx := db.BeginTransaction()
+	db.PutWithTTL(tx, "key", 1, 10*time.Millisecond)
+	db.Commit(tx)
+
+	tx = db.BeginTransaction()
+	db.Put(tx, "key", 2)
+	db.Commit(tx)
+
+	time.Sleep(20 * time.Millisecond)
+	tx = db.BeginTransaction()
+	if value, err := db.Get(tx, "key"); err != nil || value != 2 {
+		t.Errorf("Rewritten key = %d, %v; want 2", value, err)
+	}
+	db.Commit(tx)
+}
+
+// TestExpireKeysAndCollect verifies the sweep tombstones expired keys,
+// which CollectTombstones then removes
+func TestExpireKeysAndCollect(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetTombstoneGracePeriod(0)
+	tx := db.BeginTransaction()
+	for i := 0; i < 5; i++ {
+		db.PutWithTTL(tx, fmt.Sprintf("session_%d", i), i, time.Millisecond)
+	}
+	db.Put(tx, "permanent", 1)
+	db.Commit(tx)
+
+	time.Sleep(5 * time.Millisecond)
+	if expired := db.ExpireKeys(); expired != 5 {
+		t.Errorf("ExpireKeys = %d, want 5", expired)
+	}
+	if expired := db.ExpireKeys(); expired != 0 {
+		t.Errorf("Second ExpireKeys = %d, want 0", expired)
+	}
+	db.CollectTombstones()
+
+	entries := db.TakeSnapshot().Entries
+	if _, ok := entries["permanent"]; len(entries) != 1 || !ok {
+		t.Errorf("Stored keys after the sweep = %v, want only permanent", entries)
+	}
+	if stats := db.Stats(); stats.KeysExpired != 5 {
+		t.Errorf("KeysExpired = %d, want 5", stats.KeysExpired)
+	}
+}
+
+// TestSweeperWithConcurrentReaders refreshes and reads sessions while the
+// sweeper runs and verifies no reader sees a session past its deadline
+func TestSweeperWithConcurrentReaders(t *testing.T) {
+	db := NewMVCCDatabase()
+	db.SetTombstoneGracePeriod(0)
+	stop := db.StartExpirySweeper(context.Background(), time.Millisecond)
+	defer stop()
+
+	const ttl = 3 * time.Millisecond
+	done := make(chan struct{})
+	var stale atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				deadline := time.Now().Add(ttl)
+				tx := db.BeginTransaction()
+				db.PutExpiring(tx, fmt.Sprintf("session_%d", n%4), int(deadline.UnixMicro()), deadline)
+				db.Commit(tx)
+			}
+		}(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				before := time.Now()
+				tx := db.BeginTransaction()
+				value, err := db.Get(tx, fmt.Sprintf("session_%d", n%4))
+				db.Commit(tx)
+				if err == nil && int64(value) < before.UnixMicro() {
+					stale.Add(1)
+				}
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(done)
+	wg.Wait()
+
+	if stale.Load() > 0 {
+		t.Errorf("%d reads returned an expired session", stale.Load())
+	}
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// A transaction begun with BeginTransactionCtx carries its context the way
+// a database/sql transaction does: once the context is cancelled or its
+// deadline passes, the engine aborts the transaction at its next operation
+// or at Commit, and a wait for an admission slot, a key lock, a range lock
+// or an older timestamp-ordered write gives up right away instead of
+// running into its own timeout.
+
+// BeginTransactionCtx starts a new transaction at the default isolation
+// level that lives no longer than ctx. A deadline on ctx also becomes the
+// transaction's Deadline, as far off on db's clock as it is on the wall
+// clock. If ctx is done before the transaction is admitted, it comes back
+// already aborted.
+func (db *Database) BeginTransactionCtx(ctx context.Context) *Transaction {
+	return db.Begin(ctx, db.DefaultIsolation())
+}
+
+// Begin is BeginTransactionCtx at the given isolation level
+func (db *Database) Begin(ctx context.Context, level IsolationLevel) *Transaction {
+	deadline, ok := ctx.Deadline()
+	if ok {
+		deadline = db.clock.Now().Add(time.Until(deadline))
+	}
+	tx := db.beginTransaction(ctx, level, deadline)
+	db.cancelled(tx)
+	return tx
+}
+
+// Context returns the context tx was begun with, or context.Background
+// if it has none
+func (tx *Transaction) Context() context.Context {
+	if tx.ctx == nil {
+		return context.Background()
+	}
+	return tx.ctx
+}
+
+// cancelled aborts tx if its context is done and reports whether it is
+func (db *Database) cancelled(tx *Transaction) bool {
+	if tx.ctx == nil || tx.ctx.Err() == nil {
+		return false
+	}
+	if !tx.Aborted {
+		db.abortWithReason(tx, tx.ctx.Err().Error())
+	}
+	return true
+}
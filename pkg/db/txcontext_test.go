@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestCancelledContextAbortsTransaction verifies operations and Commit
+// after the context is cancelled abort the transaction and apply nothing
+func TestCancelledContextAbortsTransaction(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	ctx, cancel := context.WithCancel(context.Background())
+	tx := db.BeginTransactionCtx(ctx)
+	if !db.Write(tx, "x", 1) {
+		t.Fatal("Write before cancel failed")
+	}
+	cancel()
+
+	if db.Write(tx, "y", 2) {
+		t.Error("Write after cancel succeeded")
+	}
+	db.Commit(tx)
+	if !tx.Aborted || tx.AbortReason != context.Canceled.Error() {
+		t.Errorf("Aborted = %v (%q), want aborted with %q", tx.Aborted, tx.AbortReason, context.Canceled)
+	}
+
+	check := db.BeginTransaction()
+	if _, exists := db.Read(check, "x"); exists {
+		t.Error("Write of the cancelled transaction is visible")
+	}
+	db.Commit(check)
+}
+
+// TestCommitAfterCancelCountsOneAbort verifies a transaction whose context
+// ends just before Commit is finished once, as one abort
+func TestCommitAfterCancelCountsOneAbort(t *testing.T) {
+	for _, db := range []*Database{NewUnsynchronizedDatabase(), NewTwoPhaseLockingDatabase(), NewMVCCDatabase(), NewTimestampOrderingDatabase()} {
+		ctx, cancel := context.WithCancel(context.Background())
+		tx := db.BeginTransactionCtx(ctx)
+		db.Write(tx, "key", 1)
+		cancel()
+		if err := db.Commit(tx); err == nil {
+			t.Errorf("%s: commit after cancel succeeded", db.EngineName())
+		}
+		if stats := db.Stats(); stats.Commits != 0 || stats.Aborts != 1 {
+			t.Errorf("%s: %d commits and %d aborts, expected one abort", db.EngineName(), stats.Commits, stats.Aborts)
+		}
+	}
+}
+
+// TestLockWaitHonorsContext verifies a blocked key lock wait ends at the
+// context's deadline rather than the lock timeout
+func TestLockWaitHonorsContext(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetLockTimeout(5 * time.Second)
+	holder := db.BeginTransaction()
+	db.Write(holder, "x", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	waiter := db.BeginTransactionCtx(ctx)
+	start := time.Now()
+	if db.Write(waiter, "x", 2) {
+		t.Fatal("Write acquired a lock held by another transaction")
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("Lock wait took %v, want it to end at the 20ms context deadline", waited)
+	}
+	if !waiter.Aborted {
+		t.Error("Waiter was not aborted when its context expired")
+	}
+	if timeouts := db.Stats().LockTimeouts; timeouts != 0 {
+		t.Errorf("LockTimeouts = %d, want 0", timeouts)
+	}
+
+	// The waiter left the queue, so the lock goes free once the holder ends
+	db.Commit(holder)
+	next := db.BeginTransaction()
+	if !db.Write(next, "x", 3) {
+		t.Error("Lock not available after the holder committed")
+	}
+	db.Commit(next)
+}
+
+// TestAdmissionWaitHonorsContext verifies a transaction waiting for an
+// admission slot gives up when its context expires, without leaking a slot
+func TestAdmissionWaitHonorsContext(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	db.SetMaxConcurrentTx(1)
+	holder := db.BeginTransaction()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	queued := db.BeginTransactionCtx(ctx)
+	if !queued.Aborted {
+		t.Fatal("Transaction begun while every slot was taken")
+	}
+	db.Commit(queued)
+	db.Commit(holder)
+
+	admitted := make(chan struct{})
+	go func() {
+		db.Commit(db.BeginTransaction())
+		close(admitted)
+	}()
+	select {
+	case <-admitted:
+	case <-time.After(time.Second):
+		t.Fatal("Slot leaked: no transaction admitted after the holder committed")
+	}
+}
+
+// TestTimestampWaitHonorsContext verifies a younger transaction waiting for
+// an older pending write under T/O gives up when its context is cancelled,
+// without counting a timestamp restart
+func TestTimestampWaitHonorsContext(t *testing.T) {
+	db := NewTimestampOrderingDatabase()
+	older := db.BeginTransaction()
+	db.Write(older, "x", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	younger := db.BeginTransactionCtx(ctx)
+	if _, ok := db.Read(younger, "x"); ok {
+		t.Fatal("Read returned before the older write settled")
+	}
+	if !younger.Aborted {
+		t.Error("Younger transaction was not aborted when its context expired")
+	}
+	if restarts := db.Stats().TimestampRestarts; restarts != 0 {
+		t.Errorf("TimestampRestarts = %d, want 0", restarts)
+	}
+	db.Commit(older)
+}
@@ -0,0 +1,198 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TxStatus is where a transaction is in its lifecycle. A transaction is
+// Active from BeginTransaction until Commit or Abort finishes it; after
+// that every operation on it fails with ErrTxDone (or, if the engine
+// aborted it, ErrTxAborted) instead of quietly running outside any
+// transaction.
+type TxStatus int
+
+const (
+	// TxActive transactions accept operations
+	TxActive TxStatus = iota
+	// TxCommitted transactions committed their writes
+	TxCommitted
+	// TxAborted transactions were aborted by the client or the engine
+	TxAborted
+)
+
+func (s TxStatus) String() string {
+	switch s {
+	case TxActive:
+		return "active"
+	case TxCommitted:
+		return "committed"
+	case TxAborted:
+		return "aborted"
+	default:
+		return fmt.Sprintf("TxStatus(%d)", int(s))
+	}
+}
+
+// ErrTxDone means an operation, or a second Commit, was attempted on a
+// transaction the client already committed or aborted
+var ErrTxDone = errors.New("transaction already finished")
+
+// Status returns where tx is in its lifecycle
+func (tx *Transaction) Status() TxStatus {
+	return tx.status
+}
+
+// finish records tx's final status and stops tracking it as live
+func (db *Database) finish(tx *Transaction, status TxStatus) {
+	tx.status = status
+	if tx.parent != nil {
+		return
+	}
+	db.journalFinish(tx, status)
+	db.countOutcome(tx, status)
+	db.countClient(tx, status)
+	db.liveMu.Lock()
+	delete(db.live, tx.ID)
+	db.liveMu.Unlock()
+}
+
+// track records a top-level transaction as live until it finishes
+func (db *Database) track(tx *Transaction) {
+	if leakDetector != nil {
+		tx.beginSite = beginSite()
+	}
+	db.liveMu.Lock()
+	db.live[tx.ID] = tx
+	db.liveMu.Unlock()
+}
+
+// beginSite returns the file and line of the first caller outside the
+// database's Begin functions
+func beginSite() string {
+	pcs := make([]uintptr, 8)
+	n := runtime.Callers(3, pcs) // Skip Callers, beginSite and track
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.Contains(frame.Function, "eginTransaction") {
+			return fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// LiveTransactions returns the transactions that were begun and not yet
+// committed or aborted, oldest first
+func (db *Database) LiveTransactions() []*Transaction {
+	db.liveMu.Lock()
+	live := make([]*Transaction, 0, len(db.live))
+	for _, tx := range db.live {
+		live = append(live, tx)
+	}
+	db.liveMu.Unlock()
+
+	sort.Slice(live, func(i, j int) bool { return live[i].ID < live[j].ID })
+	return live
+}
+
+// LeakDetector remembers every database created while it is enabled so
+// that transactions nobody finished can be reported at shutdown. A leaked
+// transaction holds its key locks, admission slot and MVCC snapshot
+// forever.
+type LeakDetector struct {
+	mu        sync.Mutex
+	databases []*Database
+}
+
+// leakDetector is the process-wide detector, nil when disabled
+var leakDetector *LeakDetector
+
+// EnableLeakDetection turns on leak detection for every database created
+// afterwards, and records where each of their transactions was begun
+func EnableLeakDetection() {
+	if leakDetector == nil {
+		leakDetector = &LeakDetector{}
+	}
+}
+
+// LeakDetection returns the process-wide detector, nil unless
+// EnableLeakDetection turned it on
+func LeakDetection() *LeakDetector {
+	return leakDetector
+}
+
+// SetLeakDetector makes d the process-wide detector; nil turns detection
+// off
+func SetLeakDetector(d *LeakDetector) {
+	leakDetector = d
+}
+
+// register adds db to the databases checked at shutdown
+func (d *LeakDetector) register(db *Database) {
+	d.mu.Lock()
+	d.databases = append(d.databases, db)
+	d.mu.Unlock()
+}
+
+// Count returns how many databases are registered
+func (d *LeakDetector) Count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.databases)
+}
+
+// LiveSince describes, one line each, the transactions still live in the
+// databases registered after the first n
+func (d *LeakDetector) LiveSince(n int) []string {
+	d.mu.Lock()
+	databases := append([]*Database(nil), d.databases[n:]...)
+	d.mu.Unlock()
+
+	var leaked []string
+	for _, db := range databases {
+		for _, tx := range db.LiveTransactions() {
+			site := tx.beginSite
+			if site == "" {
+				site = "unknown site"
+			}
+			leaked = append(leaked, fmt.Sprintf("%s tx %d: begun at %s %v ago, %d operations, never committed or aborted",
+				db.EngineName(), tx.ID, site, db.since(tx.StartTime).Round(time.Millisecond), tx.OperationCount()))
+		}
+	}
+	return leaked
+}
+
+// Report writes one line per transaction still live in any registered
+// database and returns how many there were
+func (d *LeakDetector) Report(w io.Writer) int {
+	leaked := d.LiveSince(0)
+	if len(leaked) > 0 {
+		fmt.Fprintln(w, "\n=== Leaked Transactions ===")
+	}
+	for _, leak := range leaked {
+		fmt.Fprintf(w, "  %s\n", leak)
+	}
+	return len(leaked)
+}
+
+// ReportLeakedTransactions prints every transaction the process-wide
+// detector found unfinished. Call it at program exit.
+func ReportLeakedTransactions() {
+	if leakDetector == nil {
+		return
+	}
+	if leakDetector.Report(os.Stdout) == 0 {
+		fmt.Println("\n✓ No leaked transactions")
+	}
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestFinishedTransactionRejectsOperations verifies a committed or aborted
+// transaction accepts no more operations and cannot be committed again
+func TestFinishedTransactionRejectsOperations(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	tx := db.BeginTransaction()
+	if status := tx.Status(); status != TxActive {
+		t.Fatalf("New transaction is %v, want active", status)
+	}
+	db.Put(tx, "x", 1)
+	if err := db.Commit(tx); err != nil {
+		t.Fatalf("Commit returned %v", err)
+	}
+	if status := tx.Status(); status != TxCommitted {
+		t.Errorf("Committed transaction is %v", status)
+	}
+
+	if err := db.Put(tx, "x", 2); !errors.Is(err, ErrTxDone) {
+		t.Errorf("Put after commit returned %v, want ErrTxDone", err)
+	}
+	if _, err := db.Get(tx, "x"); !errors.Is(err, ErrTxDone) {
+		t.Errorf("Get after commit returned %v, want ErrTxDone", err)
+	}
+	if err := db.Commit(tx); !errors.Is(err, ErrTxDone) {
+		t.Errorf("Second commit returned %v, want ErrTxDone", err)
+	}
+	db.Abort(tx)
+	if status := tx.Status(); status != TxCommitted {
+		t.Errorf("Abort after commit changed the status to %v", status)
+	}
+
+	aborted := db.BeginTransaction()
+	db.Put(aborted, "y", 1)
+	db.Abort(aborted)
+	if err := db.Commit(aborted); !errors.Is(err, ErrTxDone) {
+		t.Errorf("Commit after abort returned %v, want ErrTxDone", err)
+	}
+
+	check := db.BeginTransaction()
+	if x, _ := db.Read(check, "x"); x != 1 {
+		t.Errorf("x = %d, want 1: a write after commit was applied", x)
+	}
+	if _, exists := db.Read(check, "y"); exists {
+		t.Error("y exists: a commit after abort was applied")
+	}
+	db.Commit(check)
+}
+
+// TestLiveTransactions verifies only unfinished transactions are live
+func TestLiveTransactions(t *testing.T) {
+	db := NewMVCCDatabase()
+	committed := db.BeginTransaction()
+	aborted := db.BeginTransaction()
+	leaked := db.BeginTransaction()
+	db.Commit(committed)
+	db.Abort(aborted)
+
+	live := db.LiveTransactions()
+	if len(live) != 1 || live[0] != leaked {
+		t.Errorf("Live transactions = %v, want only tx %d", live, leaked.ID)
+	}
+}
+
+// TestLeakDetectorReportsBeginSite verifies a transaction that is never
+// finished is reported together with where it was begun
+func TestLeakDetectorReportsBeginSite(t *testing.T) {
+	EnableLeakDetection()
+	defer func() { leakDetector = nil }()
+	detector := leakDetector
+
+	db := NewTwoPhaseLockingDatabase()
+	db.Read(db.BeginTransaction(), "x") // The leak
+	tx := db.BeginTransaction()
+	db.Commit(tx)
+
+	var out bytes.Buffer
+	if leaked := detector.Report(&out); leaked != 1 {
+		t.Errorf("Report found %d leaks, want 1:\n%s", leaked, out.String())
+	}
+	if !strings.Contains(out.String(), "txstatus_test.go:") {
+		t.Errorf("Report does not name the begin site:\n%s", out.String())
+	}
+}
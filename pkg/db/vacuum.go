@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Every MVCC commit appends a version, so without garbage collection the
+// version chains grow for as long as the database runs. A version can go
+// once no transaction can read it any more: everything older than the
+// newest version each active snapshot sees. The oldest active snapshot is
+// the horizon; of the versions committed at or before it only the newest
+// is kept, and a key whose only remaining version is a delete tombstone
+// below the horizon is dropped entirely. A transaction that is never
+// committed or aborted keeps the horizon back forever.
+
+// begin takes a snapshot for transaction txID and registers it as active,
+// in one step so that a concurrent vacuum cannot prune what it will read
+func (s *mvccStore) begin(txID int) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active[txID] = s.clock
+	return s.clock
+}
+
+// finish unregisters a transaction's snapshot. It is safe to call more
+// than once.
+func (s *mvccStore) finish(txID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.active, txID)
+}
+
+// horizon returns the oldest snapshot any active transaction reads, or the
+// latest commit if none is active. Must be called with s.mu held.
+func (s *mvccStore) horizon() int64 {
+	horizon := s.clock
+	for _, ts := range s.active {
+		if ts < horizon {
+			horizon = ts
+		}
+	}
+	return horizon
+}
+
+// Vacuum removes the MVCC versions no active transaction can read any more
+// and returns how many it reclaimed (always 0 for other engines)
+func (db *Database) Vacuum() int {
+	if db.mvcc == nil {
+		return 0
+	}
+	s := db.mvcc
+	s.mu.Lock()
+	horizon := s.horizon()
+	now := db.clock.Now()
+	reclaimed := 0
+	for key, chain := range s.chains {
+		// Index of the newest version visible at the horizon
+		keep := -1
+		for i := len(chain) - 1; i >= 0; i-- {
+			if chain[i].CommitTS <= horizon {
+				keep = i
+				break
+			}
+		}
+		since, pinned := db.pinnedSince(key)
+		for pinned && keep > 0 && chain[keep].CommitTS > since {
+			// Keep the versions from the one the key's first pin took
+			keep--
+		}
+		if !pinned && keep == len(chain)-1 && (chain[keep].Deleted || expired(chain[keep].ExpiresAt, now)) {
+			// Deleted, or expired, for every snapshot that can still read it
+			reclaimed += len(chain)
+			delete(s.chains, key)
+			continue
+		}
+		if keep > 0 {
+			reclaimed += keep
+			s.chains[key] = append([]recordVersion(nil), chain[keep:]...)
+		}
+	}
+	s.mu.Unlock()
+
+	db.countStat(statVacuumRuns, 1)
+	db.countStat(statVersionsReclaimed, reclaimed)
+	return reclaimed
+}
+
+// StartVacuum runs Vacuum every interval of db's clock until ctx is done.
+// The returned function stops it and waits for the current pass.
+func (db *Database) StartVacuum(ctx context.Context, interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		for {
+			tick := db.clock.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				tick.Stop()
+				return
+			case <-tick.C():
+				db.Vacuum()
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// RetainedVersions returns how many committed versions the MVCC store
+// holds across all keys (0 for engines other than MVCC)
+func (db *Database) RetainedVersions() int {
+	if db.mvcc == nil {
+		return 0
+	}
+	db.mvcc.mu.RLock()
+	defer db.mvcc.mu.RUnlock()
+
+	total := 0
+	for _, chain := range db.mvcc.chains {
+		total += len(chain)
+	}
+	return total
+}
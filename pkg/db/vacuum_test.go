@@ -0,0 +1,63 @@
+package db
+
+import (
+	"testing"
+)
+
+// TestVacuumReclaimsOldVersions verifies a vacuum with no active
+// transactions leaves one version per key and drops deleted keys
+func TestVacuumReclaimsOldVersions(t *testing.T) {
+	db := NewMVCCDatabase()
+	for i := 0; i < 5; i++ {
+		tx := db.BeginTransaction()
+		db.Write(tx, "kept", i)
+		db.Write(tx, "deleted", i)
+		db.Commit(tx)
+	}
+	tx := db.BeginTransaction()
+	db.Delete(tx, "deleted")
+	db.Commit(tx)
+
+	if reclaimed := db.Vacuum(); reclaimed != 10 {
+		t.Errorf("Reclaimed %d versions, want 10", reclaimed)
+	}
+	if versions := db.VersionCount("kept"); versions != 1 {
+		t.Errorf("kept has %d versions, want 1", versions)
+	}
+	if versions := db.VersionCount("deleted"); versions != 0 {
+		t.Errorf("deleted has %d versions, want 0", versions)
+	}
+
+	check := db.BeginTransaction()
+	if value, _ := db.Read(check, "kept"); value != 4 {
+		t.Errorf("kept = %d after vacuum, want 4", value)
+	}
+	db.Commit(check)
+}
+
+// TestVacuumKeepsActiveSnapshotReadable verifies versions an active
+// transaction can still read survive a vacuum
+func TestVacuumKeepsActiveSnapshotReadable(t *testing.T) {
+	db := NewMVCCDatabase()
+	tx := db.BeginTransaction()
+	db.Write(tx, "x", 1)
+	db.Commit(tx)
+
+	reader := db.BeginTransaction()
+	for i := 2; i <= 4; i++ {
+		tx := db.BeginTransaction()
+		db.Write(tx, "x", i)
+		db.Commit(tx)
+	}
+
+	db.Vacuum()
+	if value, _ := db.Read(reader, "x"); value != 1 {
+		t.Errorf("Reader saw x=%d after vacuum, want its snapshot's 1", value)
+	}
+	db.Commit(reader)
+
+	db.Vacuum()
+	if versions := db.VersionCount("x"); versions != 1 {
+		t.Errorf("x has %d versions once the reader finished, want 1", versions)
+	}
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Validator checks a write before the engine applies it. A non-nil error
+// rejects the write and aborts the writing transaction.
+type Validator func(key string, value int) error
+
+// NonNegative rejects negative values, e.g. for counters and balances
+func NonNegative() Validator {
+	return func(key string, value int) error {
+		if value < 0 {
+			return fmt.Errorf("value %d of %s is negative", value, key)
+		}
+		return nil
+	}
+}
+
+// ValueRange rejects values outside [min, max]
+func ValueRange(min, max int) Validator {
+	return func(key string, value int) error {
+		if value < min || value > max {
+			return fmt.Errorf("value %d of %s outside [%d, %d]", value, key, min, max)
+		}
+		return nil
+	}
+}
+
+// AtLeast rejects values below min, e.g. for a stock that must not be
+// oversold
+func AtLeast(min int) Validator {
+	return func(key string, value int) error {
+		if value < min {
+			return fmt.Errorf("value %d of %s is below its minimum %d", value, key, min)
+		}
+		return nil
+	}
+}
+
+// AtMost rejects values above max, e.g. for seats that must not pass a
+// room's capacity
+func AtMost(max int) Validator {
+	return func(key string, value int) error {
+		if value > max {
+			return fmt.Errorf("value %d of %s is above its maximum %d", value, key, max)
+		}
+		return nil
+	}
+}
+
+// KeyPattern rejects writes to keys that don't match the regular expression
+func KeyPattern(pattern string) Validator {
+	re := regexp.MustCompile(pattern)
+	return func(key string, value int) error {
+		if !re.MatchString(key) {
+			return fmt.Errorf("key %q does not match %s", key, pattern)
+		}
+		return nil
+	}
+}
+
+// ForKeys applies a validator only to keys matching the regular expression
+func ForKeys(pattern string, v Validator) Validator {
+	re := regexp.MustCompile(pattern)
+	return func(key string, value int) error {
+		if !re.MatchString(key) {
+			return nil
+		}
+		return v(key, value)
+	}
+}
+
+// ForKey applies a validator only to one key, e.g. to bound a single
+// stock: ForKey("stock", AtLeast(0))
+func ForKey(name string, v Validator) Validator {
+	return func(key string, value int) error {
+		if key != name {
+			return nil
+		}
+		return v(key, value)
+	}
+}
+
+// AddValidator registers a validator that every write must pass.
+// Validators should be registered before the database is shared.
+func (db *Database) AddValidator(v Validator) {
+	db.validators = append(db.validators, v)
+}
+
+// validate runs every validator against a pending write
+func (db *Database) validate(key string, value int) error {
+	for _, v := range db.validators {
+		if err := v(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateIncrements runs the validators against
+// the values tx's increments will install, and aborts tx if one is
+// rejected, before any is installed. On engines without key locks an
+// update buffers its increment, validated against the value the
+// transaction read, and the commit adds it to whatever the value is by
+// then (see update), so a value that was valid when read can become
+// invalid once a concurrent commit has changed it. The caller must hold
+// the write locks of the keys' stripes, so that no other commit changes
+// the values between the check and the install. MVCC and timestamp
+// ordering install the values their transactions computed, already
+// validated, since they abort a transaction whose read went stale.
+func (db *Database) validateIncrements(tx *Transaction, now time.Time) bool {
+	if len(db.validators) == 0 {
+		return true
+	}
+	for _, key := range tx.writeOrder {
+		pending := tx.writes[key]
+		if !pending.Relative {
+			continue
+		}
+		value := pending.Value
+		if record, exists := db.records.get(key); exists && record.live(now) {
+			value += record.Value
+		}
+		if err := db.validate(key, value); err != nil {
+			db.countStat(statValidationFailures, 1)
+			tx.logOp("COMMIT %s: INVALID (%v)", key, err)
+			tx.Aborted = true
+			tx.AbortReason = err.Error()
+			tx.writes = nil
+			tx.writeOrder = nil
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"time"
+)
+
+// WaitFor blocks until predicate holds for key's current value or the
+// timeout expires, and returns the last value seen and whether the
+// predicate held. exists is false while the key is missing or deleted.
+//
+// It is a monitor: every exclusive database operation broadcasts on a
+// condition variable and waiters re-check their predicate when woken.
+// A true result is only a hint; a transaction must re-read the key (and
+// hold its lock) before acting on it, like any "while (!cond) wait" loop.
+func (db *Database) WaitFor(key string, predicate func(value int, exists bool) bool, timeout time.Duration) (int, bool) {
+	db.changeMu.Lock()
+	defer db.changeMu.Unlock()
+
+	db.waiters.Add(1)
+	defer db.waiters.Add(-1)
+
+	// sync.Cond has no timed wait, so a timer broadcasts at the deadline
+	expired := false
+	timer := db.clock.AfterFunc(timeout, func() {
+		db.changeMu.Lock()
+		expired = true
+		db.changed.Broadcast()
+		db.changeMu.Unlock()
+	})
+	defer timer.Stop()
+
+	for {
+		value, exists := db.peek(key)
+		if predicate(value, exists) {
+			return value, true
+		}
+		if expired {
+			return value, false
+		}
+		db.changed.Wait()
+	}
+}
+
+// peek reads key's current value outside of any transaction
+func (db *Database) peek(key string) (int, bool) {
+	db.rLockKey(key)
+	defer db.rUnlockKey(key)
+
+	record, exists := db.records.get(key)
+	if !exists || !record.live(db.clock.Now()) {
+		return 0, false
+	}
+	return record.Value, true
+}
+
+// notifyChange wakes every WaitFor caller so it re-checks its predicate.
+// Callers must not hold the database lock, since waiters take it to peek.
+func (db *Database) notifyChange() {
+	if db.waiters.Load() == 0 {
+		return
+	}
+	db.changeMu.Lock()
+	db.changed.Broadcast()
+	db.changeMu.Unlock()
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// WAL is an append-only log of committed transactions, one JSON-encoded
+// CommitRecord per line. Each record is written with a single write call,
+// so it survives the process dying as soon as Append returns. It survives
+// a machine crash or power failure only once fsynced, by Sync or, with
+// SetSyncOnAppend, by Append itself; otherwise the crash can lose the tail.
+type WAL struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	syncEach bool  // Fsync every record before Append returns
+	err      error // First append error; later appends are skipped
+}
+
+// OpenWAL opens the log at path for appending, creating it if needed. A
+// record torn by a crash at the end of the log is cut off, so that the
+// next append starts on a line of its own.
+func OpenWAL(path string) (*WAL, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if complete := bytes.LastIndexByte(data, '\n') + 1; complete < len(data) {
+		if err := file.Truncate(int64(complete)); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return &WAL{path: path, file: file}, nil
+}
+
+// SetSyncOnAppend sets whether Append fsyncs each record before it
+// returns, at the cost of a disk flush per record
+func (w *WAL) SetSyncOnAppend(enabled bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.syncEach = enabled
+}
+
+// Append logs one committed transaction
+func (w *WAL) Append(record CommitRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	if _, err := w.file.Write(line); err != nil {
+		w.err = fmt.Errorf("appending to %s: %w", w.path, err)
+	} else if w.syncEach {
+		if err := w.file.Sync(); err != nil {
+			w.err = fmt.Errorf("syncing %s: %w", w.path, err)
+		}
+	}
+	return w.err
+}
+
+// Sync flushes the log to stable storage
+func (w *WAL) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Sync()
+}
+
+// Reset empties the log, once a checkpoint holds everything in it
+func (w *WAL) Reset() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// Err returns the first error an append ran into, if any
+func (w *WAL) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close closes the log file
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+// ReadWAL returns the records in the log at path, oldest first; a missing
+// log holds none. A final line without its newline is a record the process
+// died while writing: it is left out and torn reports it. Any other
+// undecodable line is an error.
+func ReadWAL(path string) (records []CommitRecord, torn bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return records, len(line) > 0, nil
+		}
+		var record CommitRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return records, false, fmt.Errorf("%s line %d: %w", path, lineNo, err)
+		}
+		records = append(records, record)
+	}
+}
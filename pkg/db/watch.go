@@ -0,0 +1,132 @@
+package db
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// db.Watch subscribes to a key's committed changes. Events are queued
+// while the commit that made them installs its writes, under the exclusive
+// database lock, so a watcher sees a key's changes in commit order, each
+// exactly once. Each watcher has an unbounded queue drained by its own
+// goroutine: a slow watcher falls behind but never blocks commits or
+// misses an event.
+
+// ChangeEvent describes one committed change to a watched key
+type ChangeEvent struct {
+	Key      string
+	OldValue int  // Value before the change; 0 when the key did not exist
+	Existed  bool // Whether the key held a live value before the change
+	NewValue int  // Value after the change; 0 when Deleted
+	Deleted  bool // The change deleted the key (or expired it)
+	Version  int  // Record version the change produced
+	TxID     int  // Committing transaction; 0 when the key expired
+}
+
+// watcher delivers one subscription's events in order
+type watcher struct {
+	events chan ChangeEvent
+	mu     sync.Mutex
+	queue  []ChangeEvent
+	wake   chan struct{} // Signalled when the queue becomes non-empty
+	done   chan struct{} // Closed when the subscription is cancelled
+	exited chan struct{} // Closed when the delivery goroutine returns
+}
+
+// watchers holds a database's subscriptions by key. It has its own mutex,
+// even when unsynchronized, so that subscribing cannot crash the program.
+type watchers struct {
+	mu    sync.Mutex
+	count atomic.Int32 // Subscriptions, so commits skip the lookup when none
+	byKey map[string][]*watcher
+}
+
+// Watch subscribes to key's committed changes. Events arrive on the
+// returned channel until stop is called, which closes the channel; events
+// still queued are dropped.
+func (db *Database) Watch(key string) (events <-chan ChangeEvent, stop func()) {
+	w := &watcher{
+		events: make(chan ChangeEvent),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	db.watches.mu.Lock()
+	if db.watches.byKey == nil {
+		db.watches.byKey = make(map[string][]*watcher)
+	}
+	db.watches.byKey[key] = append(db.watches.byKey[key], w)
+	db.watches.count.Add(1)
+	db.watches.mu.Unlock()
+
+	go w.deliver()
+
+	var once sync.Once
+	return w.events, func() {
+		once.Do(func() {
+			db.watches.mu.Lock()
+			list := db.watches.byKey[key]
+			for i, other := range list {
+				if other == w {
+					db.watches.byKey[key] = append(list[:i:i], list[i+1:]...)
+					break
+				}
+			}
+			if len(db.watches.byKey[key]) == 0 {
+				delete(db.watches.byKey, key)
+			}
+			db.watches.count.Add(-1)
+			db.watches.mu.Unlock()
+
+			close(w.done)
+			<-w.exited
+		})
+	}
+}
+
+// notifyWatchers queues event for every watcher of its key. Must be
+// called with the write lock held, in commit order.
+func (db *Database) notifyWatchers(event ChangeEvent) {
+	if db.watches.count.Load() == 0 {
+		return
+	}
+	db.watches.mu.Lock()
+	defer db.watches.mu.Unlock()
+	for _, w := range db.watches.byKey[event.Key] {
+		w.mu.Lock()
+		w.queue = append(w.queue, event)
+		w.mu.Unlock()
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// deliver sends queued events on w.events in order until w is cancelled
+func (w *watcher) deliver() {
+	defer close(w.exited)
+	defer close(w.events)
+	for {
+		w.mu.Lock()
+		batch := w.queue
+		w.queue = nil
+		w.mu.Unlock()
+
+		if len(batch) == 0 {
+			select {
+			case <-w.wake:
+				continue
+			case <-w.done:
+				return
+			}
+		}
+		for _, event := range batch {
+			select {
+			case w.events <- event:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
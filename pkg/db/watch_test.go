@@ -0,0 +1,104 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// nextEvent returns the next event from events, failing the test if none
+// arrives in time
+func nextEvent(t *testing.T, events <-chan ChangeEvent) ChangeEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("No change event arrived")
+		return ChangeEvent{}
+	}
+}
+
+// TestWatchReportsChanges verifies a watcher receives a key's inserts,
+// updates and deletes with their old and new values, and nothing for
+// aborted transactions or other keys
+func TestWatchReportsChanges(t *testing.T) {
+	for name, newDB := range atomicEngines {
+		t.Run(name, func(t *testing.T) {
+			db := newDB()
+			events, stop := db.Watch("key")
+			defer stop()
+
+			tx := db.BeginTransaction()
+			db.Put(tx, "key", 1)
+			db.Put(tx, "other", 5)
+			db.Commit(tx)
+			insertID := tx.ID
+
+			tx = db.BeginTransaction()
+			db.Put(tx, "key", 100)
+			db.Abort(tx)
+
+			tx = db.BeginTransaction()
+			db.Add(tx, "key", 2)
+			db.Commit(tx)
+			tx = db.BeginTransaction()
+			db.Remove(tx, "key")
+			db.Commit(tx)
+			deleteID := tx.ID
+
+			want := []ChangeEvent{
+				{Key: "key", NewValue: 1, Version: 1, TxID: insertID},
+				{Key: "key", OldValue: 1, Existed: true, NewValue: 3, Version: 2},
+				{Key: "key", OldValue: 3, Existed: true, Deleted: true, Version: 3, TxID: deleteID},
+			}
+			for i, expected := range want {
+				event := nextEvent(t, events)
+				if i == 1 {
+					expected.TxID = event.TxID
+				}
+				if event != expected {
+					t.Errorf("Event %d = %+v, want %+v", i, event, expected)
+				}
+			}
+			select {
+			case event := <-events:
+				t.Errorf("Unexpected event %+v", event)
+			case <-time.After(10 * time.Millisecond):
+			}
+		})
+	}
+}
+
+// TestWatchStopClosesChannel verifies stop closes the channel and that a
+// watcher that never reads does not block commits
+func TestWatchStopClosesChannel(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	events, stop := db.Watch("key")
+	for i := 0; i < 100; i++ {
+		tx := db.BeginTransaction()
+		db.Put(tx, "key", i)
+		db.Commit(tx)
+	}
+	stop()
+	stop()
+	for range events {
+	}
+}
+
+// TestWatchReportsExpiry verifies the sweeper's expiry of a key reaches
+// its watchers as a delete by no transaction
+func TestWatchReportsExpiry(t *testing.T) {
+	db := NewTwoPhaseLockingDatabase()
+	tx := db.BeginTransaction()
+	db.PutWithTTL(tx, "session", 7, time.Millisecond)
+	db.Commit(tx)
+	events, stop := db.Watch("session")
+	defer stop()
+
+	time.Sleep(5 * time.Millisecond)
+	db.ExpireKeys()
+	event := nextEvent(t, events)
+	if !event.Deleted || event.OldValue != 7 || event.TxID != 0 {
+		t.Errorf("Expiry event = %+v, want a delete of 7 by tx 0", event)
+	}
+}
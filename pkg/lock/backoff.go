@@ -0,0 +1,87 @@
+package lock
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// BackoffStrategy is how a retry loop waits before trying again
+type BackoffStrategy int
+
+const (
+	// BackoffSleep sleeps for a random time up to a bound that doubles
+	// with every retry: exponential backoff with full jitter, which
+	// spreads out retries that keep colliding.
+	BackoffSleep BackoffStrategy = iota
+	// BackoffYield gives up the processor once, with runtime.Gosched, and
+	// retries as soon as it is scheduled again.
+	BackoffYield
+	// BackoffNone retries at once.
+	BackoffNone
+)
+
+// String returns the strategy name, as ParseBackoffStrategy takes it
+func (s BackoffStrategy) String() string {
+	switch s {
+	case BackoffSleep:
+		return "sleep"
+	case BackoffYield:
+		return "yield"
+	case BackoffNone:
+		return "none"
+	default:
+		return fmt.Sprintf("BackoffStrategy(%d)", int(s))
+	}
+}
+
+// ParseBackoffStrategy parses sleep, yield or none
+func ParseBackoffStrategy(s string) (BackoffStrategy, error) {
+	for _, strategy := range []BackoffStrategy{BackoffSleep, BackoffYield, BackoffNone} {
+		if strings.EqualFold(s, strategy.String()) {
+			return strategy, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown backoff strategy %q: want sleep, yield or none", s)
+}
+
+// Backoff spaces out the attempts of a retry loop. Under BackoffSleep,
+// retry n waits a random time up to Base<<(n-1), capped at Max.
+type Backoff struct {
+	Strategy BackoffStrategy
+	Base     time.Duration
+	Max      time.Duration
+}
+
+// Delay returns how long retry number retry (1 for the first) should
+// sleep: a random time up to its bound under BackoffSleep, 0 otherwise
+func (b Backoff) Delay(retry int) time.Duration {
+	if b.Strategy != BackoffSleep {
+		return 0
+	}
+	limit := b.Max
+	if shift := retry - 1; shift < 32 && b.Base<<shift < limit {
+		limit = b.Base << shift
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit)) + 1)
+}
+
+// Wait waits before retry number retry as the strategy says, and returns
+// how long it took
+func (b Backoff) Wait(retry int) time.Duration {
+	start := time.Now()
+	switch b.Strategy {
+	case BackoffSleep:
+		time.Sleep(b.Delay(retry))
+	case BackoffYield:
+		runtime.Gosched()
+	default:
+		return 0
+	}
+	return time.Since(start)
+}
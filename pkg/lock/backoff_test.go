@@ -0,0 +1,65 @@
+package lock
+
+import (
+	"testing"
+	"time"
+)
+
+// TestBackoffDelayBounds tests that sleep delays stay under a bound that
+// doubles with every retry up to Max, and that the other strategies never
+// sleep
+func TestBackoffDelayBounds(t *testing.T) {
+	b := Backoff{Strategy: BackoffSleep, Base: time.Millisecond, Max: 10 * time.Millisecond}
+	for retry, bound := range map[int]time.Duration{1: time.Millisecond, 2: 2 * time.Millisecond, 4: 8 * time.Millisecond, 5: 10 * time.Millisecond, 100: 10 * time.Millisecond} {
+		for i := 0; i < 100; i++ {
+			if d := b.Delay(retry); d <= 0 || d > bound {
+				t.Fatalf("Retry %d slept %v, want up to %v", retry, d, bound)
+			}
+		}
+	}
+
+	for _, strategy := range []BackoffStrategy{BackoffYield, BackoffNone} {
+		b.Strategy = strategy
+		if d := b.Delay(3); d != 0 {
+			t.Errorf("%s slept %v", strategy, d)
+		}
+	}
+}
+
+// TestParseBackoffStrategy tests that every strategy parses back from its
+// name and that unknown names are rejected
+func TestParseBackoffStrategy(t *testing.T) {
+	for _, strategy := range []BackoffStrategy{BackoffSleep, BackoffYield, BackoffNone} {
+		if got, err := ParseBackoffStrategy(strategy.String()); err != nil || got != strategy {
+			t.Errorf("Parsing %q gave %v, %v", strategy, got, err)
+		}
+	}
+	if _, err := ParseBackoffStrategy("spin"); err == nil {
+		t.Error("Parsing spin succeeded")
+	}
+}
+
+// TestSeqlockBackoffWait tests that readers which wait for a writer under
+// a sleeping backoff account for the time they slept
+func TestSeqlockBackoffWait(t *testing.T) {
+	record := NewSeqlockRecord(0)
+	record.SetBackoff(Backoff{Strategy: BackoffSleep, Base: time.Millisecond, Max: time.Millisecond})
+
+	record.writeMu.Lock()
+	record.seq.Add(1) // Hold a write open
+	done := make(chan int)
+	go func() {
+		value, _ := record.Load()
+		done <- value
+	}()
+	time.Sleep(5 * time.Millisecond)
+	record.seq.Add(1)
+	record.writeMu.Unlock()
+
+	if value := <-done; value != 0 {
+		t.Errorf("Load returned %d, want 0", value)
+	}
+	if record.Retries() == 0 || record.BackoffWait() == 0 {
+		t.Errorf("%d retries and %v backoff, want both above zero", record.Retries(), record.BackoffWait())
+	}
+}
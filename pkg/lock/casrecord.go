@@ -0,0 +1,122 @@
+package lock
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// CASRecord is a lock-free record: an atomic pointer to an immutable node
+// holding the value, its version and whether the key is deleted. Writers
+// build a new node and swap it in with compare-and-swap, retrying when
+// another writer got there first, so neither readers nor writers ever
+// block.
+//
+// Replaced nodes are recycled for later writes, as a manually managed
+// heap would free them. A reader that loaded a node just before it was
+// replaced could then read a node already rewritten for another value,
+// so every operation pins the record's Epochs and replaced nodes are
+// retired to it, to be recycled only once no operation can still hold
+// them.
+type CASRecord struct {
+	node    atomic.Pointer[casNode]
+	epochs  *Epochs
+	backoff Backoff      // How a writer waits after losing a swap
+	retries atomic.Int64 // Swaps lost to another writer
+}
+
+// casNode is one state of a CASRecord, never changed while published
+type casNode struct {
+	value   int
+	version int
+	deleted bool
+}
+
+// casNodes holds freed nodes for reuse
+var casNodes = sync.Pool{New: func() any { return new(casNode) }}
+
+// NewCASRecord creates a lock-free record with an initial value, retiring
+// replaced nodes to epochs, or to a domain of its own if epochs is nil. A
+// writer that loses a swap yields the processor before it tries again;
+// SetBackoff changes that.
+func NewCASRecord(value int, epochs *Epochs) *CASRecord {
+	if epochs == nil {
+		epochs = NewEpochs()
+	}
+	r := &CASRecord{epochs: epochs, backoff: Backoff{Strategy: BackoffYield}}
+	r.node.Store(&casNode{value: value, version: 1})
+	return r
+}
+
+// SetBackoff sets how writers wait after losing a swap. It should be
+// called before the record is shared.
+func (r *CASRecord) SetBackoff(b Backoff) {
+	r.backoff = b
+}
+
+// Load returns the value and version, and false if the record is deleted
+func (r *CASRecord) Load() (int, int, bool) {
+	g := r.epochs.Pin()
+	defer g.Unpin()
+	n := r.node.Load()
+	return n.value, n.version, !n.deleted
+}
+
+// Store replaces the value, undeleting the record if need be
+func (r *CASRecord) Store(value int) {
+	r.swap(func(old, n *casNode) { n.value = value })
+}
+
+// Add applies a delta, to 0 if the record is deleted, and returns the new
+// value
+func (r *CASRecord) Add(delta int) int {
+	return r.swap(func(old, n *casNode) {
+		n.value = delta
+		if !old.deleted {
+			n.value += old.value
+		}
+	}).value
+}
+
+// Delete marks the record deleted, and reports whether it existed
+func (r *CASRecord) Delete() bool {
+	var existed bool
+	r.swap(func(old, n *casNode) {
+		existed = !old.deleted
+		n.deleted = true
+	})
+	return existed
+}
+
+// swap replaces the node with one fill derives from the current node,
+// bumping the version, and retires the node it replaced. It returns a
+// copy of the new node, which may be recycled as soon as swap unpins.
+func (r *CASRecord) swap(fill func(old, n *casNode)) casNode {
+	n := casNodes.Get().(*casNode)
+	g := r.epochs.Pin()
+	for retry := 1; ; retry++ {
+		old := r.node.Load()
+		*n = casNode{version: old.version + 1}
+		fill(old, n)
+		if r.node.CompareAndSwap(old, n) {
+			installed := *n
+			g.Unpin()
+			r.epochs.Retire(func() {
+				*old = casNode{}
+				casNodes.Put(old)
+			})
+			return installed
+		}
+		r.retries.Add(1)
+		r.backoff.Wait(retry)
+	}
+}
+
+// Retries returns how many swaps writers lost and retried
+func (r *CASRecord) Retries() int64 {
+	return r.retries.Load()
+}
+
+// Reclamation returns the counts of the record's epoch domain
+func (r *CASRecord) Reclamation() EpochStats {
+	return r.epochs.Stats()
+}
@@ -0,0 +1,7 @@
+// Package lock holds the locks the database engines are built from that
+// stand on their own: a reader-writer lock whose admission order follows
+// a LockPolicy, a sequence-locked record, and a lock-free record whose
+// memory is reclaimed through epochs. The per-key lock manager of
+// two-phase locking needs the database's transactions and is in package
+// db.
+package lock
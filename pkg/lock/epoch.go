@@ -0,0 +1,147 @@
+package lock
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Epochs is an epoch-based reclamation domain. A lock-free structure
+// cannot free, or reuse, memory it unlinked the moment it unlinks it: a
+// reader that loaded the pointer just before may still be following it.
+// Readers Pin the domain for as long as they hold such pointers, and
+// writers Retire what they unlink instead of freeing it. The domain keeps
+// a global epoch that advances only once every pinned reader has seen the
+// current one, so two advances after a retirement no reader can still
+// hold what was retired, and its free function runs.
+//
+// Pinning and unpinning take no lock. Retiring takes a mutex shared with
+// the advance that frees, which only writers contend for.
+type Epochs struct {
+	global       atomic.Uint64
+	participants atomic.Pointer[EpochGuard] // Every reader slot, a list that only grows
+
+	mu    sync.Mutex
+	limbo [3][]func() // Free functions by the epoch, modulo 3, they were retired in
+
+	retired atomic.Int64
+	freed   atomic.Int64
+}
+
+// EpochGuard is a reader's pin on an Epochs. Slots are reused by later
+// readers once unpinned.
+type EpochGuard struct {
+	epochs *Epochs
+	state  atomic.Uint64 // Pinned epoch<<1 | 1, or 0 when unpinned
+	inUse  atomic.Bool
+	next   *EpochGuard
+}
+
+// EpochStats counts the retirements of an Epochs
+type EpochStats struct {
+	Epoch    uint64 // Current global epoch
+	Retired  int64  // Free functions handed to Retire
+	Freed    int64  // Free functions that have run
+	Deferred int64  // Retired but not yet freed, because a reader might still see them
+}
+
+// NewEpochs returns a reclamation domain with no readers and nothing
+// retired
+func NewEpochs() *Epochs {
+	e := &Epochs{}
+	e.global.Store(1)
+	return e
+}
+
+// Pin marks the caller as a reader of the current epoch until it calls
+// Unpin on the returned guard. Nothing retired after the pin is freed
+// before then.
+func (e *Epochs) Pin() *EpochGuard {
+	g := e.acquire()
+	for {
+		epoch := e.global.Load()
+		g.state.Store(epoch<<1 | 1)
+		// An advance that missed the store must not have gone past epoch
+		if e.global.Load() == epoch {
+			return g
+		}
+	}
+}
+
+// Unpin ends the pin
+func (g *EpochGuard) Unpin() {
+	g.state.Store(0)
+	g.inUse.Store(false)
+}
+
+// acquire claims a free reader slot, adding one if all are taken
+func (e *Epochs) acquire() *EpochGuard {
+	for g := e.participants.Load(); g != nil; g = g.next {
+		if !g.inUse.Load() && g.inUse.CompareAndSwap(false, true) {
+			return g
+		}
+	}
+	g := &EpochGuard{epochs: e}
+	g.inUse.Store(true)
+	for {
+		head := e.participants.Load()
+		g.next = head
+		if e.participants.CompareAndSwap(head, g) {
+			return g
+		}
+	}
+}
+
+// Retire hands over free, which releases something the caller unlinked,
+// to run once no pinned reader can still see it. free runs on a goroutine
+// that is retiring, with the domain's mutex held, so it must not call
+// back into e.
+func (e *Epochs) Retire(free func()) {
+	e.retired.Add(1)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	epoch := e.global.Load()
+	e.limbo[epoch%3] = append(e.limbo[epoch%3], free)
+	e.tryAdvance()
+}
+
+// Collect tries to advance the epoch twice, freeing everything no reader
+// is pinned against, and returns how many free functions ran
+func (e *Epochs) Collect() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.tryAdvance() + e.tryAdvance()
+}
+
+// tryAdvance moves the global epoch on if every pinned reader has seen it,
+// and frees what was retired two epochs before the new one. Must be called
+// with mu held; returns how many free functions ran.
+func (e *Epochs) tryAdvance() int {
+	epoch := e.global.Load()
+	for g := e.participants.Load(); g != nil; g = g.next {
+		if state := g.state.Load(); state != 0 && state>>1 != epoch {
+			return 0
+		}
+	}
+	e.global.Store(epoch + 1)
+
+	// Readers are now pinned at epoch or epoch+1. Both pinned after
+	// whatever was retired at epoch-1 was unlinked, since the advance to
+	// epoch waited for those retirements to finish, so it can go. The
+	// bucket of epoch+1 was emptied by the advance to epoch.
+	bucket := (epoch + 2) % 3
+	frees := e.limbo[bucket]
+	for i, free := range frees {
+		free()
+		frees[i] = nil
+	}
+	e.limbo[bucket] = frees[:0]
+	e.freed.Add(int64(len(frees)))
+	return len(frees)
+}
+
+// Stats returns the domain's epoch and retirement counts
+func (e *Epochs) Stats() EpochStats {
+	freed := e.freed.Load()
+	retired := e.retired.Load()
+	return EpochStats{Epoch: e.global.Load(), Retired: retired, Freed: freed, Deferred: retired - freed}
+}
@@ -0,0 +1,196 @@
+package lock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LockPolicy decides who goes first when readers and writers compete
+// for the database lock
+type LockPolicy int
+
+const (
+	// PreferReaders admits readers whenever no writer holds the lock.
+	// Writers can starve under a steady stream of readers.
+	PreferReaders LockPolicy = iota
+	// PreferWriters holds back new readers while a writer is waiting.
+	// Readers can starve under a steady stream of writers.
+	PreferWriters
+	// Fair admits requests in arrival order, letting consecutive readers
+	// share the lock. Nobody starves.
+	Fair
+)
+
+// String returns the policy name
+func (p LockPolicy) String() string {
+	switch p {
+	case PreferReaders:
+		return "PreferReaders"
+	case PreferWriters:
+		return "PreferWriters"
+	case Fair:
+		return "Fair"
+	default:
+		return fmt.Sprintf("LockPolicy(%d)", int(p))
+	}
+}
+
+// LockWaitStats reports how long each role waited to acquire the lock
+type LockWaitStats struct {
+	ReaderAcquisitions int
+	ReaderWait         time.Duration
+	WriterAcquisitions int
+	WriterWait         time.Duration
+}
+
+// AvgReaderWait returns the average time a reader waited for the lock
+func (s LockWaitStats) AvgReaderWait() time.Duration {
+	if s.ReaderAcquisitions == 0 {
+		return 0
+	}
+	return s.ReaderWait / time.Duration(s.ReaderAcquisitions)
+}
+
+// AvgWriterWait returns the average time a writer waited for the lock
+func (s LockWaitStats) AvgWriterWait() time.Duration {
+	if s.WriterAcquisitions == 0 {
+		return 0
+	}
+	return s.WriterWait / time.Duration(s.WriterAcquisitions)
+}
+
+// PolicyRWLock is a reader-writer lock built on a monitor (mutex + condition
+// variable) whose admission order is controlled by a LockPolicy
+type PolicyRWLock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	policy LockPolicy
+
+	readers        int  // Readers currently holding the lock
+	writer         bool // Whether a writer currently holds the lock
+	waitingReaders int
+	waitingWriters int
+
+	// Fair policy: every request takes a ticket and is admitted in order
+	nextTicket uint64
+	serving    uint64
+
+	stats LockWaitStats
+
+	// Keeps locks allocated side by side, such as a database's stripes,
+	// off each other's cache lines
+	_ [64]byte
+}
+
+// NewPolicyRWLock creates a reader-writer lock with the given policy
+func NewPolicyRWLock(policy LockPolicy) *PolicyRWLock {
+	l := &PolicyRWLock{policy: policy}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// Policy returns the lock's admission policy
+func (l *PolicyRWLock) Policy() LockPolicy {
+	return l.policy
+}
+
+// RLock acquires the lock in shared mode
+func (l *PolicyRWLock) RLock() {
+	start := time.Now()
+	l.mu.Lock()
+	ticket := l.takeTicket()
+	l.waitingReaders++
+	for !l.canRead(ticket) {
+		l.cond.Wait()
+	}
+	l.waitingReaders--
+	l.readers++
+	if l.policy == Fair {
+		// Let the next request in line try; if it is a reader it can share
+		l.serving++
+		l.cond.Broadcast()
+	}
+	l.stats.ReaderAcquisitions++
+	l.stats.ReaderWait += time.Since(start)
+	l.mu.Unlock()
+}
+
+// RUnlock releases a shared hold on the lock
+func (l *PolicyRWLock) RUnlock() {
+	l.mu.Lock()
+	l.readers--
+	if l.readers == 0 {
+		l.cond.Broadcast()
+	}
+	l.mu.Unlock()
+}
+
+// Lock acquires the lock in exclusive mode
+func (l *PolicyRWLock) Lock() {
+	start := time.Now()
+	l.mu.Lock()
+	ticket := l.takeTicket()
+	l.waitingWriters++
+	for !l.canWrite(ticket) {
+		l.cond.Wait()
+	}
+	l.waitingWriters--
+	l.writer = true
+	if l.policy == Fair {
+		l.serving++
+	}
+	l.stats.WriterAcquisitions++
+	l.stats.WriterWait += time.Since(start)
+	l.mu.Unlock()
+}
+
+// Unlock releases an exclusive hold on the lock
+func (l *PolicyRWLock) Unlock() {
+	l.mu.Lock()
+	l.writer = false
+	l.cond.Broadcast()
+	l.mu.Unlock()
+}
+
+// WaitStats returns a snapshot of the per-role wait statistics
+func (l *PolicyRWLock) WaitStats() LockWaitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// takeTicket hands out the next arrival ticket (only used by Fair).
+// Must be called with l.mu held.
+func (l *PolicyRWLock) takeTicket() uint64 {
+	ticket := l.nextTicket
+	l.nextTicket++
+	return ticket
+}
+
+// canRead reports whether a reader may enter. Must be called with l.mu held.
+func (l *PolicyRWLock) canRead(ticket uint64) bool {
+	switch l.policy {
+	case PreferWriters:
+		return !l.writer && l.waitingWriters == 0
+	case Fair:
+		return !l.writer && ticket == l.serving
+	default: // PreferReaders
+		return !l.writer
+	}
+}
+
+// canWrite reports whether a writer may enter. Must be called with l.mu held.
+func (l *PolicyRWLock) canWrite(ticket uint64) bool {
+	if l.writer || l.readers > 0 {
+		return false
+	}
+	switch l.policy {
+	case PreferReaders:
+		return l.waitingReaders == 0
+	case Fair:
+		return ticket == l.serving
+	default: // PreferWriters
+		return true
+	}
+}
@@ -0,0 +1,74 @@
+package lock
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitForWaitingWriters blocks until n writers are queued on the lock
+func waitForWaitingWriters(t *testing.T, l *PolicyRWLock, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		waiting := l.waitingWriters
+		l.mu.Unlock()
+		if waiting >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queued writers", n)
+}
+
+// readerAdmitted reports whether a new reader gets the lock while a writer
+// is queued behind an existing reader
+func readerAdmitted(t *testing.T, policy LockPolicy) bool {
+	l := NewPolicyRWLock(policy)
+	l.RLock()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		l.Lock()
+		l.Unlock()
+	}()
+	waitForWaitingWriters(t, l, 1)
+
+	admitted := make(chan bool)
+	go func() {
+		l.RLock()
+		admitted <- true
+		l.RUnlock()
+	}()
+
+	result := false
+	select {
+	case <-admitted:
+		result = true
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	l.RUnlock()
+	if !result {
+		<-admitted
+	}
+	wg.Wait()
+	return result
+}
+
+// TestLockPolicyAdmission tests which policies let a new reader overtake
+// a waiting writer
+func TestLockPolicyAdmission(t *testing.T) {
+	if !readerAdmitted(t, PreferReaders) {
+		t.Errorf("PreferReaders should admit a reader while a writer waits")
+	}
+	if readerAdmitted(t, PreferWriters) {
+		t.Errorf("PreferWriters should hold back readers while a writer waits")
+	}
+	if readerAdmitted(t, Fair) {
+		t.Errorf("Fair should queue a reader behind an earlier writer")
+	}
+}
@@ -0,0 +1,134 @@
+package lock
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SeqlockRecord wraps a hot record behind a sequence lock (seqlock).
+// Writers serialize on a mutex and make the sequence number odd while they
+// modify the record, then even again when done. Readers take no lock at all:
+// they read optimistically and retry only if a writer intervened.
+//
+// The fields are atomics so the optimistic reads are not data races under
+// the Go memory model; the seqlock is what makes the pair consistent.
+type SeqlockRecord struct {
+	seq     atomic.Uint64 // Odd while a write is in progress
+	writeMu sync.Mutex    // Serializes writers only
+	value   atomic.Int64
+	version atomic.Int64
+	retries atomic.Int64 // Reads that had to retry because of a writer
+
+	backoff     Backoff      // How a reader waits for a writer to finish
+	backoffWait atomic.Int64 // Nanoseconds readers spent in backoff
+}
+
+// NewSeqlockRecord creates a seqlock-protected record with an initial
+// value. A reader that finds a write in progress yields the processor
+// before it looks again; SetBackoff changes that.
+func NewSeqlockRecord(value int) *SeqlockRecord {
+	r := &SeqlockRecord{backoff: Backoff{Strategy: BackoffYield}}
+	r.value.Store(int64(value))
+	r.version.Store(1)
+	return r
+}
+
+// Load returns a consistent value/version pair without taking any lock
+func (r *SeqlockRecord) Load() (int, int) {
+	for waits := 1; ; {
+		start := r.seq.Load()
+		if start&1 == 1 {
+			// A writer is in the critical section, let it finish
+			r.retries.Add(1)
+			r.backoffWait.Add(int64(r.backoff.Wait(waits)))
+			waits++
+			continue
+		}
+
+		value := r.value.Load()
+		version := r.version.Load()
+
+		if r.seq.Load() == start {
+			return int(value), int(version)
+		}
+		r.retries.Add(1)
+	}
+}
+
+// Store replaces the value and bumps the version
+func (r *SeqlockRecord) Store(value int) {
+	r.writeMu.Lock()
+	r.seq.Add(1) // odd: write in progress
+	r.value.Store(int64(value))
+	r.version.Add(1)
+	r.seq.Add(1) // even: write done
+	r.writeMu.Unlock()
+}
+
+// Add applies a delta as an atomic read-modify-write and returns the new value
+func (r *SeqlockRecord) Add(delta int) int {
+	r.writeMu.Lock()
+	r.seq.Add(1)
+	newValue := r.value.Load() + int64(delta)
+	r.value.Store(newValue)
+	r.version.Add(1)
+	r.seq.Add(1)
+	r.writeMu.Unlock()
+	return int(newValue)
+}
+
+// SetBackoff sets how readers wait for a write in progress. It should be
+// called before the record is shared.
+func (r *SeqlockRecord) SetBackoff(b Backoff) {
+	r.backoff = b
+}
+
+// BackoffWait returns how long readers spent waiting for writes in
+// progress
+func (r *SeqlockRecord) BackoffWait() time.Duration {
+	return time.Duration(r.backoffWait.Load())
+}
+
+// Retries returns how many optimistic reads had to be retried
+func (r *SeqlockRecord) Retries() int64 {
+	return r.retries.Load()
+}
+
+// RWMutexRecord is the reader-writer lock equivalent of SeqlockRecord,
+// used as the baseline in the hot-key benchmarks
+type RWMutexRecord struct {
+	mu      sync.RWMutex
+	value   int
+	version int
+}
+
+// NewRWMutexRecord creates an RWMutex-protected record with an initial value
+func NewRWMutexRecord(value int) *RWMutexRecord {
+	return &RWMutexRecord{value: value, version: 1}
+}
+
+// Load returns the value/version pair under a read lock
+func (r *RWMutexRecord) Load() (int, int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.value, r.version
+}
+
+// Store replaces the value and bumps the version under the write lock
+func (r *RWMutexRecord) Store(value int) {
+	r.mu.Lock()
+	r.value = value
+	r.version++
+	r.mu.Unlock()
+}
+
+// Add applies a delta under the write lock and returns the new value
+func (r *RWMutexRecord) Add(delta int) int {
+	r.mu.Lock()
+	r.value += delta
+	r.version++
+	newValue := r.value
+	r.mu.Unlock()
+	return newValue
+}
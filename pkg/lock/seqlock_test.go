@@ -0,0 +1,99 @@
+package lock
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestSeqlockNoTornReads tests that optimistic readers never observe a
+// value/version pair from the middle of a write
+func TestSeqlockNoTornReads(t *testing.T) {
+	// value and version move in lockstep: value == version - 1
+	record := NewSeqlockRecord(0)
+
+	stopChan := make(chan bool)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				record.Add(1)
+			}
+		}()
+	}
+
+	var readers sync.WaitGroup
+	torn := make(chan [2]int, 1)
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stopChan:
+					return
+				default:
+					value, version := record.Load()
+					if value != version-1 {
+						select {
+						case torn <- [2]int{value, version}:
+						default:
+						}
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(stopChan)
+	readers.Wait()
+
+	select {
+	case pair := <-torn:
+		t.Errorf("torn read: value=%d version=%d", pair[0], pair[1])
+	default:
+	}
+
+	if value, _ := record.Load(); value != 4000 {
+		t.Errorf("expected value=4000, got %d", value)
+	}
+}
+
+// BenchmarkHotKeySeqlock benchmarks a read-mostly hot key behind a seqlock
+func BenchmarkHotKeySeqlock(b *testing.B) {
+	record := NewSeqlockRecord(0)
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if i%10 == 0 {
+				record.Add(1)
+			} else {
+				record.Load()
+			}
+			i++
+		}
+	})
+	b.ReportMetric(float64(record.Retries())/float64(b.N), "retries/op")
+}
+
+// BenchmarkHotKeyRWMutex benchmarks the same workload behind an RWMutex
+func BenchmarkHotKeyRWMutex(b *testing.B) {
+	record := NewRWMutexRecord(0)
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if i%10 == 0 {
+				record.Add(1)
+			} else {
+				record.Load()
+			}
+			i++
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunAdmissionControlScenario runs the counter scenario on a two-phase
+// locking database that admits at most limit transactions at once, or any
+// number at 0, to show where the waiting moves and what it costs: with a
+// limit, clients queue at BEGIN instead of on the hot counter's lock.
+func RunAdmissionControlScenario(ctx context.Context, limit int, numClients int, incrementsPerClient int) ScenarioResult {
+	fmt.Println("\n=== Admission Control Scenario ===")
+	d := db.NewTwoPhaseLockingDatabase()
+	d.SetMaxConcurrentTx(limit)
+
+	start := time.Now()
+	result := RunCounterScenario(ctx, d, numClients, incrementsPerClient)
+	result.Parameters["max_concurrent_tx"] = limit
+	elapsed := time.Since(start)
+
+	stats := d.Stats()
+	if limit <= 0 {
+		fmt.Println("Admission limit: unlimited")
+	} else {
+		fmt.Printf("Admission limit: %d concurrent transactions\n", limit)
+	}
+	fmt.Printf("  Elapsed: %v (%.0f tx/s)\n", elapsed.Round(time.Millisecond), float64(stats.TotalUpdates)/elapsed.Seconds())
+	fmt.Printf("  Queued for admission: %d", stats.AdmissionQueued)
+	if stats.AdmissionQueued > 0 {
+		fmt.Printf(" (avg wait %v)", (stats.AdmissionWait / time.Duration(stats.AdmissionQueued)).Round(time.Microsecond))
+	}
+	fmt.Printf("\n  Lock timeouts: %d\n", stats.LockTimeouts)
+	return result
+}
+
+// RunDeadlineSchedulingScenario overloads a database that admits two
+// transactions at a time with a mix of transactions with tight and loose
+// deadlines, and measures how many of each finish late under policy. FIFO
+// makes tight transactions wait behind loose ones; EDF lets them jump the
+// queue, at the cost of loose transactions that still have time to spare.
+func RunDeadlineSchedulingScenario(ctx context.Context, policy db.AdmissionPolicy, numClients int, txPerClient int) ScenarioResult {
+	const (
+		slots       = 2
+		serviceTime = time.Millisecond
+		tight       = 5 * time.Millisecond
+		loose       = 50 * time.Millisecond
+	)
+
+	d := db.NewTwoPhaseLockingDatabase()
+	d.SetMaxConcurrentTx(slots)
+	d.SetAdmissionPolicy(policy)
+	result := newScenarioResult("deadline_scheduling", d, map[string]any{
+		"policy":        policy.String(),
+		"clients":       numClients,
+		"tx_per_client": txPerClient,
+		"slots":         slots,
+	})
+	result.Seed = db.NewRunSeed()
+
+	fmt.Printf("\n=== Deadline Scheduling Scenario (%s) ===\n", policy)
+	fmt.Printf("Running %d clients x %d transactions through %d slots; deadlines %v or %v, work %v each\n",
+		numClients, txPerClient, slots, tight, loose, serviceTime)
+
+	var wg sync.WaitGroup
+	var tightRun, tightMissed, looseRun, looseMissed atomic.Int64
+
+	for i := 0; i < numClients; i++ {
+		wg.Add(1)
+		clientID := i
+
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(result.Seed + int64(clientID)))
+			key := fmt.Sprintf("client_%d", clientID)
+
+			for j := 0; j < txPerClient && ctx.Err() == nil; j++ {
+				slack, run, missed := loose, &looseRun, &looseMissed
+				if rng.Intn(2) == 0 {
+					slack, run, missed = tight, &tightRun, &tightMissed
+				}
+				deadline := time.Now().Add(slack)
+
+				tx := d.BeginTransactionWithDeadline(deadline)
+				d.UpdateOrInsert(tx, key, 1, 0)
+				time.Sleep(serviceTime) // Simulate the transaction's work
+				d.Commit(tx)
+
+				run.Add(1)
+				if time.Now().After(deadline) {
+					missed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	done := int(tightRun.Load() + looseRun.Load())
+	result.Partial = reportPartial(ctx, done, numClients*txPerClient, "transactions")
+
+	rate := func(missed, run int64) float64 {
+		if run == 0 {
+			return 0
+		}
+		return float64(missed) / float64(run)
+	}
+	tightRate := rate(tightMissed.Load(), tightRun.Load())
+	looseRate := rate(looseMissed.Load(), looseRun.Load())
+	overall := rate(tightMissed.Load()+looseMissed.Load(), int64(done))
+
+	fmt.Printf("\nTight deadlines missed: %d of %d (%.1f%%)\n", tightMissed.Load(), tightRun.Load(), 100*tightRate)
+	fmt.Printf("Loose deadlines missed: %d of %d (%.1f%%)\n", looseMissed.Load(), looseRun.Load(), 100*looseRate)
+	fmt.Printf("Overall miss rate:      %.1f%%\n", 100*overall)
+
+	stats := d.Stats()
+	result.Passed = stats.LockTimeouts == 0
+	result.Metrics["tight_miss_rate"] = tightRate
+	result.Metrics["loose_miss_rate"] = looseRate
+	result.Metrics["miss_rate"] = overall
+	if stats.AdmissionQueued > 0 {
+		result.Metrics["avg_admission_wait_us"] = float64((stats.AdmissionWait / time.Duration(stats.AdmissionQueued)).Microseconds())
+	}
+	return result.finish(d)
+}
@@ -0,0 +1,17 @@
+package sim
+
+import (
+	"context"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestAtomicCounterScenario checks the Incr counter loses nothing on the
+// unsynchronized engine
+func TestAtomicCounterScenario(t *testing.T) {
+	result := RunAtomicCounterScenario(context.Background(), db.NewUnsynchronizedDatabase(), 8, 50)
+	if !result.Passed {
+		t.Errorf("Atomic counter scenario failed: %v", result.Metrics)
+	}
+}
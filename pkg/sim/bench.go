@@ -0,0 +1,214 @@
+package sim
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// The bench command measures what each engine's synchronization costs
+// across a matrix of workloads: every combination of a goroutine count, a
+// key cardinality and a read ratio. Each cell runs on a new database with
+// no processing delays, no operation logs and pooled transactions, as the
+// Go benchmarks do, so the engines' own overhead is all that is measured,
+// and the matrix is written as CSV, a row per engine and cell, for a
+// spreadsheet or notebook to chart.
+//
+//	go run ./cmd/db-sim bench
+//	go run ./cmd/db-sim bench -engines 2pl,mvcc -goroutines 1,16 -keys 1,1000 -reads 0,90 -duration 100ms -o matrix.csv
+
+// The axes of the default matrix
+var (
+	DefaultBenchGoroutines = []int{1, 4, 16, 64}
+	DefaultBenchKeys       = []int{1, 100, 10000}
+	DefaultBenchReads      = []int{0, 50, 90, 100}
+)
+
+// BenchCell is one workload of a benchmark matrix: Goroutines goroutines
+// running transactions back to back over Keys keys, each a read of a
+// random key or, in 100-ReadPercent percent of them, an update of one
+type BenchCell struct {
+	Goroutines  int
+	Keys        int
+	ReadPercent int
+}
+
+// String names the cell as its sub-benchmark is named
+func (c BenchCell) String() string {
+	return fmt.Sprintf("g=%d/keys=%d/reads=%d", c.Goroutines, c.Keys, c.ReadPercent)
+}
+
+// BenchCells returns every combination of the axes, goroutines varying
+// slowest
+func BenchCells(goroutines, keys, reads []int) []BenchCell {
+	var cells []BenchCell
+	for _, g := range goroutines {
+		for _, k := range keys {
+			for _, r := range reads {
+				cells = append(cells, BenchCell{Goroutines: g, Keys: k, ReadPercent: r})
+			}
+		}
+	}
+	return cells
+}
+
+// BenchResult is what one engine did in one cell of the matrix
+type BenchResult struct {
+	Engine    string
+	Cell      BenchCell
+	Committed int
+	Aborted   int
+	Elapsed   time.Duration
+	Latency   db.LatencyHistogram // Of every transaction, aborted ones included
+}
+
+// Throughput returns the committed transactions per second
+func (r BenchResult) Throughput() float64 {
+	return float64(r.Committed) / r.Elapsed.Seconds()
+}
+
+// newBenchDatabase returns a new database of engine set up, if it is
+// Configurable, for measuring the engine alone, loaded with the keys of
+// cell
+func newBenchDatabase(engine string, cell BenchCell) (db.DB, error) {
+	d, err := db.OpenEngine(engine)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := d.(db.Configurable); ok {
+		c.SetProcessingDelays(db.NoProcessingDelays)
+		c.SetOpLogLimit(0)
+		c.SetTransactionPooling(true)
+	}
+	return d, bulkLoad(d, benchmarkKeys(cell.Keys))
+}
+
+// benchmarkKeys returns the values key_0 = 0 to key_<n-1> = n-1, for a
+// benchmark to load before it starts
+func benchmarkKeys(n int) map[string]int {
+	values := make(map[string]int, n)
+	for i, key := range numberedKeys(n) {
+		values[key] = i
+	}
+	return values
+}
+
+// benchTransaction runs one transaction of a cell with readPercent on d:
+// a read of a random one of keys, or an update of one. It reports whether
+// the transaction committed.
+func benchTransaction(d db.DB, keys []string, readPercent int, rng *rand.Rand) bool {
+	key := keys[rng.Intn(len(keys))]
+	tx := begin(d)
+	if rng.Intn(100) < readPercent {
+		d.Read(tx, key)
+	} else {
+		d.Update(tx, key, 1)
+	}
+	return d.Commit(tx) == nil
+}
+
+// RunBenchCell runs cell on d for duration, or until ctx is done, with
+// exactly cell.Goroutines goroutines, each running at least one
+// transaction
+func RunBenchCell(ctx context.Context, d db.DB, cell BenchCell, duration time.Duration, seed int64) BenchResult {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	keys := numberedKeys(cell.Keys)
+	latency := new(db.LatencyCounters)
+	var mu sync.Mutex
+	result := BenchResult{Engine: engineName(d), Cell: cell}
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for g := 0; g < cell.Goroutines; g++ {
+		wg.Add(1)
+		go func(rng *rand.Rand) {
+			defer wg.Done()
+			committed, aborted := 0, 0
+			for done := false; !done; done = ctx.Err() != nil {
+				began := time.Now()
+				if benchTransaction(d, keys, cell.ReadPercent, rng) {
+					committed++
+				} else {
+					aborted++
+				}
+				latency.Observe(time.Since(began))
+			}
+			mu.Lock()
+			result.Committed += committed
+			result.Aborted += aborted
+			mu.Unlock()
+		}(rand.New(rand.NewSource(seed + int64(g))))
+	}
+	wg.Wait()
+	result.Elapsed = time.Since(start)
+	result.Latency = latency.Snapshot()
+	return result
+}
+
+// benchCSVHeader is the header of the bench command's CSV matrix
+var benchCSVHeader = []string{"engine", "goroutines", "keys", "read_pct", "committed", "aborted", "throughput", "abort_rate", "p50_us", "p99_us"}
+
+// record returns the result as a CSV record under benchCSVHeader
+func (r BenchResult) record() []string {
+	float := func(f float64, prec int) string { return strconv.FormatFloat(f, 'f', prec, 64) }
+	return []string{
+		r.Engine, strconv.Itoa(r.Cell.Goroutines), strconv.Itoa(r.Cell.Keys), strconv.Itoa(r.Cell.ReadPercent),
+		strconv.Itoa(r.Committed), strconv.Itoa(r.Aborted),
+		float(r.Throughput(), 0), float(float64(r.Aborted)/float64(max(r.Committed+r.Aborted, 1)), 4),
+		float(microseconds(r.Latency.P50), 3), float(microseconds(r.Latency.P99), 3),
+	}
+}
+
+// Bench runs every cell on every engine for duration each, writing the
+// matrix to out as CSV as it goes and a line per cell to progress
+func Bench(ctx context.Context, out io.Writer, progress io.Writer, engines []string, cells []BenchCell, duration time.Duration) error {
+	var errs []error
+	for _, engine := range engines {
+		if _, err := db.OpenEngine(engine); err != nil {
+			errs = append(errs, err)
+		} else if name, _ := db.LookupEngine(strings.SplitN(engine, "/", 2)[0]); name == "unsynchronized" {
+			errs = append(errs, fmt.Errorf("the unsynchronized engine cannot run in parallel"))
+		}
+	}
+	if len(engines) == 0 || len(cells) == 0 || duration <= 0 {
+		errs = append(errs, fmt.Errorf("nothing to measure"))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	w := csv.NewWriter(out)
+	if err := w.Write(benchCSVHeader); err != nil {
+		return err
+	}
+	seed := db.NewRunSeed()
+	for _, engine := range engines {
+		for _, cell := range cells {
+			d, err := newBenchDatabase(engine, cell)
+			if err != nil {
+				return err
+			}
+			result := RunBenchCell(ctx, d, cell, duration, seed)
+			fmt.Fprintf(progress, "%-28s %-26s %10.0f tx/s, %d aborted, p99 %v\n", engine, cell,
+				result.Throughput(), result.Aborted, roundLatency(result.Latency.P99))
+			if err := w.Write(result.record()); err != nil {
+				return err
+			}
+			w.Flush()
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
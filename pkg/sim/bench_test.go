@@ -0,0 +1,62 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestBenchMatrixCSV runs a small matrix and checks it comes out as a CSV
+// row per engine and cell, in order, with work done in every cell
+func TestBenchMatrixCSV(t *testing.T) {
+	noLeaks(t)
+	var out bytes.Buffer
+	cells := BenchCells([]int{1, 4}, []int{1}, []int{0, 100})
+	if err := Bench(context.Background(), &out, io.Discard, []string{"2pl", "mvcc"}, cells, 5*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1+2*len(cells) || !reflect.DeepEqual(records[0], benchCSVHeader) {
+		t.Fatalf("got %d records headed %v, want %d under %v", len(records), records[0], 1+2*len(cells), benchCSVHeader)
+	}
+	for i, record := range records[1:] {
+		engine, cell := []string{"two-phase-locking", "mvcc"}[i/len(cells)], cells[i%len(cells)]
+		want := []string{engine, strconv.Itoa(cell.Goroutines), strconv.Itoa(cell.Keys), strconv.Itoa(cell.ReadPercent)}
+		if !reflect.DeepEqual(record[:4], want) {
+			t.Errorf("row %d is %v, want it to start %v", i, record, want)
+		}
+		if committed, _ := strconv.Atoi(record[4]); committed == 0 {
+			t.Errorf("row %d committed nothing: %v", i, record)
+		}
+	}
+}
+
+// TestRunBenchCellCounts checks a cell's updates all land, and are all
+// counted as committed
+func TestRunBenchCellCounts(t *testing.T) {
+	noLeaks(t)
+	d, err := newBenchDatabase("synchronized", BenchCell{Keys: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := RunBenchCell(context.Background(), d, BenchCell{Goroutines: 8, Keys: 1}, 10*time.Millisecond, 1)
+
+	tx := begin(d)
+	value, _ := d.Read(tx, "key_0")
+	d.Commit(tx)
+	if result.Committed == 0 || value != result.Committed || result.Aborted != 0 {
+		t.Errorf("%d committed and %d aborted, key_0 = %d", result.Committed, result.Aborted, value)
+	}
+	if result.Latency.Count != result.Committed {
+		t.Errorf("%d latencies for %d transactions", result.Latency.Count, result.Committed)
+	}
+}
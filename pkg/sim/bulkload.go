@@ -0,0 +1,30 @@
+package sim
+
+import (
+	"fmt"
+	"sort"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// bulkLoad writes values into store: with BulkLoad if it is a *Database,
+// otherwise in a single transaction of writes, in key order
+func bulkLoad(store db.DB, values map[string]int) error {
+	if d, ok := store.(*db.Database); ok {
+		return d.BulkLoad(values)
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tx := begin(store)
+	for _, key := range keys {
+		if !store.Write(tx, key, values[key]) {
+			store.Abort(tx)
+			return fmt.Errorf("loading %s failed", key)
+		}
+	}
+	return store.Commit(tx)
+}
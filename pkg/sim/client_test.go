@@ -0,0 +1,60 @@
+package sim
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestClientRunHonorsBudget tests that a client stops issuing transactions
+// once its scenario context expires
+func TestClientRunHonorsBudget(t *testing.T) {
+	d := db.NewTwoPhaseLockingDatabase()
+	config := ClientConfig{ID: 1, NumTransactions: 100000, OperationsPerTx: 3, ThinkTime: time.Millisecond}
+	client := NewClient(config, d)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	start := time.Now()
+	go client.Run(ctx, &wg)
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("client kept running %v after a 20ms budget", elapsed)
+	}
+	if done := client.Completed(); done == 0 || done >= config.NumTransactions {
+		t.Errorf("expected a partial run, completed %d of %d", done, config.NumTransactions)
+	}
+}
+
+// TestRunSeedRepeatsOperations verifies clients seeded from RunSeed pick
+// the same operations in every run, and that clients differ from each other
+func TestRunSeedRepeatsOperations(t *testing.T) {
+	defer func(seed int64) { db.RunSeed = seed }(db.RunSeed)
+	db.RunSeed = 42
+
+	operations := func(id int) [][]Operation {
+		c := NewClient(ClientConfig{ID: id, OperationsPerTx: 3}, db.NewTwoPhaseLockingDatabase())
+		txs := make([][]Operation, 20)
+		for i := range txs {
+			txs[i] = c.nextTransaction()
+		}
+		return txs
+	}
+	if first, again := operations(1), operations(1); !reflect.DeepEqual(first, again) {
+		t.Error("client 1 picked different operations with the same seed")
+	}
+	if reflect.DeepEqual(operations(1), operations(2)) {
+		t.Error("clients 1 and 2 picked the same operations")
+	}
+	if got := seedOrClock(0); got != 42 {
+		t.Errorf("seedOrClock(0) = %d, expected the run seed 42", got)
+	}
+}
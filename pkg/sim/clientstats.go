@@ -0,0 +1,43 @@
+package sim
+
+import (
+	"fmt"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// starvedShare is the share of the mean throughput below which a client
+// is reported as starved
+const starvedShare = 0.5
+
+// printFairnessReport prints each client's throughput while it was
+// active, latencies, abort rate and lock wait, then Jain's index of their
+// throughputs, and returns the index and how many clients were starved.
+// Throughput is measured over each client's own activity, since clients
+// that each run a fixed number of transactions all get through them by
+// the end of the run: a starved client shows up as one that took longer.
+func printFairnessReport(clients []db.ClientStats) (jain float64, starved int) {
+	throughputs := make([]float64, len(clients))
+	mean := 0.0
+	for i, c := range clients {
+		throughputs[i] = c.Throughput()
+		mean += throughputs[i] / float64(len(clients))
+	}
+
+	fmt.Println("Per-client fairness:")
+	for i, c := range clients {
+		mark := ""
+		if throughputs[i] < starvedShare*mean {
+			mark = "  ← starved"
+			starved++
+		}
+		fmt.Printf("  client %-3d %8.1f tx/s, latency p50 %-8v p99 %-8v aborts %5.1f%%, lock wait %v%s\n",
+			c.Client, throughputs[i], c.Latency.P50.Round(time.Microsecond), c.Latency.P99.Round(time.Microsecond),
+			100*c.AbortRate(), c.LockWait.Round(time.Microsecond), mark)
+	}
+	jain = db.JainIndex(throughputs)
+	fmt.Printf("Jain's fairness index over throughput: %.3f (1 = perfectly fair, %.3f = one client gets everything)\n",
+		jain, 1/float64(len(clients)))
+	return jain, starved
+}
@@ -0,0 +1,18 @@
+package sim
+
+import (
+	"context"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestScenarioReportsFairness verifies a multi-client scenario ends with
+// the fairness index among its metrics
+func TestScenarioReportsFairness(t *testing.T) {
+	result := RunCounterScenario(context.Background(), db.NewTwoPhaseLockingDatabase(), 4, 20)
+	jain, reported := result.Metrics["jain_fairness"]
+	if !reported || jain <= 0.25 || jain > 1 {
+		t.Errorf("Expected a fairness index in (0.25, 1], got %v (reported %v)", jain, reported)
+	}
+}
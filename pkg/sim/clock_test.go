@@ -0,0 +1,14 @@
+package sim
+
+import (
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// simulated gives d a simulated clock, for tests whose operations should
+// not spend real time on their processing delays, and returns it
+func simulated(d *db.Database) *db.Database {
+	d.SetClock(db.NewSimClock(time.Time{}))
+	return d
+}
@@ -0,0 +1,688 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"database-sync-unsynchronized/httpapi"
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// Commands. Each scenario that can be run on its own is a Command, whose
+// flags are its parameters; cmd/db-sim runs them by name, and each in
+// turn with the flags of its runs when it makes the full run.
+
+// Command is a scenario that can be run on its own, with its parameters
+// as flags
+type Command struct {
+	Name    string
+	Summary string
+	// define declares the command's flags on fs and returns the scenario,
+	// which reads them once fs has parsed the arguments
+	define func(fs *flag.FlagSet) func(ctx context.Context) ScenarioResult
+	// runs are the flags of each run the full run makes of the command,
+	// such as the same workload on several engines; nil for one run with
+	// its defaults
+	runs [][]string
+	// Expect is what the full run's closing summary says the command
+	// shows; lines after the first continue it
+	Expect string
+}
+
+// engineFlag is a -engine flag naming a registered database engine as
+// workload files do. An engine with policies may name one too, as in
+// synchronized/fair.
+type engineFlag struct{ name string }
+
+func (e *engineFlag) String() string { return e.name }
+
+func (e *engineFlag) Set(name string) error {
+	if _, err := db.OpenEngine(name); err != nil {
+		return err
+	}
+	e.name = name
+	return nil
+}
+
+// open returns a new database of the named engine
+func (e *engineFlag) open() db.DB {
+	d, _ := db.OpenEngine(e.name) // Set validated the name
+	return d
+}
+
+// engine declares an -engine flag defaulting to name
+func engine(fs *flag.FlagSet, name string) *engineFlag {
+	e := &engineFlag{name: name}
+	fs.Var(e, "engine", "database engine: "+strings.Join(db.EngineVariants(), ", "))
+	return e
+}
+
+// databaseFlag is an -engine flag for scenarios that need more than a DB,
+// which only accepts the built-in engines
+type databaseFlag struct{ engineFlag }
+
+func (e *databaseFlag) Set(name string) error {
+	if _, err := db.OpenDatabase(name); err != nil {
+		return err
+	}
+	e.name = name
+	return nil
+}
+
+// open returns a new database of the named engine
+func (e *databaseFlag) open() *db.Database {
+	d, _ := db.OpenDatabase(e.name) // Set validated the name
+	return d
+}
+
+// database declares an -engine flag for a built-in engine defaulting to
+// name
+func database(fs *flag.FlagSet, name string) *databaseFlag {
+	e := &databaseFlag{engineFlag{name: name}}
+	fs.Var(e, "engine", "database engine: "+strings.Join(db.BuiltinEngineVariants(), ", "))
+	return e
+}
+
+// IntListFlag is a comma-separated list of integers, such as "1,2,4"
+type IntListFlag []int
+
+func (l *IntListFlag) String() string {
+	parts := make([]string, len(*l))
+	for i, n := range *l {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *IntListFlag) Set(value string) error {
+	var list IntListFlag
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n <= 0 {
+			return fmt.Errorf("%q is not a positive integer", part)
+		}
+		list = append(list, n)
+	}
+	*l = list
+	return nil
+}
+
+// commands are the scenarios that can be run one at a time, with the
+// parameters main runs them with as their defaults, in the order the full
+// run runs them. Registered scenarios follow them.
+var commands = []Command{
+	{"counter", "concurrent increments of one counter (lost updates)", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "unsynchronized")
+		clients := fs.Int("clients", 10, "number of concurrent clients")
+		increments := fs.Int("increments", 100, "increments per client")
+		atomic := fs.Bool("atomic", false, "increment with one atomic db.Incr call instead of read-then-write")
+		return func(ctx context.Context) ScenarioResult {
+			if *atomic {
+				return RunAtomicCounterScenario(ctx, store.open(), *clients, *increments)
+			}
+			return RunCounterScenario(ctx, store.open(), *clients, *increments)
+		}
+	}, [][]string{nil, {"-atomic"}},
+		"Counter: lost updates (final value < expected);\none atomic db.Incr call each loses none, even unsynchronized"},
+	{"bank", "concurrent transfers between accounts (lost updates, money created or destroyed)", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "unsynchronized")
+		clients := fs.Int("clients", 5, "number of concurrent clients")
+		transfers := fs.Int("transfers", 50, "transfers per client")
+		atomic := fs.Bool("atomic", false, "transfer with one atomic db.Transfer call")
+		return func(ctx context.Context) ScenarioResult {
+			if *atomic {
+				return RunAtomicTransferScenario(ctx, store.open(), *clients, *transfers)
+			}
+			return RunBankTransferScenario(ctx, store.open(), *clients, *transfers)
+		}
+	}, [][]string{nil, {"-atomic"}, {"-engine", "2pl"}, {"-engine", "mvcc"}},
+		"Bank transfer: money lost unsynchronized (total < 2000); db.Transfer, two-phase locking\nand MVCC, whose conflicting transfers RunTransaction retries, keep the total at 2000"},
+	{"readwrite", "readers checking an invariant while writers move values (dirty reads)", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "unsynchronized")
+		readers := fs.Int("readers", 5, "number of readers")
+		writers := fs.Int("writers", 3, "number of writers")
+		duration := fs.Duration("duration", 2*time.Second, "how long the workload runs")
+		return func(ctx context.Context) ScenarioResult {
+			return RunReadWriteScenario(ctx, store.open(), *readers, *writers, *duration)
+		}
+	}, [][]string{
+		nil,
+		{"-engine", "synchronized/prefer-readers", "-duration", "500ms"},
+		{"-engine", "synchronized/prefer-writers", "-duration", "500ms"},
+		{"-engine", "synchronized/fair", "-duration", "500ms"},
+		{"-engine", "mvcc", "-duration", "500ms"},
+	}, "Read-write: inconsistent reads unsynchronized; under each lock policy the non-preferred\nrole waits much longer; MVCC readers see a snapshot and never an inconsistent read"},
+	{"general", "eight clients running random reads, writes, updates and deletes", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "unsynchronized")
+		lockTimeout := fs.Duration("lock-timeout", 20*time.Millisecond, "key lock timeout under two-phase locking, which breaks deadlocks")
+		numKeys := fs.Int("num-keys", 0, "operate on key_0 to key_<n-1> instead of the five built-in keys (0)")
+		var distribution KeyDistribution
+		fs.Var(&distribution, "distribution", "key distribution: uniform, zipfian[:skew] or hotspot[:keys%/ops%]")
+		duration := fs.Duration("duration", 0, "run the clients for this long instead of 50 transactions each (0)")
+		warmup := fs.Duration("warmup", 0, "with -duration, run this long first without measuring")
+		cooldown := fs.Duration("cooldown", 0, "with -duration, run this long after without measuring")
+		contention := fs.Int("contention", 0, "then report the n keys with the most lock waiting; 0 to disable")
+		return func(ctx context.Context) ScenarioResult {
+			d := store.open()
+			d.SetLockTimeout(*lockTimeout)
+			workload := GeneralWorkload()
+			workload.Distribution = distribution
+			if *numKeys > 0 {
+				workload.NumKeys, workload.InitialValues = *numKeys, nil
+			}
+			if *duration > 0 {
+				workload.Duration, workload.Warmup, workload.Cooldown = db.Duration(*duration), db.Duration(*warmup), db.Duration(*cooldown)
+				workload.Clients[0].Transactions = 0
+			}
+			result := runGeneralWorkload(ctx, d, workload)
+			if *contention > 0 {
+				d.ContentionReport(*contention)
+			}
+			return result
+		}
+	}, [][]string{nil, {"-engine", "2pl", "-contention", "5"}},
+		"General: data corruption and race warnings unsynchronized; two-phase locking keeps the data,\nand lock timeouts break its deadlocks (run with -lockdep to see the lock-order inversions behind them)"},
+	{"admission", "fifty clients on one hot counter, admitted a few transactions at a time or all at once", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		limit := fs.Int("limit", 0, "most transactions active at once; 0 for no cap")
+		clients := fs.Int("clients", 50, "number of concurrent clients")
+		increments := fs.Int("increments", 20, "increments per client")
+		return func(ctx context.Context) ScenarioResult {
+			return RunAdmissionControlScenario(ctx, *limit, *clients, *increments)
+		}
+	}, [][]string{nil, {"-limit", "4"}},
+		"Admission control: with a limit, clients queue at BEGIN instead of on the hot key"},
+	{"producer-consumer", "producers and consumers sharing a bounded queue (condition variables)", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "2pl")
+		producers := fs.Int("producers", 3, "number of producers")
+		consumers := fs.Int("consumers", 4, "number of consumers")
+		items := fs.Int("items", 50, "items per producer")
+		return func(ctx context.Context) ScenarioResult {
+			return RunProducerConsumerScenario(ctx, store.open(), *producers, *consumers, *items)
+		}
+	}, nil, "Producer-consumer: consumers sleep in WaitFor, every item consumed once"},
+	{"failover", "the primary dies mid-workload and the standby takes over", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		synchronous := fs.Bool("sync", false, "replicate synchronously instead of asynchronously")
+		clients := fs.Int("clients", 8, "number of concurrent clients")
+		txs := fs.Int("tx", 100, "transactions per client")
+		return func(ctx context.Context) ScenarioResult {
+			mode := db.AsyncReplication
+			if *synchronous {
+				mode = db.SyncReplication
+			}
+			return RunFailoverScenario(ctx, mode, *clients, *txs)
+		}
+	}, [][]string{nil, {"-sync"}},
+		"Failover: async replication loses acknowledged commits, sync loses none\n(a retried commit whose acknowledgement died with the primary is duplicated)"},
+	{"partition", "quorum writes while a replica is partitioned away, then read repair and anti-entropy", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		clients := fs.Int("clients", 8, "number of concurrent clients")
+		writes := fs.Int("writes", 100, "writes per client")
+		return func(ctx context.Context) ScenarioResult {
+			return RunQuorumPartitionScenario(ctx, *clients, *writes)
+		}
+	}, nil, "Quorum: replicas diverge under a partition, read repair and anti-entropy reconcile them"},
+	{"handoff", "quorum writes while a replica is down, with or without hinted handoff", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		handoff := fs.Bool("handoff", false, "keep hints of the writes the replica missed and hand them over when it is back")
+		clients := fs.Int("clients", 8, "number of concurrent clients")
+		writes := fs.Int("writes", 100, "writes per client")
+		return func(ctx context.Context) ScenarioResult {
+			return RunHintedHandoffScenario(ctx, *handoff, *clients, *writes)
+		}
+	}, [][]string{nil, {"-handoff"}}, "Hinted handoff: a replica back from an outage holds every acknowledged write"},
+	{"writeskew", "two doctors going off call at once under snapshot isolation or SSI", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		isolation := fs.String("isolation", "RepeatableRead", "isolation level: RepeatableRead (snapshot isolation) or Serializable (SSI)")
+		rounds := fs.Int("rounds", 50, "number of rounds")
+		return func(ctx context.Context) ScenarioResult {
+			level, _ := db.ParseIsolationLevel(*isolation) // Checked by validateCommandFlags
+			return RunWriteSkewScenario(ctx, db.NewMVCCDatabase(), level, *rounds)
+		}
+	}, [][]string{nil, {"-isolation", "Serializable"}},
+		"Write skew: snapshot isolation leaves nobody on call, SSI aborts one doctor"},
+	{"probes", "readers probing for stale reads under several consistency modes", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		readers := fs.Int("readers", 4, "number of readers")
+		duration := fs.Duration("duration", 200*time.Millisecond, "how long each consistency mode is probed")
+		return func(ctx context.Context) ScenarioResult {
+			return RunConsistencyProbeScenario(ctx, *readers, *duration)
+		}
+	}, nil, "Consistency probes: stale reads only when R + W <= N or reading a lagging standby"},
+	{"restarts", "transfers restarted until they commit, counting the restarts an engine causes", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "2pl")
+		lockTimeout := fs.Duration("lock-timeout", 10*time.Millisecond, "key lock timeout under two-phase locking, which breaks deadlocks")
+		clients := fs.Int("clients", 8, "number of concurrent clients")
+		txs := fs.Int("tx", 50, "transactions per client")
+		return func(ctx context.Context) ScenarioResult {
+			d := store.open()
+			d.SetLockTimeout(*lockTimeout)
+			return RunRestartComparisonScenario(ctx, d, *clients, *txs)
+		}
+	}, [][]string{nil, {"-engine", "tso"}},
+		"Restart comparison: 2PL restarts on deadlock timeouts, T/O on out-of-order operations"},
+	{"diff", "the same seeded increments on the unsynchronized and two-phase locking engines, diffed", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		seed := fs.Int64("seed", 0, "workload seed; 0 picks one from the clock")
+		clients := fs.Int("clients", 8, "number of concurrent clients")
+		ops := fs.Int("ops", 100, "increments per client")
+		return func(ctx context.Context) ScenarioResult {
+			return RunSnapshotDiffScenario(ctx, seedOrClock(*seed), *clients, *ops)
+		}
+	}, nil, "Snapshot diff: unsynchronized keys fall short of the two-phase locking outcome"},
+	{"vacuum", "MVCC versions piling up on hot keys, with or without a background vacuum", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		interval := fs.Duration("vacuum", 0, "vacuum interval; 0 to disable")
+		writers := fs.Int("writers", 8, "number of writers")
+		updates := fs.Int("updates", 200, "updates per writer")
+		return func(ctx context.Context) ScenarioResult {
+			return RunVersionGrowthScenario(ctx, *interval, *writers, *updates)
+		}
+	}, [][]string{nil, {"-vacuum", "5ms"}},
+		"Version GC: without vacuum every update stays in memory; with it one version per key"},
+	{"deadlines", "transactions with tight and loose deadlines overloading admission, FIFO or EDF", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		edf := fs.Bool("edf", false, "admit the earliest deadline first instead of in arrival order")
+		clients := fs.Int("clients", 12, "number of concurrent clients")
+		txs := fs.Int("tx", 40, "transactions per client")
+		return func(ctx context.Context) ScenarioResult {
+			policy := db.AdmitFIFO
+			if *edf {
+				policy = db.AdmitEDF
+			}
+			return RunDeadlineSchedulingScenario(ctx, policy, *clients, *txs)
+		}
+	}, [][]string{nil, {"-edf"}},
+		"Deadline scheduling: EDF misses far fewer tight deadlines than FIFO under overload"},
+	{"latency-slo", "transactions cancelled by their context when they exceed a latency SLO", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		slo := fs.Duration("slo", 10*time.Millisecond, "per-transaction latency SLO")
+		clients := fs.Int("clients", 8, "number of concurrent clients")
+		txs := fs.Int("tx", 50, "transactions per client")
+		return func(ctx context.Context) ScenarioResult {
+			return RunLatencySLOScenario(ctx, *slo, *clients, *txs)
+		}
+	}, nil, "Latency SLO: lock waits end when the transaction's context does, never at the lock timeout"},
+	{"crash-recovery", "crash mid-workload and rebuild from the checkpoint and WAL tail", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		interval := fs.Duration("checkpoint", 5*time.Millisecond, "checkpoint interval")
+		clients := fs.Int("clients", 6, "number of concurrent clients")
+		txs := fs.Int("tx", 200, "transactions per client")
+		return func(ctx context.Context) ScenarioResult {
+			return RunCrashRecoveryScenario(ctx, *interval, *clients, *txs)
+		}
+	}, nil, "Crash recovery: checkpoint plus WAL tail rebuild exactly the committed state"},
+	{"replay", "a journaled run with lost updates, replayed on two-phase locking to the same state", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		clients := fs.Int("clients", 10, "number of concurrent clients")
+		increments := fs.Int("increments", 100, "increments per client")
+		return func(ctx context.Context) ScenarioResult {
+			return RunJournalReplayScenario(ctx, *clients, *increments)
+		}
+	}, nil, "Journal replay: the replay lands on the same lost updates and shows the interleaving behind them"},
+	{"sessions", "sessions kept alive with a TTL while a sweeper expires them", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		ttl := fs.Duration("ttl", 5*time.Millisecond, "how long a refreshed session lives")
+		writers := fs.Int("writers", 4, "number of writers refreshing sessions")
+		readers := fs.Int("readers", 6, "number of readers looking sessions up")
+		duration := fs.Duration("duration", 200*time.Millisecond, "how long the writers run")
+		return func(ctx context.Context) ScenarioResult {
+			return RunSessionExpiryScenario(ctx, *ttl, *writers, *readers, *duration)
+		}
+	}, nil, "Session expiry: expired sessions are never served, and the sweeper removes every one"},
+	{"tables", "transfers and counters with the same key names in separate tables", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "2pl")
+		lockTimeout := fs.Duration("lock-timeout", 10*time.Millisecond, "key lock timeout under two-phase locking, inherited by the tables")
+		clients := fs.Int("clients", 8, "number of concurrent clients")
+		transfers := fs.Int("transfers", 50, "transfers per client")
+		return func(ctx context.Context) ScenarioResult {
+			d := store.open()
+			d.SetLockTimeout(*lockTimeout)
+			return RunTablesScenario(ctx, d, *clients, *transfers)
+		}
+	}, nil, "Tables: transfers and counters share key names but not tables, so both stay exact"},
+	{"index", "tasks moving between priorities while readers query a secondary index", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "mvcc")
+		writers := fs.Int("writers", 4, "number of writers")
+		readers := fs.Int("readers", 4, "number of readers")
+		duration := fs.Duration("duration", 200*time.Millisecond, "how long the workload runs")
+		return func(ctx context.Context) ScenarioResult {
+			return RunIndexScenario(ctx, store.open(), *writers, *readers, *duration)
+		}
+	}, nil, "Secondary index: every query finds every task exactly once while tasks move"},
+	{"watch", "watchers following counters through change notifications", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "mvcc")
+		writers := fs.Int("writers", 6, "number of writers")
+		increments := fs.Int("increments", 100, "increments per writer")
+		watchers := fs.Int("watchers", 3, "number of watchers")
+		return func(ctx context.Context) ScenarioResult {
+			return RunWatchScenario(ctx, store.open(), *writers, *increments, *watchers)
+		}
+	}, nil, "Watch: every watcher sees every committed increment once, in version order"},
+	{"audit", "lost increments traced to the stale writes behind them", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		clients := fs.Int("clients", 8, "number of concurrent clients")
+		increments := fs.Int("increments", 50, "increments per client")
+		return func(ctx context.Context) ScenarioResult {
+			return RunAuditTrailScenario(ctx, *clients, *increments)
+		}
+	}, nil, "Audit trail: lost increments, each traced to the stale write and client behind it"},
+	{"shards", "cross-shard transfers with two-phase commit at several shard counts", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		shards := IntListFlag{1, 2, 4, 8, 16}
+		fs.Var(&shards, "shards", "comma-separated shard counts to run at")
+		clients := fs.Int("clients", 16, "number of concurrent clients")
+		transfers := fs.Int("transfers", 25, "transfers per client")
+		return func(ctx context.Context) ScenarioResult {
+			return RunShardScalingScenario(ctx, shards, *clients, *transfers)
+		}
+	}, nil, "Shard scaling: cross-shard transfers commit atomically at every shard count"},
+	{"http", "increments through the REST API, served on the server's goroutines", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "2pl")
+		clients := fs.Int("clients", 8, "number of concurrent clients")
+		increments := fs.Int("increments", 25, "increments per client")
+		return func(ctx context.Context) ScenarioResult {
+			return RunHTTPAPIScenario(ctx, store.open(), *clients, *increments)
+		}
+	}, nil, "HTTP API: increments made over REST are isolated like any others, none lost"},
+	{"http-load", "many REST sessions sharing a few pooled connections, with or without pipelining", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "mvcc")
+		sessions := fs.Int("sessions", 1000, "number of client sessions")
+		increments := fs.Int("increments", 3, "increments per session")
+		conns := fs.Int("conns", 4, "connections the pool may open")
+		pipeline := fs.Int("pipeline", 1, "requests in flight on one connection")
+		timeout := fs.Duration("request-timeout", 10*time.Second, "how long a request may take")
+		return func(ctx context.Context) ScenarioResult {
+			cfg := httpapi.PoolConfig{MaxConns: *conns, Pipeline: *pipeline, RequestTimeout: *timeout}
+			return RunHTTPLoadScenario(ctx, store.open(), *sessions, *increments, cfg)
+		}
+	}, [][]string{nil, {"-pipeline", "32"}},
+		"HTTP load: four pooled connections carry a thousand sessions; pipelining keeps\neach busy instead of idle between round trips"},
+	{"replication", "asynchronous read replicas serving stale reads", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		replicas := fs.Int("replicas", 3, "number of read replicas")
+		writers := fs.Int("writers", 4, "number of writers")
+		writes := fs.Int("writes", 100, "writes per writer")
+		delay := fs.Duration("delay", 500*time.Microsecond, "replication delay")
+		return func(ctx context.Context) ScenarioResult {
+			return RunReplicationScenario(ctx, *replicas, *writers, *writes, *delay)
+		}
+	}, nil, "Replication: lagging replicas serve stale reads, never go backwards, and converge"},
+	{"raft", "a Raft leader crashes and a new one takes over without losing writes", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		clients := fs.Int("clients", 4, "number of concurrent clients")
+		writes := fs.Int("writes", 100, "writes per client")
+		return func(ctx context.Context) ScenarioResult {
+			return RunRaftScenario(ctx, *clients, *writes)
+		}
+	}, nil, "Raft: the leader crashes, a new one is elected, and every acknowledged write is on every node"},
+	{"2pc", "two-phase commit through no votes and coordinator crashes", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		seed := fs.Int64("seed", 0, "failure injection seed; 0 picks one from the clock")
+		clients := fs.Int("clients", 8, "number of concurrent clients")
+		transfers := fs.Int("transfers", 100, "transfers per client")
+		return func(ctx context.Context) ScenarioResult {
+			return RunTwoPhaseCommitScenario(ctx, seedOrClock(*seed), *clients, *transfers)
+		}
+	}, nil, "Two-phase commit: through no votes and coordinator crashes, the total across shards never changes"},
+	{"lease", "stalled nodes writing after their lock leases expired", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		fencing := fs.Bool("fencing", false, "reject late writes with fencing tokens")
+		seed := fs.Int64("seed", 0, "stall seed; 0 picks one from the clock")
+		nodes := fs.Int("nodes", 8, "number of nodes")
+		increments := fs.Int("increments", 25, "increments per node")
+		return func(ctx context.Context) ScenarioResult {
+			return RunLeaseScenario(ctx, seedOrClock(*seed), *fencing, *nodes, *increments)
+		}
+	}, [][]string{nil, {"-fencing"}},
+		"Lease locks: stalled nodes' late writes lose increments unless fencing tokens reject them"},
+	{"quorum", "read and write quorums over the read replicas", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		writes := fs.Int("writes", 100, "writes per quorum configuration")
+		delay := fs.Duration("delay", time.Millisecond, "replication delay")
+		return func(ctx context.Context) ScenarioResult {
+			return RunReplicationQuorumScenario(ctx, *writes, *delay)
+		}
+	}, nil, "Replication quorums: with R+W>N every read sees the client's own write; with R+W<=N some miss it"},
+	{"ycsb", "a YCSB core workload (A to F) with throughput and latency per operation", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "2pl")
+		workload := fs.String("workload", "A", "core workload: A (update heavy), B (read mostly), C (read only), D (read latest), E (short ranges) or F (read-modify-write)")
+		records := fs.Int("records", 1000, "records loaded before the run")
+		clients := fs.Int("clients", 4, "number of concurrent clients")
+		ops := fs.Int("ops", 250, "operations per client, each its own transaction")
+		return func(ctx context.Context) ScenarioResult {
+			return RunYCSBScenario(ctx, store.open(), strings.ToUpper(*workload), *records, *clients, *ops)
+		}
+	}, [][]string{nil, {"-workload", "B"}, {"-workload", "C"}, {"-workload", "D"}, {"-workload", "E"}, {"-workload", "F"}},
+		"YCSB A-F: throughput and per-operation latency of the standard workloads, every record kept"},
+	{"openloop", "transactions arriving at a fixed rate, showing queueing once it exceeds capacity", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := engine(fs, "2pl")
+		lockTimeout := fs.Duration("lock-timeout", 20*time.Millisecond, "key lock timeout under two-phase locking, which breaks deadlocks")
+		rates := IntListFlag{5000}
+		fs.Var(&rates, "rate", "arrivals per second, or comma-separated rates to run one after another")
+		duration := fs.Duration("duration", time.Second, "how long transactions arrive for at each rate")
+		return func(ctx context.Context) ScenarioResult {
+			d := store.open()
+			if c, ok := d.(db.Configurable); ok {
+				c.SetLockTimeout(*lockTimeout)
+			}
+			perSecond := make([]float64, len(rates))
+			for i, rate := range rates {
+				perSecond[i] = float64(rate)
+			}
+			return RunOpenLoopScenario(ctx, d, perSecond, *duration)
+		}
+	}, [][]string{{"-rate", "500,2000,8000", "-duration", "300ms"}},
+		"Open-loop load: past capacity throughput levels off while response times grow with the queue"},
+	{"ratelimit", "clients capped at a fixed rate, comparing engines under the same load", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "2pl")
+		clients := fs.Int("clients", 16, "number of clients")
+		clientRate := fs.Float64("client-rate", 0, "transactions per second each client may start; 0 for no cap")
+		globalRate := fs.Float64("global-rate", 2000, "transactions per second all clients together may start; 0 for no cap")
+		duration := fs.Duration("duration", time.Second, "how long the clients run")
+		return func(ctx context.Context) ScenarioResult {
+			return RunRateLimitScenario(ctx, store.open(), *clients, *clientRate, *globalRate, *duration)
+		}
+	}, [][]string{
+		{"-engine", "synchronized/fair", "-duration", "500ms"},
+		{"-duration", "500ms"},
+		{"-engine", "mvcc", "-duration", "500ms"},
+	}, "Rate-limited load: every engine starts the same 2000 tx/s; latency and aborts differ"},
+	{"bounded-queue", "producers and consumers passing numbered items through a queue of database keys", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "2pl")
+		producers := fs.Int("producers", 3, "number of producers")
+		consumers := fs.Int("consumers", 3, "number of consumers")
+		items := fs.Int("items", 40, "items per producer")
+		capacity := fs.Int("capacity", 4, "slots in the queue")
+		return func(ctx context.Context) ScenarioResult {
+			return RunBoundedQueueScenario(ctx, store.open(), *producers, *consumers, *items, *capacity)
+		}
+	}, [][]string{{"-engine", "unsynchronized"}, nil},
+		"Bounded queue: unsynchronized, items lost and taken twice; two-phase locking delivers each once"},
+	{"phantom", "a scan repeated around an insert, and bookings against a quota, at an isolation level", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "2pl")
+		isolation := fs.String("isolation", "RepeatableRead", "isolation level: RepeatableRead, or Serializable for range locks or SSI")
+		rounds := fs.Int("rounds", 20, "number of rounds")
+		return func(ctx context.Context) ScenarioResult {
+			level, _ := db.ParseIsolationLevel(*isolation) // Checked by validateCommandFlags
+			return RunPhantomScenario(ctx, store.open(), level, *rounds)
+		}
+	}, [][]string{nil, {"-isolation", "Serializable"}, {"-engine", "mvcc"}, {"-engine", "mvcc", "-isolation", "Serializable"}},
+		"Phantoms: RepeatableRead lets 2PL's repeated scans find new keys, and MVCC's\nsnapshots overbook the quota; range locks and SSI prevent both"},
+	{"priority-inversion", "a high-priority transaction waiting on a low-priority lock holder while medium-priority work runs", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		inheritance := fs.Bool("inheritance", false, "lock holders inherit the priority of their waiters")
+		medium := fs.Int("medium", 3, "medium-priority jobs per round")
+		rounds := fs.Int("rounds", 10, "number of rounds")
+		return func(ctx context.Context) ScenarioResult {
+			return RunPriorityInversionScenario(ctx, *inheritance, *medium, *rounds)
+		}
+	}, [][]string{nil, {"-inheritance"}},
+		"Priority inversion: the high-priority transaction waits out all medium-priority work,\nunless the lock holder inherits its priority"},
+	{"convoy", "short transactions queuing behind a slow one under a database lock, and not under key locks", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		keyLocks := fs.Bool("key-locks", false, "lock each key instead of the whole database")
+		short := fs.Int("short", 16, "clients running short transactions")
+		duration := fs.Duration("duration", 300*time.Millisecond, "how long the clients run")
+		return func(ctx context.Context) ScenarioResult {
+			granularity := db.DatabaseLock
+			if *keyLocks {
+				granularity = db.KeyLocks
+			}
+			return RunConvoyScenario(ctx, granularity, *short, *duration)
+		}
+	}, [][]string{nil, {"-key-locks"}},
+		"Lock convoy: under a database lock every short transaction queues behind the slow one;\nwith per-key locks the queue stays empty"},
+	{"escrow", "orders taking items from a hot stock counter, under exclusive locks or escrow", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		escrow := fs.Bool("escrow", false, "reserve items with escrow instead of locking the counter")
+		clients := fs.Int("clients", 8, "number of concurrent clients")
+		orders := fs.Int("orders", 25, "orders per client")
+		return func(ctx context.Context) ScenarioResult {
+			return RunEscrowScenario(ctx, *escrow, *clients, *orders)
+		}
+	}, [][]string{nil, {"-escrow"}},
+		"Hot counter: escrow runs orders side by side, several times the throughput of\nexclusive locks, and the stock still never goes negative"},
+	{"linearizability", "every operation on a register and a counter recorded and checked for linearizability", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "2pl")
+		clients := fs.Int("clients", 4, "number of clients")
+		ops := fs.Int("ops", 50, "operations per client")
+		return func(ctx context.Context) ScenarioResult {
+			return RunLinearizabilityScenario(ctx, store.open(), *clients, *ops)
+		}
+	}, [][]string{{"-engine", "unsynchronized"}, nil, {"-engine", "mvcc"}},
+		"Linearizability: unsynchronized, no order explains the counter's responses;\ntwo-phase locking and MVCC histories are linearizable"},
+	{"modelcheck", "every interleaving of two or three small transactions checked against an invariant", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "unsynchronized")
+		program := &modelProgramFlag{"lost-update"}
+		fs.Var(program, "program", "transaction to check: "+strings.Join(modelProgramNames(), ", "))
+		threads := fs.Int("threads", 2, "copies of the transaction run at once")
+		limit := fs.Int("limit", 10000, "most interleavings to try")
+		return func(ctx context.Context) ScenarioResult {
+			return RunModelCheck(ctx, store.open, program.name, *threads, *limit)
+		}
+	}, [][]string{nil, {"-engine", "mvcc"}},
+		"Model check: unsynchronized, every interleaving with both reads before a commit\nloses an increment; under MVCC none of the 252 does"},
+	{"chaos", "transfers under injected delays, aborts, client crashes and a database crash, then recovery", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		seed := fs.Int64("seed", 0, "fault injection seed; 0 picks one from the clock")
+		clients := fs.Int("clients", 6, "number of concurrent clients")
+		transfers := fs.Int("transfers", 50, "transfers per client")
+		delay := fs.Float64("delay", 0.1, "probability of an extra delay at each fault point; 0 to disable")
+		maxDelay := fs.Duration("max-delay", time.Millisecond, "longest extra delay")
+		abort := fs.Float64("abort", 0.05, "probability of aborting the transaction at each operation; 0 to disable")
+		clientCrash := fs.Float64("client-crash", 0.002, "probability of a client dying partway through a transaction; 0 to disable")
+		crashTimeout := fs.Duration("client-crash-timeout", 20*time.Millisecond, "how long a dead client's transaction keeps its locks")
+		crashAt := fs.Int("crash-at", 150, "crash the database at this commit; 0 to disable")
+		crashPoint := fs.String("crash-point", db.CrashAfterWAL, "crash the database just "+db.CrashBeforeWAL+" or "+db.CrashAfterWAL)
+		return func(ctx context.Context) ScenarioResult {
+			return RunChaosScenario(ctx, db.FaultConfig{
+				Seed:                   seedOrClock(*seed),
+				DelayProbability:       *delay,
+				MaxDelay:               db.Duration(*maxDelay),
+				AbortProbability:       *abort,
+				ClientCrashProbability: *clientCrash,
+				ClientCrashTimeout:     db.Duration(*crashTimeout),
+				CrashAtCommit:          int64(*crashAt),
+				CrashPoint:             *crashPoint,
+			}, *clients, *transfers)
+		}
+	}, nil, "Chaos: injected aborts are retried, dead clients' transactions are aborted,\nand after the crash the recovered accounts still add up"},
+	{"power-failure", "transfers on a durable database, recovered after power failures at random WAL offsets", func(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+		store := database(fs, "2pl")
+		seed := fs.Int64("seed", 0, "seed picking the failure offsets; 0 picks one from the clock")
+		clients := fs.Int("clients", 4, "number of concurrent clients")
+		transfers := fs.Int("transfers", 50, "transfers per client")
+		failures := fs.Int("failures", 20, "power failures to recover from")
+		return func(ctx context.Context) ScenarioResult {
+			return RunPowerFailureScenario(ctx, store.open, seedOrClock(*seed), *clients, *transfers, *failures)
+		}
+	}, nil, "Power failures: wherever the WAL is cut, recovery keeps every acknowledged transfer\nand none of the torn one"},
+}
+
+// seedOrClock returns seed, or if it is 0 the run's -seed or one from the
+// clock
+func seedOrClock(seed int64) int64 {
+	if seed == 0 {
+		return db.NewRunSeed()
+	}
+	return seed
+}
+
+// FullRuns returns the flags of each run the full run makes of the
+// command
+func (c Command) FullRuns() [][]string {
+	if c.runs == nil {
+		return [][]string{nil}
+	}
+	return c.runs
+}
+
+// FindCommand returns the command called name
+func FindCommand(name string) (Command, bool) {
+	for _, c := range commands {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Command{}, false
+}
+
+// Commands returns every command, in the order the full run runs them
+func Commands() []Command {
+	return append([]Command(nil), commands...)
+}
+
+// ErrUnknownCommand is returned for a command that does not exist, and
+// ErrBadFlags by Parse for flags its flag set has already reported, with
+// its usage
+var (
+	ErrUnknownCommand = errors.New("unknown command")
+	ErrBadFlags       = errors.New("bad flags")
+)
+
+// Parse declares the command's flags on fs, parses args with it and
+// validates them, and returns the scenario with them. It returns
+// flag.ErrHelp if they asked for help.
+func (c Command) Parse(fs *flag.FlagSet, args []string) (func(context.Context) ScenarioResult, error) {
+	scenario := c.define(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, ErrBadFlags
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("%s: unexpected argument %q", c.Name, fs.Arg(0))
+	}
+	if err := ValidateFlags(fs); err != nil {
+		return nil, fmt.Errorf("%s: %w", c.Name, err)
+	}
+	return scenario, nil
+}
+
+// scenario returns the command's scenario with the flags args, which the
+// simulator chose itself
+func (c Command) scenario(args ...string) (func(context.Context) ScenarioResult, error) {
+	return c.Parse(flag.NewFlagSet(c.Name, flag.ContinueOnError), args)
+}
+
+// ValidateFlags rejects counts that are not positive, or negative
+// where 0 is the default, means no cap or disables something, and
+// isolation levels that do not exist
+func ValidateFlags(fs *flag.FlagSet) error {
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		getter, ok := f.Value.(flag.Getter)
+		if !ok {
+			return // Validated by its Set
+		}
+		zeroAllowed := f.DefValue == "0" || strings.HasSuffix(f.Usage, "0 for no cap") || strings.HasSuffix(f.Usage, "0 to disable")
+		switch value := getter.Get().(type) {
+		case int:
+			if zeroAllowed && value < 0 {
+				errs = append(errs, fmt.Errorf("-%s must not be negative", f.Name))
+			} else if !zeroAllowed && value <= 0 {
+				errs = append(errs, fmt.Errorf("-%s must be positive", f.Name))
+			}
+		case float64:
+			if zeroAllowed && value < 0 {
+				errs = append(errs, fmt.Errorf("-%s must not be negative", f.Name))
+			} else if !zeroAllowed && value <= 0 {
+				errs = append(errs, fmt.Errorf("-%s must be positive", f.Name))
+			}
+		case time.Duration:
+			if value < 0 {
+				errs = append(errs, fmt.Errorf("-%s must not be negative", f.Name))
+			}
+		}
+		if f.Name == "isolation" {
+			if _, err := db.ParseIsolationLevel(f.Value.String()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
@@ -0,0 +1,111 @@
+package sim
+
+import (
+	"errors"
+	"flag"
+	"reflect"
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestCommandsDefineFlags verifies every command declares its flags
+// without clashing, has defaults that pass validation, and runs in the
+// full run with flags it accepts and a summary of what it shows
+func TestCommandsDefineFlags(t *testing.T) {
+	seen := map[string]bool{"all": true}
+	for _, c := range commands {
+		if seen[c.Name] {
+			t.Errorf("command %q defined twice", c.Name)
+		}
+		seen[c.Name] = true
+
+		fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+		if c.define(fs) == nil {
+			t.Errorf("%s: no scenario", c.Name)
+		}
+		if err := ValidateFlags(fs); err != nil {
+			t.Errorf("%s: defaults rejected: %v", c.Name, err)
+		}
+		for _, args := range c.FullRuns() {
+			if _, err := c.scenario(args...); err != nil {
+				t.Errorf("%s %v: %v", c.Name, args, err)
+			}
+		}
+		if c.Expect == "" {
+			t.Errorf("%s: no expected behavior for the full run", c.Name)
+		}
+	}
+}
+
+// TestCompare verifies compare runs each chosen scenario on each chosen
+// engine, synchronized lock policies included
+func TestCompare(t *testing.T) {
+	manifest := NewRunManifest(nil)
+	if err := Compare(manifest, []string{"counter", "bank"}, []string{"2pl", "synchronized/fair"}, false); err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+	var ran []string
+	for _, result := range manifest.Scenarios {
+		ran = append(ran, result.Name+" on "+result.Engine)
+	}
+	want := []string{
+		"counter on two-phase-locking", "counter on synchronized/Fair",
+		"bank_transfer on two-phase-locking", "bank_transfer on synchronized/Fair",
+	}
+	if !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %v, expected %v", ran, want)
+	}
+	if !manifest.Scenarios[0].Passed || anomalies(manifest.Scenarios[0]) != 0 {
+		t.Errorf("counter on two-phase locking: %+v", manifest.Scenarios[0])
+	}
+}
+
+// TestAbortsAreNotAnomalies verifies the counter and read-write scenarios
+// count only committed work on engines that abort on conflicts, so their
+// aborts are not reported as lost updates or inconsistent reads
+func TestAbortsAreNotAnomalies(t *testing.T) {
+	ctx, cancel := NewScenarioContext()
+	defer cancel()
+	for _, engine := range []string{"mvcc", "tso"} {
+		t.Run(engine, func(t *testing.T) {
+			d, _ := db.OpenDatabase(engine)
+			counter := RunCounterScenario(ctx, d, 8, 50)
+			d, _ = db.OpenDatabase(engine)
+			readWrite := RunReadWriteScenario(ctx, d, 4, 2, 50*time.Millisecond)
+			for _, result := range []ScenarioResult{counter, readWrite} {
+				if !result.Passed || anomalies(result) != 0 {
+					t.Errorf("%s: passed %v with %d anomalies, metrics %v", result.Name, result.Passed, anomalies(result), result.Metrics)
+				}
+			}
+		})
+	}
+}
+
+// TestCompareRejectsWhatItCannotRun verifies compare rejects unknown
+// engines and scenarios, and scenarios that take no engine, before it
+// runs anything
+func TestCompareRejectsWhatItCannotRun(t *testing.T) {
+	cases := []struct {
+		scenarios, engines []string
+		want               error
+	}{
+		{[]string{"counter"}, []string{"btree"}, nil},
+		{[]string{"nope"}, []string{"2pl"}, ErrUnknownCommand},
+		{[]string{"raft"}, []string{"2pl"}, nil},
+		{[]string{"counter"}, nil, nil},
+	}
+	for _, c := range cases {
+		manifest := NewRunManifest(nil)
+		err := Compare(manifest, c.scenarios, c.engines, false)
+		if err == nil {
+			t.Errorf("%v on %v: no error", c.scenarios, c.engines)
+		} else if c.want != nil && !errors.Is(err, c.want) {
+			t.Errorf("%v on %v: error %v, expected %v", c.scenarios, c.engines, err, c.want)
+		}
+		if len(manifest.Scenarios) != 0 {
+			t.Errorf("%v on %v: ran a scenario", c.scenarios, c.engines)
+		}
+	}
+}
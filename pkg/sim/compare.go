@@ -0,0 +1,189 @@
+package sim
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// The compare command runs every scenario that takes an -engine flag on
+// every registered engine, under each of its policies, with the
+// scenario's default parameters, and prints what the mini-project is
+// about side by side: which engines keep each scenario correct, and at
+// what cost in throughput and tail latency.
+//
+//	go run ./cmd/db-sim compare
+//	go run ./cmd/db-sim compare -scenarios counter,bank -engines 2pl,mvcc -v
+
+// anomalyMetrics are the scenario metrics counting correctness violations
+var anomalyMetrics = []string{"lost_updates", "lost_money", "inconsistent_reads", "phantom_reads", "violations", "non_linearizable", "lost_items", "duplicated_items"}
+
+// anomalies returns how many correctness violations result found: those
+// its scenario counts itself, and the corruption the database detected.
+// Scenarios that count none report the database's lost updates instead.
+func anomalies(result ScenarioResult) int {
+	n := result.Stats.DataCorruption
+	counted := false
+	for _, name := range anomalyMetrics {
+		if value, found := result.Metrics[name]; found {
+			n += int(math.Abs(value))
+			counted = true
+		}
+	}
+	if !counted {
+		n += result.Stats.LostUpdates
+	}
+	return n
+}
+
+// TakesEngine reports whether the command has an -engine flag
+func (c Command) TakesEngine() bool {
+	fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	c.define(fs)
+	return fs.Lookup("engine") != nil
+}
+
+// RunsOn reports whether the command's -engine flag accepts engine
+func (c Command) RunsOn(engine string) bool {
+	fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	c.define(fs)
+	f := fs.Lookup("engine")
+	return f != nil && f.Value.Set(engine) == nil
+}
+
+// Compare runs each of the named scenarios, commands that take an -engine
+// flag, on each of engines through manifest, and prints the correctness and
+// performance matrices. Each run's own output is shown only if verbose is
+// set.
+func Compare(manifest *RunManifest, scenarioNames []string, engines []string, verbose bool) error {
+	var errs []error
+	for _, engine := range engines {
+		if _, err := db.OpenEngine(engine); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	var scenarios []Command
+	for _, name := range scenarioNames {
+		c, exists := FindCommand(name)
+		switch {
+		case !exists:
+			errs = append(errs, fmt.Errorf("%w %q", ErrUnknownCommand, name))
+		case !c.TakesEngine():
+			errs = append(errs, fmt.Errorf("scenario %q runs on no engine of your choosing", name))
+		default:
+			scenarios = append(scenarios, c)
+		}
+	}
+	if len(engines) == 0 || len(scenarios) == 0 {
+		errs = append(errs, fmt.Errorf("nothing to compare"))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("compare: %w", err)
+	}
+
+	fmt.Printf("Comparing %d engines on %d scenarios\n", len(engines), len(scenarios))
+	results := make(map[string]map[string]ScenarioResult, len(scenarios))
+	for _, c := range scenarios {
+		results[c.Name] = make(map[string]ScenarioResult, len(engines))
+		for _, engine := range engines {
+			if !c.RunsOn(engine) {
+				// An engine from outside only runs the scenarios that
+				// take any DB; its other cells stay empty
+				fmt.Printf("  %-18s on %-28s skipped: needs a built-in engine\n", c.Name, engine)
+				continue
+			}
+			scenario, err := c.scenario("-engine", engine)
+			if err != nil {
+				return err
+			}
+			var result ScenarioResult
+			withOutput(verbose, func() { result = manifest.Run(scenario) })
+			results[c.Name][engine] = result
+
+			outcome := "passed"
+			if !result.Passed {
+				outcome = "FAILED"
+			}
+			fmt.Printf("  %-18s on %-28s %s in %v\n", c.Name, engine, outcome, result.Duration.Round(time.Millisecond))
+		}
+	}
+
+	printCompareMatrix("Correctness: anomalies found (✓ where the scenario's check held, ✗ where it found anomalies, ? where it failed without finding any, such as a level the engine refused, – where it did not run)", scenarios, engines, results, func(r ScenarioResult) string {
+		n := anomalies(r)
+		mark := "✓"
+		switch {
+		case n > 0:
+			mark = "✗"
+		case !r.Passed:
+			mark = "?"
+		}
+		if r.Partial {
+			mark += "⏱"
+		}
+		return fmt.Sprintf("%s %d", mark, n)
+	})
+	printCompareMatrix("Aborts: transactions the engine aborted, which are not anomalies", scenarios, engines, results, func(r ScenarioResult) string {
+		return fmt.Sprint(r.Stats.Aborts)
+	})
+	printCompareMatrix("Throughput: transactions per second", scenarios, engines, results, func(r ScenarioResult) string {
+		return fmt.Sprintf("%.0f", newResultRow(manifest.StartedAt, 0, r).Throughput)
+	})
+	printCompareMatrix("Tail latency: p99 of the slowest operation", scenarios, engines, results, func(r ScenarioResult) string {
+		var p99 time.Duration
+		for _, h := range r.Stats.Latency {
+			p99 = max(p99, h.P99)
+		}
+		return roundLatency(p99).String()
+	})
+	return nil
+}
+
+// withOutput runs run, discarding what it prints unless show is set
+func withOutput(show bool, run func()) {
+	if show {
+		run()
+		return
+	}
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		run()
+		return
+	}
+	defer devNull.Close()
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+	run()
+}
+
+// printCompareMatrix prints a matrix of cell(result) with an engine per
+// row and a scenario per column
+func printCompareMatrix(title string, scenarios []Command, engines []string, results map[string]map[string]ScenarioResult, cell func(ScenarioResult) string) {
+	width := len("engine")
+	for _, engine := range engines {
+		width = max(width, len(engine))
+	}
+
+	fmt.Printf("\n=== %s ===\n", title)
+	fmt.Printf("%-*s", width, "engine")
+	for _, c := range scenarios {
+		fmt.Printf("  %*s", max(len(c.Name), 9), c.Name)
+	}
+	fmt.Println()
+	for _, engine := range engines {
+		fmt.Printf("%-*s", width, engine)
+		for _, c := range scenarios {
+			text := "–"
+			if result, ran := results[c.Name][engine]; ran {
+				text = cell(result)
+			}
+			fmt.Printf("  %*s", max(len(c.Name), 9), text)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,501 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// A workload file describes a run of simulated clients: the engine to run
+// them on, the keys they share and their starting values, and groups of
+// identical clients with their transaction counts, operation mixes, think
+// times and isolation level. It is YAML (.yaml, .yml) or JSON (.json):
+//
+//	name: hot-counters
+//	engine: 2pl
+//	lock_timeout: 20ms
+//	initial_values:
+//	  counter: 0
+//	keys: [counter]
+//	clients:
+//	  - count: 4
+//	    transactions: 100
+//	    operations_per_tx: 2
+//	    think_time: 100us
+//	    mix:
+//	      read: 1
+//	      update: 3
+//
+// The YAML reader (yaml.go) handles the block style above and flow lists,
+// but not flow mappings.
+//
+// go run ./cmd/db-sim -config workload.yaml runs it in place of the
+// built-in scenarios.
+
+// ClientGroup is a number of clients with the same behavior. Keys,
+// NumKeys, Distribution, Mix and Isolation left empty are taken from the
+// workload. Workload names a built-in workload (uniform, read-heavy,
+// write-heavy or transfer) over the keys in place of the mix.
+type ClientGroup struct {
+	Count           int             `json:"count"`
+	Transactions    int             `json:"transactions"` // Per client; 0 runs until the workload's duration is up
+	OperationsPerTx int             `json:"operations_per_tx"`
+	ThinkTime       db.Duration     `json:"think_time"`
+	TxTimeout       db.Duration     `json:"tx_timeout"`
+	Keys            []string        `json:"keys"`
+	NumKeys         int             `json:"num_keys"`
+	Distribution    KeyDistribution `json:"distribution"`
+	Mix             OperationMix    `json:"mix"`
+	Isolation       string          `json:"isolation"`
+	Workload        string          `json:"workload"`
+	RateLimit       float64         `json:"rate_limit"` // Per client, in transactions per second; 0 for no cap
+	Priority        int             `json:"priority"`   // Of its transactions under two-phase locking, higher more urgent
+	ValueSize       int             `json:"value_size"` // Payload bytes each write carries; 0 for the workload's
+}
+
+// WorkloadConfig is a workload file
+type WorkloadConfig struct {
+	Name           string               `json:"name"`
+	Engine         string               `json:"engine"`      // A registered engine, such as 2pl; see Engines
+	LockPolicy     string               `json:"lock_policy"` // For the synchronized engine: prefer-readers, prefer-writers or fair
+	Isolation      string               `json:"isolation"`   // Default for every group; empty for the engine's default
+	LockTimeout    db.Duration          `json:"lock_timeout"`
+	Stripes        int                  `json:"stripes"`    // Lock stripes of a locking engine; 0 for DefaultStripes
+	Duration       db.Duration          `json:"duration"`   // Stops the clients after this long; 0 to run until they are done
+	Warmup         db.Duration          `json:"warmup"`     // Runs before duration without being measured; needs a duration
+	Cooldown       db.Duration          `json:"cooldown"`   // Runs after duration without being measured; needs a duration
+	Seed           int64                `json:"seed"`       // Client i is seeded with Seed+i; 0 seeds from the clock
+	RateLimit      float64              `json:"rate_limit"` // Of all clients together, in transactions per second; 0 for no cap
+	UpsertOnUpdate bool                 `json:"upsert_on_update"`
+	InitialValues  map[string]int       `json:"initial_values"`
+	Keys           []string             `json:"keys"`              // Default for every group; empty for the built-in contended keys
+	NumKeys        int                  `json:"num_keys"`          // Without keys, operate on key_0 to key_<num_keys-1>
+	Distribution   KeyDistribution      `json:"distribution"`      // Default for every group: uniform, zipfian[:skew] or hotspot[:keys%/ops%]
+	Mix            OperationMix         `json:"mix"`               // Default for every group; zero for the built-in mix
+	ValueSize      int                  `json:"value_size"`        // Default for every group: payload bytes each write carries; 0 for integer values only
+	MaxKeys        int                  `json:"max_keys"`          // Live keys kept before the least recently used are evicted; 0 for no limit
+	MaxBytes       int                  `json:"max_bytes"`         // Estimated bytes of live records kept before the least recently used are evicted; 0 for no limit
+	Faults         db.FaultConfig       `json:"faults"`            // Injected delays, aborts and crashes; see faults.go
+	Processing     *db.ProcessingDelays `json:"processing_delays"` // Simulated processing time of each operation; nil for the defaults
+	Clients        []ClientGroup        `json:"clients"`
+}
+
+// LoadWorkloadConfig reads and validates the workload file at path. Unknown
+// fields are errors, so a misspelt setting is not silently ignored.
+func LoadWorkloadConfig(path string) (WorkloadConfig, error) {
+	var cfg WorkloadConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+	case ".yaml", ".yml":
+		value, err := parseYAML(data)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = json.Marshal(value); err != nil {
+			return cfg, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return cfg, fmt.Errorf("%s: workload files must end in .yaml, .yml or .json", path)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate reports every problem with the configuration
+func (cfg WorkloadConfig) Validate() error {
+	var errs []error
+	d, err := db.NewEngine(cfg.Engine, cfg.LockPolicy)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	reporter, _ := d.(db.Reporter) // Isolation levels are only checked against engines that report theirs
+	if cfg.Isolation != "" {
+		if level, err := db.ParseIsolationLevel(cfg.Isolation); err != nil {
+			errs = append(errs, err)
+		} else if reporter != nil {
+			if err := reporter.CheckIsolation(level); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if cfg.LockTimeout < 0 || cfg.Duration < 0 || cfg.Warmup < 0 || cfg.Cooldown < 0 {
+		errs = append(errs, fmt.Errorf("lock_timeout, duration, warmup and cooldown must not be negative"))
+	}
+	if cfg.RateLimit < 0 {
+		errs = append(errs, fmt.Errorf("rate_limit must not be negative"))
+	}
+	if (cfg.Warmup > 0 || cfg.Cooldown > 0) && cfg.Duration == 0 {
+		errs = append(errs, fmt.Errorf("warmup and cooldown need a duration to measure"))
+	}
+	if err := cfg.Mix.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cfg.Distribution.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.NumKeys < 0 {
+		errs = append(errs, fmt.Errorf("num_keys must not be negative"))
+	}
+	if cfg.Stripes < 0 {
+		errs = append(errs, fmt.Errorf("stripes must not be negative"))
+	}
+	if cfg.ValueSize < 0 {
+		errs = append(errs, fmt.Errorf("value_size must not be negative"))
+	}
+	if cfg.MaxKeys < 0 || cfg.MaxBytes < 0 {
+		errs = append(errs, fmt.Errorf("max_keys and max_bytes must not be negative"))
+	}
+	if cfg.Processing != nil {
+		if err := cfg.Processing.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := cfg.Faults.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(cfg.Clients) == 0 {
+		errs = append(errs, fmt.Errorf("no clients"))
+	}
+	for i, group := range cfg.Clients {
+		if group.Count <= 0 {
+			errs = append(errs, fmt.Errorf("clients[%d]: count must be positive", i))
+		}
+		if group.Transactions < 0 || (group.Transactions == 0 && cfg.Duration == 0) {
+			errs = append(errs, fmt.Errorf("clients[%d]: transactions must be positive unless the workload has a duration", i))
+		}
+		if group.OperationsPerTx <= 0 {
+			errs = append(errs, fmt.Errorf("clients[%d]: operations_per_tx must be positive", i))
+		}
+		if group.ThinkTime < 0 || group.TxTimeout < 0 || group.RateLimit < 0 {
+			errs = append(errs, fmt.Errorf("clients[%d]: think_time, tx_timeout and rate_limit must not be negative", i))
+		}
+		if err := group.Mix.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("clients[%d]: %w", i, err))
+		}
+		if err := group.Distribution.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("clients[%d]: %w", i, err))
+		}
+		if group.NumKeys < 0 || group.ValueSize < 0 {
+			errs = append(errs, fmt.Errorf("clients[%d]: num_keys and value_size must not be negative", i))
+		}
+		if group.Isolation != "" {
+			if level, err := db.ParseIsolationLevel(group.Isolation); err != nil {
+				errs = append(errs, fmt.Errorf("clients[%d]: %w", i, err))
+			} else if reporter != nil {
+				if err := reporter.CheckIsolation(level); err != nil {
+					errs = append(errs, fmt.Errorf("clients[%d]: %w", i, err))
+				}
+			}
+		}
+		if group.Workload != "" {
+			client := cfg.clientConfig(group, 0)
+			if _, err := builtinWorkload(group.Workload, clientKeys(client.Keys, client.NumKeys), client.Distribution); err != nil {
+				errs = append(errs, fmt.Errorf("clients[%d]: %w", i, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validate rejects negative weights
+func (m OperationMix) validate() error {
+	if m.Read < 0 || m.Write < 0 || m.Update < 0 || m.Delete < 0 {
+		return fmt.Errorf("mix weights must not be negative")
+	}
+	return nil
+}
+
+// NewDatabase returns a database of the configured engine with the
+// configured lock timeout, update behavior, capacity, processing delays
+// and faults, which are seeded with the workload's seed unless they have
+// their own. The initial values are written by the run, not here. An
+// engine that is not Configurable, or no FaultInjector, is only accepted
+// without the settings it cannot take.
+func (cfg WorkloadConfig) NewDatabase() (db.DB, error) {
+	d, err := db.NewEngine(cfg.Engine, cfg.LockPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := d.(db.Configurable); ok {
+		if cfg.LockTimeout > 0 {
+			c.SetLockTimeout(time.Duration(cfg.LockTimeout))
+		}
+		if cfg.Stripes > 0 {
+			c.SetStripes(cfg.Stripes)
+		}
+		c.SetUpsertOnUpdate(cfg.UpsertOnUpdate)
+		c.SetCapacity(db.Capacity{Keys: cfg.MaxKeys, Bytes: cfg.MaxBytes})
+		if cfg.Processing != nil {
+			delays := *cfg.Processing
+			if delays.Seed == 0 {
+				delays.Seed = cfg.Seed
+			}
+			if err := c.SetProcessingDelays(delays); err != nil {
+				return nil, err
+			}
+		}
+	} else if cfg.LockTimeout > 0 || cfg.Stripes > 0 || cfg.UpsertOnUpdate || cfg.MaxKeys > 0 || cfg.MaxBytes > 0 || cfg.Processing != nil {
+		return nil, fmt.Errorf("engine %s takes no lock_timeout, stripes, upsert_on_update, max_keys, max_bytes or processing", engineName(d))
+	}
+	faults := cfg.Faults
+	if faults.Seed == 0 {
+		faults.Seed = cfg.Seed
+	}
+	if f, ok := d.(db.FaultInjector); ok {
+		if err := f.SetFaults(faults); err != nil {
+			return nil, err
+		}
+	} else if faults.Enabled() {
+		return nil, fmt.Errorf("engine %s injects no faults", engineName(d))
+	}
+	return d, nil
+}
+
+// ClientConfigs expands the client groups into one configuration per
+// client, with IDs from 1 in group order
+func (cfg WorkloadConfig) ClientConfigs() []ClientConfig {
+	var clients []ClientConfig
+	for _, group := range cfg.Clients {
+		for i := 0; i < group.Count; i++ {
+			clients = append(clients, cfg.clientConfig(group, len(clients)+1))
+		}
+	}
+	return clients
+}
+
+// clientConfig returns the configuration of client id of group
+func (cfg WorkloadConfig) clientConfig(group ClientGroup, id int) ClientConfig {
+	client := ClientConfig{
+		ID:              id,
+		NumTransactions: group.Transactions,
+		OperationsPerTx: group.OperationsPerTx,
+		ThinkTime:       time.Duration(group.ThinkTime),
+		TxTimeout:       time.Duration(group.TxTimeout),
+		Keys:            group.Keys,
+		NumKeys:         group.NumKeys,
+		Distribution:    group.Distribution,
+		Mix:             group.Mix,
+		Isolation:       group.Isolation,
+		RateLimit:       group.RateLimit,
+		Priority:        group.Priority,
+		ValueSize:       group.ValueSize,
+	}
+	if len(client.Keys) == 0 && client.NumKeys == 0 {
+		client.Keys, client.NumKeys = cfg.Keys, cfg.NumKeys
+	}
+	if client.Distribution.Kind == "" {
+		client.Distribution = cfg.Distribution
+	}
+	if client.Mix.total() == 0 {
+		client.Mix = cfg.Mix
+	}
+	if client.ValueSize == 0 {
+		client.ValueSize = cfg.ValueSize
+	}
+	if client.Isolation == "" {
+		client.Isolation = cfg.Isolation
+	}
+	if group.Workload != "" {
+		// Checked by Validate
+		client.Workload, _ = builtinWorkload(group.Workload, clientKeys(client.Keys, client.NumKeys), client.Distribution)
+	}
+	if cfg.Seed != 0 {
+		client.Seed = cfg.Seed + int64(id)
+	}
+	return client
+}
+
+// GeneralWorkload is the workload of the general scenario: eight clients
+// of 50 three-operation transactions each over the built-in keys
+func GeneralWorkload() WorkloadConfig {
+	return WorkloadConfig{
+		Name: "general",
+		InitialValues: map[string]int{
+			"account_1": 500, "account_2": 500, "account_3": 500, "counter": 0, "balance": 1000,
+		},
+		// Random deletes would otherwise make every later update of that key fail
+		UpsertOnUpdate: true,
+		Clients: []ClientGroup{
+			{Count: 8, Transactions: 50, OperationsPerTx: 3, ThinkTime: db.Duration(100 * time.Microsecond)},
+		},
+	}
+}
+
+// runGeneralWorkload runs the general scenario with workload, a variation
+// of GeneralWorkload
+func runGeneralWorkload(ctx context.Context, d *db.Database, workload WorkloadConfig) ScenarioResult {
+	result := newScenarioResult("general", d, map[string]any{
+		"clients": 8, "distribution": workload.Distribution.String(),
+		"duration": workload.Duration, "warmup": workload.Warmup, "cooldown": workload.Cooldown,
+	})
+
+	fmt.Println("\n=== General Concurrent Operations Scenario ===")
+	fmt.Printf("Running 8 clients with mixed operations\n")
+
+	d.SetUpsertOnUpdate(workload.UpsertOnUpdate)
+	completed := runWorkload(ctx, d, workload, workload.ClientConfigs(), &result)
+
+	// Display final state
+	fmt.Println("\nFinal database state:")
+	d.PrintRecords()
+	d.PrintStats()
+
+	fmt.Println("\n⚠️  Note: If you see inconsistent data or the program crashes,")
+	fmt.Println("    that's expected! This demonstrates why synchronization is needed.")
+
+	// The general workload has no invariant to check beyond not crashing
+	result.Passed = true
+	result.Metrics["transactions"] = float64(completed)
+	return result.finish(d)
+}
+
+// RunWorkloadScenario runs the workload cfg describes on d, which should
+// come from cfg.NewDatabase
+func RunWorkloadScenario(ctx context.Context, d db.DB, cfg WorkloadConfig) ScenarioResult {
+	name := cfg.Name
+	if name == "" {
+		name = "workload"
+	}
+	clients := cfg.ClientConfigs()
+	result := newScenarioResult(name, d, map[string]any{
+		"clients": len(clients), "engine": engineName(d), "duration": cfg.Duration,
+		"warmup": cfg.Warmup, "cooldown": cfg.Cooldown,
+	})
+
+	fmt.Printf("\n=== Workload: %s ===\n", name)
+	fmt.Printf("Running %d clients on the %s engine\n", len(clients), engineName(d))
+
+	completed := runWorkload(ctx, d, cfg, clients, &result)
+	if f, ok := d.(db.FaultInjector); ok {
+		if faults, counts := f.Faults(); faults.Enabled() {
+			fmt.Printf("Injected %v (fault seed %d)\n", counts, faults.Seed)
+			result.Metrics["injected_delays"] = float64(counts.Delays)
+			result.Metrics["injected_aborts"] = float64(counts.Aborts)
+			result.Metrics["client_crashes"] = float64(counts.ClientCrashes)
+			result.Metrics["database_crashes"] = float64(counts.Crashes)
+		}
+	}
+
+	if r, ok := d.(db.Reporter); ok {
+		fmt.Println("\nFinal database state:")
+		r.PrintRecords()
+		r.PrintStats()
+	}
+
+	// A configured workload has no invariant to check beyond not crashing
+	result.Passed = true
+	result.Metrics["transactions"] = float64(completed)
+	return result.finish(d)
+}
+
+// Phases returns the phases of a timed workload: its warm-up, its
+// duration, measured, and its cool-down
+func (cfg WorkloadConfig) Phases() Phases {
+	return Phases{Warmup: time.Duration(cfg.Warmup), Measure: time.Duration(cfg.Duration), Cooldown: time.Duration(cfg.Cooldown)}
+}
+
+// runWorkload writes cfg's initial values, runs clients to completion, to
+// the end of cfg's phases or until ctx is cancelled, and returns how many
+// transactions they finished. It marks result partial if ctx cut it short.
+// With a warm-up or cool-down, result reports only the measured phase, and
+// its throughput. Clients without a Limiter share one capping them at
+// cfg.RateLimit.
+func runWorkload(ctx context.Context, d db.DB, cfg WorkloadConfig, clients []ClientConfig, result *ScenarioResult) int {
+	if len(cfg.InitialValues) > 0 {
+		keys := make([]string, 0, len(cfg.InitialValues))
+		for key := range cfg.InitialValues {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		initial := make([]string, len(keys))
+		for i, key := range keys {
+			initial[i] = fmt.Sprintf("%s=%d", key, cfg.InitialValues[key])
+		}
+		bulkLoad(d, cfg.InitialValues)
+		fmt.Printf("Initial state: %s\n", strings.Join(initial, ", "))
+	}
+
+	// The duration ends the run as planned, unlike ctx, whose expiry makes
+	// the result partial
+	phases := cfg.Phases()
+	runCtx := ctx
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, phases.Total())
+		defer cancel()
+	}
+
+	// The clients share one bucket for the workload's cap
+	var limiter *db.TokenBucket
+	if cfg.RateLimit > 0 {
+		limiter = db.NewTokenBucketWithClock(cfg.RateLimit, 1, clockOf(d))
+	}
+
+	var wg sync.WaitGroup
+	running := make([]*Client, 0, len(clients))
+	planned := 0
+	for _, config := range clients {
+		if config.Limiter == nil {
+			config.Limiter = limiter
+		}
+		wg.Add(1)
+		client := NewClient(config, d)
+		running = append(running, client)
+		result.Clients = append(result.Clients, client.Config())
+		planned += config.NumTransactions
+		go client.Run(runCtx, &wg)
+	}
+	if phases.phased() {
+		fmt.Printf("Phases: %v\n", phases)
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		phases.track(d, result, done)
+		<-done
+
+		measured := result.measured.Since(*result.baseline)
+		finished := measured.Commits + measured.Aborts
+		result.Metrics["measured_transactions"] = float64(finished)
+		result.Metrics["throughput"] = float64(finished) / phases.Measure.Seconds()
+		fmt.Printf("Measured %d transactions (%d committed, %d aborted): %.0f tx/s\n",
+			finished, measured.Commits, measured.Aborts, result.Metrics["throughput"])
+	} else {
+		wg.Wait()
+	}
+	if f, ok := d.(db.FaultInjector); ok {
+		f.AwaitAbandoned()
+	}
+
+	completed := 0
+	for _, client := range running {
+		completed += client.Completed()
+	}
+	result.Partial = reportPartial(ctx, completed, planned, "transactions")
+	return completed
+}
@@ -0,0 +1,225 @@
+package sim
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// writeWorkload writes a workload file named name into a temporary
+// directory and returns its path
+func writeWorkload(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestLoadWorkloadConfigYAMLAndJSON verifies the same workload reads the
+// same from YAML and JSON, and expands into per-client configurations
+func TestLoadWorkloadConfigYAMLAndJSON(t *testing.T) {
+	yamlPath := writeWorkload(t, "w.yaml", `
+engine: mvcc
+isolation: Serializable
+seed: 10
+duration: 2s
+initial_values:
+  counter: 5
+keys: [counter]
+mix:
+  update: 1
+clients:
+  - count: 2
+    transactions: 3
+    operations_per_tx: 2
+    think_time: 100us
+  - count: 1
+    transactions: 0
+    operations_per_tx: 1
+    isolation: ReadCommitted
+    mix:
+      read: 1
+`)
+	jsonPath := writeWorkload(t, "w.json", `{
+  "engine": "mvcc", "isolation": "Serializable", "seed": 10, "duration": "2s",
+  "initial_values": {"counter": 5}, "keys": ["counter"], "mix": {"update": 1},
+  "clients": [
+    {"count": 2, "transactions": 3, "operations_per_tx": 2, "think_time": 100000},
+    {"count": 1, "transactions": 0, "operations_per_tx": 1, "isolation": "ReadCommitted", "mix": {"read": 1}}
+  ]
+}`)
+
+	fromYAML, err := LoadWorkloadConfig(yamlPath)
+	if err != nil {
+		t.Fatalf("loading YAML: %v", err)
+	}
+	fromJSON, err := LoadWorkloadConfig(jsonPath)
+	if err != nil {
+		t.Fatalf("loading JSON: %v", err)
+	}
+
+	clients := fromYAML.ClientConfigs()
+	if got := fromJSON.ClientConfigs(); len(got) != len(clients) {
+		t.Fatalf("JSON expands to %d clients, YAML to %d", len(got), len(clients))
+	}
+	if len(clients) != 3 {
+		t.Fatalf("expanded to %d clients, expected 3", len(clients))
+	}
+	first, reader := clients[0], clients[2]
+	if first.ID != 1 || first.Seed != 11 || first.ThinkTime != 100*time.Microsecond ||
+		first.Isolation != "Serializable" || first.Mix.Update != 1 || first.Keys[0] != "counter" {
+		t.Errorf("first client = %+v, expected the workload's defaults", first)
+	}
+	if reader.ID != 3 || reader.Isolation != "ReadCommitted" || reader.Mix != (OperationMix{Read: 1}) {
+		t.Errorf("reader client = %+v, expected its group's overrides", reader)
+	}
+	if fromJSON.ClientConfigs()[0].ThinkTime != first.ThinkTime {
+		t.Errorf("a number of nanoseconds and \"100us\" differ")
+	}
+}
+
+// TestLoadWorkloadConfigRejectsMistakes verifies unknown fields, unknown
+// names and impossible values are errors rather than silently ignored
+func TestLoadWorkloadConfigRejectsMistakes(t *testing.T) {
+	cases := map[string]string{
+		"misspelt field":       "engine: 2pl\nclient:\n  - count: 1\n",
+		"unknown engine":       "engine: btree\nclients:\n  - count: 1\n    transactions: 1\n    operations_per_tx: 1\n",
+		"unknown isolation":    "isolation: Snapshot\nclients:\n  - count: 1\n    transactions: 1\n    operations_per_tx: 1\n",
+		"isolation too strong": "engine: tso\nisolation: Serializable\nclients:\n  - count: 1\n    transactions: 1\n    operations_per_tx: 1\n",
+		"no clients":           "engine: 2pl\n",
+		"unbounded clients":    "clients:\n  - count: 1\n    operations_per_tx: 1\n",
+		"negative weight":      "clients:\n  - count: 1\n    transactions: 1\n    operations_per_tx: 1\n    mix:\n      read: -1\n",
+		"unknown workload":     "clients:\n  - count: 1\n    transactions: 1\n    operations_per_tx: 1\n    workload: zipf\n",
+		"malformed duration":   "lock_timeout: soon\nclients:\n  - count: 1\n    transactions: 1\n    operations_per_tx: 1\n",
+		"warmup unmeasured":    "warmup: 1s\nclients:\n  - count: 1\n    transactions: 1\n    operations_per_tx: 1\n",
+		"negative rate":        "clients:\n  - count: 1\n    transactions: 1\n    operations_per_tx: 1\n    rate_limit: -5\n",
+		"fault probability":    "faults:\n  abort_probability: 1.5\nclients:\n  - count: 1\n    transactions: 1\n    operations_per_tx: 1\n",
+		"unknown crash point":  "faults:\n  crash_at_commit: 3\n  crash_point: never\nclients:\n  - count: 1\n    transactions: 1\n    operations_per_tx: 1\n",
+	}
+	for name, content := range cases {
+		if _, err := LoadWorkloadConfig(writeWorkload(t, "w.yml", content)); err == nil {
+			t.Errorf("%s: loaded without error", name)
+		}
+	}
+	if _, err := LoadWorkloadConfig(writeWorkload(t, "w.toml", "")); err == nil {
+		t.Error("a .toml file loaded without error")
+	}
+}
+
+// TestExampleWorkload verifies the workload shipped at the root of the
+// repository loads
+func TestExampleWorkload(t *testing.T) {
+	cfg, err := LoadWorkloadConfig(filepath.Join("..", "..", "workload.yaml"))
+	if err != nil {
+		t.Fatalf("loading workload.yaml: %v", err)
+	}
+	if _, err := cfg.NewDatabase(); err != nil {
+		t.Fatalf("creating its database: %v", err)
+	}
+}
+
+// TestRunWorkloadScenario verifies a configured workload runs on the
+// configured engine and keeps to its keys and operation mix
+func TestRunWorkloadScenario(t *testing.T) {
+	cfg := WorkloadConfig{
+		Name:          "test-workload",
+		Engine:        "2pl",
+		LockTimeout:   db.Duration(time.Second),
+		Seed:          1,
+		InitialValues: map[string]int{"hits": 0},
+		Keys:          []string{"hits"},
+		Mix:           OperationMix{Update: 1},
+		Clients:       []ClientGroup{{Count: 3, Transactions: 10, OperationsPerTx: 1}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	d, err := cfg.NewDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := RunWorkloadScenario(context.Background(), d, cfg)
+	if result.Name != "test-workload" || !result.Passed || result.Partial {
+		t.Errorf("result = %+v, expected a passing, complete run", result)
+	}
+	if result.Metrics["transactions"] != 30 {
+		t.Errorf("ran %v transactions, expected 30", result.Metrics["transactions"])
+	}
+	if len(result.Clients) != 3 || result.Clients[2].Seed != 4 {
+		t.Errorf("clients = %+v, expected three seeded from 2", result.Clients)
+	}
+
+	if stats := d.Stats(); stats.TotalUpdates != 30 || stats.TotalReads != 0 {
+		t.Errorf("%d updates and %d reads, expected the mix's 30 updates only", stats.TotalUpdates, stats.TotalReads)
+	}
+
+	tx := begin(d)
+	defer d.Abort(tx)
+	records, err := d.(*db.Database).ScanPrefix(tx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := records["hits"]; len(records) != 1 || !exists {
+		t.Errorf("records = %v, expected the one configured key", records)
+	}
+}
+
+// TestRunWorkloadDuration verifies a workload with a duration and no
+// transaction count stops on time without being reported as partial
+func TestRunWorkloadDuration(t *testing.T) {
+	cfg := WorkloadConfig{
+		Engine:   "synchronized",
+		Duration: db.Duration(50 * time.Millisecond),
+		Clients:  []ClientGroup{{Count: 2, OperationsPerTx: 2, ThinkTime: db.Duration(time.Millisecond)}},
+	}
+	d, err := cfg.NewDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	result := RunWorkloadScenario(context.Background(), d, cfg)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ran for %v, expected about 50ms", elapsed)
+	}
+	if result.Partial || result.Metrics["transactions"] == 0 {
+		t.Errorf("result = %+v, expected a complete run with transactions", result)
+	}
+}
+
+// TestRunWorkloadPhases verifies a workload's warm-up and cool-down run
+// but are left out of its statistics
+func TestRunWorkloadPhases(t *testing.T) {
+	cfg := WorkloadConfig{
+		Engine:   "synchronized",
+		Warmup:   db.Duration(100 * time.Millisecond),
+		Duration: db.Duration(100 * time.Millisecond),
+		Cooldown: db.Duration(100 * time.Millisecond),
+		Clients:  []ClientGroup{{Count: 2, OperationsPerTx: 2, ThinkTime: db.Duration(time.Millisecond)}},
+	}
+	d, err := cfg.NewDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := RunWorkloadScenario(context.Background(), d, cfg)
+
+	measured := result.Metrics["measured_transactions"]
+	if measured == 0 || measured >= result.Metrics["transactions"] {
+		t.Errorf("measured %v of %v transactions, expected some but not all", measured, result.Metrics["transactions"])
+	}
+	if got := float64(result.Stats.Commits + result.Stats.Aborts); got != measured {
+		t.Errorf("statistics count %v transactions, expected the %v measured", got, measured)
+	}
+	if all := d.Stats(); all.Commits+all.Aborts <= result.Stats.Commits+result.Stats.Aborts {
+		t.Errorf("the warm-up and cool-down finished no transactions")
+	}
+	if result.Metrics["throughput"] <= 0 {
+		t.Errorf("throughput = %v", result.Metrics["throughput"])
+	}
+}
@@ -0,0 +1,138 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunConvoyScenario runs numShort clients of short one-key transactions
+// for duration on a two-phase locking database with the given lock
+// granularity, while a slow transaction holding a lock for slowWork starts
+// every interval. It samples how many transactions wait for locks every
+// millisecond. Under a database lock each slow transaction forms a
+// convoy: every short transaction queues behind it, and the queue drains
+// one transaction at a time after it. With per-key locks the short
+// transactions, on other keys, never queue. It passes if no more than
+// half the short transactions were ever queued at once.
+func RunConvoyScenario(ctx context.Context, granularity db.LockGranularity, numShort int, duration time.Duration) ScenarioResult {
+	const (
+		slowWork = 20 * time.Millisecond
+		interval = 50 * time.Millisecond
+		sample   = time.Millisecond
+		bucket   = 10 * time.Millisecond // Samples per printed queue length
+	)
+
+	d := db.NewTwoPhaseLockingDatabase()
+	d.SetLockGranularity(granularity)
+	result := newScenarioResult("convoy", d, map[string]any{
+		"granularity": granularity.String(),
+		"short":       numShort,
+		"duration":    duration.String(),
+	})
+
+	fmt.Printf("\n=== Lock Convoy Scenario (%s) ===\n", granularity)
+	fmt.Printf("%d clients of one-key transactions for %v; every %v a transaction holds its lock for %v\n",
+		numShort, duration, interval, slowWork)
+
+	start := time.Now()
+	runCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	var wg sync.WaitGroup
+	var slowRuns atomic.Int64
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ctx := db.WithClient(runCtx, numShort+1)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for runCtx.Err() == nil {
+			tx := d.BeginTransactionCtx(ctx)
+			d.Write(tx, "report", int(slowRuns.Add(1)))
+			time.Sleep(slowWork) // Simulate the transaction's work
+			d.Commit(tx)
+			select {
+			case <-ticker.C:
+			case <-runCtx.Done():
+			}
+		}
+	}()
+
+	for i := 1; i <= numShort; i++ {
+		wg.Add(1)
+		go func(ctx context.Context, key string) {
+			defer wg.Done()
+			for runCtx.Err() == nil {
+				tx := d.BeginTransactionCtx(ctx)
+				d.UpdateOrInsert(tx, key, 1, 0)
+				d.Commit(tx)
+				time.Sleep(time.Millisecond)
+			}
+		}(db.WithClient(runCtx, i), fmt.Sprintf("short_%d", i))
+	}
+
+	// Sample the lock queue until the clients are done
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	var samples []int
+	ticker := time.NewTicker(sample)
+	for sampling := true; sampling; {
+		select {
+		case <-ticker.C:
+			samples = append(samples, d.LockManager().Waiting())
+		case <-done:
+			sampling = false
+		}
+	}
+	ticker.Stop()
+	result.Partial = reportPartial(ctx, int(time.Since(start).Milliseconds()), int(duration.Milliseconds()), "milliseconds")
+
+	var shortLatency db.LatencyHistogram
+	for _, c := range d.ClientStats() {
+		if c.Client <= numShort {
+			shortLatency = shortLatency.Merge(c.Latency)
+		}
+	}
+	maxQueue, total := 0, 0
+	for _, n := range samples {
+		maxQueue = max(maxQueue, n)
+		total += n
+	}
+	meanQueue := float64(total) / float64(max(len(samples), 1))
+
+	perBucket := int(bucket / sample)
+	var series []string
+	for i := 0; i < len(samples); i += perBucket {
+		longest := 0
+		for _, n := range samples[i:min(i+perBucket, len(samples))] {
+			longest = max(longest, n)
+		}
+		series = append(series, fmt.Sprint(longest))
+	}
+	fmt.Printf("\nLock queue length over time (longest per %v): %s\n", bucket, strings.Join(series, " "))
+	fmt.Printf("Queue length: mean %.1f, max %d; %d slow transactions\n", meanQueue, maxQueue, slowRuns.Load())
+	fmt.Printf("Short transactions: %d, latency p50 %v, p99 %v\n", shortLatency.Count,
+		roundLatency(shortLatency.P50), roundLatency(shortLatency.P99))
+
+	result.Passed = maxQueue <= numShort/2
+	if result.Passed {
+		fmt.Println("✓ No convoy: the short transactions did not queue behind the slow one")
+	} else {
+		fmt.Printf("❌ LOCK CONVOY: up to %d of %d short transactions queued behind the slow one\n", maxQueue, numShort)
+	}
+	result.Metrics["mean_queue"] = meanQueue
+	result.Metrics["max_queue"] = float64(maxQueue)
+	result.Metrics["short_p50_us"] = microseconds(shortLatency.P50)
+	result.Metrics["short_p99_us"] = microseconds(shortLatency.P99)
+	result.Metrics["throughput"] = float64(shortLatency.Count) / duration.Seconds()
+	return result.finish(d)
+}
@@ -0,0 +1,23 @@
+package sim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestConvoyScenario verifies short transactions queue behind the slow one
+// under a database lock and not with per-key locks
+func TestConvoyScenario(t *testing.T) {
+	noLeaks(t)
+	coarse := RunConvoyScenario(context.Background(), db.DatabaseLock, 4, 120*time.Millisecond)
+	fine := RunConvoyScenario(context.Background(), db.KeyLocks, 4, 120*time.Millisecond)
+	if coarse.Passed || coarse.Metrics["max_queue"] == 0 {
+		t.Errorf("no convoy under a database lock: %+v", coarse.Metrics)
+	}
+	if !fine.Passed || fine.Metrics["max_queue"] != 0 {
+		t.Errorf("transactions queued with per-key locks: %+v", fine.Metrics)
+	}
+}
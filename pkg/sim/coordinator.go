@@ -0,0 +1,147 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunTwoPhaseCommitScenario has clients transfer money between accounts
+// on different shards while the coordinator is made to fail: a
+// participant votes no, or the coordinator crashes before deciding, after
+// deciding, or halfway through telling the shards to commit. A recovery
+// process finishes the transactions left in doubt. However each transfer
+// ended, it must have happened on both shards or on neither, so the total
+// across all shards never changes.
+func RunTwoPhaseCommitScenario(ctx context.Context, seed int64, numClients int, transfersPerClient int) ScenarioResult {
+	const numShards, accounts, initialBalance = 4, 16, 1000
+	sharded := db.NewShardedDatabase(numShards, db.NewTwoPhaseLockingDatabase)
+	for i := 0; i < numShards; i++ {
+		sharded.Shard(i).SetLockTimeout(10 * time.Millisecond)
+	}
+	coordinator := sharded.Coordinator()
+
+	result := newScenarioResult("two_phase_commit", sharded.Shard(0), map[string]any{
+		"shards":               numShards,
+		"clients":              numClients,
+		"transfers_per_client": transfersPerClient,
+	})
+	result.Seed = seed
+
+	fmt.Println("\n=== Two-Phase Commit Scenario (coordinator failures) ===")
+	fmt.Printf("Running %d clients with %d cross-shard transfers each over %d shards; the coordinator keeps failing\n",
+		numClients, transfersPerClient, numShards)
+
+	keys := make([]string, accounts)
+	setup := sharded.Begin()
+	for i := range keys {
+		keys[i] = fmt.Sprintf("account_%d", i)
+		sharded.Put(setup, keys[i], initialBalance)
+	}
+	if err := sharded.Commit(setup); err != nil {
+		fmt.Printf("❌ Setup failed: %v\n", err)
+		return result.finish(sharded.Shard(0))
+	}
+
+	stopRecovery := coordinator.StartRecovery(ctx, time.Millisecond)
+
+	// The fault injector arms a failpoint for every few two-phase commits
+	failpoints := []db.Failpoint{db.VoteNo, db.CrashBeforeDecision, db.CrashAfterDecision, db.CrashMidCommit}
+	injecting := make(chan struct{})
+	injected := make(map[db.Failpoint]int)
+	var injector sync.WaitGroup
+	injector.Add(1)
+	go func() {
+		defer injector.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-injecting:
+				return
+			case <-time.After(2 * time.Millisecond):
+			}
+			failpoint := failpoints[i%len(failpoints)]
+			coordinator.SetFailpoint(failpoint)
+			injected[failpoint]++
+		}
+	}()
+
+	var completed, failed, inDoubt atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < numClients; i++ {
+		wg.Add(1)
+		go func(client int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed + int64(client)))
+			for j := 0; j < transfersPerClient && ctx.Err() == nil; j++ {
+				from, to := keys[rng.Intn(accounts)], keys[rng.Intn(accounts)]
+				for sharded.ShardFor(from) == sharded.ShardFor(to) {
+					to = keys[rng.Intn(accounts)]
+				}
+				amount := 1 + rng.Intn(20)
+				err := sharded.RunTransactionCtx(ctx, func(tx *db.ShardedTransaction) error {
+					if err := sharded.Add(tx, from, -amount); err != nil {
+						return err
+					}
+					return sharded.Add(tx, to, amount)
+				})
+				switch {
+				case err == nil:
+					completed.Add(1)
+				case errors.Is(err, db.ErrInDoubt):
+					inDoubt.Add(1)
+				default:
+					failed.Add(1)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(injecting)
+	injector.Wait()
+	// A failpoint armed after the last transfer would fire on the check
+	// below
+	coordinator.SetFailpoint(db.NoFailure)
+	stopRecovery()
+
+	done := int(completed.Load() + failed.Load() + inDoubt.Load())
+	result.Partial = reportPartial(ctx, done, numClients*transfersPerClient, "transfers")
+
+	total := 0
+	check := sharded.Begin()
+	for _, key := range keys {
+		balance, _ := sharded.Get(check, key)
+		total += balance
+	}
+	sharded.Commit(check)
+
+	stats := coordinator.Stats()
+	fmt.Printf("Transfers: %d committed, %d failed, %d left in doubt by a coordinator crash\n",
+		completed.Load(), failed.Load(), inDoubt.Load())
+	fmt.Printf("Failpoints armed: %d vote-no, %d crash-before-decision, %d crash-after-decision, %d crash-mid-commit\n",
+		injected[db.VoteNo], injected[db.CrashBeforeDecision], injected[db.CrashAfterDecision], injected[db.CrashMidCommit])
+	fmt.Printf("Recovery committed %d and aborted %d in-doubt transactions (%d still in doubt)\n",
+		stats.RecoveredCommits, stats.RecoveredAborts, coordinator.InDoubt())
+	fmt.Printf("Total across shards: %d (expected %d)\n", total, accounts*initialBalance)
+
+	preserved := total == accounts*initialBalance && coordinator.InDoubt() == 0
+	if preserved {
+		fmt.Printf("✓ Every transfer happened on both shards or neither, through every failure\n")
+	} else {
+		fmt.Printf("❌ A transfer was applied on only one shard: %d created or destroyed\n", total-accounts*initialBalance)
+	}
+
+	result.Passed = preserved
+	result.Metrics["committed_transfers"] = float64(completed.Load())
+	result.Metrics["failed_transfers"] = float64(failed.Load())
+	result.Metrics["in_doubt_transfers"] = float64(inDoubt.Load())
+	result.Metrics["recovered_commits"] = float64(stats.RecoveredCommits)
+	result.Metrics["recovered_aborts"] = float64(stats.RecoveredAborts)
+	result.Metrics["total"] = float64(total)
+	return result.finish(sharded.Shard(0))
+}
@@ -0,0 +1,15 @@
+package sim
+
+import (
+	"context"
+	"testing"
+)
+
+// TestTwoPhaseCommitScenario runs the scenario on a small workload
+func TestTwoPhaseCommitScenario(t *testing.T) {
+	noLeaks(t)
+	result := RunTwoPhaseCommitScenario(context.Background(), 1, 4, 50)
+	if !result.Passed {
+		t.Errorf("Expected every transfer on both shards or neither: %+v", result.Metrics)
+	}
+}
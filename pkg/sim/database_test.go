@@ -0,0 +1,67 @@
+package sim
+
+import (
+	"math/rand"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// ============================================================================
+// BENCHMARK TESTS
+// These benchmarks measure performance of the database operations.
+// Run with: go test -bench=. -benchmem
+// ============================================================================
+
+// benchmarkEngines runs benchmark on a new database of every registered
+// engine, as a sub-benchmark named after it. The databases have no
+// processing delays, keep no operation logs and reuse their transactions,
+// so what is measured is the engines' own overhead.
+// The unsynchronized engine is left out: its maps are not safe for
+// parallel use.
+func benchmarkEngines(b *testing.B, benchmark func(b *testing.B, d *db.Database)) {
+	for _, engine := range db.EngineVariants() {
+		if engine == "unsynchronized" {
+			continue
+		}
+		b.Run(engine, func(b *testing.B) {
+			d, err := db.OpenDatabase(engine)
+			if err != nil {
+				b.Fatal(err)
+			}
+			d.SetProcessingDelays(db.NoProcessingDelays)
+			d.SetOpLogLimit(0)
+			d.SetTransactionPooling(true)
+			b.ReportAllocs()
+			benchmark(b, d)
+		})
+	}
+}
+
+// BenchmarkMatrix benchmarks every engine on a corner of the bench
+// command's matrix: few and many goroutines, one hot key to many keys,
+// and write-only, read-mostly and read-only transactions. The
+// sub-benchmarks are named as in g=16/keys=100/reads=90/mvcc; run
+// "go run ./cmd/db-sim bench" for the whole matrix as CSV.
+func BenchmarkMatrix(b *testing.B) {
+	for _, cell := range BenchCells([]int{1, 16}, []int{1, 100, 10000}, []int{0, 90, 100}) {
+		b.Run(cell.String(), func(b *testing.B) {
+			benchmarkEngines(b, func(b *testing.B, d *db.Database) {
+				d.BulkLoad(benchmarkKeys(cell.Keys))
+				keys := numberedKeys(cell.Keys)
+				var seed atomic.Int64
+				b.SetParallelism(max(1, cell.Goroutines/runtime.GOMAXPROCS(0)))
+
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					rng := rand.New(rand.NewSource(seed.Add(1)))
+					for pb.Next() {
+						benchTransaction(d, keys, cell.ReadPercent, rng)
+					}
+				})
+			})
+		})
+	}
+}
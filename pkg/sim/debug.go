@@ -0,0 +1,51 @@
+package sim
+
+import (
+	"sync"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// The database the current scenario runs on is watched, so a debug
+// endpoint such as cmd/db-sim's -debug-addr can report its live counters
+// while the scenario runs.
+
+// debugTarget is the watched database
+var debugTarget struct {
+	mu       sync.Mutex
+	scenario string
+	db       db.DB
+}
+
+// watchDatabase makes d, running scenario, the watched database
+func watchDatabase(scenario string, d db.DB) {
+	debugTarget.mu.Lock()
+	debugTarget.scenario, debugTarget.db = scenario, d
+	debugTarget.mu.Unlock()
+}
+
+// DatabaseVars returns the live counters of the watched database, for a
+// debug endpoint to publish; nil before any scenario has started
+func DatabaseVars() any {
+	debugTarget.mu.Lock()
+	scenario, d := debugTarget.scenario, debugTarget.db
+	debugTarget.mu.Unlock()
+	if d == nil {
+		return nil
+	}
+
+	vars := map[string]any{
+		"scenario": scenario,
+		"engine":   engineName(d),
+		"stats":    d.Stats(),
+	}
+	if r, ok := d.(db.Reporter); ok {
+		vars["clients"] = r.ClientStats()
+		vars["live_tx"] = len(r.LiveTransactions())
+		if keys, waits := r.LockContention(10); keys != nil {
+			vars["hottest_keys"] = keys
+			vars["longest_waits"] = waits
+		}
+	}
+	return vars
+}
@@ -0,0 +1,119 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// diffWorkloadOp is one increment in the replayed diff workload
+type diffWorkloadOp struct {
+	key   string
+	delta int
+}
+
+// RunSnapshotDiffScenario replays the same seeded increment workload on the
+// unsynchronized and the two-phase locking engine and diffs the outcomes.
+// Every key differs by the updates the unsynchronized engine lost; the
+// two-phase locking outcome is checked against the sum of the deltas.
+func RunSnapshotDiffScenario(ctx context.Context, seed int64, numClients int, opsPerClient int) ScenarioResult {
+	result := ScenarioResult{
+		Name:   "snapshot_diff",
+		Engine: "unsynchronized vs two-phase-locking",
+		Parameters: map[string]any{
+			"clients":        numClients,
+			"ops_per_client": opsPerClient,
+		},
+		Seed:      seed,
+		StartedAt: time.Now(),
+		Metrics:   make(map[string]float64),
+	}
+
+	fmt.Println("\n=== Snapshot Diff Scenario ===")
+	fmt.Printf("Replaying %d clients x %d increments (seed %d) on two engines\n", numClients, opsPerClient, seed)
+
+	keys := make([]string, 8)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("item_%d", i)
+	}
+	workload := make([][]diffWorkloadOp, numClients)
+	expected := make(map[string]int, len(keys))
+	for i := range workload {
+		rng := rand.New(rand.NewSource(seed + int64(i)))
+		for j := 0; j < opsPerClient; j++ {
+			op := diffWorkloadOp{key: keys[rng.Intn(len(keys))], delta: rng.Intn(10) + 1}
+			workload[i] = append(workload[i], op)
+			expected[op.key] += op.delta
+		}
+	}
+
+	replay := func(d *db.Database) (db.DBSnapshot, int) {
+		// Every key exists before the clients start, so the unsynchronized
+		// engine only races on values, never on the map itself
+		initial := make(map[string]int, len(keys))
+		for _, key := range keys {
+			initial[key] = 0
+		}
+		d.BulkLoad(initial)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		applied := 0
+		for _, ops := range workload {
+			wg.Add(1)
+			go func(ops []diffWorkloadOp) {
+				defer wg.Done()
+				for _, op := range ops {
+					if ctx.Err() != nil {
+						return
+					}
+					// Read-modify-write in the client, like the bank transfers
+					tx := d.BeginTransaction()
+					value, _ := d.Read(tx, op.key)
+					d.Write(tx, op.key, value+op.delta)
+					d.Commit(tx)
+					mu.Lock()
+					applied++
+					mu.Unlock()
+				}
+			}(ops)
+		}
+		wg.Wait()
+		return d.TakeSnapshot(), applied
+	}
+
+	unsync, _ := replay(db.NewUnsynchronizedDatabase())
+	locked, applied := replay(db.NewTwoPhaseLockingDatabase())
+	result.Partial = reportPartial(ctx, applied, numClients*opsPerClient, "increments")
+
+	fmt.Println()
+	diffs := db.DiffSnapshots(unsync, locked)
+	db.PrintDiff(os.Stdout, unsync, locked, diffs)
+
+	mismatches := 0
+	for _, key := range keys {
+		if entry := locked.Entries[key]; entry.Value != expected[key] {
+			mismatches++
+		}
+	}
+	if result.Partial {
+		// Cancelled clients skipped increments, so the sums cannot match
+		mismatches = 0
+	}
+	if mismatches > 0 {
+		fmt.Printf("❌ Two-phase locking outcome differs from the serial sum on %d keys\n", mismatches)
+	} else {
+		fmt.Println("✓ Two-phase locking outcome matches the serial sum of every key")
+	}
+
+	result.Passed = mismatches == 0
+	result.Metrics["differing_keys"] = float64(len(diffs))
+	result.Metrics["locked_mismatches"] = float64(mismatches)
+	result.Duration = time.Since(result.StartedAt)
+	return result
+}
@@ -0,0 +1,147 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// KeyDistribution decides how often each of a client's keys is picked,
+// and with it how skewed contention is. It is written as text, in flags
+// and workload files alike:
+//
+//	uniform        every key equally often (the default)
+//	zipfian:1.2    the i-th key in proportion to 1/(1+i)^1.2; the skew must be above 1
+//	hotspot:20/80  80% of operations on the first 20% of the keys
+//
+// "zipfian" alone has skew 1.1 and "hotspot" alone is 20/80.
+type KeyDistribution struct {
+	Kind    string  // "uniform", "zipfian" or "hotspot"; empty is uniform
+	S       float64 // Zipfian skew, above 1
+	HotKeys float64 // Hotspot: fraction of the keys that are hot
+	HotOps  float64 // Hotspot: fraction of the operations on hot keys
+}
+
+// Defaults of the zipfian and hotspot distributions
+const (
+	defaultZipfS   = 1.1
+	defaultHotKeys = 0.2
+	defaultHotOps  = 0.8
+)
+
+// ParseKeyDistribution parses a distribution written as String writes it
+func ParseKeyDistribution(text string) (KeyDistribution, error) {
+	kind, params, _ := strings.Cut(text, ":")
+	switch kind {
+	case "", "uniform":
+		if params != "" {
+			return KeyDistribution{}, fmt.Errorf("the uniform distribution takes no parameters")
+		}
+		return KeyDistribution{Kind: kind}, nil
+
+	case "zipfian":
+		d := KeyDistribution{Kind: kind, S: defaultZipfS}
+		if params != "" {
+			s, err := strconv.ParseFloat(params, 64)
+			if err != nil {
+				return KeyDistribution{}, fmt.Errorf("zipfian skew %q is not a number", params)
+			}
+			d.S = s
+		}
+		return d, d.validate()
+
+	case "hotspot":
+		d := KeyDistribution{Kind: kind, HotKeys: defaultHotKeys, HotOps: defaultHotOps}
+		if params != "" {
+			keys, ops, found := strings.Cut(params, "/")
+			hotKeys, err1 := strconv.ParseFloat(keys, 64)
+			hotOps, err2 := strconv.ParseFloat(ops, 64)
+			if !found || err1 != nil || err2 != nil {
+				return KeyDistribution{}, fmt.Errorf("hotspot %q is not keys%%/operations%%, such as 20/80", params)
+			}
+			d.HotKeys, d.HotOps = hotKeys/100, hotOps/100
+		}
+		return d, d.validate()
+
+	default:
+		return KeyDistribution{}, fmt.Errorf("unknown key distribution %q: want uniform, zipfian[:skew] or hotspot[:keys%%/ops%%]", text)
+	}
+}
+
+// validate rejects parameters the distribution cannot use
+func (d KeyDistribution) validate() error {
+	switch d.Kind {
+	case "zipfian":
+		if !(d.S > 1) {
+			return fmt.Errorf("zipfian skew must be above 1, got %v", d.S)
+		}
+	case "hotspot":
+		if !(d.HotKeys > 0 && d.HotKeys <= 1 && d.HotOps >= 0 && d.HotOps <= 1) {
+			return fmt.Errorf("hotspot percentages must be within 0 to 100, with some keys hot")
+		}
+	}
+	return nil
+}
+
+func (d KeyDistribution) String() string {
+	switch d.Kind {
+	case "zipfian":
+		return "zipfian:" + strconv.FormatFloat(d.S, 'g', -1, 64)
+	case "hotspot":
+		return "hotspot:" + strconv.FormatFloat(100*d.HotKeys, 'g', -1, 64) + "/" + strconv.FormatFloat(100*d.HotOps, 'g', -1, 64)
+	default:
+		return "uniform"
+	}
+}
+
+// Set parses text into d, making a KeyDistribution a flag.Value
+func (d *KeyDistribution) Set(text string) error {
+	parsed, err := ParseKeyDistribution(text)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (d KeyDistribution) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *KeyDistribution) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("key distribution must be a string such as \"zipfian:1.2\", got %s", data)
+	}
+	return d.Set(text)
+}
+
+// Pick returns the index of the next of n keys to operate on
+func (d KeyDistribution) Pick(rng *rand.Rand, n int) int {
+	switch d.Kind {
+	case "zipfian":
+		if n == 1 {
+			return 0
+		}
+		return int(rand.NewZipf(rng, d.S, 1, uint64(n-1)).Uint64())
+	case "hotspot":
+		hot := min(max(int(d.HotKeys*float64(n)), 1), n)
+		if hot == n || rng.Float64() < d.HotOps {
+			return rng.Intn(hot)
+		}
+		return hot + rng.Intn(n-hot)
+	default:
+		return rng.Intn(n)
+	}
+}
+
+// numberedKeys returns the keys key_0 to key_<n-1>
+func numberedKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "key_" + strconv.Itoa(i)
+	}
+	return keys
+}
@@ -0,0 +1,97 @@
+package sim
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestParseKeyDistribution verifies distributions read back as they are
+// written, with defaults for omitted parameters, and bad ones are errors
+func TestParseKeyDistribution(t *testing.T) {
+	for text, want := range map[string]string{
+		"":              "uniform",
+		"uniform":       "uniform",
+		"zipfian":       "zipfian:1.1",
+		"zipfian:1.5":   "zipfian:1.5",
+		"hotspot":       "hotspot:20/80",
+		"hotspot:10/90": "hotspot:10/90",
+	} {
+		d, err := ParseKeyDistribution(text)
+		if err != nil {
+			t.Errorf("ParseKeyDistribution(%q): %v", text, err)
+		} else if d.String() != want {
+			t.Errorf("ParseKeyDistribution(%q) = %s, expected %s", text, d, want)
+		}
+	}
+	for _, text := range []string{"gaussian", "uniform:2", "zipfian:1", "zipfian:x", "hotspot:20", "hotspot:0/50", "hotspot:20/120"} {
+		if _, err := ParseKeyDistribution(text); err == nil {
+			t.Errorf("ParseKeyDistribution(%q) succeeded, expected an error", text)
+		}
+	}
+}
+
+// pickCounts picks n of keys keys from d and counts each
+func pickCounts(d KeyDistribution, keys, n int) []int {
+	rng := rand.New(rand.NewSource(1))
+	counts := make([]int, keys)
+	for i := 0; i < n; i++ {
+		counts[d.Pick(rng, keys)]++
+	}
+	return counts
+}
+
+// TestKeyDistributionSkew verifies uniform picks are even, zipfian ones
+// fall off from the first key and hotspot ones keep to their split
+func TestKeyDistributionSkew(t *testing.T) {
+	const keys, n = 100, 100000
+
+	for i, c := range pickCounts(KeyDistribution{}, keys, n) {
+		if c < n/keys*8/10 || c > n/keys*12/10 {
+			t.Errorf("uniform: key %d picked %d times, expected about %d", i, c, n/keys)
+		}
+	}
+
+	zipf := pickCounts(KeyDistribution{Kind: "zipfian", S: 1.5}, keys, n)
+	if !(zipf[0] > zipf[1] && zipf[1] > zipf[10] && zipf[10] > zipf[99]) || zipf[0] < n/4 {
+		t.Errorf("zipfian: picks %v, expected the first key to dominate and the rest to fall off", zipf[:12])
+	}
+
+	hot := pickCounts(KeyDistribution{Kind: "hotspot", HotKeys: 0.1, HotOps: 0.9}, keys, n)
+	onHot := 0
+	for _, c := range hot[:10] {
+		onHot += c
+	}
+	if onHot < n*88/100 || onHot > n*92/100 {
+		t.Errorf("hotspot 10/90: %d of %d picks on the hot keys, expected about 90%%", onHot, n)
+	}
+}
+
+// TestWorkloadConfigDistribution verifies a workload file's distribution
+// and key count reach its clients, a group's overriding the workload's
+func TestWorkloadConfigDistribution(t *testing.T) {
+	cfg, err := LoadWorkloadConfig(writeWorkload(t, "w.yaml", `
+num_keys: 1000
+distribution: zipfian:1.3
+clients:
+  - count: 1
+    transactions: 1
+    operations_per_tx: 1
+  - count: 1
+    transactions: 1
+    operations_per_tx: 1
+    distribution: uniform
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients := cfg.ClientConfigs()
+	if clients[0].NumKeys != 1000 || clients[0].Distribution.String() != "zipfian:1.3" {
+		t.Errorf("first client = %+v, expected the workload's 1000 keys under zipfian:1.3", clients[0])
+	}
+	if clients[1].Distribution.String() != "uniform" {
+		t.Errorf("second client's distribution = %s, expected its group's uniform", clients[1].Distribution)
+	}
+	if keys := clientKeys(clients[0].Keys, clients[0].NumKeys); len(keys) != 1000 || keys[999] != "key_999" {
+		t.Errorf("expected key_0 to key_999, got %d keys", len(keys))
+	}
+}
@@ -0,0 +1,6 @@
+// Package sim is the simulator that drives the database: the clients,
+// workloads and scenarios, the command table they are run from, and
+// compare, sweep and bench, which run them across engines. It only uses
+// package db's exported API and parses no command line of its own;
+// cmd/db-sim does that.
+package sim
@@ -0,0 +1,42 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// engineName names d's engine as results and reports do: its EngineName
+// if it is a Reporter, otherwise its type
+func engineName(d db.DB) string {
+	if r, ok := d.(db.Reporter); ok {
+		return r.EngineName()
+	}
+	return fmt.Sprintf("%T", d)
+}
+
+// defaultIsolation is the level d begins transactions at when none is
+// asked for: its DefaultIsolation if it is a Reporter, otherwise
+// Serializable, which an engine runs at the strongest level it enforces
+func defaultIsolation(d db.DB) db.IsolationLevel {
+	if r, ok := d.(db.Reporter); ok {
+		return r.DefaultIsolation()
+	}
+	return db.Serializable
+}
+
+// begin starts a transaction on d at its default isolation level, as
+// BeginTransaction does on a *Database
+func begin(d db.DB) *db.Transaction {
+	return d.Begin(context.Background(), defaultIsolation(d))
+}
+
+// clockOf returns d's clock if it is Configurable, otherwise the wall
+// clock
+func clockOf(d db.DB) db.Clock {
+	if c, ok := d.(db.Configurable); ok {
+		return c.Clock()
+	}
+	return db.RealClock
+}
@@ -0,0 +1,228 @@
+package sim
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestEngineRegistry checks engines open by name, alias and policy, and
+// unknown names and policies are errors naming what is registered
+func TestEngineRegistry(t *testing.T) {
+	for engine, want := range map[string]string{
+		"unsynchronized":              "unsynchronized",
+		"synchronized/fair":           "synchronized/Fair",
+		"2pl":                         "two-phase-locking",
+		"two-phase-locking":           "two-phase-locking",
+		"MVCC":                        "mvcc",
+		"timestamp-ordering":          "timestamp-ordering",
+		"synchronized/Prefer-Writers": "synchronized/PreferWriters",
+	} {
+		d, err := db.OpenEngine(engine)
+		if err != nil {
+			t.Errorf("%s: err %v, want %s", engine, err, want)
+		} else if engineName(d) != want {
+			t.Errorf("%s: opened %s, want %s", engine, engineName(d), want)
+		}
+	}
+
+	for engine, want := range map[string]string{
+		"btree":             "unsynchronized, synchronized, 2pl, mvcc, tso",
+		"synchronized/lifo": "prefer-readers, prefer-writers or fair",
+		"2pl/fair":          "no policies",
+	} {
+		if _, err := db.OpenEngine(engine); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %v, want one mentioning %q", engine, err, want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("an alias registered again")
+		}
+	}()
+	db.RegisterEngine("btree", []string{"two-phase-locking"}, nil, nil)
+}
+
+// TestEnginesImplementDB runs a transfer through the DB interface alone on
+// every engine variant, and checks the outcome and the statistics
+func TestEnginesImplementDB(t *testing.T) {
+	for _, engine := range db.EngineVariants() {
+		t.Run(engine, func(t *testing.T) {
+			d, err := db.OpenEngine(engine)
+			if err != nil {
+				t.Fatal(err)
+			}
+			transferThroughDB(t, d)
+		})
+	}
+}
+
+// transferThroughDB moves 30 from a to b, deletes a scratch key and aborts
+// a write, using nothing but the DB interface
+func transferThroughDB(t *testing.T, d db.DB) {
+	setup := begin(d)
+	d.Write(setup, "a", 100)
+	d.Write(setup, "b", 0)
+	d.Write(setup, "scratch", 1)
+	if err := d.Commit(setup); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := begin(d)
+	if !d.Update(tx, "a", -30) || !d.Update(tx, "b", 30) || !d.Delete(tx, "scratch") {
+		t.Fatal("an operation of the transfer failed")
+	}
+	if err := d.Commit(tx); err != nil {
+		t.Fatal(err)
+	}
+	aborted := begin(d)
+	d.Write(aborted, "a", 0)
+	d.Abort(aborted)
+
+	check := begin(d)
+	a, _ := d.Read(check, "a")
+	b, _ := d.Read(check, "b")
+	_, scratch := d.Read(check, "scratch")
+	d.Commit(check)
+	if a != 70 || b != 30 || scratch {
+		t.Errorf("a=%d b=%d scratch exists %v, want 70, 30 and deleted", a, b, scratch)
+	}
+	if stats := d.Stats(); stats.Commits != 3 || stats.Aborts != 1 {
+		t.Errorf("%d commits and %d aborts, want 3 and 1", stats.Commits, stats.Aborts)
+	}
+}
+
+// mapDB is an engine from outside: one mutex over a map, with each
+// transaction's writes buffered until it commits. It implements DB and
+// nothing else.
+type mapDB struct {
+	mu      sync.Mutex
+	values  map[string]int
+	pending map[*db.Transaction]map[string]*int // nil for a delete
+	stats   db.Stats
+}
+
+func newMapDB() *mapDB {
+	return &mapDB{values: make(map[string]int), pending: make(map[*db.Transaction]map[string]*int)}
+}
+
+func (m *mapDB) Begin(ctx context.Context, level db.IsolationLevel) *db.Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tx := &db.Transaction{ID: len(m.pending) + m.stats.Commits + m.stats.Aborts + 1, Isolation: level}
+	m.pending[tx] = make(map[string]*int)
+	return tx
+}
+
+func (m *mapDB) Read(tx *db.Transaction, key string) (int, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if value, written := m.pending[tx][key]; written {
+		if value == nil {
+			return 0, false
+		}
+		return *value, true
+	}
+	value, exists := m.values[key]
+	return value, exists
+}
+
+func (m *mapDB) Write(tx *db.Transaction, key string, value int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending[tx][key] = &value
+	return true
+}
+
+func (m *mapDB) Update(tx *db.Transaction, key string, delta int) bool {
+	value, exists := m.Read(tx, key)
+	return exists && m.Write(tx, key, value+delta)
+}
+
+func (m *mapDB) Delete(tx *db.Transaction, key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending[tx][key] = nil
+	return true
+}
+
+func (m *mapDB) Commit(tx *db.Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, value := range m.pending[tx] {
+		if value == nil {
+			delete(m.values, key)
+		} else {
+			m.values[key] = *value
+		}
+	}
+	delete(m.pending, tx)
+	m.stats.Commits++
+	return nil
+}
+
+func (m *mapDB) Abort(tx *db.Transaction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.pending, tx)
+	tx.Aborted = true
+	m.stats.Aborts++
+}
+
+func (m *mapDB) Stats() db.Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// TestOutsideEngine registers an engine implementing DB alone, and checks
+// it opens by name, runs workloads and compares on the scenarios that take
+// any DB, and is refused by the ones that need a built-in engine
+func TestOutsideEngine(t *testing.T) {
+	db.RegisterEngine("map", nil, nil, func(string) (db.DB, error) { return newMapDB(), nil })
+	defer db.UnregisterEngine("map")
+
+	d, err := db.OpenEngine("map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transferThroughDB(t, d)
+
+	cfg := WorkloadConfig{
+		Engine:        "map",
+		InitialValues: map[string]int{"hits": 0},
+		Keys:          []string{"hits"},
+		Mix:           OperationMix{Read: 1, Update: 1},
+		ValueSize:     8,
+		Clients:       []ClientGroup{{Count: 3, Transactions: 10, OperationsPerTx: 1}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	d, err = cfg.NewDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := RunWorkloadScenario(context.Background(), d, cfg); !result.Passed || result.Engine != "*sim.mapDB" || result.Metrics["transactions"] != 30 {
+		t.Errorf("result = %+v, expected 30 transactions passing on *sim.mapDB", result)
+	}
+
+	cfg.LockTimeout = db.Duration(time.Second)
+	if _, err := cfg.NewDatabase(); err == nil || !strings.Contains(err.Error(), "lock_timeout") {
+		t.Errorf("a lock timeout for an engine that takes no settings: err %v", err)
+	}
+	if _, err := db.OpenDatabase("map"); err == nil || !strings.Contains(err.Error(), "not built in") {
+		t.Errorf("opening it as a built-in engine: err %v", err)
+	}
+	for name, want := range map[string]bool{"openloop": true, "bank": false} {
+		c, _ := FindCommand(name)
+		if got := c.RunsOn("map"); got != want {
+			t.Errorf("%s runs on it: %v, want %v", name, got, want)
+		}
+	}
+}
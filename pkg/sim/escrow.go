@@ -0,0 +1,112 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunEscrowScenario has numClients clients each run txPerClient orders
+// against a hot stock counter, each order taking one item and doing a
+// millisecond of other work before it commits. Under two-phase locking
+// (escrow false) an order holds the stock's exclusive lock through that
+// work, so orders run one at a time; with escrow they reserve their item
+// and run side by side. Stock for three quarters of the orders makes the
+// last ones sell out. It reports committed orders per second, and passes
+// if the stock never went negative and accounts for every order.
+func RunEscrowScenario(ctx context.Context, escrow bool, numClients int, txPerClient int) ScenarioResult {
+	const work = time.Millisecond
+
+	d := db.NewTwoPhaseLockingDatabase()
+	mode := "two-phase locking"
+	if escrow {
+		mode = "escrow"
+	}
+	result := newScenarioResult("escrow", d, map[string]any{
+		"escrow":        escrow,
+		"clients":       numClients,
+		"tx_per_client": txPerClient,
+	})
+
+	initial := numClients * txPerClient * 3 / 4
+	fmt.Printf("\n=== Hot Counter Scenario (%s) ===\n", mode)
+	fmt.Printf("%d clients x %d orders, each taking 1 of %d items in stock and working %v before commit\n",
+		numClients, txPerClient, initial, work)
+	setup := d.BeginTransaction()
+	d.Write(setup, "stock", initial)
+	d.Commit(setup)
+
+	var sold, soldOut, failed atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 1; i <= numClients; i++ {
+		wg.Add(1)
+		go func(ctx context.Context, orders string) {
+			defer wg.Done()
+			for j := 0; j < txPerClient && ctx.Err() == nil; j++ {
+				tx := d.BeginTransactionCtx(ctx)
+				var err error
+				if escrow {
+					err = d.Escrow(tx, "stock", -1, 0)
+				} else {
+					var stock int
+					if stock, err = d.Get(tx, "stock"); err == nil && stock < 1 {
+						err = db.ErrEscrowExhausted // Sold out, as escrow would say
+					} else if err == nil {
+						err = d.Add(tx, "stock", -1)
+					}
+				}
+				if err == nil {
+					err = d.Upsert(tx, orders, 1, 0)
+					time.Sleep(work) // Simulate the rest of the order
+				}
+				if err != nil {
+					d.Abort(tx)
+					if errors.Is(err, db.ErrEscrowExhausted) {
+						soldOut.Add(1)
+					} else {
+						failed.Add(1)
+					}
+					continue
+				}
+				if d.Commit(tx) == nil {
+					sold.Add(1)
+				} else {
+					failed.Add(1)
+				}
+			}
+		}(db.WithClient(ctx, i), fmt.Sprintf("orders_%d", i))
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	finished := int(sold.Load() + soldOut.Load() + failed.Load())
+	result.Partial = reportPartial(ctx, finished, numClients*txPerClient, "orders")
+
+	check := d.BeginTransaction()
+	stock, _ := d.Get(check, "stock")
+	d.Commit(check)
+	throughput := float64(sold.Load()) / elapsed.Seconds()
+	fmt.Printf("\nSold %d, refused %d as sold out, %d failed; %d left in stock\n", sold.Load(), soldOut.Load(), failed.Load(), stock)
+	fmt.Printf("Throughput: %.0f orders/s in %v\n", throughput, elapsed.Round(time.Millisecond))
+
+	oversold := max(0, -stock)
+	result.Passed = stock >= 0 && stock == initial-int(sold.Load())
+	switch {
+	case oversold > 0:
+		fmt.Printf("❌ OVERSOLD: stock fell to %d\n", stock)
+	case !result.Passed:
+		fmt.Printf("❌ Stock %d does not match %d sold from %d\n", stock, sold.Load(), initial)
+	default:
+		fmt.Println("✓ Stock never went negative and matches the orders sold")
+	}
+	result.Metrics["throughput"] = throughput
+	result.Metrics["sold"] = float64(sold.Load())
+	result.Metrics["sold_out"] = float64(soldOut.Load())
+	result.Metrics["violations"] = float64(oversold)
+	return result.finish(d)
+}
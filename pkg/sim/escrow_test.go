@@ -0,0 +1,22 @@
+package sim
+
+import (
+	"context"
+	"testing"
+)
+
+// TestEscrowScenario verifies escrow keeps the stock right and outruns
+// exclusive locks
+func TestEscrowScenario(t *testing.T) {
+	locked := RunEscrowScenario(context.Background(), false, 4, 10)
+	escrow := RunEscrowScenario(context.Background(), true, 4, 10)
+	if !locked.Passed || !escrow.Passed {
+		t.Fatalf("stock wrong: locked %+v, escrow %+v", locked.Metrics, escrow.Metrics)
+	}
+	if escrow.Metrics["sold"] != 30 {
+		t.Errorf("%v sold with escrow, expected the 30 in stock", escrow.Metrics["sold"])
+	}
+	if escrow.Metrics["throughput"] <= locked.Metrics["throughput"] {
+		t.Errorf("escrow %.0f orders/s, no faster than locking's %.0f", escrow.Metrics["throughput"], locked.Metrics["throughput"])
+	}
+}
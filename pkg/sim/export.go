@@ -0,0 +1,218 @@
+package sim
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// ResultRow is one scenario's result flattened for analysis: a row of the
+// CSV results file, or an object of the JSON one. Rows from different
+// runs and engines can be concatenated and grouped by Scenario and Engine.
+type ResultRow struct {
+	Run                   string             `json:"run"` // When the run started, RFC 3339 to the nanosecond; tells runs apart
+	Index                 int                `json:"index"`
+	Scenario              string             `json:"scenario"`
+	Engine                string             `json:"engine"`
+	Seed                  int64              `json:"seed"`
+	Passed                bool               `json:"passed"`
+	Partial               bool               `json:"partial"`
+	DurationMS            float64            `json:"duration_ms"`
+	Throughput            float64            `json:"throughput"` // Transactions per second, or the scenario's own measure
+	Commits               int                `json:"commits"`
+	Aborts                int                `json:"aborts"`
+	Retries               int                `json:"retries"`
+	LostUpdates           int                `json:"lost_updates"`
+	DataCorruption        int                `json:"data_corruption"`
+	LockTimeouts          int                `json:"lock_timeouts"`
+	Deadlocks             int                `json:"deadlocks"`
+	WriteConflicts        int                `json:"write_conflicts"`
+	SerializationFailures int                `json:"serialization_failures"`
+	Latency               map[string]Latency `json:"latency_us"` // By operation
+	Parameters            map[string]any     `json:"parameters"`
+	Metrics               map[string]float64 `json:"metrics"` // The scenario's own, such as inconsistent reads found
+}
+
+// Latency holds an operation's latency percentiles in microseconds
+type Latency struct {
+	P50  float64 `json:"p50"`
+	P99  float64 `json:"p99"`
+	P999 float64 `json:"p999"`
+	Max  float64 `json:"max"`
+}
+
+// microseconds converts d for a results file
+func microseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
+
+// newResultRow flattens result, the index-th scenario of the run started
+// at run
+func newResultRow(run time.Time, index int, result ScenarioResult) ResultRow {
+	s := result.Stats
+	row := ResultRow{
+		Run: run.Format(time.RFC3339Nano), Index: index,
+		Scenario: result.Name, Engine: result.Engine, Seed: result.Seed,
+		Passed: result.Passed, Partial: result.Partial,
+		DurationMS: float64(result.Duration) / float64(time.Millisecond),
+		Commits:    s.Commits, Aborts: s.Aborts, Retries: s.TransactionRetries,
+		LostUpdates: s.LostUpdates, DataCorruption: s.DataCorruption,
+		LockTimeouts: s.LockTimeouts, Deadlocks: s.Deadlocks,
+		WriteConflicts: s.WriteConflicts, SerializationFailures: s.SerializationFailures,
+		Latency:    make(map[string]Latency, len(s.Latency)),
+		Parameters: result.Parameters,
+		Metrics:    result.Metrics,
+	}
+	if throughput, measured := result.Metrics["throughput"]; measured {
+		row.Throughput = throughput
+	} else if result.Duration > 0 {
+		row.Throughput = float64(s.Commits+s.Aborts) / result.Duration.Seconds()
+	}
+	for kind, h := range s.Latency {
+		row.Latency[kind] = Latency{P50: microseconds(h.P50), P99: microseconds(h.P99), P999: microseconds(h.P999), Max: microseconds(h.Max)}
+	}
+	return row
+}
+
+// resultColumns are the CSV results file's columns, after which come the
+// latency percentiles of each operation, then the parameters and metrics
+var resultColumns = []string{
+	"run", "index", "scenario", "engine", "seed", "passed", "partial", "duration_ms", "throughput",
+	"commits", "aborts", "retries", "lost_updates", "data_corruption", "lock_timeouts", "deadlocks",
+	"write_conflicts", "serialization_failures",
+}
+
+// csvHeader returns the CSV results file's header
+func csvHeader() []string {
+	header := append([]string(nil), resultColumns...)
+	for kind := db.OpKind(0); kind < db.NumOpKinds; kind++ {
+		for _, p := range []string{"p50", "p99", "p999", "max"} {
+			header = append(header, kind.String()+"_"+p+"_us")
+		}
+	}
+	return append(header, "parameters", "metrics")
+}
+
+// record returns the row as a CSV record under csvHeader. Operations that
+// did not run have empty latencies, and the parameters and metrics are
+// written key=value, separated by semicolons.
+func (r ResultRow) record() []string {
+	itoa := strconv.Itoa
+	ftoa := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	record := []string{
+		r.Run, itoa(r.Index), r.Scenario, r.Engine, strconv.FormatInt(r.Seed, 10),
+		strconv.FormatBool(r.Passed), strconv.FormatBool(r.Partial), ftoa(r.DurationMS), ftoa(r.Throughput),
+		itoa(r.Commits), itoa(r.Aborts), itoa(r.Retries), itoa(r.LostUpdates), itoa(r.DataCorruption),
+		itoa(r.LockTimeouts), itoa(r.Deadlocks), itoa(r.WriteConflicts), itoa(r.SerializationFailures),
+	}
+	for kind := db.OpKind(0); kind < db.NumOpKinds; kind++ {
+		h, ran := r.Latency[kind.String()]
+		if !ran {
+			record = append(record, "", "", "", "")
+			continue
+		}
+		record = append(record, ftoa(h.P50), ftoa(h.P99), ftoa(h.P999), ftoa(h.Max))
+	}
+
+	parameters := make([]string, 0, len(r.Parameters))
+	for key, value := range r.Parameters {
+		parameters = append(parameters, fmt.Sprintf("%s=%v", key, value))
+	}
+	metrics := make([]string, 0, len(r.Metrics))
+	for key, value := range r.Metrics {
+		metrics = append(metrics, key+"="+ftoa(value))
+	}
+	sort.Strings(parameters)
+	sort.Strings(metrics)
+	return append(record, strings.Join(parameters, ";"), strings.Join(metrics, ";"))
+}
+
+// ResultsFile writes each scenario's result to a results file as soon as
+// the scenario finishes, so a run cut short still leaves the results of
+// the scenarios it completed. A .csv file gets a row per scenario, and a
+// .json file an array of ResultRow objects, rewritten each time. Rows of
+// earlier runs already in the file are kept, so one file can collect a
+// series of runs.
+type ResultsFile struct {
+	path string
+	run  time.Time
+	rows []ResultRow // Every row of a .json file
+}
+
+// OpenResultsFile opens the results file at path, ending in .csv or
+// .json, for the run started at run, creating it if needed
+func OpenResultsFile(path string, run time.Time) (*ResultsFile, error) {
+	f := &ResultsFile{path: path, run: run}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		if len(data) == 0 {
+			return f, f.writeCSV(os.O_CREATE|os.O_TRUNC|os.O_WRONLY, csvHeader())
+		}
+		header, _, _ := strings.Cut(string(data), "\n")
+		if header != strings.Join(csvHeader(), ",") {
+			return nil, fmt.Errorf("%s: has different columns; results need a new file", path)
+		}
+		return f, nil
+	case ".json":
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &f.rows); err != nil {
+				return nil, fmt.Errorf("%s: not a results file: %w", path, err)
+			}
+		}
+		return f, f.writeJSON()
+	default:
+		return nil, fmt.Errorf("%s: results files must end in .csv or .json", path)
+	}
+}
+
+// Add writes result, the index-th scenario of the run
+func (f *ResultsFile) Add(index int, result ScenarioResult) error {
+	row := newResultRow(f.run, index, result)
+	if strings.ToLower(filepath.Ext(f.path)) == ".csv" {
+		return f.writeCSV(os.O_APPEND|os.O_WRONLY, row.record())
+	}
+	f.rows = append(f.rows, row)
+	return f.writeJSON()
+}
+
+// writeCSV opens the file with flag and writes record to it
+func (f *ResultsFile) writeCSV(flag int, record []string) error {
+	file, err := os.OpenFile(f.path, flag, 0o644)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(file)
+	w.Write(record)
+	w.Flush()
+	if err := w.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeJSON writes every row so far
+func (f *ResultsFile) writeJSON() error {
+	rows := f.rows
+	if rows == nil {
+		rows = []ResultRow{}
+	}
+	data, err := json.MarshalIndent(rows, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.path, append(data, '\n'), 0o644)
+}
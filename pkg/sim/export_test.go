@@ -0,0 +1,105 @@
+package sim
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// exportedResult runs the counter scenario for a result to export
+func exportedResult(t *testing.T) ScenarioResult {
+	t.Helper()
+	return RunCounterScenario(context.Background(), db.NewTwoPhaseLockingDatabase(), 2, 10)
+}
+
+// TestResultsFileCSV verifies the CSV results file gets a row per scenario,
+// keeping the rows of earlier runs
+func TestResultsFileCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	result := exportedResult(t)
+	for run := 0; run < 2; run++ {
+		f, err := OpenResultsFile(path, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Add(1, result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("%d records, expected the header and a row per run", len(records))
+	}
+	row := map[string]string{}
+	for i, column := range records[0] {
+		row[column] = records[1][i]
+	}
+	if row["scenario"] != "counter" || row["engine"] != "two-phase-locking" || row["passed"] != "true" {
+		t.Errorf("row = %v", row)
+	}
+	if row["commit_p50_us"] == "" || row["scan_p50_us"] != "" {
+		t.Errorf("commit p50 %q and scan p50 %q, expected only operations that ran to have latencies", row["commit_p50_us"], row["scan_p50_us"])
+	}
+}
+
+// TestResultsFileJSON verifies the JSON results file stays a valid array
+// of every scenario's row
+func TestResultsFileJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.json")
+	result := exportedResult(t)
+	for run := 0; run < 2; run++ {
+		f, err := OpenResultsFile(path, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Add(1, result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []ResultRow
+	if err := json.Unmarshal(data, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Run == rows[1].Run {
+		t.Fatalf("rows = %+v, expected one from each of two runs", rows)
+	}
+	if rows[0].Commits != result.Stats.Commits || rows[0].Throughput <= 0 || rows[0].Latency["update"].P50 <= 0 {
+		t.Errorf("row = %+v", rows[0])
+	}
+}
+
+// TestResultsFileRejectsMistakes verifies unknown formats and files of
+// other columns are refused rather than appended to
+func TestResultsFileRejectsMistakes(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := OpenResultsFile(filepath.Join(dir, "results.txt"), time.Now()); err == nil {
+		t.Error("a .txt results file was accepted")
+	}
+	other := filepath.Join(dir, "other.csv")
+	if err := os.WriteFile(other, []byte("a,b\n1,2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenResultsFile(other, time.Now()); err == nil {
+		t.Error("a CSV file with other columns was accepted")
+	}
+}
@@ -0,0 +1,121 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunFailoverScenario runs clients against a primary replicated to a warm
+// standby, crashes the primary halfway through, promotes the standby and
+// lets the clients reconnect and carry on. Each client increments its own
+// counter, so comparing a counter on the new primary with the number of
+// commits its client saw acknowledged reveals lost commits (acknowledged
+// but never replicated) and duplicated ones (replicated, but the client
+// never got the acknowledgement and retried).
+func RunFailoverScenario(ctx context.Context, mode db.ReplicationMode, numClients int, txPerClient int) ScenarioResult {
+	primary := db.NewTwoPhaseLockingDatabase()
+	standby := db.NewStandby(primary, mode, 200*time.Microsecond)
+
+	result := newScenarioResult("failover_"+mode.String(), primary, map[string]any{
+		"replication":   mode.String(),
+		"clients":       numClients,
+		"tx_per_client": txPerClient,
+	})
+
+	fmt.Printf("\n=== Failover Scenario (%s replication) ===\n", mode)
+	fmt.Printf("Running %d clients with %d commits each; the primary dies halfway\n", numClients, txPerClient)
+
+	var current atomic.Pointer[db.Database]
+	current.Store(primary)
+	failedOver := make(chan struct{})
+
+	planned := numClients * txPerClient
+	acked := make([]int, numClients)
+	var totalAcked, reconnects atomic.Int64
+
+	// The failure detector: kill the primary once half the work is acknowledged
+	go func() {
+		for totalAcked.Load() < int64(planned/2) && ctx.Err() == nil {
+			time.Sleep(100 * time.Microsecond)
+		}
+		primary.Crash()
+		time.Sleep(2 * time.Millisecond) // Time to notice the primary is gone
+		current.Store(standby.Promote())
+		close(failedOver)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < numClients; i++ {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+			key := fmt.Sprintf("client_%d", id)
+
+			for acked[id] < txPerClient && ctx.Err() == nil {
+				d := current.Load()
+				tx := d.BeginTransaction()
+				d.UpdateOrInsert(tx, key, 1, 0)
+				d.Commit(tx)
+
+				if !tx.Aborted {
+					acked[id]++
+					totalAcked.Add(1)
+					continue
+				}
+				if d.Crashed() {
+					// Connection lost: wait for the standby and retry there
+					reconnects.Add(1)
+					select {
+					case <-failedOver:
+					case <-ctx.Done():
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	<-failedOver
+
+	result.Partial = reportPartial(ctx, int(totalAcked.Load()), planned, "commits")
+
+	newPrimary := current.Load()
+	lost, duplicated := 0, 0
+	tx := newPrimary.BeginTransaction()
+	for id := 0; id < numClients; id++ {
+		value, _ := newPrimary.Read(tx, fmt.Sprintf("client_%d", id))
+		if value < acked[id] {
+			lost += acked[id] - value
+		} else {
+			duplicated += value - acked[id]
+		}
+	}
+	newPrimary.Commit(tx)
+
+	applied, lastSeq, dropped := standby.ReplicationStatus()
+	fmt.Printf("\nAcknowledged commits: %d, client reconnects: %d\n", totalAcked.Load(), reconnects.Load())
+	fmt.Printf("Standby replayed %d commits (up to seq %d); %d in flight were dropped at failover\n", applied, lastSeq, dropped)
+
+	if lost > 0 {
+		fmt.Printf("❌ %d acknowledged commits were LOST in the failover\n", lost)
+	}
+	if duplicated > 0 {
+		fmt.Printf("❌ %d commits were DUPLICATED by clients retrying an unacknowledged commit\n", duplicated)
+	}
+	if lost == 0 && duplicated == 0 {
+		fmt.Printf("✓ Every acknowledged commit survived the failover exactly once\n")
+	}
+
+	result.Passed = lost == 0 && duplicated == 0
+	result.Metrics["acked_commits"] = float64(totalAcked.Load())
+	result.Metrics["lost_commits"] = float64(lost)
+	result.Metrics["duplicated_commits"] = float64(duplicated)
+	result.Metrics["reconnects"] = float64(reconnects.Load())
+	result.Metrics["dropped_in_flight"] = float64(dropped)
+	return result.finish(newPrimary)
+}
@@ -0,0 +1,23 @@
+package sim
+
+import (
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestFailoverSyncReplicationLosesNothing verifies that no acknowledged
+// commit is lost when the primary dies under synchronous replication
+func TestFailoverSyncReplicationLosesNothing(t *testing.T) {
+	noLeaks(t)
+	ctx, cancel := NewScenarioContext()
+	defer cancel()
+
+	result := RunFailoverScenario(ctx, db.SyncReplication, 4, 50)
+	if lost := result.Metrics["lost_commits"]; lost != 0 {
+		t.Errorf("Sync replication lost %v acknowledged commits", lost)
+	}
+	if result.Metrics["acked_commits"] != 200 {
+		t.Errorf("Clients got %v commits acknowledged, want 200", result.Metrics["acked_commits"])
+	}
+}
@@ -0,0 +1,184 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunChaosScenario runs bank transfers between four accounts on a durable
+// two-phase locking database injecting the faults config describes, then
+// recovers a new database from its storage. Each client also counts its
+// acknowledged transfers in a key of its own. Money must be conserved
+// after every commit and in the recovered state, whatever the faults, and
+// recovery must keep every acknowledged transfer, plus at most the one
+// whose acknowledgement a database crash swallowed.
+func RunChaosScenario(ctx context.Context, config db.FaultConfig, numClients int, transfersPerClient int) ScenarioResult {
+	const (
+		accounts = 4
+		balance  = 1000
+	)
+	primary := db.NewTwoPhaseLockingDatabase()
+	primary.SetLockTimeout(20 * time.Millisecond)
+	result := newScenarioResult("chaos", primary, map[string]any{
+		"clients":              numClients,
+		"transfers":            transfersPerClient,
+		"delay_probability":    config.DelayProbability,
+		"max_delay":            time.Duration(config.MaxDelay).String(),
+		"abort_probability":    config.AbortProbability,
+		"client_crash":         config.ClientCrashProbability,
+		"crash_at_commit":      config.CrashAtCommit,
+		"crash_point":          config.CrashPoint,
+		"client_crash_timeout": time.Duration(config.ClientCrashTimeout).String(),
+	})
+
+	fmt.Println("\n=== Chaos Scenario (injected delays, aborts and crashes) ===")
+	if err := config.Validate(); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return result.finish(primary)
+	}
+
+	dir, err := os.MkdirTemp("", "chaos-")
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return result.finish(primary)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := primary.AttachStorage(dir); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return result.finish(primary)
+	}
+
+	keys := make([]string, accounts)
+	setup := primary.BeginTransaction()
+	for i := range keys {
+		keys[i] = fmt.Sprintf("account_%d", i+1)
+		primary.Write(setup, keys[i], balance)
+	}
+	primary.Commit(setup)
+	primary.AddInvariant(db.SumInvariant(accounts*balance, keys...))
+
+	// Faults start once the accounts exist, so an injected abort cannot
+	// leave them unfunded
+	primary.SetFaults(config) // Validated above
+	config, _ = primary.Faults()
+	result.Seed = config.Seed
+	fmt.Printf("Running %d clients with %d transfers each between %d accounts, fault seed %d\n",
+		numClients, transfersPerClient, accounts, config.Seed)
+
+	planned := numClients * transfersPerClient
+	acked := make([]int, numClients+1)
+	var attempts, crashedClients atomic.Int64
+	var wg sync.WaitGroup
+	for client := 1; client <= numClients; client++ {
+		wg.Add(1)
+		go func(ctx context.Context, client int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(config.Seed + int64(client)))
+			tally := fmt.Sprintf("transfers_%d", client)
+			for acked[client] < transfersPerClient && ctx.Err() == nil && !primary.Crashed() {
+				from, to := rng.Intn(accounts), rng.Intn(accounts-1)
+				if to >= from {
+					to++
+				}
+				amount := 1 + rng.Intn(50)
+				attempts.Add(1)
+
+				tx := primary.BeginTransactionCtx(ctx)
+				steps := []func() error{
+					func() error { return primary.Add(tx, keys[from], -amount) },
+					func() error { return primary.Add(tx, keys[to], amount) },
+					func() error { return primary.Upsert(tx, tally, 1, 0) },
+				}
+				crashAt := primary.ClientCrash(client, len(steps))
+				var err error
+				for i, step := range steps {
+					if i == crashAt {
+						break
+					}
+					if err = step(); err != nil {
+						break
+					}
+				}
+				if crashAt >= 0 {
+					primary.Abandon(tx)
+					crashedClients.Add(1)
+					return
+				}
+				if err != nil {
+					primary.Abort(tx)
+					continue
+				}
+				if primary.Commit(tx) == nil {
+					acked[client]++
+				}
+			}
+		}(db.WithClient(ctx, client), client)
+	}
+	wg.Wait()
+	primary.AwaitAbandoned()
+	done := 0
+	for _, n := range acked {
+		done += n
+	}
+	result.Partial = reportPartial(ctx, done, planned, "transfers")
+	_, counts := primary.Faults()
+	fmt.Printf("Injected %v\n", counts)
+	fmt.Printf("%d transfers acknowledged of %d attempted; %d clients crashed\n", done, attempts.Load(), crashedClients.Load())
+	violations := reportInvariants(primary)
+
+	// Whatever the database had, only its storage survives
+	if err := primary.CloseStorage(); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return result.finish(primary)
+	}
+	recovered := db.NewTwoPhaseLockingDatabase()
+	report, err := recovered.AttachStorage(dir)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return result.finish(recovered)
+	}
+	defer recovered.CloseStorage()
+	fmt.Printf("Recovered %d commits from the WAL\n", report.Replayed)
+
+	entries := recovered.TakeSnapshot().Entries
+	total, lost, unacked := 0, 0, 0
+	for _, key := range keys {
+		total += entries[key].Value
+	}
+	for client := 1; client <= numClients; client++ {
+		value := entries[fmt.Sprintf("transfers_%d", client)].Value
+		if value < acked[client] {
+			lost += acked[client] - value
+		} else {
+			unacked += value - acked[client]
+		}
+	}
+	if total != accounts*balance {
+		fmt.Printf("❌ MONEY NOT CONSERVED after recovery: the accounts hold %d, not %d\n", total, accounts*balance)
+	} else {
+		fmt.Printf("✓ The recovered accounts still hold %d\n", total)
+	}
+	if lost > 0 {
+		fmt.Printf("❌ %d acknowledged transfers were LOST in recovery\n", lost)
+	} else {
+		fmt.Printf("✓ Recovery kept every acknowledged transfer (%d more committed unacknowledged as the crash hit)\n", unacked)
+	}
+
+	result.Passed = violations == 0 && total == accounts*balance && lost == 0
+	result.Metrics["acked_transfers"] = float64(done)
+	result.Metrics["attempts"] = float64(attempts.Load())
+	result.Metrics["injected_delays"] = float64(counts.Delays)
+	result.Metrics["injected_aborts"] = float64(counts.Aborts)
+	result.Metrics["client_crashes"] = float64(counts.ClientCrashes)
+	result.Metrics["database_crashes"] = float64(counts.Crashes)
+	result.Metrics["lost_transfers"] = float64(lost)
+	result.Metrics["unacked_transfers"] = float64(unacked)
+	return result.finish(recovered)
+}
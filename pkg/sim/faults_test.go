@@ -0,0 +1,81 @@
+package sim
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestClientCrashAbandonsTransaction has every client die in its first
+// transaction and checks that the database aborts what they left behind,
+// releasing its locks, once the crash timeout has passed
+func TestClientCrashAbandonsTransaction(t *testing.T) {
+	d := db.NewTwoPhaseLockingDatabase()
+	if err := d.SetFaults(db.FaultConfig{Seed: 5, ClientCrashProbability: 1, ClientCrashTimeout: db.Duration(10 * time.Millisecond)}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	clients := make([]*Client, 3)
+	for i := range clients {
+		clients[i] = NewClient(ClientConfig{ID: i + 1, NumTransactions: 5, OperationsPerTx: 3, Keys: []string{"a", "b"},
+			Mix: OperationMix{Write: 1}}, d)
+		wg.Add(1)
+		go clients[i].Run(context.Background(), &wg)
+	}
+	wg.Wait()
+	for _, c := range clients {
+		if !c.crashed || c.Completed() != 0 {
+			t.Errorf("client %d: crashed %v after %d transactions, want a crash in the first", c.config.ID, c.crashed, c.Completed())
+		}
+	}
+	d.AwaitAbandoned()
+	if active := d.LiveTransactions(); len(active) != 0 {
+		t.Errorf("%d transactions still active after the crash timeout", len(active))
+	}
+	if _, counts := d.Faults(); counts.ClientCrashes != 3 {
+		t.Errorf("%d client crashes, want 3", counts.ClientCrashes)
+	}
+
+	// The abandoned locks are free again
+	d.SetFaults(db.FaultConfig{})
+	tx := d.BeginTransaction()
+	if err := d.Put(tx, "a", 1); err != nil {
+		t.Fatalf("after the crashes: %v", err)
+	}
+	d.Commit(tx)
+}
+
+func TestChaosScenario(t *testing.T) {
+	noLeaks(t)
+	result := RunChaosScenario(context.Background(), db.FaultConfig{
+		Seed:                   9,
+		DelayProbability:       0.1,
+		MaxDelay:               db.Duration(200 * time.Microsecond),
+		AbortProbability:       0.05,
+		ClientCrashProbability: 0.01,
+		CrashAtCommit:          40,
+		CrashPoint:             db.CrashBeforeWAL,
+	}, 4, 15)
+	if !result.Passed {
+		t.Fatalf("chaos scenario failed: %+v", result.Metrics)
+	}
+	if result.Metrics["database_crashes"] != 1 || result.Metrics["injected_aborts"] == 0 {
+		t.Errorf("expected a crash and some aborts, got %+v", result.Metrics)
+	}
+}
+
+// TestChaosScenarioSetupEscapesFaults verifies the accounts are funded
+// before faults start: with every operation aborted no transfer commits,
+// but the recovered accounts still hold their opening balances
+func TestChaosScenarioSetupEscapesFaults(t *testing.T) {
+	noLeaks(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	result := RunChaosScenario(ctx, db.FaultConfig{Seed: 3, AbortProbability: 1}, 2, 5)
+	if !result.Passed || result.Metrics["acked_transfers"] != 0 {
+		t.Errorf("passed %v with metrics %+v, expected a pass with no transfers", result.Passed, result.Metrics)
+	}
+}
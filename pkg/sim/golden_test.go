@@ -0,0 +1,117 @@
+package sim
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// Golden files. Each case runs a scenario with a fixed RunSeed on a
+// simulated clock, with one client, or transactions that never wait on
+// each other, so no interleaving can vary, and compares the report it
+// printed and its summary with the files under testdata/golden. A change
+// to the engine that alters a scenario's outcome or report fails here; if
+// the change is intended, rewrite the files with
+//
+//	go test -run TestGolden -update
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files under testdata/golden")
+
+// goldenCases are the runs whose reports and summaries are kept
+var goldenCases = map[string]func(ctx context.Context) ScenarioResult{
+	"counter-unsynchronized": func(ctx context.Context) ScenarioResult {
+		return RunCounterScenario(ctx, simulated(db.NewUnsynchronizedDatabase()), 1, 50)
+	},
+	"bank-transfer-2pl": func(ctx context.Context) ScenarioResult {
+		return RunBankTransferScenario(ctx, simulated(db.NewTwoPhaseLockingDatabase()), 1, 50)
+	},
+	"ycsb-a-mvcc": func(ctx context.Context) ScenarioResult {
+		return RunYCSBScenario(ctx, simulated(db.NewMVCCDatabase()), "a", 100, 1, 200)
+	},
+	"write-skew-repeatable-read": func(ctx context.Context) ScenarioResult {
+		return RunWriteSkewScenario(ctx, simulated(db.NewMVCCDatabase()), db.RepeatableRead, 5)
+	},
+	"linearizability-tso": func(ctx context.Context) ScenarioResult {
+		return RunLinearizabilityScenario(ctx, simulated(db.NewTimestampOrderingDatabase()), 1, 30)
+	},
+}
+
+// captureReport runs scenario and returns its result and what it printed
+func captureReport(t *testing.T, scenario func(ctx context.Context) ScenarioResult) (ScenarioResult, string) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	printed := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		printed <- data
+	}()
+	result := scenario(context.Background())
+	w.Close()
+	os.Stdout = stdout
+	return result, string(<-printed)
+}
+
+// checkGolden compares got with the golden file name, or rewrites it
+// under -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	path := filepath.Join("testdata", "golden", name)
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s changed; got:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	defer func(seed int64) { db.RunSeed = seed }(db.RunSeed)
+	db.RunSeed = 42
+	for name, scenario := range goldenCases {
+		t.Run(name, func(t *testing.T) {
+			result, report := captureReport(t, scenario)
+			summary, err := json.MarshalIndent(result.Summary(), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, name+".txt", []byte(report))
+			checkGolden(t, name+".json", append(summary, '\n'))
+		})
+	}
+}
+
+// TestGoldenRunsRepeat checks that the golden runs are deterministic, so
+// a golden file can only change with the code: every case run twice has
+// the same report and summary
+func TestGoldenRunsRepeat(t *testing.T) {
+	defer func(seed int64) { db.RunSeed = seed }(db.RunSeed)
+	db.RunSeed = 42
+	for name, scenario := range goldenCases {
+		first, firstReport := captureReport(t, scenario)
+		second, secondReport := captureReport(t, scenario)
+		a, _ := json.Marshal(first.Summary())
+		b, _ := json.Marshal(second.Summary())
+		if firstReport != secondReport || string(a) != string(b) {
+			t.Errorf("%s differs between runs:\n%s\n%s", name, a, b)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package sim
+
+import (
+	"fmt"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// Goroutine leaks. Everything a scenario starts, its clients, watchers,
+// sweepers, checkpointers and servers, should have returned by the time
+// it reports. With leak detection on, the scenario runner notes the
+// goroutines running before each scenario and afterwards waits briefly
+// for any new ones to exit; those still running outlived the scenario
+// and fail it, like the transactions it left unfinished.
+
+// leakGrace is how long goroutines a scenario started get to exit after it
+// returns, such as a server's connections closing
+var leakGrace = 2 * time.Second
+
+// scenarioLeaks notes what is running before a scenario, so what it leaves
+// behind can be found afterwards
+type scenarioLeaks struct {
+	goroutines map[int]string
+	databases  int // Databases the leak detector held before the scenario
+}
+
+// startLeakCheck notes what is running, if leak detection is on; nil if
+// it is off
+func startLeakCheck() *scenarioLeaks {
+	detector := db.LeakDetection()
+	if detector == nil {
+		return nil
+	}
+	return &scenarioLeaks{goroutines: db.RunningGoroutines(), databases: detector.Count()}
+}
+
+// check reports the goroutines the scenario of result left running and
+// the transactions it left unfinished, and fails it if there are any
+func (l *scenarioLeaks) check(result *ScenarioResult) {
+	if l == nil {
+		return
+	}
+	goroutines := db.LeakedGoroutines(l.goroutines, leakGrace)
+	transactions := db.LeakDetection().LiveSince(l.databases)
+	result.Metrics["leaked_goroutines"] = float64(len(goroutines))
+	result.Metrics["leaked_transactions"] = float64(len(transactions))
+	if len(goroutines) == 0 && len(transactions) == 0 {
+		return
+	}
+	result.Passed = false
+	if len(goroutines) > 0 {
+		fmt.Printf("❌ %d goroutines outlived the scenario:\n", len(goroutines))
+		for _, stack := range goroutines {
+			fmt.Printf("  %s\n", db.GoroutineSummary(stack))
+		}
+	}
+	if len(transactions) > 0 {
+		fmt.Printf("❌ %d transactions outlived the scenario:\n", len(transactions))
+		for _, leak := range transactions {
+			fmt.Printf("  %s\n", leak)
+		}
+	}
+}
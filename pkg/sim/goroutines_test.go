@@ -0,0 +1,95 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestMain fails the run if any test left a goroutine running
+func TestMain(m *testing.M) {
+	before := db.RunningGoroutines()
+	code := m.Run()
+	if code == 0 {
+		if leaked := db.LeakedGoroutines(before, leakGrace); len(leaked) > 0 {
+			fmt.Fprintf(os.Stderr, "%d goroutines outlived the tests:\n\n%s\n", len(leaked), strings.Join(leaked, "\n\n"))
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// noLeaks fails t if a goroutine it starts or a transaction on a database
+// it creates is still running when it ends. Scenarios the test runs
+// through a RunManifest are checked on their own as well.
+func noLeaks(t *testing.T) {
+	previous := db.LeakDetection()
+	db.SetLeakDetector(&db.LeakDetector{})
+	before := db.RunningGoroutines()
+	t.Cleanup(func() {
+		defer db.SetLeakDetector(previous)
+		for _, stack := range db.LeakedGoroutines(before, leakGrace) {
+			t.Errorf("goroutine outlived the test: %s", db.GoroutineSummary(stack))
+		}
+		for _, leak := range db.LeakDetection().LiveSince(0) {
+			t.Errorf("transaction outlived the test: %s", leak)
+		}
+	})
+}
+
+// TestScenarioLeaksFailIt checks the scenario runner fails a scenario that
+// leaves a goroutine running or a transaction unfinished, and names them
+func TestScenarioLeaksFailIt(t *testing.T) {
+	defer func(grace time.Duration) { leakGrace = grace }(leakGrace)
+	leakGrace = 50 * time.Millisecond
+	defer db.SetLeakDetector(db.LeakDetection())
+	db.SetLeakDetector(&db.LeakDetector{})
+
+	stop := make(chan struct{})
+	manifest := NewRunManifest(nil)
+	var d *db.Database
+	result, report := captureReport(t, func(context.Context) ScenarioResult {
+		return manifest.Run(func(ctx context.Context) ScenarioResult {
+			d = db.NewTwoPhaseLockingDatabase()
+			result := newScenarioResult("leaky", d, nil)
+			go func() { <-stop }()
+			d.Read(d.BeginTransaction(), "x")
+			result.Passed = true
+			return result.finish(d)
+		})
+	})
+	close(stop)
+	for _, tx := range d.LiveTransactions() {
+		d.Abort(tx)
+	}
+
+	if result.Passed || result.Metrics["leaked_goroutines"] != 1 || result.Metrics["leaked_transactions"] != 1 {
+		t.Errorf("leaky scenario passed or miscounted: %+v", result.Metrics)
+	}
+	for _, want := range []string{"1 goroutines outlived", "goroutines_test.go", "1 transactions outlived"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report does not mention %q:\n%s", want, report)
+		}
+	}
+}
+
+// TestFinishedScenarioHasNoLeaks checks a scenario whose goroutines all
+// returned and whose transactions all finished passes the leak check
+func TestFinishedScenarioHasNoLeaks(t *testing.T) {
+	defer db.SetLeakDetector(db.LeakDetection())
+	db.SetLeakDetector(&db.LeakDetector{})
+
+	result, _ := captureReport(t, func(context.Context) ScenarioResult {
+		return NewRunManifest(nil).Run(func(ctx context.Context) ScenarioResult {
+			return RunCounterScenario(ctx, db.NewTwoPhaseLockingDatabase(), 3, 10)
+		})
+	})
+	if !result.Passed || result.Metrics["leaked_goroutines"] != 0 || result.Metrics["leaked_transactions"] != 0 {
+		t.Errorf("result %+v", result.Metrics)
+	}
+}
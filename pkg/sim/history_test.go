@@ -0,0 +1,14 @@
+package sim
+
+import (
+	"context"
+	"testing"
+)
+
+// TestAuditTrailScenario checks the trail accounts for every lost increment
+func TestAuditTrailScenario(t *testing.T) {
+	result := RunAuditTrailScenario(context.Background(), 4, 25)
+	if !result.Passed {
+		t.Errorf("Audit trail scenario failed: %v", result.Metrics)
+	}
+}
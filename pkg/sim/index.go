@@ -0,0 +1,131 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunIndexScenario keeps a pool of tasks, each with a priority, while
+// writers reprioritize and replace tasks and readers query the priority
+// index. Every transaction keeps the number of tasks the same, so a query
+// over every priority must always find exactly that many tasks, each once:
+// an index that lagged its records would lose or double-count a task that
+// was moving.
+func RunIndexScenario(ctx context.Context, d *db.Database, numWriters int, numReaders int, duration time.Duration) ScenarioResult {
+	result := newScenarioResult("secondary_index", d, map[string]any{
+		"writers":  numWriters,
+		"readers":  numReaders,
+		"duration": duration.String(),
+	})
+	result.Seed = db.NewRunSeed()
+
+	fmt.Println("\n=== Secondary Index Scenario ===")
+	fmt.Printf("%d writers move tasks between priorities while %d readers query the index for %v (%s)\n",
+		numWriters, numReaders, duration, d.EngineName())
+
+	const tasks, priorities = 50, 10
+	initial := make(map[string]int, tasks)
+	for i := 0; i < tasks; i++ {
+		initial[fmt.Sprintf("task_%03d", i)] = i % priorities
+	}
+	d.BulkLoad(initial)
+	d.CreateIndex("by_priority")
+
+	start := time.Now()
+	runCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	var moves, replaces, queries, badQueries atomic.Int64
+	var nextTask atomic.Int64
+	nextTask.Store(tasks)
+	var wg sync.WaitGroup
+	for i := 0; i < numWriters; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(result.Seed + int64(id)))
+			for runCtx.Err() == nil {
+				entries, _ := d.QueryIndex("by_priority", 0, priorities-1)
+				if len(entries) == 0 {
+					continue
+				}
+				victim := entries[rng.Intn(len(entries))].Key
+				priority := rng.Intn(priorities)
+				replace := rng.Intn(4) == 0
+				replacement := fmt.Sprintf("task_%03d", nextTask.Add(1))
+
+				err := d.RunTransactionCtx(runCtx, func(tx *db.Transaction) error {
+					if _, err := d.Get(tx, victim); err != nil {
+						// Replaced by another writer since the query
+						return nil
+					}
+					if !replace {
+						return d.Put(tx, victim, priority)
+					}
+					if err := d.Remove(tx, victim); err != nil {
+						return err
+					}
+					return d.Put(tx, replacement, priority)
+				})
+				if err != nil {
+					continue
+				}
+				if replace {
+					replaces.Add(1)
+				} else {
+					moves.Add(1)
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < numReaders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for runCtx.Err() == nil {
+				entries, err := d.QueryIndex("by_priority", 0, priorities-1)
+				seen := make(map[string]bool, len(entries))
+				for _, entry := range entries {
+					seen[entry.Key] = true
+				}
+				if err != nil || len(entries) != tasks || len(seen) != tasks {
+					badQueries.Add(1)
+				}
+				queries.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	ran := time.Since(start)
+	result.Partial = reportPartial(ctx, int(min(ran, duration)/time.Millisecond), int(duration/time.Millisecond), "planned milliseconds")
+
+	problems, _ := d.VerifyIndex("by_priority")
+	fmt.Printf("Moves: %d, replacements: %d, queries: %d\n", moves.Load(), replaces.Load(), queries.Load())
+	if badQueries.Load() > 0 {
+		fmt.Printf("❌ %d queries did not find exactly %d tasks\n", badQueries.Load(), tasks)
+	}
+	for i, problem := range problems {
+		if i == 5 {
+			fmt.Printf("  ... and %d more\n", len(problems)-5)
+			break
+		}
+		fmt.Printf("❌ Index out of step: %s\n", problem)
+	}
+	if badQueries.Load() == 0 && len(problems) == 0 {
+		fmt.Printf("✓ Every query found all %d tasks once, and the index matches the records\n", tasks)
+	}
+
+	result.Passed = badQueries.Load() == 0 && len(problems) == 0
+	result.Metrics["moves"] = float64(moves.Load())
+	result.Metrics["replacements"] = float64(replaces.Load())
+	result.Metrics["queries"] = float64(queries.Load())
+	result.Metrics["bad_queries"] = float64(badQueries.Load())
+	result.Metrics["index_problems"] = float64(len(problems))
+	return result.finish(d)
+}
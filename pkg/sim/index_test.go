@@ -0,0 +1,22 @@
+package sim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestIndexScenario runs the index scenario on both isolating engines
+func TestIndexScenario(t *testing.T) {
+	noLeaks(t)
+	for name, d := range map[string]*db.Database{"2PL": db.NewTwoPhaseLockingDatabase(), "MVCC": db.NewMVCCDatabase()} {
+		t.Run(name, func(t *testing.T) {
+			result := RunIndexScenario(context.Background(), d, 3, 3, 50*time.Millisecond)
+			if !result.Passed {
+				t.Errorf("Index scenario failed: %v", result.Metrics)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package sim
+
+import (
+	"fmt"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// reportInvariants prints how many violations d's invariant checker found
+// and the first few, and returns how many there were
+func reportInvariants(d db.Reporter) int {
+	violations, count := d.InvariantViolations()
+	if count == 0 {
+		fmt.Printf("✓ Invariants held after every commit (%d checked)\n", d.InvariantCount())
+		return 0
+	}
+	fmt.Printf("❌ INVARIANT BROKEN by %d commits; the first:\n", count)
+	for _, v := range violations[:min(len(violations), 3)] {
+		fmt.Printf("   %v\n", v)
+	}
+	return count
+}
@@ -0,0 +1,24 @@
+package sim
+
+import (
+	"context"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestInvariantFailsScenario verifies a registered scenario's invariants
+// are checked through its run and a broken one fails it
+func TestInvariantFailsScenario(t *testing.T) {
+	d := db.NewTwoPhaseLockingDatabase()
+	d.AddInvariant(db.EqualInvariant("pair_x", "pair_tally_1"))
+	result := RunRegisteredScenario(context.Background(), d, "paired-counters", Params{"clients": 2, "increments": 5})
+	if result.Passed || result.Metrics["invariant_violations"] == 0 {
+		t.Errorf("pair_x and one client's tally stayed equal with two clients: %+v", result.Metrics)
+	}
+
+	result = RunRegisteredScenario(context.Background(), db.NewTwoPhaseLockingDatabase(), "paired-counters", Params{"clients": 2, "increments": 5})
+	if !result.Passed || result.Metrics["invariant_violations"] != 0 {
+		t.Errorf("x == y broken under two-phase locking: %+v", result.Metrics)
+	}
+}
@@ -0,0 +1,175 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// inventoryOversell has clients buy items from a stock counter that must
+// never go below zero. Each purchase checks the stock, takes an item and
+// records the sale in the client's own tally. With the check and the
+// decrement as separate steps, two clients can both see the last item and
+// both take it: without isolation the stock is oversold. The guard
+// parameter picks how purchases are made safe where transactions alone do
+// not: 1 decrements with CompareAndSet, retrying if the stock changed
+// since it was read, and 2 decrements unconditionally, with the stock's
+// validator ForKey("inventory_stock", AtLeast(0)) rejecting a decrement
+// below zero.
+type inventoryOversell struct{}
+
+// The purchase guards of inventoryOversell
+const (
+	guardNone            = 0 // Check, then decrement, in one transaction
+	guardCompareAndSet   = 1 // Decrement only the value that was checked
+	guardNonNegativeRule = 2 // Decrement, rejected by the stock's validator below zero
+)
+
+// inventoryStock is how many items the oversell scenario starts with
+const inventoryStock = 100
+
+// errSoldOut is a purchase's error when the stock has run out
+var errSoldOut = errors.New("sold out")
+
+func init() {
+	RegisterScenario(inventoryOversell{}, ScenarioInfo{
+		Summary:  "clients buying from a stock that must not go below zero (oversell; guard 1 uses CompareAndSet, 2 a non-negative constraint)",
+		Defaults: Params{"clients": 8, "orders": 20, "guard": guardNone},
+		Expect:   "Oversell: unsynchronized, more items are sold than were in stock and it goes negative;\ntwo-phase locking, CompareAndSet or a non-negative constraint each keep it exact",
+		Variants: []Params{{"guard": guardCompareAndSet}, {"guard": guardNonNegativeRule}},
+	})
+}
+
+func (inventoryOversell) Name() string { return "oversell" }
+
+func (inventoryOversell) Setup(d *db.Database) error {
+	return d.RunTransaction(func(tx *db.Transaction) error {
+		return d.Put(tx, "inventory_stock", inventoryStock)
+	})
+}
+
+func (inventoryOversell) Run(ctx context.Context, d *db.Database, params Params) error {
+	guard := params["guard"]
+	switch guard {
+	case guardNone, guardCompareAndSet:
+	case guardNonNegativeRule:
+		d.AddValidator(db.ForKey("inventory_stock", db.AtLeast(0)))
+	default:
+		return fmt.Errorf("guard %d: expected 0 (none), 1 (CompareAndSet) or 2 (non-negative constraint)", guard)
+	}
+
+	var wg sync.WaitGroup
+	for client := 1; client <= params["clients"]; client++ {
+		wg.Add(1)
+		go func(ctx context.Context, tally string) {
+			defer wg.Done()
+			for i := 0; i < params["orders"] && ctx.Err() == nil; i++ {
+				buyItem(ctx, d, guard, tally) // Sold out or failed: the order goes unfilled
+			}
+		}(db.WithClient(ctx, client), fmt.Sprintf("inventory_sold_%d", client))
+	}
+	wg.Wait()
+	return nil
+}
+
+// buyItem takes one item from the stock with guard and records the sale
+// in tally. It returns errSoldOut if the stock ran out.
+func buyItem(ctx context.Context, d *db.Database, guard int, tally string) error {
+	switch guard {
+	case guardCompareAndSet:
+		for {
+			var stock int
+			err := d.RunTransactionCtx(ctx, func(tx *db.Transaction) error {
+				var err error
+				stock, err = d.Get(tx, "inventory_stock")
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if stock < 1 {
+				return errSoldOut
+			}
+			swapped, err := d.CompareAndSet("inventory_stock", stock, stock-1)
+			if err != nil {
+				return err
+			}
+			if swapped {
+				break
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+		}
+		_, err := d.Incr(tally)
+		return err
+
+	case guardNonNegativeRule:
+		if _, err := d.Decr("inventory_stock"); err != nil {
+			if errors.Is(err, db.ErrTxAborted) {
+				return errSoldOut // The validator refused a negative stock
+			}
+			return err
+		}
+		_, err := d.Incr(tally)
+		return err
+
+	default:
+		return d.RunTransactionCtx(ctx, func(tx *db.Transaction) error {
+			stock, err := d.Get(tx, "inventory_stock")
+			if err != nil {
+				return err
+			}
+			if stock < 1 {
+				return errSoldOut
+			}
+			if err := d.Add(tx, "inventory_stock", -1); err != nil {
+				return err
+			}
+			return d.Upsert(tx, tally, 1, 0)
+		})
+	}
+}
+
+func (inventoryOversell) Invariants() []db.Invariant {
+	return []db.Invariant{{
+		Name: "stock >= 0",
+		Keys: []string{"inventory_stock"},
+		Check: func(values map[string]int) error {
+			if stock := values["inventory_stock"]; stock < 0 {
+				return fmt.Errorf("stock is %d", stock)
+			}
+			return nil
+		},
+	}}
+}
+
+func (inventoryOversell) Verify(d *db.Database) []db.Violation {
+	entries := d.TakeSnapshot().Entries
+	stock := entries["inventory_stock"].Value
+	sold := 0
+	for key, entry := range entries {
+		if strings.HasPrefix(key, "inventory_sold_") {
+			sold += entry.Value
+		}
+	}
+	fmt.Printf("Sold %d items from a stock of %d; %d left\n", sold, inventoryStock, stock)
+
+	var violations []db.Violation
+	if stock < 0 {
+		violations = append(violations, db.Violation{Invariant: "stock >= 0", Detail: fmt.Sprintf("stock fell to %d", stock)})
+	}
+	if sold > inventoryStock {
+		violations = append(violations, db.Violation{Invariant: "sold <= initial stock",
+			Detail: fmt.Sprintf("OVERSOLD: %d items sold from a stock of %d", sold, inventoryStock)})
+	}
+	if stock+sold != inventoryStock {
+		violations = append(violations, db.Violation{Invariant: "stock + sold == initial stock",
+			Detail: fmt.Sprintf("%d left and %d sold, but the stock was %d", stock, sold, inventoryStock)})
+	}
+	return violations
+}
@@ -0,0 +1,31 @@
+package sim
+
+import (
+	"context"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestOversellGuards verifies CompareAndSet and the non-negative
+// constraint each sell exactly the stock, on engines with and without
+// locks
+func TestOversellGuards(t *testing.T) {
+	for _, guard := range []int{guardCompareAndSet, guardNonNegativeRule} {
+		for _, d := range []*db.Database{simulated(db.NewTwoPhaseLockingDatabase()), simulated(db.NewMVCCDatabase())} {
+			result := RunRegisteredScenario(context.Background(), d, "oversell", Params{"guard": guard, "clients": 4, "orders": 30})
+			if !result.Passed {
+				t.Errorf("guard %d on %s: %+v", guard, result.Engine, result.Metrics)
+			}
+		}
+	}
+}
+
+// TestOversellRejectsUnknownGuard verifies a guard outside 0-2 fails the
+// run instead of running unguarded
+func TestOversellRejectsUnknownGuard(t *testing.T) {
+	result := RunRegisteredScenario(context.Background(), db.NewTwoPhaseLockingDatabase(), "oversell", Params{"guard": 3})
+	if result.Passed {
+		t.Error("guard 3 passed")
+	}
+}
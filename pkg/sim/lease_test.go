@@ -0,0 +1,20 @@
+package sim
+
+import (
+	"context"
+	"testing"
+)
+
+// TestLeaseScenario verifies fencing keeps every increment, and ignoring
+// it loses some when nodes stall past their leases
+func TestLeaseScenario(t *testing.T) {
+	noLeaks(t)
+	fenced := RunLeaseScenario(context.Background(), 1, true, 4, 25)
+	if !fenced.Passed {
+		t.Errorf("Expected no lost increments with fencing: %+v", fenced.Metrics)
+	}
+	unfenced := RunLeaseScenario(context.Background(), 1, false, 4, 25)
+	if unfenced.Metrics["stalls"] > 0 && unfenced.Metrics["expired_leases"] == 0 {
+		t.Errorf("Expected stalls to outlive leases: %+v", unfenced.Metrics)
+	}
+}
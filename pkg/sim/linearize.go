@@ -0,0 +1,420 @@
+package sim
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// Linearizability. A history of operations is linearizable if each
+// operation can be given a single instant between its invocation and its
+// response at which it took effect, such that taken in that order the
+// operations obey the object's sequential specification: every read
+// returns the value last written, every add the sum so far. It is the
+// strongest verdict a run can get: where the other scenarios spot-check a
+// final value, the checker accounts for every response a client saw.
+//
+// Clients record each operation with a HistoryRecorder as they invoke it
+// and when it returns. CheckLinearizable then searches for a valid order,
+// one key at a time (linearizability is local, so a history is
+// linearizable if each key's is), in the manner of Wing and Gong's
+// algorithm: take in turn each operation that can go next, one whose
+// invocation precedes every outstanding response, and backtrack when the
+// model rejects it, remembering the states already ruled out.
+
+// A HistoryOp is one call in a recorded history: what a client asked of a
+// key and what it got back, bracketed by its invocation and response
+type HistoryOp struct {
+	Client int
+	Kind   db.OpKind // OpRead, OpWrite, or OpUpdate for an add
+	Key    string
+	Input  int   // Value written or delta added
+	Output int   // Value read, or the value an add produced
+	Call   int64 // Position of the invocation in the history
+	Return int64 // Position of the response; 0 while the outcome is unknown
+}
+
+func (op HistoryOp) String() string {
+	switch op.Kind {
+	case db.OpRead:
+		return fmt.Sprintf("client %d: read %s -> %d", op.Client, op.Key, op.Output)
+	case db.OpWrite:
+		return fmt.Sprintf("client %d: write %s = %d", op.Client, op.Key, op.Input)
+	default:
+		return fmt.Sprintf("client %d: add %+d to %s -> %d", op.Client, op.Input, op.Key, op.Output)
+	}
+}
+
+// pending reports whether op's response is unknown, so its output is too
+func (op HistoryOp) pending() bool {
+	return op.Return == 0
+}
+
+// A HistoryRecorder records the operations clients invoke and their
+// responses, in the order they happen. It is safe for concurrent use.
+type HistoryRecorder struct {
+	mu     sync.Mutex
+	clock  int64
+	ops    []HistoryOp
+	failed []bool
+}
+
+// NewHistoryRecorder returns an empty recorder
+func NewHistoryRecorder() *HistoryRecorder {
+	return &HistoryRecorder{}
+}
+
+// Invoke records that client invoked an operation on key, and returns its
+// id for Complete or Fail
+func (r *HistoryRecorder) Invoke(client int, kind db.OpKind, key string, input int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clock++
+	r.ops = append(r.ops, HistoryOp{Client: client, Kind: kind, Key: key, Input: input, Call: r.clock})
+	r.failed = append(r.failed, false)
+	return len(r.ops) - 1
+}
+
+// Complete records that operation id returned output
+func (r *HistoryRecorder) Complete(id int, output int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clock++
+	r.ops[id].Output = output
+	r.ops[id].Return = r.clock
+}
+
+// Fail records that operation id certainly did not take effect, such as a
+// write whose transaction aborted; it is left out of the history. An
+// operation neither completed nor failed may or may not have taken effect.
+func (r *HistoryRecorder) Fail(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed[id] = true
+}
+
+// Operations returns the recorded history, in invocation order
+func (r *HistoryRecorder) Operations() []HistoryOp {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ops := make([]HistoryOp, 0, len(r.ops))
+	for i, op := range r.ops {
+		if !r.failed[i] {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// A SequentialModel is the specification of the object behind each key:
+// its initial state, and the state an operation leaves it in, or false if
+// the operation's output is impossible in the state it is applied to. An
+// operation without a response has no output to check, only its effect.
+type SequentialModel struct {
+	Name string
+	Init int
+	Step func(state int, op HistoryOp) (int, bool)
+}
+
+// RegisterModel is a register starting at 0: reads return the last value
+// written
+var RegisterModel = SequentialModel{
+	Name: "register",
+	Step: func(state int, op HistoryOp) (int, bool) {
+		switch op.Kind {
+		case db.OpRead:
+			return state, op.pending() || op.Output == state
+		case db.OpWrite:
+			return op.Input, true
+		default:
+			return state, false
+		}
+	},
+}
+
+// CounterModel is a counter starting at 0: adds return the sum so far and
+// reads the current one
+var CounterModel = SequentialModel{
+	Name: "counter",
+	Step: func(state int, op HistoryOp) (int, bool) {
+		switch op.Kind {
+		case db.OpRead:
+			return state, op.pending() || op.Output == state
+		case db.OpUpdate:
+			return state + op.Input, op.pending() || op.Output == state+op.Input
+		default:
+			return state, false
+		}
+	},
+}
+
+// linearizabilitySearchLimit bounds the orders CheckLinearizable tries per
+// key before giving up without a verdict
+const linearizabilitySearchLimit = 1_000_000
+
+// LinearizabilityResult is CheckLinearizable's verdict
+type LinearizabilityResult struct {
+	Linearizable bool
+	Inconclusive bool        // The search limit was reached; no verdict
+	Key          string      // The first key whose history is not linearizable
+	Operations   []HistoryOp // That key's history, in invocation order
+	Explored     int         // Orders tried, over every key
+}
+
+// CheckLinearizable reports whether ops, every key's operations checked
+// against model, is linearizable. Operations without a response may be
+// placed anywhere after their invocation, or left out.
+func CheckLinearizable(ops []HistoryOp, model SequentialModel) LinearizabilityResult {
+	byKey := make(map[string][]HistoryOp)
+	for _, op := range ops {
+		byKey[op.Key] = append(byKey[op.Key], op)
+	}
+	keys := make([]string, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := LinearizabilityResult{Linearizable: true}
+	for _, key := range keys {
+		history := byKey[key]
+		sort.Slice(history, func(i, j int) bool { return history[i].Call < history[j].Call })
+		s := newLinearizationSearch(history, model)
+		linearizable := s.search(model.Init)
+		result.Explored += s.explored
+		if s.explored > linearizabilitySearchLimit {
+			result.Linearizable, result.Inconclusive, result.Key = false, true, key
+			return result
+		}
+		if !linearizable {
+			result.Linearizable, result.Key, result.Operations = false, key, history
+			return result
+		}
+	}
+	return result
+}
+
+// linearizationSearch is the backtracking search for one key's
+// linearization
+type linearizationSearch struct {
+	ops       []HistoryOp // By invocation
+	model     SequentialModel
+	done      []uint64 // Bit set of the operations linearized so far
+	remaining int      // Operations with a response not yet linearized
+	ruledOut  map[string]bool
+	explored  int
+}
+
+func newLinearizationSearch(ops []HistoryOp, model SequentialModel) *linearizationSearch {
+	s := &linearizationSearch{
+		ops:      ops,
+		model:    model,
+		done:     make([]uint64, (len(ops)+63)/64),
+		ruledOut: make(map[string]bool),
+	}
+	for _, op := range ops {
+		if op.Return != 0 {
+			s.remaining++
+		}
+	}
+	return s
+}
+
+// search reports whether the operations not yet linearized can follow in
+// some order from state
+func (s *linearizationSearch) search(state int) bool {
+	if s.remaining == 0 {
+		return true
+	}
+	if s.explored++; s.explored > linearizabilitySearchLimit {
+		return false
+	}
+	memo := s.memoKey(state)
+	if s.ruledOut[memo] {
+		return false
+	}
+
+	// An operation can go next if it was invoked before every outstanding
+	// response; one invoked later must follow the operation that returned
+	var deadline int64 = 1<<63 - 1
+	for i, op := range s.ops {
+		if !s.isDone(i) && op.Return != 0 {
+			deadline = min(deadline, op.Return)
+		}
+	}
+	for i, op := range s.ops {
+		if op.Call > deadline {
+			break
+		}
+		if s.isDone(i) {
+			continue
+		}
+		next, ok := s.model.Step(state, op)
+		if !ok {
+			continue
+		}
+		s.setDone(i, true)
+		found := s.search(next)
+		s.setDone(i, false)
+		if found {
+			return true
+		}
+	}
+	s.ruledOut[memo] = true
+	return false
+}
+
+func (s *linearizationSearch) isDone(i int) bool {
+	return s.done[i/64]&(1<<(i%64)) != 0
+}
+
+// setDone marks operation i linearized, or no longer
+func (s *linearizationSearch) setDone(i int, done bool) {
+	if done {
+		s.done[i/64] |= 1 << (i % 64)
+	} else {
+		s.done[i/64] &^= 1 << (i % 64)
+	}
+	if s.ops[i].Return != 0 {
+		if done {
+			s.remaining--
+		} else {
+			s.remaining++
+		}
+	}
+}
+
+// memoKey identifies the operations linearized so far and the state they
+// left
+func (s *linearizationSearch) memoKey(state int) string {
+	buf := make([]byte, 8*(len(s.done)+1))
+	for i, word := range s.done {
+		binary.LittleEndian.PutUint64(buf[8*i:], word)
+	}
+	binary.LittleEndian.PutUint64(buf[8*len(s.done):], uint64(state))
+	return string(buf)
+}
+
+// RunLinearizabilityScenario has numClients clients each run opsPerClient
+// random operations on d, each its own transaction: writes and reads of
+// a register, and adds to and reads of a counter, the add reading the
+// counter and writing back the sum. Every invocation and response is
+// recorded, and afterwards each key's history is checked for
+// linearizability. It passes if both are linearizable.
+func RunLinearizabilityScenario(ctx context.Context, d *db.Database, numClients int, opsPerClient int) ScenarioResult {
+	const register, counter = "lin_register", "lin_counter"
+	result := newScenarioResult("linearizability", d, map[string]any{
+		"clients":        numClients,
+		"ops_per_client": opsPerClient,
+	})
+	result.Seed = db.NewRunSeed()
+
+	fmt.Printf("\n=== Linearizability Scenario (%s) ===\n", d.EngineName())
+	fmt.Printf("%d clients x %d operations on a register and a counter, every invocation and response recorded\n",
+		numClients, opsPerClient)
+	setup := d.BeginTransaction()
+	d.Write(setup, register, 0)
+	d.Write(setup, counter, 0)
+	d.Commit(setup)
+
+	recorder := NewHistoryRecorder()
+	var wg sync.WaitGroup
+	for i := 1; i <= numClients; i++ {
+		wg.Add(1)
+		go func(ctx context.Context, client int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(result.Seed + int64(client)))
+			for j := 0; j < opsPerClient && ctx.Err() == nil; j++ {
+				var id, output int
+				var err error
+				switch rng.Intn(4) {
+				case 0:
+					value := client*opsPerClient + j + 1 // Unique, so a read shows which write it saw
+					id = recorder.Invoke(client, db.OpWrite, register, value)
+					err = d.RunTransactionCtx(ctx, func(tx *db.Transaction) error {
+						return d.Put(tx, register, value)
+					})
+				case 1:
+					id = recorder.Invoke(client, db.OpRead, register, 0)
+					err = d.RunTransactionCtx(ctx, func(tx *db.Transaction) error {
+						output, err = d.Get(tx, register)
+						return err
+					})
+				case 2:
+					id = recorder.Invoke(client, db.OpUpdate, counter, 1)
+					err = d.RunTransactionCtx(ctx, func(tx *db.Transaction) error {
+						value, err := d.Get(tx, counter)
+						if err != nil {
+							return err
+						}
+						output = value + 1
+						return d.Put(tx, counter, output)
+					})
+				default:
+					id = recorder.Invoke(client, db.OpRead, counter, 0)
+					err = d.RunTransactionCtx(ctx, func(tx *db.Transaction) error {
+						output, err = d.Get(tx, counter)
+						return err
+					})
+				}
+				switch {
+				case err == nil:
+					recorder.Complete(id, output)
+				case ctx.Err() == nil:
+					recorder.Fail(id) // Aborted: it did not take effect
+				}
+			}
+		}(db.WithClient(ctx, i), i)
+	}
+	wg.Wait()
+
+	history := recorder.Operations()
+	completed := 0
+	for _, op := range history {
+		if op.Return != 0 {
+			completed++
+		}
+	}
+	result.Partial = reportPartial(ctx, len(history), numClients*opsPerClient, "operations")
+
+	var registerOps, counterOps []HistoryOp
+	for _, op := range history {
+		if op.Key == register {
+			registerOps = append(registerOps, op)
+		} else {
+			counterOps = append(counterOps, op)
+		}
+	}
+	fmt.Printf("\nRecorded %d operations, %d with a response\n", len(history), completed)
+	verdicts, violations := 0, 0
+	explored := 0
+	for _, check := range []struct {
+		ops   []HistoryOp
+		model SequentialModel
+	}{{registerOps, RegisterModel}, {counterOps, CounterModel}} {
+		verdict := CheckLinearizable(check.ops, check.model)
+		explored += verdict.Explored
+		switch {
+		case verdict.Linearizable:
+			verdicts++
+			fmt.Printf("✓ The %s's %d operations are linearizable\n", check.model.Name, len(check.ops))
+		case verdict.Inconclusive:
+			fmt.Printf("❌ The %s's history is too tangled to check within %d steps\n", check.model.Name, linearizabilitySearchLimit)
+		default:
+			violations++
+			fmt.Printf("❌ NOT LINEARIZABLE: no order of the %s's %d operations explains every response\n", check.model.Name, len(check.ops))
+		}
+	}
+
+	result.Passed = verdicts == 2
+	result.Metrics["operations"] = float64(len(history))
+	result.Metrics["linearizable"] = float64(verdicts) / 2
+	result.Metrics["non_linearizable"] = float64(violations)
+	result.Metrics["explored"] = float64(explored)
+	return result.finish(d)
+}
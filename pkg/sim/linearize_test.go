@@ -0,0 +1,83 @@
+package sim
+
+import (
+	"context"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// histOp returns an operation on key x invoked at call and returning at ret
+func histOp(kind db.OpKind, input, output int, call, ret int64) HistoryOp {
+	return HistoryOp{Kind: kind, Key: "x", Input: input, Output: output, Call: call, Return: ret}
+}
+
+// TestCheckLinearizable verifies hand-built histories get the right verdict
+func TestCheckLinearizable(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   SequentialModel
+		history []HistoryOp
+		want    bool
+	}{
+		{"read overlapping a write may see either value", RegisterModel, []HistoryOp{
+			histOp(db.OpWrite, 1, 0, 1, 4), histOp(db.OpRead, 0, 0, 2, 3), histOp(db.OpRead, 0, 1, 5, 6),
+		}, true},
+		{"stale read after the write returned", RegisterModel, []HistoryOp{
+			histOp(db.OpWrite, 1, 0, 1, 2), histOp(db.OpRead, 0, 0, 3, 4),
+		}, false},
+		{"reads see writes in different orders", RegisterModel, []HistoryOp{
+			histOp(db.OpWrite, 1, 0, 1, 10), histOp(db.OpWrite, 2, 0, 2, 10),
+			histOp(db.OpRead, 0, 1, 3, 4), histOp(db.OpRead, 0, 2, 5, 6), histOp(db.OpRead, 0, 1, 7, 8),
+		}, false},
+		{"a pending write may have taken effect", RegisterModel, []HistoryOp{
+			histOp(db.OpWrite, 1, 0, 1, 0), histOp(db.OpRead, 0, 1, 2, 3),
+		}, true},
+		{"or not", RegisterModel, []HistoryOp{
+			histOp(db.OpWrite, 1, 0, 1, 0), histOp(db.OpRead, 0, 0, 2, 3),
+		}, true},
+		{"concurrent adds", CounterModel, []HistoryOp{
+			histOp(db.OpUpdate, 1, 2, 1, 4), histOp(db.OpUpdate, 1, 1, 2, 3), histOp(db.OpRead, 0, 2, 5, 6),
+		}, true},
+		{"a pending add may have taken effect", CounterModel, []HistoryOp{
+			histOp(db.OpUpdate, 1, 0, 1, 0), histOp(db.OpRead, 0, 1, 2, 3),
+		}, true},
+		{"a pending read sees any value", RegisterModel, []HistoryOp{
+			histOp(db.OpWrite, 1, 0, 1, 2), histOp(db.OpRead, 0, 0, 3, 0),
+		}, true},
+		{"lost update", CounterModel, []HistoryOp{
+			histOp(db.OpUpdate, 1, 1, 1, 3), histOp(db.OpUpdate, 1, 1, 2, 4),
+		}, false},
+	}
+	for _, tt := range tests {
+		result := CheckLinearizable(tt.history, tt.model)
+		if result.Linearizable != tt.want || result.Inconclusive {
+			t.Errorf("%s: %+v, expected linearizable %v", tt.name, result, tt.want)
+		}
+	}
+}
+
+// TestHistoryRecorderDropsFailed verifies failed operations are left out
+// and unanswered ones kept without a response
+func TestHistoryRecorderDropsFailed(t *testing.T) {
+	r := NewHistoryRecorder()
+	done := r.Invoke(1, db.OpWrite, "x", 1)
+	failed := r.Invoke(2, db.OpWrite, "x", 2)
+	r.Invoke(3, db.OpRead, "x", 0)
+	r.Complete(done, 0)
+	r.Fail(failed)
+
+	ops := r.Operations()
+	if len(ops) != 2 || ops[0].Return == 0 || ops[1].Return != 0 || ops[1].Client != 3 {
+		t.Errorf("history %v, expected client 1's write answered and client 3's read pending", ops)
+	}
+}
+
+// TestLinearizabilityScenario verifies two-phase locking's history is
+// linearizable
+func TestLinearizabilityScenario(t *testing.T) {
+	result := RunLinearizabilityScenario(context.Background(), db.NewTwoPhaseLockingDatabase(), 4, 30)
+	if !result.Passed || result.Metrics["linearizable"] != 1 {
+		t.Errorf("%+v", result.Metrics)
+	}
+}
@@ -0,0 +1,24 @@
+package sim
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// logScenario traces a finished scenario's result
+func logScenario(result ScenarioResult) {
+	logger := db.TraceLogger()
+	if logger == nil {
+		return
+	}
+	logger.LogAttrs(context.Background(), slog.LevelInfo, "scenario finished",
+		slog.String("scenario", result.Name),
+		slog.String("engine", result.Engine),
+		slog.Bool("passed", result.Passed),
+		slog.Bool("partial", result.Partial),
+		slog.Duration("duration", result.Duration.Round(time.Microsecond)),
+	)
+}
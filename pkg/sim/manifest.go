@@ -0,0 +1,123 @@
+package sim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunManifest records how a run was configured, what it ran on and what
+// came out of it, so experiments in lab reports can be reproduced and
+// compared across machines and synchronization strategies
+type RunManifest struct {
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	Args        []string
+	Flags       map[string]string // Every flag's effective value
+	Environment RunEnvironment
+	Scenarios   []ScenarioResult
+	Summary     ManifestSummary
+
+	// SnapshotDir, if set, is where Run saves each scenario's final
+	// database state, as <index>_<name>.json
+	SnapshotDir string `json:"-"`
+
+	// Results, if set, gets each scenario's result as Run records it
+	Results *ResultsFile `json:"-"`
+}
+
+// RunEnvironment describes the machine and runtime of a run
+type RunEnvironment struct {
+	GoVersion  string
+	GOOS       string
+	GOARCH     string
+	GOMAXPROCS int
+	NumCPU     int
+	Hostname   string
+}
+
+// ManifestSummary counts scenario outcomes
+type ManifestSummary struct {
+	Scenarios int
+	Passed    int
+	Failed    int
+	Partial   int
+}
+
+// NewRunManifest starts a manifest for a run with the given arguments.
+// The caller records the effective flag values in its Flags.
+func NewRunManifest(args []string) *RunManifest {
+	hostname, _ := os.Hostname()
+	m := &RunManifest{
+		StartedAt: time.Now(),
+		Args:      args,
+		Flags:     make(map[string]string),
+		Environment: RunEnvironment{
+			GoVersion:  runtime.Version(),
+			GOOS:       runtime.GOOS,
+			GOARCH:     runtime.GOARCH,
+			GOMAXPROCS: runtime.GOMAXPROCS(0),
+			NumCPU:     runtime.NumCPU(),
+			Hostname:   hostname,
+		},
+	}
+	return m
+}
+
+// Run runs a scenario under a context bounded by ScenarioBudget and
+// records its result
+func (m *RunManifest) Run(scenario func(ctx context.Context) ScenarioResult) ScenarioResult {
+	ctx, cancel := NewScenarioContext()
+	defer cancel()
+
+	leaks := startLeakCheck()
+	result := scenario(ctx)
+	leaks.check(&result)
+	if m.SnapshotDir != "" && result.final != nil {
+		path := filepath.Join(m.SnapshotDir, fmt.Sprintf("%02d_%s.json", len(m.Scenarios)+1, result.Name))
+		if err := db.WriteSnapshot(path, *result.final); err != nil {
+			fmt.Fprintf(os.Stderr, "saving snapshot: %v\n", err)
+		} else {
+			result.Snapshot = path
+		}
+	}
+	result.final = nil
+	logScenario(result)
+	m.Add(result)
+	if m.Results != nil {
+		if err := m.Results.Add(len(m.Scenarios), result); err != nil {
+			fmt.Fprintf(os.Stderr, "writing results: %v\n", err)
+		}
+	}
+	return result
+}
+
+// Add records a scenario result
+func (m *RunManifest) Add(result ScenarioResult) {
+	m.Scenarios = append(m.Scenarios, result)
+	m.Summary.Scenarios++
+	if result.Passed {
+		m.Summary.Passed++
+	} else {
+		m.Summary.Failed++
+	}
+	if result.Partial {
+		m.Summary.Partial++
+	}
+}
+
+// WriteFile finishes the manifest and writes it to path as indented JSON
+func (m *RunManifest) WriteFile(path string) error {
+	m.FinishedAt = time.Now()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,73 @@
+package sim
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestRunManifestWriteFile tests that a manifest round-trips through JSON
+// with its environment, scenario results and summary
+func TestRunManifestWriteFile(t *testing.T) {
+	manifest := NewRunManifest([]string{"-budget", "1s"})
+	manifest.Run(func(ctx context.Context) ScenarioResult {
+		return RunCounterScenario(ctx, db.NewTwoPhaseLockingDatabase(), 2, 5)
+	})
+	manifest.Add(ScenarioResult{Name: "failing", Partial: true})
+
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	if err := manifest.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading manifest: %v", err)
+	}
+	var decoded RunManifest
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("manifest is not valid JSON: %v", err)
+	}
+
+	if decoded.Environment.GOMAXPROCS == 0 || decoded.Environment.GoVersion == "" {
+		t.Errorf("environment not captured: %+v", decoded.Environment)
+	}
+	if len(decoded.Scenarios) != 2 || decoded.Scenarios[0].Engine != "two-phase-locking" {
+		t.Fatalf("unexpected scenarios: %+v", decoded.Scenarios)
+	}
+	if got := decoded.Scenarios[0].Metrics["final_value"]; got != 10 {
+		t.Errorf("expected final_value=10, got %v", got)
+	}
+	want := ManifestSummary{Scenarios: 2, Passed: 1, Failed: 1, Partial: 1}
+	if decoded.Summary != want {
+		t.Errorf("expected summary %+v, got %+v", want, decoded.Summary)
+	}
+}
+
+// TestRunManifestSavesSnapshots verifies each scenario's final state is
+// saved when the manifest has a snapshot directory
+func TestRunManifestSavesSnapshots(t *testing.T) {
+	manifest := NewRunManifest(nil)
+	manifest.SnapshotDir = t.TempDir()
+	result := manifest.Run(func(ctx context.Context) ScenarioResult {
+		return RunCounterScenario(ctx, db.NewTwoPhaseLockingDatabase(), 2, 5)
+	})
+
+	if result.Snapshot == "" {
+		t.Fatal("No snapshot recorded in the scenario result")
+	}
+	if _, err := os.Stat(result.Snapshot); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := db.LoadSnapshot(result.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := snapshot.Entries["counter"]; entry.Value != 10 {
+		t.Errorf("Saved counter = %d, want 10", entry.Value)
+	}
+}
@@ -0,0 +1,256 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// Model checking. RunModelCheck runs two or three copies of a small
+// transaction under every interleaving the deterministic scheduler can
+// produce (see schedule.go), checks an invariant on the state each leaves,
+// and prints the interleavings that break it step by step. Where the race
+// demos only show that an anomaly can happen, this shows exactly which
+// orders of operations cause it. Each interleaving runs on a simulated
+// clock (see clock.go), so the operations' processing time costs nothing.
+
+// modelProgram is a small transaction to model check, with the data it
+// starts from and the invariant its copies must keep
+type modelProgram struct {
+	summary   string
+	setup     func(threads int) map[string]int
+	run       func(ctx context.Context, d *db.Database, thread int, threads int)
+	invariant func(threads int) db.Invariant
+}
+
+// modelPrograms are the transactions modelcheck can check, by name
+var modelPrograms = map[string]modelProgram{
+	"lost-update": {
+		summary: "each thread reads x, writes back x+1 and marks itself done",
+		setup: func(int) map[string]int {
+			return map[string]int{"x": 0}
+		},
+		run: func(ctx context.Context, d *db.Database, thread int, _ int) {
+			tx := d.BeginTransactionCtx(ctx)
+			x, ok := d.Read(tx, "x")
+			if !ok || !d.Write(tx, "x", x+1) || !d.Write(tx, fmt.Sprintf("done_%d", thread), 1) {
+				d.Abort(tx)
+				return
+			}
+			d.Commit(tx)
+		},
+		invariant: func(threads int) db.Invariant {
+			keys := []string{"x"}
+			for i := 1; i <= threads; i++ {
+				keys = append(keys, fmt.Sprintf("done_%d", i))
+			}
+			return db.Invariant{
+				Name: "x == " + strings.Join(keys[1:], " + "),
+				Keys: keys,
+				Check: func(values map[string]int) error {
+					done := 0
+					for _, key := range keys[1:] {
+						done += values[key]
+					}
+					if values["x"] != done {
+						return fmt.Errorf("x = %d after %d committed increments", values["x"], done)
+					}
+					return nil
+				},
+			}
+		},
+	},
+	"transfer": {
+		summary: "each thread moves 10 from one account to the next, reading both first",
+		setup: func(threads int) map[string]int {
+			accounts := make(map[string]int)
+			for i := 1; i <= max(threads, 2); i++ {
+				accounts[fmt.Sprintf("account_%d", i)] = 100
+			}
+			return accounts
+		},
+		run: func(ctx context.Context, d *db.Database, thread int, threads int) {
+			n := max(threads, 2)
+			from, to := fmt.Sprintf("account_%d", thread), fmt.Sprintf("account_%d", thread%n+1)
+			tx := d.BeginTransactionCtx(ctx)
+			a, okA := d.Read(tx, from)
+			b, okB := d.Read(tx, to)
+			if !okA || !okB || !d.Write(tx, from, a-10) || !d.Write(tx, to, b+10) {
+				d.Abort(tx)
+				return
+			}
+			d.Commit(tx)
+		},
+		invariant: func(threads int) db.Invariant {
+			var keys []string
+			for i := 1; i <= max(threads, 2); i++ {
+				keys = append(keys, fmt.Sprintf("account_%d", i))
+			}
+			return db.SumInvariant(100*len(keys), keys...)
+		},
+	},
+	"write-skew": {
+		summary: "each doctor goes off call if the others' records show at least two on call",
+		setup: func(threads int) map[string]int {
+			doctors := make(map[string]int)
+			for i := 1; i <= threads; i++ {
+				doctors[fmt.Sprintf("on_call_%d", i)] = 1
+			}
+			return doctors
+		},
+		run: func(ctx context.Context, d *db.Database, thread int, threads int) {
+			tx := d.BeginTransactionCtx(ctx)
+			onCall := 0
+			for i := 1; i <= threads; i++ {
+				value, ok := d.Read(tx, fmt.Sprintf("on_call_%d", i))
+				if !ok {
+					d.Abort(tx)
+					return
+				}
+				onCall += value
+			}
+			if onCall < 2 || !d.Write(tx, fmt.Sprintf("on_call_%d", thread), 0) {
+				d.Abort(tx)
+				return
+			}
+			d.Commit(tx)
+		},
+		invariant: func(threads int) db.Invariant {
+			var keys []string
+			for i := 1; i <= threads; i++ {
+				keys = append(keys, fmt.Sprintf("on_call_%d", i))
+			}
+			return db.Invariant{
+				Name: "at least one doctor on call",
+				Keys: keys,
+				Check: func(values map[string]int) error {
+					for _, key := range keys {
+						if values[key] > 0 {
+							return nil
+						}
+					}
+					return fmt.Errorf("nobody is on call")
+				},
+			}
+		},
+	},
+}
+
+// modelProgramNames returns the names of modelPrograms, sorted
+func modelProgramNames() []string {
+	names := make([]string, 0, len(modelPrograms))
+	for name := range modelPrograms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// modelProgramFlag is a -program flag naming one of modelPrograms
+type modelProgramFlag struct{ name string }
+
+func (p *modelProgramFlag) String() string { return p.name }
+
+func (p *modelProgramFlag) Set(name string) error {
+	if _, exists := modelPrograms[name]; !exists {
+		return fmt.Errorf("unknown program %q: expected one of %s", name, strings.Join(modelProgramNames(), ", "))
+	}
+	p.name = name
+	return nil
+}
+
+// RunModelCheck runs threads copies of the named program on databases
+// from open under every interleaving, up to limit of them, and reports
+// each one that leaves the program's invariant broken, the first step by
+// step. It passes if none does.
+func RunModelCheck(ctx context.Context, open func() *db.Database, name string, threads int, limit int) ScenarioResult {
+	const shown = 5 // Violating interleavings listed after the first
+
+	program := modelPrograms[name]
+	invariant := program.invariant(threads)
+	result := newScenarioResult("modelcheck", open(), map[string]any{
+		"program": name,
+		"threads": threads,
+		"limit":   limit,
+	})
+
+	fmt.Printf("\n=== Model Check (%s, %d transactions, %s) ===\n", name, threads, result.Engine)
+	fmt.Printf("Program: %s\nInvariant: %s\n", program.summary, invariant.Name)
+
+	var outcomes []string // What each violating interleaving left, by index into Failures
+	last := open()        // The database of the latest interleaving, for its statistics
+	exploration := db.ExploreAll(func(s *db.Scheduler) error {
+		if ctx.Err() != nil {
+			return nil // Out of budget: running no threads ends the exploration
+		}
+		d := open()
+		d.SetClock(db.NewSimClock(time.Time{}))
+		last = d
+		setup := d.BeginTransaction()
+		for key, value := range program.setup(threads) {
+			d.Write(setup, key, value)
+		}
+		d.Commit(setup)
+
+		runs := make([]func(context.Context), threads)
+		for i := range runs {
+			thread := i + 1
+			runs[i] = func(ctx context.Context) { program.run(ctx, d, thread, threads) }
+		}
+		s.Run(ctx, runs...)
+
+		entries := d.TakeSnapshot().Entries
+		values := make(map[string]int, len(invariant.Keys))
+		for _, key := range invariant.Keys {
+			if entry, exists := entries[key]; exists && !entry.Deleted {
+				values[key] = entry.Value
+			}
+		}
+		err := invariant.Check(values)
+		if err != nil {
+			var state []string
+			for _, key := range invariant.Keys {
+				state = append(state, fmt.Sprintf("%s=%d", key, values[key]))
+			}
+			outcomes = append(outcomes, strings.Join(state, " "))
+		}
+		return err
+	}, limit)
+	result.Partial = reportPartial(ctx, exploration.Schedules, limit, "interleavings")
+
+	if exploration.Complete {
+		fmt.Printf("\nExplored all %d interleavings\n", exploration.Schedules)
+	} else {
+		fmt.Printf("\nExplored %d interleavings, stopping at the limit before trying them all\n", exploration.Schedules)
+	}
+	failures := exploration.Failures
+	if len(failures) == 0 {
+		fmt.Printf("✓ No interleaving broke %s\n", invariant.Name)
+	} else {
+		fmt.Printf("❌ %d of %d interleavings broke %s. The first, step by step:\n", len(failures), exploration.Schedules, invariant.Name)
+		for i, step := range failures[0].Steps {
+			fmt.Printf("   %2d. %v\n", i+1, step)
+		}
+		fmt.Printf("   => %s: %v\n", outcomes[0], failures[0].Err)
+		for i, failure := range failures[1:min(len(failures), shown+1)] {
+			var steps []string
+			for _, step := range failure.Steps {
+				steps = append(steps, fmt.Sprintf("T%d:%s", step.Thread, strings.TrimSpace(step.Op+" "+step.Key)))
+			}
+			fmt.Printf("   %s => %s\n", strings.Join(steps, ", "), outcomes[i+1])
+		}
+		if len(failures) > shown+1 {
+			fmt.Printf("   ... and %d more\n", len(failures)-shown-1)
+		}
+	}
+
+	result.Passed = len(failures) == 0
+	result.Metrics["interleavings"] = float64(exploration.Schedules)
+	result.Metrics["violating_interleavings"] = float64(len(failures))
+	result.Metrics["violations"] = float64(len(failures))
+	return result.finish(last)
+}
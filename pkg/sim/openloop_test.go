@@ -0,0 +1,67 @@
+package sim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestOpenLoopArrivalRate verifies an open-loop client issues transactions
+// at about its target rate and accounts for every one of them
+func TestOpenLoopArrivalRate(t *testing.T) {
+	d := db.NewTwoPhaseLockingDatabase()
+	c := NewClient(ClientConfig{ID: 1, OperationsPerTx: 2, Seed: 1}, d)
+	report := c.RunOpenLoop(context.Background(), 2000, 200*time.Millisecond)
+
+	if report.Arrivals < 250 || report.Arrivals > 550 {
+		t.Errorf("%d arrivals in 200ms at 2000/s, expected about 400", report.Arrivals)
+	}
+	if report.Issued+report.Dropped != report.Arrivals || report.Completed != report.Issued {
+		t.Errorf("arrivals unaccounted for: %+v", report)
+	}
+	if report.Latency.Count != report.Completed {
+		t.Errorf("%d latencies recorded for %d transactions", report.Latency.Count, report.Completed)
+	}
+	if stats := d.Stats(); stats.Commits+stats.Aborts != report.Completed {
+		t.Errorf("%d commits and %d aborts for %d transactions", stats.Commits, stats.Aborts, report.Completed)
+	}
+}
+
+// TestOpenLoopQueuesBehindStall verifies arrivals keep coming while the
+// database is stalled, and that their wait shows in the response times
+func TestOpenLoopQueuesBehindStall(t *testing.T) {
+	d := db.NewTwoPhaseLockingDatabase()
+	holder := d.BeginTransaction()
+	d.Write(holder, "counter", 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		d.Commit(holder)
+	}()
+
+	c := NewClient(ClientConfig{ID: 1, OperationsPerTx: 1, Keys: []string{"counter"}, Mix: OperationMix{Write: 1}, Seed: 1}, d)
+	report := c.RunOpenLoop(context.Background(), 1000, 50*time.Millisecond)
+
+	if report.Issued < 20 {
+		t.Errorf("only %d transactions issued behind the stall; arrivals waited for completions", report.Issued)
+	}
+	if report.Latency.P50 < 40*time.Millisecond {
+		t.Errorf("median response time %v, expected most transactions to wait out the 100ms stall", report.Latency.P50)
+	}
+	if report.Completed != report.Issued {
+		t.Errorf("%d of %d issued transactions completed", report.Completed, report.Issued)
+	}
+}
+
+// TestOpenLoopScenario verifies the scenario accounts for every arrival
+func TestOpenLoopScenario(t *testing.T) {
+	noLeaks(t)
+	result := RunOpenLoopScenario(context.Background(), db.NewTwoPhaseLockingDatabase(), []float64{500, 3000}, 100*time.Millisecond)
+	if !result.Passed {
+		t.Errorf("open-loop scenario failed: %+v", result.Metrics)
+	}
+	if result.Metrics["rate_3000_throughput"] <= 0 {
+		t.Errorf("no throughput recorded at 3000/s: %+v", result.Metrics)
+	}
+}
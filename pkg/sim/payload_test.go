@@ -0,0 +1,41 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestClientValueSize runs clients whose writes carry payloads, in
+// parallel for the race detector, and checks every written key holds one
+func TestClientValueSize(t *testing.T) {
+	noLeaks(t)
+	for _, engine := range []string{"synchronized", "2pl", "mvcc"} {
+		d, _ := db.OpenDatabase(engine)
+		d.SetProcessingDelays(db.NoProcessingDelays)
+		var wg sync.WaitGroup
+		for id := 1; id <= 4; id++ {
+			config := ClientConfig{ID: id, NumTransactions: 20, OperationsPerTx: 2, NumKeys: 8,
+				Mix: OperationMix{Read: 1, Write: 1}, ValueSize: 256, Seed: int64(id)}
+			wg.Add(1)
+			go NewClient(config, d).Run(context.Background(), &wg)
+		}
+		wg.Wait()
+
+		tx := d.BeginTransaction()
+		values, _ := d.Scan(tx, "key_")
+		for key, value := range values {
+			payload, _ := d.GetBytes(tx, key)
+			if value != 256 || len(payload) != 256 || bytes.Equal(payload, make([]byte, 256)) {
+				t.Errorf("%s: %s = %d with %d payload bytes", engine, key, value, len(payload))
+			}
+		}
+		d.Commit(tx)
+		if n := d.Stats().PayloadBytes; n == 0 || n%256 != 0 {
+			t.Errorf("%s: %d payload bytes, want a multiple of 256", engine, n)
+		}
+	}
+}
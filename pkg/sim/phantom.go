@@ -0,0 +1,164 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// phantomQuota is how many keys the phantom scenario's bookings may add
+// up to under a prefix
+const phantomQuota = 3
+
+// RunPhantomScenario runs rounds of two phantom experiments on d with
+// transactions at level. In the first, a transaction scans a prefix twice
+// while another inserts a key under it; finding a new key the second time
+// is a phantom read. In the second, two transactions each count a prefix's
+// keys and add one if the count is under a quota of three, starting from
+// two; if both commit the quota is exceeded, a write skew on a predicate
+// rather than on keys. Range locks (two-phase locking at Serializable)
+// prevent both; below Serializable, two-phase locking still prevents the
+// overbooking, since its read locks are exclusive and the second count
+// times out on the first, but not the phantom read. Snapshot isolation
+// prevents the phantom read but not the overbooking, which takes SSI's
+// range tracking to catch. A round whose scan fails, such as on a lock
+// timeout, is aborted rather than counted. It passes if neither anomaly
+// occurred.
+func RunPhantomScenario(ctx context.Context, d *db.Database, level db.IsolationLevel, rounds int) ScenarioResult {
+	result := newScenarioResult("phantom", d, map[string]any{
+		"isolation": level.String(),
+		"rounds":    rounds,
+	})
+
+	fmt.Printf("\n=== Phantom Scenario (%s, %s) ===\n", d.EngineName(), level)
+	fmt.Printf("Running %d rounds of a scan repeated around an insert, and of two bookings against a quota of %d\n", rounds, phantomQuota)
+
+	if err := d.CheckIsolation(level); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return result.finish(d)
+	}
+
+	// Range locks make the bookings deadlock; time them out quickly
+	d.SetLockTimeout(20 * time.Millisecond)
+
+	phantomReads, abortedReads, overbooked, refused := 0, 0, 0, 0
+	completed := 0
+	for round := 0; round < rounds && ctx.Err() == nil; round++ {
+		switch phantom, ok := phantomRead(d, level, fmt.Sprintf("phantom_%03d_", round)); {
+		case !ok:
+			abortedReads++ // A scan timed out on the insert's lock
+		case phantom:
+			phantomReads++
+		}
+		booked := bookAgainstQuota(d, level, fmt.Sprintf("quota_%03d_", round))
+		switch {
+		case booked > phantomQuota:
+			overbooked++
+		case booked < phantomQuota:
+			refused++ // Both bookings aborted; harmless but wasted
+		}
+		completed++
+	}
+	result.Partial = reportPartial(ctx, completed, rounds, "rounds")
+
+	fmt.Printf("\nRounds whose repeated scan found a new key: %d of %d (%d with the scanning transaction aborted)\n", phantomReads, completed, abortedReads)
+	fmt.Printf("Rounds that booked past the quota: %d of %d (%d with both bookings aborted)\n", overbooked, completed, refused)
+	if phantomReads > 0 {
+		fmt.Printf("❌ PHANTOM READ: a scan repeated in one transaction changed %d times\n", phantomReads)
+	}
+	if overbooked > 0 {
+		fmt.Printf("❌ PHANTOM WRITE SKEW: two bookings each saw room and the quota was exceeded %d times\n", overbooked)
+	}
+	if phantomReads == 0 && overbooked == 0 {
+		fmt.Println("✓ No phantoms: every scan was repeatable and the quota held")
+	}
+
+	result.Passed = phantomReads == 0 && overbooked == 0
+	result.Metrics["phantom_reads"] = float64(phantomReads)
+	result.Metrics["violations"] = float64(overbooked)
+	result.Metrics["rounds"] = float64(completed)
+	return result.finish(d)
+}
+
+// phantomRead reports whether a transaction at level scanning prefix
+// twice, while another inserts a key under it in between, sees the
+// inserted key the second time, and false as its second result if either
+// scan failed, such as on a lock timeout, and the transaction was aborted
+func phantomRead(d *db.Database, level db.IsolationLevel, prefix string) (bool, bool) {
+	setup := d.BeginTransaction()
+	d.Write(setup, prefix+"a", 1)
+	d.Write(setup, prefix+"b", 1)
+	d.Commit(setup)
+
+	reader := d.BeginTransactionWithIsolation(level)
+	first, ok := d.Scan(reader, prefix)
+
+	inserted := make(chan struct{})
+	go func() {
+		defer close(inserted)
+		tx := d.BeginTransaction()
+		d.Write(tx, prefix+"c", 1)
+		d.Commit(tx)
+	}()
+	// Under a range lock the insert waits for the reader to finish
+	select {
+	case <-inserted:
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	var second map[string]int
+	if ok {
+		second, ok = d.Scan(reader, prefix)
+	}
+	if ok {
+		ok = d.Commit(reader) == nil
+	} else {
+		d.Abort(reader)
+	}
+	<-inserted
+	return ok && len(second) != len(first), ok
+}
+
+// bookAgainstQuota has two transactions at level, each having counted
+// prefix's keys, add one if there are fewer than phantomQuota, and
+// returns how many keys prefix has afterwards
+func bookAgainstQuota(d *db.Database, level db.IsolationLevel, prefix string) int {
+	setup := d.BeginTransaction()
+	for i := 1; i < phantomQuota; i++ {
+		d.Write(setup, fmt.Sprintf("%sbooked_%d", prefix, i), 1)
+	}
+	d.Commit(setup)
+
+	// Both count before either books
+	var bothCounted, wg sync.WaitGroup
+	bothCounted.Add(2)
+	for _, booker := range []string{"alice", "bob"} {
+		wg.Add(1)
+		go func(booker string) {
+			defer wg.Done()
+			tx := d.BeginTransactionWithIsolation(level)
+			booked, ok := d.Scan(tx, prefix)
+			bothCounted.Done()
+			bothCounted.Wait()
+
+			// A booking that could not count must not book
+			if !ok {
+				d.Abort(tx)
+				return
+			}
+			if len(booked) < phantomQuota {
+				d.Write(tx, prefix+booker, 1)
+			}
+			d.Commit(tx)
+		}(booker)
+	}
+	wg.Wait()
+
+	check := d.BeginTransaction()
+	booked, _ := d.Scan(check, prefix)
+	d.Commit(check)
+	return len(booked)
+}
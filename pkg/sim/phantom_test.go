@@ -0,0 +1,46 @@
+package sim
+
+import (
+	"context"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestPhantomScenario checks which engines and levels let phantoms through
+func TestPhantomScenario(t *testing.T) {
+	cases := []struct {
+		name            string
+		newDB           func() *db.Database
+		level           db.IsolationLevel
+		phantomReads    bool
+		quotaOverbooked bool
+	}{
+		{"2pl/RepeatableRead", db.NewTwoPhaseLockingDatabase, db.RepeatableRead, true, false},
+		{"2pl/Serializable", db.NewTwoPhaseLockingDatabase, db.Serializable, false, false},
+		{"mvcc/RepeatableRead", db.NewMVCCDatabase, db.RepeatableRead, false, true},
+		{"mvcc/Serializable", db.NewMVCCDatabase, db.Serializable, false, false},
+		{"tso/RepeatableRead", db.NewTimestampOrderingDatabase, db.RepeatableRead, false, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result := RunPhantomScenario(context.Background(), c.newDB(), c.level, 3)
+			if got := result.Metrics["phantom_reads"] > 0; got != c.phantomReads {
+				t.Errorf("phantom reads = %v, want %v", got, c.phantomReads)
+			}
+			if got := result.Metrics["violations"] > 0; got != c.quotaOverbooked {
+				t.Errorf("quota overbooked = %v, want %v", got, c.quotaOverbooked)
+			}
+			if result.Passed != (!c.phantomReads && !c.quotaOverbooked) {
+				t.Errorf("passed = %v with %+v", result.Passed, result.Metrics)
+			}
+		})
+	}
+
+	// Timestamp ordering cannot keep phantoms out, so it refuses to run
+	// at Serializable rather than claim to
+	result := RunPhantomScenario(context.Background(), db.NewTimestampOrderingDatabase(), db.Serializable, 3)
+	if result.Passed || result.Metrics["rounds"] != 0 {
+		t.Errorf("T/O at Serializable: passed %v after %v rounds, want it refused", result.Passed, result.Metrics["rounds"])
+	}
+}
@@ -0,0 +1,60 @@
+package sim
+
+import (
+	"fmt"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// Phases split a timed run into warm-up, measurement and cool-down. Load
+// runs throughout, but only what the database did while measuring is
+// reported: the warm-up lets caches, lock queues and version chains
+// settle, and the cool-down keeps the load steady until the measurement
+// is over instead of letting it trail off as clients stop.
+type Phases struct {
+	Warmup   time.Duration
+	Measure  time.Duration
+	Cooldown time.Duration
+}
+
+// Total returns how long a run with the phases lasts
+func (p Phases) Total() time.Duration {
+	return p.Warmup + p.Measure + p.Cooldown
+}
+
+// phased reports whether p measures part of a run, leaving out a warm-up
+// or a cool-down
+func (p Phases) phased() bool {
+	return p.Measure > 0 && (p.Warmup > 0 || p.Cooldown > 0)
+}
+
+func (p Phases) String() string {
+	return fmt.Sprintf("%v warm-up, %v measured, %v cool-down", p.Warmup, p.Measure, p.Cooldown)
+}
+
+// track makes result report only d's measurement phase, for a run that
+// started now and ends when done is closed. It returns once the
+// measurement is over, or the run ended before that.
+func (p Phases) track(d db.DB, result *ScenarioResult, done <-chan struct{}) {
+	timer := time.NewTimer(p.Warmup)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-done:
+		fmt.Println("⚠️  The run ended during its warm-up; nothing was measured")
+		result.measureFrom(d)
+		result.measureUntil(d)
+		return
+	}
+
+	result.measureFrom(d)
+	start := time.Now()
+	timer.Reset(p.Measure)
+	select {
+	case <-timer.C:
+	case <-done:
+		fmt.Printf("⚠️  The run ended %v into its %v measurement\n", time.Since(start).Round(time.Millisecond), p.Measure)
+	}
+	result.measureUntil(d)
+}
@@ -0,0 +1,217 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// cutPower copies the storage in dir to a new directory as a power failure
+// at WAL offset n would leave it: the checkpoint, and the first n bytes of
+// the WAL
+func cutPower(dir string, n int64) (string, error) {
+	failed, err := os.MkdirTemp("", "power-failure-")
+	if err != nil {
+		return "", err
+	}
+	checkpoint, err := os.ReadFile(filepath.Join(dir, db.CheckpointFileName))
+	if err == nil {
+		err = os.WriteFile(filepath.Join(failed, db.CheckpointFileName), checkpoint, 0o644)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(failed)
+		return "", err
+	}
+	wal, err := os.ReadFile(filepath.Join(dir, db.WALFileName))
+	if err == nil {
+		err = os.WriteFile(filepath.Join(failed, db.WALFileName), wal[:n], 0o644)
+	}
+	if err != nil {
+		os.RemoveAll(failed)
+		return "", err
+	}
+	return failed, nil
+}
+
+// RunPowerFailureScenario runs bank transfers between four accounts on a
+// durable database from open, checkpointing halfway, then simulates
+// power failures at random offsets of the WAL written after the
+// checkpoint, every other one at the end of a record. The database syncs
+// each commit to disk before acknowledging it. Each transfer also counts
+// itself in a key of its client. For every failure the database recovered
+// from the cut storage must hold every transfer acknowledged by then, so
+// each client's count is exactly its transfers logged before the cut, and
+// no part of the torn one, so the accounts still add up.
+func RunPowerFailureScenario(ctx context.Context, open func() *db.Database, seed int64, numClients int, transfersPerClient int, failures int) ScenarioResult {
+	const (
+		accounts = 4
+		balance  = 1000
+	)
+	primary := open()
+	primary.SetLockTimeout(20 * time.Millisecond) // Break deadlocks quickly
+	result := newScenarioResult("power_failure", primary, map[string]any{
+		"clients":   numClients,
+		"transfers": transfersPerClient,
+		"failures":  failures,
+	})
+	result.Seed = seed
+
+	fmt.Printf("\n=== Power Failure Scenario (WAL cut at random offsets, %s) ===\n", result.Engine)
+	fmt.Printf("Running %d clients with %d transfers each between %d accounts, then recovering from %d power failures\n",
+		numClients, transfersPerClient, accounts, failures)
+
+	dir, err := os.MkdirTemp("", "power-failure-")
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return result.finish(primary)
+	}
+	defer os.RemoveAll(dir)
+	primary.SetSyncCommits(true)
+	if _, err := primary.AttachStorage(dir); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return result.finish(primary)
+	}
+
+	keys := make([]string, accounts)
+	setup := primary.BeginTransaction()
+	for i := range keys {
+		keys[i] = fmt.Sprintf("account_%d", i+1)
+		primary.Write(setup, keys[i], balance)
+	}
+	primary.Commit(setup)
+
+	// Each client's acknowledged transfers, by transaction ID
+	acked := make([][]int, numClients+1)
+	var done atomic.Int64
+	transfer := func(ctx context.Context, client int, rng *rand.Rand) {
+		from, to := rng.Intn(accounts), rng.Intn(accounts-1)
+		if to >= from {
+			to++
+		}
+		amount := 1 + rng.Intn(50)
+		var id int
+		err := primary.RunTransactionCtx(ctx, func(tx *db.Transaction) error {
+			id = tx.ID
+			if err := primary.Add(tx, keys[from], -amount); err != nil {
+				return err
+			}
+			if err := primary.Add(tx, keys[to], amount); err != nil {
+				return err
+			}
+			return primary.Upsert(tx, fmt.Sprintf("transfers_%d", client), 1, 0)
+		})
+		if err == nil {
+			acked[client] = append(acked[client], id)
+			done.Add(1)
+		}
+	}
+	runHalf := func(half int) {
+		var wg sync.WaitGroup
+		for client := 1; client <= numClients; client++ {
+			wg.Add(1)
+			go func(ctx context.Context, client int) {
+				defer wg.Done()
+				rng := rand.New(rand.NewSource(seed + int64(2*client+half)))
+				for i := half; i < transfersPerClient && ctx.Err() == nil; i += 2 {
+					transfer(ctx, client, rng)
+				}
+			}(db.WithClient(ctx, client), client)
+		}
+		wg.Wait()
+	}
+	runHalf(0)
+	checkpointErr := primary.Checkpoint()
+	runHalf(1)
+	result.Partial = reportPartial(ctx, int(done.Load()), numClients*transfersPerClient, "transfers")
+	if err := primary.CloseStorage(); err != nil || checkpointErr != nil {
+		fmt.Printf("❌ %v\n", errors.Join(checkpointErr, err))
+		return result.finish(primary)
+	}
+
+	ends, size, err := db.WALRecordEnds(filepath.Join(dir, db.WALFileName))
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return result.finish(primary)
+	}
+	loggedAt := make(map[int]int64, len(ends)) // Transaction -> end of its record
+	for _, end := range ends {
+		loggedAt[end.TxID] = end.End
+	}
+	fmt.Printf("%d transfers acknowledged; the WAL after the checkpoint holds %d records in %d bytes\n",
+		done.Load(), len(ends), size)
+
+	rng := rand.New(rand.NewSource(seed))
+	var lost, phantom, unbalanced, torn int
+	for i := 0; i < failures && ctx.Err() == nil; i++ {
+		// Every other failure falls between records, tearing none
+		cut := rng.Int63n(size + 1)
+		if i%2 == 0 && len(ends) > 0 {
+			cut = ends[rng.Intn(len(ends))].End
+		}
+		failed, err := cutPower(dir, cut)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return result.finish(primary)
+		}
+		recovered := open()
+		report, err := recovered.AttachStorage(failed)
+		if err != nil {
+			os.RemoveAll(failed)
+			fmt.Printf("❌ Recovery after a failure at byte %d: %v\n", cut, err)
+			return result.finish(primary)
+		}
+		if report.TornTail {
+			torn++
+		}
+
+		entries := recovered.TakeSnapshot().Entries
+		total := 0
+		for _, key := range keys {
+			total += entries[key].Value
+		}
+		if total != accounts*balance {
+			unbalanced++
+			fmt.Printf("❌ Failure at byte %d: the accounts hold %d, not %d\n", cut, total, accounts*balance)
+		}
+		for client := 1; client <= numClients; client++ {
+			// Transfers the checkpoint holds were never in this WAL
+			want := 0
+			for _, id := range acked[client] {
+				if end, logged := loggedAt[id]; !logged || end <= cut {
+					want++
+				}
+			}
+			got := entries[fmt.Sprintf("transfers_%d", client)].Value
+			if got < want {
+				lost += want - got
+				fmt.Printf("❌ Failure at byte %d: client %d had %d transfers acknowledged, %d recovered\n", cut, client, want, got)
+			} else if got > want {
+				phantom += got - want
+				fmt.Printf("❌ Failure at byte %d: client %d recovered %d transfers, only %d were logged\n", cut, client, got, want)
+			}
+		}
+		recovered.CloseStorage()
+		os.RemoveAll(failed)
+	}
+
+	if lost == 0 && phantom == 0 && unbalanced == 0 {
+		fmt.Printf("✓ Every power failure recovered exactly the acknowledged transfers, with the accounts balanced (%d tore a record)\n", torn)
+	}
+	result.Passed = lost == 0 && phantom == 0 && unbalanced == 0
+	result.Metrics["acked_transfers"] = float64(done.Load())
+	result.Metrics["wal_records"] = float64(len(ends))
+	result.Metrics["wal_bytes"] = float64(size)
+	result.Metrics["torn_tails"] = float64(torn)
+	result.Metrics["lost_transfers"] = float64(lost)
+	result.Metrics["phantom_transfers"] = float64(phantom)
+	result.Metrics["unbalanced_recoveries"] = float64(unbalanced)
+	return result.finish(primary)
+}
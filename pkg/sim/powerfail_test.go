@@ -0,0 +1,67 @@
+package sim
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+func TestPowerFailureScenario(t *testing.T) {
+	noLeaks(t)
+	for _, engine := range []string{"2pl", "mvcc"} {
+		t.Run(engine, func(t *testing.T) {
+			open := func() *db.Database {
+				d, _ := db.OpenDatabase(engine)
+				return d
+			}
+			result := RunPowerFailureScenario(context.Background(), open, 7, 3, 10, 12)
+			if !result.Passed {
+				t.Fatalf("power failure scenario failed: %+v", result.Metrics)
+			}
+			if result.Metrics["acked_transfers"] != 30 || result.Metrics["torn_tails"] != 6 {
+				t.Errorf("expected 30 transfers and 6 torn records, got %+v", result.Metrics)
+			}
+		})
+	}
+}
+
+// TestCutPowerTearsRecord checks that storage cut inside a record recovers
+// the records before it and none of it, and storage cut at its end
+// recovers it too
+func TestCutPowerTearsRecord(t *testing.T) {
+	dir := t.TempDir()
+	d := db.NewTwoPhaseLockingDatabase()
+	if _, err := d.AttachStorage(dir); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if _, err := d.Incr("counter"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.CloseStorage()
+	ends, size, err := db.WALRecordEnds(filepath.Join(dir, db.WALFileName))
+	if err != nil || len(ends) != 3 || ends[2].End != size {
+		t.Fatalf("record ends %+v of %d bytes, err %v", ends, size, err)
+	}
+
+	for cut, want := range map[int64]int{ends[1].End - 1: 1, ends[1].End: 2} {
+		failed, err := cutPower(dir, cut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(failed)
+		recovered := db.NewTwoPhaseLockingDatabase()
+		report, err := recovered.AttachStorage(failed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recovered.CloseStorage()
+		if got, _ := recovered.Snapshot().Get("counter"); got != want || report.TornTail != (want == 1) {
+			t.Errorf("cut at %d: counter %d, torn %v; want %d", cut, got, report.TornTail, want)
+		}
+	}
+}
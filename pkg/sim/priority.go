@@ -0,0 +1,105 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunPriorityInversionScenario runs rounds of the classic priority
+// inversion on a two-phase locking database sharing one Processor: a
+// low-priority transaction takes a lock and starts computing, then a
+// high-priority transaction waits for the lock while medium-priority
+// transactions, which need no lock, keep the processor busy. Without
+// inheritance the high-priority transaction waits for all of the
+// medium-priority work; with it only for the rest of the low-priority
+// transaction's. It passes if the high-priority transaction's median
+// latency stayed below one medium-priority transaction's work, that is
+// it did not wait for medium-priority work.
+func RunPriorityInversionScenario(ctx context.Context, inheritance bool, numMedium int, rounds int) ScenarioResult {
+	const (
+		low, medium, high = 1, 5, 10
+		quantum           = time.Millisecond
+		lowWork           = 4 * time.Millisecond
+		mediumWork        = 20 * time.Millisecond
+		highWork          = time.Millisecond
+	)
+
+	d := db.NewTwoPhaseLockingDatabase()
+	d.SetPriorityInheritance(inheritance)
+	cpu := db.NewProcessor(d, quantum)
+	result := newScenarioResult("priority_inversion", d, map[string]any{
+		"inheritance": inheritance,
+		"medium":      numMedium,
+		"rounds":      rounds,
+	})
+
+	mode := "without priority inheritance"
+	if inheritance {
+		mode = "with priority inheritance"
+	}
+	fmt.Printf("\n=== Priority Inversion Scenario (%s) ===\n", mode)
+	fmt.Printf("Running %d rounds: a low-priority holder (%v of work), a high-priority waiter (%v), and %d medium-priority jobs (%v each)\n",
+		rounds, lowWork, highWork, numMedium, mediumWork)
+
+	var latencies []time.Duration
+	for round := 0; round < rounds && ctx.Err() == nil; round++ {
+		locked := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tx := d.BeginTransactionCtx(db.WithPriority(ctx, low))
+			d.Write(tx, "resource", round)
+			close(locked)
+			cpu.Run(tx, lowWork)
+			d.Commit(tx)
+		}()
+		<-locked
+
+		for i := 0; i < numMedium; i++ {
+			wg.Add(1)
+			go func(job string) {
+				defer wg.Done()
+				tx := d.BeginTransactionCtx(db.WithPriority(ctx, medium))
+				d.Write(tx, job, round)
+				cpu.Run(tx, mediumWork)
+				d.Commit(tx)
+			}(fmt.Sprintf("job_%d", i))
+		}
+
+		start := time.Now()
+		tx := d.BeginTransactionCtx(db.WithPriority(ctx, high))
+		d.Write(tx, "resource", round)
+		cpu.Run(tx, highWork)
+		if d.Commit(tx) == nil {
+			latencies = append(latencies, time.Since(start))
+		}
+		wg.Wait()
+	}
+	result.Partial = reportPartial(ctx, len(latencies), rounds, "rounds")
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var median, worst time.Duration
+	if len(latencies) > 0 {
+		median, worst = latencies[len(latencies)/2], latencies[len(latencies)-1]
+	}
+	fmt.Printf("\nHigh-priority latency: median %v, worst %v\n", median.Round(100*time.Microsecond), worst.Round(100*time.Microsecond))
+
+	result.Passed = len(latencies) > 0 && median < mediumWork
+	switch {
+	case len(latencies) == 0:
+		fmt.Println("❌ No high-priority transaction committed")
+	case result.Passed:
+		fmt.Println("✓ The lock holder inherited the waiter's priority; medium-priority work did not delay it")
+	default:
+		fmt.Println("❌ PRIORITY INVERSION: the high-priority transaction waited for medium-priority work")
+	}
+	result.Metrics["high_p50_us"] = microseconds(median)
+	result.Metrics["high_max_us"] = microseconds(worst)
+	return result.finish(d)
+}
@@ -0,0 +1,19 @@
+package sim
+
+import (
+	"context"
+	"testing"
+)
+
+// TestPriorityInversionScenario verifies inheritance removes the
+// inversion the scenario shows without it
+func TestPriorityInversionScenario(t *testing.T) {
+	without := RunPriorityInversionScenario(context.Background(), false, 2, 3)
+	with := RunPriorityInversionScenario(context.Background(), true, 2, 3)
+	if without.Passed {
+		t.Errorf("no inversion without inheritance: %+v", without.Metrics)
+	}
+	if !with.Passed {
+		t.Errorf("inversion despite inheritance: %+v", with.Metrics)
+	}
+}
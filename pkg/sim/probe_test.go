@@ -0,0 +1,23 @@
+package sim
+
+import (
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestOverlappingQuorumsNeverStale verifies probes never observe a stale
+// read when R + W > N
+func TestOverlappingQuorumsNeverStale(t *testing.T) {
+	ctx, cancel := NewScenarioContext()
+	defer cancel()
+
+	report := db.ProbeConsistency(ctx, quorumProbeTarget(3, 2, 2, time.Millisecond), 4, 50*time.Millisecond)
+	if report.Reads == 0 {
+		t.Fatal("Probes made no reads")
+	}
+	if report.StaleReads != 0 {
+		t.Errorf("%d of %d reads were stale with R + W > N", report.StaleReads, report.Reads)
+	}
+}
@@ -0,0 +1,188 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// The bounded queue lives in the database, as a list under the key queue
+// (see collections.go): producers push items on the left and consumers pop
+// them from the right. The list's value is its length, so producers wait
+// in WaitFor until the queue has room, consumers until it has an item, and
+// each re-checks under its transaction before moving an item, since
+// another may have got there first. Unsynchronized, two producers can push
+// onto the same list, losing an item, and two consumers can pop the same
+// one, duplicating it.
+
+// Errors a producer or consumer gets when the queue filled up or emptied
+// between its wake-up and its transaction
+var (
+	errQueueFull  = errors.New("queue full")
+	errQueueEmpty = errors.New("queue empty")
+)
+
+// RunBoundedQueueScenario has numProducers producers each put
+// itemsPerProducer items through a queue of capacity slots to numConsumers
+// consumers, coordinating through WaitFor. Every item is numbered, so the
+// consumers' tallies show items lost or taken twice. It reports items
+// delivered per second, and passes if every item was consumed exactly once.
+func RunBoundedQueueScenario(ctx context.Context, d *db.Database, numProducers int, numConsumers int, itemsPerProducer int, capacity int) ScenarioResult {
+	result := newScenarioResult("bounded_queue", d, map[string]any{
+		"producers": numProducers, "consumers": numConsumers, "items_per_producer": itemsPerProducer, "capacity": capacity,
+	})
+
+	fmt.Println("\n=== Bounded Queue Scenario ===")
+	fmt.Printf("%d producers (%d items each) and %d consumers sharing a %d-slot queue on %s\n",
+		numProducers, itemsPerProducer, numConsumers, capacity, d.EngineName())
+	// Items are numbered from 1
+	planned := numProducers * itemsPerProducer
+	produced := make([]atomic.Bool, planned+1)
+	taken := make([]atomic.Int32, planned+1)
+	var delivered, fullWakeups, emptyWakeups atomic.Int64
+	start := time.Now()
+	producersDone := make(chan struct{})
+
+	var producers sync.WaitGroup
+	for p := 0; p < numProducers; p++ {
+		producers.Add(1)
+		go func(ctx context.Context, first int) {
+			defer producers.Done()
+			for item := first; item < first+itemsPerProducer && ctx.Err() == nil; {
+				if _, room := d.WaitFor("queue", func(size int, _ bool) bool { return size < capacity }, 10*time.Millisecond); !room {
+					continue
+				}
+				err := d.RunTransactionCtx(ctx, func(tx *db.Transaction) error {
+					queued, err := d.ListItems(tx, "queue")
+					if err != nil {
+						return err
+					}
+					if len(queued) >= capacity {
+						return errQueueFull
+					}
+					_, err = d.PushLeft(tx, "queue", strconv.Itoa(item))
+					return err
+				})
+				switch {
+				case err == nil:
+					produced[item].Store(true)
+					item++
+				case errors.Is(err, errQueueFull):
+					fullWakeups.Add(1)
+				}
+			}
+		}(db.WithClient(ctx, p+1), p*itemsPerProducer+1)
+	}
+
+	var consumers sync.WaitGroup
+	for c := 0; c < numConsumers; c++ {
+		consumers.Add(1)
+		go func(ctx context.Context) {
+			defer consumers.Done()
+			for ctx.Err() == nil {
+				if _, available := d.WaitFor("queue", func(size int, _ bool) bool { return size > 0 }, 10*time.Millisecond); !available {
+					select {
+					case <-producersDone:
+						return // Nothing more is coming
+					default:
+						continue
+					}
+				}
+				var item int
+				err := d.RunTransactionCtx(ctx, func(tx *db.Transaction) error {
+					popped, err := d.PopRight(tx, "queue")
+					if errors.Is(err, db.ErrKeyNotFound) {
+						return errQueueEmpty
+					}
+					if err != nil {
+						return err
+					}
+					item, err = strconv.Atoi(popped)
+					return err
+				})
+				switch {
+				case err == nil:
+					if item > 0 && item <= planned {
+						taken[item].Add(1)
+					}
+					delivered.Add(1)
+				case errors.Is(err, errQueueEmpty):
+					emptyWakeups.Add(1)
+				}
+			}
+		}(db.WithClient(ctx, numProducers+c+1))
+	}
+
+	producers.Wait()
+	close(producersDone)
+	consumers.Wait()
+	elapsed := time.Since(start)
+	result.Partial = reportPartial(ctx, int(delivered.Load()), planned, "items")
+
+	// Items still queued when the run was cut short are neither lost nor
+	// consumed
+	var list []string
+	size := 0
+	err := d.RunTransaction(func(tx *db.Transaction) error {
+		var err error
+		if list, err = d.ListItems(tx, "queue"); err != nil {
+			return err
+		}
+		if size, err = d.Get(tx, "queue"); errors.Is(err, db.ErrKeyNotFound) {
+			size, err = 0, nil
+		}
+		return err
+	})
+	if err != nil {
+		fmt.Printf("❌ Reading the queue failed: %v\n", err)
+		return result.finish(d)
+	}
+	queued := make(map[int]bool)
+	for _, popped := range list {
+		if item, err := strconv.Atoi(popped); err == nil {
+			queued[item] = true
+		}
+	}
+	var numProduced, lost, duplicated int
+	for item := 1; item <= planned; item++ {
+		if !produced[item].Load() {
+			continue
+		}
+		numProduced++
+		switch n := int(taken[item].Load()); {
+		case n == 0 && !queued[item]:
+			lost++
+		case n > 1:
+			duplicated += n - 1
+		}
+	}
+	throughput := float64(delivered.Load()) / elapsed.Seconds()
+
+	fmt.Printf("\nProduced %d items, consumers took %d: %.0f items/s\n", numProduced, delivered.Load(), throughput)
+	fmt.Printf("Woken to a queue already full %d times, already empty %d times\n", fullWakeups.Load(), emptyWakeups.Load())
+	consistent := size == len(list) && size <= capacity
+	if !consistent {
+		fmt.Printf("❌ RACE CONDITION DETECTED! Queue length %d, but it holds %d items in %d slots\n", size, len(list), capacity)
+	}
+	if lost > 0 || duplicated > 0 {
+		fmt.Printf("❌ RACE CONDITION DETECTED! %d items lost, %d taken twice\n", lost, duplicated)
+	} else if consistent {
+		fmt.Println("✓ Every item produced was consumed exactly once")
+	}
+
+	result.Passed = consistent && lost == 0 && duplicated == 0
+	result.Metrics["produced"] = float64(numProduced)
+	result.Metrics["consumed"] = float64(delivered.Load())
+	result.Metrics["throughput"] = throughput
+	result.Metrics["lost_items"] = float64(lost)
+	result.Metrics["duplicated_items"] = float64(duplicated)
+	result.Metrics["full_wakeups"] = float64(fullWakeups.Load())
+	result.Metrics["empty_wakeups"] = float64(emptyWakeups.Load())
+	return result.finish(d)
+}
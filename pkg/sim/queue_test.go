@@ -0,0 +1,38 @@
+package sim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestBoundedQueueDeliversOnce verifies the isolating engines pass every
+// item through the queue exactly once
+func TestBoundedQueueDeliversOnce(t *testing.T) {
+	for _, d := range []*db.Database{db.NewTwoPhaseLockingDatabase(), db.NewMVCCDatabase()} {
+		result := RunBoundedQueueScenario(context.Background(), d, 2, 2, 10, 3)
+		if !result.Passed {
+			t.Errorf("%s: %+v", d.EngineName(), result.Metrics)
+		}
+		if result.Metrics["consumed"] != 20 {
+			t.Errorf("%s: %v items consumed, expected 20", d.EngineName(), result.Metrics["consumed"])
+		}
+	}
+}
+
+// TestBoundedQueueCancelled verifies a cancelled run stops, with items
+// still queued counted as neither lost nor consumed
+func TestBoundedQueueCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	// No consumers, so producers fill the queue and wait for room
+	result := RunBoundedQueueScenario(ctx, db.NewTwoPhaseLockingDatabase(), 2, 0, 10, 3)
+	if !result.Partial {
+		t.Error("cancelled run not marked partial")
+	}
+	if produced := result.Metrics["produced"]; produced > 3 || result.Metrics["lost_items"] != 0 {
+		t.Errorf("%v items produced into 3 slots, %v lost", produced, result.Metrics["lost_items"])
+	}
+}
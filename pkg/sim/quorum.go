@@ -0,0 +1,213 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunQuorumPartitionScenario writes to a N=3, R=2, W=2 cluster while one
+// replica is partitioned away, heals the partition and then lets read
+// repair and anti-entropy bring the replicas back in sync. It reports how
+// many divergences each mechanism found and repaired.
+func RunQuorumPartitionScenario(ctx context.Context, numClients int, writesPerClient int) ScenarioResult {
+	cluster := db.NewQuorumCluster(3, 2, 2)
+	cluster.SetReplicationLag(200 * time.Microsecond)
+
+	const keysPerClient = 10
+	result := ScenarioResult{
+		Name:   "quorum_partition",
+		Engine: cluster.String(),
+		Parameters: map[string]any{
+			"clients":           numClients,
+			"writes_per_client": writesPerClient,
+			"keys_per_client":   keysPerClient,
+		},
+		StartedAt: time.Now(),
+		Metrics:   make(map[string]float64),
+	}
+
+	fmt.Println("\n=== Quorum Partition Scenario ===")
+	fmt.Printf("%s: %d clients write while replica 2 is partitioned away\n", cluster, numClients)
+
+	stopAntiEntropy := cluster.StartAntiEntropy(ctx, 5*time.Millisecond)
+	cluster.Partition(2)
+
+	// Each client owns its keys, so the last acknowledged write is the
+	// value every replica must converge to
+	expected := make([]map[string]int, numClients)
+	var done atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < numClients; i++ {
+		wg.Add(1)
+		expected[i] = make(map[string]int)
+
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < writesPerClient && ctx.Err() == nil; j++ {
+				key := fmt.Sprintf("c%d_k%d", id, j%keysPerClient)
+				if cluster.Put(key, j) {
+					expected[id][key] = j
+					done.Add(1)
+				}
+				time.Sleep(50 * time.Microsecond)
+			}
+		}(i)
+	}
+	wg.Wait()
+	cluster.Quiesce()
+	result.Partial = reportPartial(ctx, int(done.Load()), numClients*writesPerClient, "writes")
+
+	cluster.Heal()
+	divergentAfterPartition := cluster.DivergentKeys()
+	fmt.Printf("\nPartition healed: %d keys differ between replicas\n", divergentAfterPartition)
+
+	// Reading every key repairs the replicas each read quorum touches
+	wrongReads := 0
+	for _, keys := range expected {
+		for key, want := range keys {
+			if value, _, _ := cluster.Get(key); value != want {
+				wrongReads++
+			}
+		}
+	}
+	afterReads := cluster.DivergentKeys()
+	fmt.Printf("After reading every key: %d keys still differ\n", afterReads)
+
+	// Anti-entropy catches whatever the reads did not touch
+	deadline := time.Now().Add(time.Second)
+	for cluster.DivergentKeys() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	stopAntiEntropy()
+
+	remaining := cluster.DivergentKeys()
+	stats := cluster.Stats()
+	fmt.Printf("Read repair:   %d stale copies seen, %d repaired\n", stats.StaleReads, stats.ReadRepairs)
+	fmt.Printf("Anti-entropy:  %d rounds, %d divergences found, %d repaired\n",
+		stats.AntiEntropyRounds, stats.AntiEntropyDivergences, stats.AntiEntropyRepairs)
+	fmt.Printf("Background replica writes dropped by the partition: %d\n", stats.DroppedReplications)
+
+	if wrongReads > 0 {
+		fmt.Printf("❌ %d quorum reads returned a stale value\n", wrongReads)
+	}
+	if remaining > 0 {
+		fmt.Printf("❌ %d keys still differ between replicas\n", remaining)
+	} else if wrongReads == 0 {
+		fmt.Printf("✓ Quorum reads were never stale and all replicas converged\n")
+	}
+
+	result.Duration = time.Since(result.StartedAt)
+	result.Passed = wrongReads == 0 && remaining == 0
+	result.Metrics["writes"] = float64(stats.Writes)
+	result.Metrics["divergent_after_partition"] = float64(divergentAfterPartition)
+	result.Metrics["divergent_after_reads"] = float64(afterReads)
+	result.Metrics["stale_reads"] = float64(stats.StaleReads)
+	result.Metrics["read_repairs"] = float64(stats.ReadRepairs)
+	result.Metrics["anti_entropy_divergences"] = float64(stats.AntiEntropyDivergences)
+	result.Metrics["anti_entropy_repairs"] = float64(stats.AntiEntropyRepairs)
+	result.Metrics["wrong_reads"] = float64(wrongReads)
+	return result
+}
+
+// RunHintedHandoffScenario writes to a N=3, R=2, W=2 cluster while replica
+// 2 goes down for the middle third of the run, then checks that the
+// recovered replica holds every acknowledged write. Without hinted handoff
+// the writes it missed only exist on replicas 0 and 1 until read repair or
+// anti-entropy happens to copy them, so losing those two would lose them.
+func RunHintedHandoffScenario(ctx context.Context, handoff bool, numClients int, writesPerClient int) ScenarioResult {
+	cluster := db.NewQuorumCluster(3, 2, 2)
+	cluster.SetReplicationLag(200 * time.Microsecond)
+	cluster.SetHintedHandoff(handoff)
+
+	mode := "without"
+	if handoff {
+		mode = "with"
+	}
+	result := ScenarioResult{
+		Name:   "hinted_handoff",
+		Engine: cluster.String(),
+		Parameters: map[string]any{
+			"hinted_handoff":    handoff,
+			"clients":           numClients,
+			"writes_per_client": writesPerClient,
+		},
+		StartedAt: time.Now(),
+		Metrics:   make(map[string]float64),
+	}
+
+	fmt.Printf("\n=== Hinted Handoff Scenario (%s hints) ===\n", mode)
+	fmt.Printf("%s: replica 2 is down for the middle third of %d writes\n", cluster, numClients*writesPerClient)
+
+	planned := numClients * writesPerClient
+	var done atomic.Int64
+	outageOver := make(chan struct{})
+
+	// Take replica 2 down after a third of the writes, bring it back after two
+	go func() {
+		defer close(outageOver)
+		for done.Load() < int64(planned/3) && ctx.Err() == nil {
+			time.Sleep(100 * time.Microsecond)
+		}
+		cluster.Partition(2)
+		for done.Load() < int64(2*planned/3) && ctx.Err() == nil {
+			time.Sleep(100 * time.Microsecond)
+		}
+		cluster.Reconnect(2)
+	}()
+
+	// Every write goes to a fresh key, so each acknowledged write can be
+	// looked for on its own
+	acked := make([][]string, numClients)
+	var wg sync.WaitGroup
+	for i := 0; i < numClients; i++ {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < writesPerClient && ctx.Err() == nil; j++ {
+				key := fmt.Sprintf("c%d_w%d", id, j)
+				if cluster.Put(key, j) {
+					acked[id] = append(acked[id], key)
+				}
+				done.Add(1)
+				time.Sleep(50 * time.Microsecond)
+			}
+		}(i)
+	}
+	wg.Wait()
+	<-outageOver
+	cluster.Quiesce()
+	result.Partial = reportPartial(ctx, int(done.Load()), planned, "writes")
+
+	total, missing := 0, 0
+	for _, keys := range acked {
+		for _, key := range keys {
+			total++
+			if _, exists := cluster.ReplicaValue(2, key); !exists {
+				missing++
+			}
+		}
+	}
+
+	stats := cluster.Stats()
+	fmt.Printf("\nAcknowledged writes: %d\n", total)
+	fmt.Printf("Hints stored: %d, delivered on recovery: %d\n", stats.HintsStored, stats.HintsDelivered)
+	if missing > 0 {
+		fmt.Printf("❌ Replica 2 is missing %d acknowledged writes: they would be LOST if replicas 0 and 1 failed now\n", missing)
+	} else {
+		fmt.Printf("✓ The recovered replica holds every acknowledged write\n")
+	}
+
+	result.Duration = time.Since(result.StartedAt)
+	result.Passed = missing == 0
+	result.Metrics["acked_writes"] = float64(total)
+	result.Metrics["missing_on_recovered_replica"] = float64(missing)
+	result.Metrics["hints_stored"] = float64(stats.HintsStored)
+	result.Metrics["hints_delivered"] = float64(stats.HintsDelivered)
+	return result
+}
@@ -0,0 +1,21 @@
+package sim
+
+import (
+	"testing"
+)
+
+// TestHintedHandoffScenarioLosesNothing verifies the scenario's recovered
+// replica ends up with every acknowledged write
+func TestHintedHandoffScenarioLosesNothing(t *testing.T) {
+	noLeaks(t)
+	ctx, cancel := NewScenarioContext()
+	defer cancel()
+
+	result := RunHintedHandoffScenario(ctx, true, 4, 60)
+	if missing := result.Metrics["missing_on_recovered_replica"]; missing != 0 {
+		t.Errorf("Recovered replica is missing %v acknowledged writes", missing)
+	}
+	if result.Metrics["hints_delivered"] == 0 {
+		t.Error("No hints were delivered; the outage did not overlap any writes")
+	}
+}
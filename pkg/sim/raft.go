@@ -0,0 +1,135 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunRaftScenario has clients write their own counters through a
+// three-node Raft cluster, each write acknowledged only once a majority
+// committed it. A third of the way through the leader crashes; the others
+// elect a new one and the clients carry on. Two thirds of the way through
+// the crashed node restarts and catches up. Every acknowledged write must
+// then be on every node, and all nodes must hold the same data.
+func RunRaftScenario(ctx context.Context, numClients int, writesPerClient int) ScenarioResult {
+	cluster := db.NewRaftCluster(3)
+	defer cluster.Close()
+
+	result := newScenarioResult("raft", cluster.Node(0).DB(), map[string]any{
+		"nodes":             cluster.Size(),
+		"clients":           numClients,
+		"writes_per_client": writesPerClient,
+	})
+	result.Seed = cluster.Seed()
+
+	fmt.Println("\n=== Raft Scenario (consensus-replicated writes) ===")
+	fmt.Printf("Running %d clients with %d writes each on %d Raft nodes; the leader crashes a third of the way in\n",
+		numClients, writesPerClient, cluster.Size())
+
+	firstLeader, err := cluster.WaitForLeader(ctx)
+	if err != nil {
+		fmt.Printf("❌ No leader was elected: %v\n", err)
+		return result.finish(cluster.Node(0).DB())
+	}
+	fmt.Printf("Node %d elected leader\n", firstLeader)
+
+	planned := numClients * writesPerClient
+	acked := make([]int, numClients)
+	var totalAcked atomic.Int64
+	var slowest atomic.Int64 // Longest write, in nanoseconds
+
+	// The fault injector: crash the leader, then bring it back
+	crashed := -1
+	newLeader := -1
+	faults := make(chan struct{})
+	go func() {
+		defer close(faults)
+		for totalAcked.Load() < int64(planned/3) && ctx.Err() == nil {
+			time.Sleep(100 * time.Microsecond)
+		}
+		id, ok := cluster.Leader()
+		if !ok {
+			return
+		}
+		crashed = id
+		cluster.Crash(id)
+		elected, err := cluster.WaitForLeader(ctx)
+		if err != nil {
+			return
+		}
+		newLeader = elected
+		for totalAcked.Load() < int64(2*planned/3) && ctx.Err() == nil {
+			time.Sleep(100 * time.Microsecond)
+		}
+		cluster.Restart(id)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < numClients; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			client := cluster.NewClient()
+			key := fmt.Sprintf("client_%d", id)
+			for acked[id] < writesPerClient && ctx.Err() == nil {
+				start := time.Now()
+				if err := client.Put(ctx, key, acked[id]+1); err != nil {
+					continue
+				}
+				elapsed := int64(time.Since(start))
+				for current := slowest.Load(); elapsed > current && !slowest.CompareAndSwap(current, elapsed); current = slowest.Load() {
+				}
+				acked[id]++
+				totalAcked.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	<-faults
+	result.Partial = reportPartial(ctx, int(totalAcked.Load()), planned, "writes")
+
+	settled := cluster.Settle(ctx) == nil
+	fmt.Printf("Acknowledged writes: %d; node %d crashed, node %d took over; %d elections started\n",
+		totalAcked.Load(), crashed, newLeader, cluster.Elections())
+	fmt.Printf("Slowest write: %v (spans the election)\n", time.Duration(slowest.Load()).Round(time.Microsecond))
+
+	// Every node must hold every acknowledged write
+	missing := 0
+	reference := cluster.Node(0).DB().TakeSnapshot()
+	diverged := 0
+	for _, status := range cluster.Status() {
+		d := cluster.Node(status.ID).DB()
+		for id := 0; id < numClients; id++ {
+			value, _ := db.ReadKey(d, fmt.Sprintf("client_%d", id))
+			if value != acked[id] {
+				missing++
+			}
+		}
+		diverged += len(db.DiffSnapshots(reference, d.TakeSnapshot()))
+		fmt.Printf("  node %d: %s, term %d, log %d, applied %d\n",
+			status.ID, status.Role, status.Term, status.LastIndex, status.Applied)
+	}
+
+	if missing > 0 {
+		fmt.Printf("❌ %d acknowledged writes are missing from some node\n", missing)
+	}
+	if diverged > 0 || !settled {
+		fmt.Printf("❌ The nodes hold different data (%d keys differ)\n", diverged)
+	}
+	if missing == 0 && diverged == 0 && settled {
+		fmt.Printf("✓ Every acknowledged write survived the crash and is on all %d nodes\n", cluster.Size())
+	}
+
+	result.Passed = missing == 0 && diverged == 0 && settled && newLeader >= 0
+	result.Metrics["acked_writes"] = float64(totalAcked.Load())
+	result.Metrics["elections"] = float64(cluster.Elections())
+	result.Metrics["missing_writes"] = float64(missing)
+	result.Metrics["diverged_keys"] = float64(diverged)
+	result.Metrics["slowest_write_ms"] = float64(slowest.Load()) / float64(time.Millisecond)
+	return result.finish(cluster.Node(0).DB())
+}
@@ -0,0 +1,15 @@
+package sim
+
+import (
+	"context"
+	"testing"
+)
+
+// TestRaftScenario runs the scenario on a small workload
+func TestRaftScenario(t *testing.T) {
+	noLeaks(t)
+	result := RunRaftScenario(context.Background(), 3, 30)
+	if !result.Passed {
+		t.Errorf("Expected every acknowledged write on every node: %+v", result.Metrics)
+	}
+}
@@ -0,0 +1,96 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunRateLimitScenario runs numClients closed-loop clients on d for
+// duration, each transaction three reads and an update of 100 keys, with
+// each client capped at clientRate transactions per second and all of
+// them together at globalRate; either is unlimited at 0. Run on several
+// engines with the same caps, it compares them under the same load. It
+// passes if the transactions started stayed within the caps.
+func RunRateLimitScenario(ctx context.Context, d *db.Database, numClients int, clientRate float64, globalRate float64, duration time.Duration) ScenarioResult {
+	result := newScenarioResult("rate_limit", d, map[string]any{
+		"clients": numClients, "client_rate": clientRate, "global_rate": globalRate, "duration": duration.String(),
+	})
+	result.Seed = db.NewRunSeed()
+
+	fmt.Println("\n=== Rate-Limited Load ===")
+	fmt.Printf("%d clients capped at %s each and %s in all, for %v on %s\n",
+		numClients, rateText(clientRate), rateText(globalRate), duration, d.EngineName())
+	keys := numberedKeys(100)
+	snapshot := db.DBSnapshot{Entries: make(map[string]db.SnapshotEntry, len(keys))}
+	for _, key := range keys {
+		snapshot.Entries[key] = db.SnapshotEntry{}
+	}
+	if err := d.Restore(snapshot); err != nil {
+		fmt.Printf("❌ Loading keys failed: %v\n", err)
+		return result.finish(d)
+	}
+
+	var global *db.TokenBucket
+	if globalRate > 0 {
+		global = db.NewTokenBucketWithClock(globalRate, 1, d.Clock())
+	}
+	clients := make([]ClientConfig, numClients)
+	for i := range clients {
+		clients[i] = ClientConfig{
+			ID: i + 1, OperationsPerTx: 4, Keys: keys, Mix: OperationMix{Read: 3, Update: 1},
+			RateLimit: clientRate, Limiter: global, Seed: result.Seed + int64(i+1),
+		}
+	}
+	result.measureFrom(d)
+	start := time.Now()
+	completed := runWorkload(ctx, d, WorkloadConfig{Duration: db.Duration(duration)}, clients, &result)
+	elapsed := time.Since(start)
+
+	stats := d.Stats().Since(*result.baseline)
+	var latency db.LatencyHistogram
+	for _, c := range d.ClientStats() {
+		latency = latency.Merge(c.Latency)
+	}
+	achieved := float64(completed) / elapsed.Seconds()
+	limit := globalRate
+	if clientRate > 0 && (limit == 0 || clientRate*float64(numClients) < limit) {
+		limit = clientRate * float64(numClients)
+	}
+	fmt.Printf("Started %.0f tx/s (%d committed, %d aborted), transaction p50 %v, p99 %v\n",
+		achieved, stats.Commits, stats.Aborts, roundLatency(latency.P50), roundLatency(latency.P99))
+	if global != nil {
+		fmt.Printf("Clients waited %v in all for the global cap\n", global.Throttled().Round(time.Millisecond))
+	}
+
+	// Each bucket starts with a token, so a run may start one transaction
+	// per bucket over its cap
+	allowance := 1.0
+	if clientRate > 0 {
+		allowance += float64(numClients)
+	}
+	result.Passed = limit == 0 || float64(completed) <= limit*elapsed.Seconds()+allowance
+	switch {
+	case limit == 0:
+		fmt.Println("✓ Uncapped: the engine set the pace")
+	case result.Passed:
+		fmt.Printf("✓ Load held within the cap of %.0f tx/s\n", limit)
+	default:
+		fmt.Printf("❌ %d transactions started in %v, over the cap of %.0f tx/s\n", completed, elapsed.Round(time.Millisecond), limit)
+	}
+	result.Metrics["throughput"] = achieved
+	result.Metrics["cap"] = limit
+	result.Metrics["tx_p50_us"] = microseconds(latency.P50)
+	result.Metrics["tx_p99_us"] = microseconds(latency.P99)
+	return result.finish(d)
+}
+
+// rateText describes a rate cap, 0 being none
+func rateText(rate float64) string {
+	if rate == 0 {
+		return "no cap"
+	}
+	return fmt.Sprintf("%.0f tx/s", rate)
+}
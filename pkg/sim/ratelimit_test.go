@@ -0,0 +1,57 @@
+package sim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestWorkloadRateLimit verifies a workload's global cap and a group's
+// per-client cap both hold its clients back
+func TestWorkloadRateLimit(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		global    float64
+		perClient float64
+	}{
+		{"global", 400, 0},
+		{"per client", 0, 100},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := WorkloadConfig{
+				Engine: "2pl", Duration: db.Duration(100 * time.Millisecond), RateLimit: tc.global,
+				Clients: []ClientGroup{{Count: 4, OperationsPerTx: 1, RateLimit: tc.perClient}},
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			d, _ := cfg.NewDatabase()
+			var result ScenarioResult
+			result.Metrics = map[string]float64{}
+			completed := runWorkload(context.Background(), d, cfg, cfg.ClientConfigs(), &result)
+
+			// 400 tx/s for 100ms, plus the tokens the buckets start with
+			if completed > 40+4+1 {
+				t.Errorf("%d transactions in 100ms under a cap of 400 tx/s", completed)
+			}
+			if completed < 10 {
+				t.Errorf("only %d transactions in 100ms under a cap of 400 tx/s", completed)
+			}
+		})
+	}
+}
+
+// TestRateLimitScenario verifies the scenario holds its engines to the cap
+func TestRateLimitScenario(t *testing.T) {
+	for _, d := range []*db.Database{db.NewSynchronizedDatabase(db.Fair), db.NewMVCCDatabase()} {
+		result := RunRateLimitScenario(context.Background(), d, 8, 0, 500, 100*time.Millisecond)
+		if !result.Passed {
+			t.Errorf("%s went over the cap: %+v", d.EngineName(), result.Metrics)
+		}
+		if result.Metrics["cap"] != 500 {
+			t.Errorf("cap reported as %v, expected 500", result.Metrics["cap"])
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunReplicationScenario has writers increment a counter on a primary
+// while one reader per replica reads it from that replica, each replica
+// further behind than the last. Every replica read is compared with the
+// primary's value read just before it: a smaller value is a stale read.
+// Replication is correct if each replica's reads never go backwards and
+// every replica converges on the primary's final value.
+func RunReplicationScenario(ctx context.Context, numReplicas int, numWriters int, writesPerWriter int, delay time.Duration) ScenarioResult {
+	primary := db.NewTwoPhaseLockingDatabase()
+	delays := make([]time.Duration, numReplicas)
+	for i := range delays {
+		delays[i] = time.Duration(i+1) * delay
+	}
+	rs := db.NewReplicaSet(primary, delays...)
+	defer rs.Close()
+
+	result := newScenarioResult("replication", primary, map[string]any{
+		"replicas":          numReplicas,
+		"writers":           numWriters,
+		"writes_per_writer": writesPerWriter,
+		"delay_us":          delay.Microseconds(),
+	})
+
+	fmt.Println("\n=== Replication Scenario (asynchronous read replicas) ===")
+	fmt.Printf("Running %d writers with %d increments each on the primary; %d replicas %v behind\n",
+		numWriters, writesPerWriter, numReplicas, delays)
+
+	setup := primary.BeginTransaction()
+	primary.Put(setup, "counter", 0)
+	primary.Commit(setup)
+
+	var writes atomic.Int64
+	var writersWG sync.WaitGroup
+	for i := 0; i < numWriters; i++ {
+		writersWG.Add(1)
+		go func() {
+			defer writersWG.Done()
+			for j := 0; j < writesPerWriter && ctx.Err() == nil; j++ {
+				if _, err := primary.Incr("counter"); err == nil {
+					writes.Add(1)
+				}
+			}
+		}()
+	}
+	writing := make(chan struct{})
+	go func() {
+		writersWG.Wait()
+		close(writing)
+	}()
+
+	reads := make([]int, numReplicas)
+	stale := make([]int, numReplicas)
+	regressions := make([]int, numReplicas)
+	var readersWG sync.WaitGroup
+	for i, r := range rs.Replicas() {
+		readersWG.Add(1)
+		go func(i int, r *db.Replica) {
+			defer readersWG.Done()
+			last := 0
+			for {
+				select {
+				case <-writing:
+					return
+				default:
+				}
+				current, err := db.ReadKey(primary, "counter")
+				if err != nil {
+					continue
+				}
+				value, err := r.Get("counter")
+				if err != nil {
+					// The setup commit has not arrived yet
+					continue
+				}
+				reads[i]++
+				if value < current {
+					stale[i]++
+				}
+				if value < last {
+					regressions[i]++
+				}
+				last = value
+				time.Sleep(50 * time.Microsecond)
+			}
+		}(i, r)
+	}
+	readersWG.Wait()
+	result.Partial = reportPartial(ctx, int(writes.Load()), numWriters*writesPerWriter, "increments")
+
+	final, _ := db.ReadKey(primary, "counter")
+	lags := make([]db.ReplicaLag, numReplicas)
+	for i, r := range rs.Replicas() {
+		lags[i] = r.Lag()
+	}
+	caughtUp := rs.CatchUp(ctx) == nil
+
+	fmt.Printf("Primary counter: %d after %d increments\n", final, writes.Load())
+	converged, totalReads, totalStale, totalRegressions := true, 0, 0, 0
+	for i, r := range rs.Replicas() {
+		value, _ := r.Get("counter")
+		if value != final {
+			converged = false
+		}
+		fmt.Printf("  replica %d (%v): %d/%d reads stale, %d commits behind when writes stopped, worst lag %d commits / %v, final %d\n",
+			i, delays[i], stale[i], reads[i], lags[i].Commits, lags[i].MaxCommits, lags[i].MaxBehind.Round(time.Microsecond), value)
+		totalReads += reads[i]
+		totalStale += stale[i]
+		totalRegressions += regressions[i]
+		result.Metrics[fmt.Sprintf("replica_%d_stale_reads", i)] = float64(stale[i])
+		result.Metrics[fmt.Sprintf("replica_%d_max_lag_commits", i)] = float64(lags[i].MaxCommits)
+		result.Metrics[fmt.Sprintf("replica_%d_max_lag_ms", i)] = float64(lags[i].MaxBehind) / float64(time.Millisecond)
+	}
+
+	if totalStale > 0 {
+		fmt.Printf("✓ Replicas served %d stale reads out of %d, trailing the primary as expected\n", totalStale, totalReads)
+	} else {
+		fmt.Printf("✓ No stale reads (the replicas kept up)\n")
+	}
+	if totalRegressions > 0 {
+		fmt.Printf("❌ %d replica reads went backwards\n", totalRegressions)
+	}
+	if !caughtUp || !converged {
+		fmt.Printf("❌ The replicas did not converge on the primary's value\n")
+	} else {
+		fmt.Printf("✓ Every replica converged on the primary's value once caught up\n")
+	}
+
+	result.Passed = caughtUp && converged && totalRegressions == 0
+	result.Metrics["increments"] = float64(writes.Load())
+	result.Metrics["replica_reads"] = float64(totalReads)
+	result.Metrics["stale_reads"] = float64(totalStale)
+	result.Metrics["read_regressions"] = float64(totalRegressions)
+	return result.finish(primary)
+}
+
+// RunReplicationQuorumScenario runs one client against a primary with two
+// lagging replicas under several read and write quorums. The client writes
+// a counter and immediately reads it back through the quorum; a read that
+// returns less than the client just wrote missed its own write. With
+// R + W > N no read may miss one. With R + W <= N some will.
+func RunReplicationQuorumScenario(ctx context.Context, writes int, delay time.Duration) ScenarioResult {
+	configs := [][2]int{{1, 1}, {2, 1}, {1, 2}, {2, 2}, {3, 1}, {1, 3}}
+	const n = 3
+
+	result := newScenarioResult("replication_quorum", db.NewTwoPhaseLockingDatabase(), map[string]any{
+		"nodes":    n,
+		"writes":   writes,
+		"delay_us": delay.Microseconds(),
+	})
+
+	fmt.Println("\n=== Replication Quorum Scenario (read-your-writes) ===")
+	fmt.Printf("One client writes a counter %d times and reads it straight back; N=%d, replicas %v and %v behind\n",
+		writes, n, delay, 2*delay)
+
+	var last *db.Database
+	done, violations := 0, 0
+	for _, config := range configs {
+		r, w := config[0], config[1]
+		primary := db.NewTwoPhaseLockingDatabase()
+		rs := db.NewReplicaSet(primary, delay, 2*delay)
+		rs.SetQuorum(r, w)
+
+		missed, latency := 0, time.Duration(0)
+		i := 0
+		for i = 1; i <= writes && ctx.Err() == nil; i++ {
+			start := time.Now()
+			tx := primary.BeginTransaction()
+			primary.Put(tx, "counter", i)
+			primary.Commit(tx)
+			latency += time.Since(start)
+
+			if value, err := rs.Get("counter"); err != nil || value < i {
+				missed++
+			}
+		}
+		rs.Close()
+		written := i - 1
+		done += written
+		last = primary
+
+		overlap := r+w > n
+		relation := "R+W<=N"
+		if overlap {
+			relation = "R+W>N "
+		}
+		mark := "✓"
+		if overlap && missed > 0 {
+			mark = "❌"
+			violations++
+		}
+		fmt.Printf("  %s R=%d W=%d (%s): %3d/%d reads missed the client's own write, mean write latency %v\n",
+			mark, r, w, relation, missed, written, (latency / time.Duration(max(written, 1))).Round(time.Microsecond))
+
+		label := fmt.Sprintf("r%d_w%d", r, w)
+		result.Metrics[label+"_missed_reads"] = float64(missed)
+		result.Metrics[label+"_write_latency_us"] = float64(latency.Microseconds()) / float64(max(written, 1))
+	}
+	result.Partial = reportPartial(ctx, done, writes*len(configs), "writes")
+
+	if violations == 0 {
+		fmt.Printf("✓ Every overlapping quorum read its own writes; only R+W<=N missed them\n")
+	} else {
+		fmt.Printf("❌ %d configurations with R+W>N missed a write\n", violations)
+	}
+	result.Passed = violations == 0
+	return result.finish(last)
+}
@@ -0,0 +1,25 @@
+package sim
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestReplicationScenario runs the scenario on a small workload
+func TestReplicationScenario(t *testing.T) {
+	noLeaks(t)
+	result := RunReplicationScenario(context.Background(), 2, 2, 50, 200*time.Microsecond)
+	if !result.Passed {
+		t.Errorf("Expected replication to converge without read regressions: %+v", result.Metrics)
+	}
+}
+
+// TestReplicationQuorumScenario runs the quorum scenario on a small workload
+func TestReplicationQuorumScenario(t *testing.T) {
+	noLeaks(t)
+	result := RunReplicationQuorumScenario(context.Background(), 20, 500*time.Microsecond)
+	if !result.Passed {
+		t.Errorf("Expected no stale reads under overlapping quorums: %+v", result.Metrics)
+	}
+}
@@ -0,0 +1,131 @@
+package sim
+
+import (
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// ScenarioResult is the machine-readable summary of one scenario run
+type ScenarioResult struct {
+	Name       string
+	Engine     string
+	Parameters map[string]any
+	Seed       int64          `json:",omitempty"` // Base RNG seed; client i uses Seed+i
+	Clients    []ClientConfig `json:",omitempty"`
+	StartedAt  time.Time
+	Duration   time.Duration
+	Partial    bool // Cut short by the scenario budget
+	Passed     bool // The scenario's correctness check held
+	Metrics    map[string]float64
+	Stats      db.Stats
+	Snapshot   string `json:",omitempty"` // File the final database state was saved to (-snapshots)
+
+	final    *db.DBSnapshot // Final database state, until the manifest saves it
+	baseline *db.Stats      // Statistics before the measured part of the run; nil to measure all of it
+	measured *db.Stats      // Statistics at the end of the measured part; nil if it lasts to the end
+}
+
+// newScenarioResult starts the summary of a scenario run on d, and makes
+// d the one the debug endpoint reports on
+func newScenarioResult(name string, d db.DB, parameters map[string]any) ScenarioResult {
+	watchDatabase(name, d)
+	return ScenarioResult{
+		Name:       name,
+		Engine:     engineName(d),
+		Parameters: parameters,
+		StartedAt:  time.Now(),
+		Metrics:    make(map[string]float64),
+	}
+}
+
+// measureFrom makes the result's statistics leave out everything d did
+// so far, such as loading data for the run
+func (r *ScenarioResult) measureFrom(d db.DB) {
+	stats := d.Stats()
+	r.baseline = &stats
+}
+
+// measureUntil makes the result's statistics leave out everything d
+// does from now on, such as a cool-down
+func (r *ScenarioResult) measureUntil(d db.DB) {
+	stats := d.Stats()
+	r.measured = &stats
+}
+
+// finish records the run's duration and the database's final statistics
+// and, if it is a Reporter, its state. It prints the operations' latency
+// percentiles, and the fairness report if more than one client ran tagged
+// transactions.
+func (r ScenarioResult) finish(d db.DB) ScenarioResult {
+	r.Duration = time.Since(r.StartedAt)
+	r.Stats = d.Stats()
+	if r.measured != nil {
+		r.Stats = *r.measured
+	}
+	if r.baseline != nil {
+		r.Stats = r.Stats.Since(*r.baseline)
+	}
+	printLatencyReport(r.Engine, r.Stats)
+	reporter, ok := d.(db.Reporter)
+	if !ok {
+		return r
+	}
+	if clients := reporter.ClientStats(); len(clients) > 1 {
+		jain, starved := printFairnessReport(clients)
+		r.Metrics["jain_fairness"] = jain
+		r.Metrics["starved_clients"] = float64(starved)
+	}
+	if reporter.InvariantCount() > 0 {
+		broken := reportInvariants(reporter)
+		r.Metrics["invariant_violations"] = float64(broken)
+		r.Passed = r.Passed && broken == 0
+	}
+	if j := reporter.Journal(); j != nil && j.InMemory() {
+		r.Metrics["serializable"] = 0
+		if reportSerializability(j).Serializable {
+			r.Metrics["serializable"] = 1
+		}
+	}
+	final := reporter.TakeSnapshot()
+	r.final = &final
+	return r
+}
+
+// ScenarioSummary is the part of a ScenarioResult a run decides: what ran,
+// its outcome, its statistics and the final value of every key, without
+// the wall-clock time it started and took. Runs with the same RunSeed and
+// parameters on a simulated clock, whose clients do not interleave, have
+// the same summary.
+type ScenarioSummary struct {
+	Name       string
+	Engine     string
+	Parameters map[string]any
+	Seed       int64 `json:",omitempty"`
+	Partial    bool
+	Passed     bool
+	Metrics    map[string]float64
+	Stats      db.Stats
+	Final      map[string]int `json:",omitempty"` // Key -> value at the end of the run
+}
+
+// Summary returns the summary of the run
+func (r ScenarioResult) Summary() ScenarioSummary {
+	summary := ScenarioSummary{
+		Name:       r.Name,
+		Engine:     r.Engine,
+		Parameters: r.Parameters,
+		Seed:       r.Seed,
+		Partial:    r.Partial,
+		Passed:     r.Passed,
+		Metrics:    r.Metrics,
+		Stats:      r.Stats,
+	}
+	if r.final != nil {
+		summary.Final = make(map[string]int, len(r.final.Entries))
+		for key, entry := range r.final.Entries {
+			summary.Final[key] = entry.Value
+		}
+	}
+	return summary
+}
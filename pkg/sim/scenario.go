@@ -0,0 +1,190 @@
+package sim
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// A Scenario is a self-contained experiment: it sets up a database, runs
+// a concurrent workload on it and then checks the state it left. A
+// Scenario registers itself, from an init function, as a command, and so
+// appears like the built-in commands in the full run, in compare and in
+// the registry's tests:
+//
+//	func init() {
+//		RegisterScenario(myScenario{}, ScenarioInfo{Summary: "what it demonstrates", Defaults: Params{"clients": 4}})
+//	}
+type Scenario interface {
+	// Name identifies the scenario, as its command name
+	Name() string
+	// Setup writes the data the scenario starts from into d, a new
+	// database
+	Setup(d *db.Database) error
+	// Run runs the workload on d with params, stopping early if ctx is
+	// cancelled. Clients should tag their contexts with WithClient.
+	Run(ctx context.Context, d *db.Database, params Params) error
+	// Verify checks the state the run left in d, and returns every
+	// invariant it finds broken
+	Verify(d *db.Database) []db.Violation
+}
+
+// An InvariantScenario is a Scenario with invariants that must hold after
+// every commit of its run, not only at the end; they are registered on
+// the database after Setup
+type InvariantScenario interface {
+	Scenario
+	Invariants() []db.Invariant
+}
+
+// Params are a scenario's parameters by name, such as "clients"
+type Params map[string]int
+
+// ScenarioInfo describes a registered scenario to the command line and
+// the full run
+type ScenarioInfo struct {
+	Summary  string   // What it demonstrates, for the command list
+	Defaults Params   // Its parameters and their defaults; each becomes a flag of its command
+	Expect   string   // What the full run shows, for its closing summary
+	Variants []Params // Parameters the full run also runs it with on the unsynchronized engine, over Defaults
+}
+
+// registeredScenario is a scenario in the registry
+type registeredScenario struct {
+	Scenario
+	summary  string
+	defaults Params
+}
+
+// scenarioRegistry holds the registered scenarios in registration order
+var scenarioRegistry []registeredScenario
+
+// RegisterScenario adds s to the registry as the command info describes.
+// The full run runs it with its defaults on the unsynchronized and
+// two-phase locking engines, and then with each of info.Variants. Call it
+// from an init function; it panics if the name is taken.
+func RegisterScenario(s Scenario, info ScenarioInfo) {
+	if _, taken := FindCommand(s.Name()); taken || s.Name() == "all" || s.Name() == "compare" || s.Name() == "sweep" || s.Name() == "bench" {
+		panic(fmt.Sprintf("scenario %q registered twice", s.Name()))
+	}
+	r := registeredScenario{Scenario: s, summary: info.Summary, defaults: info.Defaults}
+	runs := [][]string{{"-engine", "unsynchronized"}, {"-engine", "2pl"}}
+	for _, variant := range info.Variants {
+		args := []string{"-engine", "unsynchronized"}
+		for _, name := range variant.names() {
+			args = append(args, "-"+name, strconv.Itoa(variant[name]))
+		}
+		runs = append(runs, args)
+	}
+	scenarioRegistry = append(scenarioRegistry, r)
+	commands = append(commands, Command{s.Name(), info.Summary, r.define, runs, info.Expect})
+}
+
+// RegisteredScenarios returns the names of the registered scenarios, in
+// registration order
+func RegisteredScenarios() []string {
+	names := make([]string, len(scenarioRegistry))
+	for i, r := range scenarioRegistry {
+		names[i] = r.Name()
+	}
+	return names
+}
+
+// findScenario returns the registered scenario called name
+func findScenario(name string) (registeredScenario, bool) {
+	for _, r := range scenarioRegistry {
+		if r.Name() == name {
+			return r, true
+		}
+	}
+	return registeredScenario{}, false
+}
+
+// names returns the names of the parameters, sorted
+func (p Params) names() []string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// define declares the scenario's -engine flag and a flag for each of its
+// parameters, as a command's define does
+func (r registeredScenario) define(fs *flag.FlagSet) func(context.Context) ScenarioResult {
+	d := database(fs, "2pl")
+	values := make(map[string]*int, len(r.defaults))
+	for _, name := range r.defaults.names() {
+		values[name] = fs.Int(name, r.defaults[name], name)
+	}
+	return func(ctx context.Context) ScenarioResult {
+		params := make(Params, len(values))
+		for name, value := range values {
+			params[name] = *value
+		}
+		return r.run(ctx, d.open(), params)
+	}
+}
+
+// RunRegisteredScenario runs the registered scenario called name on d,
+// a new database, with params overriding its defaults
+func RunRegisteredScenario(ctx context.Context, d *db.Database, name string, params Params) ScenarioResult {
+	r, exists := findScenario(name)
+	if !exists {
+		panic(fmt.Sprintf("no scenario %q registered", name))
+	}
+	merged := make(Params, len(r.defaults))
+	for key, value := range r.defaults {
+		merged[key] = value
+	}
+	for key, value := range params {
+		merged[key] = value
+	}
+	return r.run(ctx, d, merged)
+}
+
+// run sets up, runs and verifies the scenario on d with params. It
+// passes if Verify finds no violations.
+func (r registeredScenario) run(ctx context.Context, d *db.Database, params Params) ScenarioResult {
+	parameters := make(map[string]any, len(params))
+	for name, value := range params {
+		parameters[name] = value
+	}
+	result := newScenarioResult(r.Name(), d, parameters)
+
+	fmt.Printf("\n=== %s ===\n", r.Name())
+	fmt.Printf("Running %s, on %s\n", r.summary, d.EngineName())
+	if err := r.Setup(d); err != nil {
+		fmt.Printf("❌ Setup failed: %v\n", err)
+		return result.finish(d)
+	}
+	if s, ok := r.Scenario.(InvariantScenario); ok {
+		for _, inv := range s.Invariants() {
+			d.AddInvariant(inv)
+		}
+	}
+	if err := r.Run(ctx, d, params); err != nil {
+		fmt.Printf("❌ Run failed: %v\n", err)
+		return result.finish(d)
+	}
+	if ctx.Err() != nil {
+		fmt.Printf("⏱  PARTIAL RESULT: scenario cancelled (%v); verifying what it did\n", ctx.Err())
+		result.Partial = true
+	}
+
+	violations := r.Verify(d)
+	for _, v := range violations {
+		fmt.Printf("❌ %v\n", v)
+	}
+	if len(violations) == 0 {
+		fmt.Println("✓ Every invariant held")
+	}
+	result.Passed = len(violations) == 0
+	result.Metrics["violations"] = float64(len(violations))
+	return result.finish(d)
+}
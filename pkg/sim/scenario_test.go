@@ -0,0 +1,63 @@
+package sim
+
+import (
+	"context"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestRegisteredScenariosHold verifies every registered scenario finds no
+// violations on the two-phase locking engine
+func TestRegisteredScenariosHold(t *testing.T) {
+	noLeaks(t)
+	if len(RegisteredScenarios()) == 0 {
+		t.Fatal("no scenarios registered")
+	}
+	for _, name := range RegisteredScenarios() {
+		result := RunRegisteredScenario(context.Background(), simulated(db.NewTwoPhaseLockingDatabase()), name, nil)
+		if !result.Passed || result.Metrics["violations"] != 0 {
+			t.Errorf("%s: %+v", name, result)
+		}
+	}
+}
+
+// TestRegisteredScenarioIsCommand verifies a registered scenario runs as a
+// command, with its parameters as flags, and takes part in compare
+func TestRegisteredScenarioIsCommand(t *testing.T) {
+	c, exists := FindCommand("paired-counters")
+	if !exists || !c.TakesEngine() {
+		t.Fatal("paired-counters is not a command with an -engine flag")
+	}
+	scenario, err := c.scenario("-engine", "mvcc", "-clients", "3", "-increments", "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := NewRunManifest(nil).Run(scenario)
+	if !result.Passed || result.Engine != "mvcc" || result.Parameters["clients"] != 3 {
+		t.Errorf("result = %+v, expected a passing MVCC run with 3 clients", result)
+	}
+}
+
+// TestRegisterScenarioRejectsTakenNames verifies a name can only be
+// registered once, and not as a built-in command
+func TestRegisterScenarioRejectsTakenNames(t *testing.T) {
+	for _, name := range []string{"paired-counters", "counter", "compare"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s registered again", name)
+				}
+			}()
+			RegisterScenario(namedScenario(name), ScenarioInfo{})
+		}()
+	}
+}
+
+// namedScenario is a scenario that does nothing, under its own name
+type namedScenario string
+
+func (s namedScenario) Name() string                                  { return string(s) }
+func (namedScenario) Setup(*db.Database) error                        { return nil }
+func (namedScenario) Run(context.Context, *db.Database, Params) error { return nil }
+func (namedScenario) Verify(*db.Database) []db.Violation              { return nil }
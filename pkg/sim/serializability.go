@@ -0,0 +1,15 @@
+package sim
+
+import (
+	"fmt"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// reportSerializability checks the history in the in-memory journal j,
+// prints the verdict and returns it
+func reportSerializability(j *db.Journal) db.SerializabilityReport {
+	report := db.CheckSerializable(j.Entries())
+	fmt.Printf("Conflict-serializable: %v\n", report)
+	return report
+}
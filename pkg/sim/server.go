@@ -0,0 +1,220 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/httpapi"
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// httpClient is a client of the REST API, sending its requests through a
+// connection pool shared with other clients
+type httpClient struct {
+	pool *httpapi.Pool
+}
+
+// do sends a request and decodes a JSON response into out, if given. It
+// returns the response status.
+func (c httpClient) do(method, path string, body any, out any) (int, error) {
+	return c.pool.Do(context.Background(), method, path, body, out)
+}
+
+// increment adds 1 to key in a transaction of its own over the API,
+// retrying while it conflicts. It returns how many attempts conflicted.
+func (c httpClient) increment(key string) (conflicts int, err error) {
+	for {
+		var begun struct{ ID int }
+		if _, err := c.do(http.MethodPost, "/tx", nil, &begun); err != nil {
+			return conflicts, err
+		}
+		txParam := fmt.Sprintf("?tx=%d", begun.ID)
+
+		var read struct{ Value int }
+		status, err := c.do(http.MethodGet, "/keys/"+key+txParam, nil, &read)
+		if err == nil && status == http.StatusOK {
+			status, err = c.do(http.MethodPut, "/keys/"+key+txParam, map[string]int{"value": read.Value + 1}, nil)
+		}
+		if err == nil && status == http.StatusNoContent {
+			status, err = c.do(http.MethodPost, fmt.Sprintf("/tx/%d/commit", begun.ID), nil, nil)
+			if err == nil && status == http.StatusNoContent {
+				return conflicts, nil
+			}
+		} else {
+			c.do(http.MethodPost, fmt.Sprintf("/tx/%d/abort", begun.ID), nil, nil)
+		}
+		if err != nil {
+			return conflicts, err
+		}
+		if status != http.StatusConflict {
+			return conflicts, fmt.Errorf("increment of %s: status %d", key, status)
+		}
+		conflicts++
+		time.Sleep(time.Duration(conflicts) * 100 * time.Microsecond)
+	}
+}
+
+// RunHTTPAPIScenario serves d over HTTP and has clients increment a
+// counter through the REST API, each increment a read and a write in an
+// explicit transaction, retried when it conflicts. The requests arrive on
+// the server's goroutines, so the engine must keep them apart exactly as
+// it does for clients calling it directly.
+func RunHTTPAPIScenario(ctx context.Context, d *db.Database, numClients int, incrementsPerClient int) ScenarioResult {
+	result := newScenarioResult("http_api", d, map[string]any{
+		"clients":               numClients,
+		"increments_per_client": incrementsPerClient,
+	})
+
+	fmt.Println("\n=== HTTP API Scenario (REST transactions) ===")
+	fmt.Printf("Running %d HTTP clients, each incrementing a counter %d times (%s)\n",
+		numClients, incrementsPerClient, d.EngineName())
+
+	setup := d.BeginTransaction()
+	d.Put(setup, "counter", 0)
+	d.Commit(setup)
+
+	handler := db.NewHTTPHandler(d)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	pool := httpapi.NewPool(server.Listener.Addr().String(), httpapi.PoolConfig{MaxConns: numClients, Pipeline: 1})
+	defer pool.Close()
+	client := httpClient{pool: pool}
+
+	var wg sync.WaitGroup
+	var completed, conflicts, failed atomic.Int64
+	for i := 0; i < numClients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < incrementsPerClient && ctx.Err() == nil; j++ {
+				retried, err := client.increment("counter")
+				conflicts.Add(int64(retried))
+				if err != nil {
+					failed.Add(1)
+					continue
+				}
+				completed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	done := int(completed.Load() + failed.Load())
+	result.Partial = reportPartial(ctx, done, numClients*incrementsPerClient, "increments")
+
+	var final struct{ Value int }
+	client.do(http.MethodGet, "/keys/counter", nil, &final)
+	fmt.Printf("Increments: %d committed, %d failed, %d conflicts retried\n", completed.Load(), failed.Load(), conflicts.Load())
+	fmt.Printf("Final counter value: %d (expected %d)\n", final.Value, completed.Load())
+
+	open := handler.OpenTransactions()
+	if final.Value != int(completed.Load()) {
+		fmt.Printf("❌ Lost %d increments made over HTTP\n", int(completed.Load())-final.Value)
+	}
+	if open > 0 {
+		fmt.Printf("❌ %d transactions were left open\n", open)
+	}
+	if final.Value == int(completed.Load()) && open == 0 {
+		fmt.Printf("✓ Every committed increment is in the counter\n")
+	}
+
+	result.Passed = final.Value == int(completed.Load()) && open == 0
+	result.Metrics["increments"] = float64(completed.Load())
+	result.Metrics["failed_increments"] = float64(failed.Load())
+	result.Metrics["conflicts"] = float64(conflicts.Load())
+	result.Metrics["final_value"] = float64(final.Value)
+	return result.finish(d)
+}
+
+// RunHTTPLoadScenario has many client sessions, far more than there are
+// connections, each run transactions over the REST API through one shared
+// connection pool. Each session increments a counter of its own, so the
+// sessions never conflict and the run measures how well the pool
+// multiplexes them: with pipelining, each connection carries many
+// sessions' requests at once instead of one round trip at a time.
+func RunHTTPLoadScenario(ctx context.Context, d *db.Database, sessions int, incrementsPerSession int, cfg httpapi.PoolConfig) ScenarioResult {
+	result := newScenarioResult(fmt.Sprintf("http_load_pipeline_%d", cfg.Pipeline), d, map[string]any{
+		"sessions":               sessions,
+		"increments_per_session": incrementsPerSession,
+		"max_conns":              cfg.MaxConns,
+		"pipeline":               cfg.Pipeline,
+		"request_timeout_ms":     cfg.RequestTimeout.Milliseconds(),
+	})
+
+	fmt.Printf("\n=== HTTP Load Scenario (%d sessions over %d connections, pipeline depth %d) ===\n",
+		sessions, cfg.MaxConns, cfg.Pipeline)
+	fmt.Printf("Each session increments its own counter %d times in REST transactions (%s)\n",
+		incrementsPerSession, d.EngineName())
+
+	handler := db.NewHTTPHandler(d)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	pool := httpapi.NewPool(server.Listener.Addr().String(), cfg)
+	defer pool.Close()
+	client := httpClient{pool: pool}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	var completed, conflicts, failed atomic.Int64
+	for i := 0; i < sessions; i++ {
+		wg.Add(1)
+		go func(session int) {
+			defer wg.Done()
+			key := fmt.Sprintf("session_%d", session)
+			status, err := client.do(http.MethodPut, "/keys/"+key, map[string]int{"value": 0}, nil)
+			if err != nil || status != http.StatusNoContent {
+				failed.Add(int64(incrementsPerSession))
+				return
+			}
+			for j := 0; j < incrementsPerSession && ctx.Err() == nil; j++ {
+				retried, err := client.increment(key)
+				conflicts.Add(int64(retried))
+				if err != nil {
+					failed.Add(1)
+					continue
+				}
+				completed.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	done := int(completed.Load() + failed.Load())
+	result.Partial = reportPartial(ctx, done, sessions*incrementsPerSession, "increments")
+
+	// Every committed increment must be in its session's counter
+	total := 0
+	for i := 0; i < sessions; i++ {
+		var read struct{ Value int }
+		client.do(http.MethodGet, fmt.Sprintf("/keys/session_%d", i), nil, &read)
+		total += read.Value
+	}
+	stats := pool.Stats()
+	open := handler.OpenTransactions()
+	throughput := float64(completed.Load()) / elapsed.Seconds()
+
+	fmt.Printf("Increments: %d committed, %d failed, %d conflicts retried in %v (%.0f transactions/s)\n",
+		completed.Load(), failed.Load(), conflicts.Load(), elapsed.Round(time.Millisecond), throughput)
+	fmt.Printf("Pool: %d requests over %d connections, at most %d in flight, %d timed out, %d connections broken\n",
+		stats.Requests, stats.Dialed, stats.MaxInFlight, stats.TimedOut, stats.Broken)
+
+	exact := total == int(completed.Load()) && open == 0
+	if exact {
+		fmt.Printf("✓ Every committed increment is in its session's counter\n")
+	} else {
+		fmt.Printf("❌ Counters hold %d increments, %d committed; %d transactions left open\n", total, completed.Load(), open)
+	}
+
+	result.Passed = exact && failed.Load() == 0
+	result.Metrics["increments"] = float64(completed.Load())
+	result.Metrics["failed_increments"] = float64(failed.Load())
+	result.Metrics["throughput_tps"] = throughput
+	result.Metrics["connections"] = float64(stats.Dialed)
+	result.Metrics["max_in_flight"] = float64(stats.MaxInFlight)
+	result.Metrics["timed_out_requests"] = float64(stats.TimedOut)
+	return result.finish(d)
+}
@@ -0,0 +1,78 @@
+package sim
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/httpapi"
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestHTTPIncrementsAreNotLost runs concurrent read-modify-write
+// increments over the REST API on each isolating engine and checks none is
+// lost
+func TestHTTPIncrementsAreNotLost(t *testing.T) {
+	engines := map[string]func() *db.Database{
+		"two-phase-locking":  db.NewTwoPhaseLockingDatabase,
+		"mvcc":               db.NewMVCCDatabase,
+		"timestamp-ordering": db.NewTimestampOrderingDatabase,
+	}
+	for name, newDB := range engines {
+		t.Run(name, func(t *testing.T) {
+			d := newDB()
+			d.SetLockTimeout(10 * time.Millisecond)
+			if _, err := d.Incr("counter"); err != nil {
+				t.Fatalf("Incr: %v", err)
+			}
+			handler := db.NewHTTPHandler(d)
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			pool := httpapi.NewPool(server.Listener.Addr().String(), httpapi.PoolConfig{MaxConns: 4})
+			defer pool.Close()
+			client := httpClient{pool: pool}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 10; j++ {
+						if _, err := client.increment("counter"); err != nil {
+							t.Errorf("increment: %v", err)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			var final struct{ Value int }
+			if status, err := client.do(http.MethodGet, "/keys/counter", nil, &final); err != nil || status != http.StatusOK {
+				t.Fatalf("GET /keys/counter: status %d, %v", status, err)
+			}
+			if final.Value != 41 {
+				t.Errorf("Expected counter 41, got %d", final.Value)
+			}
+			if open := handler.OpenTransactions(); open != 0 {
+				t.Errorf("Expected no open transactions, got %d", open)
+			}
+		})
+	}
+}
+
+// TestHTTPLoadScenario runs many sessions over a few pipelined
+// connections and checks every increment lands
+func TestHTTPLoadScenario(t *testing.T) {
+	noLeaks(t)
+	result := RunHTTPLoadScenario(context.Background(), db.NewMVCCDatabase(), 100, 2,
+		httpapi.PoolConfig{MaxConns: 2, Pipeline: 16, RequestTimeout: 5 * time.Second})
+	if !result.Passed {
+		t.Errorf("Expected every increment to land: %+v", result.Metrics)
+	}
+	if result.Metrics["connections"] > 2 {
+		t.Errorf("Expected at most 2 connections, got %v", result.Metrics["connections"])
+	}
+}
@@ -0,0 +1,120 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunShardScalingScenario runs the same stress workload, transfers between
+// random accounts, on sharded databases of each size in shardCounts and
+// reports the throughput of each. Most transfers span two shards and
+// commit with two-phase commit; the total must be preserved at every size.
+func RunShardScalingScenario(ctx context.Context, shardCounts []int, numClients int, transfersPerClient int) ScenarioResult {
+	newShard := func() *db.Database {
+		d := db.NewTwoPhaseLockingDatabase()
+		d.SetLockTimeout(10 * time.Millisecond) // Transfers lock in random order
+		return d
+	}
+	// The result's statistics and final state are those of the last run's
+	// first shard
+	last := newShard()
+	result := newScenarioResult("shard_scaling", last, map[string]any{
+		"shard_counts":         shardCounts,
+		"clients":              numClients,
+		"transfers_per_client": transfersPerClient,
+	})
+	result.Seed = db.NewRunSeed()
+
+	fmt.Println("\n=== Shard Scaling Scenario (consistent hashing + two-phase commit) ===")
+	fmt.Printf("Running %d clients, each making %d transfers among 64 accounts, on two-phase locking shards\n",
+		numClients, transfersPerClient)
+
+	const accounts, initialBalance = 64, 1000
+	passed, ran := true, 0
+	for _, n := range shardCounts {
+		if ctx.Err() != nil {
+			break
+		}
+		sdb := db.NewShardedDatabase(n, newShard)
+		last = sdb.Shard(0)
+		names := make([]string, accounts)
+		for i := range names {
+			names[i] = fmt.Sprintf("account_%02d", i)
+		}
+		sdb.RunTransaction(func(tx *db.ShardedTransaction) error {
+			for _, name := range names {
+				sdb.Put(tx, name, initialBalance)
+			}
+			return nil
+		})
+
+		start := time.Now()
+		var wg sync.WaitGroup
+		var completed, failed atomic.Int64
+		for i := 0; i < numClients; i++ {
+			wg.Add(1)
+			go func(id int) {
+				defer wg.Done()
+				rng := rand.New(rand.NewSource(result.Seed + int64(id)))
+				for j := 0; j < transfersPerClient && ctx.Err() == nil; j++ {
+					a := rng.Intn(accounts)
+					from, to := names[a], names[(a+1+rng.Intn(accounts-1))%accounts]
+					amount := rng.Intn(50) + 1
+					err := sdb.RunTransactionCtx(ctx, func(tx *db.ShardedTransaction) error {
+						if err := sdb.Add(tx, from, -amount); err != nil {
+							return err
+						}
+						return sdb.Add(tx, to, amount)
+					})
+					if err != nil {
+						failed.Add(1)
+						continue
+					}
+					completed.Add(1)
+				}
+			}(i)
+		}
+		wg.Wait()
+		elapsed := time.Since(start)
+
+		total := 0
+		sdb.RunTransaction(func(tx *db.ShardedTransaction) error {
+			total = 0
+			for _, name := range names {
+				balance, err := sdb.Get(tx, name)
+				if err != nil {
+					return err
+				}
+				total += balance
+			}
+			return nil
+		})
+		stats := sdb.Stats()
+		throughput := float64(completed.Load()) / elapsed.Seconds()
+		mark := "✓"
+		if total != accounts*initialBalance {
+			mark = "❌"
+			passed = false
+		}
+		fmt.Printf("  %s %2d shards: %6.0f transfers/s, %d cross-shard, %d single-shard, %d retries, %d given up, total=%d\n",
+			mark, n, throughput, stats.CrossShardCommits, stats.SingleShardCommits, stats.Retries, failed.Load(), total)
+		result.Metrics[fmt.Sprintf("throughput_%d_shards", n)] = throughput
+		result.Metrics[fmt.Sprintf("cross_shard_%d_shards", n)] = float64(stats.CrossShardCommits)
+		ran++
+	}
+	result.Partial = reportPartial(ctx, ran, len(shardCounts), "shard counts")
+
+	if passed {
+		fmt.Printf("✓ The total was preserved at every shard count\n")
+	} else {
+		fmt.Printf("❌ Two-phase commit lost or created money\n")
+	}
+	result.Passed = passed
+	return result.finish(last)
+}
@@ -0,0 +1,14 @@
+package sim
+
+import (
+	"context"
+	"testing"
+)
+
+// TestShardScalingScenario runs the scaling scenario at two sizes
+func TestShardScalingScenario(t *testing.T) {
+	result := RunShardScalingScenario(context.Background(), []int{1, 4}, 4, 20)
+	if !result.Passed {
+		t.Errorf("Shard scaling scenario failed: %v", result.Metrics)
+	}
+}
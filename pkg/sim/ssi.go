@@ -0,0 +1,96 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunWriteSkewScenario runs the doctors on-call problem: alice and bob are
+// both on call, and the rule is that at least one of them must stay on
+// call. Each round two transactions run concurrently; each checks that two
+// doctors are on call and then takes its own doctor off. Snapshot isolation
+// lets both commit and leaves nobody on call; SSI aborts one of them.
+func RunWriteSkewScenario(ctx context.Context, d *db.Database, level db.IsolationLevel, rounds int) ScenarioResult {
+	result := newScenarioResult("write_skew", d, map[string]any{
+		"isolation": level.String(),
+		"rounds":    rounds,
+	})
+
+	fmt.Printf("\n=== Write Skew Scenario (%s) ===\n", level)
+	fmt.Printf("Running %d rounds of two doctors going off call at the same time\n", rounds)
+
+	doctors := []string{"oncall_alice", "oncall_bob"}
+	var violations, serializationAborts atomic.Int64
+	completed := 0
+
+	for round := 0; round < rounds && ctx.Err() == nil; round++ {
+		setup := d.BeginTransaction()
+		for _, doctor := range doctors {
+			d.Write(setup, doctor, 1)
+		}
+		d.Commit(setup)
+
+		// Both transactions read before either commits
+		var bothRead, wg sync.WaitGroup
+		bothRead.Add(len(doctors))
+		for _, doctor := range doctors {
+			wg.Add(1)
+
+			go func(me string) {
+				defer wg.Done()
+				tx := d.BeginTransactionWithIsolation(level)
+
+				onCall := 0
+				for _, other := range doctors {
+					value, _ := d.Read(tx, other)
+					onCall += value
+				}
+				bothRead.Done()
+				bothRead.Wait()
+
+				if onCall >= 2 {
+					d.Write(tx, me, 0)
+				}
+				d.Commit(tx)
+				if tx.Aborted && strings.HasPrefix(tx.AbortReason, "serialization failure") {
+					serializationAborts.Add(1)
+				}
+			}(doctor)
+		}
+		wg.Wait()
+
+		check := d.BeginTransaction()
+		onCall := 0
+		for _, doctor := range doctors {
+			value, _ := d.Read(check, doctor)
+			onCall += value
+		}
+		d.Commit(check)
+
+		if onCall == 0 {
+			violations.Add(1)
+		}
+		completed++
+	}
+
+	result.Partial = reportPartial(ctx, completed, rounds, "rounds")
+
+	fmt.Printf("\nRounds that left nobody on call: %d of %d\n", violations.Load(), completed)
+	fmt.Printf("Transactions aborted with a serialization failure: %d\n", serializationAborts.Load())
+	if violations.Load() > 0 {
+		fmt.Printf("❌ WRITE SKEW: both doctors went off call %d times\n", violations.Load())
+	} else {
+		fmt.Printf("✓ Someone was always on call\n")
+	}
+
+	result.Passed = violations.Load() == 0
+	result.Metrics["violations"] = float64(violations.Load())
+	result.Metrics["serialization_aborts"] = float64(serializationAborts.Load())
+	result.Metrics["rounds"] = float64(completed)
+	return result.finish(d)
+}
@@ -0,0 +1,19 @@
+package sim
+
+import (
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestWriteSkewScenarioSerializable verifies the concurrent scenario never
+// leaves nobody on call under SSI
+func TestWriteSkewScenarioSerializable(t *testing.T) {
+	ctx, cancel := NewScenarioContext()
+	defer cancel()
+
+	result := RunWriteSkewScenario(ctx, db.NewMVCCDatabase(), db.Serializable, 50)
+	if result.Metrics["violations"] != 0 {
+		t.Errorf("SSI allowed write skew %v times", result.Metrics["violations"])
+	}
+}
@@ -0,0 +1,35 @@
+package sim
+
+import (
+	"fmt"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// printLatencyReport prints the latency percentiles of every kind of
+// operation in stats that ran on engine
+func printLatencyReport(engine string, stats db.Stats) {
+	if len(stats.Latency) == 0 {
+		return
+	}
+	fmt.Printf("Latency percentiles (%s):\n", engine)
+	fmt.Printf("  %-7s %8s %10s %10s %10s %10s %10s\n", "op", "count", "p50", "p90", "p99", "p99.9", "max")
+	for kind := db.OpKind(0); kind < db.NumOpKinds; kind++ {
+		h, ran := stats.Latency[kind.String()]
+		if !ran {
+			continue
+		}
+		fmt.Printf("  %-7s %8d %10v %10v %10v %10v %10v\n", kind, h.Count,
+			roundLatency(h.P50), roundLatency(h.P90), roundLatency(h.P99), roundLatency(h.P999), roundLatency(h.Max))
+	}
+}
+
+// roundLatency rounds d to three significant digits for display
+func roundLatency(d time.Duration) time.Duration {
+	unit := time.Duration(1)
+	for d >= 1000*unit {
+		unit *= 10
+	}
+	return d.Round(unit)
+}
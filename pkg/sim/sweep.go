@@ -0,0 +1,145 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// A concurrency sweep runs the same workload at increasing client counts
+// and reports throughput and transaction p99 latency at each, the classic
+// scalability curve: throughput rises with clients until the engine's
+// synchronization becomes the bottleneck, then flattens or falls while
+// latency climbs. Each level runs on a new database, so levels do not
+// inherit each other's data or statistics.
+//
+//	go run ./cmd/db-sim sweep
+//	go run ./cmd/db-sim sweep -engines 2pl,mvcc -levels 1,2,4,8,16 -duration 500ms
+
+// DefaultSweepLevels are the client counts a sweep runs by default
+var DefaultSweepLevels = []int{1, 2, 4, 8, 16, 32, 64, 128}
+
+// RunSweepLevel runs one level of a concurrency sweep on d: numClients
+// closed-loop clients, without think time, for duration, each transaction
+// three reads and an update of numKeys keys. It reports committed
+// transactions per second and, if d is a Reporter, the p99 of the
+// transactions' begin-to-finish latency, and passes if every transaction
+// committed or aborted once.
+func RunSweepLevel(ctx context.Context, d db.DB, numClients int, numKeys int, duration time.Duration) ScenarioResult {
+	result := newScenarioResult("sweep", d, map[string]any{
+		"clients": numClients, "keys": numKeys, "duration": duration.String(),
+	})
+	result.Seed = db.NewRunSeed()
+
+	fmt.Printf("\n=== Concurrency Sweep: %d clients ===\n", numClients)
+	keys := numberedKeys(numKeys)
+	initial := make(map[string]int, numKeys)
+	for _, key := range keys {
+		initial[key] = 0
+	}
+	if err := bulkLoad(d, initial); err != nil {
+		fmt.Printf("❌ Loading %d keys failed: %v\n", numKeys, err)
+		return result.finish(d)
+	}
+
+	clients := make([]ClientConfig, numClients)
+	for i := range clients {
+		clients[i] = ClientConfig{
+			ID: i + 1, OperationsPerTx: 4, Keys: keys, Mix: OperationMix{Read: 3, Update: 1},
+			Seed: result.Seed + int64(i+1),
+		}
+	}
+	result.measureFrom(d)
+	start := time.Now()
+	var run ScenarioResult // Collects the clients; this result reports on them
+	completed := runWorkload(ctx, d, WorkloadConfig{Duration: db.Duration(duration)}, clients, &run)
+	elapsed := time.Since(start)
+	result.Partial = run.Partial
+
+	stats := d.Stats().Since(*result.baseline)
+	var latency db.LatencyHistogram
+	if r, ok := d.(db.Reporter); ok {
+		for _, c := range r.ClientStats() {
+			latency = latency.Merge(c.Latency)
+		}
+	}
+	throughput := float64(stats.Commits) / elapsed.Seconds()
+	fmt.Printf("%d clients on %s: %.0f committed tx/s, %d aborted, p50 %v, p99 %v\n", numClients, engineName(d),
+		throughput, stats.Aborts, roundLatency(latency.P50), roundLatency(latency.P99))
+
+	result.Passed = stats.Commits+stats.Aborts == completed
+	if !result.Passed {
+		fmt.Printf("❌ %d transactions finished, but %d committed and %d aborted\n", completed, stats.Commits, stats.Aborts)
+	}
+	result.Metrics["throughput"] = throughput
+	result.Metrics["abort_rate"] = float64(stats.Aborts) / float64(max(completed, 1))
+	result.Metrics["tx_p50_us"] = microseconds(latency.P50)
+	result.Metrics["tx_p99_us"] = microseconds(latency.P99)
+	return result.finish(d)
+}
+
+// Sweep sweeps each of engines through levels of clients through
+// manifest, and prints the throughput and latency curves. Each level's own
+// output is shown only if verbose is set.
+func Sweep(manifest *RunManifest, engines []string, levels []int, numKeys int, duration time.Duration, verbose bool) error {
+	var errs []error
+	for _, engine := range engines {
+		if _, err := db.OpenEngine(engine); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(engines) == 0 || len(levels) == 0 || duration <= 0 {
+		errs = append(errs, fmt.Errorf("nothing to sweep"))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("sweep: %w", err)
+	}
+
+	fmt.Printf("\n=== Concurrency Sweep: %v clients, %v per level, %d keys ===\n", levels, duration, numKeys)
+	results := make(map[string]map[int]ScenarioResult, len(engines))
+	for _, engine := range engines {
+		results[engine] = make(map[int]ScenarioResult, len(levels))
+		for _, clients := range levels {
+			d, _ := db.OpenEngine(engine)
+			withOutput(verbose, func() {
+				results[engine][clients] = manifest.Run(func(ctx context.Context) ScenarioResult {
+					return RunSweepLevel(ctx, d, clients, numKeys, duration)
+				})
+			})
+		}
+	}
+
+	printSweepCurve("Throughput: committed transactions per second", engines, levels, results, func(r ScenarioResult) string {
+		return fmt.Sprintf("%.0f", r.Metrics["throughput"])
+	})
+	printSweepCurve("Transaction p99 latency", engines, levels, results, func(r ScenarioResult) string {
+		return roundLatency(time.Duration(r.Metrics["tx_p99_us"] * float64(time.Microsecond))).String()
+	})
+	return nil
+}
+
+// printSweepCurve prints cell(result) with a client count per row and an
+// engine per column
+func printSweepCurve(title string, engines []string, levels []int, results map[string]map[int]ScenarioResult, cell func(ScenarioResult) string) {
+	fmt.Printf("\n=== %s ===\n", title)
+	fmt.Printf("%7s", "clients")
+	for _, engine := range engines {
+		fmt.Printf("  %*s", max(len(engine), 9), engine)
+	}
+	fmt.Println()
+	for _, clients := range levels {
+		fmt.Printf("%7d", clients)
+		for _, engine := range engines {
+			r := results[engine][clients]
+			text := cell(r)
+			if r.Partial {
+				text = "⏱" + text
+			}
+			fmt.Printf("  %*s", max(len(engine), 9), text)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,59 @@
+package sim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestSweepLevel verifies a sweep level measures throughput and
+// transaction latency and accounts for every transaction
+func TestSweepLevel(t *testing.T) {
+	result := RunSweepLevel(context.Background(), db.NewMVCCDatabase(), 4, 20, 50*time.Millisecond)
+	if !result.Passed || result.Partial {
+		t.Errorf("result = %+v, expected a complete passing level", result)
+	}
+	if result.Metrics["throughput"] <= 0 || result.Metrics["tx_p99_us"] < result.Metrics["tx_p50_us"] || result.Metrics["tx_p50_us"] <= 0 {
+		t.Errorf("metrics = %v", result.Metrics)
+	}
+}
+
+// TestSweep verifies a sweep runs each engine at each client count, and
+// rejects what it cannot sweep
+func TestSweep(t *testing.T) {
+	noLeaks(t)
+	manifest := NewRunManifest(nil)
+	if err := Sweep(manifest, []string{"2pl", "tso"}, []int{1, 3}, 16, 20*time.Millisecond, false); err != nil {
+		t.Fatal(err)
+	}
+	var ran []any
+	for _, result := range manifest.Scenarios {
+		ran = append(ran, result.Engine, result.Parameters["clients"])
+	}
+	want := []any{"two-phase-locking", 1, "two-phase-locking", 3, "timestamp-ordering", 1, "timestamp-ordering", 3}
+	if len(ran) != len(want) {
+		t.Fatalf("ran %v, expected %v", ran, want)
+	}
+	for i := range want {
+		if ran[i] != want[i] {
+			t.Fatalf("ran %v, expected %v", ran, want)
+		}
+	}
+
+	for _, c := range []struct {
+		engines  []string
+		levels   []int
+		duration time.Duration
+	}{
+		{[]string{"btree"}, []int{1}, time.Millisecond},
+		{[]string{"2pl"}, nil, time.Millisecond},
+		{[]string{"2pl"}, []int{1}, 0},
+	} {
+		manifest := NewRunManifest(nil)
+		if err := Sweep(manifest, c.engines, c.levels, 16, c.duration, false); err == nil || len(manifest.Scenarios) != 0 {
+			t.Errorf("%+v: error %v after %d runs", c, err, len(manifest.Scenarios))
+		}
+	}
+}
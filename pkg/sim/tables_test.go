@@ -0,0 +1,17 @@
+package sim
+
+import (
+	"context"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestTablesScenario runs the tables scenario on two-phase locking, with a
+// simulated clock
+func TestTablesScenario(t *testing.T) {
+	result := RunTablesScenario(context.Background(), simulated(db.NewTwoPhaseLockingDatabase()), 4, 20)
+	if !result.Passed {
+		t.Errorf("Tables scenario failed: %v", result.Metrics)
+	}
+}
@@ -0,0 +1,125 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunRestartComparisonScenario runs transfers between a handful of accounts
+// and restarts every transaction the engine aborts (or whose lock wait
+// times out), after a random backoff, until it commits. Under two-phase
+// locking restarts come from deadlocks broken by lock timeouts; under
+// timestamp ordering from operations that arrived out of timestamp order.
+func RunRestartComparisonScenario(ctx context.Context, d *db.Database, numClients int, txPerClient int) ScenarioResult {
+	result := newScenarioResult("restart_comparison", d, map[string]any{
+		"clients":       numClients,
+		"tx_per_client": txPerClient,
+	})
+	result.Seed = db.NewRunSeed()
+
+	fmt.Printf("\n=== Restart Comparison Scenario (%s) ===\n", d.EngineName())
+	fmt.Printf("Running %d clients, each committing %d transfers, restarting on abort\n", numClients, txPerClient)
+
+	accounts := []string{"acct_0", "acct_1", "acct_2", "acct_3"}
+	initTx := d.BeginTransaction()
+	for _, account := range accounts {
+		d.Write(initTx, account, 1000)
+	}
+	d.Commit(initTx)
+	initialTotal := 1000 * len(accounts)
+
+	var wg sync.WaitGroup
+	var committed, restarts atomic.Int64
+
+	for i := 0; i < numClients; i++ {
+		wg.Add(1)
+		clientID := i
+
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(result.Seed + int64(clientID)))
+
+			for j := 0; j < txPerClient; j++ {
+				from := accounts[rng.Intn(len(accounts))]
+				to := accounts[rng.Intn(len(accounts))]
+				for from == to {
+					to = accounts[rng.Intn(len(accounts))]
+				}
+				amount := rng.Intn(50) + 1
+
+				for attempt := 0; ; attempt++ {
+					if ctx.Err() != nil {
+						return
+					}
+					if attempt > 0 {
+						// Back off randomly before retrying, or transactions
+						// that keep aborting each other never get through
+						restarts.Add(1)
+						backoff := min(50*time.Microsecond<<min(attempt, 6), 2*time.Millisecond)
+						time.Sleep(time.Duration(rng.Int63n(int64(backoff))))
+					}
+					if transferOnce(d, from, to, amount) {
+						committed.Add(1)
+						break
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	result.Partial = reportPartial(ctx, int(committed.Load()), numClients*txPerClient, "transfers")
+
+	check := d.BeginTransaction()
+	finalTotal := 0
+	for _, account := range accounts {
+		value, _ := d.Read(check, account)
+		finalTotal += value
+	}
+	d.Commit(check)
+
+	perTx := 0.0
+	if committed.Load() > 0 {
+		perTx = float64(restarts.Load()) / float64(committed.Load())
+	}
+	fmt.Printf("\nCommitted %d transfers with %d restarts (%.2f per transfer)\n", committed.Load(), restarts.Load(), perTx)
+	if finalTotal != initialTotal {
+		fmt.Printf("❌ Money not conserved: total %d, expected %d\n", finalTotal, initialTotal)
+	} else {
+		fmt.Printf("✓ Total conserved: %d\n", finalTotal)
+	}
+
+	result.Passed = finalTotal == initialTotal
+	result.Metrics["committed"] = float64(committed.Load())
+	result.Metrics["restarts"] = float64(restarts.Load())
+	result.Metrics["restarts_per_tx"] = perTx
+	return result.finish(d)
+}
+
+// transferOnce attempts one transfer and reports whether it committed. A
+// transaction that failed is aborted, so the caller can simply retry.
+func transferOnce(d *db.Database, from, to string, amount int) bool {
+	tx := d.BeginTransaction()
+	fromBalance, okFrom := d.Read(tx, from)
+
+	// Simulate processing time
+	time.Sleep(time.Microsecond * 100)
+
+	toBalance, okTo := d.Read(tx, to)
+	if !okFrom || !okTo ||
+		!d.Write(tx, from, fromBalance-amount) ||
+		!d.Write(tx, to, toBalance+amount) {
+		if !tx.Aborted {
+			d.Abort(tx)
+		}
+		return false
+	}
+	d.Commit(tx)
+	return !tx.Aborted
+}
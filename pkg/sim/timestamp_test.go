@@ -0,0 +1,27 @@
+package sim
+
+import (
+	"testing"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestRestartComparisonConservesMoney verifies restarted transfers under
+// both engines leave the total intact
+func TestRestartComparisonConservesMoney(t *testing.T) {
+	ctx, cancel := NewScenarioContext()
+	defer cancel()
+
+	twoPL := db.NewTwoPhaseLockingDatabase()
+	twoPL.SetLockTimeout(10 * time.Millisecond)
+	for _, d := range []*db.Database{twoPL, db.NewTimestampOrderingDatabase()} {
+		result := RunRestartComparisonScenario(ctx, d, 4, 20)
+		if !result.Passed {
+			t.Errorf("%s did not conserve money", d.EngineName())
+		}
+		if result.Metrics["committed"] != 80 {
+			t.Errorf("%s committed %v transfers, want 80", d.EngineName(), result.Metrics["committed"])
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunSessionExpiryScenario keeps a pool of sessions alive with writers
+// that refresh random sessions with a TTL, while readers look sessions up
+// and a sweeper expires them in the background. Each session's value is
+// its own expiry time, so a reader can tell whether it was handed a
+// session that had already expired. Once the writers stop, every session
+// must expire and be swept away.
+func RunSessionExpiryScenario(ctx context.Context, ttl time.Duration, numWriters int, numReaders int, duration time.Duration) ScenarioResult {
+	d := db.NewTwoPhaseLockingDatabase()
+	d.SetTombstoneGracePeriod(ttl)
+	result := newScenarioResult("session_expiry", d, map[string]any{
+		"ttl":      ttl.String(),
+		"writers":  numWriters,
+		"readers":  numReaders,
+		"duration": duration.String(),
+	})
+
+	fmt.Println("\n=== Session Expiry Scenario (TTL + background sweeper) ===")
+	fmt.Printf("%d writers refresh sessions with a %v TTL while %d readers look them up for %v\n",
+		numWriters, ttl, numReaders, duration)
+
+	const sessions = 32
+	sweepInterval := max(ttl/4, time.Millisecond)
+	stopSweeper := d.StartExpirySweeper(ctx, sweepInterval)
+
+	start := time.Now()
+	runCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	var refreshes, hits, misses, expiredServed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < numWriters; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(id)))
+			for runCtx.Err() == nil {
+				key := fmt.Sprintf("session_%d", rng.Intn(sessions))
+				deadline := time.Now().Add(ttl)
+				tx := d.BeginTransaction()
+				d.PutExpiring(tx, key, int(deadline.UnixMicro()), deadline)
+				if d.Commit(tx) == nil {
+					refreshes.Add(1)
+				}
+				time.Sleep(time.Duration(rng.Intn(int(ttl/time.Microsecond)/2+1)) * time.Microsecond)
+			}
+		}(i)
+	}
+	for i := 0; i < numReaders; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(1000 + id)))
+			for runCtx.Err() == nil {
+				key := fmt.Sprintf("session_%d", rng.Intn(sessions))
+				before := time.Now()
+				tx := d.BeginTransaction()
+				value, err := d.Get(tx, key)
+				d.Commit(tx)
+				if err != nil {
+					misses.Add(1)
+					continue
+				}
+				hits.Add(1)
+				if int64(value) < before.UnixMicro() {
+					// The session had expired before the read even began
+					expiredServed.Add(1)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	ran := time.Since(start)
+
+	// With no more refreshes every session expires, and the sweeper
+	// removes its record once the tombstone is past the grace period
+	stored := func() int { return len(d.TakeSnapshot().Entries) }
+	deadline := time.Now().Add(2*ttl + 20*sweepInterval)
+	for stored() > 0 && ctx.Err() == nil && time.Now().Before(deadline) {
+		time.Sleep(sweepInterval)
+	}
+	stopSweeper()
+	remaining := stored()
+	result.Partial = reportPartial(ctx, int(min(ran, duration)/time.Millisecond), int(duration/time.Millisecond), "planned milliseconds")
+
+	stats := d.Stats()
+	fmt.Printf("Refreshes: %d, lookups: %d hit / %d missed\n", refreshes.Load(), hits.Load(), misses.Load())
+	fmt.Printf("Sweeper expired %d keys and collected %d tombstones\n", stats.KeysExpired, stats.TombstonesCollected)
+
+	if expiredServed.Load() > 0 {
+		fmt.Printf("❌ %d lookups returned a session that had already expired\n", expiredServed.Load())
+	}
+	if remaining > 0 {
+		fmt.Printf("❌ %d session records still stored after every TTL ran out\n", remaining)
+	}
+	if expiredServed.Load() == 0 && remaining == 0 {
+		fmt.Printf("✓ No expired session was ever served, and every session was swept away\n")
+	}
+
+	result.Passed = expiredServed.Load() == 0 && remaining == 0
+	result.Metrics["refreshes"] = float64(refreshes.Load())
+	result.Metrics["hits"] = float64(hits.Load())
+	result.Metrics["misses"] = float64(misses.Load())
+	result.Metrics["expired_served"] = float64(expiredServed.Load())
+	result.Metrics["keys_expired"] = float64(stats.KeysExpired)
+	return result.finish(d)
+}
@@ -0,0 +1,75 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunLatencySLOScenario runs the general client mix against a two-phase
+// locking database whose lock timeout is far longer than slo, with every
+// client cancelling transactions that run longer than slo. Lock waits end
+// at the SLO instead of the lock timeout, so none ever reaches it.
+func RunLatencySLOScenario(ctx context.Context, slo time.Duration, numClients int, txPerClient int) ScenarioResult {
+	d := db.NewTwoPhaseLockingDatabase()
+	result := newScenarioResult("latency_slo", d, map[string]any{
+		"slo":           slo.String(),
+		"clients":       numClients,
+		"tx_per_client": txPerClient,
+		"lock_timeout":  d.LockManager().Timeout().String(),
+	})
+
+	fmt.Println("\n=== Latency SLO Scenario ===")
+	fmt.Printf("Running %d clients x %d transactions, each cancelled after %v (lock timeout %v)\n",
+		numClients, txPerClient, slo, d.LockManager().Timeout())
+
+	initTx := d.BeginTransaction()
+	for _, key := range []string{"account_1", "account_2", "account_3", "counter", "balance"} {
+		d.Write(initTx, key, 1000)
+	}
+	d.Commit(initTx)
+	d.SetUpsertOnUpdate(true)
+
+	var wg sync.WaitGroup
+	running := make([]*Client, 0, numClients)
+	for i := 0; i < numClients; i++ {
+		config := ClientConfig{
+			ID:              i + 1,
+			NumTransactions: txPerClient,
+			OperationsPerTx: 3,
+			ThinkTime:       100 * time.Microsecond,
+			TxTimeout:       slo,
+		}
+		wg.Add(1)
+		client := NewClient(config, d)
+		running = append(running, client)
+		result.Clients = append(result.Clients, client.Config())
+		go client.Run(ctx, &wg)
+	}
+	wg.Wait()
+
+	completed, timedOut := 0, 0
+	for _, client := range running {
+		completed += client.Completed()
+		timedOut += client.TimedOut()
+	}
+	result.Partial = reportPartial(ctx, completed, numClients*txPerClient, "transactions")
+
+	stats := d.Stats()
+	fmt.Printf("\nTransactions: %d run, %d cancelled at the SLO\n", completed, timedOut)
+	fmt.Printf("Committed after the SLO: %d, lock waits that hit the timeout: %d\n", stats.DeadlinesMissed, stats.LockTimeouts)
+	if stats.LockTimeouts > 0 {
+		fmt.Printf("❌ %d lock waits outlived their transaction's context\n", stats.LockTimeouts)
+	} else {
+		fmt.Printf("✓ Every blocked lock wait ended at the SLO\n")
+	}
+
+	result.Passed = stats.LockTimeouts == 0
+	result.Metrics["transactions"] = float64(completed)
+	result.Metrics["timed_out"] = float64(timedOut)
+	result.Metrics["deadlines_missed"] = float64(stats.DeadlinesMissed)
+	return result.finish(d)
+}
@@ -0,0 +1,108 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunVersionGrowthScenario hammers a few hot keys with updates on an MVCC
+// database, with a background vacuum every vacuumInterval (0 disables it),
+// and reports how many versions are retained. Without the vacuum every
+// update stays in memory; with it each key settles back to one version.
+func RunVersionGrowthScenario(ctx context.Context, vacuumInterval time.Duration, numWriters int, updatesPerWriter int) ScenarioResult {
+	d := db.NewMVCCDatabase()
+	result := newScenarioResult("version_growth", d, map[string]any{
+		"vacuum_interval":    vacuumInterval.String(),
+		"writers":            numWriters,
+		"updates_per_writer": updatesPerWriter,
+	})
+
+	if vacuumInterval > 0 {
+		fmt.Printf("\n=== Version Growth Scenario (vacuum every %v) ===\n", vacuumInterval)
+	} else {
+		fmt.Println("\n=== Version Growth Scenario (no vacuum) ===")
+	}
+	fmt.Printf("Running %d writers, each updating hot keys %d times\n", numWriters, updatesPerWriter)
+
+	keys := []string{"hot_0", "hot_1", "hot_2", "hot_3"}
+	setup := d.BeginTransaction()
+	for _, key := range keys {
+		d.Write(setup, key, 0)
+	}
+	d.Commit(setup)
+
+	stop := func() {}
+	if vacuumInterval > 0 {
+		stop = d.StartVacuum(ctx, vacuumInterval)
+	}
+
+	var wg sync.WaitGroup
+	var committed atomic.Int64
+	var peakMu sync.Mutex
+	peak := 0
+	for i := 0; i < numWriters; i++ {
+		wg.Add(1)
+		writer := i
+
+		go func() {
+			defer wg.Done()
+			for j := 0; j < updatesPerWriter && ctx.Err() == nil; j++ {
+				tx := d.BeginTransaction()
+				d.Update(tx, keys[(writer+j)%len(keys)], 1)
+				d.Commit(tx)
+				if !tx.Aborted {
+					committed.Add(1)
+				}
+				retained := d.RetainedVersions()
+				peakMu.Lock()
+				peak = max(peak, retained)
+				peakMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	stop()
+	result.Partial = reportPartial(ctx, int(committed.Load()), numWriters*updatesPerWriter, "updates")
+
+	retained := d.RetainedVersions()
+	if vacuumInterval > 0 {
+		// Nothing is active any more, so a final pass leaves one version per key
+		d.Vacuum()
+	}
+	final := d.RetainedVersions()
+
+	check := d.BeginTransaction()
+	total := 0
+	for _, key := range keys {
+		value, _ := d.Read(check, key)
+		total += value
+	}
+	d.Commit(check)
+
+	stats := d.Stats()
+	fmt.Printf("\nCommitted updates:  %d (%d aborted by write conflicts)\n", committed.Load(), stats.WriteConflicts)
+	fmt.Printf("Versions retained:  peak %d, at end %d, after final vacuum %d\n", peak, retained, final)
+	fmt.Printf("Versions reclaimed: %d in %d vacuum runs\n", stats.VersionsReclaimed, stats.VacuumRuns)
+
+	result.Passed = total == int(committed.Load())
+	if !result.Passed {
+		fmt.Printf("❌ Hot keys sum to %d, expected %d committed updates\n", total, committed.Load())
+	} else if vacuumInterval > 0 && final != len(keys) {
+		fmt.Printf("❌ %d versions left for %d keys after the final vacuum\n", final, len(keys))
+		result.Passed = false
+	} else {
+		fmt.Printf("✓ Every committed update is accounted for\n")
+	}
+
+	result.Metrics["committed"] = float64(committed.Load())
+	result.Metrics["versions_peak"] = float64(peak)
+	result.Metrics["versions_retained"] = float64(retained)
+	result.Metrics["versions_after_vacuum"] = float64(final)
+	result.Metrics["versions_reclaimed"] = float64(stats.VersionsReclaimed)
+	return result.finish(d)
+}
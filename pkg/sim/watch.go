@@ -0,0 +1,130 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// RunWatchScenario has writers increment a set of counters while watchers
+// subscribe to every counter. Each watcher checks that the events of each
+// counter continue one another: every version follows the last one, and
+// every old value is the new value the watcher last saw. Once the writers
+// finish, each watcher must have seen every committed increment exactly
+// once.
+func RunWatchScenario(ctx context.Context, d *db.Database, numWriters int, incrementsPerWriter int, numWatchers int) ScenarioResult {
+	result := newScenarioResult("watch", d, map[string]any{
+		"writers":               numWriters,
+		"increments_per_writer": incrementsPerWriter,
+		"watchers":              numWatchers,
+	})
+	result.Seed = db.NewRunSeed()
+
+	fmt.Println("\n=== Watch Scenario (change notifications) ===")
+	fmt.Printf("%d writers increment counters %d times each while %d watchers follow every counter (%s)\n",
+		numWriters, incrementsPerWriter, numWatchers, d.EngineName())
+
+	const counters = 4
+	keys := make([]string, counters)
+	setup := d.BeginTransaction()
+	for i := range keys {
+		keys[i] = fmt.Sprintf("counter_%d", i)
+		d.Put(setup, keys[i], 0)
+	}
+	d.Commit(setup)
+
+	// Each watcher follows every counter, one goroutine per subscription
+	type watched struct {
+		events, outOfOrder atomic.Int64
+		stops              []func()
+	}
+	all := make([]*watched, numWatchers)
+	var watchWG sync.WaitGroup
+	for i := range all {
+		w := &watched{}
+		all[i] = w
+		for _, key := range keys {
+			events, stop := d.Watch(key)
+			w.stops = append(w.stops, stop)
+			watchWG.Add(1)
+			go func() {
+				defer watchWG.Done()
+				lastVersion, lastValue := -1, 0
+				for event := range events {
+					if lastVersion >= 0 && (event.Version != lastVersion+1 || event.OldValue != lastValue) {
+						w.outOfOrder.Add(1)
+					}
+					if event.NewValue != event.OldValue+1 {
+						w.outOfOrder.Add(1)
+					}
+					lastVersion, lastValue = event.Version, event.NewValue
+					w.events.Add(1)
+				}
+			}()
+		}
+	}
+
+	var writeWG sync.WaitGroup
+	var committed atomic.Int64
+	for i := 0; i < numWriters; i++ {
+		writeWG.Add(1)
+		go func(id int) {
+			defer writeWG.Done()
+			for j := 0; j < incrementsPerWriter; j++ {
+				if ctx.Err() != nil {
+					return
+				}
+				key := keys[(id+j)%counters]
+				err := d.RunTransactionCtx(ctx, func(tx *db.Transaction) error {
+					return d.Add(tx, key, 1)
+				})
+				if err == nil {
+					committed.Add(1)
+				}
+			}
+		}(i)
+	}
+	writeWG.Wait()
+	result.Partial = reportPartial(ctx, int(committed.Load()), numWriters*incrementsPerWriter, "increments")
+
+	// Give the watchers a moment to drain their queues
+	deadline := time.Now().Add(time.Second)
+	for _, w := range all {
+		for w.events.Load() < committed.Load() && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for _, w := range all {
+		for _, stop := range w.stops {
+			stop()
+		}
+	}
+	watchWG.Wait()
+
+	missed, outOfOrder := int64(0), int64(0)
+	for i, w := range all {
+		fmt.Printf("  watcher %d: %d events, %d out of order\n", i, w.events.Load(), w.outOfOrder.Load())
+		missed += committed.Load() - w.events.Load()
+		outOfOrder += w.outOfOrder.Load()
+	}
+	fmt.Printf("Increments committed: %d\n", committed.Load())
+	if missed != 0 {
+		fmt.Printf("❌ Watchers missed (or double-counted) %d events in total\n", missed)
+	}
+	if outOfOrder > 0 {
+		fmt.Printf("❌ %d events did not follow the previous one\n", outOfOrder)
+	}
+	if missed == 0 && outOfOrder == 0 {
+		fmt.Printf("✓ Every watcher saw every committed change exactly once, in order\n")
+	}
+
+	result.Passed = missed == 0 && outOfOrder == 0
+	result.Metrics["committed"] = float64(committed.Load())
+	result.Metrics["missed_events"] = float64(missed)
+	result.Metrics["out_of_order"] = float64(outOfOrder)
+	return result.finish(d)
+}
@@ -0,0 +1,21 @@
+package sim
+
+import (
+	"context"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestWatchScenario runs the watch scenario on both isolating engines
+func TestWatchScenario(t *testing.T) {
+	noLeaks(t)
+	for name, d := range map[string]*db.Database{"2PL": db.NewTwoPhaseLockingDatabase(), "MVCC": db.NewMVCCDatabase()} {
+		t.Run(name, func(t *testing.T) {
+			result := RunWatchScenario(context.Background(), d, 4, 50, 2)
+			if !result.Passed {
+				t.Errorf("Watch scenario failed: %v", result.Metrics)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package sim
+
+import (
+	"fmt"
+	"math/rand"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// A Workload decides what a client does: each operation of each of its
+// transactions is the next one the workload generates. New experiments
+// plug in a Workload through ClientConfig.Workload instead of changing
+// how clients operate.
+type Workload interface {
+	// NextOperation returns the next operation, drawing any randomness
+	// from rng, the client's seeded generator
+	NextOperation(rng *rand.Rand) Operation
+}
+
+// Operation is one operation of a client's transaction. The zero
+// Operation, without a key, does nothing: a workload returns it to skip
+// a turn.
+type Operation struct {
+	Kind  db.OpKind // OpRead, OpWrite, OpUpdate, OpDelete or OpScan
+	Key   string    // The key, or with OpScan the prefix of the keys scanned
+	Value int       // Value written by OpWrite; delta added by OpUpdate
+	To    string    // With OpUpdate, makes it a transfer: Value moves from Key to To
+}
+
+// UniformWorkload reads, writes, updates and deletes keys picked from Keys
+// by Distribution, each kind equally likely, except that a delete only
+// goes ahead one time in ten. Written values are below 1000 and update
+// deltas between -50 and 50. It is what clients do by default.
+type UniformWorkload struct {
+	Keys         []string
+	Distribution KeyDistribution
+}
+
+func (w UniformWorkload) NextOperation(rng *rand.Rand) Operation {
+	kind := db.OpKind(rng.Intn(4)) // OpRead, OpWrite, OpUpdate or OpDelete
+	op := Operation{Kind: kind, Key: w.Keys[w.Distribution.Pick(rng, len(w.Keys))]}
+	switch kind {
+	case db.OpWrite:
+		op.Value = rng.Intn(1000)
+	case db.OpUpdate:
+		op.Value = rng.Intn(100) - 50
+	case db.OpDelete:
+		if rng.Float32() >= 0.1 {
+			return Operation{}
+		}
+	}
+	return op
+}
+
+// MixWorkload is UniformWorkload with the kinds of operation weighted by
+// Mix, and every delete going ahead
+type MixWorkload struct {
+	Keys         []string
+	Distribution KeyDistribution
+	Mix          OperationMix
+}
+
+func (w MixWorkload) NextOperation(rng *rand.Rand) Operation {
+	kind := db.OpDelete
+	switch n := rng.Intn(w.Mix.total()); {
+	case n < w.Mix.Read:
+		kind = db.OpRead
+	case n < w.Mix.Read+w.Mix.Write:
+		kind = db.OpWrite
+	case n < w.Mix.Read+w.Mix.Write+w.Mix.Update:
+		kind = db.OpUpdate
+	}
+
+	op := Operation{Kind: kind, Key: w.Keys[w.Distribution.Pick(rng, len(w.Keys))]}
+	switch kind {
+	case db.OpWrite:
+		op.Value = rng.Intn(1000)
+	case db.OpUpdate:
+		op.Value = rng.Intn(100) - 50
+	}
+	return op
+}
+
+// ReadHeavyWorkload returns a workload of 90% reads over keys, the rest
+// writes and updates
+func ReadHeavyWorkload(keys []string, distribution KeyDistribution) MixWorkload {
+	return MixWorkload{Keys: keys, Distribution: distribution, Mix: OperationMix{Read: 90, Write: 5, Update: 5}}
+}
+
+// WriteHeavyWorkload returns a workload of 90% writes and updates over
+// keys, the rest reads
+func WriteHeavyWorkload(keys []string, distribution KeyDistribution) MixWorkload {
+	return MixWorkload{Keys: keys, Distribution: distribution, Mix: OperationMix{Read: 10, Write: 45, Update: 45}}
+}
+
+// TransferWorkload only moves amounts of 1 to MaxAmount between two
+// different keys of Keys, so their total never changes unless an update
+// is lost. Distribution picks the key paying; the one paid is any other.
+// Keys needs at least two keys.
+type TransferWorkload struct {
+	Keys         []string
+	Distribution KeyDistribution
+	MaxAmount    int
+}
+
+func (w TransferWorkload) NextOperation(rng *rand.Rand) Operation {
+	from := w.Distribution.Pick(rng, len(w.Keys))
+	to := rng.Intn(len(w.Keys) - 1)
+	if to >= from {
+		to++
+	}
+	return Operation{Kind: db.OpUpdate, Key: w.Keys[from], To: w.Keys[to], Value: 1 + rng.Intn(max(w.MaxAmount, 1))}
+}
+
+// builtinWorkload returns the built-in workload called name over keys,
+// picked by distribution: uniform, read-heavy, write-heavy or transfer (of
+// up to 100 at a time)
+func builtinWorkload(name string, keys []string, distribution KeyDistribution) (Workload, error) {
+	switch name {
+	case "uniform":
+		return UniformWorkload{Keys: keys, Distribution: distribution}, nil
+	case "read-heavy":
+		return ReadHeavyWorkload(keys, distribution), nil
+	case "write-heavy":
+		return WriteHeavyWorkload(keys, distribution), nil
+	case "transfer":
+		if len(keys) < 2 {
+			return nil, fmt.Errorf("the transfer workload needs at least two keys")
+		}
+		return TransferWorkload{Keys: keys, Distribution: distribution, MaxAmount: 100}, nil
+	default:
+		return nil, fmt.Errorf("unknown workload %q: want uniform, read-heavy, write-heavy or transfer", name)
+	}
+}
@@ -0,0 +1,106 @@
+package sim
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestMixWorkloadFollowsWeights verifies a mix only generates the kinds it
+// weighs, in roughly their proportions
+func TestMixWorkloadFollowsWeights(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	w := MixWorkload{Keys: []string{"a", "b"}, Mix: OperationMix{Read: 3, Update: 1}}
+	counts := map[db.OpKind]int{}
+	for i := 0; i < 4000; i++ {
+		op := w.NextOperation(rng)
+		if op.Key != "a" && op.Key != "b" {
+			t.Fatalf("operation on key %q, outside the workload's keys", op.Key)
+		}
+		counts[op.Kind]++
+	}
+	if counts[db.OpWrite] != 0 || counts[db.OpDelete] != 0 {
+		t.Errorf("counts = %v, expected reads and updates only", counts)
+	}
+	if counts[db.OpRead] < 2800 || counts[db.OpRead] > 3200 {
+		t.Errorf("%d reads of 4000, expected about 3000", counts[db.OpRead])
+	}
+}
+
+// TestTransferWorkloadMovesBetweenDistinctKeys verifies every transfer
+// has two different keys and an amount within bounds
+func TestTransferWorkloadMovesBetweenDistinctKeys(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	w := TransferWorkload{Keys: []string{"a", "b", "c"}, MaxAmount: 10}
+	for i := 0; i < 1000; i++ {
+		op := w.NextOperation(rng)
+		if op.Kind != db.OpUpdate || op.Key == op.To || op.To == "" || op.Value < 1 || op.Value > 10 {
+			t.Fatalf("operation %+v, expected a transfer of 1 to 10 between two keys", op)
+		}
+	}
+}
+
+// incrementWorkload always adds one to a single key
+type incrementWorkload struct{ key string }
+
+func (w incrementWorkload) NextOperation(*rand.Rand) Operation {
+	return Operation{Kind: db.OpUpdate, Key: w.key, Value: 1}
+}
+
+// TestClientRunsCustomWorkload verifies a client performs the operations
+// of any Workload it is given, and a transfer workload conserves the total
+func TestClientRunsCustomWorkload(t *testing.T) {
+	d := db.NewTwoPhaseLockingDatabase()
+	tx := d.BeginTransaction()
+	d.Write(tx, "hits", 0)
+	d.Write(tx, "a", 100)
+	d.Write(tx, "b", 100)
+	d.Commit(tx)
+
+	var wg sync.WaitGroup
+	configs := []ClientConfig{
+		{ID: 1, NumTransactions: 20, OperationsPerTx: 2, Workload: incrementWorkload{"hits"}},
+		{ID: 2, NumTransactions: 20, OperationsPerTx: 2, Workload: TransferWorkload{Keys: []string{"a", "b"}, MaxAmount: 5}},
+	}
+	for _, config := range configs {
+		wg.Add(1)
+		go NewClient(config, d).Run(context.Background(), &wg)
+	}
+	wg.Wait()
+
+	tx = d.BeginTransaction()
+	defer d.Abort(tx)
+	values := map[string]int{}
+	for _, key := range []string{"hits", "a", "b"} {
+		v, err := d.Get(tx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values[key] = v
+	}
+	if values["hits"] != 40 {
+		t.Errorf("hits = %d, expected 40", values["hits"])
+	}
+	if values["a"]+values["b"] != 200 {
+		t.Errorf("a = %d, b = %d, expected transfers conserving 200", values["a"], values["b"])
+	}
+}
+
+// TestBuiltinWorkloads verifies every built-in workload can be named in a
+// workload file, and a transfer needs two keys
+func TestBuiltinWorkloads(t *testing.T) {
+	for _, name := range []string{"uniform", "read-heavy", "write-heavy", "transfer"} {
+		if _, err := builtinWorkload(name, defaultClientKeys, KeyDistribution{}); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := builtinWorkload("transfer", []string{"only"}, KeyDistribution{}); err == nil {
+		t.Error("a transfer workload over one key was accepted")
+	}
+	if _, err := builtinWorkload("zipf", defaultClientKeys, KeyDistribution{}); err == nil {
+		t.Error("an unknown workload was accepted")
+	}
+}
@@ -0,0 +1,232 @@
+package sim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML that workload files need, without
+// a dependency: block mappings and sequences nested by indentation,
+// sequences of mappings ("- key: value"), flow sequences of scalars
+// ("[a, b]"), comments, and plain, quoted, numeric, boolean and null
+// scalars. Anchors, tags, multi-line strings and flow mappings are not
+// supported. The result is built from map[string]any, []any, string,
+// int64, float64, bool and nil, ready for encoding/json.
+func parseYAML(data []byte) (any, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		content := strings.TrimRight(stripYAMLComment(raw), " \r")
+		trimmed := strings.TrimLeft(content, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml line %d: tabs are not allowed in indentation", i+1)
+		}
+		lines = append(lines, yamlLine{number: i + 1, indent: len(content) - len(trimmed), text: trimmed})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	p := &yamlParser{lines: lines}
+	value, err := p.block(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.next < len(p.lines) {
+		line := p.lines[p.next]
+		return nil, fmt.Errorf("yaml line %d: unexpected indentation", line.number)
+	}
+	return value, nil
+}
+
+// yamlLine is a non-blank line with its comment removed
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// yamlParser consumes lines in order
+type yamlParser struct {
+	lines []yamlLine
+	next  int
+}
+
+// stripYAMLComment removes a comment: a # at the start of the line or
+// after a space, outside quotes
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' '):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// block parses the mapping or sequence whose lines start at indent
+func (p *yamlParser) block(indent int) (any, error) {
+	line := p.lines[p.next]
+	if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+// sequence parses "- item" lines at indent
+func (p *yamlParser) sequence(indent int) (any, error) {
+	items := []any{}
+	for p.next < len(p.lines) {
+		line := p.lines[p.next]
+		if line.indent != indent || !(line.text == "-" || strings.HasPrefix(line.text, "- ")) {
+			break
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+
+		var item any
+		var err error
+		switch {
+		case rest == "":
+			// The item is the block on the following, deeper lines
+			p.next++
+			item, err = p.nested(indent)
+		case isYAMLMappingEntry(rest):
+			// "- key: value" starts a mapping indented past the dash
+			p.lines[p.next] = yamlLine{number: line.number, indent: indent + len(line.text) - len(rest), text: rest}
+			item, err = p.mapping(p.lines[p.next].indent)
+		default:
+			p.next++
+			item, err = parseYAMLScalar(rest, line.number)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// mapping parses "key: value" lines at indent
+func (p *yamlParser) mapping(indent int) (any, error) {
+	entries := map[string]any{}
+	for p.next < len(p.lines) {
+		line := p.lines[p.next]
+		if line.indent != indent {
+			if line.indent > indent {
+				return nil, fmt.Errorf("yaml line %d: unexpected indentation", line.number)
+			}
+			break
+		}
+		if !isYAMLMappingEntry(line.text) {
+			return nil, fmt.Errorf("yaml line %d: expected \"key: value\", got %q", line.number, line.text)
+		}
+		key, value := splitYAMLEntry(line.text)
+		if _, duplicate := entries[key]; duplicate {
+			return nil, fmt.Errorf("yaml line %d: duplicate key %q", line.number, key)
+		}
+		p.next++
+
+		var err error
+		if value == "" {
+			// A block value: deeper lines, or a sequence at the same indent
+			if p.next < len(p.lines) && p.lines[p.next].indent == indent && strings.HasPrefix(p.lines[p.next].text, "-") {
+				entries[key], err = p.sequence(indent)
+			} else {
+				entries[key], err = p.nested(indent)
+			}
+		} else {
+			entries[key], err = parseYAMLScalar(value, line.number)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// nested parses the block on the following lines, which must be indented
+// deeper than indent; with none, the value is null
+func (p *yamlParser) nested(indent int) (any, error) {
+	if p.next >= len(p.lines) || p.lines[p.next].indent <= indent {
+		return nil, nil
+	}
+	return p.block(p.lines[p.next].indent)
+}
+
+// isYAMLMappingEntry reports whether text is "key: value" or "key:"
+func isYAMLMappingEntry(text string) bool {
+	if text[0] == '"' || text[0] == '\'' || text[0] == '[' {
+		return false
+	}
+	colon := strings.Index(text, ":")
+	return colon > 0 && (colon == len(text)-1 || text[colon+1] == ' ')
+}
+
+// splitYAMLEntry splits "key: value" into key and value
+func splitYAMLEntry(text string) (string, string) {
+	colon := strings.Index(text, ":")
+	return strings.TrimSpace(text[:colon]), strings.TrimSpace(text[colon+1:])
+}
+
+// parseYAMLScalar parses a scalar or a flow sequence of scalars
+func parseYAMLScalar(text string, number int) (any, error) {
+	switch {
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("yaml line %d: unterminated flow sequence", number)
+		}
+		items := []any{}
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		if inner == "" {
+			return items, nil
+		}
+		for _, part := range strings.Split(inner, ",") {
+			item, err := parseYAMLScalar(strings.TrimSpace(part), number)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case strings.HasPrefix(text, "{"):
+		return nil, fmt.Errorf("yaml line %d: flow mappings are not supported", number)
+	case strings.HasPrefix(text, "\""):
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("yaml line %d: bad quoted string %s", number, text)
+		}
+		return s, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("yaml line %d: bad quoted string %s", number, text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+
+	switch strings.ToLower(text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null", "~":
+		return nil, nil
+	}
+	if n, err := strconv.ParseInt(strings.ReplaceAll(text, "_", ""), 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil {
+		return f, nil
+	}
+	return text, nil
+}
@@ -0,0 +1,86 @@
+package sim
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseYAML verifies nested mappings, sequences of mappings, flow
+// sequences, comments and scalar types come out as encoding/json would
+// decode the equivalent JSON
+func TestParseYAML(t *testing.T) {
+	source := `
+# a comment
+name: "hot # not a comment"
+engine: 2pl   # a trailing comment
+upsert: true
+timeout: 20ms
+ratio: 0.5
+missing: ~
+initial:
+  counter: 0
+  other: -3
+keys: [a, 'b', "c"]
+empty: []
+clients:
+  - count: 2
+    mix:
+      read: 1
+  - count: 1
+    keys:
+      - x
+      - y
+`
+	got, err := parseYAML([]byte(source))
+	if err != nil {
+		t.Fatalf("parseYAML: %v", err)
+	}
+	want := map[string]any{
+		"name":    "hot # not a comment",
+		"engine":  "2pl",
+		"upsert":  true,
+		"timeout": "20ms",
+		"ratio":   0.5,
+		"missing": nil,
+		"initial": map[string]any{"counter": int64(0), "other": int64(-3)},
+		"keys":    []any{"a", "b", "c"},
+		"empty":   []any{},
+		"clients": []any{
+			map[string]any{"count": int64(2), "mix": map[string]any{"read": int64(1)}},
+			map[string]any{"count": int64(1), "keys": []any{"x", "y"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseYAML =\n%#v\nexpected\n%#v", got, want)
+	}
+}
+
+// TestParseYAMLSequenceUnderKey verifies a sequence may sit at its key's
+// own indentation, as YAML allows
+func TestParseYAMLSequenceUnderKey(t *testing.T) {
+	got, err := parseYAML([]byte("keys:\n- a\n- b\nname: n\n"))
+	if err != nil {
+		t.Fatalf("parseYAML: %v", err)
+	}
+	want := map[string]any{"keys": []any{"a", "b"}, "name": "n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseYAML = %#v, expected %#v", got, want)
+	}
+}
+
+// TestParseYAMLErrors verifies malformed input is rejected with its line
+func TestParseYAMLErrors(t *testing.T) {
+	cases := map[string]string{
+		"duplicate key":       "a: 1\na: 2\n",
+		"bad indentation":     "a: 1\n   b: 2\n",
+		"not a mapping entry": "a: 1\njust text\n",
+		"flow mapping":        "a: {b: 1}\n",
+		"unterminated list":   "a: [1, 2\n",
+		"tab indentation":     "a:\n\tb: 1\n",
+	}
+	for name, source := range cases {
+		if _, err := parseYAML([]byte(source)); err == nil {
+			t.Errorf("%s: parseYAML(%q) succeeded, expected an error", name, source)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// The Yahoo! Cloud Serving Benchmark defines six core workloads over a
+// table of records, each operation its own transaction:
+//
+//	A  update heavy       50% read, 50% update               zipfian
+//	B  read mostly        95% read,  5% update               zipfian
+//	C  read only         100% read                           zipfian
+//	D  read latest        95% read,  5% insert               latest
+//	E  short ranges       95% scan,  5% insert               zipfian
+//	F  read-modify-write  50% read, 50% read-modify-write    zipfian
+//
+// Records are keys user000000, user000001, ... An update is a blind write
+// (OpWrite); a read-modify-write reads the value and writes it back
+// changed (OpUpdate). Requests are zipfian: a few records are hot, spread
+// across the key space by hashing their rank. Under "latest" the hot
+// records are the most recently inserted. The database only scans by
+// prefix, so a scan covers the ten records sharing all but the last digit
+// of its start key rather than YCSB's 1 to 100 records from it.
+
+// ycsbZipfS is the skew of the zipfian request distribution. YCSB uses
+// 0.99; math/rand's Zipf needs more than 1.
+const ycsbZipfS = 1.01
+
+// ycsbPreset is the definition of one core workload
+type ycsbPreset struct {
+	description                     string
+	read, update, insert, scan, rmw int // Percentages
+	latest                          bool
+}
+
+var ycsbPresets = map[string]ycsbPreset{
+	"A": {description: "update heavy", read: 50, update: 50},
+	"B": {description: "read mostly", read: 95, update: 5},
+	"C": {description: "read only", read: 100},
+	"D": {description: "read latest", read: 95, insert: 5, latest: true},
+	"E": {description: "short ranges", scan: 95, insert: 5},
+	"F": {description: "read-modify-write", read: 50, rmw: 50},
+}
+
+// YCSBWorkload generates one of the core YCSB workloads. One workload is
+// shared by all clients of a run, which insert records under consecutive
+// numbers.
+type YCSBWorkload struct {
+	Name   string // A to F
+	preset ycsbPreset
+	count  atomic.Int64 // Records loaded or handed out for insertion
+}
+
+// NewYCSBWorkload returns core workload name (A to F) over a table already
+// loaded with records records, as LoadYCSB loads it
+func NewYCSBWorkload(name string, records int) (*YCSBWorkload, error) {
+	preset, exists := ycsbPresets[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown YCSB workload %q: want A, B, C, D, E or F", name)
+	}
+	if records <= 0 {
+		return nil, fmt.Errorf("YCSB needs at least one record")
+	}
+	w := &YCSBWorkload{Name: name, preset: preset}
+	w.count.Store(int64(records))
+	return w, nil
+}
+
+// ycsbKey returns the key of record i
+func ycsbKey(i int64) string {
+	return fmt.Sprintf("user%06d", i)
+}
+
+// LoadYCSB bulk loads records records, each with the value 0, for the YCSB
+// workloads to run on
+func LoadYCSB(d *db.Database, records int) error {
+	initial := make(map[string]int, records)
+	for i := 0; i < records; i++ {
+		initial[ycsbKey(int64(i))] = 0
+	}
+	return d.BulkLoad(initial)
+}
+
+// chooseRecord picks the record an operation requests
+func (w *YCSBWorkload) chooseRecord(rng *rand.Rand) int64 {
+	n := w.count.Load()
+	if n == 1 {
+		return 0
+	}
+	rank := int64(rand.NewZipf(rng, ycsbZipfS, 1, uint64(n-1)).Uint64())
+	if w.preset.latest {
+		return n - 1 - rank
+	}
+	h := fnv.New64a()
+	fmt.Fprint(h, rank)
+	return int64(h.Sum64() % uint64(n))
+}
+
+func (w *YCSBWorkload) NextOperation(rng *rand.Rand) Operation {
+	p := w.preset
+	n := rng.Intn(100)
+	switch {
+	case n < p.insert:
+		return Operation{Kind: db.OpWrite, Key: ycsbKey(w.count.Add(1) - 1)}
+	case n < p.insert+p.scan:
+		key := ycsbKey(w.chooseRecord(rng))
+		return Operation{Kind: db.OpScan, Key: key[:len(key)-1]}
+	case n < p.insert+p.scan+p.update:
+		return Operation{Kind: db.OpWrite, Key: ycsbKey(w.chooseRecord(rng)), Value: rng.Intn(1000)}
+	case n < p.insert+p.scan+p.update+p.rmw:
+		return Operation{Kind: db.OpUpdate, Key: ycsbKey(w.chooseRecord(rng)), Value: 1}
+	default:
+		return Operation{Kind: db.OpRead, Key: ycsbKey(w.chooseRecord(rng))}
+	}
+}
+
+// YCSBWorkloadNames returns the core workload names in order
+func YCSBWorkloadNames() []string {
+	names := make([]string, 0, len(ycsbPresets))
+	for name := range ycsbPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RunYCSBScenario loads records records into d and runs core workload
+// name on them with numClients clients of opsPerClient operations each,
+// one operation per transaction. It reports throughput and the latency
+// of each kind of operation, which make runs on different engines
+// comparable; the load is left out of both. It passes if no loaded record
+// went missing.
+func RunYCSBScenario(ctx context.Context, d *db.Database, name string, records int, numClients int, opsPerClient int) ScenarioResult {
+	result := newScenarioResult("ycsb-"+name, d, map[string]any{
+		"workload": name, "records": records, "clients": numClients, "ops_per_client": opsPerClient,
+	})
+	workload, err := NewYCSBWorkload(name, records)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return result.finish(d)
+	}
+	result.Seed = db.NewRunSeed()
+
+	fmt.Printf("\n=== YCSB Workload %s (%s) ===\n", name, workload.preset.description)
+	if err := LoadYCSB(d, records); err != nil {
+		fmt.Printf("❌ Loading %d records failed: %v\n", records, err)
+		return result.finish(d)
+	}
+	fmt.Printf("Loaded %d records; %d clients run %d operations each on %s\n", records, numClients, opsPerClient, d.EngineName())
+
+	clients := make([]ClientConfig, numClients)
+	for i := range clients {
+		clients[i] = ClientConfig{
+			ID: i + 1, NumTransactions: opsPerClient, OperationsPerTx: 1,
+			Seed: result.Seed + int64(i+1), Workload: workload,
+		}
+	}
+	result.measureFrom(d)
+	start := time.Now()
+	completed := runWorkload(ctx, d, WorkloadConfig{}, clients, &result)
+	elapsed := time.Since(start)
+
+	stats := d.Stats().Since(*result.baseline)
+	throughput := float64(completed) / elapsed.Seconds()
+	fmt.Printf("YCSB %s on %s: %d operations in %v = %.0f ops/s (%d committed, %d aborted)\n",
+		name, d.EngineName(), completed, elapsed.Round(time.Millisecond), throughput,
+		stats.Commits, stats.Aborts)
+
+	present := d.GetRecordCount()
+	result.Passed = present >= records
+	if result.Passed {
+		fmt.Printf("✓ All %d loaded records present, %d records in all\n", records, present)
+	} else {
+		fmt.Printf("❌ Only %d of the %d loaded records present\n", present, records)
+	}
+
+	result.Metrics["throughput"] = throughput
+	result.Metrics["operations"] = float64(completed)
+	for kind, h := range stats.Latency {
+		result.Metrics[kind+"_p50_us"] = float64(h.P50) / float64(time.Microsecond)
+		result.Metrics[kind+"_p99_us"] = float64(h.P99) / float64(time.Microsecond)
+	}
+	return result.finish(d)
+}
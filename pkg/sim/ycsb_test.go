@@ -0,0 +1,89 @@
+package sim
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"database-sync-unsynchronized/pkg/db"
+)
+
+// TestYCSBWorkloadMixes verifies every core workload generates its kinds
+// of operation in its proportions
+func TestYCSBWorkloadMixes(t *testing.T) {
+	const ops = 10000
+	for _, name := range YCSBWorkloadNames() {
+		w, err := NewYCSBWorkload(name, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rng := rand.New(rand.NewSource(1))
+		counts := map[db.OpKind]int{}
+		for i := 0; i < ops; i++ {
+			counts[w.NextOperation(rng).Kind]++
+		}
+
+		p := ycsbPresets[name]
+		want := map[db.OpKind]int{db.OpRead: p.read, db.OpWrite: p.update + p.insert, db.OpScan: p.scan, db.OpUpdate: p.rmw}
+		for kind, percent := range want {
+			if got := 100 * counts[kind] / ops; got < percent-2 || got > percent+2 {
+				t.Errorf("workload %s: %d%% %v operations, expected %d%%", name, got, kind, percent)
+			}
+		}
+	}
+	if _, err := NewYCSBWorkload("G", 10); err == nil {
+		t.Error("workload G was accepted")
+	}
+}
+
+// TestYCSBRequestDistributions verifies zipfian requests concentrate on a
+// few records, and read-latest ones on the newest
+func TestYCSBRequestDistributions(t *testing.T) {
+	const records, ops = 1000, 10000
+	rng := rand.New(rand.NewSource(1))
+
+	zipfian, _ := NewYCSBWorkload("C", records)
+	hits := map[string]int{}
+	for i := 0; i < ops; i++ {
+		hits[zipfian.NextOperation(rng).Key]++
+	}
+	hottest := 0
+	for _, n := range hits {
+		hottest = max(hottest, n)
+	}
+	if hottest < ops/20 {
+		t.Errorf("hottest record read %d times of %d, expected a zipfian hot spot", hottest, ops)
+	}
+
+	latest, _ := NewYCSBWorkload("D", records)
+	recent := 0
+	reads := 0
+	for i := 0; i < ops; i++ {
+		op := latest.NextOperation(rng)
+		if op.Kind != db.OpRead {
+			continue
+		}
+		reads++
+		if op.Key >= ycsbKey(latest.count.Load()-records/10) {
+			recent++
+		}
+	}
+	if recent < reads/2 {
+		t.Errorf("%d of %d reads went to the newest tenth of the records, expected most", recent, reads)
+	}
+}
+
+// TestYCSBScenario verifies a run keeps every record and reports only the
+// run's own transactions, not the load
+func TestYCSBScenario(t *testing.T) {
+	result := RunYCSBScenario(context.Background(), db.NewMVCCDatabase(), "E", 200, 3, 40)
+	if !result.Passed || result.Partial {
+		t.Fatalf("result = %+v, expected a passing, complete run", result)
+	}
+	if got := result.Stats.Commits + result.Stats.Aborts; got != 120 {
+		t.Errorf("stats count %d transactions, expected the run's 120", got)
+	}
+	if result.Metrics["throughput"] <= 0 || result.Stats.Latency["scan"].Count == 0 {
+		t.Errorf("metrics = %v, expected throughput and scan latencies", result.Metrics)
+	}
+}